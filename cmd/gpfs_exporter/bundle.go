@@ -0,0 +1,148 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/prometheus/common/version"
+	"github.com/treydock/gpfs_exporter/collectors"
+)
+
+var (
+	diagnosticBundle         = kingpin.Flag("diagnostic-bundle", "Write a diagnostic bundle to this path (tar.gz) and exit").Default("").String()
+	diagnosticBundleScrape   = kingpin.Flag("diagnostic-bundle.scrape", "Include one scrape and the raw command output of enabled collectors in the diagnostic bundle").Default("true").Bool()
+	diagnosticBundleLogLines = kingpin.Flag("diagnostic-bundle.log-lines", "Number of log lines to include in the diagnostic bundle").Default("1000").Int()
+	redactedFlagPattern      = regexp.MustCompile(`(?i)(password|secret|token|key)`)
+)
+
+type bundleEntry struct {
+	name    string
+	content string
+}
+
+// logBuffer keeps the most recent log lines written to it.
+type logBuffer struct {
+	sync.Mutex
+	lines []string
+	max   int
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+	b.lines = append(b.lines, string(p))
+	if len(b.lines) > b.max {
+		b.lines = b.lines[len(b.lines)-b.max:]
+	}
+	return len(p), nil
+}
+
+func (b *logBuffer) String() string {
+	b.Lock()
+	defer b.Unlock()
+	return strings.Join(b.lines, "")
+}
+
+type teeLogger []log.Logger
+
+func (t teeLogger) Log(keyvals ...interface{}) error {
+	var err error
+	for _, l := range t {
+		if e := l.Log(keyvals...); e != nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func redactedConfig() string {
+	var lines []string
+	for _, f := range kingpin.CommandLine.Model().Flags {
+		if f.Name == "diagnostic-bundle" || f.Name == "help" || f.Name == "version" {
+			continue
+		}
+		value := f.Value.String()
+		if redactedFlagPattern.MatchString(f.Name) && value != "" {
+			value = "<redacted>"
+		}
+		lines = append(lines, fmt.Sprintf("--%s=%s", f.Name, value))
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func writeDiagnosticBundle(path string, logs *logBuffer, logger log.Logger) error {
+	entries := []bundleEntry{
+		{name: "version.txt", content: version.Print("gpfs_exporter") + "\n"},
+		{name: "config.txt", content: redactedConfig()},
+	}
+	if *diagnosticBundleScrape {
+		collectors.EnableCommandDump()
+		w := httptest.NewRecorder()
+		metricsHandler(logger)(w, httptest.NewRequest("GET", "/metrics", nil))
+		entries = append(entries, bundleEntry{name: "metrics.txt", content: w.Body.String()})
+		outputs := collectors.CommandOutputs()
+		var names []string
+		for name := range outputs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			entries = append(entries, bundleEntry{name: fmt.Sprintf("commands/%s.txt", name), content: outputs[name]})
+		}
+	}
+	entries = append(entries, bundleEntry{name: "logs.txt", content: logs.String()})
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+	now := time.Now()
+	for _, entry := range entries {
+		header := &tar.Header{
+			Name:    entry.name,
+			Mode:    0644,
+			Size:    int64(len(entry.content)),
+			ModTime: now,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := tw.Write([]byte(entry.content)); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gw.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,109 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/treydock/gpfs_exporter/collectors"
+)
+
+func TestWriteDiagnosticBundle(t *testing.T) {
+	collectors.MmgetstateExec = func(ctx context.Context) (string, error) {
+		return mmgetstateStdout, nil
+	}
+	collectors.MmpmonExec = func(ctx context.Context) (string, error) {
+		return mmpmonStdout, nil
+	}
+	collectors.MmdiagExec = func(arg string, ctx context.Context) (string, error) {
+		return configStdout, nil
+	}
+	path := filepath.Join(t.TempDir(), "bundle.tar.gz")
+	logs := &logBuffer{max: 2}
+	logger := log.NewLogfmtLogger(logs)
+	level.Info(logger).Log("msg", "dropped")
+	level.Info(logger).Log("msg", "first")
+	level.Info(logger).Log("msg", "second")
+	if err := writeDiagnosticBundle(path, logs, log.NewNopLogger()); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	tr := tar.NewReader(gr)
+	var names []string
+	contents := make(map[string]string)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Unexpected error: %s", err.Error())
+		}
+		b, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err.Error())
+		}
+		names = append(names, header.Name)
+		contents[header.Name] = string(b)
+	}
+	expected := []string{
+		"version.txt",
+		"config.txt",
+		"metrics.txt",
+		"commands/mmdiag-config.txt",
+		"commands/mmgetstate.txt",
+		"commands/mmpmon.txt",
+		"logs.txt",
+	}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Unexpected entries\nGot: %v\nExpected: %v", names, expected)
+	}
+	if contents["commands/mmgetstate.txt"] != mmgetstateStdout {
+		t.Errorf("Unexpected mmgetstate output: %s", contents["commands/mmgetstate.txt"])
+	}
+	if !strings.Contains(contents["metrics.txt"], "gpfs_state{state=\"active\"} 1") {
+		t.Errorf("Unexpected metrics: %s", contents["metrics.txt"])
+	}
+	if !strings.Contains(contents["config.txt"], "--collector.mmgetstate=true") {
+		t.Errorf("Unexpected config: %s", contents["config.txt"])
+	}
+	if strings.Contains(contents["logs.txt"], "dropped") || !strings.Contains(contents["logs.txt"], "second") {
+		t.Errorf("Unexpected logs: %s", contents["logs.txt"])
+	}
+}
+
+func TestRedactedConfig(t *testing.T) {
+	for _, line := range strings.Split(redactedConfig(), "\n") {
+		if redactedFlagPattern.MatchString(strings.Split(line, "=")[0]) && !strings.HasSuffix(line, "=") && !strings.HasSuffix(line, "=<redacted>") {
+			t.Errorf("Flag not redacted: %s", line)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/treydock/gpfs_exporter/collectors"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	configFile = kingpin.Flag("config.file",
+		"YAML file of collector.* flag values, flags set on the command line take precedence. Reloaded on SIGHUP or a POST to /-/reload").
+		Default("").String()
+	configReloadSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "gpfs_exporter_config_last_reload_successful",
+		Help: "Indicates the last load of the configuration file was successful",
+	})
+	configReloadTimestamp = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "gpfs_exporter_config_last_reload_success_timestamp_seconds",
+		Help: "Timestamp of the last successful load of the configuration file",
+	})
+	activeConfig = &exporterConfig{}
+)
+
+// exporterConfig holds the command line arguments and the flag values applied from the
+// configuration file. Scrapes hold the read lock so a reload changes flags between scrapes,
+// flags read outside of a scrape are guarded by collectors.FlagsLock.
+type exporterConfig struct {
+	sync.RWMutex
+	args   []string
+	values map[string]string
+}
+
+// readConfigFile returns the flag values of a configuration file, lists are joined with commas
+func readConfigFile(path string) (map[string]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]interface{}
+	if err := yaml.UnmarshalStrict(b, &raw); err != nil {
+		return nil, fmt.Errorf("Unable to parse %s: %w", path, err)
+	}
+	values := make(map[string]string)
+	for name, value := range raw {
+		switch v := value.(type) {
+		case nil:
+			values[name] = ""
+		case []interface{}:
+			var items []string
+			for _, item := range v {
+				items = append(items, fmt.Sprint(item))
+			}
+			values[name] = strings.Join(items, ",")
+		case map[interface{}]interface{}:
+			return nil, fmt.Errorf("Invalid value for %s in %s, expected a value or list", name, path)
+		default:
+			values[name] = fmt.Sprint(v)
+		}
+	}
+	return values, nil
+}
+
+// apply parses the command line again, which resets every flag to its default or command line
+// value, and then sets the values for flags not set on the command line
+func (c *exporterConfig) apply(values map[string]string) error {
+	parsed, err := kingpin.CommandLine.ParseContext(c.args)
+	if err != nil {
+		return err
+	}
+	set := make(map[string]bool)
+	for _, element := range parsed.Elements {
+		if flag, ok := element.Clause.(*kingpin.FlagClause); ok {
+			set[flag.Model().Name] = true
+		}
+	}
+	if _, err := kingpin.CommandLine.Parse(c.args); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if set[name] {
+			continue
+		}
+		if err := collectors.SetCollectorFlag(name, values[name]); err != nil {
+			return err
+		}
+	}
+	// The same validation as at startup so an invalid value keeps the previous configuration
+	for _, validate := range []func() error{
+		collectors.ValidateFilesystems,
+		collectors.ValidateRegexes,
+		collectors.ValidateConstLabels,
+		collectors.ValidateMmpmonRequests,
+	} {
+		if err := validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// load reads and applies the configuration file, on error the previous values are applied again
+func (c *exporterConfig) load() error {
+	c.Lock()
+	defer c.Unlock()
+	collectors.FlagsLock.Lock()
+	defer collectors.FlagsLock.Unlock()
+	if *configFile == "" {
+		return errors.New("No configuration file set with --config.file")
+	}
+	values, err := readConfigFile(*configFile)
+	if err == nil {
+		err = c.apply(values)
+	}
+	if err != nil {
+		configReloadSuccess.Set(0)
+		if restoreErr := c.apply(c.values); restoreErr != nil {
+			return fmt.Errorf("%w, restoring previous configuration failed: %s", err, restoreErr)
+		}
+		return err
+	}
+	c.values = values
+	configReloadSuccess.Set(1)
+	configReloadTimestamp.SetToCurrentTime()
+	return nil
+}
+
+// reloadConfig reloads the configuration file and logs the result
+func reloadConfig(logger log.Logger) error {
+	if err := activeConfig.load(); err != nil {
+		level.Error(logger).Log("msg", "Error reloading configuration file, keeping previous configuration", "err", err)
+		return err
+	}
+	level.Info(logger).Log("msg", "Reloaded configuration file")
+	return nil
+}
+
+func reloadHandler(logger log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			w.Write([]byte("reload requires POST"))
+			return
+		}
+		if err := reloadConfig(logger); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/treydock/gpfs_exporter/collectors"
+)
+
+func flagValue(name string) string {
+	return kingpin.CommandLine.GetFlag(name).Model().Value.String()
+}
+
+func TestReadConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := `
+collector.mmdf: true
+collector.mmdf.filesystems:
+  - project
+  - scratch
+collector.mmdf.timeout: 60
+collector.mmdf.pool-exclude: ""
+collector.mmlsqos.filesystems:
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	values, err := readConfigFile(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	expected := map[string]string{
+		"collector.mmdf":                "true",
+		"collector.mmdf.filesystems":    "project,scratch",
+		"collector.mmdf.timeout":        "60",
+		"collector.mmdf.pool-exclude":   "",
+		"collector.mmlsqos.filesystems": "",
+	}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("Unexpected values\nGot: %v\nExpected: %v", values, expected)
+	}
+	for _, content := range []string{"collector.mmdf: [", "collector.mmdf:\n  foo: bar\n"} {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := readConfigFile(path); err == nil {
+			t.Errorf("Expected error for %q", content)
+		}
+	}
+	if _, err := readConfigFile(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Errorf("Expected error for missing file")
+	}
+}
+
+func TestConfigReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer func() {
+		activeConfig = &exporterConfig{}
+		_, _ = kingpin.CommandLine.Parse([]string{})
+	}()
+	activeConfig = &exporterConfig{args: []string{"--config.file=" + path, "--collector.mmdf.timeout=99", "--collector.disable-defaults"}}
+	if _, err := kingpin.CommandLine.Parse(activeConfig.args); err != nil {
+		t.Fatal(err)
+	}
+	write("collector.mmdf: true\ncollector.mmdf.filesystems: [project, scratch]\ncollector.mmdf.timeout: 10\n")
+	if err := activeConfig.load(); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if val := flagValue("collector.mmdf.filesystems"); val != "project,scratch" {
+		t.Errorf("Unexpected filesystems %s", val)
+	}
+	if val := flagValue("collector.mmdf.timeout"); val != "99" {
+		t.Errorf("Command line flag did not take precedence, timeout %s", val)
+	}
+	if !collectors.CollectorEnabled("mmdf") || collectors.CollectorEnabled("mmgetstate") {
+		t.Errorf("Unexpected enabled collectors, mmdf %v mmgetstate %v", collectors.CollectorEnabled("mmdf"), collectors.CollectorEnabled("mmgetstate"))
+	}
+	if val := testutil.ToFloat64(configReloadSuccess); val != 1 {
+		t.Errorf("Unexpected reload success %v", val)
+	}
+
+	// A filesystem added to the file is used after a reload, removed values return to defaults
+	write("collector.mmlsqos: true\ncollector.mmlsqos.filesystems: [project]\n")
+	w := httptest.NewRecorder()
+	reloadHandler(log.NewNopLogger())(w, httptest.NewRequest("POST", "/-/reload", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Unexpected status %d: %s", w.Code, w.Body.String())
+	}
+	if val := flagValue("collector.mmdf.filesystems"); val != "" {
+		t.Errorf("Unexpected filesystems after reload %s", val)
+	}
+	if val := flagValue("collector.mmlsqos.filesystems"); val != "project" {
+		t.Errorf("Unexpected filesystems after reload %s", val)
+	}
+	if collectors.CollectorEnabled("mmdf") || !collectors.CollectorEnabled("mmlsqos") {
+		t.Errorf("Unexpected enabled collectors after reload")
+	}
+
+	// Errors keep the previous configuration
+	for _, content := range []string{
+		"collector.mmlsqos.timeout: foo\n",
+		"collector.foo: true\n",
+		"web.disable-exporter-metrics: true\n",
+		"collector.mmlsqos.filesystems: /fs/project\n",
+		"collector.filesystems-exclude: \"^(remote\"\n",
+		"collector.mmpmon.requests: nsd_ds\n",
+		"collector.mmlsqos: [\n",
+	} {
+		write(content)
+		w = httptest.NewRecorder()
+		reloadHandler(log.NewNopLogger())(w, httptest.NewRequest("POST", "/-/reload", nil))
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("Unexpected status %d for %q", w.Code, content)
+		}
+		if val := testutil.ToFloat64(configReloadSuccess); val != 0 {
+			t.Errorf("Unexpected reload success %v for %q", val, content)
+		}
+		if val := flagValue("collector.mmlsqos.filesystems"); val != "project" {
+			t.Errorf("Previous configuration not kept for %q, filesystems %s", content, val)
+		}
+		if !collectors.CollectorEnabled("mmlsqos") {
+			t.Errorf("Previous configuration not kept for %q, mmlsqos disabled", content)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	reloadHandler(log.NewNopLogger())(w, httptest.NewRequest("GET", "/-/reload", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Unexpected status %d for GET", w.Code)
+	}
+}
+
+func TestConfigReloadConcurrentSudoCheck(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("collector.mmdf: true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		activeConfig = &exporterConfig{}
+		_, _ = kingpin.CommandLine.Parse([]string{})
+	}()
+	activeConfig = &exporterConfig{args: []string{"--config.file=" + path, "--sudo.disable"}}
+	if _, err := kingpin.CommandLine.Parse(activeConfig.args); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			if err := collectors.CheckSudo(context.Background()); err != nil {
+				t.Errorf("Unexpected error: %s", err.Error())
+			}
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		if err := activeConfig.load(); err != nil {
+			t.Errorf("Unexpected error: %s", err.Error())
+		}
+	}
+	<-done
+}
@@ -0,0 +1,154 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+	"github.com/treydock/gpfs_exporter/collectors"
+)
+
+var (
+	serveCommand     = kingpin.Command("serve", "Start the exporter HTTP server").Default()
+	debugCommand     = kingpin.Command("debug", "Run a collector once, print the parsed command output as JSON and the metrics it emits, and exit")
+	debugCollector   = debugCommand.Arg("collector", "Name of the collector to run").Required().String()
+	debugFilesystems = debugCommand.Flag("fs", "Comma separated list of filesystems to limit a per filesystem collector to").Default("").String()
+)
+
+// jsonField is a struct field kept in declaration order when encoded
+type jsonField struct {
+	name  string
+	value interface{}
+}
+
+type jsonObject []jsonField
+
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("{")
+	for i, f := range o {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		name, _ := json.Marshal(f.name)
+		value, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteString(":")
+		buf.Write(value)
+	}
+	buf.WriteString("}")
+	return buf.Bytes(), nil
+}
+
+// debugValue converts parsed output for encoding as JSON. Struct fields, including unexported
+// fields, keep their order and NaN or infinite values, which JSON can not represent, are
+// encoded as strings.
+func debugValue(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Invalid:
+		return nil
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint()
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return strconv.FormatFloat(f, 'g', -1, 64)
+		}
+		return f
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return debugValue(v.Elem())
+	case reflect.Struct:
+		var o jsonObject
+		for i := 0; i < v.NumField(); i++ {
+			o = append(o, jsonField{name: v.Type().Field(i).Name, value: debugValue(v.Field(i))})
+		}
+		return o
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		items := make([]interface{}, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			items[i] = debugValue(v.Index(i))
+		}
+		return items
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		m := make(map[string]interface{})
+		iter := v.MapRange()
+		for iter.Next() {
+			m[fmt.Sprint(debugValue(iter.Key()))] = debugValue(iter.Value())
+		}
+		return m
+	default:
+		return v.String()
+	}
+}
+
+// runDebug runs the collector once without starting the HTTP server and writes the parsed
+// output of each command it ran as JSON followed by the metrics in text exposition format
+func runDebug(name string, filesystems []string, w io.Writer, logger log.Logger) error {
+	collectors.EnableCommandDump()
+	collector, err := collectors.NewProbeCollector(name, filesystems, logger)
+	if err != nil {
+		return err
+	}
+	registry := prometheus.NewRegistry()
+	if err := prometheus.WrapRegistererWith(collectors.ConstLabels(), registry).Register(collector); err != nil {
+		return err
+	}
+	mfs, err := registry.Gather()
+	if err != nil {
+		return err
+	}
+	parsed := make(map[string]interface{})
+	for command, v := range collectors.ParsedOutputs() {
+		parsed[command] = debugValue(reflect.ValueOf(v))
+	}
+	out, err := json.MarshalIndent(parsed, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%s\n\n", out)
+	for _, mf := range mfs {
+		if _, err := expfmt.MetricFamilyToText(w, mf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/treydock/gpfs_exporter/collectors"
+)
+
+func TestParseDebugCommand(t *testing.T) {
+	command, err := kingpin.CommandLine.Parse([]string{"debug", "mmdf", "--fs=fs1,fs2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_, _ = kingpin.CommandLine.Parse([]string{})
+	}()
+	if command != debugCommand.FullCommand() {
+		t.Errorf("Unexpected command: %s", command)
+	}
+	if *debugCollector != "mmdf" {
+		t.Errorf("Unexpected collector: %s", *debugCollector)
+	}
+	if *debugFilesystems != "fs1,fs2" {
+		t.Errorf("Unexpected filesystems: %s", *debugFilesystems)
+	}
+	command, err = kingpin.CommandLine.Parse([]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if command != serveCommand.FullCommand() {
+		t.Errorf("Unexpected default command: %s", command)
+	}
+}
+
+func TestRunDebug(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	collectors.MmgetstateExec = func(ctx context.Context) (string, error) {
+		return mmgetstateStdout, nil
+	}
+	var buf bytes.Buffer
+	if err := runDebug("mmgetstate", nil, &buf, log.NewNopLogger()); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	out := buf.String()
+	parsed, metrics, _ := strings.Cut(out, "\n\n")
+	var got map[string]interface{}
+	if err := json.Unmarshal([]byte(parsed), &got); err != nil {
+		t.Fatalf("Unexpected error decoding %s: %s", parsed, err.Error())
+	}
+	expected := map[string]interface{}{"mmgetstate": map[string]interface{}{"state": "active"}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Unexpected parsed output\nGot: %v\nExpected: %v", got, expected)
+	}
+	if !strings.Contains(metrics, "gpfs_state{state=\"active\"} 1") {
+		t.Errorf("Unexpected metrics: %s", metrics)
+	}
+}
+
+func TestRunDebugUnknownCollector(t *testing.T) {
+	var buf bytes.Buffer
+	if err := runDebug("foo", nil, &buf, log.NewNopLogger()); err == nil {
+		t.Errorf("Expected error for unknown collector")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Unexpected output: %s", buf.String())
+	}
+}
+
+func TestDebugValue(t *testing.T) {
+	type waiter struct {
+		Name    string
+		seconds float64
+		Counts  map[string]int
+	}
+	out, err := json.Marshal(debugValue(reflect.ValueOf([]waiter{
+		{Name: "a", seconds: math.NaN(), Counts: map[string]int{"x": 1}},
+		{Name: "b", seconds: 1.5},
+	})))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	expected := `[{"Name":"a","seconds":"NaN","Counts":{"x":1}},{"Name":"b","seconds":1.5,"Counts":null}]`
+	if string(out) != expected {
+		t.Errorf("Unexpected JSON\nGot: %s\nExpected: %s", out, expected)
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/treydock/gpfs_exporter/collectors"
+)
+
+var (
+	listMetricsFlag   = kingpin.Flag("list-metrics", "Print the metrics of every collector and exit").Default("false").Bool()
+	listMetricsFormat = kingpin.Flag("list-metrics.format", "Format of --list-metrics, text or json").Default("text").Enum("text", "json")
+)
+
+// listMetrics writes the metrics listed by collectors.ListMetrics as a table or as JSON
+func listMetrics(w io.Writer, format string) error {
+	metrics := collectors.ListMetrics()
+	if format == "json" {
+		out, err := json.MarshalIndent(metrics, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", out)
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tCOLLECTOR\tDEFAULT\tLABELS\tHELP")
+	for _, m := range metrics {
+		collector := m.Collector
+		if collector == "" {
+			collector = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%v\t%s\t%s\n", m.Name, collector, m.DefaultEnabled, strings.Join(m.Labels, ","), m.Help)
+	}
+	return tw.Flush()
+}
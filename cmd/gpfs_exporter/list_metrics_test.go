@@ -0,0 +1,50 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"testing"
+
+	"github.com/treydock/gpfs_exporter/collectors"
+)
+
+func TestListMetrics(t *testing.T) {
+	var buf bytes.Buffer
+	if err := listMetrics(&buf, "text"); err != nil {
+		t.Fatal(err)
+	}
+	for _, pattern := range []string{
+		`(?m)^NAME\s+COLLECTOR\s+DEFAULT\s+LABELS\s+HELP$`,
+		`(?m)^gpfs_state\s+mmgetstate\s+true\s+state\s+GPFS state$`,
+		`(?m)^gpfs_exporter_collect_error\s+-\s+true\s+collector\s+Indicates if error has occurred during collection$`,
+	} {
+		if !regexp.MustCompile(pattern).Match(buf.Bytes()) {
+			t.Errorf("Output does not match %s:\n%s", pattern, buf.String())
+		}
+	}
+	buf.Reset()
+	if err := listMetrics(&buf, "json"); err != nil {
+		t.Fatal(err)
+	}
+	var metrics []collectors.MetricInfo
+	if err := json.Unmarshal(buf.Bytes(), &metrics); err != nil {
+		t.Fatal(err)
+	}
+	if len(metrics) != len(collectors.ListMetrics()) {
+		t.Errorf("Unexpected number of metrics %d", len(metrics))
+	}
+}
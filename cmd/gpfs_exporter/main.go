@@ -14,15 +14,25 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/alecthomas/kingpin/v2"
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/prometheus/client_golang/prometheus"
+	promcollectors "github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/prometheus/common/promlog"
 	"github.com/prometheus/common/promlog/flag"
 	"github.com/prometheus/common/version"
@@ -34,31 +44,287 @@ import (
 var (
 	listenAddr             = ":9303"
 	disableExporterMetrics = kingpin.Flag("web.disable-exporter-metrics", "Exclude metrics about the exporter (promhttp_*, process_*, go_*)").Default("false").Bool()
+	shutdownGracePeriod    = kingpin.Flag("web.shutdown-grace-period", "How long to wait for running GPFS commands to exit on SIGTERM or SIGINT").Default("10s").Duration()
+	disableRequestLogging  = kingpin.Flag("web.disable-request-logging", "Do not log requests to /metrics and /probe").Default("false").Bool()
+	scrapeTimeoutOffset    = kingpin.Flag("web.scrape-timeout-offset", "Offset to subtract from the scrape timeout sent by Prometheus when limiting command timeouts").Default("500ms").Duration()
+	verifyReady            = collectors.Verify
+	ready                  atomic.Bool
+	shuttingDown           atomic.Bool
+	exporterGatherer       = prometheus.DefaultGatherer
+	readyMetric            = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "gpfs_exporter_ready",
+		Help: "Indicates the exporter has verified it can run GPFS commands",
+	}, func() float64 {
+		if ready.Load() {
+			return 1
+		}
+		return 0
+	})
+	requestLogs     = &requestLogLimiter{limit: 10, interval: time.Second}
+	scrapesInFlight atomic.Int64
+	scrapesTotal    = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "gpfs_exporter_scrapes_total",
+		Help: "Number of scrapes of the metrics endpoint",
+	})
+	scrapeOverlaps = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "gpfs_exporter_scrape_overlaps_total",
+		Help: "Number of scrapes that started while another scrape was still running",
+	})
+	scrapeDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "gpfs_exporter_scrape_duration_seconds",
+		Help:    "Histogram of the time taken to serve a scrape of the metrics endpoint",
+		Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600},
+	})
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "gpfs_exporter_http_requests_total",
+		Help: "Number of HTTP requests by handler and response code",
+	}, []string{"code", "handler"})
 )
 
+// requestLogLimiter allows up to limit request log lines each interval and reports how many
+// were suppressed once the next interval starts
+type requestLogLimiter struct {
+	sync.Mutex
+	limit      int
+	interval   time.Duration
+	start      time.Time
+	count      int
+	suppressed int
+}
+
+func (l *requestLogLimiter) allow(now time.Time, logger log.Logger) bool {
+	l.Lock()
+	defer l.Unlock()
+	if now.Sub(l.start) >= l.interval {
+		if l.suppressed > 0 {
+			level.Info(logger).Log("msg", "Suppressed request logs", "count", l.suppressed)
+		}
+		l.start = now
+		l.count = 0
+		l.suppressed = 0
+	}
+	if l.count >= l.limit {
+		l.suppressed++
+		return false
+	}
+	l.count++
+	return true
+}
+
+// statusRecorder records the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// requestLogger counts requests to handler in gpfs_exporter_http_requests_total and logs the
+// client, including the common name of a TLS client certificate, and the response of each request
+func requestLogger(handler string, next http.Handler, logger log.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		httpRequests.WithLabelValues(strconv.Itoa(rec.status), handler).Inc()
+		if *disableRequestLogging || !requestLogs.allow(start, logger) {
+			return
+		}
+		clientCN := ""
+		if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+			clientCN = r.TLS.PeerCertificates[0].Subject.CommonName
+		}
+		level.Info(logger).Log("msg", "Request", "remote", r.RemoteAddr, "client_cn", clientCN, "url", r.URL.RequestURI(),
+			"status", rec.status, "duration", time.Since(start).Seconds())
+	})
+}
+
+// exporterMetrics returns a registry of the Go and process metrics with the labels added
+func exporterMetrics(labels prometheus.Labels) *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	registerer := prometheus.WrapRegistererWith(labels, registry)
+	registerer.MustRegister(promcollectors.NewGoCollector(), promcollectors.NewProcessCollector(promcollectors.ProcessCollectorOpts{}))
+	return registry
+}
+
+// scrapeDeadline returns the deadline of a scrape from the X-Prometheus-Scrape-Timeout-Seconds header
+// less --web.scrape-timeout-offset, the deadline is zero when the header is not set or not valid
+func scrapeDeadline(r *http.Request, start time.Time, logger log.Logger) time.Time {
+	header := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds")
+	if header == "" {
+		return time.Time{}
+	}
+	seconds, err := strconv.ParseFloat(header, 64)
+	if err != nil || seconds <= 0 {
+		level.Warn(logger).Log("msg", "Invalid scrape timeout header", "value", header)
+		return time.Time{}
+	}
+	return start.Add(time.Duration(seconds*float64(time.Second)) - *scrapeTimeoutOffset)
+}
+
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok"))
+}
+
+// checkReady runs the readiness verification until it passes once
+func checkReady(logger log.Logger) bool {
+	if ready.Load() {
+		return true
+	}
+	if err := verifyReady(logger); err != nil {
+		level.Debug(logger).Log("msg", "Exporter is not ready", "err", err)
+		return false
+	}
+	level.Info(logger).Log("msg", "Exporter is ready")
+	ready.Store(true)
+	return true
+}
+
+func readyzHandler(logger log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkReady(logger) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("not ready"))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ready"))
+	}
+}
+
 func metricsHandler(logger log.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if shuttingDown.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("shutting down"))
+			return
+		}
+		activeConfig.RLock()
+		defer activeConfig.RUnlock()
+		start := time.Now()
+		scrapesTotal.Inc()
+		if scrapesInFlight.Add(1) > 1 {
+			scrapeOverlaps.Inc()
+		}
+		defer func() {
+			scrapesInFlight.Add(-1)
+			scrapeDuration.Observe(time.Since(start).Seconds())
+		}()
 		registry := prometheus.NewRegistry()
+		registerer := prometheus.WrapRegistererWith(collectors.ConstLabels(), registry)
+		registerer.MustRegister(collectors.CommandMetrics...)
+		registerer.MustRegister(collectors.CollectorDurationHistogram, collectors.EnabledCollectorsMetrics)
+		registerer.MustRegister(readyMetric, scrapesTotal, scrapeOverlaps, scrapeDuration, httpRequests)
+		registerer.MustRegister(configReloadSuccess, configReloadTimestamp, sudoOK)
 
+		deadline := scrapeDeadline(r, start, logger)
 		gpfsCollector := collectors.NewGPFSCollector(logger)
 		gpfsCollector.Lock()
 		defer gpfsCollector.Unlock()
 		for key, collector := range gpfsCollector.Collectors {
 			level.Debug(logger).Log("msg", fmt.Sprintf("Enabled collector %s", key))
-			registry.MustRegister(collector)
+			collectors.SetDeadline(collector, deadline)
+			registerer.MustRegister(collector)
 		}
 
 		gatherers := prometheus.Gatherers{registry}
 		if !*disableExporterMetrics {
-			gatherers = append(gatherers, prometheus.DefaultGatherer)
+			gatherers = append(gatherers, exporterGatherer)
 		}
 
 		// Delegate http serving to Prometheus client library, which will call collector.Collect.
-		h := promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{})
+		h := promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{EnableOpenMetrics: true})
+		h.ServeHTTP(w, r)
+	}
+}
+
+// probeHandler runs a single collector, limited to the filesystems in the fs parameter when given,
+// and reports gpfs_probe_success. An unknown collector or filesystem or a failed collection is
+// reported as a success of 0 rather than an HTTP error so Prometheus records the failure.
+func probeHandler(logger log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if shuttingDown.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("shutting down"))
+			return
+		}
+		activeConfig.RLock()
+		defer activeConfig.RUnlock()
+		params := r.URL.Query()
+		name := params.Get("collector")
+		filesystems := collectors.SplitList(strings.Join(params["fs"], ","))
+		probeLogger := log.With(logger, "probe", name, "fs", strings.Join(filesystems, ","))
+
+		registry := prometheus.NewRegistry()
+		registerer := prometheus.WrapRegistererWith(collectors.ConstLabels(), registry)
+		success := 0.0
+		collector, err := collectors.NewProbeCollector(name, filesystems, probeLogger)
+		if err != nil {
+			level.Error(probeLogger).Log("msg", "Unable to run probe", "err", err)
+		} else {
+			collectors.SetDeadline(collector, scrapeDeadline(r, time.Now(), probeLogger))
+			registerer.MustRegister(collector)
+		}
+		mfs, gatherErr := registry.Gather()
+		if gatherErr != nil {
+			level.Error(probeLogger).Log("msg", "Error gathering probe metrics", "err", gatherErr)
+		}
+		if err == nil && gatherErr == nil && !probeFailed(mfs) {
+			success = 1
+		}
+
+		successRegistry := prometheus.NewRegistry()
+		prometheus.WrapRegistererWith(collectors.ConstLabels(), successRegistry).MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "gpfs_probe_success",
+			Help: "Indicates the probe collector ran without error or timeout",
+		}, func() float64 {
+			return success
+		}))
+		gatherers := prometheus.Gatherers{
+			prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+				return mfs, nil
+			}),
+			successRegistry,
+		}
+		h := promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{EnableOpenMetrics: true})
 		h.ServeHTTP(w, r)
 	}
 }
 
+// probeFailed returns true if any collection in the probe reported an error or timeout
+func probeFailed(mfs []*dto.MetricFamily) bool {
+	for _, mf := range mfs {
+		if mf.GetName() != "gpfs_exporter_collect_error" && mf.GetName() != "gpfs_exporter_collect_timeout" {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			if m.GetGauge().GetValue() != 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// shutdown stops new scrapes, waits for running commands to exit and then stops the HTTP server
+func shutdown(server *http.Server, gracePeriod time.Duration, logger log.Logger) {
+	shuttingDown.Store(true)
+	level.Info(logger).Log("msg", "Shutting down, waiting for running commands to exit", "grace_period", gracePeriod)
+	if !collectors.WaitCommands(gracePeriod) {
+		level.Warn(logger).Log("msg", "GPFS commands still running after grace period")
+	}
+	// The HTTP server gets its own grace period so responses of running scrapes can be sent
+	ctx, cancel := context.WithTimeout(context.Background(), gracePeriod)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		level.Error(logger).Log("msg", "Error shutting down HTTP server", "err", err)
+	}
+}
+
 func main() {
 	var toolkitFlags = kingpinflag.AddFlags(kingpin.CommandLine, listenAddr)
 
@@ -66,26 +332,120 @@ func main() {
 	flag.AddFlags(kingpin.CommandLine, promlogConfig)
 	kingpin.Version(version.Print("gpfs_exporter"))
 	kingpin.HelpFlag.Short('h')
-	kingpin.Parse()
+	command := kingpin.Parse()
 
 	logger := promlog.New(promlogConfig)
+	collectors.SetFailureLogger(logger)
+	activeConfig.args = os.Args[1:]
+	if *configFile != "" {
+		if err := activeConfig.load(); err != nil {
+			level.Error(logger).Log("msg", "Error loading configuration file", "err", err)
+			os.Exit(1)
+		}
+	} else {
+		configReloadSuccess.Set(1)
+	}
+	if err := collectors.ValidateFilesystems(); err != nil {
+		level.Error(logger).Log("msg", err)
+		os.Exit(1)
+	}
+	if err := collectors.ValidateRegexes(); err != nil {
+		level.Error(logger).Log("msg", err)
+		os.Exit(1)
+	}
+	if err := collectors.ValidateConstLabels(); err != nil {
+		level.Error(logger).Log("msg", err)
+		os.Exit(1)
+	}
+	if err := collectors.ValidateMmpmonRequests(); err != nil {
+		level.Error(logger).Log("msg", err)
+		os.Exit(1)
+	}
+	if labels := collectors.ConstLabels(); len(labels) > 0 {
+		exporterGatherer = exporterMetrics(labels)
+	}
+	if *listMetricsFlag {
+		if err := listMetrics(os.Stdout, *listMetricsFormat); err != nil {
+			level.Error(logger).Log("msg", "Unable to list metrics", "err", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	if err := collectors.ValidateSudo(); err != nil {
+		level.Error(logger).Log("msg", err)
+		os.Exit(1)
+	}
+	collectors.CheckGpfsBinPath(logger)
+	if command == debugCommand.FullCommand() {
+		if err := runDebug(*debugCollector, collectors.SplitList(*debugFilesystems), os.Stdout, logger); err != nil {
+			level.Error(logger).Log("msg", "Unable to run collector", "collector", *debugCollector, "err", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	if *diagnosticBundle != "" {
+		logs := &logBuffer{max: *diagnosticBundleLogLines}
+		logger = teeLogger{logger, log.With(log.NewLogfmtLogger(logs), "ts", log.DefaultTimestampUTC)}
+		level.Info(logger).Log("msg", "Writing diagnostic bundle", "path", *diagnosticBundle, "version", version.Info())
+		if err := writeDiagnosticBundle(*diagnosticBundle, logs, logger); err != nil {
+			level.Error(logger).Log("msg", "Error writing diagnostic bundle", "err", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	collectors.SetParentContext(ctx)
+	if err := checkSudo(ctx, logger); err != nil && *requireSudo {
+		os.Exit(1)
+	}
+	collectors.DetectRoles(logger)
+	if err := collectors.CheckFilesystemsExist(logger); err != nil {
+		level.Error(logger).Log("msg", err)
+		os.Exit(1)
+	}
 	level.Info(logger).Log("msg", "Starting gpfs_exporter", "version", version.Info())
 	level.Info(logger).Log("msg", "Build context", "build_context", version.BuildContext())
 	level.Info(logger).Log("msg", "Starting Server", "address", listenAddr)
 
-	http.Handle("/metrics", metricsHandler(logger))
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			reloadConfig(logger)
+		}
+	}()
+
+	go checkReady(logger)
+	go recheckSudo(ctx, *sudoCheckInterval, logger)
+
+	http.Handle("/metrics", requestLogger("/metrics", metricsHandler(logger), logger))
+	http.Handle("/probe", requestLogger("/probe", probeHandler(logger), logger))
+	http.Handle("/-/reload", reloadHandler(logger))
+	http.HandleFunc("/healthz", healthzHandler)
+	http.Handle("/readyz", readyzHandler(logger))
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(`<html>
              <head><title>GPFS Exporter</title></head>
              <body>
              <h1>GPFS Metrics Exporter</h1>
              <p><a href='/metrics'>Metrics</a></p>
+             <p><a href='/probe?collector=mmgetstate'>Probe</a></p>
              </body>
              </html>`))
 	})
 	server := &http.Server{}
-	if err := web.ListenAndServe(server, toolkitFlags, logger); err != nil {
-		level.Error(logger).Log("err", err)
-		os.Exit(1)
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- web.ListenAndServe(server, toolkitFlags, logger)
+	}()
+	select {
+	case err := <-serverErr:
+		if err != nil && err != http.ErrServerClosed {
+			level.Error(logger).Log("err", err)
+			os.Exit(1)
+		}
+	case <-ctx.Done():
+		shutdown(server, *shutdownGracePeriod, logger)
 	}
 }
@@ -14,17 +14,25 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/alecthomas/kingpin/v2"
 	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/treydock/gpfs_exporter/collectors"
 )
 
@@ -49,9 +57,15 @@ mmdiag:config:0:1:::pagepool:4294967296:static:
 mmdiag:config:0:1:::pagepoolMaxPhysMemPct:75::
 mmdiag:config:0:1:::parallelMetadataWrite:0::
 `
+	mmgetstateExec = collectors.MmgetstateExec
+	mmpmonExec     = collectors.MmpmonExec
+	mmdiagExec     = collectors.MmdiagExec
 )
 
 func TestMain(m *testing.M) {
+	mmgetstateExec = collectors.MmgetstateExec
+	mmpmonExec = collectors.MmpmonExec
+	mmdiagExec = collectors.MmdiagExec
 	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
 		os.Exit(1)
 	}
@@ -88,6 +102,400 @@ func TestMetricsHandler(t *testing.T) {
 	if !strings.Contains(body, "gpfs_exporter_collect_error{collector=\"mount\"} 0") {
 		t.Errorf("Unexpected value for gpfs_exporter_collect_error")
 	}
+	if !strings.Contains(body, "gpfs_exporter_collector_duration_seconds_histogram_count{collector=\"mount\"}") {
+		t.Errorf("Expected gpfs_exporter_collector_duration_seconds_histogram for mount")
+	}
+}
+
+func TestMetricsHandlerScrapeTimeout(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.mmgetstate.timeout=60"}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_, _ = kingpin.CommandLine.Parse([]string{})
+	}()
+	collectors.MmgetstateExec = func(ctx context.Context) (string, error) {
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(30 * time.Second):
+			return mmgetstateStdout, nil
+		}
+	}
+	defer func() {
+		collectors.MmgetstateExec = func(ctx context.Context) (string, error) {
+			return mmgetstateStdout, nil
+		}
+	}()
+	r := httptest.NewRequest("GET", "/metrics", nil)
+	r.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", "1")
+	w := httptest.NewRecorder()
+	start := time.Now()
+	metricsHandler(log.NewNopLogger())(w, r)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Scrape was not limited by the scrape timeout, took %s", elapsed)
+	}
+	if !strings.Contains(w.Body.String(), "gpfs_exporter_collect_timeout{collector=\"mmgetstate\"} 1") {
+		t.Errorf("Expected mmgetstate timeout, got:\n%s", w.Body.String())
+	}
+}
+
+func TestScrapeDeadline(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	tests := []struct {
+		header   string
+		expected time.Time
+	}{
+		{header: "", expected: time.Time{}},
+		{header: "foo", expected: time.Time{}},
+		{header: "-1", expected: time.Time{}},
+		{header: "10", expected: start.Add(9500 * time.Millisecond)},
+		{header: "2.5", expected: start.Add(2 * time.Second)},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/metrics", nil)
+		if test.header != "" {
+			r.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", test.header)
+		}
+		if deadline := scrapeDeadline(r, start, log.NewNopLogger()); !deadline.Equal(test.expected) {
+			t.Errorf("Unexpected deadline for %q, got %v expected %v", test.header, deadline, test.expected)
+		}
+	}
+}
+
+func TestMetricsHandlerFixtures(t *testing.T) {
+	dir := t.TempDir()
+	fixtures := map[string]string{
+		"mmgetstate.out":    mmgetstateStdout,
+		"mmpmon-s.out":      mmpmonStdout,
+		"mmdiag-config.out": configStdout,
+	}
+	for name, out := range fixtures {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(out), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := kingpin.CommandLine.Parse([]string{"--command.fixture-dir=" + dir}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_, _ = kingpin.CommandLine.Parse([]string{})
+	}()
+	collectors.MmgetstateExec = mmgetstateExec
+	collectors.MmpmonExec = mmpmonExec
+	collectors.MmdiagExec = mmdiagExec
+	body, err := queryExporter()
+	if err != nil {
+		t.Fatalf("Unexpected error GET /metrics: %s", err.Error())
+	}
+	for _, collector := range []string{"mmgetstate", "mmpmon", "config"} {
+		if !strings.Contains(body, fmt.Sprintf("gpfs_exporter_collect_error{collector=\"%s\"} 0", collector)) {
+			t.Errorf("Unexpected value for gpfs_exporter_collect_error for %s", collector)
+		}
+	}
+	for _, metric := range []string{
+		`gpfs_state{state="active"} 1`,
+		`gpfs_perf_read_bytes_total{fs="scratch"} 2.05607400434e+11`,
+		`gpfs_config_page_pool_bytes 4.294967296e+09`,
+	} {
+		if !strings.Contains(body, metric) {
+			t.Errorf("Expected metric %s in output:\n%s", metric, body)
+		}
+	}
+}
+
+func TestMetricsHandlerOpenMetrics(t *testing.T) {
+	collectors.MmgetstateExec = func(ctx context.Context) (string, error) {
+		return mmgetstateStdout, nil
+	}
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text; version=0.0.1")
+	rec := httptest.NewRecorder()
+	metricsHandler(log.NewNopLogger())(rec, req)
+	if contentType := rec.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "application/openmetrics-text") {
+		t.Errorf("Unexpected Content-Type %s", contentType)
+	}
+	if !strings.HasSuffix(rec.Body.String(), "# EOF\n") {
+		t.Errorf("Expected OpenMetrics EOF marker:\n%s", rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	metricsHandler(log.NewNopLogger())(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if contentType := rec.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain") {
+		t.Errorf("Unexpected Content-Type %s", contentType)
+	}
+}
+
+func TestMetricsHandlerScrapeOverlap(t *testing.T) {
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	collectors.MmgetstateExec = func(ctx context.Context) (string, error) {
+		started <- struct{}{}
+		<-release
+		return mmgetstateStdout, nil
+	}
+	defer func() {
+		collectors.MmgetstateExec = func(ctx context.Context) (string, error) {
+			return mmgetstateStdout, nil
+		}
+	}()
+	server := httptest.NewServer(metricsHandler(log.NewNopLogger()))
+	defer server.Close()
+	scrapes := testutil.ToFloat64(scrapesTotal)
+	overlaps := testutil.ToFloat64(scrapeOverlaps)
+	var wg sync.WaitGroup
+	scrape := func() {
+		defer wg.Done()
+		resp, err := http.Get(server.URL)
+		if err != nil {
+			t.Errorf("Unexpected error GET /metrics: %s", err.Error())
+			return
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	wg.Add(1)
+	go scrape()
+	<-started
+	wg.Add(1)
+	go scrape()
+	for i := 0; scrapesInFlight.Load() < 2 && i < 100; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+	if val := testutil.ToFloat64(scrapesTotal) - scrapes; val != 2 {
+		t.Errorf("Unexpected scrapes %v, expected 2", val)
+	}
+	if val := testutil.ToFloat64(scrapeOverlaps) - overlaps; val != 1 {
+		t.Errorf("Unexpected scrape overlaps %v, expected 1", val)
+	}
+	if val := scrapesInFlight.Load(); val != 0 {
+		t.Errorf("Unexpected scrapes in flight %d", val)
+	}
+
+	rec := httptest.NewRecorder()
+	metricsHandler(log.NewNopLogger())(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, name := range []string{"gpfs_exporter_scrapes_total", "gpfs_exporter_scrape_overlaps_total", "gpfs_exporter_scrape_duration_seconds_count"} {
+		if !strings.Contains(rec.Body.String(), name) {
+			t.Errorf("Expected %s in output", name)
+		}
+	}
+}
+
+func TestMetricsHandlerConstLabels(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--metrics.const-labels=cluster=ess01,site=dc2"}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_, _ = kingpin.CommandLine.Parse([]string{})
+	}()
+	collectors.MmgetstateExec = func(ctx context.Context) (string, error) {
+		return mmgetstateStdout, nil
+	}
+	rec := httptest.NewRecorder()
+	metricsHandler(log.NewNopLogger())(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, metric := range []string{
+		`gpfs_state{cluster="ess01",site="dc2",state="active"} 1`,
+		`gpfs_exporter_collect_error{cluster="ess01",collector="mount",site="dc2"} 0`,
+		`gpfs_exporter_ready{cluster="ess01",site="dc2"}`,
+	} {
+		if !strings.Contains(rec.Body.String(), metric) {
+			t.Errorf("Expected metric %s in output:\n%s", metric, rec.Body.String())
+		}
+	}
+	mfs, err := exporterMetrics(collectors.ConstLabels()).Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			labels := make(map[string]string)
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			if labels["cluster"] != "ess01" || labels["site"] != "dc2" {
+				t.Errorf("Expected const labels on %s, got %v", mf.GetName(), labels)
+			}
+		}
+	}
+}
+
+func TestProbeHandler(t *testing.T) {
+	mmdfStdout, err := os.ReadFile(filepath.Join("..", "..", "collectors", "testdata", "e2e", "5.1", "commands", "mmdf-project.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mmlsfsExec := collectors.MmlsfsExec
+	mmdfExec := collectors.MmdfExec
+	defer func() {
+		collectors.MmlsfsExec = mmlsfsExec
+		collectors.MmdfExec = mmdfExec
+	}()
+	collectors.MmlsfsExec = func(ctx context.Context) (string, error) {
+		return "fs::HEADER:version:reserved:reserved:deviceName:fieldName:data:remarks:\nmmlsfs::0:1:::project:defaultMountPoint:%2Ffs%2Fproject::\n", nil
+	}
+	var probed []string
+	collectors.MmdfExec = func(fs string, ctx context.Context) (string, error) {
+		probed = append(probed, fs)
+		return string(mmdfStdout), nil
+	}
+	collectors.MmgetstateExec = func(ctx context.Context) (string, error) {
+		return mmgetstateStdout, nil
+	}
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{"collector=mmdf&fs=project", []string{"gpfs_probe_success 1", `gpfs_exporter_collect_error{collector="mmdf-project"} 0`}},
+		{"collector=mmgetstate", []string{"gpfs_probe_success 1", `gpfs_state{state="active"} 1`}},
+		{"collector=foo", []string{"gpfs_probe_success 0"}},
+		{"collector=mmdf&fs=scratch", []string{"gpfs_probe_success 0"}},
+		{"collector=mmgetstate&fs=project", []string{"gpfs_probe_success 0"}},
+	}
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		probeHandler(log.NewNopLogger())(rec, httptest.NewRequest(http.MethodGet, "/probe?"+test.query, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("Unexpected status code %d for %s", rec.Code, test.query)
+		}
+		for _, metric := range test.expected {
+			if !strings.Contains(rec.Body.String(), metric) {
+				t.Errorf("Expected metric %s for %s in output:\n%s", metric, test.query, rec.Body.String())
+			}
+		}
+	}
+	if len(probed) != 1 || probed[0] != "project" {
+		t.Errorf("Unexpected filesystems probed with mmdf: %v", probed)
+	}
+	collectors.MmgetstateExec = func(ctx context.Context) (string, error) {
+		return "", fmt.Errorf("Error")
+	}
+	rec := httptest.NewRecorder()
+	probeHandler(log.NewNopLogger())(rec, httptest.NewRequest(http.MethodGet, "/probe?collector=mmgetstate", nil))
+	if !strings.Contains(rec.Body.String(), "gpfs_probe_success 0") {
+		t.Errorf("Expected failed probe in output:\n%s", rec.Body.String())
+	}
+}
+
+func TestRequestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.NewLogfmtLogger(&buf)
+	handler := requestLogger("/probe", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}), logger)
+	before := testutil.ToFloat64(httpRequests.WithLabelValues("503", "/probe"))
+	req := httptest.NewRequest(http.MethodGet, "/probe?collector=mmdf&fs=project", nil)
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "prometheus"}}}}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Unexpected status %d", rec.Code)
+	}
+	if val := testutil.ToFloat64(httpRequests.WithLabelValues("503", "/probe")) - before; val != 1 {
+		t.Errorf("Unexpected requests %v", val)
+	}
+	for _, expected := range []string{"client_cn=prometheus", `url="/probe?collector=mmdf&fs=project"`, "status=503", "remote=192.0.2.1:1234"} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("Expected %s in log:\n%s", expected, buf.String())
+		}
+	}
+
+	buf.Reset()
+	varTrue := true
+	disableRequestLogging = &varTrue
+	defer func() {
+		varFalse := false
+		disableRequestLogging = &varFalse
+	}()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/probe", nil))
+	if buf.Len() != 0 {
+		t.Errorf("Unexpected log with request logging disabled:\n%s", buf.String())
+	}
+	if val := testutil.ToFloat64(httpRequests.WithLabelValues("503", "/probe")) - before; val != 2 {
+		t.Errorf("Unexpected requests %v", val)
+	}
+}
+
+func TestRequestLogLimiter(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.NewLogfmtLogger(&buf)
+	limiter := &requestLogLimiter{limit: 2, interval: time.Second}
+	now := time.Now()
+	allowed := 0
+	for i := 0; i < 5; i++ {
+		if limiter.allow(now, logger) {
+			allowed++
+		}
+	}
+	if allowed != 2 {
+		t.Errorf("Unexpected allowed %d, expected 2", allowed)
+	}
+	if !limiter.allow(now.Add(time.Second), logger) {
+		t.Errorf("Expected log to be allowed in next interval")
+	}
+	if !strings.Contains(buf.String(), "count=3") {
+		t.Errorf("Expected suppressed count in log:\n%s", buf.String())
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	defer shuttingDown.Store(false)
+	server := &http.Server{}
+	shutdown(server, time.Second, log.NewNopLogger())
+	rec := httptest.NewRecorder()
+	metricsHandler(log.NewNopLogger())(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Unexpected status code %d, expected %d", rec.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestHealthzHandler(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	rec := httptest.NewRecorder()
+	healthzHandler(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Unexpected status code %d", rec.Code)
+	}
+}
+
+func TestReadyzHandler(t *testing.T) {
+	defer func(orig func(log.Logger) error) {
+		verifyReady = orig
+		ready.Store(false)
+	}(verifyReady)
+	ready.Store(false)
+	var verifyErr error = fmt.Errorf("Error")
+	verifyReady = func(logger log.Logger) error {
+		return verifyErr
+	}
+	handler := readyzHandler(log.NewNopLogger())
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Unexpected status code %d, expected %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	if val := testutil.ToFloat64(readyMetric); val != 0 {
+		t.Errorf("Unexpected gpfs_exporter_ready %v", val)
+	}
+	verifyErr = nil
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Unexpected status code %d, expected %d", rec.Code, http.StatusOK)
+	}
+	if val := testutil.ToFloat64(readyMetric); val != 1 {
+		t.Errorf("Unexpected gpfs_exporter_ready %v", val)
+	}
+	// Readiness is only verified until it passes once
+	verifyErr = fmt.Errorf("Error")
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Unexpected status code %d, expected %d", rec.Code, http.StatusOK)
+	}
 }
 
 func queryExporter() (string, error) {
@@ -0,0 +1,75 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/treydock/gpfs_exporter/collectors"
+)
+
+var (
+	requireSudo = kingpin.Flag("startup.require-sudo",
+		"Exit at startup when GPFS commands can not be run through --sudo.command without a password").Default("false").Bool()
+	sudoCheckInterval = kingpin.Flag("startup.sudo-check-interval",
+		"How often to check again that GPFS commands can be run through --sudo.command, 0 disables the periodic check").Default("5m").Duration()
+	sudoCheckTimeout = 5 * time.Second
+	checkSudoExec    = collectors.CheckSudo
+	sudoOK           = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "gpfs_exporter_sudo_ok",
+		Help: "Indicates the last check that GPFS commands can be run through sudo without a password passed",
+	})
+)
+
+// checkSudo checks that GPFS commands can be run through sudo and sets gpfs_exporter_sudo_ok
+func checkSudo(ctx context.Context, logger log.Logger) error {
+	ctx, cancel := context.WithTimeout(ctx, sudoCheckTimeout)
+	defer cancel()
+	err := checkSudoExec(ctx)
+	if err == nil {
+		sudoOK.Set(1)
+		return nil
+	}
+	sudoOK.Set(0)
+	reason := "other"
+	var sudoErr *collectors.SudoError
+	if errors.As(err, &sudoErr) {
+		reason = sudoErr.Reason
+	}
+	level.Error(logger).Log("msg", "Unable to run GPFS commands through sudo without a password", "reason", reason, "err", err)
+	return err
+}
+
+// recheckSudo runs checkSudo every interval until ctx is done
+func recheckSudo(ctx context.Context, interval time.Duration, logger log.Logger) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			checkSudo(ctx, logger)
+		}
+	}
+}
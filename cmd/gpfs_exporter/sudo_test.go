@@ -0,0 +1,67 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/treydock/gpfs_exporter/collectors"
+)
+
+func TestCheckSudo(t *testing.T) {
+	defer func() { checkSudoExec = collectors.CheckSudo }()
+	checkSudoExec = func(ctx context.Context) error {
+		return nil
+	}
+	if err := checkSudo(context.Background(), log.NewNopLogger()); err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+	if val := testutil.ToFloat64(sudoOK); val != 1 {
+		t.Errorf("Unexpected gpfs_exporter_sudo_ok %v", val)
+	}
+	checkSudoExec = func(ctx context.Context) error {
+		return &collectors.SudoError{Reason: "password_required", Output: "sudo: a password is required"}
+	}
+	if err := checkSudo(context.Background(), log.NewNopLogger()); err == nil {
+		t.Errorf("Expected error")
+	}
+	if val := testutil.ToFloat64(sudoOK); val != 0 {
+		t.Errorf("Unexpected gpfs_exporter_sudo_ok %v", val)
+	}
+}
+
+func TestRecheckSudo(t *testing.T) {
+	defer func() { checkSudoExec = collectors.CheckSudo }()
+	var checks atomic.Int64
+	checkSudoExec = func(ctx context.Context) error {
+		checks.Add(1)
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	recheckSudo(ctx, 10*time.Millisecond, log.NewNopLogger())
+	if checks.Load() == 0 {
+		t.Errorf("Expected sudo to be checked again")
+	}
+	checks.Store(0)
+	recheckSudo(context.Background(), 0, log.NewNopLogger())
+	if checks.Load() != 0 {
+		t.Errorf("Unexpected check with interval 0")
+	}
+}
@@ -14,73 +14,474 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/alecthomas/kingpin/v2"
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
-	"github.com/gofrs/flock"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
 	dto "github.com/prometheus/client_model/go"
 	"github.com/prometheus/common/expfmt"
 	"github.com/prometheus/common/promlog"
 	"github.com/prometheus/common/promlog/flag"
 	"github.com/prometheus/common/version"
 	"github.com/treydock/gpfs_exporter/collectors"
+	"github.com/treydock/gpfs_exporter/internal/textfile"
 )
 
 var (
-	output   = kingpin.Flag("output", "Path to node exporter collected file").Required().String()
-	lockFile = kingpin.Flag("lockfile", "Lock file path").Default("/tmp/gpfs_mmdf_exporter.lock").String()
+	output           = kingpin.Flag("output", "Path to node exporter collected file, a path ending with / is treated as --output-dir").String()
+	outputDir        = kingpin.Flag("output-dir", "Directory to write one node exporter collected file per collector and filesystem").String()
+	outputFormat     = kingpin.Flag("output.format", "Format of the output, one of prometheus or openmetrics").Default("prometheus").Enum("prometheus", "openmetrics")
+	outputTimestamps = kingpin.Flag("output.timestamps", "Add the collection time as the timestamp of each sample in the output").Default("false").Bool()
+	pushURL          = kingpin.Flag("push.url", "URL of Pushgateway to push metrics to after a successful collection").String()
+	pushJob          = kingpin.Flag("push.job", "Job name used when pushing metrics").Default("gpfs_mmdf_exporter").String()
+	pushGrouping     = kingpin.Flag("push.grouping", "Grouping label used when pushing metrics, in the form name=value, may be repeated").StringMap()
+	pushBasicAuth    = kingpin.Flag("push.basic-auth-file", "File containing username:password used to authenticate when pushing metrics").String()
+	lockFile         = kingpin.Flag("lockfile", "Lock file path").Default("/tmp/gpfs_mmdf_exporter.lock").String()
+	lockStaleTimeout = kingpin.Flag("lockfile-stale-timeout", "Duration after which a held lock is considered stale and broken unless its owner is still running, 0 disables").Default("0s").Duration()
+	lockWaitSeconds  float64
+	collectTime      time.Time
 )
 
-func writeMetrics(mfs []*dto.MetricFamily, logger log.Logger) error {
-	tmp, err := os.CreateTemp(filepath.Dir(*output), filepath.Base(*output))
+// globalOutput is the file in the output directory for metrics not specific to a filesystem
+const globalOutput = "gpfs_mmdf_exporter.prom"
+
+func writeMetrics(mfs []*dto.MetricFamily, failures []string, logger log.Logger) error {
+	success := len(failures) == 0
+	status, err := textfile.StatusMetrics(success, collectors.ConstLabels())
+	if err != nil {
+		level.Error(logger).Log("msg", "Error generating status metrics", "err", err)
+		return err
+	}
+	if *outputTimestamps {
+		timestampMetrics(status, collectTime)
+	}
+	mfs, err = normalizeMetrics(textfile.AppendStatus(mfs, status), logger)
 	if err != nil {
-		level.Error(logger).Log("msg", "Unable to create temp file", "err", err)
+		level.Error(logger).Log("msg", "Error normalizing metrics", "err", err)
 		return err
 	}
-	defer os.Remove(tmp.Name())
+	if dir := outputDirectory(); dir != "" {
+		if err := writeOutputDir(dir, mfs, failures, logger); err != nil {
+			return err
+		}
+	} else if *output != "" {
+		if err := writeOutput(*output, mfs, logger); err != nil {
+			return err
+		}
+	}
+	if *pushURL != "" && success {
+		if err := pushMetrics(mfs, logger); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// normalizeMetrics merges families with the same name, keeping the first of any repeated series,
+// and sorts families by name and series by labels so the output does not change order between runs.
+func normalizeMetrics(mfs []*dto.MetricFamily, logger log.Logger) ([]*dto.MetricFamily, error) {
+	families := make(map[string]*dto.MetricFamily)
+	seen := make(map[string]map[string]bool)
+	names := []string{}
 	for _, mf := range mfs {
-		if _, err := expfmt.MetricFamilyToText(tmp, mf); err != nil {
-			level.Error(logger).Log("msg", "Error generating metric text", "err", err)
+		name := mf.GetName()
+		family, ok := families[name]
+		if !ok {
+			family = &dto.MetricFamily{Name: mf.Name, Help: mf.Help, Type: mf.Type}
+			families[name] = family
+			seen[name] = make(map[string]bool)
+			names = append(names, name)
+		} else {
+			if family.GetType() != mf.GetType() {
+				return nil, fmt.Errorf("Metric family %s has conflicting types %s and %s", name, family.GetType(), mf.GetType())
+			}
+			level.Warn(logger).Log("msg", "Merging duplicate metric family", "name", name)
+		}
+		for _, m := range mf.GetMetric() {
+			key := labelsKey(m)
+			if seen[name][key] {
+				level.Warn(logger).Log("msg", "Dropping duplicate series", "name", name, "labels", key)
+				continue
+			}
+			seen[name][key] = true
+			family.Metric = append(family.Metric, m)
+		}
+	}
+	sort.Strings(names)
+	newMfs := make([]*dto.MetricFamily, 0, len(names))
+	for _, name := range names {
+		mf := families[name]
+		sort.Slice(mf.Metric, func(i, j int) bool {
+			return labelsKey(mf.Metric[i]) < labelsKey(mf.Metric[j])
+		})
+		newMfs = append(newMfs, mf)
+	}
+	return newMfs, nil
+}
+
+// validateOutput parses the encoded output so a file node exporter can not parse is never written
+func validateOutput(content []byte) error {
+	if *outputFormat == "openmetrics" {
+		content = openMetricsToText(content)
+	}
+	parser := expfmt.TextParser{}
+	if _, err := parser.TextToMetricFamilies(bytes.NewReader(content)); err != nil {
+		return fmt.Errorf("Invalid metrics output: %w", err)
+	}
+	return nil
+}
+
+// outputDirectory returns the directory used to write one file per collector and filesystem,
+// either --output-dir or --output when it ends with a trailing slash.
+func outputDirectory() string {
+	if *outputDir != "" {
+		return *outputDir
+	}
+	if strings.HasSuffix(*output, "/") {
+		return *output
+	}
+	return ""
+}
+
+func readBasicAuth(path string) (string, string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", err
+	}
+	username, password, found := strings.Cut(strings.TrimSpace(string(content)), ":")
+	if !found {
+		return "", "", fmt.Errorf("Basic auth file %s must contain username:password", path)
+	}
+	return username, password, nil
+}
+
+func pushMetrics(mfs []*dto.MetricFamily, logger log.Logger) error {
+	gatherer := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		return mfs, nil
+	})
+	pusher := push.New(*pushURL, *pushJob).Gatherer(gatherer)
+	for name, value := range *pushGrouping {
+		pusher = pusher.Grouping(name, value)
+	}
+	if *pushBasicAuth != "" {
+		username, password, err := readBasicAuth(*pushBasicAuth)
+		if err != nil {
+			level.Error(logger).Log("msg", "Error reading basic auth file", "err", err)
 			return err
 		}
+		pusher = pusher.BasicAuth(username, password)
 	}
-	if err := tmp.Close(); err != nil {
-		level.Error(logger).Log("msg", "Error closing tmp file", "err", err)
+	level.Debug(logger).Log("msg", "Pushing metrics", "url", *pushURL, "job", *pushJob)
+	if err := pusher.Push(); err != nil {
+		level.Error(logger).Log("msg", "Error pushing metrics", "url", *pushURL, "err", err)
 		return err
 	}
-	if err := os.Chmod(tmp.Name(), 0644); err != nil {
-		level.Error(logger).Log("msg", "Error executing chmod 0644 on tmp file", "err", err)
-		return err
+	return nil
+}
+
+func writeOutput(path string, mfs []*dto.MetricFamily, logger log.Logger) error {
+	var buf bytes.Buffer
+	format := expfmt.FmtText
+	if *outputFormat == "openmetrics" {
+		format = expfmt.FmtOpenMetrics
 	}
-	level.Debug(logger).Log("msg", "Renaming temp file to output", "temp", tmp.Name(), "output", *output)
-	if err := os.Rename(tmp.Name(), *output); err != nil {
-		level.Error(logger).Log("msg", "Error renaming tmp file to output", "err", err)
+	encoder := expfmt.NewEncoder(&buf, format)
+	for _, mf := range mfs {
+		if err := encoder.Encode(mf); err != nil {
+			level.Error(logger).Log("msg", "Error generating metric text", "err", err)
+			return err
+		}
+	}
+	if closer, ok := encoder.(expfmt.Closer); ok {
+		if err := closer.Close(); err != nil {
+			level.Error(logger).Log("msg", "Error generating metric text", "err", err)
+			return err
+		}
+	}
+	if err := validateOutput(buf.Bytes()); err != nil {
+		level.Error(logger).Log("msg", "Refusing to replace output with invalid metrics", "output", path, "err", err)
 		return err
 	}
+	return textfile.WriteFile(path, buf.Bytes(), logger)
+}
+
+func readOutput(path string) (map[string]*dto.MetricFamily, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasSuffix(content, []byte("# EOF\n")) {
+		content = openMetricsToText(content)
+	}
+	parser := expfmt.TextParser{}
+	return parser.TextToMetricFamilies(bytes.NewReader(content))
+}
+
+// openMetricsToText converts OpenMetrics output to the Prometheus text format so it can be
+// parsed by expfmt, the EOF marker is removed and timestamps are converted from seconds to milliseconds.
+func openMetricsToText(content []byte) []byte {
+	var buf bytes.Buffer
+	for _, line := range strings.Split(strings.TrimSuffix(string(content), "\n"), "\n") {
+		if line == "# EOF" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			buf.WriteString(line + "\n")
+			continue
+		}
+		start := strings.LastIndex(line, "}") + 1
+		if start == 0 {
+			start = strings.Index(line, " ")
+		}
+		if start == -1 {
+			buf.WriteString(line + "\n")
+			continue
+		}
+		fields := strings.Fields(line[start:])
+		if len(fields) >= 2 {
+			if ts, err := strconv.ParseFloat(fields[1], 64); err == nil {
+				line = fmt.Sprintf("%s %s %d", line[:start], fields[0], int64(math.Round(ts*1000)))
+			}
+		}
+		buf.WriteString(line + "\n")
+	}
+	return buf.Bytes()
+}
+
+// timestampMetrics sets the timestamp of samples that do not already have one,
+// samples carried forward from a previous run keep their original timestamp.
+func timestampMetrics(mfs []*dto.MetricFamily, t time.Time) {
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			if m.TimestampMs == nil {
+				ts := t.UnixMilli()
+				m.TimestampMs = &ts
+			}
+		}
+	}
+}
+
+// outputFile returns the name of the file in the output directory a sample is written to,
+// samples for a filesystem are written to <collector>-<fs>.prom.
+func outputFile(mf *dto.MetricFamily, m *dto.Metric) string {
+	for _, l := range m.GetLabel() {
+		if l.GetName() != "collector" {
+			continue
+		}
+		name, fs, found := strings.Cut(l.GetValue(), "-")
+		if found && fs != "mmlsfs" && (name == "mmdf" || name == "mmbackup") {
+			return l.GetValue() + ".prom"
+		}
+	}
+	if fs := metricFS(m); fs != "" {
+		if strings.HasPrefix(mf.GetName(), "gpfs_mmbackup_") {
+			return fmt.Sprintf("mmbackup-%s.prom", fs)
+		}
+		return fmt.Sprintf("mmdf-%s.prom", fs)
+	}
+	return globalOutput
+}
+
+func splitOutput(mfs []*dto.MetricFamily) map[string][]*dto.MetricFamily {
+	files := make(map[string][]*dto.MetricFamily)
+	for _, mf := range mfs {
+		families := make(map[string]*dto.MetricFamily)
+		for _, m := range mf.GetMetric() {
+			name := outputFile(mf, m)
+			fileMf, ok := families[name]
+			if !ok {
+				fileMf = &dto.MetricFamily{Name: mf.Name, Help: mf.Help, Type: mf.Type}
+				families[name] = fileMf
+				files[name] = append(files[name], fileMf)
+			}
+			fileMf.Metric = append(fileMf.Metric, m)
+		}
+	}
+	if _, ok := files[globalOutput]; !ok {
+		files[globalOutput] = nil
+	}
+	return files
+}
+
+// writeOutputDir writes each collector and filesystem to its own file in dir. Files of failed
+// collections keep the previous samples and files of filesystems no longer collected are removed
+// once a collection succeeds.
+func writeOutputDir(dir string, mfs []*dto.MetricFamily, failures []string, logger log.Logger) error {
+	files := splitOutput(mfs)
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var failed []string
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		fileMfs := files[name]
+		if len(failures) != 0 && collectors.FileExists(path) {
+			if prevMfs, err := readOutput(path); err != nil {
+				level.Error(logger).Log("msg", "Error parsing output metrics", "output", path, "err", err)
+			} else {
+				fileMfs = mergePrevious(fileMfs, prevMfs, failures)
+			}
+		}
+		if err := writeOutput(path, fileMfs, logger); err != nil {
+			failed = append(failed, name)
+		}
+	}
+	if len(failures) == 0 {
+		removeStaleOutputs(dir, files, logger)
+	}
+	if len(failed) != 0 {
+		return fmt.Errorf("Unable to update output files %s", strings.Join(failed, ", "))
+	}
 	return nil
 }
 
+func removeStaleOutputs(dir string, files map[string][]*dto.MetricFamily, logger log.Logger) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		level.Error(logger).Log("msg", "Unable to read output directory", "dir", dir, "err", err)
+		return
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if _, ok := files[name]; ok || entry.IsDir() || !strings.HasSuffix(name, ".prom") {
+			continue
+		}
+		if !strings.HasPrefix(name, "mmdf-") && !strings.HasPrefix(name, "mmbackup-") {
+			continue
+		}
+		level.Debug(logger).Log("msg", "Removing stale output", "output", name)
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			level.Error(logger).Log("msg", "Unable to remove stale output", "output", name, "err", err)
+		}
+	}
+}
+
+func labelsKey(m *dto.Metric) string {
+	pairs := make([]string, 0, len(m.GetLabel()))
+	for _, l := range m.GetLabel() {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", l.GetName(), l.GetValue()))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// metricFS returns the filesystem of a sample in the form used by the collector label,
+// owningcluster:fsname for filesystems mounted from a remote cluster
+func metricFS(m *dto.Metric) string {
+	var fs, cluster string
+	for _, l := range m.GetLabel() {
+		switch l.GetName() {
+		case "fs":
+			fs = l.GetValue()
+		case "remote_cluster":
+			cluster = l.GetValue()
+		}
+	}
+	if fs != "" && cluster != "" {
+		return fmt.Sprintf("%s:%s", cluster, fs)
+	}
+	return fs
+}
+
+// mergePrevious keeps freshly collected samples and carries forward samples
+// from the previous output only for filesystems whose collection failed.
+// When a failure is not for a single filesystem, such as mmlsfs failing to
+// discover filesystems, every previous sample is carried forward.
+func mergePrevious(mfs []*dto.MetricFamily, prevMfs map[string]*dto.MetricFamily, failures []string) []*dto.MetricFamily {
+	failedFS := make(map[string]bool)
+	var failedAll bool
+	for _, f := range failures {
+		if _, fs, found := strings.Cut(f, "-"); found && fs != "mmlsfs" {
+			failedFS[fs] = true
+		} else {
+			failedAll = true
+		}
+	}
+	merged := make(map[string]*dto.MetricFamily)
+	names := []string{}
+	for _, mf := range mfs {
+		if prev, ok := merged[mf.GetName()]; ok {
+			prev.Metric = append(prev.Metric, mf.Metric...)
+			continue
+		}
+		merged[mf.GetName()] = &dto.MetricFamily{Name: mf.Name, Help: mf.Help, Type: mf.Type, Metric: mf.Metric}
+		names = append(names, mf.GetName())
+	}
+	for name, prev := range prevMfs {
+		if strings.HasPrefix(name, "gpfs_exporter") {
+			continue
+		}
+		mf, ok := merged[name]
+		seen := make(map[string]bool)
+		if ok {
+			for _, m := range mf.GetMetric() {
+				seen[labelsKey(m)] = true
+			}
+		}
+		for _, m := range prev.GetMetric() {
+			if (!failedAll && !failedFS[metricFS(m)]) || seen[labelsKey(m)] {
+				continue
+			}
+			if !ok {
+				mf = &dto.MetricFamily{Name: prev.Name, Help: prev.Help, Type: prev.Type}
+				merged[name] = mf
+				names = append(names, name)
+				ok = true
+			}
+			mf.Metric = append(mf.Metric, m)
+		}
+	}
+	sort.Strings(names)
+	newMfs := make([]*dto.MetricFamily, 0, len(names))
+	for _, name := range names {
+		mf := merged[name]
+		sort.Slice(mf.Metric, func(i, j int) bool {
+			return labelsKey(mf.Metric[i]) < labelsKey(mf.Metric[j])
+		})
+		newMfs = append(newMfs, mf)
+	}
+	return newMfs
+}
+
 func collect(logger log.Logger) error {
 	registry := prometheus.NewRegistry()
-	registry.MustRegister(collectors.NewMmdfCollector(logger))
+	registerer := prometheus.WrapRegistererWith(collectors.ConstLabels(), registry)
+	registerer.MustRegister(collectors.CommandMetrics...)
+	lockWait := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "gpfs_exporter_lock_wait_seconds",
+		Help: "Time spent waiting to obtain the lock file",
+	})
+	lockWait.Set(lockWaitSeconds)
+	registerer.MustRegister(lockWait)
+	registerer.MustRegister(collectors.NewMmdfCollector(logger))
+	if collectors.CollectorEnabled("mmbackup") {
+		registerer.MustRegister(collectors.NewMmbackupCollector(logger))
+	}
 	var newMfs []*dto.MetricFamily
 	var failures []string
+	collectTime = time.Now()
 	mfs, err := registry.Gather()
 	if err != nil {
 		level.Error(logger).Log("msg", "Error executing Gather", "err", err)
 		return err
 	}
+	if *outputTimestamps {
+		timestampMetrics(mfs, collectTime)
+	}
 	for _, mf := range mfs {
-		if strings.HasPrefix(mf.GetName(), "gpfs_exporter") {
-			newMfs = append(newMfs, mf)
-		}
 		if mf.GetName() != "gpfs_exporter_collect_error" && mf.GetName() != "gpfs_exporter_collect_timeout" {
 			continue
 		}
@@ -89,42 +490,25 @@ func collect(logger log.Logger) error {
 				continue
 			}
 			for _, l := range m.GetLabel() {
-				if l.GetName() == "collector" && strings.HasPrefix(l.GetValue(), "mmdf-") {
+				if l.GetName() == "collector" && (strings.HasPrefix(l.GetValue(), "mmdf-") || strings.HasPrefix(l.GetValue(), "mmbackup-")) {
 					failures = append(failures, l.GetValue())
 				}
 			}
 		}
 	}
 
-	if len(failures) != 0 && collectors.FileExists(*output) {
-		file, err := os.Open(*output)
-		if err != nil {
-			level.Error(logger).Log("msg", "Error opening metrics file", "err", err)
-			goto failure
-		}
-		parser := expfmt.TextParser{}
-		prevMfs, err := parser.TextToMetricFamilies(file)
-		file.Close()
+	if len(failures) != 0 && outputDirectory() == "" && *output != "" && collectors.FileExists(*output) {
+		prevMfs, err := readOutput(*output)
 		if err != nil {
 			level.Error(logger).Log("msg", "Error parsing output metrics", "err", err)
 			goto failure
 		}
-		keys := make([]string, 0, len(prevMfs))
-		for k := range prevMfs {
-			keys = append(keys, k)
-		}
-		sort.Strings(keys)
-		for _, n := range keys {
-			mf := prevMfs[n]
-			if !strings.HasPrefix(n, "gpfs_exporter") {
-				newMfs = append(newMfs, mf)
-			}
-		}
+		newMfs = mergePrevious(mfs, prevMfs, failures)
 	} else {
 		newMfs = mfs
 	}
 
-	if err := writeMetrics(newMfs, logger); err != nil {
+	if err := writeMetrics(newMfs, failures, logger); err != nil {
 		return err
 	}
 	if len(failures) != 0 {
@@ -133,10 +517,10 @@ func collect(logger log.Logger) error {
 	return nil
 
 failure:
-	if err := writeMetrics(mfs, logger); err != nil {
+	if err := writeMetrics(mfs, failures, logger); err != nil {
 		return err
 	}
-	return err
+	return fmt.Errorf("Error with collection")
 }
 
 func main() {
@@ -147,18 +531,40 @@ func main() {
 	kingpin.Parse()
 
 	logger := promlog.New(promlogConfig)
+	collectors.SetFailureLogger(logger)
+	if *output == "" && *outputDir == "" && *pushURL == "" {
+		level.Error(logger).Log("msg", "At least one of --output, --output-dir or --push.url must be set")
+		os.Exit(1)
+	}
+	if err := collectors.ValidateFilesystems(); err != nil {
+		level.Error(logger).Log("msg", err)
+		os.Exit(1)
+	}
+	if err := collectors.ValidateRegexes(); err != nil {
+		level.Error(logger).Log("msg", err)
+		os.Exit(1)
+	}
+	if err := collectors.ValidateConstLabels(); err != nil {
+		level.Error(logger).Log("msg", err)
+		os.Exit(1)
+	}
+	if err := collectors.ValidateSudo(); err != nil {
+		level.Error(logger).Log("msg", err)
+		os.Exit(1)
+	}
+	collectors.CheckGpfsBinPath(logger)
+	if err := collectors.CheckFilesystemsExist(logger); err != nil {
+		level.Error(logger).Log("msg", err)
+		os.Exit(1)
+	}
 
-	fileLock := flock.New(*lockFile)
-	locked, err := fileLock.TryLock()
+	fileLock, waitSeconds, err := textfile.AcquireLock(*lockFile, *lockStaleTimeout, logger)
 	if err != nil {
 		level.Error(logger).Log("msg", "Unable to obtain lock on lock file", "lockfile", *lockFile)
 		level.Error(logger).Log("msg", err)
 		os.Exit(1)
 	}
-	if !locked {
-		level.Error(logger).Log("msg", fmt.Sprintf("Lock file %s is locked", *lockFile))
-		os.Exit(1)
-	}
+	lockWaitSeconds = waitSeconds
 	err = collect(logger)
 	if err != nil {
 		os.Exit(1)
@@ -16,12 +16,18 @@ package main
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/alecthomas/kingpin/v2"
 	"github.com/go-kit/log"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
 	"github.com/treydock/gpfs_exporter/collectors"
 )
 
@@ -46,59 +52,126 @@ mmdf:inode:0:1:::430741822:484301506:915043328:1332164000:
 	expected = `
 # HELP gpfs_fs_allocated_inodes GPFS filesystem inodes allocated
 # TYPE gpfs_fs_allocated_inodes gauge
-gpfs_fs_allocated_inodes{fs="project"} 9.15043328e+08
+gpfs_fs_allocated_inodes{fs="project",remote_cluster=""} 9.15043328e+08
 # HELP gpfs_fs_free_bytes GPFS filesystem free size in bytes
 # TYPE gpfs_fs_free_bytes gauge
-gpfs_fs_free_bytes{fs="project"} 4.92750870413312e+14
+gpfs_fs_free_bytes{fs="project",remote_cluster=""} 4.92750870413312e+14
 # HELP gpfs_fs_free_inodes GPFS filesystem inodes free
 # TYPE gpfs_fs_free_inodes gauge
-gpfs_fs_free_inodes{fs="project"} 4.84301506e+08
+gpfs_fs_free_inodes{fs="project",remote_cluster=""} 4.84301506e+08
 # HELP gpfs_fs_inodes GPFS filesystem inodes total
 # TYPE gpfs_fs_inodes gauge
-gpfs_fs_inodes{fs="project"} 1.332164e+09
+gpfs_fs_inodes{fs="project",remote_cluster=""} 1.332164e+09
 # HELP gpfs_fs_metadata_free_bytes GPFS metadata free size in bytes
 # TYPE gpfs_fs_metadata_free_bytes gauge
-gpfs_fs_metadata_free_bytes{fs="project"} 6.155570511872e+12
+gpfs_fs_metadata_free_bytes{fs="project",remote_cluster=""} 6.155570511872e+12
 # HELP gpfs_fs_metadata_size_bytes GPFS total metadata size in bytes
 # TYPE gpfs_fs_metadata_size_bytes gauge
-gpfs_fs_metadata_size_bytes{fs="project"} 1.4224931684352e+13
+gpfs_fs_metadata_size_bytes{fs="project",remote_cluster=""} 1.4224931684352e+13
+# HELP gpfs_fs_metadata_used_bytes GPFS metadata used size in bytes
+# TYPE gpfs_fs_metadata_used_bytes gauge
+gpfs_fs_metadata_used_bytes{fs="project",remote_cluster=""} 8.06936117248e+12
+# HELP gpfs_fs_pool_excluded_count GPFS count of pools excluded from pool metrics
+# TYPE gpfs_fs_pool_excluded_count gauge
+gpfs_fs_pool_excluded_count{fs="project",remote_cluster=""} 0
 # HELP gpfs_fs_pool_free_bytes GPFS pool free size in bytes
 # TYPE gpfs_fs_pool_free_bytes gauge
-gpfs_fs_pool_free_bytes{fs="project",pool="data"} 1.37457899143168e+15
-gpfs_fs_pool_free_bytes{fs="project",pool="system"} 3.89698396618752e+14
+gpfs_fs_pool_free_bytes{fs="project",pool="data",remote_cluster=""} 1.37457899143168e+15
+gpfs_fs_pool_free_bytes{fs="project",pool="system",remote_cluster=""} 3.89698396618752e+14
 # HELP gpfs_fs_pool_free_fragments_bytes GPFS pool free fragments in bytes
 # TYPE gpfs_fs_pool_free_fragments_bytes gauge
-gpfs_fs_pool_free_fragments_bytes{fs="project",pool="data"} 2.047196315648e+12
-gpfs_fs_pool_free_fragments_bytes{fs="project",pool="system"} 1.0265051611136e+13
+gpfs_fs_pool_free_fragments_bytes{fs="project",pool="data",remote_cluster=""} 2.047196315648e+12
+gpfs_fs_pool_free_fragments_bytes{fs="project",pool="system",remote_cluster=""} 1.0265051611136e+13
 # HELP gpfs_fs_pool_max_disk_size_bytes GPFS pool max disk size in bytes
 # TYPE gpfs_fs_pool_max_disk_size_bytes gauge
-gpfs_fs_pool_max_disk_size_bytes{fs="project",pool="data"} 1.0387223769776128e+16
-gpfs_fs_pool_max_disk_size_bytes{fs="project",pool="system"} 1.18075521236992e+15
+gpfs_fs_pool_max_disk_size_bytes{fs="project",pool="data",remote_cluster=""} 1.0387223769776128e+16
+gpfs_fs_pool_max_disk_size_bytes{fs="project",pool="system",remote_cluster=""} 1.18075521236992e+15
+# HELP gpfs_fs_pool_suspended_bytes GPFS pool size in bytes of NSDs not available for block allocation
+# TYPE gpfs_fs_pool_suspended_bytes gauge
+gpfs_fs_pool_suspended_bytes{fs="project",pool="data",remote_cluster=""} 0
+gpfs_fs_pool_suspended_bytes{fs="project",pool="system",remote_cluster=""} 0
+# HELP gpfs_fs_pool_suspended_free_bytes GPFS pool free size in bytes of NSDs not available for block allocation
+# TYPE gpfs_fs_pool_suspended_free_bytes gauge
+gpfs_fs_pool_suspended_free_bytes{fs="project",pool="data",remote_cluster=""} 0
+gpfs_fs_pool_suspended_free_bytes{fs="project",pool="system",remote_cluster=""} 0
 # HELP gpfs_fs_pool_total_bytes GPFS pool total size in bytes
 # TYPE gpfs_fs_pool_total_bytes gauge
-gpfs_fs_pool_total_bytes{fs="project",pool="data"} 3.138000816963584e+15
-gpfs_fs_pool_total_bytes{fs="project",pool="system"} 8.02107691106304e+14
+gpfs_fs_pool_total_bytes{fs="project",pool="data",remote_cluster=""} 3.138000816963584e+15
+gpfs_fs_pool_total_bytes{fs="project",pool="system",remote_cluster=""} 8.02107691106304e+14
+# HELP gpfs_fs_pool_used_bytes GPFS pool used size in bytes
+# TYPE gpfs_fs_pool_used_bytes gauge
+gpfs_fs_pool_used_bytes{fs="project",pool="data",remote_cluster=""} 1.763421825531904e+15
+gpfs_fs_pool_used_bytes{fs="project",pool="system",remote_cluster=""} 4.12409294487552e+14
 # HELP gpfs_fs_size_bytes GPFS filesystem total size in bytes
 # TYPE gpfs_fs_size_bytes gauge
-gpfs_fs_size_bytes{fs="project"} 3.749557989015552e+15
+gpfs_fs_size_bytes{fs="project",remote_cluster=""} 3.749557989015552e+15
+# HELP gpfs_fs_used_bytes GPFS filesystem used size in bytes
+# TYPE gpfs_fs_used_bytes gauge
+gpfs_fs_used_bytes{fs="project",remote_cluster=""} 3.25680711860224e+15
 # HELP gpfs_fs_used_inodes GPFS filesystem inodes used
 # TYPE gpfs_fs_used_inodes gauge
-gpfs_fs_used_inodes{fs="project"} 4.30741822e+08`
+gpfs_fs_used_inodes{fs="project",remote_cluster=""} 4.30741822e+08`
+	mmbackupStdout = `
+mmbackup:query:HEADER:version:reserved:reserved:filesystemName:server:lastBackupTime:status:filesBackedUp:filesFailed:
+mmbackup:query:0:1:::project:TSM1:Wed Jan 20 00%3A30%3A02 2021:Success:123456:3:
+`
+	expectedMmbackup = `# HELP gpfs_mmbackup_files_backed_up GPFS mmbackup files backed up during last run
+# TYPE gpfs_mmbackup_files_backed_up gauge
+gpfs_mmbackup_files_backed_up{fs="project",remote_cluster=""} 123456
+# HELP gpfs_mmbackup_files_failed GPFS mmbackup files failed during last run
+# TYPE gpfs_mmbackup_files_failed gauge
+gpfs_mmbackup_files_failed{fs="project",remote_cluster=""} 3`
 	expectedNoError = `# HELP gpfs_exporter_collect_error Indicates if error has occurred during collection
 # TYPE gpfs_exporter_collect_error gauge
 gpfs_exporter_collect_error{collector="mmdf-project"} 0
+# HELP gpfs_exporter_collect_error_reason Indicates the reason for a collection error or timeout
+# TYPE gpfs_exporter_collect_error_reason gauge
+gpfs_exporter_collect_error_reason{collector="mmdf-project",reason="gpfs_down"} 0
+gpfs_exporter_collect_error_reason{collector="mmdf-project",reason="not_found"} 0
+gpfs_exporter_collect_error_reason{collector="mmdf-project",reason="other"} 0
+gpfs_exporter_collect_error_reason{collector="mmdf-project",reason="parse"} 0
+gpfs_exporter_collect_error_reason{collector="mmdf-project",reason="permission"} 0
+gpfs_exporter_collect_error_reason{collector="mmdf-project",reason="timeout"} 0
+# HELP gpfs_exporter_collect_success Indicates the collector completed without error or timeout and parsed at least one record
+# TYPE gpfs_exporter_collect_success gauge
+gpfs_exporter_collect_success 1
+gpfs_exporter_collect_success{collector="mmdf-project"} 1
 # HELP gpfs_exporter_collect_timeout Indicates the collector timed out
 # TYPE gpfs_exporter_collect_timeout gauge
 gpfs_exporter_collect_timeout{collector="mmdf-project"} 0`
 	expectedError = `# HELP gpfs_exporter_collect_error Indicates if error has occurred during collection
 # TYPE gpfs_exporter_collect_error gauge
 gpfs_exporter_collect_error{collector="mmdf-project"} 1
+# HELP gpfs_exporter_collect_error_reason Indicates the reason for a collection error or timeout
+# TYPE gpfs_exporter_collect_error_reason gauge
+gpfs_exporter_collect_error_reason{collector="mmdf-project",reason="gpfs_down"} 0
+gpfs_exporter_collect_error_reason{collector="mmdf-project",reason="not_found"} 0
+gpfs_exporter_collect_error_reason{collector="mmdf-project",reason="other"} 1
+gpfs_exporter_collect_error_reason{collector="mmdf-project",reason="parse"} 0
+gpfs_exporter_collect_error_reason{collector="mmdf-project",reason="permission"} 0
+gpfs_exporter_collect_error_reason{collector="mmdf-project",reason="timeout"} 0
+# HELP gpfs_exporter_collect_success Indicates the collector completed without error or timeout and parsed at least one record
+# TYPE gpfs_exporter_collect_success gauge
+gpfs_exporter_collect_success 0
+gpfs_exporter_collect_success{collector="mmdf-project"} 0
 # HELP gpfs_exporter_collect_timeout Indicates the collector timed out
 # TYPE gpfs_exporter_collect_timeout gauge
 gpfs_exporter_collect_timeout{collector="mmdf-project"} 0`
 	expectedTimeout = `# HELP gpfs_exporter_collect_error Indicates if error has occurred during collection
 # TYPE gpfs_exporter_collect_error gauge
 gpfs_exporter_collect_error{collector="mmdf-project"} 0
+# HELP gpfs_exporter_collect_error_reason Indicates the reason for a collection error or timeout
+# TYPE gpfs_exporter_collect_error_reason gauge
+gpfs_exporter_collect_error_reason{collector="mmdf-project",reason="gpfs_down"} 0
+gpfs_exporter_collect_error_reason{collector="mmdf-project",reason="not_found"} 0
+gpfs_exporter_collect_error_reason{collector="mmdf-project",reason="other"} 0
+gpfs_exporter_collect_error_reason{collector="mmdf-project",reason="parse"} 0
+gpfs_exporter_collect_error_reason{collector="mmdf-project",reason="permission"} 0
+gpfs_exporter_collect_error_reason{collector="mmdf-project",reason="timeout"} 1
+# HELP gpfs_exporter_collect_success Indicates the collector completed without error or timeout and parsed at least one record
+# TYPE gpfs_exporter_collect_success gauge
+gpfs_exporter_collect_success 0
+gpfs_exporter_collect_success{collector="mmdf-project"} 0
 # HELP gpfs_exporter_collect_timeout Indicates the collector timed out
 # TYPE gpfs_exporter_collect_timeout gauge
 gpfs_exporter_collect_timeout{collector="mmdf-project"} 1`
@@ -138,6 +211,12 @@ func TestCollect(t *testing.T) {
 	if !strings.Contains(string(content), expectedNoError) {
 		t.Errorf("Unexpected error metrics:\n%s\nExpected:\n%s", string(content), expectedError)
 	}
+	if !strings.Contains(string(content), "gpfs_exporter_collect_success 1") {
+		t.Errorf("Unexpected collect success metric:\n%s", string(content))
+	}
+	if !strings.Contains(string(content), "gpfs_exporter_last_collect_timestamp_seconds") {
+		t.Errorf("Missing last collect timestamp metric:\n%s", string(content))
+	}
 }
 
 func TestCollectError(t *testing.T) {
@@ -162,6 +241,12 @@ func TestCollectError(t *testing.T) {
 	if !strings.Contains(string(content), expectedError) {
 		t.Errorf("Unexpected error metrics:\n%s\nExpected:\n%s", string(content), expectedError)
 	}
+	if !strings.Contains(string(content), "gpfs_exporter_collect_success 0") {
+		t.Errorf("Unexpected collect success metric:\n%s", string(content))
+	}
+	if !strings.Contains(string(content), "gpfs_exporter_last_collect_timestamp_seconds") {
+		t.Errorf("Missing last collect timestamp metric:\n%s", string(content))
+	}
 }
 
 func TestCollectTimeout(t *testing.T) {
@@ -186,4 +271,634 @@ func TestCollectTimeout(t *testing.T) {
 	if !strings.Contains(string(content), expectedTimeout) {
 		t.Errorf("Unexpected error metrics:\n%s\nExpected:\n%s", string(content), expectedError)
 	}
+	if !strings.Contains(string(content), "gpfs_exporter_collect_success 0") {
+		t.Errorf("Unexpected collect success metric:\n%s", string(content))
+	}
+	if !strings.Contains(string(content), "gpfs_exporter_last_collect_timestamp_seconds") {
+		t.Errorf("Missing last collect timestamp metric:\n%s", string(content))
+	}
+}
+
+func TestCollectMmbackup(t *testing.T) {
+	args := []string{fmt.Sprintf("--output=%s", outputPath), "--collector.mmdf.filesystems=project",
+		"--collector.mmbackup", "--collector.mmbackup.filesystems=project"}
+	if _, err := kingpin.CommandLine.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_, _ = kingpin.CommandLine.Parse([]string{fmt.Sprintf("--output=%s", outputPath), "--collector.mmdf.filesystems=project"})
+	}()
+	collectors.MmdfExec = func(fs string, ctx context.Context) (string, error) {
+		return mmdfStdout, nil
+	}
+	collectors.MmbackupExec = func(fs string, ctx context.Context) (string, error) {
+		return mmbackupStdout, nil
+	}
+	err := collect(log.NewNopLogger())
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+		return
+	}
+	content, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+		return
+	}
+	if !strings.Contains(string(content), expected) {
+		t.Errorf("Unexpected content:\n%s\nExpected:\n%s", string(content), expected)
+	}
+	if !strings.Contains(string(content), expectedMmbackup) {
+		t.Errorf("Unexpected content:\n%s\nExpected:\n%s", string(content), expectedMmbackup)
+	}
+}
+
+func TestCollectLockWait(t *testing.T) {
+	lockWaitSeconds = 0.25
+	defer func() { lockWaitSeconds = 0 }()
+	collectors.MmdfExec = func(fs string, ctx context.Context) (string, error) {
+		return mmdfStdout, nil
+	}
+	if err := collect(log.NewNopLogger()); err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+	content, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if !strings.Contains(string(content), "gpfs_exporter_lock_wait_seconds 0.25") {
+		t.Errorf("Expected lock wait metric in output:\n%s", string(content))
+	}
+}
+
+func TestCollectErrorInvalidOutput(t *testing.T) {
+	collectors.MmdfExec = func(fs string, ctx context.Context) (string, error) {
+		return "", fmt.Errorf("Error")
+	}
+	if err := os.WriteFile(outputPath, []byte("invalid metrics\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := collect(log.NewNopLogger()); err == nil {
+		t.Errorf("Expected error")
+	}
+	content, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if !strings.Contains(string(content), "gpfs_exporter_collect_success 0") {
+		t.Errorf("Unexpected collect success metric:\n%s", string(content))
+	}
+	if !strings.Contains(string(content), "gpfs_exporter_last_collect_timestamp_seconds") {
+		t.Errorf("Missing last collect timestamp metric:\n%s", string(content))
+	}
+	collectors.MmdfExec = func(fs string, ctx context.Context) (string, error) {
+		return mmdfStdout, nil
+	}
+	if err := collect(log.NewNopLogger()); err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+}
+
+func TestCollectPush(t *testing.T) {
+	var pushed []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, _ := r.BasicAuth()
+		pushed = append(pushed, fmt.Sprintf("%s %s %s:%s", r.Method, r.URL.Path, username, password))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	authFile := filepath.Join(filepath.Dir(outputPath), "push-auth")
+	if err := os.WriteFile(authFile, []byte("gpfs:secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer func(url string, auth string, grouping map[string]string) {
+		*pushURL = url
+		*pushBasicAuth = auth
+		*pushGrouping = grouping
+	}(*pushURL, *pushBasicAuth, *pushGrouping)
+	*pushURL = server.URL
+	*pushBasicAuth = authFile
+	*pushGrouping = map[string]string{"instance": "nsd01"}
+	collectors.MmdfExec = func(fs string, ctx context.Context) (string, error) {
+		return mmdfStdout, nil
+	}
+	if err := collect(log.NewNopLogger()); err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+	expectedPush := "PUT /metrics/job/gpfs_mmdf_exporter/instance/nsd01 gpfs:secret"
+	if len(pushed) != 1 || pushed[0] != expectedPush {
+		t.Errorf("Unexpected push requests %v, expected %s", pushed, expectedPush)
+	}
+	if !collectors.FileExists(outputPath) {
+		t.Errorf("Expected output to still be written")
+	}
+	collectors.MmdfExec = func(fs string, ctx context.Context) (string, error) {
+		return "", fmt.Errorf("Error")
+	}
+	if err := collect(log.NewNopLogger()); err == nil {
+		t.Errorf("Expected error")
+	}
+	if len(pushed) != 1 {
+		t.Errorf("Unexpected push after failed collection: %v", pushed)
+	}
+	collectors.MmdfExec = func(fs string, ctx context.Context) (string, error) {
+		return mmdfStdout, nil
+	}
+	server.Close()
+	if err := collect(log.NewNopLogger()); err == nil {
+		t.Errorf("Expected error when push fails")
+	}
+}
+
+func TestCollectErrorPartial(t *testing.T) {
+	args := []string{fmt.Sprintf("--output=%s", outputPath), "--collector.mmdf.filesystems=project,scratch"}
+	if _, err := kingpin.CommandLine.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_, _ = kingpin.CommandLine.Parse([]string{fmt.Sprintf("--output=%s", outputPath), "--collector.mmdf.filesystems=project"})
+	}()
+	collectors.MmdfExec = func(fs string, ctx context.Context) (string, error) {
+		return mmdfStdout, nil
+	}
+	if err := collect(log.NewNopLogger()); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	collectors.MmdfExec = func(fs string, ctx context.Context) (string, error) {
+		if fs == "scratch" {
+			return "", fmt.Errorf("Error")
+		}
+		return strings.Replace(mmdfStdout, ":430741822:", ":430741823:", 1), nil
+	}
+	if err := collect(log.NewNopLogger()); err == nil {
+		t.Errorf("Expected error")
+	}
+	content, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	expectedUsed := `# TYPE gpfs_fs_used_inodes gauge
+gpfs_fs_used_inodes{fs="project",remote_cluster=""} 4.30741823e+08
+gpfs_fs_used_inodes{fs="scratch",remote_cluster=""} 4.30741822e+08
+`
+	if !strings.Contains(string(content), expectedUsed) {
+		t.Errorf("Unexpected content:\n%s\nExpected:\n%s", string(content), expectedUsed)
+	}
+	if strings.Count(string(content), `gpfs_fs_size_bytes{fs="scratch",remote_cluster=""}`) != 1 {
+		t.Errorf("Expected single stale scratch sample:\n%s", string(content))
+	}
+	if !strings.Contains(string(content), `gpfs_exporter_collect_error{collector="mmdf-scratch"} 1`) {
+		t.Errorf("Unexpected error metrics:\n%s", string(content))
+	}
+	if !strings.Contains(string(content), "gpfs_exporter_collect_success 0") {
+		t.Errorf("Unexpected collect success metric:\n%s", string(content))
+	}
+}
+
+func TestCollectErrorDiscovery(t *testing.T) {
+	args := []string{fmt.Sprintf("--output=%s", outputPath), "--collector.mmlsfs.cache-ttl=0s"}
+	if _, err := kingpin.CommandLine.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	mmlsfsExec := collectors.MmlsfsExec
+	defer func() {
+		collectors.MmlsfsExec = mmlsfsExec
+		_, _ = kingpin.CommandLine.Parse([]string{fmt.Sprintf("--output=%s", outputPath), "--collector.mmdf.filesystems=project"})
+	}()
+	collectors.MmlsfsExec = func(ctx context.Context) (string, error) {
+		return "fs::HEADER:version:reserved:reserved:deviceName:fieldName:data:remarks:\nmmlsfs::0:1:::project:defaultMountPoint:%2Ffs%2Fproject::\n", nil
+	}
+	collectors.MmdfExec = func(fs string, ctx context.Context) (string, error) {
+		return mmdfStdout, nil
+	}
+	if err := collect(log.NewNopLogger()); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	collectors.MmlsfsExec = func(ctx context.Context) (string, error) {
+		return "", fmt.Errorf("Error")
+	}
+	if err := collect(log.NewNopLogger()); err == nil {
+		t.Errorf("Expected error")
+	}
+	content, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if !strings.Contains(string(content), expected) {
+		t.Errorf("Unexpected content:\n%s\nExpected:\n%s", string(content), expected)
+	}
+	if !strings.Contains(string(content), `gpfs_exporter_collect_error{collector="mmdf-mmlsfs"} 1`) {
+		t.Errorf("Unexpected error metrics:\n%s", string(content))
+	}
+	if !strings.Contains(string(content), "gpfs_exporter_collect_success 0") {
+		t.Errorf("Unexpected collect success metric:\n%s", string(content))
+	}
+}
+
+func TestCollectOutputDir(t *testing.T) {
+	dir := t.TempDir()
+	args := []string{fmt.Sprintf("--output-dir=%s", dir), "--collector.mmdf.filesystems=project,scratch"}
+	if _, err := kingpin.CommandLine.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		*outputDir = ""
+		_, _ = kingpin.CommandLine.Parse([]string{fmt.Sprintf("--output=%s", outputPath), "--collector.mmdf.filesystems=project"})
+	}()
+	stale := filepath.Join(dir, "mmdf-old.prom")
+	if err := os.WriteFile(stale, []byte("gpfs_fs_size_bytes{fs=\"old\"} 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	other := filepath.Join(dir, "node.prom")
+	if err := os.WriteFile(other, []byte("node_foo 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	collectors.MmdfExec = func(fs string, ctx context.Context) (string, error) {
+		return mmdfStdout, nil
+	}
+	if err := collect(log.NewNopLogger()); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []string
+	for _, entry := range entries {
+		files = append(files, entry.Name())
+	}
+	expectedFiles := []string{"gpfs_mmdf_exporter.prom", "mmdf-project.prom", "mmdf-scratch.prom", "node.prom"}
+	if strings.Join(files, ",") != strings.Join(expectedFiles, ",") {
+		t.Errorf("Unexpected files %v, expected %v", files, expectedFiles)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "mmdf-project.prom"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), `gpfs_fs_used_inodes{fs="project",remote_cluster=""} 4.30741822e+08`) {
+		t.Errorf("Unexpected content:\n%s", string(content))
+	}
+	if strings.Contains(string(content), `fs="scratch"`) || strings.Contains(string(content), `collector="mmdf-scratch"`) {
+		t.Errorf("Unexpected scratch samples in project file:\n%s", string(content))
+	}
+	if !strings.Contains(string(content), `gpfs_exporter_collect_error{collector="mmdf-project"} 0`) {
+		t.Errorf("Unexpected error metrics:\n%s", string(content))
+	}
+	content, err = os.ReadFile(filepath.Join(dir, "gpfs_mmdf_exporter.prom"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "gpfs_exporter_collect_success 1") {
+		t.Errorf("Unexpected collect success metric:\n%s", string(content))
+	}
+	if !strings.Contains(string(content), "gpfs_exporter_lock_wait_seconds") {
+		t.Errorf("Expected lock wait metric in output:\n%s", string(content))
+	}
+
+	collectors.MmdfExec = func(fs string, ctx context.Context) (string, error) {
+		if fs == "scratch" {
+			return "", fmt.Errorf("Error")
+		}
+		return strings.Replace(mmdfStdout, ":430741822:", ":430741823:", 1), nil
+	}
+	if err := collect(log.NewNopLogger()); err == nil {
+		t.Errorf("Expected error")
+	}
+	content, err = os.ReadFile(filepath.Join(dir, "mmdf-project.prom"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), `gpfs_fs_used_inodes{fs="project",remote_cluster=""} 4.30741823e+08`) {
+		t.Errorf("Expected project file to be replaced:\n%s", string(content))
+	}
+	content, err = os.ReadFile(filepath.Join(dir, "mmdf-scratch.prom"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), `gpfs_fs_used_inodes{fs="scratch",remote_cluster=""} 4.30741822e+08`) {
+		t.Errorf("Expected previous scratch samples:\n%s", string(content))
+	}
+	if !strings.Contains(string(content), `gpfs_exporter_collect_error{collector="mmdf-scratch"} 1`) {
+		t.Errorf("Unexpected error metrics:\n%s", string(content))
+	}
+
+	if _, err := kingpin.CommandLine.Parse([]string{fmt.Sprintf("--output=%s/", dir), "--collector.mmdf.filesystems=project"}); err != nil {
+		t.Fatal(err)
+	}
+	collectors.MmdfExec = func(fs string, ctx context.Context) (string, error) {
+		return mmdfStdout, nil
+	}
+	if err := collect(log.NewNopLogger()); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if collectors.FileExists(filepath.Join(dir, "mmdf-scratch.prom")) {
+		t.Errorf("Expected stale scratch file to be removed")
+	}
+	if !collectors.FileExists(other) {
+		t.Errorf("Expected files not written by the exporter to be kept")
+	}
+}
+
+func TestCollectErrorRemote(t *testing.T) {
+	dir := t.TempDir()
+	args := []string{fmt.Sprintf("--output=%s", outputPath), "--collector.mmdf.filesystems=project,remote:scratch"}
+	if _, err := kingpin.CommandLine.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		*outputDir = ""
+		_, _ = kingpin.CommandLine.Parse([]string{fmt.Sprintf("--output=%s", outputPath), "--collector.mmdf.filesystems=project"})
+	}()
+	for _, path := range []string{outputPath, filepath.Join(dir, "mmdf-remote:scratch.prom")} {
+		if path != outputPath {
+			*output = ""
+			*outputDir = dir
+		}
+		collectors.MmdfExec = func(fs string, ctx context.Context) (string, error) {
+			return mmdfStdout, nil
+		}
+		if err := collect(log.NewNopLogger()); err != nil {
+			t.Fatalf("Unexpected error: %s", err.Error())
+		}
+		collectors.MmdfExec = func(fs string, ctx context.Context) (string, error) {
+			if fs == "remote:scratch" {
+				return "", fmt.Errorf("Error")
+			}
+			return strings.Replace(mmdfStdout, ":430741822:", ":430741823:", 1), nil
+		}
+		if err := collect(log.NewNopLogger()); err == nil {
+			t.Errorf("Expected error")
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err.Error())
+		}
+		if !strings.Contains(string(content), `gpfs_fs_used_inodes{fs="scratch",remote_cluster="remote"} 4.30741822e+08`) {
+			t.Errorf("Expected previous remote samples in %s:\n%s", path, string(content))
+		}
+		if !strings.Contains(string(content), `gpfs_exporter_collect_error{collector="mmdf-remote:scratch"} 1`) {
+			t.Errorf("Unexpected error metrics in %s:\n%s", path, string(content))
+		}
+		if path == outputPath && !strings.Contains(string(content), `gpfs_fs_used_inodes{fs="project",remote_cluster=""} 4.30741823e+08`) {
+			t.Errorf("Expected project samples to be replaced:\n%s", string(content))
+		}
+	}
+}
+
+func TestCollectOutputDirWriteError(t *testing.T) {
+	dir := t.TempDir()
+	args := []string{fmt.Sprintf("--output-dir=%s", dir), "--collector.mmdf.filesystems=project,scratch"}
+	if _, err := kingpin.CommandLine.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		*outputDir = ""
+		_, _ = kingpin.CommandLine.Parse([]string{fmt.Sprintf("--output=%s", outputPath), "--collector.mmdf.filesystems=project"})
+	}()
+	if err := os.Mkdir(filepath.Join(dir, "mmdf-project.prom"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	collectors.MmdfExec = func(fs string, ctx context.Context) (string, error) {
+		return mmdfStdout, nil
+	}
+	if err := collect(log.NewNopLogger()); err == nil {
+		t.Errorf("Expected error")
+	}
+	if !collectors.FileExists(filepath.Join(dir, "mmdf-scratch.prom")) {
+		t.Errorf("Expected remaining files to be written")
+	}
+}
+
+func TestCollectOpenMetrics(t *testing.T) {
+	args := []string{fmt.Sprintf("--output=%s", outputPath), "--collector.mmdf.filesystems=project,scratch",
+		"--output.format=openmetrics", "--output.timestamps"}
+	if _, err := kingpin.CommandLine.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		*outputFormat = "prometheus"
+		*outputTimestamps = false
+		_, _ = kingpin.CommandLine.Parse([]string{fmt.Sprintf("--output=%s", outputPath), "--collector.mmdf.filesystems=project"})
+	}()
+	collectors.MmdfExec = func(fs string, ctx context.Context) (string, error) {
+		return mmdfStdout, nil
+	}
+	before := time.Now().UnixMilli()
+	if err := collect(log.NewNopLogger()); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	after := time.Now().UnixMilli()
+	content, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(content), "\n# EOF\n") {
+		t.Errorf("Expected OpenMetrics EOF marker:\n%s", string(content))
+	}
+	mfs, err := readOutput(outputPath)
+	if err != nil {
+		t.Fatalf("Unexpected error parsing output: %s", err.Error())
+	}
+	for _, name := range []string{"gpfs_fs_used_inodes", "gpfs_exporter_collect_success", "gpfs_exporter_last_collect_timestamp_seconds"} {
+		mf, ok := mfs[name]
+		if !ok {
+			t.Errorf("Missing %s in output:\n%s", name, string(content))
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			if ts := m.GetTimestampMs(); ts < before || ts > after {
+				t.Errorf("Unexpected timestamp %d for %s, expected between %d and %d", ts, name, before, after)
+			}
+		}
+	}
+	firstTimestamp := mfs["gpfs_fs_used_inodes"].GetMetric()[0].GetTimestampMs()
+
+	time.Sleep(10 * time.Millisecond)
+	collectors.MmdfExec = func(fs string, ctx context.Context) (string, error) {
+		if fs == "scratch" {
+			return "", fmt.Errorf("Error")
+		}
+		return mmdfStdout, nil
+	}
+	if err := collect(log.NewNopLogger()); err == nil {
+		t.Errorf("Expected error")
+	}
+	mfs, err = readOutput(outputPath)
+	if err != nil {
+		t.Fatalf("Unexpected error parsing output: %s", err.Error())
+	}
+	for _, m := range mfs["gpfs_fs_used_inodes"].GetMetric() {
+		fs := metricFS(m)
+		if fs == "scratch" && m.GetTimestampMs() != firstTimestamp {
+			t.Errorf("Expected previous timestamp %d for scratch, got %d", firstTimestamp, m.GetTimestampMs())
+		}
+		if fs == "project" && m.GetTimestampMs() <= firstTimestamp {
+			t.Errorf("Expected new timestamp for project, got %d", m.GetTimestampMs())
+		}
+	}
+}
+
+func TestCollectTimestamps(t *testing.T) {
+	args := []string{fmt.Sprintf("--output=%s", outputPath), "--collector.mmdf.filesystems=project", "--output.timestamps"}
+	if _, err := kingpin.CommandLine.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		*outputTimestamps = false
+		_, _ = kingpin.CommandLine.Parse([]string{fmt.Sprintf("--output=%s", outputPath), "--collector.mmdf.filesystems=project"})
+	}()
+	collectors.MmdfExec = func(fs string, ctx context.Context) (string, error) {
+		return mmdfStdout, nil
+	}
+	if err := collect(log.NewNopLogger()); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	content, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), "# EOF") {
+		t.Errorf("Unexpected OpenMetrics EOF marker:\n%s", string(content))
+	}
+	expectedLine := fmt.Sprintf(`gpfs_fs_used_inodes{fs="project",remote_cluster=""} 4.30741822e+08 %d`, collectTime.UnixMilli())
+	if !strings.Contains(string(content), expectedLine) {
+		t.Errorf("Unexpected content:\n%s\nExpected:\n%s", string(content), expectedLine)
+	}
+}
+
+func TestCollectConstLabels(t *testing.T) {
+	args := []string{fmt.Sprintf("--output=%s", outputPath), "--collector.mmdf.filesystems=project", "--metrics.const-labels=cluster=ess01,site=dc2"}
+	if _, err := kingpin.CommandLine.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_, _ = kingpin.CommandLine.Parse([]string{fmt.Sprintf("--output=%s", outputPath), "--collector.mmdf.filesystems=project"})
+	}()
+	collectors.MmdfExec = func(fs string, ctx context.Context) (string, error) {
+		return mmdfStdout, nil
+	}
+	if err := collect(log.NewNopLogger()); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	content, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		`gpfs_fs_used_inodes{cluster="ess01",fs="project",remote_cluster="",site="dc2"} 4.30741822e+08`,
+		`gpfs_exporter_collect_error{cluster="ess01",collector="mmdf-project",site="dc2"} 0`,
+		`gpfs_exporter_collect_success{cluster="ess01",site="dc2"} 1`,
+	} {
+		if !strings.Contains(string(content), expected) {
+			t.Errorf("Expected %s in content:\n%s", expected, string(content))
+		}
+	}
+}
+
+func gaugeFamily(name string, samples map[string]float64) *dto.MetricFamily {
+	text := fmt.Sprintf("# HELP %s %s\n# TYPE %s gauge\n", name, name, name)
+	for fs, value := range samples {
+		text += fmt.Sprintf("%s{fs=%q} %v\n", name, fs, value)
+	}
+	parser := expfmt.TextParser{}
+	mfs, err := parser.TextToMetricFamilies(strings.NewReader(text))
+	if err != nil {
+		panic(err)
+	}
+	return mfs[name]
+}
+
+func TestNormalizeMetrics(t *testing.T) {
+	mfs := []*dto.MetricFamily{
+		gaugeFamily("gpfs_fs_size_bytes", map[string]float64{"scratch": 2, "project": 1}),
+		gaugeFamily("gpfs_fs_free_bytes", map[string]float64{"project": 1}),
+		gaugeFamily("gpfs_fs_size_bytes", map[string]float64{"project": 3, "ess": 4}),
+	}
+	normalized, err := normalizeMetrics(mfs, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	var got []string
+	for _, mf := range normalized {
+		for _, m := range mf.GetMetric() {
+			got = append(got, fmt.Sprintf("%s{%s} %v", mf.GetName(), labelsKey(m), m.GetGauge().GetValue()))
+		}
+	}
+	expected := []string{
+		`gpfs_fs_free_bytes{fs="project"} 1`,
+		`gpfs_fs_size_bytes{fs="ess"} 4`,
+		`gpfs_fs_size_bytes{fs="project"} 1`,
+		`gpfs_fs_size_bytes{fs="scratch"} 2`,
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Unexpected metrics:\n%s\nExpected:\n%s", strings.Join(got, "\n"), strings.Join(expected, "\n"))
+	}
+	counter := gaugeFamily("gpfs_fs_size_bytes", map[string]float64{"scratch": 5})
+	counter.Type = dto.MetricType_COUNTER.Enum()
+	if _, err := normalizeMetrics(append(mfs, counter), log.NewNopLogger()); err == nil {
+		t.Errorf("Expected error for conflicting types")
+	}
+}
+
+func TestMergePreviousDuplicateFamily(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "output")
+	mfs := []*dto.MetricFamily{
+		gaugeFamily("gpfs_fs_size_bytes", map[string]float64{"project": 1}),
+		gaugeFamily("gpfs_fs_size_bytes", map[string]float64{"ess": 3}),
+	}
+	prevMfs := map[string]*dto.MetricFamily{
+		"gpfs_fs_size_bytes": gaugeFamily("gpfs_fs_size_bytes", map[string]float64{"project": 5, "scratch": 2}),
+	}
+	merged := mergePrevious(mfs, prevMfs, []string{"mmdf-scratch"})
+	if len(merged) != 1 {
+		t.Fatalf("Expected one merged family, got %d", len(merged))
+	}
+	normalized, err := normalizeMetrics(append(merged, gaugeFamily("gpfs_fs_size_bytes", map[string]float64{"scratch": 6})), log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if err := writeOutput(path, normalized, log.NewNopLogger()); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `# HELP gpfs_fs_size_bytes gpfs_fs_size_bytes
+# TYPE gpfs_fs_size_bytes gauge
+gpfs_fs_size_bytes{fs="ess"} 3
+gpfs_fs_size_bytes{fs="project"} 1
+gpfs_fs_size_bytes{fs="scratch"} 2
+`
+	if string(content) != expected {
+		t.Errorf("Unexpected content:\n%s\nExpected:\n%s", string(content), expected)
+	}
+}
+
+func TestWriteOutputInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "output")
+	if err := os.WriteFile(path, []byte("gpfs_fs_size_bytes{fs=\"project\"} 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mfs := []*dto.MetricFamily{
+		gaugeFamily("gpfs_fs_size_bytes", map[string]float64{"project": 1}),
+		gaugeFamily("gpfs_fs_free_bytes", map[string]float64{"project": 1}),
+		gaugeFamily("gpfs_fs_size_bytes", map[string]float64{"scratch": 2}),
+	}
+	if err := writeOutput(path, mfs, log.NewNopLogger()); err == nil {
+		t.Errorf("Expected error writing duplicate families")
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "gpfs_fs_size_bytes{fs=\"project\"} 1\n" {
+		t.Errorf("Expected previous output to be kept, got:\n%s", string(content))
+	}
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Unexpected files left in output directory: %v", entries)
+	}
 }
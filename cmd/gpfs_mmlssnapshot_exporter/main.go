@@ -14,16 +14,15 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"os"
-	"path/filepath"
 	"sort"
 	"strings"
 
 	"github.com/alecthomas/kingpin/v2"
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
-	"github.com/gofrs/flock"
 	"github.com/prometheus/client_golang/prometheus"
 	dto "github.com/prometheus/client_model/go"
 	"github.com/prometheus/common/expfmt"
@@ -31,45 +30,44 @@ import (
 	"github.com/prometheus/common/promlog/flag"
 	"github.com/prometheus/common/version"
 	"github.com/treydock/gpfs_exporter/collectors"
+	"github.com/treydock/gpfs_exporter/internal/textfile"
 )
 
 var (
-	output   = kingpin.Flag("output", "Path to node exporter collected file").Required().String()
-	lockFile = kingpin.Flag("lockfile", "Lock file path").Default("/tmp/gpfs_mmdf_exporter.lock").String()
+	output           = kingpin.Flag("output", "Path to node exporter collected file").Required().String()
+	lockFile         = kingpin.Flag("lockfile", "Lock file path").Default("/tmp/gpfs_mmdf_exporter.lock").String()
+	lockStaleTimeout = kingpin.Flag("lockfile-stale-timeout", "Duration after which a held lock is considered stale and broken unless its owner is still running, 0 disables").Default("0s").Duration()
+	lockWaitSeconds  float64
 )
 
-func writeMetrics(mfs []*dto.MetricFamily, logger log.Logger) error {
-	tmp, err := os.CreateTemp(filepath.Dir(*output), filepath.Base(*output))
+func writeMetrics(mfs []*dto.MetricFamily, success bool, logger log.Logger) error {
+	status, err := textfile.StatusMetrics(success, collectors.ConstLabels())
 	if err != nil {
-		level.Error(logger).Log("msg", "Unable to create temp file", "err", err)
+		level.Error(logger).Log("msg", "Error generating status metrics", "err", err)
 		return err
 	}
-	defer os.Remove(tmp.Name())
+	mfs = textfile.AppendStatus(mfs, status)
+	var buf bytes.Buffer
 	for _, mf := range mfs {
-		if _, err := expfmt.MetricFamilyToText(tmp, mf); err != nil {
+		if _, err := expfmt.MetricFamilyToText(&buf, mf); err != nil {
 			level.Error(logger).Log("msg", "Error generating metric text", "err", err)
 			return err
 		}
 	}
-	if err := tmp.Close(); err != nil {
-		level.Error(logger).Log("msg", "Error closing tmp file", "err", err)
-		return err
-	}
-	if err := os.Chmod(tmp.Name(), 0644); err != nil {
-		level.Error(logger).Log("msg", "Error executing chmod 0644 on tmp file", "err", err)
-		return err
-	}
-	level.Debug(logger).Log("msg", "Renaming temp file to output", "temp", tmp.Name(), "output", *output)
-	if err := os.Rename(tmp.Name(), *output); err != nil {
-		level.Error(logger).Log("msg", "Error renaming tmp file to output", "err", err)
-		return err
-	}
-	return nil
+	return textfile.WriteFile(*output, buf.Bytes(), logger)
 }
 
 func collect(logger log.Logger) error {
 	registry := prometheus.NewRegistry()
-	registry.MustRegister(collectors.NewMmlssnapshotCollector(logger))
+	registerer := prometheus.WrapRegistererWith(collectors.ConstLabels(), registry)
+	registerer.MustRegister(collectors.CommandMetrics...)
+	lockWait := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "gpfs_exporter_lock_wait_seconds",
+		Help: "Time spent waiting to obtain the lock file",
+	})
+	lockWait.Set(lockWaitSeconds)
+	registerer.MustRegister(lockWait)
+	registerer.MustRegister(collectors.NewMmlssnapshotCollector(logger))
 	var newMfs []*dto.MetricFamily
 	var failures []string
 	mfs, err := registry.Gather()
@@ -124,7 +122,7 @@ func collect(logger log.Logger) error {
 		newMfs = mfs
 	}
 
-	if err := writeMetrics(newMfs, logger); err != nil {
+	if err := writeMetrics(newMfs, len(failures) == 0, logger); err != nil {
 		return err
 	}
 	if len(failures) != 0 {
@@ -133,10 +131,10 @@ func collect(logger log.Logger) error {
 	return nil
 
 failure:
-	if err := writeMetrics(mfs, logger); err != nil {
+	if err := writeMetrics(mfs, false, logger); err != nil {
 		return err
 	}
-	return err
+	return fmt.Errorf("Error with collection")
 }
 
 func main() {
@@ -147,18 +145,36 @@ func main() {
 	kingpin.Parse()
 
 	logger := promlog.New(promlogConfig)
+	collectors.SetFailureLogger(logger)
+	if err := collectors.ValidateFilesystems(); err != nil {
+		level.Error(logger).Log("msg", err)
+		os.Exit(1)
+	}
+	if err := collectors.ValidateRegexes(); err != nil {
+		level.Error(logger).Log("msg", err)
+		os.Exit(1)
+	}
+	if err := collectors.ValidateConstLabels(); err != nil {
+		level.Error(logger).Log("msg", err)
+		os.Exit(1)
+	}
+	if err := collectors.ValidateSudo(); err != nil {
+		level.Error(logger).Log("msg", err)
+		os.Exit(1)
+	}
+	collectors.CheckGpfsBinPath(logger)
+	if err := collectors.CheckFilesystemsExist(logger); err != nil {
+		level.Error(logger).Log("msg", err)
+		os.Exit(1)
+	}
 
-	fileLock := flock.New(*lockFile)
-	locked, err := fileLock.TryLock()
+	fileLock, waitSeconds, err := textfile.AcquireLock(*lockFile, *lockStaleTimeout, logger)
 	if err != nil {
 		level.Error(logger).Log("msg", "Unable to obtain lock on lock file", "lockfile", *lockFile)
 		level.Error(logger).Log("msg", err)
 		os.Exit(1)
 	}
-	if !locked {
-		level.Error(logger).Log("msg", fmt.Sprintf("Lock file %s is locked", *lockFile))
-		os.Exit(1)
-	}
+	lockWaitSeconds = waitSeconds
 	err = collect(logger)
 	if err != nil {
 		os.Exit(1)
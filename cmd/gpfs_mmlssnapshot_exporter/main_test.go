@@ -36,35 +36,74 @@ mmlssnapshot::0:1:::ess:20201115_PAS1736:16337:Valid:Sun Nov 15 02%3A47%3A48 202
 	expected = `
 # HELP gpfs_snapshot_created_timestamp_seconds GPFS snapshot creation timestamp
 # TYPE gpfs_snapshot_created_timestamp_seconds gauge
-gpfs_snapshot_created_timestamp_seconds{fileset="",fs="ess",id="27107",snapshot="20210120"} 1.611120602e+09
-gpfs_snapshot_created_timestamp_seconds{fileset="PAS1736",fs="ess",id="16337",snapshot="20201115_PAS1736"} 1.605426468e+09
-# HELP gpfs_snapshot_data_size_bytes GPFS snapshot data size
+gpfs_snapshot_created_timestamp_seconds{fileset="",fs="ess",id="27107",remote_cluster="",snapshot="20210120"} 1.611120602e+09
+gpfs_snapshot_created_timestamp_seconds{fileset="PAS1736",fs="ess",id="16337",remote_cluster="",snapshot="20201115_PAS1736"} 1.605426468e+09
+# HELP gpfs_snapshot_data_size_bytes GPFS snapshot data size in bytes
 # TYPE gpfs_snapshot_data_size_bytes gauge
-gpfs_snapshot_data_size_bytes{fileset="",fs="ess",id="27107",snapshot="20210120"} 8.4335344877568e+14
-gpfs_snapshot_data_size_bytes{fileset="PAS1736",fs="ess",id="16337",snapshot="20201115_PAS1736"} 0
-# HELP gpfs_snapshot_metadata_size_bytes GPFS snapshot metadata size
+gpfs_snapshot_data_size_bytes{fileset="",fs="ess",id="27107",remote_cluster="",snapshot="20210120"} 8.4335344877568e+14
+gpfs_snapshot_data_size_bytes{fileset="PAS1736",fs="ess",id="16337",remote_cluster="",snapshot="20201115_PAS1736"} 0
+# HELP gpfs_snapshot_filtered_count GPFS count of snapshots excluded by the include, exclude and min-age filters
+# TYPE gpfs_snapshot_filtered_count gauge
+gpfs_snapshot_filtered_count{fs="ess",remote_cluster=""} 0
+# HELP gpfs_snapshot_metadata_size_bytes GPFS snapshot metadata size in bytes
 # TYPE gpfs_snapshot_metadata_size_bytes gauge
-gpfs_snapshot_metadata_size_bytes{fileset="",fs="ess",id="27107",snapshot="20210120"} 5.42144495616e+11
-gpfs_snapshot_metadata_size_bytes{fileset="PAS1736",fs="ess",id="16337",snapshot="20201115_PAS1736"} 2.10108416e+08
+gpfs_snapshot_metadata_size_bytes{fileset="",fs="ess",id="27107",remote_cluster="",snapshot="20210120"} 5.42144495616e+11
+gpfs_snapshot_metadata_size_bytes{fileset="PAS1736",fs="ess",id="16337",remote_cluster="",snapshot="20201115_PAS1736"} 2.10108416e+08
 # HELP gpfs_snapshot_status_info GPFS snapshot status
 # TYPE gpfs_snapshot_status_info gauge
-gpfs_snapshot_status_info{fileset="",fs="ess",id="27107",snapshot="20210120",status="Valid"} 1
-gpfs_snapshot_status_info{fileset="PAS1736",fs="ess",id="16337",snapshot="20201115_PAS1736",status="Valid"} 1`
+gpfs_snapshot_status_info{fileset="",fs="ess",id="27107",remote_cluster="",snapshot="20210120",status="Valid"} 1
+gpfs_snapshot_status_info{fileset="PAS1736",fs="ess",id="16337",remote_cluster="",snapshot="20201115_PAS1736",status="Valid"} 1`
 	expectedNoError = `# HELP gpfs_exporter_collect_error Indicates if error has occurred during collection
 # TYPE gpfs_exporter_collect_error gauge
 gpfs_exporter_collect_error{collector="mmlssnapshot-ess"} 0
+# HELP gpfs_exporter_collect_error_reason Indicates the reason for a collection error or timeout
+# TYPE gpfs_exporter_collect_error_reason gauge
+gpfs_exporter_collect_error_reason{collector="mmlssnapshot-ess",reason="gpfs_down"} 0
+gpfs_exporter_collect_error_reason{collector="mmlssnapshot-ess",reason="not_found"} 0
+gpfs_exporter_collect_error_reason{collector="mmlssnapshot-ess",reason="other"} 0
+gpfs_exporter_collect_error_reason{collector="mmlssnapshot-ess",reason="parse"} 0
+gpfs_exporter_collect_error_reason{collector="mmlssnapshot-ess",reason="permission"} 0
+gpfs_exporter_collect_error_reason{collector="mmlssnapshot-ess",reason="timeout"} 0
+# HELP gpfs_exporter_collect_success Indicates the collector completed without error or timeout and parsed at least one record
+# TYPE gpfs_exporter_collect_success gauge
+gpfs_exporter_collect_success{collector="mmlssnapshot-ess"} 1
+gpfs_exporter_collect_success 1
 # HELP gpfs_exporter_collect_timeout Indicates the collector timed out
 # TYPE gpfs_exporter_collect_timeout gauge
 gpfs_exporter_collect_timeout{collector="mmlssnapshot-ess"} 0`
 	expectedError = `# HELP gpfs_exporter_collect_error Indicates if error has occurred during collection
 # TYPE gpfs_exporter_collect_error gauge
 gpfs_exporter_collect_error{collector="mmlssnapshot-ess"} 1
+# HELP gpfs_exporter_collect_error_reason Indicates the reason for a collection error or timeout
+# TYPE gpfs_exporter_collect_error_reason gauge
+gpfs_exporter_collect_error_reason{collector="mmlssnapshot-ess",reason="gpfs_down"} 0
+gpfs_exporter_collect_error_reason{collector="mmlssnapshot-ess",reason="not_found"} 0
+gpfs_exporter_collect_error_reason{collector="mmlssnapshot-ess",reason="other"} 1
+gpfs_exporter_collect_error_reason{collector="mmlssnapshot-ess",reason="parse"} 0
+gpfs_exporter_collect_error_reason{collector="mmlssnapshot-ess",reason="permission"} 0
+gpfs_exporter_collect_error_reason{collector="mmlssnapshot-ess",reason="timeout"} 0
+# HELP gpfs_exporter_collect_success Indicates the collector completed without error or timeout and parsed at least one record
+# TYPE gpfs_exporter_collect_success gauge
+gpfs_exporter_collect_success{collector="mmlssnapshot-ess"} 0
+gpfs_exporter_collect_success 0
 # HELP gpfs_exporter_collect_timeout Indicates the collector timed out
 # TYPE gpfs_exporter_collect_timeout gauge
 gpfs_exporter_collect_timeout{collector="mmlssnapshot-ess"} 0`
 	expectedTimeout = `# HELP gpfs_exporter_collect_error Indicates if error has occurred during collection
 # TYPE gpfs_exporter_collect_error gauge
 gpfs_exporter_collect_error{collector="mmlssnapshot-ess"} 0
+# HELP gpfs_exporter_collect_error_reason Indicates the reason for a collection error or timeout
+# TYPE gpfs_exporter_collect_error_reason gauge
+gpfs_exporter_collect_error_reason{collector="mmlssnapshot-ess",reason="gpfs_down"} 0
+gpfs_exporter_collect_error_reason{collector="mmlssnapshot-ess",reason="not_found"} 0
+gpfs_exporter_collect_error_reason{collector="mmlssnapshot-ess",reason="other"} 0
+gpfs_exporter_collect_error_reason{collector="mmlssnapshot-ess",reason="parse"} 0
+gpfs_exporter_collect_error_reason{collector="mmlssnapshot-ess",reason="permission"} 0
+gpfs_exporter_collect_error_reason{collector="mmlssnapshot-ess",reason="timeout"} 1
+# HELP gpfs_exporter_collect_success Indicates the collector completed without error or timeout and parsed at least one record
+# TYPE gpfs_exporter_collect_success gauge
+gpfs_exporter_collect_success{collector="mmlssnapshot-ess"} 0
+gpfs_exporter_collect_success 0
 # HELP gpfs_exporter_collect_timeout Indicates the collector timed out
 # TYPE gpfs_exporter_collect_timeout gauge
 gpfs_exporter_collect_timeout{collector="mmlssnapshot-ess"} 1`
@@ -107,6 +146,12 @@ func TestCollect(t *testing.T) {
 	if !strings.Contains(string(content), expectedNoError) {
 		t.Errorf("Unexpected error metrics:\n%s\nExpected:\n%s", string(content), expectedError)
 	}
+	if !strings.Contains(string(content), "gpfs_exporter_collect_success 1") {
+		t.Errorf("Unexpected collect success metric:\n%s", string(content))
+	}
+	if !strings.Contains(string(content), "gpfs_exporter_last_collect_timestamp_seconds") {
+		t.Errorf("Missing last collect timestamp metric:\n%s", string(content))
+	}
 }
 
 func TestCollectError(t *testing.T) {
@@ -131,6 +176,12 @@ func TestCollectError(t *testing.T) {
 	if !strings.Contains(string(content), expectedError) {
 		t.Errorf("Unexpected error metrics:\n%s\nExpected:\n%s", string(content), expectedError)
 	}
+	if !strings.Contains(string(content), "gpfs_exporter_collect_success 0") {
+		t.Errorf("Unexpected collect success metric:\n%s", string(content))
+	}
+	if !strings.Contains(string(content), "gpfs_exporter_last_collect_timestamp_seconds") {
+		t.Errorf("Missing last collect timestamp metric:\n%s", string(content))
+	}
 }
 
 func TestCollectTimeout(t *testing.T) {
@@ -155,4 +206,56 @@ func TestCollectTimeout(t *testing.T) {
 	if !strings.Contains(string(content), expectedTimeout) {
 		t.Errorf("Unexpected error metrics:\n%s\nExpected:\n%s", string(content), expectedError)
 	}
+	if !strings.Contains(string(content), "gpfs_exporter_collect_success 0") {
+		t.Errorf("Unexpected collect success metric:\n%s", string(content))
+	}
+	if !strings.Contains(string(content), "gpfs_exporter_last_collect_timestamp_seconds") {
+		t.Errorf("Missing last collect timestamp metric:\n%s", string(content))
+	}
+}
+
+func TestCollectLockWait(t *testing.T) {
+	lockWaitSeconds = 0.25
+	defer func() { lockWaitSeconds = 0 }()
+	collectors.MmlssnapshotExec = func(fs string, ctx context.Context) (string, error) {
+		return mmlssnapshotStdout, nil
+	}
+	if err := collect(log.NewNopLogger()); err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+	content, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if !strings.Contains(string(content), "gpfs_exporter_lock_wait_seconds 0.25") {
+		t.Errorf("Expected lock wait metric in output:\n%s", string(content))
+	}
+}
+
+func TestCollectErrorInvalidOutput(t *testing.T) {
+	collectors.MmlssnapshotExec = func(fs string, ctx context.Context) (string, error) {
+		return "", fmt.Errorf("Error")
+	}
+	if err := os.WriteFile(outputPath, []byte("invalid metrics\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := collect(log.NewNopLogger()); err == nil {
+		t.Errorf("Expected error")
+	}
+	content, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if !strings.Contains(string(content), "gpfs_exporter_collect_success 0") {
+		t.Errorf("Unexpected collect success metric:\n%s", string(content))
+	}
+	if !strings.Contains(string(content), "gpfs_exporter_last_collect_timestamp_seconds") {
+		t.Errorf("Missing last collect timestamp metric:\n%s", string(content))
+	}
+	collectors.MmlssnapshotExec = func(fs string, ctx context.Context) (string, error) {
+		return mmlssnapshotStdout, nil
+	}
+	if err := collect(log.NewNopLogger()); err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
 }
@@ -16,54 +16,262 @@ package collectors
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"net/url"
+	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime/debug"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/alecthomas/kingpin/v2"
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
 )
 
 const (
 	namespace = "gpfs"
+	// anyRecords is the record count for collectors where an empty result is valid
+	anyRecords = -1
 )
 
 var (
-	collectorState = make(map[string]*bool)
-	factories      = make(map[string]func(logger log.Logger) Collector)
-	execCommand    = exec.CommandContext
-	MmlsfsExec     = mmlsfs
-	MmdiagExec     = mmdiag
-	NowLocation    = func() *time.Location {
+	collectorState    = make(map[string]*bool)
+	forcedCollectors  = make(map[string]bool)
+	collectorSeries   = make(map[string]*int)
+	collectorRetries  = make(map[string]*int)
+	factories         = make(map[string]func(logger log.Logger) Collector)
+	collectorDefaults = make(map[string]bool)
+	execCommand       = exec.CommandContext
+	commandWaitDelay  = 5 * time.Second
+	MmlsfsExec        = mmlsfs
+	MmdiagExec        = mmdiag
+	NowLocation       = func() *time.Location {
 		return time.Now().Location()
 	}
-	collectDuration = prometheus.NewDesc(
+	collectDuration = newDesc(
 		prometheus.BuildFQName(namespace, "exporter", "collector_duration_seconds"),
 		"Collector time duration.",
 		[]string{"collector"}, nil)
-	collectError = prometheus.NewDesc(
+	collectError = newDesc(
 		prometheus.BuildFQName(namespace, "exporter", "collect_error"),
 		"Indicates if error has occurred during collection",
 		[]string{"collector"}, nil)
-	collecTimeout = prometheus.NewDesc(
+	collecTimeout = newDesc(
 		prometheus.BuildFQName(namespace, "exporter", "collect_timeout"),
 		"Indicates the collector timed out",
 		[]string{"collector"}, nil)
-	lastExecution = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "exporter", "last_execution"),
-		"Last execution time of ", []string{"collector"}, nil)
-	sudoCmd       = kingpin.Flag("config.sudo.command", "The command to run sudo").Default("sudo").String()
+	collectErrorReason = newDesc(
+		prometheus.BuildFQName(namespace, "exporter", "collect_error_reason"),
+		"Indicates the reason for a collection error or timeout",
+		[]string{"collector", "reason"}, nil)
+	errorReasons      = []string{"timeout", "not_found", "permission", "gpfs_down", "parse", "other"}
+	notFoundPattern   = regexp.MustCompile(`(?i)command not found|no such file or directory`)
+	permissionPattern = regexp.MustCompile(`(?i)permission denied|not allowed to execute|password is required|not in the sudoers|operation not permitted`)
+	gpfsDownPattern   = regexp.MustCompile(`(?i)gpfs is not (running|ready|active)|daemon is not running|mmfsd is not running|gpfs is down|the gpfs daemon has been stopped`)
+	collectSuccess    = newDesc(
+		prometheus.BuildFQName(namespace, "exporter", "collect_success"),
+		"Indicates the collector completed without error or timeout and parsed at least one record",
+		[]string{"collector"}, nil)
+	lastExecution = newDesc(
+		prometheus.BuildFQName(namespace, "exporter", "last_execution_timestamp_seconds"),
+		"Unix timestamp of the last execution of the collector",
+		[]string{"collector"}, nil)
+	lastSuccess = newDesc(
+		prometheus.BuildFQName(namespace, "exporter", "last_success_timestamp_seconds"),
+		"Unix timestamp of the last execution of the collector that completed without error, 0 if none has",
+		[]string{"collector"}, nil)
+	filesystemsAdded = newDesc(
+		prometheus.BuildFQName(namespace, "exporter", "filesystems_added_total"),
+		"Number of filesystems added to the collected set since exporter start",
+		[]string{"collector"}, nil)
+	filesystemsRemoved = newDesc(
+		prometheus.BuildFQName(namespace, "exporter", "filesystems_removed_total"),
+		"Number of filesystems removed from the collected set since exporter start",
+		[]string{"collector"}, nil)
+	filesystemsExcluded = newDesc(
+		prometheus.BuildFQName(namespace, "exporter", "filesystems_excluded"),
+		"Number of filesystems discovered with mmlsfs that were excluded from collection",
+		[]string{"collector"}, nil)
+	filesystemsChanged = newDesc(
+		prometheus.BuildFQName(namespace, "exporter", "filesystems_changed"),
+		"Indicates the collected set of filesystems changed since the previous collection",
+		[]string{"collector"}, nil)
+	filesystemsCache = &FilesystemTracker{
+		filesystems: make(map[string][]string),
+		added:       make(map[string]float64),
+		removed:     make(map[string]float64),
+	}
+	lastSuccessCache = &LastSuccessTracker{
+		times: make(map[string]float64),
+	}
+	collectFailures = &FailureLogger{
+		logger: log.NewNopLogger(),
+		logged: make(map[string]time.Time),
+	}
+	commandDump     = &CommandDump{}
+	commandDuration = newHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "exporter",
+		Name:      "command_duration_seconds",
+		Help:      "Duration of GPFS command executions",
+	}, []string{"command"})
+	commandFailures = newCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "exporter",
+		Name:      "command_failures_total",
+		Help:      "Number of failed GPFS command executions",
+	}, []string{"command", "reason"})
+	commandsInFlight = newGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "exporter",
+		Name:      "commands_in_flight",
+		Help:      "Number of GPFS commands currently executing",
+	}, []string{"command"})
+	parseErrors = newCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "exporter",
+		Name:      "parse_errors_total",
+		Help:      "Number of command output rows skipped because they could not be parsed",
+	}, []string{"collector"})
+	collectorPanics = newCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "exporter",
+		Name:      "collector_panics_total",
+		Help:      "Number of collector panics recovered during collection",
+	}, []string{"collector"})
+	commandRetries = newCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "exporter",
+		Name:      "command_retries_total",
+		Help:      "Number of failed GPFS command executions that were retried",
+	}, []string{"collector"})
+	commandKilled = newCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "exporter",
+		Name:      "command_killed_total",
+		Help:      "Number of GPFS commands that did not exit after the collector's timeout and were killed and abandoned",
+	}, []string{"collector"})
+	inflightCollections = newGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "exporter",
+		Name:      "inflight_collections",
+		Help:      "Number of collections currently running, a value that keeps growing means collections are not returning",
+	}, []string{"collector"})
+	seriesLimitExceeded = newGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "exporter",
+		Name:      "series_limit_exceeded",
+		Help:      "Indicates the last collection reached the collector's series limit and further series were dropped",
+	}, []string{"collector"})
+	parseIncomplete = newGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "exporter",
+		Name:      "parse_incomplete",
+		Help:      "Indicates the last command output was missing required sections, such as when it was truncated",
+	}, []string{"collector"})
+	collectorEnabled = newDesc(
+		prometheus.BuildFQName(namespace, "exporter", "collector_enabled"),
+		"Indicates the collector is enabled by flags",
+		[]string{"collector"}, nil)
+	configuredFilesystemMissing = newDesc(
+		prometheus.BuildFQName(namespace, "exporter", "configured_filesystem_missing"),
+		"Indicates a filesystem set by collector flags was not found by mmlsfs",
+		[]string{"fs"}, nil)
+	// CommandMetrics are the collectors for command execution, parsing, collector panic and missing filesystem metrics
+	CommandMetrics = []prometheus.Collector{commandDuration, commandFailures, commandsInFlight, inflightCollections, parseErrors, parseIncomplete, collectorPanics, commandRetries,
+		commandKilled, seriesLimitExceeded, nodeRole, configuredFilesystemsCollector{}}
+	// CollectorDurationHistogram tracks collector durations across scrapes, only useful for long running exporters
+	CollectorDurationHistogram = newHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "exporter",
+		Name:      "collector_duration_seconds_histogram",
+		Help:      "Histogram of collector time duration.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600},
+	}, []string{"collector"})
+	scrapes = &ScrapeGroup{
+		calls:     make(map[string]*scrapeCall),
+		last:      make(map[string][]prometheus.Metric),
+		deadlines: make(map[string]time.Time),
+	}
+	logCollectFailures = kingpin.Flag("log.collect-failures",
+		"Log collections that end with an error or timeout at error level, each collector and reason is logged at most once per --log.collect-failures-interval").
+		Default("false").Bool()
+	logCollectFailuresInterval = kingpin.Flag("log.collect-failures-interval",
+		"Minimum time between logs of failed collections with the same collector and reason").Default("10m").Duration()
+	disableDefaults = kingpin.Flag("collector.disable-defaults",
+		"Disable the collectors enabled by default, only collectors enabled with --collector.<name> are run").
+		Default("false").Bool()
+	concurrentScrape = kingpin.Flag("exporter.concurrent-scrape",
+		"How to handle a scrape while a collector is already running, block waits and shares the result, cached serves the last result").
+		Default("block").Enum("block", "cached")
+	constLabels = kingpin.Flag("metrics.const-labels",
+		"Labels added to every metric as comma separated name=value pairs, for example cluster=ess01,site=dc2").
+		Default("").String()
+	keepLastOnDiscoveryFailure = kingpin.Flag("collector.keep-last-on-discovery-failure",
+		"When mmlsfs fails collect the filesystems discovered by the last successful mmlsfs of the collector").
+		Default("false").Bool()
+	validateFilesystems = kingpin.Flag("collector.validate-filesystems",
+		"Check that filesystems set by collector flags are found by mmlsfs, fail exits at startup and warn only logs").
+		Default("off").Enum("off", "warn", "fail")
+	sudoCmd       = kingpin.Flag("sudo.command", "The command used to run GPFS commands, may include arguments such as 'sudo -n -u gpfsadmin'").Default("sudo").String()
+	sudoCmdLegacy = kingpin.Flag("config.sudo.command", "Deprecated, use --sudo.command").Hidden().Default("").String()
+	sudoDisable   = kingpin.Flag("sudo.disable", "Run GPFS commands directly rather than with --sudo.command, such as when running as root").Default("false").Bool()
+	sudoSingleArg = kingpin.Flag("sudo.single-argument", "Pass the GPFS command and its arguments to --sudo.command as a single argument").Default("false").Bool()
+	gpfsBinPath   = kingpin.Flag("gpfs.bin-path", "Directory containing the GPFS commands").Default("/usr/lpp/mmfs/bin").String()
+	fixtureDir    = kingpin.Flag("command.fixture-dir", "Directory of captured command output to read instead of executing GPFS commands").Default("").String()
 	mmlsfsTimeout = kingpin.Flag("config.mmlsfs.timeout", "Timeout for mmlsfs execution").Default("5").Int()
+	mmlsfsTTL     = kingpin.Flag("collector.mmlsfs.cache-ttl", "How long filesystems discovered with mmlsfs are cached and shared between collectors").Default("60s").Duration()
+	mmlsfsCache   = &MmlsfsCache{}
+	parent        = &parentCtx{ctx: context.Background()}
+	commands      = &commandTracker{}
+	fsExclude     = kingpin.Flag("collector.filesystems-exclude", "Regex of filesystems discovered with mmlsfs to exclude, such as remote cluster filesystems").Default("^$").String()
+	retries       = kingpin.Flag("collector.retries", "Number of times a failed GPFS command is retried within the collector's timeout, timeouts are not retried").Default("0").Int()
+	retryBackoff  = kingpin.Flag("collector.retry-backoff", "Time to wait before the first retry of a failed GPFS command, doubled for each following retry").Default("1s").Duration()
+	maxSeries     = kingpin.Flag("collector.max-series", "Maximum number of series a collector may report in a scrape, further series are dropped, 0 disables the limit").Default("0").Int()
+	killGrace     = kingpin.Flag("collector.kill-grace", "Time after a collector's timeout to wait for a GPFS command to exit before its process group is killed and the command is abandoned").Default("10s").Duration()
 )
 
+// MmlsfsCache shares the filesystems discovered with mmlsfs between collectors
+type MmlsfsCache struct {
+	sync.Mutex
+	filesystems []string
+	mountpoints []GPFSFilesystem
+	err         error
+	updated     time.Time
+}
+
+// parentCtx is the context all collector command contexts derive from
+type parentCtx struct {
+	sync.Mutex
+	ctx context.Context
+}
+
+// commandTracker counts running GPFS commands, once stopped by WaitCommands no new
+// commands are started so the wait can not race with commands being added
+type commandTracker struct {
+	sync.Mutex
+	wg      sync.WaitGroup
+	stopped bool
+}
+
+// FlagsLock is held for writing while a configuration reload changes flag values. Scrapes are
+// not run during a reload, code that reads flags outside of a scrape, such as the periodic sudo
+// check and commands abandoned after a timeout, holds it for reading.
+var FlagsLock sync.RWMutex
+
+var errCommandsStopped = errors.New("GPFS commands are not started during shutdown")
+
 type DurationBucketValues []float64
 
 func (d *DurationBucketValues) Set(value string) error {
@@ -92,8 +300,95 @@ func DurationBuckets(s kingpin.Settings) (target *[]float64) {
 }
 
 type GPFSFilesystem struct {
-	Name       string
-	Mountpoint string
+	Name          string
+	Mountpoint    string
+	RemoteCluster string
+}
+
+// FilesystemTracker keeps the filesystems collected by each collector
+// across scrapes so changes to the set can be reported.
+type FilesystemTracker struct {
+	sync.Mutex
+	filesystems map[string][]string
+	added       map[string]float64
+	removed     map[string]float64
+}
+
+// LastSuccessTracker records when each collector last completed without error.
+// Collectors are created for every scrape so this state is kept at the package level.
+type LastSuccessTracker struct {
+	sync.Mutex
+	times map[string]float64
+}
+
+// FailureLogger logs collections that end with an error or timeout, each collector and reason
+// is logged at most once per interval so a collector that keeps failing does not flood the log.
+type FailureLogger struct {
+	sync.Mutex
+	logger log.Logger
+	logged map[string]time.Time
+}
+
+// SetFailureLogger sets the logger used by --log.collect-failures
+func SetFailureLogger(logger log.Logger) {
+	collectFailures.Lock()
+	defer collectFailures.Unlock()
+	collectFailures.logger = logger
+}
+
+func (f *FailureLogger) log(collector string, err error, duration float64, now time.Time) {
+	if !*logCollectFailures {
+		return
+	}
+	reason := errorReason(err)
+	key := collector + ":" + reason
+	f.Lock()
+	defer f.Unlock()
+	if last, ok := f.logged[key]; ok && now.Sub(last) < *logCollectFailuresInterval {
+		return
+	}
+	f.logged[key] = now
+	keyvals := []interface{}{"msg", "Collection failed"}
+	if name, fs, found := strings.Cut(collector, "-"); found && fs != "mmlsfs" {
+		keyvals = append(keyvals, "collector", name, "fs", fs)
+	} else {
+		keyvals = append(keyvals, "collector", collector)
+	}
+	keyvals = append(keyvals, "reason", reason, "duration", duration, "err", err)
+	level.Error(f.logger).Log(keyvals...)
+}
+
+// CommandDump records the raw output of commands run by collectors and the
+// results parsed from it so they can be included in diagnostic output.
+type CommandDump struct {
+	sync.Mutex
+	enabled bool
+	outputs map[string]string
+	parsed  map[string]interface{}
+}
+
+// ScrapeGroup ensures only one Collect runs at a time for each collector
+// and shares the resulting metrics with concurrent scrapes. The deadline of
+// the scrape running a collector limits the timeout of its commands.
+type ScrapeGroup struct {
+	sync.Mutex
+	calls     map[string]*scrapeCall
+	last      map[string][]prometheus.Metric
+	deadlines map[string]time.Time
+}
+
+type scrapeCall struct {
+	wg      sync.WaitGroup
+	metrics []prometheus.Metric
+}
+
+type sharedCollector struct {
+	name      string
+	collector Collector
+	logger    log.Logger
+	// factory is the registered name of the collector and deadline the deadline of the scrape
+	factory  string
+	deadline time.Time
 }
 
 type GPFSCollector struct {
@@ -107,6 +402,14 @@ type Collector interface {
 	Collect(ch chan<- prometheus.Metric)
 }
 
+func init() {
+	// Collectors set by flags are recorded by flag actions, reset them before each parse
+	kingpin.CommandLine.PreAction(func(*kingpin.ParseContext) error {
+		forcedCollectors = make(map[string]bool)
+		return nil
+	})
+}
+
 func registerCollector(collector string, isDefaultEnabled bool, factory func(logger log.Logger) Collector) {
 	var helpDefaultState string
 	if isDefaultEnabled {
@@ -117,23 +420,185 @@ func registerCollector(collector string, isDefaultEnabled bool, factory func(log
 	flagName := fmt.Sprintf("collector.%s", collector)
 	flagHelp := fmt.Sprintf("Enable the %s collector (default: %s).", collector, helpDefaultState)
 	defaultValue := fmt.Sprintf("%v", isDefaultEnabled)
-	flag := kingpin.Flag(flagName, flagHelp).Default(defaultValue).Bool()
+	flag := kingpin.Flag(flagName, flagHelp).Default(defaultValue).Action(func(*kingpin.ParseContext) error {
+		forcedCollectors[collector] = true
+		return nil
+	}).Bool()
 	collectorState[collector] = flag
+	collectorRetries[collector] = kingpin.Flag(flagName+".retries",
+		fmt.Sprintf("Number of times a failed GPFS command is retried for the %s collector, defaults to --collector.retries", collector)).Default("-1").Int()
+	collectorSeries[collector] = kingpin.Flag(flagName+".max-series",
+		fmt.Sprintf("Maximum number of series the %s collector may report in a scrape, defaults to --collector.max-series", collector)).Default("-1").Int()
 	factories[collector] = factory
+	collectorDefaults[collector] = isDefaultEnabled
+}
+
+// CollectorEnabled returns true if the named collector is enabled by flags. With
+// --collector.disable-defaults only collectors set with --collector.<name> are enabled.
+// With --collector.auto-role the collectors not set with --collector.<name> are enabled
+// by the detected roles of the node.
+func CollectorEnabled(collector string) bool {
+	enabled, ok := collectorState[collector]
+	if !ok {
+		return false
+	}
+	if forcedCollectors[collector] {
+		return *enabled
+	}
+	if roleEnabled, ok := autoRoleEnabled(collector); ok {
+		return roleEnabled
+	}
+	return *enabled && !*disableDefaults
+}
+
+// SetCollectorFlag sets the collector.* flag name to value the same as setting it on the command line
+func SetCollectorFlag(name string, value string) error {
+	flag := kingpin.CommandLine.GetFlag(name)
+	if flag == nil || !strings.HasPrefix(name, "collector.") {
+		return fmt.Errorf("Unknown collector flag %s", name)
+	}
+	if err := flag.Model().Value.Set(value); err != nil {
+		return fmt.Errorf("Invalid value %q for %s: %w", value, name, err)
+	}
+	if _, ok := collectorState[strings.TrimPrefix(name, "collector.")]; ok {
+		forcedCollectors[strings.TrimPrefix(name, "collector.")] = true
+	}
+	return nil
+}
+
+// EnabledCollectorsMetrics reports gpfs_exporter_collector_enabled for every registered collector
+var EnabledCollectorsMetrics prometheus.Collector = enabledCollectorsCollector{}
+
+type enabledCollectorsCollector struct{}
+
+func (c enabledCollectorsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collectorEnabled
+}
+
+func (c enabledCollectorsCollector) Collect(ch chan<- prometheus.Metric) {
+	for collector := range collectorState {
+		var enabled float64
+		if CollectorEnabled(collector) {
+			enabled = 1
+		}
+		ch <- prometheus.MustNewConstMetric(collectorEnabled, prometheus.GaugeValue, enabled, collector)
+	}
 }
 
 func NewGPFSCollector(logger log.Logger) *GPFSCollector {
 	collectors := make(map[string]Collector)
-	for key, enabled := range collectorState {
+	for key := range collectorState {
 		var collector Collector
-		if *enabled {
-			collector = factories[key](log.With(logger, "collector", key))
-			collectors[key] = collector
+		if CollectorEnabled(key) {
+			collectorLogger := log.With(logger, "collector", key)
+			collector = factories[key](collectorLogger)
+			collectors[key] = &sharedCollector{name: key, collector: collector, logger: collectorLogger, factory: key}
 		}
 	}
 	return &GPFSCollector{Collectors: collectors}
 }
 
+func (g *ScrapeGroup) collect(s *sharedCollector) []prometheus.Metric {
+	name, collector, logger := s.name, s.collector, s.logger
+	g.Lock()
+	if call, ok := g.calls[name]; ok {
+		last, cached := g.last[name]
+		g.Unlock()
+		if *concurrentScrape == "cached" && cached {
+			return last
+		}
+		call.wg.Wait()
+		return call.metrics
+	}
+	call := &scrapeCall{}
+	call.wg.Add(1)
+	g.calls[name] = call
+	if !s.deadline.IsZero() {
+		g.deadlines[s.factory] = s.deadline
+	}
+	g.Unlock()
+
+	ch := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	go func() {
+		limit := seriesLimit(s.factory)
+		var series int
+		var exceeded bool
+		for m := range ch {
+			if limit > 0 && !seriesLimitExempt(m.Desc()) {
+				if series >= limit {
+					if !exceeded {
+						info, _ := describeDesc(m.Desc())
+						level.Error(logger).Log("msg", "Collector reached its series limit, dropping further series", "collector", name, "limit", limit, "metric", info.Name)
+					}
+					exceeded = true
+					continue
+				}
+				series++
+			}
+			call.metrics = append(call.metrics, m)
+		}
+		if limit <= 0 {
+			seriesLimitExceeded.DeleteLabelValues(name)
+		} else if exceeded {
+			seriesLimitExceeded.WithLabelValues(name).Set(1)
+		} else {
+			seriesLimitExceeded.WithLabelValues(name).Set(0)
+		}
+		close(done)
+	}()
+	collectRecover(name, collector, ch, logger)
+	close(ch)
+	<-done
+
+	g.Lock()
+	g.last[name] = call.metrics
+	delete(g.calls, name)
+	if !s.deadline.IsZero() && g.deadlines[s.factory].Equal(s.deadline) {
+		delete(g.deadlines, s.factory)
+	}
+	g.Unlock()
+	call.wg.Done()
+	return call.metrics
+}
+
+// seriesLimit returns the maximum number of series for collector, 0 when there is no limit
+func seriesLimit(collector string) int {
+	if l, ok := collectorSeries[collector]; ok && *l >= 0 {
+		return *l
+	}
+	return *maxSeries
+}
+
+// seriesLimitExempt returns true for the status metrics collectors report about themselves,
+// which are not counted or dropped by the series limit
+func seriesLimitExempt(desc *prometheus.Desc) bool {
+	for _, d := range statusDescs {
+		if desc == d {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *sharedCollector) Describe(ch chan<- *prometheus.Desc) {
+	s.collector.Describe(ch)
+}
+
+// deadline returns the deadline of the scrape running the collector, if any
+func (g *ScrapeGroup) deadline(collector string) (time.Time, bool) {
+	g.Lock()
+	defer g.Unlock()
+	deadline, ok := g.deadlines[collector]
+	return deadline, ok
+}
+
+func (s *sharedCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, m := range scrapes.collect(s) {
+		ch <- m
+	}
+}
+
 func SliceContains(slice []string, str string) bool {
 	for _, s := range slice {
 		if str == s {
@@ -143,6 +608,265 @@ func SliceContains(slice []string, str string) bool {
 	return false
 }
 
+// SplitList splits a comma separated value, trimming whitespace and dropping empty entries
+func SplitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// gpfsTimeLayouts are the timestamp layouts printed by GPFS commands, ANSIC is printed with LC_ALL=C
+// and the others include a timezone
+var gpfsTimeLayouts = []string{
+	time.ANSIC,
+	time.RubyDate,
+	"Mon Jan _2 15:04:05 2006 -0700",
+	time.UnixDate,
+	"Mon Jan _2 15:04:05 2006 MST",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05 MST",
+}
+
+// parseGPFSTime parses a timestamp from GPFS command output trying each of gpfsTimeLayouts.
+// Times without a timezone, or with an abbreviation not known in the local timezone, are parsed
+// in the local timezone.
+func parseGPFSTime(value string) (time.Time, error) {
+	value = strings.Join(strings.Fields(value), " ")
+	for _, layout := range gpfsTimeLayouts {
+		t, err := time.ParseInLocation(layout, value, NowLocation())
+		if err != nil {
+			continue
+		}
+		if name, offset := t.Zone(); offset == 0 && name != "" && name != "UTC" && name != "GMT" {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), NowLocation())
+		}
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("Unable to parse time %q", value)
+}
+
+// DecodeGPFSString decodes the %XX escapes GPFS uses in -Y output for any byte that
+// would otherwise be ambiguous, such as colons, spaces and non-ASCII characters.
+// Unlike url.QueryUnescape a + is left as is and invalid escapes are kept literally.
+func DecodeGPFSString(value string) string {
+	if !strings.Contains(value, "%") {
+		return value
+	}
+	var b strings.Builder
+	b.Grow(len(value))
+	for i := 0; i < len(value); i++ {
+		if value[i] == '%' && i+2 < len(value) {
+			if c, err := strconv.ParseUint(value[i+1:i+3], 16, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 2
+				continue
+			}
+		}
+		b.WriteByte(value[i])
+	}
+	return b.String()
+}
+
+// filesystemFlags returns the flags that set filesystems for collectors
+func filesystemFlags() map[string]*string {
+	return map[string]*string{
+		"collector.mmafmctl.filesystems":     afmFilesystems,
+		"collector.mmbackup.filesystems":     mmbackupFilesystems,
+		"collector.mmdf.filesystems":         configFilesystems,
+		"collector.mmlsfileset.filesystems":  filesetFilesystems,
+		"collector.mmlsqos.filesystems":      qosFilesystems,
+		"collector.mmlssnapshot.filesystems": snapshotFilesystems,
+		"collector.mmrepquota.filesystems":   configMmrepquotaFilesystems,
+		"collector.mmrepquota.filesets":      configMmrepquotaFilesets,
+	}
+}
+
+// ValidateFilesystems returns an error if any filesystem set by flags is not a valid name
+func ValidateFilesystems() error {
+	flags := filesystemFlags()
+	names := make([]string, 0, len(flags))
+	for name := range flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, fs := range SplitList(*flags[name]) {
+			if strings.ContainsAny(fs, "/ \t\n") {
+				return fmt.Errorf("Invalid filesystem %q for --%s", fs, name)
+			}
+		}
+	}
+	return nil
+}
+
+// regexFlags returns the flags that are compiled as regular expressions when collecting
+func regexFlags() map[string]*string {
+	return map[string]*string{
+		"collector.filesystems-exclude":          fsExclude,
+		"collector.mmces.ignored-services":       mmcesIgnoredServices,
+		"collector.mmdf.pool-include":            mmdfPoolInclude,
+		"collector.mmdf.pool-exclude":            mmdfPoolExclude,
+		"collector.mmhealth.ignored-node":        mmhealthIgnoredNode,
+		"collector.mmhealth.ignored-component":   mmhealthIgnoredComponent,
+		"collector.mmhealth.ignored-entityname":  mmhealthIgnoredEntityName,
+		"collector.mmhealth.ignored-entitytype":  mmhealthIgnoredEntityType,
+		"collector.mmhealth.ignored-event":       mmhealthIgnoredEvent,
+		"collector.mmhealth.ignored-status":      mmhealthIgnoredStatus,
+		"collector.mmhealth.fs-structure-events": mmhealthStructureEvents,
+		"collector.mmlsfs.attributes":            mmlsfsAttributes,
+		"collector.mmlssnapshot.include":         snapshotInclude,
+		"collector.mmlssnapshot.exclude":         snapshotExclude,
+		"collector.network.ignored-peers":        networkIgnoredPeers,
+		"collector.waiter.exclude":               waiterExclude,
+	}
+}
+
+// ValidateRegexes returns an error if any regex set by flags does not compile, so a typo
+// fails at startup rather than every collection
+func ValidateRegexes() error {
+	flags := regexFlags()
+	names := make([]string, 0, len(flags))
+	for name := range flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := regexp.Compile(*flags[name]); err != nil {
+			return fmt.Errorf("Invalid regex for --%s: %s", name, err)
+		}
+	}
+	return nil
+}
+
+// ValidateConstLabels returns an error if --metrics.const-labels is not a list of valid name=value pairs
+func ValidateConstLabels() error {
+	_, err := parseConstLabels(*constLabels)
+	return err
+}
+
+// ConstLabels returns the labels set by --metrics.const-labels to add to every metric,
+// invalid pairs are skipped as they are rejected at startup by ValidateConstLabels
+func ConstLabels() prometheus.Labels {
+	labels, _ := parseConstLabels(*constLabels)
+	return labels
+}
+
+func parseConstLabels(value string) (prometheus.Labels, error) {
+	labels := prometheus.Labels{}
+	var err error
+	for _, pair := range SplitList(value) {
+		kv := strings.SplitN(pair, "=", 2)
+		name := strings.TrimSpace(kv[0])
+		if len(kv) != 2 {
+			err = fmt.Errorf("Invalid label %q for --metrics.const-labels, expected name=value", pair)
+			continue
+		}
+		if !model.LabelName(name).IsValid() || strings.HasPrefix(name, model.ReservedLabelPrefix) {
+			err = fmt.Errorf("Invalid label name %q for --metrics.const-labels", name)
+			continue
+		}
+		if _, ok := labels[name]; ok {
+			err = fmt.Errorf("Duplicate label name %q for --metrics.const-labels", name)
+			continue
+		}
+		labels[name] = strings.TrimSpace(kv[1])
+	}
+	return labels, err
+}
+
+// configuredFilesystems returns the filesystems set by flags and the flags that set each one
+func configuredFilesystems() map[string][]string {
+	configured := make(map[string][]string)
+	for name, value := range filesystemFlags() {
+		for _, fs := range SplitList(*value) {
+			// mmrepquota filesets are given as filesystem:fileset
+			fs = strings.SplitN(fs, ":", 2)[0]
+			if !SliceContains(configured[fs], name) {
+				configured[fs] = append(configured[fs], name)
+			}
+		}
+	}
+	for fs := range configured {
+		sort.Strings(configured[fs])
+	}
+	return configured
+}
+
+// CheckFilesystemsExist runs mmlsfs to check that the filesystems set by flags exist when
+// --collector.validate-filesystems is enabled. In warn mode problems are only logged.
+func CheckFilesystemsExist(logger log.Logger) error {
+	if *validateFilesystems == "off" {
+		return nil
+	}
+	configured := configuredFilesystems()
+	if len(configured) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(parentContext(), time.Duration(*mmlsfsTimeout)*time.Second)
+	defer cancel()
+	discovered, err := mmlsfsCache.get(ctx, logger)
+	if err != nil {
+		err = fmt.Errorf("Unable to validate filesystems with mmlsfs: %w", err)
+	} else {
+		var missing []string
+		for fs := range configured {
+			if !SliceContains(discovered, fs) {
+				missing = append(missing, fs)
+			}
+		}
+		sort.Strings(missing)
+		for _, fs := range missing {
+			level.Warn(logger).Log("msg", "Filesystem set by flags was not found by mmlsfs", "fs", fs,
+				"flags", strings.Join(configured[fs], ","), "found", strings.Join(discovered, ","))
+		}
+		if len(missing) > 0 {
+			err = fmt.Errorf("Filesystems not found by mmlsfs: %s", strings.Join(missing, ","))
+		}
+	}
+	if err != nil && *validateFilesystems == "warn" {
+		level.Warn(logger).Log("msg", "Filesystem validation failed, collectors will report errors for missing filesystems", "err", err)
+		return nil
+	}
+	return err
+}
+
+type configuredFilesystemsCollector struct{}
+
+func (c configuredFilesystemsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- configuredFilesystemMissing
+}
+
+// Collect reports if each filesystem set by flags is missing from the filesystems
+// found by mmlsfs, nothing is reported if mmlsfs fails as collectors report that error.
+func (c configuredFilesystemsCollector) Collect(ch chan<- prometheus.Metric) {
+	if *validateFilesystems == "off" {
+		return
+	}
+	configured := configuredFilesystems()
+	if len(configured) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(parentContext(), time.Duration(*mmlsfsTimeout)*time.Second)
+	defer cancel()
+	discovered, err := mmlsfsCache.get(ctx, log.NewNopLogger())
+	if err != nil {
+		return
+	}
+	for fs := range configured {
+		var missing float64
+		if !SliceContains(discovered, fs) {
+			missing = 1
+		}
+		ch <- prometheus.MustNewConstMetric(configuredFilesystemMissing, prometheus.GaugeValue, missing, fs)
+	}
+}
+
 func SliceIndex(slice []string, str string) int {
 	for i, v := range slice {
 		if v == str {
@@ -152,10 +876,43 @@ func SliceIndex(slice []string, str string) int {
 	return -1
 }
 
+// HeaderIndexMap returns the index of each column of a -Y HEADER line by name so values
+// are looked up by column name rather than position, the first column with a name is used
+func HeaderIndexMap(headers []string) map[string]int {
+	indexes := make(map[string]int)
+	for i, h := range headers {
+		if _, ok := indexes[h]; !ok && h != "" {
+			indexes[h] = i
+		}
+	}
+	return indexes
+}
+
+// headerValue returns the value of the named column, ok is false when the
+// header has no such column or the row is too short to include it
+func headerValue(items []string, indexes map[string]int, name string) (string, bool) {
+	i, ok := indexes[name]
+	if !ok || i >= len(items) {
+		return "", false
+	}
+	return items[i], true
+}
+
+// KBToBytes converts a value GPFS reports in kilobytes, which are 1024 bytes, to bytes
+func KBToBytes(kb float64) float64 {
+	return kb * 1024
+}
+
+// MBToBytes converts a value GPFS reports in megabytes, which are 1024 kilobytes, to bytes
+func MBToBytes(mb float64) float64 {
+	return KBToBytes(mb * 1024)
+}
+
+// ParseFloat parses str, a value in kilobytes is converted to bytes when toBytes is true
 func ParseFloat(str string, toBytes bool, logger log.Logger) (float64, error) {
 	if val, err := strconv.ParseFloat(str, 64); err == nil {
 		if toBytes {
-			val = val * 1024
+			val = KBToBytes(val)
 		}
 		return val, nil
 	} else {
@@ -164,55 +921,890 @@ func ParseFloat(str string, toBytes bool, logger log.Logger) (float64, error) {
 	}
 }
 
-func FileExists(filename string) bool {
-	info, err := os.Stat(filename)
-	if os.IsNotExist(err) {
+// EnableCommandDump starts recording the raw output of commands run by collectors.
+func EnableCommandDump() {
+	commandDump.Lock()
+	defer commandDump.Unlock()
+	commandDump.enabled = true
+	commandDump.outputs = make(map[string]string)
+	commandDump.parsed = make(map[string]interface{})
+}
+
+// CommandOutputs returns the recorded command output keyed by command name.
+func CommandOutputs() map[string]string {
+	commandDump.Lock()
+	defer commandDump.Unlock()
+	outputs := make(map[string]string)
+	for name, out := range commandDump.outputs {
+		outputs[name] = out
+	}
+	return outputs
+}
+
+// ParsedOutputs returns the recorded parsed command output keyed by command name.
+func ParsedOutputs() map[string]interface{} {
+	commandDump.Lock()
+	defer commandDump.Unlock()
+	parsed := make(map[string]interface{})
+	for name, v := range commandDump.parsed {
+		parsed[name] = v
+	}
+	return parsed
+}
+
+func (d *CommandDump) record(name string, out string) {
+	d.Lock()
+	defer d.Unlock()
+	if !d.enabled {
+		return
+	}
+	d.outputs[name] = out
+}
+
+// recordParsed records the result parsed from the output of the named command
+func (d *CommandDump) recordParsed(name string, v interface{}) {
+	d.Lock()
+	defer d.Unlock()
+	if !d.enabled {
+		return
+	}
+	d.parsed[name] = v
+}
+
+// SetParentContext sets the context that all collector command contexts derive from.
+// Canceling it aborts any running GPFS commands.
+func SetParentContext(ctx context.Context) {
+	parent.Lock()
+	defer parent.Unlock()
+	parent.ctx = ctx
+}
+
+func parentContext() context.Context {
+	parent.Lock()
+	defer parent.Unlock()
+	return parent.ctx
+}
+
+// SetDeadline limits the commands of collectors returned by NewGPFSCollector or
+// NewProbeCollector to the deadline of the scrape, a zero deadline sets no limit.
+func SetDeadline(collector Collector, deadline time.Time) {
+	if s, ok := collector.(*sharedCollector); ok {
+		s.deadline = deadline
+	}
+}
+
+// commandContext returns the context for the commands of a collector with the timeout in
+// seconds, shortened to the deadline of the scrape running the collector when that is sooner
+func commandContext(collector string, timeout int) (context.Context, context.CancelFunc) {
+	commandDeadline := time.Now().Add(time.Duration(timeout) * time.Second)
+	if deadline, ok := scrapes.deadline(collector); ok && deadline.Before(commandDeadline) {
+		commandDeadline = deadline
+	}
+	return context.WithDeadline(parentContext(), commandDeadline)
+}
+
+// WaitCommands stops new GPFS commands from starting and waits up to timeout for running
+// commands to exit, it returns false if any are still running
+func WaitCommands(timeout time.Duration) bool {
+	commands.Lock()
+	commands.stopped = true
+	commands.Unlock()
+	done := make(chan struct{})
+	go func() {
+		commands.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
 		return false
 	}
-	return !info.IsDir()
 }
 
-func mmdiag(arg string, ctx context.Context) (string, error) {
-	cmd := execCommand(ctx, *sudoCmd, "/usr/lpp/mmfs/bin/mmdiag", arg, "-Y")
+// RunMMCommand runs a GPFS command using sudo and records command execution metrics.
+func RunMMCommand(ctx context.Context, name string, args ...string) (string, error) {
+	return runMMCommand(ctx, nil, name, args...)
+}
+
+// start adds a running command, it returns false once WaitCommands has been called
+func (t *commandTracker) start() bool {
+	t.Lock()
+	defer t.Unlock()
+	if t.stopped {
+		return false
+	}
+	t.wg.Add(1)
+	return true
+}
+
+func runMMCommand(ctx context.Context, stdin io.Reader, name string, args ...string) (string, error) {
+	if !commands.start() {
+		commandFailures.WithLabelValues(name, "error").Inc()
+		return "", errCommandsStopped
+	}
+	defer commands.wg.Done()
+	commandsInFlight.WithLabelValues(name).Inc()
+	defer commandsInFlight.WithLabelValues(name).Dec()
+	start := time.Now()
+	// The flags are read under FlagsLock as a command abandoned after a timeout can still be
+	// running when the configuration is reloaded
+	FlagsLock.RLock()
+	fixtures, grace := *fixtureDir, *killGrace
+	var argv []string
+	var err error
+	if fixtures == "" {
+		argv, err = commandArgv(name, args...)
+	}
+	FlagsLock.RUnlock()
+	if fixtures != "" {
+		out, err := readFixture(fixtures, name, args)
+		commandDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+		if err != nil {
+			commandFailures.WithLabelValues(name, "error").Inc()
+			return "", err
+		}
+		return out, nil
+	}
+	if err != nil {
+		commandFailures.WithLabelValues(name, "error").Inc()
+		return "", err
+	}
+	cmd := execCommand(ctx, argv[0], argv[1:]...)
+	killProcessGroup(cmd)
+	// Force the C locale so dates and numbers are printed the same on every node
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env, "LC_ALL=C")
+	if stdin != nil {
+		cmd.Stdin = stdin
+	}
 	var out bytes.Buffer
+	var stderr bytes.Buffer
 	cmd.Stdout = &out
-	err := cmd.Run()
-	if ctx.Err() == context.DeadlineExceeded {
+	cmd.Stderr = &stderr
+	err = runWatchdog(ctx, cmd, grace)
+	commandDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+	var killedErr *CommandKilledError
+	if errors.As(err, &killedErr) {
+		commandFailures.WithLabelValues(name, "timeout").Inc()
+		killedErr.Command = strings.Join(append([]string{name}, args...), " ")
+		return "", err
+	} else if ctx.Err() == context.DeadlineExceeded {
+		commandFailures.WithLabelValues(name, "timeout").Inc()
 		return "", ctx.Err()
 	} else if err != nil {
-		return "", err
+		commandFailures.WithLabelValues(name, "error").Inc()
+		return "", newCommandError(append([]string{name}, args...), err, stderr.String())
 	}
 	return out.String(), nil
 }
 
-func mmlfsfsFilesystems(ctx context.Context, logger log.Logger) ([]string, error) {
+// killProcessGroup runs cmd in its own process group and kills the whole group when the context
+// is done, so children that ignore SIGTERM or hold stdout open can not leave cmd.Run blocked.
+// WaitDelay closes the output pipes if the group still does not exit.
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = commandWaitDelay
+}
+
+// runWatchdog runs cmd and waits for it to exit. If cmd has not exited grace, the value of
+// --collector.kill-grace, after the context deadline, such as a command stuck in uninterruptible
+// sleep that can not be reaped, its process group is killed and the wait is abandoned so the
+// collection still returns.
+func runWatchdog(ctx context.Context, cmd *exec.Cmd, grace time.Duration) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return <-done
+	}
+	timer := time.NewTimer(time.Until(deadline) + grace)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		return &CommandKilledError{Pid: cmd.Process.Pid}
+	}
+}
+
+// CommandKilledError is returned when a GPFS command did not exit after its timeout and was
+// killed and abandoned. It is treated as a timeout.
+type CommandKilledError struct {
+	Command string
+	Pid     int
+}
+
+func (e *CommandKilledError) Error() string {
+	return fmt.Sprintf("%s (pid %d) did not exit after timeout, killed and abandoned", e.Command, e.Pid)
+}
+
+func (e *CommandKilledError) Is(target error) bool {
+	return target == context.DeadlineExceeded
+}
+
+// commandKilledTimeout counts a command abandoned by the watchdog for collector and
+// returns context.DeadlineExceeded in its place so the collection is reported as a timeout
+func commandKilledTimeout(collector string, err error) error {
+	var killedErr *CommandKilledError
+	if errors.As(err, &killedErr) {
+		commandKilled.WithLabelValues(collector).Inc()
+		return context.DeadlineExceeded
+	}
+	return err
+}
+
+// CommandError is returned when a GPFS command fails and records why it failed
+type CommandError struct {
+	Command  string
+	ExitCode int
+	Stderr   string
+	Reason   string
+	Err      error
+}
+
+// IncompleteOutputError is returned when command output is missing sections it always includes,
+// such as when the output was truncated, so zeros are not reported for values that were never seen
+type IncompleteOutputError struct {
+	Command string
+	Missing []string
+}
+
+func (e *IncompleteOutputError) Error() string {
+	return fmt.Sprintf("incomplete %s output, missing %s", e.Command, strings.Join(e.Missing, ", "))
+}
+
+// recordParseIncomplete sets gpfs_exporter_parse_incomplete for the collector from the parse error,
+// the series is removed once complete output is parsed so filesystems no longer collected do not linger
+func recordParseIncomplete(collector string, err error) {
+	var incompleteErr *IncompleteOutputError
+	if errors.As(err, &incompleteErr) {
+		parseIncomplete.WithLabelValues(collector).Set(1)
+	} else {
+		parseIncomplete.DeleteLabelValues(collector)
+	}
+}
+
+// execRetry runs exec and retries failures up to the number of retries configured for
+// collector, waiting --collector.retry-backoff between attempts. Timeouts are not retried
+// and no retry is attempted once ctx has expired.
+func execRetry(ctx context.Context, collector string, exec func() (string, error)) (string, error) {
+	attempts := *retries
+	if r, ok := collectorRetries[collector]; ok && *r >= 0 {
+		attempts = *r
+	}
+	backoff := *retryBackoff
+	for attempt := 0; ; attempt++ {
+		out, err := exec()
+		err = commandKilledTimeout(collector, err)
+		if err == nil || attempt >= attempts || errors.Is(err, context.DeadlineExceeded) || ctx.Err() != nil {
+			return out, err
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return out, err
+		case <-timer.C:
+		}
+		backoff = backoff * 2
+		commandRetries.WithLabelValues(collector).Inc()
+	}
+}
+
+func (e *CommandError) Error() string {
+	msg := fmt.Sprintf("%s failed (%s): %s", e.Command, e.Reason, e.Err)
+	if e.Stderr != "" {
+		msg = fmt.Sprintf("%s: %s", msg, e.Stderr)
+	}
+	return msg
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+func newCommandError(command []string, err error, stderr string) *CommandError {
+	e := &CommandError{Command: strings.Join(command, " "), ExitCode: -1, Err: err}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		e.ExitCode = exitErr.ExitCode()
+	}
+	// Keep only the start of stderr so logs stay readable
+	e.Stderr = strings.TrimSpace(stderr)
+	if len(e.Stderr) > 256 {
+		e.Stderr = e.Stderr[:256] + "..."
+	}
+	e.Reason = classifyCommandError(err, e.ExitCode, stderr)
+	return e
+}
+
+// classifyCommandError returns the reason a command failed from its error, exit code and stderr
+func classifyCommandError(err error, exitCode int, stderr string) string {
+	switch {
+	case errors.Is(err, exec.ErrNotFound) || errors.Is(err, os.ErrNotExist) || exitCode == 127 || notFoundPattern.MatchString(stderr):
+		return "not_found"
+	case errors.Is(err, os.ErrPermission) || exitCode == 126 || permissionPattern.MatchString(stderr):
+		return "permission"
+	case gpfsDownPattern.MatchString(stderr):
+		return "gpfs_down"
+	}
+	return "other"
+}
+
+// errorReason returns the reason reported by gpfs_exporter_collect_error_reason for a collection error
+func errorReason(err error) string {
+	var commandErr *CommandError
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var numErr *strconv.NumError
+	var timeErr *time.ParseError
+	var incompleteErr *IncompleteOutputError
+	switch {
+	case err == context.DeadlineExceeded:
+		return "timeout"
+	case errors.As(err, &commandErr):
+		return commandErr.Reason
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr), errors.As(err, &numErr), errors.As(err, &timeErr), errors.As(err, &incompleteErr):
+		return "parse"
+	}
+	return "other"
+}
+
+// fixtureName returns the name of the fixture file read in place of running a command.
+// The name is the command followed by its first argument other than -Y without leading dashes,
+// such as mmdf-project.out for "mmdf project -Y" and mmdiag-config.out for "mmdiag --config -Y".
+func fixtureName(name string, args ...string) string {
+	for _, arg := range args {
+		if arg == "-Y" {
+			continue
+		}
+		return fmt.Sprintf("%s-%s.out", name, strings.TrimLeft(arg, "-"))
+	}
+	return fmt.Sprintf("%s.out", name)
+}
+
+func readFixture(dir string, name string, args []string) (string, error) {
+	path := filepath.Join(dir, fixtureName(name, args...))
+	out, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("Fixture %s for command %s does not exist", path, strings.Join(append([]string{name}, args...), " "))
+	} else if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// commandArgv returns the arguments used to execute a GPFS command, all GPFS commands
+// are run through --sudo.command unless --sudo.disable is set.
+func commandArgv(name string, args ...string) ([]string, error) {
+	command := append([]string{GpfsCommand(name)}, args...)
+	if *sudoDisable {
+		return command, nil
+	}
+	sudo := *sudoCmd
+	if *sudoCmdLegacy != "" {
+		sudo = *sudoCmdLegacy
+	}
+	argv, err := splitShellWords(sudo)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse --sudo.command %q: %s", sudo, err)
+	}
+	if len(argv) == 0 {
+		return nil, fmt.Errorf("--sudo.command must not be empty unless --sudo.disable is set")
+	}
+	if *sudoSingleArg {
+		return append(argv, strings.Join(command, " ")), nil
+	}
+	return append(argv, command...), nil
+}
+
+// ValidateSudo returns an error if the command used to run GPFS commands is not valid
+func ValidateSudo() error {
+	_, err := commandArgv("mmlsfs")
+	return err
+}
+
+// SudoError is returned by CheckSudo when GPFS commands can not be run without a password
+type SudoError struct {
+	// Reason is password_required, not_permitted, timeout or other
+	Reason string
+	Output string
+	Err    error
+}
+
+func (e *SudoError) Error() string {
+	msg := map[string]string{
+		"password_required": "sudo requires a password",
+		"not_permitted":     "sudo does not permit running GPFS commands",
+		"timeout":           "sudo check timed out",
+	}[e.Reason]
+	if msg == "" {
+		msg = "sudo check failed"
+	}
+	if e.Output != "" {
+		return fmt.Sprintf("%s: %s", msg, e.Output)
+	}
+	return fmt.Sprintf("%s: %s", msg, e.Err)
+}
+
+func (e *SudoError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	sudoPasswordPattern     = regexp.MustCompile(`(?i)password is required|terminal is required|askpass`)
+	sudoNotPermittedPattern = regexp.MustCompile(`(?i)not allowed|may not run|not in the sudoers|not permitted`)
+)
+
+// CheckSudo checks that mmlsfs can be run through --sudo.command without a password.
+// When --sudo.command is sudo the check lists the permission with sudo -n -l, otherwise
+// mmlsfs is run. Nothing is checked when --sudo.disable or --command.fixture-dir is set.
+func CheckSudo(ctx context.Context) error {
+	FlagsLock.RLock()
+	if *sudoDisable || *fixtureDir != "" {
+		FlagsLock.RUnlock()
+		return nil
+	}
+	argv, err := commandArgv("mmlsfs", "all", "-Y", "-T")
+	singleArg := *sudoSingleArg
+	FlagsLock.RUnlock()
+	if err != nil {
+		return &SudoError{Reason: "other", Err: err}
+	}
+	if filepath.Base(argv[0]) == "sudo" && !singleArg {
+		argv = append([]string{argv[0], "-n", "-l"}, argv[1:]...)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := execCommand(ctx, argv[0], argv[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return &SudoError{Reason: "timeout", Err: ctx.Err()}
+	}
+	if err == nil {
+		return nil
+	}
+	output := strings.TrimSpace(stderr.String())
+	if output == "" {
+		output = strings.TrimSpace(stdout.String())
+	}
+	reason := "other"
+	switch {
+	case sudoPasswordPattern.MatchString(output):
+		reason = "password_required"
+	case sudoNotPermittedPattern.MatchString(output):
+		reason = "not_permitted"
+	}
+	return &SudoError{Reason: reason, Output: output, Err: err}
+}
+
+// splitShellWords splits value into words the way a POSIX shell would,
+// supporting single quotes, double quotes and backslash escapes.
+func splitShellWords(value string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+	for _, r := range value {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\\':
+			escaped = true
+			inWord = true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if escaped || quote != 0 {
+		return nil, fmt.Errorf("unterminated quote or escape")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// GpfsCommand returns the path used to run a GPFS command
+func GpfsCommand(name string) string {
+	return filepath.Join(*gpfsBinPath, name)
+}
+
+// CheckGpfsBinPath logs a warning when the GPFS command directory does not exist
+func CheckGpfsBinPath(logger log.Logger) bool {
+	if *fixtureDir != "" {
+		level.Info(logger).Log("msg", "Reading command output from fixtures instead of running GPFS commands", "path", *fixtureDir)
+		return true
+	}
+	info, err := os.Stat(*gpfsBinPath)
+	if err != nil || !info.IsDir() {
+		level.Warn(logger).Log("msg", "GPFS command directory does not exist, collectors running GPFS commands will fail",
+			"path", *gpfsBinPath)
+		return false
+	}
+	return true
+}
+
+// Verify checks that GPFS commands can be run by listing filesystems with mmlsfs
+func Verify(logger log.Logger) error {
+	if info, err := os.Stat(*gpfsBinPath); *fixtureDir == "" && (err != nil || !info.IsDir()) {
+		return fmt.Errorf("GPFS command directory %s does not exist", *gpfsBinPath)
+	}
+	ctx, cancel := context.WithTimeout(parentContext(), time.Duration(*mmlsfsTimeout)*time.Second)
+	defer cancel()
+	_, _, err := mmlfsfsFilesystems(ctx, logger)
+	return err
+}
+
+func FileExists(filename string) bool {
+	info, err := os.Stat(filename)
+	if os.IsNotExist(err) {
+		return false
+	}
+	return !info.IsDir()
+}
+
+func mmdiag(arg string, ctx context.Context) (string, error) {
+	return RunMMCommand(ctx, "mmdiag", arg, "-Y")
+}
+
+// mmlfsfsFilesystems returns the filesystems discovered with mmlsfs that are not excluded
+// and the number of filesystems that were excluded.
+func mmlfsfsFilesystems(ctx context.Context, logger log.Logger) ([]string, float64, error) {
+	discovered, err := mmlsfsCache.get(ctx, logger)
+	if err != nil {
+		return nil, 0, err
+	}
+	exclude := regexp.MustCompile(*fsExclude)
 	var filesystems []string
+	var excluded float64
+	for _, fs := range discovered {
+		if exclude.MatchString(fs) {
+			level.Debug(logger).Log("msg", "Excluding filesystem discovered with mmlsfs", "fs", fs)
+			excluded++
+			continue
+		}
+		filesystems = append(filesystems, fs)
+	}
+	return filesystems, excluded, nil
+}
+
+// get returns the cached filesystems, running mmlsfs when the cache has expired.
+// Callers waiting while mmlsfs runs share the result of that execution, including errors,
+// and a failed execution is never reused by later calls.
+func (c *MmlsfsCache) get(ctx context.Context, logger log.Logger) ([]string, error) {
+	start := time.Now()
+	c.Lock()
+	defer c.Unlock()
+	if c.updated.After(start) {
+		level.Debug(logger).Log("msg", "Using filesystems from concurrent mmlsfs execution")
+		return c.filesystems, c.err
+	}
+	if c.err == nil && !c.updated.IsZero() && time.Since(c.updated) < *mmlsfsTTL {
+		level.Debug(logger).Log("msg", "Using cached mmlsfs filesystems")
+		return c.filesystems, nil
+	}
+	c.filesystems, c.mountpoints, c.err = mmlsfsFilesystemsExec(ctx)
+	c.updated = time.Now()
+	return c.filesystems, c.err
+}
+
+// mounts returns the filesystems and their default mount points from the last successful
+// mmlsfs execution, mmlsfs is never run so nothing is returned until another collector runs it
+func (c *MmlsfsCache) mounts() []GPFSFilesystem {
+	c.Lock()
+	defer c.Unlock()
+	if c.err != nil {
+		return nil
+	}
+	return c.mountpoints
+}
+
+func mmlsfsFilesystemsExec(ctx context.Context) ([]string, []GPFSFilesystem, error) {
+	var filesystems []string
+	var mountpoints []GPFSFilesystem
 	out, err := MmlsfsExec(ctx)
 	if err != nil {
-		return nil, err
+		return nil, nil, commandKilledTimeout("mmlsfs", err)
 	}
+	commandDump.record("mmlsfs", out)
 	mmlsfs_filesystems := parse_mmlsfs(out)
+	commandDump.recordParsed("mmlsfs", mmlsfs_filesystems)
 	for _, fs := range mmlsfs_filesystems {
 		filesystems = append(filesystems, fs.Name)
+		if fs.Mountpoint != "" {
+			name, _ := splitFilesystem(fs.Name)
+			mountpoints = append(mountpoints, GPFSFilesystem{Name: name, Mountpoint: fs.Mountpoint, RemoteCluster: fs.RemoteCluster})
+		}
 	}
-	return filesystems, nil
+	return filesystems, mountpoints, nil
 }
 
-func mmlsfs(ctx context.Context) (string, error) {
-	cmd := execCommand(ctx, *sudoCmd, "/usr/lpp/mmfs/bin/mmlsfs", "all", "-Y", "-T")
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	err := cmd.Run()
-	if ctx.Err() == context.DeadlineExceeded {
-		return "", ctx.Err()
+func (t *FilesystemTracker) update(collector string, filesystems []string) (float64, float64, float64) {
+	t.Lock()
+	defer t.Unlock()
+	var changed float64
+	previous, ok := t.filesystems[collector]
+	if ok {
+		for _, fs := range filesystems {
+			if !SliceContains(previous, fs) {
+				t.added[collector]++
+				changed = 1
+			}
+		}
+		for _, fs := range previous {
+			if !SliceContains(filesystems, fs) {
+				t.removed[collector]++
+				changed = 1
+			}
+		}
+	}
+	t.filesystems[collector] = filesystems
+	return t.added[collector], t.removed[collector], changed
+}
+
+// last returns the filesystems of the previous collection, ok is false before the first collection
+func (t *FilesystemTracker) last(collector string) ([]string, bool) {
+	t.Lock()
+	defer t.Unlock()
+	filesystems, ok := t.filesystems[collector]
+	return filesystems, ok
+}
+
+func (t *LastSuccessTracker) update(collector string, success bool, now time.Time) float64 {
+	t.Lock()
+	defer t.Unlock()
+	if success {
+		t.times[collector] = float64(now.Unix())
+	}
+	return t.times[collector]
+}
+
+// collectRecover runs Collect for the named collector so a panic is reported
+// as a collection error rather than failing the whole scrape.
+func collectRecover(name string, collector Collector, ch chan<- prometheus.Metric, logger log.Logger) {
+	inflightCollections.WithLabelValues(name).Inc()
+	defer inflightCollections.WithLabelValues(name).Dec()
+	defer recoverCollectorPanic(ch, name, time.Now(), logger)
+	collector.Collect(ch)
+}
+
+// recoverCollectorPanic must be deferred, it logs a panic with its stack and reports it
+// as a collection error for collector. Collectors must send their status metrics last
+// so a recovered panic does not duplicate them.
+func recoverCollectorPanic(ch chan<- prometheus.Metric, collector string, start time.Time, logger log.Logger) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	level.Error(logger).Log("msg", "Recovered from collector panic", "collector", collector, "panic", r, "stack", string(debug.Stack()))
+	collectorPanics.WithLabelValues(collector).Inc()
+	emitCollectorStatus(ch, collector, fmt.Errorf("panic: %v", r), start, 0)
+}
+
+// recordCount returns the record count of a collector that parses a single record.
+func recordCount(parsed bool) int {
+	if parsed {
+		return 1
+	}
+	return 0
+}
+
+// emitCollectResult sends the error, timeout, error reason and success metrics for collector.
+// Collection is only successful if records is not 0, collectors where an empty result
+// is valid pass anyRecords.
+func emitCollectResult(ch chan<- prometheus.Metric, collector string, err error, records int) {
+	var timeout float64
+	var errorMetric float64
+	var success float64
+	if err == context.DeadlineExceeded {
+		timeout = 1
 	} else if err != nil {
-		return "", err
+		errorMetric = 1
+	} else if records != 0 {
+		success = 1
 	}
-	return out.String(), nil
+	ch <- prometheus.MustNewConstMetric(collectError, prometheus.GaugeValue, errorMetric, collector)
+	ch <- prometheus.MustNewConstMetric(collecTimeout, prometheus.GaugeValue, timeout, collector)
+	ch <- prometheus.MustNewConstMetric(collectSuccess, prometheus.GaugeValue, success, collector)
+	var reason string
+	if err != nil {
+		reason = errorReason(err)
+	}
+	for _, r := range errorReasons {
+		var value float64
+		if r == reason {
+			value = 1
+		}
+		ch <- prometheus.MustNewConstMetric(collectErrorReason, prometheus.GaugeValue, value, collector, r)
+	}
+}
+
+// emitCollectorStatus sends the error, timeout, success, duration and execution time metrics
+// shared by all collectors for the result of a collection that started at start and parsed records.
+func emitCollectorStatus(ch chan<- prometheus.Metric, collector string, err error, start time.Time, records int) {
+	emitCollectResult(ch, collector, err, records)
+	duration := time.Since(start).Seconds()
+	ch <- prometheus.MustNewConstMetric(collectDuration, prometheus.GaugeValue, duration, collector)
+	CollectorDurationHistogram.WithLabelValues(collector).Observe(duration)
+	if err != nil {
+		collectFailures.log(collector, err, duration, time.Now())
+	}
+	emitLastExecution(ch, collector, err == nil)
+}
+
+// emitLastExecution sends the last execution and last successful execution timestamps for collector.
+func emitLastExecution(ch chan<- prometheus.Metric, collector string, success bool) {
+	now := time.Now()
+	ch <- prometheus.MustNewConstMetric(lastExecution, prometheus.GaugeValue, float64(now.Unix()), collector)
+	ch <- prometheus.MustNewConstMetric(lastSuccess, prometheus.GaugeValue, lastSuccessCache.update(collector, success, now), collector)
+}
+
+// filesystemOverride is embedded by collectors that run per filesystem so a probe
+// can collect an explicit list of filesystems instead of the filesystems flag
+type filesystemOverride struct {
+	filesystems []string
+}
+
+func (f *filesystemOverride) setFilesystems(filesystems []string) {
+	f.filesystems = filesystems
+}
+
+// getFilesystems returns the filesystems set for a probe, otherwise the configured or discovered filesystems
+func (f *filesystemOverride) getFilesystems(configured string, collector string, ch chan<- prometheus.Metric, logger log.Logger) []string {
+	if f.filesystems != nil {
+		return f.filesystems
+	}
+	return getFilesystems(configured, collector, ch, logger)
+}
+
+// NewProbeCollector returns the named collector for a single probe, limited to the given filesystems
+// when any are given. The collector does not need to be enabled by flags. An error is returned for an
+// unknown collector, a collector that does not run per filesystem or a filesystem not found by mmlsfs.
+func NewProbeCollector(name string, filesystems []string, logger log.Logger) (Collector, error) {
+	factory, ok := factories[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown collector %s", name)
+	}
+	collectorLogger := log.With(logger, "collector", name)
+	collector := factory(collectorLogger)
+	key := name
+	if len(filesystems) > 0 {
+		override, ok := collector.(interface{ setFilesystems([]string) })
+		if !ok {
+			return nil, fmt.Errorf("collector %s does not collect per filesystem", name)
+		}
+		ctx, cancel := context.WithTimeout(parentContext(), time.Duration(*mmlsfsTimeout)*time.Second)
+		defer cancel()
+		existing, err := mmlsfsCache.get(ctx, logger)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list filesystems with mmlsfs: %w", err)
+		}
+		for _, fs := range filesystems {
+			if !SliceContains(existing, fs) {
+				return nil, fmt.Errorf("filesystem %s not found by mmlsfs", fs)
+			}
+		}
+		override.setFilesystems(filesystems)
+		key = fmt.Sprintf("%s-%s", name, strings.Join(filesystems, ","))
+	}
+	return &sharedCollector{name: key, collector: collector, logger: collectorLogger, factory: name}, nil
+}
+
+// getFilesystems returns the configured filesystems or those discovered with mmlsfs
+// and reports changes to that set since the previous collection. When mmlsfs fails
+// the previous filesystems are returned with --collector.keep-last-on-discovery-failure.
+func getFilesystems(configured string, collector string, ch chan<- prometheus.Metric, logger log.Logger) []string {
+	var filesystems []string
+	if configured == "" {
+		ctx, cancel := commandContext(collector, *mmlsfsTimeout)
+		defer cancel()
+		mmlfsfs_filesystems, excluded, err := mmlfsfsFilesystems(ctx, logger)
+		if err == context.DeadlineExceeded {
+			level.Error(logger).Log("msg", "Timeout executing mmlsfs")
+		} else if err != nil {
+			level.Error(logger).Log("msg", err)
+		}
+		emitCollectResult(ch, fmt.Sprintf("%s-mmlsfs", collector), err, len(mmlfsfs_filesystems))
+		if err != nil {
+			if !*keepLastOnDiscoveryFailure {
+				return nil
+			}
+			last, ok := filesystemsCache.last(collector)
+			if !ok {
+				return nil
+			}
+			level.Warn(logger).Log("msg", "Unable to discover filesystems, collecting the filesystems of the last successful discovery", "filesystems", strings.Join(last, ","))
+			filesystems = last
+		} else {
+			ch <- prometheus.MustNewConstMetric(filesystemsExcluded, prometheus.GaugeValue, excluded, collector)
+			filesystems = mmlfsfs_filesystems
+		}
+	} else {
+		filesystems = SplitList(configured)
+	}
+	added, removed, changed := filesystemsCache.update(collector, filesystems)
+	ch <- prometheus.MustNewConstMetric(filesystemsAdded, prometheus.CounterValue, added, collector)
+	ch <- prometheus.MustNewConstMetric(filesystemsRemoved, prometheus.CounterValue, removed, collector)
+	ch <- prometheus.MustNewConstMetric(filesystemsChanged, prometheus.GaugeValue, changed, collector)
+	return filesystems
+}
+
+// splitFilesystem returns the filesystem name and owning cluster of a device,
+// filesystems mounted from a remote cluster can be listed as owningcluster:fsname.
+// The owning cluster is empty for local filesystems.
+func splitFilesystem(device string) (string, string) {
+	if cluster, fs, ok := strings.Cut(device, ":"); ok {
+		return fs, cluster
+	}
+	return device, ""
+}
+
+func mmlsfs(ctx context.Context) (string, error) {
+	return RunMMCommand(ctx, "mmlsfs", "all", "-Y", "-T")
 }
 
 func parse_mmlsfs(out string) []GPFSFilesystem {
 	var filesystems []GPFSFilesystem
+	// Column positions of mmlsfs -Y output are used until a HEADER line is seen
+	indexes := map[string]int{"deviceName": 6, "fieldName": 7, "data": 8}
 	lines := strings.Split(out, "\n")
 	for _, line := range lines {
 		items := strings.Split(line, ":")
@@ -220,15 +1812,18 @@ func parse_mmlsfs(out string) []GPFSFilesystem {
 			continue
 		}
 		if items[2] == "HEADER" {
+			indexes = HeaderIndexMap(items)
 			continue
 		}
-		var fs GPFSFilesystem
-		fs.Name = items[6]
-		mountpoint, err := url.QueryUnescape(items[8])
-		if err != nil {
+		name, ok := headerValue(items, indexes, "deviceName")
+		if !ok {
 			continue
 		}
-		fs.Mountpoint = mountpoint
+		var fs GPFSFilesystem
+		fs.Name = DecodeGPFSString(name)
+		mountpoint, _ := headerValue(items, indexes, "data")
+		fs.Mountpoint = DecodeGPFSString(mountpoint)
+		_, fs.RemoteCluster = splitFilesystem(fs.Name)
 		filesystems = append(filesystems, fs)
 	}
 	return filesystems
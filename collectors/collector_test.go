@@ -15,20 +15,32 @@ package collectors
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 
 	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
 )
 
 var (
 	mockedExitStatus = 0
 	mockedStdout     string
+	mockedStderr     string
 	_, cancel        = context.WithTimeout(context.Background(), 5*time.Second)
 	mmlsfsStdout     = `
 fs::HEADER:version:reserved:reserved:deviceName:fieldName:data:remarks:
@@ -42,10 +54,79 @@ func TestMain(m *testing.M) {
 	NowLocation = func() *time.Location {
 		return time.FixedZone("EST", -5*60*60)
 	}
+	// Tests replace MmlsfsExec so discovered filesystems must not be cached between them
+	mmlsfsNoCache := time.Duration(0)
+	mmlsfsTTL = &mmlsfsNoCache
 	exitVal := m.Run()
 	os.Exit(exitVal)
 }
 
+func TestCollectorEnabledFlags(t *testing.T) {
+	defer func() {
+		if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	tests := []struct {
+		args     []string
+		expected []string
+	}{
+		{args: []string{}, expected: []string{"config", "mmgetstate", "mmlsmgr", "mmpmon", "mount"}},
+		{args: []string{"--collector.mmdf", "--no-collector.mount"}, expected: []string{"config", "mmdf", "mmgetstate", "mmlsmgr", "mmpmon"}},
+		{args: []string{"--collector.disable-defaults"}, expected: nil},
+		{args: []string{"--collector.disable-defaults", "--collector.mmdf", "--collector.mount"}, expected: []string{"mmdf", "mount"}},
+		{args: []string{"--collector.disable-defaults", "--collector.mmdf", "--no-collector.mount"}, expected: []string{"mmdf"}},
+	}
+	for _, test := range tests {
+		if _, err := kingpin.CommandLine.Parse(test.args); err != nil {
+			t.Fatal(err)
+		}
+		var enabled []string
+		for name := range NewGPFSCollector(log.NewNopLogger()).Collectors {
+			enabled = append(enabled, name)
+		}
+		sort.Strings(enabled)
+		if !reflect.DeepEqual(enabled, test.expected) {
+			t.Errorf("Unexpected collectors for %v\nGot: %v\nExpected: %v", test.args, enabled, test.expected)
+		}
+		for name := range collectorState {
+			if CollectorEnabled(name) != SliceContains(test.expected, name) {
+				t.Errorf("Unexpected CollectorEnabled for %s with %v", name, test.args)
+			}
+		}
+	}
+
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.disable-defaults", "--collector.mmdf"}); err != nil {
+		t.Fatal(err)
+	}
+	expected := `
+		# HELP gpfs_exporter_collector_enabled Indicates the collector is enabled by flags
+		# TYPE gpfs_exporter_collector_enabled gauge
+		gpfs_exporter_collector_enabled{collector="mmdf"} 1
+		gpfs_exporter_collector_enabled{collector="mmgetstate"} 0
+	`
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(EnabledCollectorsMetrics)
+	if val := testutil.CollectAndCount(EnabledCollectorsMetrics); val != len(collectorState) {
+		t.Errorf("Unexpected collector enabled count %d, expected %d", val, len(collectorState))
+	}
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var filtered []*dto.Metric
+	for _, m := range mfs[0].GetMetric() {
+		if name := m.GetLabel()[0].GetValue(); name == "mmdf" || name == "mmgetstate" {
+			filtered = append(filtered, m)
+		}
+	}
+	mfs[0].Metric = filtered
+	if err := testutil.GatherAndCompare(prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) { return mfs, nil }),
+		strings.NewReader(expected)); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
 func TestArgs(t *testing.T) {
 	if _, err := kingpin.CommandLine.Parse([]string{"--collector.waiter.buckets=foo"}); err == nil {
 		t.Errorf("Expected error, none given")
@@ -60,6 +141,7 @@ func fakeExecCommand(ctx context.Context, command string, args ...string) *exec.
 	es := strconv.Itoa(mockedExitStatus)
 	cmd.Env = []string{"GO_WANT_HELPER_PROCESS=1",
 		"STDOUT=" + mockedStdout,
+		"STDERR=" + mockedStderr,
 		"EXIT_STATUS=" + es}
 	return cmd
 }
@@ -71,6 +153,7 @@ func TestExecCommandHelper(t *testing.T) {
 
 	//nolint:staticcheck
 	fmt.Fprintf(os.Stdout, os.Getenv("STDOUT"))
+	fmt.Fprint(os.Stderr, os.Getenv("STDERR"))
 	i, _ := strconv.Atoi(os.Getenv("EXIT_STATUS"))
 	os.Exit(i)
 }
@@ -130,6 +213,556 @@ func TestMmdiagTimeout(t *testing.T) {
 	}
 }
 
+func TestGpfsBinPath(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--gpfs.bin-path=/opt/gpfs/bin"}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { execCommand = exec.CommandContext }()
+	var command []string
+	execCommand = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+		command = append([]string{name}, args...)
+		return fakeExecCommand(ctx, name, args...)
+	}
+	mockedExitStatus = 0
+	mockedStdout = "foo"
+	if _, err := mmgetstate(context.Background()); err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+	if len(command) < 2 || command[1] != "/opt/gpfs/bin/mmgetstate" {
+		t.Errorf("Unexpected command: %v", command)
+	}
+	if val := GpfsCommand("mmlsfs"); val != "/opt/gpfs/bin/mmlsfs" {
+		t.Errorf("Unexpected command path: %s", val)
+	}
+	if CheckGpfsBinPath(log.NewNopLogger()) {
+		t.Errorf("Expected missing GPFS command directory")
+	}
+	if _, err := kingpin.CommandLine.Parse([]string{"--gpfs.bin-path=" + t.TempDir()}); err != nil {
+		t.Fatal(err)
+	}
+	if !CheckGpfsBinPath(log.NewNopLogger()) {
+		t.Errorf("Expected existing GPFS command directory")
+	}
+}
+
+func TestSudoCommand(t *testing.T) {
+	var command []string
+	execCommand = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+		command = append([]string{name}, args...)
+		return fakeExecCommand(ctx, name, args...)
+	}
+	defer func() { execCommand = exec.CommandContext }()
+	mockedExitStatus = 0
+	mockedStdout = "foo"
+	tests := []struct {
+		flags      []string
+		mmgetstate []string
+		mmdf       []string
+	}{
+		{
+			flags:      []string{},
+			mmgetstate: []string{"sudo", "/usr/lpp/mmfs/bin/mmgetstate", "-Y"},
+			mmdf:       []string{"sudo", "/usr/lpp/mmfs/bin/mmdf", "project", "-Y"},
+		},
+		{
+			flags:      []string{"--sudo.command=sudo -n -u 'gpfs admin'"},
+			mmgetstate: []string{"sudo", "-n", "-u", "gpfs admin", "/usr/lpp/mmfs/bin/mmgetstate", "-Y"},
+			mmdf:       []string{"sudo", "-n", "-u", "gpfs admin", "/usr/lpp/mmfs/bin/mmdf", "project", "-Y"},
+		},
+		{
+			flags:      []string{"--config.sudo.command=doas"},
+			mmgetstate: []string{"doas", "/usr/lpp/mmfs/bin/mmgetstate", "-Y"},
+			mmdf:       []string{"doas", "/usr/lpp/mmfs/bin/mmdf", "project", "-Y"},
+		},
+		{
+			flags:      []string{"--sudo.command=/usr/local/bin/gpfs-wrapper", "--sudo.single-argument"},
+			mmgetstate: []string{"/usr/local/bin/gpfs-wrapper", "/usr/lpp/mmfs/bin/mmgetstate -Y"},
+			mmdf:       []string{"/usr/local/bin/gpfs-wrapper", "/usr/lpp/mmfs/bin/mmdf project -Y"},
+		},
+		{
+			flags:      []string{"--sudo.disable"},
+			mmgetstate: []string{"/usr/lpp/mmfs/bin/mmgetstate", "-Y"},
+			mmdf:       []string{"/usr/lpp/mmfs/bin/mmdf", "project", "-Y"},
+		},
+	}
+	for _, test := range tests {
+		if _, err := kingpin.CommandLine.Parse(test.flags); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := mmgetstate(context.Background()); err != nil {
+			t.Errorf("Unexpected error: %s", err.Error())
+		}
+		if !reflect.DeepEqual(command, test.mmgetstate) {
+			t.Errorf("Unexpected mmgetstate command with %v\nGot: %q\nExpected: %q", test.flags, command, test.mmgetstate)
+		}
+		if _, err := mmdf("project", context.Background()); err != nil {
+			t.Errorf("Unexpected error: %s", err.Error())
+		}
+		if !reflect.DeepEqual(command, test.mmdf) {
+			t.Errorf("Unexpected mmdf command with %v\nGot: %q\nExpected: %q", test.flags, command, test.mmdf)
+		}
+	}
+}
+
+func TestValidateSudo(t *testing.T) {
+	tests := map[string]bool{
+		"sudo -n":                true,
+		"sudo -u \"gpfs admin\"": true,
+		"sudo -u 'gpfs":          false,
+		"":                       false,
+	}
+	for value, valid := range tests {
+		if _, err := kingpin.CommandLine.Parse([]string{"--sudo.command=" + value}); err != nil {
+			t.Fatal(err)
+		}
+		if err := ValidateSudo(); valid && err != nil {
+			t.Errorf("Unexpected error for %q: %s", value, err.Error())
+		} else if !valid && err == nil {
+			t.Errorf("Expected error for %q", value)
+		}
+	}
+	if _, err := kingpin.CommandLine.Parse([]string{"--sudo.command=", "--sudo.disable"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateSudo(); err != nil {
+		t.Errorf("Unexpected error with --sudo.disable: %s", err.Error())
+	}
+}
+
+func TestSplitShellWords(t *testing.T) {
+	tests := map[string][]string{
+		"sudo":                      {"sudo"},
+		"  sudo   -n  ":             {"sudo", "-n"},
+		"sudo -u 'gpfs admin'":      {"sudo", "-u", "gpfs admin"},
+		`sudo -u "gpfs admin" -- x`: {"sudo", "-u", "gpfs admin", "--", "x"},
+		`wrap\ per 'a'"b"`:          {"wrap per", "ab"},
+		"":                          nil,
+	}
+	for value, expected := range tests {
+		if val, err := splitShellWords(value); err != nil {
+			t.Errorf("Unexpected error for %q: %s", value, err.Error())
+		} else if !reflect.DeepEqual(val, expected) {
+			t.Errorf("Unexpected split of %q, got %q expected %q", value, val, expected)
+		}
+	}
+	if _, err := splitShellWords(`sudo "unterminated`); err == nil {
+		t.Errorf("Expected error for unterminated quote")
+	}
+}
+
+func TestCommandErrorReason(t *testing.T) {
+	execCommand = fakeExecCommand
+	defer func() {
+		execCommand = exec.CommandContext
+		mockedStderr = ""
+	}()
+	mockedStdout = ""
+	tests := []struct {
+		exitStatus int
+		stderr     string
+		reason     string
+	}{
+		{exitStatus: 1, stderr: "sudo: /usr/lpp/mmfs/bin/mmgetstate: command not found", reason: "not_found"},
+		{exitStatus: 127, stderr: "", reason: "not_found"},
+		{exitStatus: 1, stderr: "sudo: a password is required", reason: "permission"},
+		{exitStatus: 1, stderr: "Sorry, user gpfs_exporter is not allowed to execute '/usr/lpp/mmfs/bin/mmgetstate -Y' as root", reason: "permission"},
+		{exitStatus: 1, stderr: "mmgetstate: 6027-1242 GPFS is not running", reason: "gpfs_down"},
+		{exitStatus: 2, stderr: "unexpected failure", reason: "other"},
+	}
+	for _, test := range tests {
+		mockedExitStatus = test.exitStatus
+		mockedStderr = test.stderr
+		_, err := mmgetstate(context.Background())
+		var commandErr *CommandError
+		if !errors.As(err, &commandErr) {
+			t.Errorf("Expected CommandError for %q, got %v", test.stderr, err)
+			continue
+		}
+		if commandErr.Reason != test.reason {
+			t.Errorf("Unexpected reason for %q, got %s expected %s", test.stderr, commandErr.Reason, test.reason)
+		}
+		if commandErr.ExitCode != test.exitStatus {
+			t.Errorf("Unexpected exit code %d, expected %d", commandErr.ExitCode, test.exitStatus)
+		}
+		if commandErr.Stderr != test.stderr || !strings.Contains(err.Error(), test.stderr) {
+			t.Errorf("Unexpected stderr in error: %s", err.Error())
+		}
+		if val := errorReason(err); val != test.reason {
+			t.Errorf("Unexpected error reason %s, expected %s", val, test.reason)
+		}
+	}
+	if val := errorReason(context.DeadlineExceeded); val != "timeout" {
+		t.Errorf("Unexpected error reason for timeout %s", val)
+	}
+	if _, err := strconv.ParseFloat("foo", 64); errorReason(err) != "parse" {
+		t.Errorf("Unexpected error reason for parse error %s", errorReason(err))
+	}
+	if val := errorReason(fmt.Errorf("Error")); val != "other" {
+		t.Errorf("Unexpected error reason for other error %s", val)
+	}
+}
+
+func TestCheckSudo(t *testing.T) {
+	var argv []string
+	execCommand = func(ctx context.Context, command string, args ...string) *exec.Cmd {
+		argv = append([]string{command}, args...)
+		return fakeExecCommand(ctx, command, args...)
+	}
+	defer func() {
+		execCommand = exec.CommandContext
+		mockedStderr = ""
+	}()
+	mockedStdout = ""
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		exitStatus int
+		stderr     string
+		reason     string
+	}{
+		{exitStatus: 0, stderr: "", reason: ""},
+		{exitStatus: 1, stderr: "sudo: a password is required", reason: "password_required"},
+		{exitStatus: 1, stderr: "", reason: "other"},
+		{exitStatus: 1, stderr: "Sorry, user gpfs_exporter is not allowed to execute '/usr/lpp/mmfs/bin/mmlsfs all -Y -T' as root", reason: "not_permitted"},
+	}
+	for _, test := range tests {
+		mockedExitStatus = test.exitStatus
+		mockedStderr = test.stderr
+		err := CheckSudo(context.Background())
+		expectedArgv := []string{"sudo", "-n", "-l", "/usr/lpp/mmfs/bin/mmlsfs", "all", "-Y", "-T"}
+		if !reflect.DeepEqual(argv, expectedArgv) {
+			t.Errorf("Unexpected command\nExpected: %v\nGot: %v", expectedArgv, argv)
+		}
+		if test.reason == "" {
+			if err != nil {
+				t.Errorf("Unexpected error: %s", err.Error())
+			}
+			continue
+		}
+		var sudoErr *SudoError
+		if !errors.As(err, &sudoErr) {
+			t.Errorf("Expected SudoError for %q, got %v", test.stderr, err)
+			continue
+		}
+		if sudoErr.Reason != test.reason {
+			t.Errorf("Unexpected reason for %q, got %s expected %s", test.stderr, sudoErr.Reason, test.reason)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 0*time.Second)
+	defer cancel()
+	var sudoErr *SudoError
+	if err := CheckSudo(ctx); !errors.As(err, &sudoErr) || sudoErr.Reason != "timeout" {
+		t.Errorf("Expected timeout, got %v", err)
+	}
+	if _, err := kingpin.CommandLine.Parse([]string{"--sudo.command=/usr/local/bin/gpfs-wrapper"}); err != nil {
+		t.Fatal(err)
+	}
+	mockedExitStatus = 0
+	if err := CheckSudo(context.Background()); err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+	if expectedArgv := []string{"/usr/local/bin/gpfs-wrapper", "/usr/lpp/mmfs/bin/mmlsfs", "all", "-Y", "-T"}; !reflect.DeepEqual(argv, expectedArgv) {
+		t.Errorf("Unexpected command\nExpected: %v\nGot: %v", expectedArgv, argv)
+	}
+	if _, err := kingpin.CommandLine.Parse([]string{"--sudo.disable"}); err != nil {
+		t.Fatal(err)
+	}
+	argv = nil
+	if err := CheckSudo(context.Background()); err != nil || argv != nil {
+		t.Errorf("Expected no check with --sudo.disable, got %v %v", err, argv)
+	}
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectErrorReason(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	execCommand = fakeExecCommand
+	MmgetstateExec = mmgetstate
+	defer func() {
+		execCommand = exec.CommandContext
+		mockedStderr = ""
+	}()
+	mockedExitStatus = 1
+	mockedStdout = ""
+	mockedStderr = "mmgetstate: 6027-1242 GPFS is not running"
+	expected := `
+		# HELP gpfs_exporter_collect_error Indicates if error has occurred during collection
+		# TYPE gpfs_exporter_collect_error gauge
+		gpfs_exporter_collect_error{collector="mmgetstate"} 1
+		# HELP gpfs_exporter_collect_error_reason Indicates the reason for a collection error or timeout
+		# TYPE gpfs_exporter_collect_error_reason gauge
+		gpfs_exporter_collect_error_reason{collector="mmgetstate",reason="gpfs_down"} 1
+		gpfs_exporter_collect_error_reason{collector="mmgetstate",reason="not_found"} 0
+		gpfs_exporter_collect_error_reason{collector="mmgetstate",reason="other"} 0
+		gpfs_exporter_collect_error_reason{collector="mmgetstate",reason="parse"} 0
+		gpfs_exporter_collect_error_reason{collector="mmgetstate",reason="permission"} 0
+		gpfs_exporter_collect_error_reason{collector="mmgetstate",reason="timeout"} 0
+	`
+	collector := NewMmgetstateCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
+		"gpfs_exporter_collect_error", "gpfs_exporter_collect_error_reason"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestExecRetry(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.retries=2", "--collector.retry-backoff=1ms", "--collector.mmdf.retries=0"}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		*retries = 0
+		*retryBackoff = time.Second
+		*collectorRetries["mmdf"] = -1
+	}()
+	defer commandRetries.Reset()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	attempts := 0
+	_, err := execRetry(ctx, "waiter", func() (string, error) {
+		attempts++
+		return "", fmt.Errorf("GPFS is busy")
+	})
+	if err == nil {
+		t.Errorf("Expected error")
+	}
+	if attempts != 3 {
+		t.Errorf("Unexpected number of attempts %d, expected 3", attempts)
+	}
+	attempts = 0
+	_, err = execRetry(ctx, "waiter", func() (string, error) {
+		attempts++
+		return "", context.DeadlineExceeded
+	})
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected DeadlineExceeded, got %v", err)
+	}
+	if attempts != 1 {
+		t.Errorf("Timeout should not be retried, got %d attempts", attempts)
+	}
+	attempts = 0
+	_, _ = execRetry(ctx, "mmdf", func() (string, error) {
+		attempts++
+		return "", fmt.Errorf("GPFS is busy")
+	})
+	if attempts != 1 {
+		t.Errorf("Per collector retries should override global, got %d attempts", attempts)
+	}
+	expiredCtx, expiredCancel := context.WithCancel(context.Background())
+	expiredCancel()
+	attempts = 0
+	_, _ = execRetry(expiredCtx, "waiter", func() (string, error) {
+		attempts++
+		return "", fmt.Errorf("GPFS is busy")
+	})
+	if attempts != 1 {
+		t.Errorf("Expired context should not be retried, got %d attempts", attempts)
+	}
+	if val := testutil.ToFloat64(commandRetries.WithLabelValues("waiter")); val != 2 {
+		t.Errorf("Unexpected command retries %v, expected 2", val)
+	}
+}
+
+func TestFixtureDir(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := kingpin.CommandLine.Parse([]string{"--command.fixture-dir=" + dir}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_, _ = kingpin.CommandLine.Parse([]string{})
+	}()
+	tests := map[string][]string{
+		"mmdf-project.out":    {"mmdf", "project", "-Y"},
+		"mmdiag-config.out":   {"mmdiag", "--config", "-Y"},
+		"mmgetstate.out":      {"mmgetstate", "-Y"},
+		"mmrepquota-j.out":    {"mmrepquota", "-j", "-Y", "-a"},
+		"mmhealth-node.out":   {"mmhealth", "node", "show", "-Y"},
+		"mmlsfs-all.out":      {"mmlsfs", "all", "-Y", "-T"},
+		"mmgetstate-a.out":    {"mmgetstate", "-a", "-Y", "-s"},
+		"mmfsadm-test.out":    {"mmfsadm", "test", "verbs", "status"},
+		"mmlscluster.out":     {"mmlscluster", "-Y"},
+		"mmafmctl-ess.out":    {"mmafmctl", "ess", "getstate", "-Y"},
+		"mmlsqos-scratch.out": {"mmlsqos", "scratch", "-Y", "--seconds", "60"},
+	}
+	for expected, command := range tests {
+		if val := fixtureName(command[0], command[1:]...); val != expected {
+			t.Errorf("Unexpected fixture name %s, expected %s", val, expected)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "mmdf-project.out"), []byte("foo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { execCommand = exec.CommandContext }()
+	execCommand = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+		t.Errorf("Unexpected command execution: %s %v", name, args)
+		return fakeExecCommand(ctx, name, args...)
+	}
+	out, err := RunMMCommand(context.Background(), "mmdf", "project", "-Y")
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+	if out != "foo" {
+		t.Errorf("Unexpected out: %s", out)
+	}
+	_, err = RunMMCommand(context.Background(), "mmdf", "scratch", "-Y")
+	if err == nil {
+		t.Errorf("Expected error")
+	} else if !strings.Contains(err.Error(), "mmdf-scratch.out") {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+	if err := Verify(log.NewNopLogger()); err == nil || !strings.Contains(err.Error(), "mmlsfs-all.out") {
+		t.Errorf("Unexpected verify error: %v", err)
+	}
+}
+
+func TestRunMMCommandMetrics(t *testing.T) {
+	execCommand = fakeExecCommand
+	mockedStdout = "foo"
+	defer func() { execCommand = exec.CommandContext }()
+	commandDuration.Reset()
+	commandFailures.Reset()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	mockedExitStatus = 0
+	if _, err := RunMMCommand(ctx, "mmdiag", "--waiters", "-Y"); err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+	mockedExitStatus = 1
+	if _, err := RunMMCommand(ctx, "mmdiag", "--waiters", "-Y"); err == nil {
+		t.Errorf("Expected error")
+	}
+	timeoutCtx, timeoutCancel := context.WithTimeout(context.Background(), 0*time.Second)
+	defer timeoutCancel()
+	if _, err := RunMMCommand(timeoutCtx, "mmdiag", "--waiters", "-Y"); err != context.DeadlineExceeded {
+		t.Errorf("Expected DeadlineExceeded")
+	}
+	if val := testutil.CollectAndCount(commandDuration); val != 1 {
+		t.Errorf("Unexpected command duration count %d", val)
+	}
+	if val := testutil.ToFloat64(commandFailures.WithLabelValues("mmdiag", "error")); val != 1 {
+		t.Errorf("Unexpected error failures %v", val)
+	}
+	if val := testutil.ToFloat64(commandFailures.WithLabelValues("mmdiag", "timeout")); val != 1 {
+		t.Errorf("Unexpected timeout failures %v", val)
+	}
+	if val := testutil.ToFloat64(commandsInFlight.WithLabelValues("mmdiag")); val != 0 {
+		t.Errorf("Unexpected commands in flight %v", val)
+	}
+}
+
+func TestCollectorTimeoutKillsCommand(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.mmdf.timeout=1"}); err != nil {
+		t.Fatal(err)
+	}
+	filesystems := "project"
+	prevFilesystems := configFilesystems
+	configFilesystems = &filesystems
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	var cmd *exec.Cmd
+	execCommand = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+		script := fmt.Sprintf("trap '' TERM; sleep 60 & echo $! > %s; wait", pidFile)
+		cmd = exec.CommandContext(ctx, "sh", "-c", script)
+		return cmd
+	}
+	defer func() {
+		execCommand = exec.CommandContext
+		configFilesystems = prevFilesystems
+		MmdfExec = func(fs string, ctx context.Context) (string, error) {
+			return mmdfStdout, nil
+		}
+	}()
+	MmdfExec = mmdf
+	collector := &sharedCollector{name: "mmdf", collector: NewMmdfCollector(log.NewNopLogger()), logger: log.NewNopLogger()}
+	gatherers := setupGatherer(collector)
+	start := time.Now()
+	if _, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("Collector returned after %s, expected within timeout", elapsed)
+	}
+	if cmd == nil || cmd.ProcessState == nil {
+		t.Fatalf("Expected command to be reaped")
+	}
+	pid, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// SIGKILL delivery to the reparented child is asynchronous, give it a moment to exit
+	var stat []byte
+	for i := 0; i < 50; i++ {
+		stat, err = os.ReadFile(filepath.Join("/proc", strings.TrimSpace(string(pid)), "stat"))
+		if err != nil || strings.Contains(string(stat), ") Z ") {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err == nil && !strings.Contains(string(stat), ") Z ") {
+		t.Errorf("Expected child process %s to be killed, got %s", strings.TrimSpace(string(pid)), string(stat))
+	}
+	if val := testutil.ToFloat64(inflightCollections.WithLabelValues("mmdf")); val != 0 {
+		t.Errorf("Unexpected inflight collections %v", val)
+	}
+}
+
+func TestCollectorWatchdogAbandonsCommand(t *testing.T) {
+	setsid, err := exec.LookPath("setsid")
+	if err != nil {
+		t.Skip("setsid not found")
+	}
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.mmdf.timeout=1", "--collector.kill-grace=100ms"}); err != nil {
+		t.Fatal(err)
+	}
+	filesystems := "project"
+	prevFilesystems := configFilesystems
+	configFilesystems = &filesystems
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	// The child leaves its own session holding stdout open so killing the process group
+	// can not end the command and only the watchdog can return the collection
+	execCommand = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+		script := fmt.Sprintf("trap '' TERM; %s sleep 60 & echo $! > %s; wait", setsid, pidFile)
+		return exec.CommandContext(ctx, "sh", "-c", script)
+	}
+	commandWaitDelay = time.Minute
+	defer func() {
+		execCommand = exec.CommandContext
+		commandWaitDelay = 5 * time.Second
+		configFilesystems = prevFilesystems
+		MmdfExec = func(fs string, ctx context.Context) (string, error) {
+			return mmdfStdout, nil
+		}
+		if pid, err := os.ReadFile(pidFile); err == nil {
+			if p, err := strconv.Atoi(strings.TrimSpace(string(pid))); err == nil {
+				_ = syscall.Kill(p, syscall.SIGKILL)
+			}
+		}
+	}()
+	MmdfExec = mmdf
+	commandKilled.Reset()
+	expected := `
+		# HELP gpfs_exporter_collect_timeout Indicates the collector timed out
+		# TYPE gpfs_exporter_collect_timeout gauge
+		gpfs_exporter_collect_timeout{collector="mmdf-project"} 1
+	`
+	collector := NewMmdfCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	start := time.Now()
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collect_timeout"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Collector returned after %s, expected shortly after timeout and grace", elapsed)
+	}
+	if val := testutil.ToFloat64(commandKilled.WithLabelValues("mmdf")); val != 1 {
+		t.Errorf("Unexpected command killed count %v", val)
+	}
+}
+
 func TestMmlsfs(t *testing.T) {
 	execCommand = fakeExecCommand
 	mockedExitStatus = 0
@@ -194,3 +827,957 @@ func TestParseMmlsfs(t *testing.T) {
 		t.Errorf("Unexpected Mounpoint, got %v", val)
 	}
 }
+
+func TestParseMmlsfsRemote(t *testing.T) {
+	out := `
+fs::HEADER:version:reserved:reserved:deviceName:fieldName:data:remarks:
+mmlsfs::0:1:::project:defaultMountPoint:%2Ffs%2Fproject::
+mmlsfs::0:1:::ess01%3Ascratch:defaultMountPoint:%2Ffs%2Fscratch::
+`
+	filesystems := parse_mmlsfs(out)
+	if len(filesystems) != 2 {
+		t.Fatalf("Expected 2 filesystems returned, got %d", len(filesystems))
+	}
+	if val := filesystems[0].RemoteCluster; val != "" {
+		t.Errorf("Unexpected RemoteCluster for local filesystem, got %v", val)
+	}
+	if val := filesystems[1].Name; val != "ess01:scratch" {
+		t.Errorf("Unexpected Name, got %v", val)
+	}
+	if val := filesystems[1].RemoteCluster; val != "ess01" {
+		t.Errorf("Unexpected RemoteCluster, got %v", val)
+	}
+}
+
+func TestSplitFilesystem(t *testing.T) {
+	tests := []struct {
+		device  string
+		fs      string
+		cluster string
+	}{
+		{device: "project", fs: "project", cluster: ""},
+		{device: "ess01:project", fs: "project", cluster: "ess01"},
+		{device: "ess01.example.com:scratch", fs: "scratch", cluster: "ess01.example.com"},
+	}
+	for _, test := range tests {
+		fs, cluster := splitFilesystem(test.device)
+		if fs != test.fs || cluster != test.cluster {
+			t.Errorf("Unexpected split of %s, got %s %s", test.device, fs, cluster)
+		}
+	}
+}
+
+func TestFilesystemsChanged(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	defer func(mmdf *string) { configFilesystems = mmdf }(configFilesystems)
+	filesystems := ""
+	configFilesystems = &filesystems
+	filesystemsCache = &FilesystemTracker{
+		filesystems: make(map[string][]string),
+		added:       make(map[string]float64),
+		removed:     make(map[string]float64),
+	}
+	MmdfExec = func(fs string, ctx context.Context) (string, error) {
+		return "", nil
+	}
+	fixtures := []string{mmlsfsStdout, `
+fs::HEADER:version:reserved:reserved:deviceName:fieldName:data:remarks:
+mmlsfs::0:1:::project:defaultMountPoint:%2Ffs%2Fproject::
+mmlsfs::0:1:::home:defaultMountPoint:%2Ffs%2Fhome::
+`, mmlsfsStdout, mmlsfsStdout}
+	expected := []string{`
+		# HELP gpfs_exporter_filesystems_added_total Number of filesystems added to the collected set since exporter start
+		# TYPE gpfs_exporter_filesystems_added_total counter
+		gpfs_exporter_filesystems_added_total{collector="mmdf"} 0
+		# HELP gpfs_exporter_filesystems_changed Indicates the collected set of filesystems changed since the previous collection
+		# TYPE gpfs_exporter_filesystems_changed gauge
+		gpfs_exporter_filesystems_changed{collector="mmdf"} 0
+		# HELP gpfs_exporter_filesystems_removed_total Number of filesystems removed from the collected set since exporter start
+		# TYPE gpfs_exporter_filesystems_removed_total counter
+		gpfs_exporter_filesystems_removed_total{collector="mmdf"} 0
+	`, `
+		# HELP gpfs_exporter_filesystems_added_total Number of filesystems added to the collected set since exporter start
+		# TYPE gpfs_exporter_filesystems_added_total counter
+		gpfs_exporter_filesystems_added_total{collector="mmdf"} 1
+		# HELP gpfs_exporter_filesystems_changed Indicates the collected set of filesystems changed since the previous collection
+		# TYPE gpfs_exporter_filesystems_changed gauge
+		gpfs_exporter_filesystems_changed{collector="mmdf"} 1
+		# HELP gpfs_exporter_filesystems_removed_total Number of filesystems removed from the collected set since exporter start
+		# TYPE gpfs_exporter_filesystems_removed_total counter
+		gpfs_exporter_filesystems_removed_total{collector="mmdf"} 2
+	`, `
+		# HELP gpfs_exporter_filesystems_added_total Number of filesystems added to the collected set since exporter start
+		# TYPE gpfs_exporter_filesystems_added_total counter
+		gpfs_exporter_filesystems_added_total{collector="mmdf"} 3
+		# HELP gpfs_exporter_filesystems_changed Indicates the collected set of filesystems changed since the previous collection
+		# TYPE gpfs_exporter_filesystems_changed gauge
+		gpfs_exporter_filesystems_changed{collector="mmdf"} 1
+		# HELP gpfs_exporter_filesystems_removed_total Number of filesystems removed from the collected set since exporter start
+		# TYPE gpfs_exporter_filesystems_removed_total counter
+		gpfs_exporter_filesystems_removed_total{collector="mmdf"} 3
+	`, `
+		# HELP gpfs_exporter_filesystems_added_total Number of filesystems added to the collected set since exporter start
+		# TYPE gpfs_exporter_filesystems_added_total counter
+		gpfs_exporter_filesystems_added_total{collector="mmdf"} 3
+		# HELP gpfs_exporter_filesystems_changed Indicates the collected set of filesystems changed since the previous collection
+		# TYPE gpfs_exporter_filesystems_changed gauge
+		gpfs_exporter_filesystems_changed{collector="mmdf"} 0
+		# HELP gpfs_exporter_filesystems_removed_total Number of filesystems removed from the collected set since exporter start
+		# TYPE gpfs_exporter_filesystems_removed_total counter
+		gpfs_exporter_filesystems_removed_total{collector="mmdf"} 3
+	`}
+	for i, fixture := range fixtures {
+		out := fixture
+		MmlsfsExec = func(ctx context.Context) (string, error) {
+			return out, nil
+		}
+		collector := NewMmdfCollector(log.NewNopLogger())
+		gatherers := setupGatherer(collector)
+		if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected[i]),
+			"gpfs_exporter_filesystems_added_total", "gpfs_exporter_filesystems_removed_total", "gpfs_exporter_filesystems_changed"); err != nil {
+			t.Errorf("unexpected collecting result for collection %d:\n%s", i, err)
+		}
+	}
+}
+
+func TestKeepLastOnDiscoveryFailure(t *testing.T) {
+	defer func(mmdf *string) {
+		configFilesystems = mmdf
+		mmlsfsCache = &MmlsfsCache{}
+	}(configFilesystems)
+	filesystems := ""
+	configFilesystems = &filesystems
+	MmdfExec = func(fs string, ctx context.Context) (string, error) {
+		if fs == "scratch" {
+			return "", fmt.Errorf("mmdf failed")
+		}
+		return mmdfStdout, nil
+	}
+	discovered := `
+fs::HEADER:version:reserved:reserved:deviceName:fieldName:data:remarks:
+mmlsfs::0:1:::project:defaultMountPoint:%2Ffs%2Fproject::
+mmlsfs::0:1:::scratch:defaultMountPoint:%2Ffs%2Fscratch::
+`
+	expected := map[bool]string{
+		true: `
+		# HELP gpfs_exporter_collect_error Indicates if error has occurred during collection
+		# TYPE gpfs_exporter_collect_error gauge
+		gpfs_exporter_collect_error{collector="mmdf-mmlsfs"} 1
+		gpfs_exporter_collect_error{collector="mmdf-project"} 0
+		gpfs_exporter_collect_error{collector="mmdf-scratch"} 1
+		# HELP gpfs_fs_inodes GPFS filesystem inodes total
+		# TYPE gpfs_fs_inodes gauge
+		gpfs_fs_inodes{fs="project",remote_cluster=""} 1332164000
+	`,
+		false: `
+		# HELP gpfs_exporter_collect_error Indicates if error has occurred during collection
+		# TYPE gpfs_exporter_collect_error gauge
+		gpfs_exporter_collect_error{collector="mmdf-mmlsfs"} 1
+	`,
+	}
+	for keep, e := range expected {
+		args := []string{}
+		if keep {
+			args = append(args, "--collector.keep-last-on-discovery-failure")
+		}
+		if _, err := kingpin.CommandLine.Parse(args); err != nil {
+			t.Fatal(err)
+		}
+		filesystemsCache = &FilesystemTracker{
+			filesystems: make(map[string][]string),
+			added:       make(map[string]float64),
+			removed:     make(map[string]float64),
+		}
+		mmlsfsCache = &MmlsfsCache{}
+		MmlsfsExec = func(ctx context.Context) (string, error) {
+			return discovered, nil
+		}
+		collector := NewMmdfCollector(log.NewNopLogger())
+		if val, err := testutil.GatherAndCount(setupGatherer(collector), "gpfs_fs_inodes"); err != nil {
+			t.Errorf("keep=%v: Unexpected error: %v", keep, err)
+		} else if val != 1 {
+			t.Errorf("keep=%v: Unexpected gpfs_fs_inodes count %d after discovery, expected 1", keep, val)
+		}
+		mmlsfsCache = &MmlsfsCache{}
+		MmlsfsExec = func(ctx context.Context) (string, error) {
+			return "", fmt.Errorf("mmlsfs failed")
+		}
+		collector = NewMmdfCollector(log.NewNopLogger())
+		if err := testutil.GatherAndCompare(setupGatherer(collector), strings.NewReader(e),
+			"gpfs_exporter_collect_error", "gpfs_fs_inodes"); err != nil {
+			t.Errorf("keep=%v: unexpected collecting result:\n%s", keep, err)
+		}
+	}
+}
+
+func TestMmlsfsCache(t *testing.T) {
+	ttl := time.Minute
+	defer func(orig *time.Duration) {
+		mmlsfsTTL = orig
+		mmlsfsCache = &MmlsfsCache{}
+	}(mmlsfsTTL)
+	mmlsfsTTL = &ttl
+	mmlsfsCache = &MmlsfsCache{}
+	out := `
+fs::HEADER:version:reserved:reserved:deviceName:fieldName:data:remarks:
+mmlsfs::0:1:::project:defaultMountPoint:%2Ffs%2Fproject::
+mmlsfs::0:1:::scratch:defaultMountPoint:%2Ffs%2Fscratch::
+`
+	var calls int32
+	fail := true
+	MmlsfsExec = func(ctx context.Context) (string, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(100 * time.Millisecond)
+		if fail {
+			return "", fmt.Errorf("Error")
+		}
+		return out, nil
+	}
+	var wg sync.WaitGroup
+	errs := make([]error, 3)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, _, errs[i] = mmlfsfsFilesystems(context.Background(), log.NewNopLogger())
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err == nil {
+			t.Errorf("Expected error from shared mmlsfs call %d", i)
+		}
+	}
+	if val := atomic.LoadInt32(&calls); val != 1 {
+		t.Errorf("Unexpected mmlsfs executions, got %d", val)
+	}
+	fail = false
+	for i := 0; i < 2; i++ {
+		filesystems, _, err := mmlfsfsFilesystems(context.Background(), log.NewNopLogger())
+		if err != nil {
+			t.Errorf("Unexpected error: %s", err.Error())
+		}
+		if len(filesystems) != 2 {
+			t.Errorf("Unexpected filesystems: %v", filesystems)
+		}
+	}
+	if val := atomic.LoadInt32(&calls); val != 2 {
+		t.Errorf("Unexpected mmlsfs executions, got %d", val)
+	}
+}
+
+func TestLastSuccess(t *testing.T) {
+	defer func() {
+		lastSuccessCache = &LastSuccessTracker{times: make(map[string]float64)}
+	}()
+	lastSuccessCache = &LastSuccessTracker{times: make(map[string]float64)}
+	now := time.Unix(1000, 0)
+	if val := lastSuccessCache.update("test", false, now); val != 0 {
+		t.Errorf("Unexpected last success before any success, got %v", val)
+	}
+	if val := lastSuccessCache.update("test", true, now); val != 1000 {
+		t.Errorf("Unexpected last success, got %v", val)
+	}
+	if val := lastSuccessCache.update("test", false, time.Unix(2000, 0)); val != 1000 {
+		t.Errorf("Unexpected last success after error, got %v", val)
+	}
+	if val := lastSuccessCache.update("other", false, now); val != 0 {
+		t.Errorf("Unexpected last success for other collector, got %v", val)
+	}
+	ch := make(chan prometheus.Metric, 12)
+	emitCollectorStatus(ch, "test", context.DeadlineExceeded, time.Now(), 0)
+	close(ch)
+	if val := len(ch); val != 12 {
+		t.Errorf("Unexpected status metric count %d, expected 12", val)
+	}
+	if val := lastSuccessCache.update("test", false, now); val != 1000 {
+		t.Errorf("Unexpected last success after timeout, got %v", val)
+	}
+}
+
+func TestEmitCollectResult(t *testing.T) {
+	tests := []struct {
+		err     error
+		records int
+		success float64
+	}{
+		{err: nil, records: 2, success: 1},
+		{err: nil, records: 0, success: 0},
+		{err: nil, records: anyRecords, success: 1},
+		{err: fmt.Errorf("Error"), records: 2, success: 0},
+		{err: context.DeadlineExceeded, records: anyRecords, success: 0},
+	}
+	for _, test := range tests {
+		ch := make(chan prometheus.Metric, 9)
+		emitCollectResult(ch, "test", test.err, test.records)
+		close(ch)
+		var success float64 = -1
+		for m := range ch {
+			if !strings.Contains(m.Desc().String(), "gpfs_exporter_collect_success") {
+				continue
+			}
+			metric := &dto.Metric{}
+			if err := m.Write(metric); err != nil {
+				t.Fatal(err)
+			}
+			success = metric.GetGauge().GetValue()
+		}
+		if success != test.success {
+			t.Errorf("Unexpected success for err %v and records %d, got %v expected %v", test.err, test.records, success, test.success)
+		}
+	}
+}
+
+type panicCollector struct {
+	desc *prometheus.Desc
+}
+
+func (c *panicCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *panicCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, 1, "extra")
+}
+
+func TestCollectorPanic(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	MmgetstateExec = func(ctx context.Context) (string, error) {
+		return mmgetstateStdout, nil
+	}
+	panics := testutil.ToFloat64(collectorPanics.WithLabelValues("panic"))
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(&sharedCollector{name: "panic", logger: log.NewNopLogger(),
+		collector: &panicCollector{desc: prometheus.NewDesc("gpfs_test_panic", "Test panic", nil, nil)}})
+	registry.MustRegister(&sharedCollector{name: "mmgetstate", logger: log.NewNopLogger(),
+		collector: NewMmgetstateCollector(log.NewNopLogger())})
+	expected := `
+		# HELP gpfs_exporter_collect_error Indicates if error has occurred during collection
+		# TYPE gpfs_exporter_collect_error gauge
+		gpfs_exporter_collect_error{collector="mmgetstate"} 0
+		gpfs_exporter_collect_error{collector="panic"} 1
+		# HELP gpfs_state GPFS state
+		# TYPE gpfs_state gauge
+		gpfs_state{state="active"} 1
+		gpfs_state{state="arbitrating"} 0
+		gpfs_state{state="down"} 0
+		gpfs_state{state="unknown"} 0
+	`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), "gpfs_exporter_collect_error", "gpfs_state"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+	if val := testutil.ToFloat64(collectorPanics.WithLabelValues("panic")) - panics; val != 1 {
+		t.Errorf("Unexpected collector panics %v, expected 1", val)
+	}
+}
+
+func TestSeriesLimit(t *testing.T) {
+	MmgetstateExec = func(ctx context.Context) (string, error) {
+		return mmgetstateStdout, nil
+	}
+	defer kingpin.CommandLine.Parse([]string{})
+	tests := []struct {
+		args     []string
+		count    int
+		exceeded float64
+	}{
+		{args: []string{"--collector.max-series=2"}, count: 14, exceeded: 1},
+		{args: []string{"--collector.max-series=2", "--collector.mmgetstate.max-series=0"}, count: 16, exceeded: -1},
+		{args: []string{"--collector.mmgetstate.max-series=100"}, count: 16, exceeded: 0},
+		{args: []string{}, count: 16, exceeded: -1},
+	}
+	for _, test := range tests {
+		if _, err := kingpin.CommandLine.Parse(test.args); err != nil {
+			t.Fatal(err)
+		}
+		collector := &sharedCollector{name: "mmgetstate", factory: "mmgetstate", collector: NewMmgetstateCollector(log.NewNopLogger()), logger: log.NewNopLogger()}
+		if val, err := testutil.GatherAndCount(setupGatherer(collector)); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		} else if val != test.count {
+			t.Errorf("Unexpected collection count %d with %v, expected %d", val, test.args, test.count)
+		}
+		if val, err := testutil.GatherAndCount(setupGatherer(collector), "gpfs_exporter_collect_success"); err != nil || val != 1 {
+			t.Errorf("Expected status metrics to not be limited with %v, got %d", test.args, val)
+		}
+		if test.exceeded < 0 {
+			if testutil.CollectAndCount(seriesLimitExceeded) != 0 {
+				t.Errorf("Unexpected gpfs_exporter_series_limit_exceeded with %v", test.args)
+			}
+		} else if val := testutil.ToFloat64(seriesLimitExceeded.WithLabelValues("mmgetstate")); val != test.exceeded {
+			t.Errorf("Unexpected gpfs_exporter_series_limit_exceeded %v with %v, expected %v", val, test.args, test.exceeded)
+		}
+	}
+}
+
+func TestScrapeGroupBlock(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	var calls int32
+	MmgetstateExec = func(ctx context.Context) (string, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(500 * time.Millisecond)
+		return mmgetstateStdout, nil
+	}
+	collector := &sharedCollector{name: "mmgetstate", collector: NewMmgetstateCollector(log.NewNopLogger()), logger: log.NewNopLogger()}
+	var wg sync.WaitGroup
+	counts := make([]int, 2)
+	for i := range counts {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			counts[i], _ = testutil.GatherAndCount(setupGatherer(collector))
+		}(i)
+		time.Sleep(100 * time.Millisecond)
+	}
+	wg.Wait()
+	if calls != 1 {
+		t.Errorf("Unexpected command executions %d, expected 1", calls)
+	}
+	for i, count := range counts {
+		if count != 16 {
+			t.Errorf("Unexpected collection count %d for scrape %d, expected 16", count, i)
+		}
+	}
+}
+
+func TestScrapeGroupCached(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--exporter.concurrent-scrape=cached"}); err != nil {
+		t.Fatal(err)
+	}
+	var calls int32
+	MmgetstateExec = func(ctx context.Context) (string, error) {
+		atomic.AddInt32(&calls, 1)
+		return mmgetstateStdout, nil
+	}
+	collector := &sharedCollector{name: "mmgetstate", collector: NewMmgetstateCollector(log.NewNopLogger()), logger: log.NewNopLogger()}
+	if val, err := testutil.GatherAndCount(setupGatherer(collector)); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 16 {
+		t.Errorf("Unexpected collection count %d, expected 16", val)
+	}
+	MmgetstateExec = func(ctx context.Context) (string, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(500 * time.Millisecond)
+		return mmgetstateStdout, nil
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, _ = testutil.GatherAndCount(setupGatherer(collector))
+	}()
+	time.Sleep(100 * time.Millisecond)
+	start := time.Now()
+	if val, err := testutil.GatherAndCount(setupGatherer(collector)); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 16 {
+		t.Errorf("Unexpected collection count %d, expected 16", val)
+	}
+	if time.Since(start) > 300*time.Millisecond {
+		t.Errorf("Cached scrape waited for running collection")
+	}
+	wg.Wait()
+	if calls != 2 {
+		t.Errorf("Unexpected command executions %d, expected 2", calls)
+	}
+}
+
+func TestNewProbeCollector(t *testing.T) {
+	MmlsfsExec = func(ctx context.Context) (string, error) {
+		return mmlsfsStdout, nil
+	}
+	if _, err := NewProbeCollector("foo", nil, log.NewNopLogger()); err == nil {
+		t.Errorf("Expected error for unknown collector")
+	}
+	if _, err := NewProbeCollector("mmgetstate", []string{"project"}, log.NewNopLogger()); err == nil {
+		t.Errorf("Expected error for collector that does not run per filesystem")
+	}
+	if _, err := NewProbeCollector("mmdf", []string{"project", "home"}, log.NewNopLogger()); err == nil {
+		t.Errorf("Expected error for missing filesystem")
+	}
+	collector, err := NewProbeCollector("mmdf", []string{"scratch"}, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	shared := collector.(*sharedCollector)
+	if shared.name != "mmdf-scratch" {
+		t.Errorf("Unexpected probe name %s", shared.name)
+	}
+	if fs := shared.collector.(*MmdfCollector).filesystems; !reflect.DeepEqual(fs, []string{"scratch"}) {
+		t.Errorf("Unexpected probe filesystems %v", fs)
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	tests := map[string][]string{
+		"":                    nil,
+		"project":             {"project"},
+		"project,scratch":     {"project", "scratch"},
+		"project, scratch":    {"project", "scratch"},
+		" project ,,scratch,": {"project", "scratch"},
+	}
+	for value, expected := range tests {
+		if val := SplitList(value); !reflect.DeepEqual(val, expected) {
+			t.Errorf("Unexpected split of %q, got %v expected %v", value, val, expected)
+		}
+	}
+}
+
+func TestParseGPFSTime(t *testing.T) {
+	tests := map[string]int64{
+		"Wed May 18 10:41:35 2016":       1463586095,
+		"Wed May  8 10:41:35 2016":       1462722095,
+		"Wed May 18 10:41:35 EST 2016":   1463586095,
+		"Wed May 18 10:41:35 UTC 2016":   1463568095,
+		"Wed May 18 10:41:35 2016 UTC":   1463568095,
+		"Wed May 18 10:41:35 CEST 2016":  1463586095,
+		"Wed May 18 10:41:35 -0400 2016": 1463582495,
+		"2016-05-18 10:41:35":            1463586095,
+		"2016-05-18 10:41:35 +0000":      1463568095,
+	}
+	for value, expected := range tests {
+		parsed, err := parseGPFSTime(value)
+		if err != nil {
+			t.Errorf("Unexpected error parsing %s: %s", value, err.Error())
+			continue
+		}
+		if parsed.Unix() != expected {
+			t.Errorf("Unexpected time for %s, got %d expected %d", value, parsed.Unix(), expected)
+		}
+	}
+	for _, value := range []string{"Mi Mai 18 10:41:35 2016", "18. Mai 2016 10:41:35", "foo", ""} {
+		if _, err := parseGPFSTime(value); err == nil {
+			t.Errorf("Expected error parsing %s", value)
+		}
+	}
+}
+
+func TestRunMMCommandLocale(t *testing.T) {
+	var cmd *exec.Cmd
+	execCommand = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+		cmd = fakeExecCommand(ctx, name, args...)
+		return cmd
+	}
+	defer func() { execCommand = exec.CommandContext }()
+	mockedExitStatus = 0
+	mockedStdout = "foo"
+	if _, err := RunMMCommand(context.Background(), "mmlsfileset", "project", "-Y"); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if !SliceContains(cmd.Env, "LC_ALL=C") || !SliceContains(cmd.Env, "GO_WANT_HELPER_PROCESS=1") {
+		t.Errorf("Unexpected command environment: %v", cmd.Env)
+	}
+}
+
+func TestDecodeGPFSString(t *testing.T) {
+	tests := map[string]string{
+		"":                             "",
+		"project":                      "project",
+		"%2Ffs%2Fproject":              "/fs/project",
+		"Thu Nov 23 14%3A29%3A26 2017": "Thu Nov 23 14:29:26 2017",
+		"/fs/my%20project":             "/fs/my project",
+		"%2D%2D":                       "--",
+		"a+b":                          "a+b",
+		"/fs%project":                  "/fs%project",
+		"100%":                         "100%",
+		"caf%C3%A9":                    "café",
+		"%3a%3A":                       "::",
+	}
+	for value, expected := range tests {
+		if val := DecodeGPFSString(value); val != expected {
+			t.Errorf("Unexpected decode of %q, got %q expected %q", value, val, expected)
+		}
+	}
+}
+
+func TestValidateFilesystems(t *testing.T) {
+	defer func(mmdf *string, qos *string) {
+		configFilesystems = mmdf
+		qosFilesystems = qos
+	}(configFilesystems, qosFilesystems)
+	empty := ""
+	qosFilesystems = &empty
+	tests := map[string]bool{
+		"":                    true,
+		"project, scratch":    true,
+		"project,/fs/project": false,
+		"pro ject,scratch":    false,
+	}
+	for filesystems, valid := range tests {
+		value := filesystems
+		configFilesystems = &value
+		if err := ValidateFilesystems(); valid && err != nil {
+			t.Errorf("Unexpected error for %q: %s", filesystems, err.Error())
+		} else if !valid && err == nil {
+			t.Errorf("Expected error for %q", filesystems)
+		}
+	}
+}
+
+func TestValidateRegexes(t *testing.T) {
+	defer func(exclude string) { *fsExclude = exclude }(*fsExclude)
+	if err := ValidateRegexes(); err != nil {
+		t.Errorf("Unexpected error for defaults: %s", err.Error())
+	}
+	*fsExclude = "^(remote"
+	if err := ValidateRegexes(); err == nil {
+		t.Errorf("Expected error for invalid regex")
+	} else if !strings.Contains(err.Error(), "--collector.filesystems-exclude") {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+}
+
+func TestParseConstLabels(t *testing.T) {
+	tests := map[string]prometheus.Labels{
+		"":                           {},
+		"cluster=ess01":              {"cluster": "ess01"},
+		" cluster=ess01 , site=dc2 ": {"cluster": "ess01", "site": "dc2"},
+		"cluster=":                   {"cluster": ""},
+	}
+	for value, expected := range tests {
+		labels, err := parseConstLabels(value)
+		if err != nil {
+			t.Errorf("Unexpected error for %q: %s", value, err.Error())
+		}
+		if !reflect.DeepEqual(labels, expected) {
+			t.Errorf("Unexpected labels for %q, got %v expected %v", value, labels, expected)
+		}
+	}
+	for _, value := range []string{"cluster", "1cluster=ess01", "site-name=dc2", "__name__=foo", "cluster=ess01,cluster=ess02"} {
+		if _, err := parseConstLabels(value); err == nil {
+			t.Errorf("Expected error for %q", value)
+		}
+	}
+}
+
+func TestCheckFilesystemsExist(t *testing.T) {
+	defer func() { MmlsfsExec = mmlsfs }()
+	MmlsfsExec = func(ctx context.Context) (string, error) {
+		return mmlsfsStdout, nil
+	}
+	tests := []struct {
+		args  []string
+		valid bool
+	}{
+		{args: []string{"--collector.mmdf.filesystems=bogus"}, valid: true},
+		{args: []string{"--collector.validate-filesystems=fail"}, valid: true},
+		{args: []string{"--collector.validate-filesystems=fail", "--collector.mmdf.filesystems=project,ess",
+			"--collector.mmrepquota.filesets=scratch:home"}, valid: true},
+		{args: []string{"--collector.validate-filesystems=fail", "--collector.mmlssnapshot.filesystems=bogus"}, valid: false},
+		{args: []string{"--collector.validate-filesystems=fail", "--collector.mmrepquota.filesets=bogus:home"}, valid: false},
+		{args: []string{"--collector.validate-filesystems=warn", "--collector.mmdf.filesystems=bogus"}, valid: true},
+	}
+	defer func() { _, _ = kingpin.CommandLine.Parse([]string{}) }()
+	for _, test := range tests {
+		if _, err := kingpin.CommandLine.Parse(test.args); err != nil {
+			t.Fatal(err)
+		}
+		if err := CheckFilesystemsExist(log.NewNopLogger()); test.valid && err != nil {
+			t.Errorf("Unexpected error for %v: %s", test.args, err.Error())
+		} else if !test.valid && err == nil {
+			t.Errorf("Expected error for %v", test.args)
+		}
+	}
+	MmlsfsExec = func(ctx context.Context) (string, error) {
+		return "", errors.New("mmlsfs failed")
+	}
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.validate-filesystems=fail", "--collector.mmdf.filesystems=project"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckFilesystemsExist(log.NewNopLogger()); err == nil {
+		t.Errorf("Expected error when mmlsfs fails")
+	}
+}
+
+func TestConfiguredFilesystemMissing(t *testing.T) {
+	defer func() {
+		MmlsfsExec = mmlsfs
+		_, _ = kingpin.CommandLine.Parse([]string{})
+	}()
+	MmlsfsExec = func(ctx context.Context) (string, error) {
+		return mmlsfsStdout, nil
+	}
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.validate-filesystems=warn",
+		"--collector.mmdf.filesystems=project,bogus", "--collector.mmlsqos.filesystems=project"}); err != nil {
+		t.Fatal(err)
+	}
+	expected := `
+		# HELP gpfs_exporter_configured_filesystem_missing Indicates a filesystem set by collector flags was not found by mmlsfs
+		# TYPE gpfs_exporter_configured_filesystem_missing gauge
+		gpfs_exporter_configured_filesystem_missing{fs="bogus"} 1
+		gpfs_exporter_configured_filesystem_missing{fs="project"} 0
+	`
+	if err := testutil.CollectAndCompare(configuredFilesystemsCollector{}, strings.NewReader(expected)); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.mmdf.filesystems=bogus"}); err != nil {
+		t.Fatal(err)
+	}
+	if val := testutil.CollectAndCount(configuredFilesystemsCollector{}); val != 0 {
+		t.Errorf("Unexpected collection count %d, expected 0", val)
+	}
+}
+
+func TestParentContextCancel(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	SetParentContext(ctx)
+	defer SetParentContext(context.Background())
+	defer func(mmdf *string) { configFilesystems = mmdf }(configFilesystems)
+	filesystems := "project"
+	configFilesystems = &filesystems
+	MmdfExec = func(fs string, ctx context.Context) (string, error) {
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(10 * time.Second):
+			return mmdfStdout, nil
+		}
+	}
+	expected := `
+		# HELP gpfs_exporter_collect_error Indicates if error has occurred during collection
+		# TYPE gpfs_exporter_collect_error gauge
+		gpfs_exporter_collect_error{collector="mmdf-project"} 1
+	`
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	collector := NewMmdfCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collect_error"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Collection was not aborted, took %s", elapsed)
+	}
+	defer func() { commands = &commandTracker{} }()
+	if !WaitCommands(time.Second) {
+		t.Errorf("Expected no running commands")
+	}
+}
+
+func TestWaitCommandsStopsCommands(t *testing.T) {
+	execCommand = fakeExecCommand
+	mockedExitStatus = 0
+	mockedStdout = "foo"
+	defer func() {
+		execCommand = exec.CommandContext
+		commands = &commandTracker{}
+	}()
+	if !WaitCommands(time.Second) {
+		t.Errorf("Expected no running commands")
+	}
+	if _, err := RunMMCommand(context.Background(), "mmlsfs", "all", "-Y"); err != errCommandsStopped {
+		t.Errorf("Expected command to be refused after WaitCommands, got %v", err)
+	}
+}
+
+func TestFailureLoggerDedup(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--log.collect-failures", "--log.collect-failures-interval=1m"}); err != nil {
+		t.Fatal(err)
+	}
+	defer kingpin.CommandLine.Parse([]string{})
+	var buf strings.Builder
+	f := &FailureLogger{
+		logger: log.NewLogfmtLogger(&buf),
+		logged: make(map[string]time.Time),
+	}
+	now := time.Now()
+	f.log("mmdf-project", context.DeadlineExceeded, 30, now)
+	if got := buf.String(); !strings.Contains(got, "collector=mmdf fs=project reason=timeout duration=30") {
+		t.Errorf("Unexpected log: %s", got)
+	}
+	buf.Reset()
+	f.log("mmdf-project", context.DeadlineExceeded, 30, now.Add(30*time.Second))
+	if buf.Len() != 0 {
+		t.Errorf("Expected no log within interval, got: %s", buf.String())
+	}
+	f.log("mmdf-project", errors.New("boom"), 1, now.Add(30*time.Second))
+	if got := buf.String(); !strings.Contains(got, "reason=other") {
+		t.Errorf("Expected log for different reason, got: %s", got)
+	}
+	buf.Reset()
+	f.log("mmdf-project", context.DeadlineExceeded, 30, now.Add(2*time.Minute))
+	if !strings.Contains(buf.String(), "reason=timeout") {
+		t.Errorf("Expected log after interval, got: %s", buf.String())
+	}
+	buf.Reset()
+	f.log("mmhealth", context.DeadlineExceeded, 30, now)
+	if got := buf.String(); !strings.Contains(got, "collector=mmhealth reason=timeout") || strings.Contains(got, "fs=") {
+		t.Errorf("Unexpected log: %s", got)
+	}
+}
+
+func TestFailureLoggerDisabled(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	var buf strings.Builder
+	f := &FailureLogger{
+		logger: log.NewLogfmtLogger(&buf),
+		logged: make(map[string]time.Time),
+	}
+	f.log("mmdf-project", context.DeadlineExceeded, 30, time.Now())
+	if buf.Len() != 0 {
+		t.Errorf("Expected no log, got: %s", buf.String())
+	}
+}
+
+// insertColumn returns out with a dummy column inserted at index of every -Y HEADER
+// and data line, the same as when a new GPFS release adds a column
+func insertColumn(out string, index int) string {
+	lines := strings.Split(out, "\n")
+	for i, l := range lines {
+		items := strings.Split(l, ":")
+		if len(items) < 3 || len(items) <= index {
+			continue
+		}
+		value := "dummy"
+		if items[2] == "HEADER" {
+			value = "dummyColumn"
+		}
+		items = append(items[:index], append([]string{value}, items[index:]...)...)
+		lines[i] = strings.Join(items, ":")
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestHeaderIndexMap(t *testing.T) {
+	indexes := HeaderIndexMap(strings.Split("mmlsfs::HEADER:version:reserved:reserved:deviceName:fieldName:data:remarks:", ":"))
+	if val := indexes["deviceName"]; val != 6 {
+		t.Errorf("Unexpected deviceName index %d", val)
+	}
+	if val := indexes["reserved"]; val != 4 {
+		t.Errorf("Unexpected reserved index %d, expected first column", val)
+	}
+	items := strings.Split("mmlsfs::0:1:::project:defaultMountPoint", ":")
+	if val, ok := headerValue(items, indexes, "fieldName"); !ok || val != "defaultMountPoint" {
+		t.Errorf("Unexpected fieldName %s %v", val, ok)
+	}
+	if _, ok := headerValue(items, indexes, "data"); ok {
+		t.Errorf("Expected no value for column past end of row")
+	}
+	if _, ok := headerValue(items, indexes, "missing"); ok {
+		t.Errorf("Expected no value for missing column")
+	}
+}
+
+func TestParseMmlsfsInsertedColumn(t *testing.T) {
+	out := `
+fs::HEADER:version:reserved:reserved:deviceName:fieldName:data:remarks:
+mmlsfs::0:1:::project:defaultMountPoint:%2Ffs%2Fproject::
+mmlsfs::0:1:::scratch:defaultMountPoint:%2Ffs%2Fscratch::
+`
+	expected := parse_mmlsfs(out)
+	if len(expected) != 2 {
+		t.Fatalf("Expected 2 filesystems, got %d", len(expected))
+	}
+	got := parse_mmlsfs(insertColumn(out, 6))
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Unexpected filesystems with inserted column\nGot: %v\nExpected: %v", got, expected)
+	}
+}
+
+func TestCommandContextScrapeDeadline(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.mmgetstate.timeout=60"}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_, _ = kingpin.CommandLine.Parse([]string{})
+	}()
+	var got time.Time
+	MmgetstateExec = func(ctx context.Context) (string, error) {
+		got, _ = ctx.Deadline()
+		return mmgetstateStdout, nil
+	}
+	deadline := time.Now().Add(time.Second)
+	collector := &sharedCollector{name: "mmgetstate", factory: "mmgetstate", logger: log.NewNopLogger(),
+		collector: NewMmgetstateCollector(log.NewNopLogger())}
+	SetDeadline(collector, deadline)
+	collector.Collect(make(chan prometheus.Metric, 100))
+	if !got.Equal(deadline) {
+		t.Errorf("Unexpected deadline %v, expected %v", got, deadline)
+	}
+	if _, ok := scrapes.deadline("mmgetstate"); ok {
+		t.Errorf("Scrape deadline was not removed after collection")
+	}
+	SetDeadline(collector, time.Time{})
+	collector.Collect(make(chan prometheus.Metric, 100))
+	if time.Until(got) < 59*time.Second {
+		t.Errorf("Unexpected deadline %v without a scrape deadline", got)
+	}
+}
+
+func TestKBToBytes(t *testing.T) {
+	if val := KBToBytes(1); val != 1024 {
+		t.Errorf("Unexpected bytes %v for 1 KB", val)
+	}
+	if val := MBToBytes(1); val != 1048576 {
+		t.Errorf("Unexpected bytes %v for 1 MB", val)
+	}
+}
+
+// TestByteScaling checks the bytes of each collector against the units of the command output,
+// mmdf, mmrepquota, mmlsfileset and mmlssnapshot report kilobytes and mmlsqos megabytes per second
+func TestByteScaling(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	logger := log.NewNopLogger()
+	df, err := parse_mmdf(mmdfStdout, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	quotas, err := parse_mmrepquota(mmrepquotaStdout, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filesets, err := parse_mmlsfileset(`
+mmlsfileset::HEADER:version:reserved:reserved:filesystemName:filesetName:id:rootInode:status:path:parentId:created:inodes:dataInKB:comment:inodeSpace:isInodeSpaceOwner:maxInodes:allocInodes:freeInodes:
+mmlsfileset::0:1:::project:root:0:3:Linked:%2Ffs%2Fproject:--:Wed May 18 10%3A41%3A35 2016:1000:337419744:root fileset:0:1:300000000:102052224:102045986:
+`, logger)
+	if err != nil || len(filesets) != 1 || filesets[0].DataSize == nil {
+		t.Fatalf("Unexpected filesets %v: %v", filesets, err)
+	}
+	snapshots, err := parse_mmlssnapshot(`
+mmlssnapshot::HEADER:version:reserved:reserved:filesystemName:directory:snapID:status:created:quotas:data:metadata:fileset:snapType:
+mmlssnapshot::0:1:::ess:20210120:27107:Valid:Wed Jan 20 00%3A30%3A02 2021::2048:16:::
+`, logger)
+	if err != nil || len(snapshots) != 1 {
+		t.Fatalf("Unexpected snapshots %v: %v", snapshots, err)
+	}
+	qos, err := parse_mmlsqos(mmlsqosStdout, logger)
+	if err != nil || len(qos) == 0 {
+		t.Fatalf("Unexpected qos %v: %v", qos, err)
+	}
+	tests := []struct {
+		name     string
+		got      float64
+		expected float64
+	}{
+		{name: "mmdf fsSize 3661677723648 KB", got: df.FSTotal, expected: 3749557989015552},
+		{name: "mmdf system poolSize 783308292096 KB", got: df.Pools[0].PoolTotal, expected: 802107691106304},
+		{name: "mmdf P_META_VD102 diskSize 771751936 KB", got: df.NSDs[0].Size, expected: 790273982464},
+		{name: "mmrepquota root blockUsage 337419744 KB", got: quotas[0].BlockUsage, expected: 345517817856},
+		{name: "mmrepquota root blockInDoubt 163840 KB", got: quotas[0].BlockInDoubt, expected: 167772160},
+		{name: "mmrepquota PZS1003 blockQuota 2147483648 KB", got: quotas[1].BlockQuota, expected: 2199023255552},
+		{name: "mmlsfileset root dataInKB 337419744 KB", got: *filesets[0].DataSize, expected: 345517817856},
+		{name: "mmlssnapshot data 2048 KB", got: snapshots[0].Data, expected: 2097152},
+		{name: "mmlssnapshot metadata 16 KB", got: snapshots[0].Metadata, expected: 16384},
+		{name: "mmlsqos MBs 4.675 MB/s", got: qos[0].Bs, expected: 4902092.8},
+	}
+	for _, test := range tests {
+		if test.got != test.expected {
+			t.Errorf("Unexpected bytes for %s, got %v expected %v", test.name, test.got, test.expected)
+		}
+	}
+	if df.Pools[0].PoolName != "system" || df.NSDs[0].NSDName != "P_META_VD102" || quotas[1].Name != "PZS1003" {
+		t.Errorf("Unexpected fixture order")
+	}
+}
@@ -46,8 +46,8 @@ func init() {
 
 func NewConfigCollector(logger log.Logger) Collector {
 	return &ConfigCollector{
-		PagePool: prometheus.NewDesc(prometheus.BuildFQName(namespace, "config", "page_pool_bytes"),
-			"GPFS configured page pool size", nil, nil),
+		PagePool: newDesc(prometheus.BuildFQName(namespace, "config", "page_pool_bytes"),
+			"GPFS configured page pool size in bytes", nil, nil),
 		logger: logger,
 	}
 }
@@ -59,69 +59,62 @@ func (c *ConfigCollector) Describe(ch chan<- *prometheus.Desc) {
 func (c *ConfigCollector) Collect(ch chan<- prometheus.Metric) {
 	level.Debug(c.logger).Log("msg", "Collecting config metrics")
 	collectTime := time.Now()
-	timeout := 0
-	errorMetric := 0
 	metrics, err := c.collect()
 	if err == context.DeadlineExceeded {
 		level.Error(c.logger).Log("msg", "Timeout executing 'mmdiag --config'")
-		timeout = 1
 	} else if err != nil {
 		level.Error(c.logger).Log("msg", err)
-		errorMetric = 1
 	}
 
 	if err == nil {
 		ch <- prometheus.MustNewConstMetric(c.PagePool, prometheus.GaugeValue, metrics.PagePool)
 	}
 
-	ch <- prometheus.MustNewConstMetric(collectError, prometheus.GaugeValue, float64(errorMetric), "config")
-	ch <- prometheus.MustNewConstMetric(collecTimeout, prometheus.GaugeValue, float64(timeout), "config")
-	ch <- prometheus.MustNewConstMetric(collectDuration, prometheus.GaugeValue, time.Since(collectTime).Seconds(), "config")
+	emitCollectorStatus(ch, "config", err, collectTime, recordCount(metrics.PagePool != 0))
 }
 
 func (c *ConfigCollector) collect() (ConfigMetric, error) {
 	var configMetric ConfigMetric
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(*configTimeout)*time.Second)
+	ctx, cancel := commandContext("config", *configTimeout)
 	defer cancel()
-	out, err := MmdiagExec("--config", ctx)
+	out, err := execRetry(ctx, "config", func() (string, error) {
+		return MmdiagExec("--config", ctx)
+	})
 	if err != nil {
 		return configMetric, err
 	}
+	commandDump.record("mmdiag-config", out)
 	parse_mmdiag_config(out, &configMetric, c.logger)
+	commandDump.recordParsed("mmdiag-config", configMetric)
 	return configMetric, nil
 }
 
 func parse_mmdiag_config(out string, configMetric *ConfigMetric, logger log.Logger) {
 	lines := strings.Split(out, "\n")
-	var keyIdx int
-	var valueIdx int
+	var headers map[string]int
 	for _, line := range lines {
 		items := strings.Split(line, ":")
 		if len(items) < 3 {
 			continue
 		}
 		if items[2] == "HEADER" {
-			for i, header := range items {
-				if header == "name" {
-					keyIdx = i
-				} else if header == "value" {
-					valueIdx = i
-				}
-			}
+			headers = HeaderIndexMap(items)
 			continue
 		}
-		if (len(items) - 1) < keyIdx {
+		key, ok := headerValue(items, headers, "name")
+		if !ok || !SliceContains(configs, key) {
 			continue
 		}
-		if !SliceContains(configs, items[keyIdx]) {
+		valueStr, ok := headerValue(items, headers, "value")
+		if !ok {
 			continue
 		}
-		value, err := strconv.ParseFloat(items[valueIdx], 64)
+		value, err := strconv.ParseFloat(valueStr, 64)
 		if err != nil {
-			level.Error(logger).Log("msg", fmt.Sprintf("Unable to convert %s to float64", items[valueIdx]), "err", err)
+			level.Error(logger).Log("msg", fmt.Sprintf("Unable to convert %s to float64", valueStr), "err", err)
 			continue
 		}
-		switch items[keyIdx] {
+		switch key {
 		case "pagepool":
 			configMetric.PagePool = value
 		}
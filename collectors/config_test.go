@@ -16,6 +16,7 @@ package collectors
 import (
 	"context"
 	"fmt"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -52,7 +53,7 @@ func TestConfigCollector(t *testing.T) {
 		return configStdout, nil
 	}
 	expected := `
-		# HELP gpfs_config_page_pool_bytes GPFS configured page pool size
+		# HELP gpfs_config_page_pool_bytes GPFS configured page pool size in bytes
 		# TYPE gpfs_config_page_pool_bytes gauge
 		gpfs_config_page_pool_bytes 4294967296
 	`
@@ -60,8 +61,8 @@ func TestConfigCollector(t *testing.T) {
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
-	} else if val != 4 {
-		t.Errorf("Unexpected collection count %d, expected 4", val)
+	} else if val != 13 {
+		t.Errorf("Unexpected collection count %d, expected 13", val)
 	}
 	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_config_page_pool_bytes"); err != nil {
 		t.Errorf("unexpected collecting result:\n%s", err)
@@ -84,8 +85,8 @@ func TestConfigCollectorError(t *testing.T) {
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
-	} else if val != 3 {
-		t.Errorf("Unexpected collection count %d, expected 3", val)
+	} else if val != 12 {
+		t.Errorf("Unexpected collection count %d, expected 12", val)
 	}
 	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collect_error"); err != nil {
 		t.Errorf("unexpected collecting result:\n%s", err)
@@ -108,10 +109,22 @@ func TestConfigCollectorTimeout(t *testing.T) {
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
-	} else if val != 3 {
-		t.Errorf("Unexpected collection count %d, expected 3", val)
+	} else if val != 12 {
+		t.Errorf("Unexpected collection count %d, expected 12", val)
 	}
 	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collect_timeout"); err != nil {
 		t.Errorf("unexpected collecting result:\n%s", err)
 	}
 }
+
+func TestParseMmdiagConfigInsertedColumn(t *testing.T) {
+	var expected, got ConfigMetric
+	parse_mmdiag_config(configStdout, &expected, log.NewNopLogger())
+	if expected.PagePool == 0 {
+		t.Fatal("Expected pagepool to be parsed")
+	}
+	parse_mmdiag_config(insertColumn(configStdout, 7), &got, log.NewNopLogger())
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Unexpected metrics with inserted column\nGot: %v\nExpected: %v", got, expected)
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const deadlockTimeLayout = "2006-01-02_15:04:05-0700"
+
+var (
+	deadlockTimeout = kingpin.Flag("collector.deadlock.timeout", "Timeout for 'mmdiag --deadlock' execution").Default("5").Int()
+)
+
+type DeadlockMetrics struct {
+	Detected     float64
+	LastDetected float64
+	Waiters      float64
+}
+
+type DeadlockCollector struct {
+	Detected     *prometheus.Desc
+	LastDetected *prometheus.Desc
+	Waiters      *prometheus.Desc
+	logger       log.Logger
+}
+
+func init() {
+	registerCollector("deadlock", false, NewDeadlockCollector)
+}
+
+func NewDeadlockCollector(logger log.Logger) Collector {
+	return &DeadlockCollector{
+		Detected: newDesc(prometheus.BuildFQName(namespace, "deadlock", "detected"),
+			"GPFS deadlock detection has found a deadlock on this node", nil, nil),
+		LastDetected: newDesc(prometheus.BuildFQName(namespace, "deadlock", "last_detected_timestamp_seconds"),
+			"GPFS timestamp of the last detected deadlock, 0 if none reported", nil, nil),
+		Waiters: newDesc(prometheus.BuildFQName(namespace, "deadlock", "waiters"),
+			"GPFS count of waiters reported by deadlock detection", nil, nil),
+		logger: logger,
+	}
+}
+
+func (c *DeadlockCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.Detected
+	ch <- c.LastDetected
+	ch <- c.Waiters
+}
+
+func (c *DeadlockCollector) Collect(ch chan<- prometheus.Metric) {
+	level.Debug(c.logger).Log("msg", "Collecting deadlock metrics")
+	collectTime := time.Now()
+	metrics, err := c.collect()
+	if err == context.DeadlineExceeded {
+		level.Error(c.logger).Log("msg", "Timeout executing 'mmdiag --deadlock'")
+	} else if err != nil {
+		level.Error(c.logger).Log("msg", err)
+	}
+	if err == nil {
+		ch <- prometheus.MustNewConstMetric(c.Detected, prometheus.GaugeValue, metrics.Detected)
+		ch <- prometheus.MustNewConstMetric(c.LastDetected, prometheus.GaugeValue, metrics.LastDetected)
+		ch <- prometheus.MustNewConstMetric(c.Waiters, prometheus.GaugeValue, metrics.Waiters)
+	}
+	emitCollectorStatus(ch, "deadlock", err, collectTime, anyRecords)
+}
+
+func (c *DeadlockCollector) collect() (DeadlockMetrics, error) {
+	ctx, cancel := commandContext("deadlock", *deadlockTimeout)
+	defer cancel()
+	out, err := execRetry(ctx, "deadlock", func() (string, error) {
+		return MmdiagExec("--deadlock", ctx)
+	})
+	if err != nil {
+		return DeadlockMetrics{}, err
+	}
+	commandDump.record("mmdiag-deadlock", out)
+	metrics := parse_mmdiag_deadlock(out, c.logger)
+	commandDump.recordParsed("mmdiag-deadlock", metrics)
+	return metrics, nil
+}
+
+// parse_mmdiag_deadlock reads the deadlock section for the detection state and counts the
+// waiters rows. Output without a deadlock section is treated as a deadlock when any waiters
+// are reported, and output with neither returns zeros.
+func parse_mmdiag_deadlock(out string, logger log.Logger) DeadlockMetrics {
+	var metrics DeadlockMetrics
+	foundState := false
+	headers := make(map[string][]string)
+	lines := strings.Split(out, "\n")
+	for _, l := range lines {
+		if !strings.HasPrefix(l, "mmdiag") {
+			continue
+		}
+		items := strings.Split(l, ":")
+		if len(items) < 3 {
+			continue
+		}
+		section := items[1]
+		if items[2] == "HEADER" {
+			headers[section] = items
+			continue
+		}
+		value := func(header string) string {
+			if i := SliceIndex(headers[section], header); i != -1 && i < len(items) {
+				return DecodeGPFSString(items[i])
+			}
+			return ""
+		}
+		switch section {
+		case "deadlock":
+			foundState = true
+			switch strings.ToLower(value("deadlockDetected")) {
+			case "yes", "1", "true":
+				metrics.Detected = 1
+			}
+			lastDetected := value("lastDeadlockTime")
+			if lastDetected == "" || lastDetected == "-" {
+				continue
+			}
+			t, err := time.Parse(deadlockTimeLayout, lastDetected)
+			if err != nil {
+				level.Warn(logger).Log("msg", "Unable to parse last deadlock time", "value", lastDetected, "err", err)
+				parseErrors.WithLabelValues("deadlock").Inc()
+				continue
+			}
+			metrics.LastDetected = float64(t.Unix())
+		case "waiters":
+			metrics.Waiters++
+		}
+	}
+	if !foundState && metrics.Waiters > 0 {
+		metrics.Detected = 1
+	}
+	return metrics
+}
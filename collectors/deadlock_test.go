@@ -0,0 +1,170 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var (
+	deadlockStdout = `
+mmdiag:deadlock:HEADER:version:reserved:reserved:deadlockDetected:lastDeadlockTime:deadlockDetectionThreshold:
+mmdiag:deadlock:0:1:::yes:2021-09-23_15%3A31%3A33-0400:300:
+mmdiag:waiters:HEADER:version:reserved:reserved:threadId:threadAddr:threadName:waitStartTime:waitTime:isMonitored:condVarAddr:condVarName:condVarReason:mutexAddr:mutexName:auxReason:delayTime:delayReason:
+mmdiag:waiters:0:1:::101445:00000000F57FC500:SyncHandlerThread:2021-09-23_15%3A26%3A33-0400:300.4512:monitored::::::on ThCond 0x1802E0B5C68 (LkObjCondvar), reason 'waiting for RO lock':::
+mmdiag:waiters:0:1:::101446:00000000F57FC600:FileBlockWriteFetchHandlerThread:2021-09-23_15%3A26%3A35-0400:298.1022:monitored::::::on ThCond 0x1802E0B5C68 (LkObjCondvar), reason 'waiting for WW lock':::
+`
+	deadlockStdoutNone = `
+mmdiag:deadlock:HEADER:version:reserved:reserved:deadlockDetected:lastDeadlockTime:deadlockDetectionThreshold:
+mmdiag:deadlock:0:1:::no:-:300:
+`
+)
+
+func TestParseMmdiagDeadlock(t *testing.T) {
+	tests := map[string]DeadlockMetrics{
+		deadlockStdout:     {Detected: 1, LastDetected: 1632425493, Waiters: 2},
+		deadlockStdoutNone: {},
+		"":                 {},
+		strings.Replace(deadlockStdout, "mmdiag:deadlock:0:1:::yes:2021-09-23_15%3A31%3A33-0400:300:\n", "", 1): {Detected: 1, Waiters: 2},
+	}
+	for out, expected := range tests {
+		if metrics := parse_mmdiag_deadlock(out, log.NewNopLogger()); metrics != expected {
+			t.Errorf("Unexpected metrics\nGot: %v\nExpected: %v\nOutput: %s", metrics, expected, out)
+		}
+	}
+}
+
+func TestParseMmdiagDeadlockBadTime(t *testing.T) {
+	out := strings.Replace(deadlockStdout, "2021-09-23_15%3A31%3A33-0400:300", "foo:300", 1)
+	before := testutil.ToFloat64(parseErrors.WithLabelValues("deadlock"))
+	metrics := parse_mmdiag_deadlock(out, log.NewNopLogger())
+	if metrics.Detected != 1 || metrics.LastDetected != 0 {
+		t.Errorf("Unexpected metrics, got %v", metrics)
+	}
+	if val := testutil.ToFloat64(parseErrors.WithLabelValues("deadlock")) - before; val != 1 {
+		t.Errorf("Unexpected parse errors, got %v", val)
+	}
+}
+
+func TestDeadlockCollector(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	MmdiagExec = func(arg string, ctx context.Context) (string, error) {
+		return deadlockStdout, nil
+	}
+	expected := `
+		# HELP gpfs_deadlock_detected GPFS deadlock detection has found a deadlock on this node
+		# TYPE gpfs_deadlock_detected gauge
+		gpfs_deadlock_detected 1
+		# HELP gpfs_deadlock_last_detected_timestamp_seconds GPFS timestamp of the last detected deadlock, 0 if none reported
+		# TYPE gpfs_deadlock_last_detected_timestamp_seconds gauge
+		gpfs_deadlock_last_detected_timestamp_seconds 1632425493
+		# HELP gpfs_deadlock_waiters GPFS count of waiters reported by deadlock detection
+		# TYPE gpfs_deadlock_waiters gauge
+		gpfs_deadlock_waiters 2
+	`
+	collector := NewDeadlockCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 15 {
+		t.Errorf("Unexpected collection count %d, expected 15", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
+		"gpfs_deadlock_detected", "gpfs_deadlock_last_detected_timestamp_seconds", "gpfs_deadlock_waiters"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestDeadlockCollectorEmpty(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	MmdiagExec = func(arg string, ctx context.Context) (string, error) {
+		return "", nil
+	}
+	expected := `
+		# HELP gpfs_deadlock_detected GPFS deadlock detection has found a deadlock on this node
+		# TYPE gpfs_deadlock_detected gauge
+		gpfs_deadlock_detected 0
+		# HELP gpfs_deadlock_waiters GPFS count of waiters reported by deadlock detection
+		# TYPE gpfs_deadlock_waiters gauge
+		gpfs_deadlock_waiters 0
+		# HELP gpfs_exporter_collect_success Indicates the collector completed without error or timeout and parsed at least one record
+		# TYPE gpfs_exporter_collect_success gauge
+		gpfs_exporter_collect_success{collector="deadlock"} 1
+	`
+	collector := NewDeadlockCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
+		"gpfs_deadlock_detected", "gpfs_deadlock_waiters", "gpfs_exporter_collect_success"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestDeadlockCollectorError(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	MmdiagExec = func(arg string, ctx context.Context) (string, error) {
+		return "", fmt.Errorf("Error")
+	}
+	expected := `
+		# HELP gpfs_exporter_collect_error Indicates if error has occurred during collection
+		# TYPE gpfs_exporter_collect_error gauge
+		gpfs_exporter_collect_error{collector="deadlock"} 1
+	`
+	collector := NewDeadlockCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 12 {
+		t.Errorf("Unexpected collection count %d, expected 12", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collect_error"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestDeadlockCollectorTimeout(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	MmdiagExec = func(arg string, ctx context.Context) (string, error) {
+		return "", context.DeadlineExceeded
+	}
+	expected := `
+		# HELP gpfs_exporter_collect_timeout Indicates the collector timed out
+		# TYPE gpfs_exporter_collect_timeout gauge
+		gpfs_exporter_collect_timeout{collector="deadlock"} 1
+	`
+	collector := NewDeadlockCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 12 {
+		t.Errorf("Unexpected collection count %d, expected 12", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collect_timeout"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
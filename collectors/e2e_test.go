@@ -0,0 +1,316 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+var (
+	updateGolden = flag.Bool("update", false, "Update the golden metrics.prom files used by TestEndToEnd")
+	// e2eIgnoredMetrics change between runs or depend on the tests that ran before
+	e2eIgnoredMetrics = []string{
+		"gpfs_exporter_collector_duration_seconds",
+		"gpfs_exporter_last_execution_timestamp_seconds",
+		"gpfs_exporter_last_success_timestamp_seconds",
+		"gpfs_exporter_filesystems_added_total",
+		"gpfs_exporter_filesystems_removed_total",
+		"gpfs_exporter_filesystems_changed",
+	}
+)
+
+// TestEndToEnd enables every collector and replays the command output captured in each
+// testdata/e2e/<version> directory, comparing the collected metrics with that directory's
+// metrics.prom. Extra flags for a version, including --no-collector.<name> for commands
+// that version does not have, can be listed one per line in its flags file.
+// Run with -update to rewrite metrics.prom after an intended change.
+func TestEndToEnd(t *testing.T) {
+	dirs, err := filepath.Glob(filepath.Join("testdata", "e2e", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dirs) == 0 {
+		t.Fatal("No fixture directories found in testdata/e2e")
+	}
+	defer func() {
+		_, _ = kingpin.CommandLine.Parse([]string{})
+		resetE2EExecs()
+		procMounts = "/proc/mounts"
+		fstabPath = "/etc/fstab"
+	}()
+	for _, dir := range dirs {
+		version := filepath.Base(dir)
+		t.Run(version, func(t *testing.T) {
+			setE2EExecs(dir)
+			mmlsmgrCache = &MmlsmgrCache{}
+			procMounts = filepath.Join(dir, "mounts")
+			fstabPath = filepath.Join(dir, "fstab")
+			var flags []string
+			if content, err := os.ReadFile(filepath.Join(dir, "flags")); err == nil {
+				flags = strings.Fields(string(content))
+			}
+			var args []string
+			for name := range collectorState {
+				if !SliceContains(flags, "--no-collector."+name) {
+					args = append(args, "--collector."+name)
+				}
+			}
+			args = append(args, flags...)
+			if _, err := kingpin.CommandLine.Parse(args); err != nil {
+				t.Fatal(err)
+			}
+			// The mount collector only uses mmlsfs when another collector has already run it,
+			// so the cache is filled first to not depend on the order collectors run
+			mmlsfsCache = &MmlsfsCache{}
+			_, _ = mmlsfsCache.get(context.Background(), log.NewNopLogger())
+			got, err := gatherE2E()
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkListedMetrics(t, got)
+			golden := filepath.Join(dir, "metrics.prom")
+			if *updateGolden {
+				if err := os.WriteFile(golden, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			expected, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("Unable to read %s, run with -update to create it: %s", golden, err)
+			}
+			if !bytes.Equal(got, expected) {
+				t.Errorf("Metrics for GPFS %s do not match %s, run with -update if the change is intended\n%s",
+					version, golden, diffLines(string(expected), string(got)))
+			}
+		})
+	}
+}
+
+// setE2EExecs points every Exec variable at the command output saved in dir/commands,
+// using the same file names as the commands directory of a diagnostic bundle.
+// A missing file is returned as an error the same as a failed command.
+func setE2EExecs(dir string) {
+	fixture := func(name string) (string, error) {
+		out, err := os.ReadFile(filepath.Join(dir, "commands", name+".txt"))
+		return string(out), err
+	}
+	MmlsfsExec = func(ctx context.Context) (string, error) {
+		return fixture("mmlsfs")
+	}
+	MmdiagExec = func(arg string, ctx context.Context) (string, error) {
+		return fixture("mmdiag-" + strings.TrimLeft(arg, "-"))
+	}
+	MmafmctlExec = func(fs string, ctx context.Context) (string, error) {
+		return fixture("mmafmctl-" + fs)
+	}
+	MmbackupExec = func(fs string, ctx context.Context) (string, error) {
+		return fixture("mmbackup-" + fs)
+	}
+	mmcesExec = func(nodename string, ctx context.Context) (string, error) {
+		return fixture("mmces")
+	}
+	mmcesAddressExec = func(ctx context.Context) (string, error) {
+		return fixture("mmces-address")
+	}
+	MmdfExec = func(fs string, ctx context.Context) (string, error) {
+		return fixture("mmdf-" + fs)
+	}
+	MmgetstateExec = func(ctx context.Context) (string, error) {
+		return fixture("mmgetstate")
+	}
+	mmhealthExec = func(ctx context.Context) (string, error) {
+		return fixture("mmhealth")
+	}
+	MmkeyservClientExec = func(ctx context.Context) (string, error) {
+		return fixture("mmkeyserv-client")
+	}
+	MmkeyservServerExec = func(ctx context.Context) (string, error) {
+		return fixture("mmkeyserv-server")
+	}
+	MmlscallbackExec = func(ctx context.Context) (string, error) {
+		return fixture("mmlscallback")
+	}
+	MmlsconfigExec = func(ctx context.Context) (string, error) {
+		return fixture("mmlsconfig")
+	}
+	MmccrCheckExec = func(ctx context.Context) (string, error) {
+		return fixture("mmccr-check")
+	}
+	MmlsclusterExec = func(ctx context.Context) (string, error) {
+		return fixture("mmlscluster")
+	}
+	MmlsfilesetExec = func(fs string, ctx context.Context) (string, error) {
+		return fixture("mmlsfileset-" + fs)
+	}
+	MmlsfsAllExec = func(ctx context.Context) (string, error) {
+		return fixture("mmlsfs-all")
+	}
+	MmlsmgrExec = func(ctx context.Context) (string, error) {
+		return fixture("mmlsmgr")
+	}
+	MmlsqosExec = func(fs string, ctx context.Context) (string, error) {
+		return fixture("mmlsqos-" + fs)
+	}
+	MmlssnapshotExec = func(fs string, ctx context.Context) (string, error) {
+		return fixture("mmlssnapshot-" + fs)
+	}
+	MmpdiskExec = func(ctx context.Context) (string, error) {
+		return fixture("mmvdisk-pdisk")
+	}
+	MmpmonExec = func(ctx context.Context) (string, error) {
+		return fixture("mmpmon")
+	}
+	mmrepquotaExec = func(ctx context.Context, typeArg string) (string, error) {
+		return fixture("mmrepquota" + typeArg)
+	}
+	MmvdiskExec = func(ctx context.Context) (string, error) {
+		return fixture("mmvdisk-recoverygroup")
+	}
+	MmvdiskDAExec = func(rg string, ctx context.Context) (string, error) {
+		return fixture("mmvdisk-da-" + rg)
+	}
+	QuorumExec = func(ctx context.Context) (string, error) {
+		return fixture("mmgetstate-summary")
+	}
+	verbsExec = func(ctx context.Context) (string, error) {
+		return fixture("verbs")
+	}
+}
+
+// resetE2EExecs points every Exec variable back at the function running the GPFS command
+func resetE2EExecs() {
+	MmlsfsExec = mmlsfs
+	MmdiagExec = mmdiag
+	MmafmctlExec = mmafmctl
+	MmbackupExec = mmbackup
+	mmcesExec = mmces
+	mmcesAddressExec = mmcesAddress
+	MmdfExec = mmdf
+	MmgetstateExec = mmgetstate
+	mmhealthExec = mmhealth
+	MmkeyservClientExec = mmkeyservClient
+	MmkeyservServerExec = mmkeyservServer
+	MmlscallbackExec = mmlscallback
+	MmlsconfigExec = mmlsconfig
+	MmccrCheckExec = mmccrCheck
+	MmlsclusterExec = mmlscluster
+	MmlsfilesetExec = mmlsfileset
+	MmlsfsAllExec = mmlsfsAll
+	MmlsmgrExec = mmlsmgr
+	MmlsqosExec = mmlsqos
+	MmlssnapshotExec = mmlssnapshot
+	MmpdiskExec = mmpdisk
+	MmpmonExec = mmpmon
+	mmrepquotaExec = mmrepquota
+	MmvdiskExec = mmvdisk
+	MmvdiskDAExec = mmvdiskDA
+	QuorumExec = mmgetstateSummary
+	verbsExec = verbs
+}
+
+func gatherE2E() ([]byte, error) {
+	registry := prometheus.NewRegistry()
+	gpfsCollector := NewGPFSCollector(log.NewNopLogger())
+	for _, collector := range gpfsCollector.Collectors {
+		registry.MustRegister(collector)
+	}
+	mfs, err := registry.Gather()
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	for _, mf := range mfs {
+		if SliceContains(e2eIgnoredMetrics, mf.GetName()) {
+			continue
+		}
+		if _, err := expfmt.MetricFamilyToText(&buf, mf); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// checkListedMetrics fails the test for any metric in the scraped metrics that ListMetrics
+// does not list with the same labels
+func checkListedMetrics(t *testing.T, scraped []byte) {
+	listed := make(map[string][][]string)
+	for _, m := range ListMetrics() {
+		labels := append([]string{}, m.Labels...)
+		sort.Strings(labels)
+		listed[m.Name] = append(listed[m.Name], labels)
+	}
+	var parser expfmt.TextParser
+	mfs, err := parser.TextToMetricFamilies(bytes.NewReader(scraped))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, mf := range mfs {
+		if _, ok := listed[name]; !ok {
+			t.Errorf("Metric %s is not listed by ListMetrics", name)
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			var labels []string
+			for _, l := range m.GetLabel() {
+				labels = append(labels, l.GetName())
+			}
+			sort.Strings(labels)
+			found := false
+			for _, l := range listed[name] {
+				if strings.Join(l, ",") == strings.Join(labels, ",") {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("Metric %s with labels %v is not listed by ListMetrics, listed with %v", name, labels, listed[name])
+				break
+			}
+		}
+	}
+}
+
+// diffLines returns the lines only found in expected prefixed with - and
+// the lines only found in got prefixed with +
+func diffLines(expected string, got string) string {
+	expectedLines := strings.Split(expected, "\n")
+	gotLines := strings.Split(got, "\n")
+	var diff []string
+	for _, l := range expectedLines {
+		if !SliceContains(gotLines, l) {
+			diff = append(diff, "-"+l)
+		}
+	}
+	for _, l := range gotLines {
+		if !SliceContains(expectedLines, l) {
+			diff = append(diff, "+"+l)
+		}
+	}
+	sort.SliceStable(diff, func(i, j int) bool {
+		return diff[i][1:] < diff[j][1:]
+	})
+	return strings.Join(diff, "\n")
+}
@@ -0,0 +1,146 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// descMetrics records the name, help and variable labels of every desc created by this package,
+	// which a Desc does not expose. It is keyed by Desc.String so collectors created for each probe
+	// do not add entries.
+	descMetrics = struct {
+		sync.RWMutex
+		metrics map[string]MetricInfo
+	}{metrics: make(map[string]MetricInfo)}
+	// statusDescs are reported for every collector by emitCollectorStatus, the filesystem tracking
+	// and collectors skipped on nodes that are not a manager
+	statusDescs = []*prometheus.Desc{collectDuration, collectError, collecTimeout, collectErrorReason, collectSuccess,
+		lastExecution, lastSuccess, filesystemsAdded, filesystemsRemoved, filesystemsExcluded, filesystemsChanged, collectorSkipped}
+)
+
+// MetricInfo describes a metric the exporter can report. Collector is empty for metrics
+// about the exporter itself, such as the collection status reported for every collector.
+type MetricInfo struct {
+	Name           string   `json:"name"`
+	Help           string   `json:"help"`
+	Labels         []string `json:"labels"`
+	Collector      string   `json:"collector"`
+	DefaultEnabled bool     `json:"default_enabled"`
+}
+
+// ListMetrics returns the metrics described by every registered collector and the exporter
+// metrics of the collectors package, sorted by name and collector. Labels that depend on
+// flags, such as the node label of mmhealth, reflect the current flag values.
+func ListMetrics() []MetricInfo {
+	var metrics []MetricInfo
+	seen := make(map[string]bool)
+	add := func(collector string, defaultEnabled bool, describe func(ch chan<- *prometheus.Desc)) {
+		ch := make(chan *prometheus.Desc)
+		go func() {
+			describe(ch)
+			close(ch)
+		}()
+		for desc := range ch {
+			info, ok := describeDesc(desc)
+			if !ok || seen[collector+"/"+info.Name] {
+				continue
+			}
+			seen[collector+"/"+info.Name] = true
+			info.Collector = collector
+			info.DefaultEnabled = defaultEnabled
+			metrics = append(metrics, info)
+		}
+	}
+	for name, factory := range factories {
+		add(name, collectorDefaults[name], factory(log.NewNopLogger()).Describe)
+	}
+	add("", true, func(ch chan<- *prometheus.Desc) {
+		for _, desc := range statusDescs {
+			ch <- desc
+		}
+		for _, c := range CommandMetrics {
+			c.Describe(ch)
+		}
+		CollectorDurationHistogram.Describe(ch)
+		EnabledCollectorsMetrics.Describe(ch)
+	})
+	sort.Slice(metrics, func(i, j int) bool {
+		if metrics[i].Name != metrics[j].Name {
+			return metrics[i].Name < metrics[j].Name
+		}
+		return metrics[i].Collector < metrics[j].Collector
+	})
+	return metrics
+}
+
+// newDesc is prometheus.NewDesc that records the metric for ListMetrics and logging
+func newDesc(fqName, help string, variableLabels []string, constLabels prometheus.Labels) *prometheus.Desc {
+	desc := prometheus.NewDesc(fqName, help, variableLabels, constLabels)
+	recordDesc(desc, fqName, help, variableLabels)
+	return desc
+}
+
+func newCounterVec(opts prometheus.CounterOpts, labels []string) *prometheus.CounterVec {
+	c := prometheus.NewCounterVec(opts, labels)
+	recordCollector(c, prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name), opts.Help, labels)
+	return c
+}
+
+func newGaugeVec(opts prometheus.GaugeOpts, labels []string) *prometheus.GaugeVec {
+	c := prometheus.NewGaugeVec(opts, labels)
+	recordCollector(c, prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name), opts.Help, labels)
+	return c
+}
+
+func newHistogramVec(opts prometheus.HistogramOpts, labels []string) *prometheus.HistogramVec {
+	c := prometheus.NewHistogramVec(opts, labels)
+	recordCollector(c, prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name), opts.Help, labels)
+	return c
+}
+
+func newHistogram(opts prometheus.HistogramOpts) prometheus.Histogram {
+	c := prometheus.NewHistogram(opts)
+	recordCollector(c, prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name), opts.Help, nil)
+	return c
+}
+
+// recordCollector records the single desc described by c
+func recordCollector(c prometheus.Collector, name, help string, labels []string) {
+	ch := make(chan *prometheus.Desc, 1)
+	c.Describe(ch)
+	close(ch)
+	recordDesc(<-ch, name, help, labels)
+}
+
+func recordDesc(desc *prometheus.Desc, name, help string, labels []string) {
+	info := MetricInfo{Name: name, Help: help, Labels: append([]string{}, labels...)}
+	key := desc.String()
+	descMetrics.Lock()
+	defer descMetrics.Unlock()
+	descMetrics.metrics[key] = info
+}
+
+// describeDesc returns the name, help and variable labels recorded when desc was created
+func describeDesc(desc *prometheus.Desc) (MetricInfo, bool) {
+	descMetrics.RLock()
+	defer descMetrics.RUnlock()
+	info, ok := descMetrics.metrics[desc.String()]
+	return info, ok
+}
@@ -0,0 +1,107 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestListMetrics(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	metrics := ListMetrics()
+	if !sort.SliceIsSorted(metrics, func(i, j int) bool { return metrics[i].Name < metrics[j].Name }) {
+		t.Errorf("Metrics are not sorted by name")
+	}
+	find := func(name string) *MetricInfo {
+		for i := range metrics {
+			if metrics[i].Name == name {
+				return &metrics[i]
+			}
+		}
+		return nil
+	}
+	expected := []MetricInfo{
+		{Name: "gpfs_qos_iops", Help: "GPFS performance of the class in I/O operations per second",
+			Labels: []string{"fs", "remote_cluster", "pool", "class"}, Collector: "mmlsqos", DefaultEnabled: false},
+		{Name: "gpfs_state", Help: "GPFS state",
+			Labels: []string{"state"}, Collector: "mmgetstate", DefaultEnabled: true},
+		{Name: "gpfs_exporter_collect_error", Help: "Indicates if error has occurred during collection",
+			Labels: []string{"collector"}, Collector: "", DefaultEnabled: true},
+		{Name: "gpfs_exporter_command_failures_total", Help: "Number of failed GPFS command executions",
+			Labels: []string{"command", "reason"}, Collector: "", DefaultEnabled: true},
+	}
+	for _, e := range expected {
+		m := find(e.Name)
+		if m == nil {
+			t.Errorf("Metric %s not listed", e.Name)
+			continue
+		}
+		if !reflect.DeepEqual(*m, e) {
+			t.Errorf("Unexpected metric info\nExpected: %+v\nGot: %+v", e, *m)
+		}
+	}
+	for collector := range factories {
+		found := false
+		for _, m := range metrics {
+			if m.Collector == collector {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("No metrics listed for collector %s", collector)
+		}
+	}
+}
+
+func TestDescribeDesc(t *testing.T) {
+	desc := newDesc("gpfs_test", `Help with "quotes", and commas`, []string{"fs", "pool"}, prometheus.Labels{"cluster": "test"})
+	info, ok := describeDesc(desc)
+	if !ok {
+		t.Fatalf("No metric recorded for %s", desc.String())
+	}
+	expected := MetricInfo{Name: "gpfs_test", Help: `Help with "quotes", and commas`, Labels: []string{"fs", "pool"}}
+	if !reflect.DeepEqual(info, expected) {
+		t.Errorf("Unexpected metric info\nExpected: %+v\nGot: %+v", expected, info)
+	}
+	if _, ok := describeDesc(prometheus.NewDesc("gpfs_test_unrecorded", "Help", nil, nil)); ok {
+		t.Errorf("Unexpected metric info for desc not created by newDesc")
+	}
+}
+
+func TestDescribeDescCollectors(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	for name, factory := range factories {
+		ch := make(chan *prometheus.Desc)
+		go func() {
+			factory(log.NewNopLogger()).Describe(ch)
+			close(ch)
+		}()
+		for desc := range ch {
+			if _, ok := describeDesc(desc); !ok {
+				t.Errorf("Collector %s describes %s that was not created by newDesc", name, desc.String())
+			}
+		}
+	}
+}
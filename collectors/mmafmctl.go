@@ -0,0 +1,186 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	afmFilesystems = kingpin.Flag("collector.mmafmctl.filesystems", "Filesystems to query with mmafmctl, comma separated. Defaults to all filesystems.").Default("").String()
+	afmTimeout     = kingpin.Flag("collector.mmafmctl.timeout", "Timeout for mmafmctl execution").Default("60").Int()
+	afmMap         = map[string]string{
+		"filesetName":  "Fileset",
+		"cacheState":   "CacheState",
+		"queueLength":  "QueueLength",
+		"queueNumExec": "QueueNumExec",
+	}
+	MmafmctlExec = mmafmctl
+)
+
+type AFMMetric struct {
+	Fileset      string
+	CacheState   string
+	QueueLength  float64
+	QueueNumExec float64
+}
+
+type MmafmctlCollector struct {
+	filesystemOverride
+	QueueLength  *prometheus.Desc
+	QueueNumExec *prometheus.Desc
+	CacheState   *prometheus.Desc
+	logger       log.Logger
+}
+
+func init() {
+	registerCollector("mmafmctl", false, NewMmafmctlCollector)
+}
+
+func NewMmafmctlCollector(logger log.Logger) Collector {
+	labels := []string{"fs", "remote_cluster", "fileset"}
+	return &MmafmctlCollector{
+		QueueLength: newDesc(prometheus.BuildFQName(namespace, "afm", "queue_length"),
+			"GPFS AFM gateway queue length", labels, nil),
+		QueueNumExec: newDesc(prometheus.BuildFQName(namespace, "afm", "queue_executed"),
+			"GPFS AFM gateway queue executed operations", labels, nil),
+		CacheState: newDesc(prometheus.BuildFQName(namespace, "afm", "cache_state_info"),
+			"GPFS AFM cache state", append(labels, []string{"state"}...), nil),
+		logger: logger,
+	}
+}
+
+func (c *MmafmctlCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.QueueLength
+	ch <- c.QueueNumExec
+	ch <- c.CacheState
+}
+
+func (c *MmafmctlCollector) Collect(ch chan<- prometheus.Metric) {
+	wg := &sync.WaitGroup{}
+	filesystems := c.getFilesystems(*afmFilesystems, "mmafmctl", ch, c.logger)
+	for _, fs := range filesystems {
+		level.Debug(c.logger).Log("msg", "Collecting mmafmctl metrics", "fs", fs)
+		wg.Add(1)
+		collectTime := time.Now()
+		go func(fs string) {
+			defer wg.Done()
+			label := fmt.Sprintf("mmafmctl-%s", fs)
+			fsName, remoteCluster := splitFilesystem(fs)
+			defer recoverCollectorPanic(ch, label, collectTime, c.logger)
+			metrics, err := c.mmafmctlCollect(fs)
+			if err == context.DeadlineExceeded {
+				level.Error(c.logger).Log("msg", fmt.Sprintf("Timeout executing %s", label))
+			} else if err != nil {
+				level.Error(c.logger).Log("msg", err, "fs", fs)
+			}
+			if err == nil {
+				for _, m := range metrics {
+					ch <- prometheus.MustNewConstMetric(c.QueueLength, prometheus.GaugeValue, m.QueueLength, fsName, remoteCluster, m.Fileset)
+					ch <- prometheus.MustNewConstMetric(c.QueueNumExec, prometheus.GaugeValue, m.QueueNumExec, fsName, remoteCluster, m.Fileset)
+					ch <- prometheus.MustNewConstMetric(c.CacheState, prometheus.GaugeValue, 1, fsName, remoteCluster, m.Fileset, m.CacheState)
+				}
+			}
+			emitCollectorStatus(ch, label, err, collectTime, anyRecords)
+		}(fs)
+	}
+	wg.Wait()
+}
+
+func (c *MmafmctlCollector) mmafmctlCollect(fs string) ([]AFMMetric, error) {
+	ctx, cancel := commandContext("mmafmctl", *afmTimeout)
+	defer cancel()
+	out, err := execRetry(ctx, "mmafmctl", func() (string, error) {
+		return MmafmctlExec(fs, ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	commandDump.record(fmt.Sprintf("mmafmctl-%s", fs), out)
+	metrics := parse_mmafmctl(out, c.logger)
+	commandDump.recordParsed(fmt.Sprintf("mmafmctl-%s", fs), metrics)
+	return metrics, nil
+}
+
+func mmafmctl(fs string, ctx context.Context) (string, error) {
+	return RunMMCommand(ctx, "mmafmctl", fs, "getstate", "-Y")
+}
+
+func parse_mmafmctl(out string, logger log.Logger) []AFMMetric {
+	var metrics []AFMMetric
+	var headers []string
+	lines := strings.Split(out, "\n")
+	for _, l := range lines {
+		if !strings.HasPrefix(l, "mmafmctl") {
+			continue
+		}
+		items := strings.Split(l, ":")
+		if len(items) < 3 {
+			continue
+		}
+		if items[2] == "HEADER" {
+			headers = items
+			continue
+		}
+		var metric AFMMetric
+		var rowErr error
+		ps := reflect.ValueOf(&metric) // pointer to struct - addressable
+		s := ps.Elem()                 // struct
+		for i, h := range headers {
+			if i >= len(items) {
+				break
+			}
+			field, ok := afmMap[h]
+			if !ok {
+				continue
+			}
+			f := s.FieldByName(field)
+			if f.Kind() == reflect.String {
+				f.SetString(DecodeGPFSString(items[i]))
+			} else if f.Kind() == reflect.Float64 {
+				// Queue values are not reported for filesets without an active gateway queue
+				if items[i] == "-" || items[i] == "" {
+					continue
+				}
+				val, err := strconv.ParseFloat(items[i], 64)
+				if err != nil {
+					rowErr = fmt.Errorf("Error parsing %s value %s: %w", h, items[i], err)
+					break
+				}
+				f.SetFloat(val)
+			}
+		}
+		if rowErr != nil {
+			level.Warn(logger).Log("msg", "Skipping AFM fileset with unparsable values", "fileset", metric.Fileset, "err", rowErr)
+			parseErrors.WithLabelValues("mmafmctl").Inc()
+			continue
+		}
+		if metric.Fileset == "" {
+			continue
+		}
+		metrics = append(metrics, metric)
+	}
+	return metrics
+}
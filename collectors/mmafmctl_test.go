@@ -0,0 +1,220 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var (
+	mmafmctlStdout = `
+mmafmctl::HEADER:version:reserved:reserved:filesetName:filesetTarget:cacheState:gatewayNode:queueLength:queueNumExec:
+mmafmctl::0:1:::cache1:nfs%3A%2F%2Fhome%2Fcache1:Active:gw01:12:345678:
+mmafmctl::0:1:::cache2:nfs%3A%2F%2Fhome%2Fcache2:NeedsRecovery:gw02:0:1024:
+mmafmctl::0:1:::cache3:nfs%3A%2F%2Fhome%2Fcache3:Unmounted:-:-:-:
+`
+	mmafmctlStdoutBadValue = `
+mmafmctl::HEADER:version:reserved:reserved:filesetName:filesetTarget:cacheState:gatewayNode:queueLength:queueNumExec:
+mmafmctl::0:1:::cache1:nfs%3A%2F%2Fhome%2Fcache1:Active:gw01:foo:345678:
+mmafmctl::0:1:::cache2:nfs%3A%2F%2Fhome%2Fcache2:NeedsRecovery:gw02:0:1024:
+`
+)
+
+func TestMmafmctl(t *testing.T) {
+	execCommand = fakeExecCommand
+	mockedExitStatus = 0
+	mockedStdout = "foo"
+	defer func() { execCommand = exec.CommandContext }()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out, err := mmafmctl("test", ctx)
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+	if out != mockedStdout {
+		t.Errorf("Unexpected out: %s", out)
+	}
+}
+
+func TestMmafmctlError(t *testing.T) {
+	execCommand = fakeExecCommand
+	mockedExitStatus = 1
+	mockedStdout = "foo"
+	defer func() { execCommand = exec.CommandContext }()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out, err := mmafmctl("test", ctx)
+	if err == nil {
+		t.Errorf("Expected error")
+	}
+	if out != "" {
+		t.Errorf("Unexpected out: %s", out)
+	}
+}
+
+func TestMmafmctlTimeout(t *testing.T) {
+	execCommand = fakeExecCommand
+	mockedExitStatus = 1
+	mockedStdout = "foo"
+	defer func() { execCommand = exec.CommandContext }()
+	ctx, cancel := context.WithTimeout(context.Background(), 0*time.Second)
+	defer cancel()
+	out, err := mmafmctl("test", ctx)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected DeadlineExceeded")
+	}
+	if out != "" {
+		t.Errorf("Unexpected out: %s", out)
+	}
+}
+
+func TestParseMmafmctl(t *testing.T) {
+	metrics := parse_mmafmctl(mmafmctlStdout, log.NewNopLogger())
+	if len(metrics) != 3 {
+		t.Errorf("Unexpected number of metrics, got %d", len(metrics))
+		return
+	}
+	if metrics[0].Fileset != "cache1" {
+		t.Errorf("Unexpected value for Fileset, got %v", metrics[0].Fileset)
+	}
+	if metrics[0].CacheState != "Active" {
+		t.Errorf("Unexpected value for CacheState, got %v", metrics[0].CacheState)
+	}
+	if metrics[0].QueueLength != 12 {
+		t.Errorf("Unexpected value for QueueLength, got %v", metrics[0].QueueLength)
+	}
+	if metrics[0].QueueNumExec != 345678 {
+		t.Errorf("Unexpected value for QueueNumExec, got %v", metrics[0].QueueNumExec)
+	}
+	if metrics[2].CacheState != "Unmounted" || metrics[2].QueueLength != 0 {
+		t.Errorf("Unexpected values for cache3, got %+v", metrics[2])
+	}
+}
+
+func TestParseMmafmctlErrors(t *testing.T) {
+	before := testutil.ToFloat64(parseErrors.WithLabelValues("mmafmctl"))
+	metrics := parse_mmafmctl(mmafmctlStdoutBadValue, log.NewNopLogger())
+	if len(metrics) != 1 {
+		t.Errorf("Unexpected number of metrics, got %d", len(metrics))
+		return
+	}
+	if metrics[0].Fileset != "cache2" {
+		t.Errorf("Unexpected value for Fileset, got %v", metrics[0].Fileset)
+	}
+	if val := testutil.ToFloat64(parseErrors.WithLabelValues("mmafmctl")) - before; val != 1 {
+		t.Errorf("Unexpected parse errors, got %v", val)
+	}
+}
+
+func TestMmafmctlCollector(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	filesystems := "project"
+	afmFilesystems = &filesystems
+	MmafmctlExec = func(fs string, ctx context.Context) (string, error) {
+		return mmafmctlStdout, nil
+	}
+	expected := `
+		# HELP gpfs_afm_cache_state_info GPFS AFM cache state
+		# TYPE gpfs_afm_cache_state_info gauge
+		gpfs_afm_cache_state_info{fileset="cache1",fs="project",remote_cluster="",state="Active"} 1
+		gpfs_afm_cache_state_info{fileset="cache2",fs="project",remote_cluster="",state="NeedsRecovery"} 1
+		gpfs_afm_cache_state_info{fileset="cache3",fs="project",remote_cluster="",state="Unmounted"} 1
+		# HELP gpfs_afm_queue_executed GPFS AFM gateway queue executed operations
+		# TYPE gpfs_afm_queue_executed gauge
+		gpfs_afm_queue_executed{fileset="cache1",fs="project",remote_cluster=""} 345678
+		gpfs_afm_queue_executed{fileset="cache2",fs="project",remote_cluster=""} 1024
+		gpfs_afm_queue_executed{fileset="cache3",fs="project",remote_cluster=""} 0
+		# HELP gpfs_afm_queue_length GPFS AFM gateway queue length
+		# TYPE gpfs_afm_queue_length gauge
+		gpfs_afm_queue_length{fileset="cache1",fs="project",remote_cluster=""} 12
+		gpfs_afm_queue_length{fileset="cache2",fs="project",remote_cluster=""} 0
+		gpfs_afm_queue_length{fileset="cache3",fs="project",remote_cluster=""} 0
+	`
+	collector := NewMmafmctlCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 24 {
+		t.Errorf("Unexpected collection count %d, expected 24", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
+		"gpfs_afm_cache_state_info", "gpfs_afm_queue_executed", "gpfs_afm_queue_length"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestMmafmctlCollectorError(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	filesystems := "project"
+	afmFilesystems = &filesystems
+	MmafmctlExec = func(fs string, ctx context.Context) (string, error) {
+		return "", fmt.Errorf("Error")
+	}
+	expected := `
+		# HELP gpfs_exporter_collect_error Indicates if error has occurred during collection
+		# TYPE gpfs_exporter_collect_error gauge
+		gpfs_exporter_collect_error{collector="mmafmctl-project"} 1
+	`
+	collector := NewMmafmctlCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 15 {
+		t.Errorf("Unexpected collection count %d, expected 15", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
+		"gpfs_exporter_collect_error", "gpfs_afm_queue_length"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestMmafmctlCollectorTimeout(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	filesystems := "project"
+	afmFilesystems = &filesystems
+	MmafmctlExec = func(fs string, ctx context.Context) (string, error) {
+		return "", context.DeadlineExceeded
+	}
+	expected := `
+		# HELP gpfs_exporter_collect_timeout Indicates the collector timed out
+		# TYPE gpfs_exporter_collect_timeout gauge
+		gpfs_exporter_collect_timeout{collector="mmafmctl-project"} 1
+	`
+	collector := NewMmafmctlCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 15 {
+		t.Errorf("Unexpected collection count %d, expected 15", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
+		"gpfs_exporter_collect_timeout", "gpfs_afm_queue_length"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	mmbackupFilesystems = kingpin.Flag("collector.mmbackup.filesystems", "Filesystems to query with mmbackup, comma separated. Defaults to all filesystems.").Default("").String()
+	mmbackupTimeout     = kingpin.Flag("collector.mmbackup.timeout", "Timeout for mmbackup execution").Default("120").Int()
+	mmbackupStatuses    = []string{"success", "warning", "failed", "running"}
+	mmbackupMap         = map[string]string{
+		"filesystemName": "FS",
+		"lastBackupTime": "LastRun",
+		"status":         "Status",
+		"filesBackedUp":  "FilesBackedUp",
+		"filesFailed":    "FilesFailed",
+	}
+	MmbackupExec = mmbackup
+)
+
+type BackupMetric struct {
+	FS            string
+	LastRun       float64
+	Status        string
+	FilesBackedUp float64
+	FilesFailed   float64
+}
+
+type MmbackupCollector struct {
+	filesystemOverride
+	LastRun       *prometheus.Desc
+	FilesBackedUp *prometheus.Desc
+	FilesFailed   *prometheus.Desc
+	Status        *prometheus.Desc
+	logger        log.Logger
+}
+
+func init() {
+	registerCollector("mmbackup", false, NewMmbackupCollector)
+}
+
+func NewMmbackupCollector(logger log.Logger) Collector {
+	labels := []string{"fs", "remote_cluster"}
+	return &MmbackupCollector{
+		LastRun: newDesc(prometheus.BuildFQName(namespace, "mmbackup", "last_run_timestamp_seconds"),
+			"GPFS mmbackup last run timestamp", labels, nil),
+		FilesBackedUp: newDesc(prometheus.BuildFQName(namespace, "mmbackup", "files_backed_up"),
+			"GPFS mmbackup files backed up during last run", labels, nil),
+		FilesFailed: newDesc(prometheus.BuildFQName(namespace, "mmbackup", "files_failed"),
+			"GPFS mmbackup files failed during last run", labels, nil),
+		Status: newDesc(prometheus.BuildFQName(namespace, "mmbackup", "status"),
+			"GPFS mmbackup status of last run", []string{"fs", "remote_cluster", "status"}, nil),
+		logger: logger,
+	}
+}
+
+func (c *MmbackupCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.LastRun
+	ch <- c.FilesBackedUp
+	ch <- c.FilesFailed
+	ch <- c.Status
+}
+
+func (c *MmbackupCollector) Collect(ch chan<- prometheus.Metric) {
+	wg := &sync.WaitGroup{}
+	filesystems := c.getFilesystems(*mmbackupFilesystems, "mmbackup", ch, c.logger)
+	for _, fs := range filesystems {
+		level.Debug(c.logger).Log("msg", "Collecting mmbackup metrics", "fs", fs)
+		wg.Add(1)
+		collectTime := time.Now()
+		go func(fs string) {
+			defer wg.Done()
+			label := fmt.Sprintf("mmbackup-%s", fs)
+			fsName, remoteCluster := splitFilesystem(fs)
+			defer recoverCollectorPanic(ch, label, collectTime, c.logger)
+			metric, err := c.mmbackupCollect(fs)
+			if err == context.DeadlineExceeded {
+				level.Error(c.logger).Log("msg", fmt.Sprintf("Timeout executing %s", label))
+			} else if err != nil {
+				level.Error(c.logger).Log("msg", err, "fs", fs)
+			}
+			if err == nil {
+				ch <- prometheus.MustNewConstMetric(c.LastRun, prometheus.GaugeValue, metric.LastRun, fsName, remoteCluster)
+				ch <- prometheus.MustNewConstMetric(c.FilesBackedUp, prometheus.GaugeValue, metric.FilesBackedUp, fsName, remoteCluster)
+				ch <- prometheus.MustNewConstMetric(c.FilesFailed, prometheus.GaugeValue, metric.FilesFailed, fsName, remoteCluster)
+				for _, s := range mmbackupStatuses {
+					var value float64
+					if s == metric.Status {
+						value = 1
+					}
+					ch <- prometheus.MustNewConstMetric(c.Status, prometheus.GaugeValue, value, fsName, remoteCluster, s)
+				}
+				var unknown float64
+				if !SliceContains(mmbackupStatuses, metric.Status) {
+					unknown = 1
+					level.Warn(c.logger).Log("msg", "Unknown status encountered", "status", metric.Status, "fs", fs)
+				}
+				ch <- prometheus.MustNewConstMetric(c.Status, prometheus.GaugeValue, unknown, fsName, remoteCluster, "unknown")
+			}
+			emitCollectorStatus(ch, label, err, collectTime, recordCount(metric.Status != ""))
+		}(fs)
+	}
+	wg.Wait()
+}
+
+func (c *MmbackupCollector) mmbackupCollect(fs string) (BackupMetric, error) {
+	ctx, cancel := commandContext("mmbackup", *mmbackupTimeout)
+	defer cancel()
+	out, err := execRetry(ctx, "mmbackup", func() (string, error) {
+		return MmbackupExec(fs, ctx)
+	})
+	if err != nil {
+		return BackupMetric{}, err
+	}
+	commandDump.record(fmt.Sprintf("mmbackup-%s", fs), out)
+	metric, err := parse_mmbackup(out, c.logger)
+	commandDump.recordParsed(fmt.Sprintf("mmbackup-%s", fs), metric)
+	return metric, err
+}
+
+func mmbackup(fs string, ctx context.Context) (string, error) {
+	return RunMMCommand(ctx, "mmbackup", fs, "-q", "-Y")
+}
+
+func parse_mmbackup(out string, logger log.Logger) (BackupMetric, error) {
+	var metric BackupMetric
+	var headers []string
+	lines := strings.Split(out, "\n")
+	for _, l := range lines {
+		if !strings.HasPrefix(l, "mmbackup") {
+			continue
+		}
+		items := strings.Split(l, ":")
+		if len(items) < 3 {
+			continue
+		}
+		if items[2] == "HEADER" {
+			headers = items
+			continue
+		}
+		ps := reflect.ValueOf(&metric) // pointer to struct - addressable
+		s := ps.Elem()                 // struct
+		for i, h := range headers {
+			if i >= len(items) {
+				break
+			}
+			field, ok := mmbackupMap[h]
+			if !ok {
+				continue
+			}
+			f := s.FieldByName(field)
+			if h == "status" {
+				f.SetString(strings.ToLower(items[i]))
+			} else if f.Kind() == reflect.String {
+				f.SetString(DecodeGPFSString(items[i]))
+			} else if f.Kind() == reflect.Float64 {
+				if h == "lastBackupTime" {
+					lastStr := DecodeGPFSString(items[i])
+					lastTime, err := parseGPFSTime(lastStr)
+					if err != nil {
+						level.Error(logger).Log("msg", "Unable to parse time", "value", lastStr)
+						return BackupMetric{}, err
+					}
+					f.SetFloat(float64(lastTime.Unix()))
+					continue
+				}
+				if val, err := strconv.ParseFloat(items[i], 64); err == nil {
+					f.SetFloat(val)
+				} else {
+					level.Error(logger).Log("msg", fmt.Sprintf("Error parsing %s value %s: %s", h, items[i], err.Error()))
+					return BackupMetric{}, err
+				}
+			}
+		}
+	}
+	if metric.FS == "" {
+		return BackupMetric{}, fmt.Errorf("No mmbackup status found")
+	}
+	return metric, nil
+}
@@ -0,0 +1,220 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var (
+	mmbackupStdout = `
+mmbackup:query:HEADER:version:reserved:reserved:filesystemName:server:lastBackupTime:status:filesBackedUp:filesFailed:
+mmbackup:query:0:1:::project:TSM1:Wed Jan 20 00%3A30%3A02 2021:Success:123456:3:
+`
+	mmbackupStdoutBadTime = `
+mmbackup:query:HEADER:version:reserved:reserved:filesystemName:server:lastBackupTime:status:filesBackedUp:filesFailed:
+mmbackup:query:0:1:::project:TSM1:Wed Jan 20 foo:Success:123456:3:
+`
+	mmbackupStdoutBadValue = `
+mmbackup:query:HEADER:version:reserved:reserved:filesystemName:server:lastBackupTime:status:filesBackedUp:filesFailed:
+mmbackup:query:0:1:::project:TSM1:Wed Jan 20 00%3A30%3A02 2021:Success:foo:3:
+`
+)
+
+func TestMmbackup(t *testing.T) {
+	execCommand = fakeExecCommand
+	mockedExitStatus = 0
+	mockedStdout = "foo"
+	defer func() { execCommand = exec.CommandContext }()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out, err := mmbackup("test", ctx)
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+	if out != mockedStdout {
+		t.Errorf("Unexpected out: %s", out)
+	}
+}
+
+func TestMmbackupError(t *testing.T) {
+	execCommand = fakeExecCommand
+	mockedExitStatus = 1
+	mockedStdout = "foo"
+	defer func() { execCommand = exec.CommandContext }()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out, err := mmbackup("test", ctx)
+	if err == nil {
+		t.Errorf("Expected error")
+	}
+	if out != "" {
+		t.Errorf("Unexpected out: %s", out)
+	}
+}
+
+func TestMmbackupTimeout(t *testing.T) {
+	execCommand = fakeExecCommand
+	mockedExitStatus = 1
+	mockedStdout = "foo"
+	defer func() { execCommand = exec.CommandContext }()
+	ctx, cancel := context.WithTimeout(context.Background(), 0*time.Second)
+	defer cancel()
+	out, err := mmbackup("test", ctx)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected DeadlineExceeded")
+	}
+	if out != "" {
+		t.Errorf("Unexpected out: %s", out)
+	}
+}
+
+func TestParseMmbackup(t *testing.T) {
+	metric, err := parse_mmbackup(mmbackupStdout, log.NewNopLogger())
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+		return
+	}
+	if metric.FS != "project" {
+		t.Errorf("Unexpected value for FS, got %v", metric.FS)
+	}
+	if metric.LastRun != 1611120602 {
+		t.Errorf("Unexpected value for LastRun, got %v", metric.LastRun)
+	}
+	if metric.Status != "success" {
+		t.Errorf("Unexpected value for Status, got %v", metric.Status)
+	}
+	if metric.FilesBackedUp != 123456 {
+		t.Errorf("Unexpected value for FilesBackedUp, got %v", metric.FilesBackedUp)
+	}
+	if metric.FilesFailed != 3 {
+		t.Errorf("Unexpected value for FilesFailed, got %v", metric.FilesFailed)
+	}
+}
+
+func TestParseMmbackupErrors(t *testing.T) {
+	if _, err := parse_mmbackup(mmbackupStdoutBadTime, log.NewNopLogger()); err == nil {
+		t.Errorf("Expected error")
+	}
+	if _, err := parse_mmbackup(mmbackupStdoutBadValue, log.NewNopLogger()); err == nil {
+		t.Errorf("Expected error")
+	}
+	if _, err := parse_mmbackup("", log.NewNopLogger()); err == nil {
+		t.Errorf("Expected error")
+	}
+}
+
+func TestMmbackupCollector(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	filesystems := "project"
+	mmbackupFilesystems = &filesystems
+	MmbackupExec = func(fs string, ctx context.Context) (string, error) {
+		return mmbackupStdout, nil
+	}
+	expected := `
+		# HELP gpfs_mmbackup_files_backed_up GPFS mmbackup files backed up during last run
+		# TYPE gpfs_mmbackup_files_backed_up gauge
+		gpfs_mmbackup_files_backed_up{fs="project",remote_cluster=""} 123456
+		# HELP gpfs_mmbackup_files_failed GPFS mmbackup files failed during last run
+		# TYPE gpfs_mmbackup_files_failed gauge
+		gpfs_mmbackup_files_failed{fs="project",remote_cluster=""} 3
+		# HELP gpfs_mmbackup_last_run_timestamp_seconds GPFS mmbackup last run timestamp
+		# TYPE gpfs_mmbackup_last_run_timestamp_seconds gauge
+		gpfs_mmbackup_last_run_timestamp_seconds{fs="project",remote_cluster=""} 1611120602
+		# HELP gpfs_mmbackup_status GPFS mmbackup status of last run
+		# TYPE gpfs_mmbackup_status gauge
+		gpfs_mmbackup_status{fs="project",remote_cluster="",status="failed"} 0
+		gpfs_mmbackup_status{fs="project",remote_cluster="",status="running"} 0
+		gpfs_mmbackup_status{fs="project",remote_cluster="",status="success"} 1
+		gpfs_mmbackup_status{fs="project",remote_cluster="",status="unknown"} 0
+		gpfs_mmbackup_status{fs="project",remote_cluster="",status="warning"} 0
+	`
+	collector := NewMmbackupCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 23 {
+		t.Errorf("Unexpected collection count %d, expected 23", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
+		"gpfs_mmbackup_files_backed_up", "gpfs_mmbackup_files_failed",
+		"gpfs_mmbackup_last_run_timestamp_seconds", "gpfs_mmbackup_status"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestMmbackupCollectorError(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	filesystems := "project"
+	mmbackupFilesystems = &filesystems
+	MmbackupExec = func(fs string, ctx context.Context) (string, error) {
+		return "", fmt.Errorf("Error")
+	}
+	expected := `
+		# HELP gpfs_exporter_collect_error Indicates if error has occurred during collection
+		# TYPE gpfs_exporter_collect_error gauge
+		gpfs_exporter_collect_error{collector="mmbackup-project"} 1
+	`
+	collector := NewMmbackupCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 15 {
+		t.Errorf("Unexpected collection count %d, expected 15", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
+		"gpfs_exporter_collect_error", "gpfs_mmbackup_status"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestMmbackupCollectorTimeout(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	filesystems := "project"
+	mmbackupFilesystems = &filesystems
+	MmbackupExec = func(fs string, ctx context.Context) (string, error) {
+		return "", context.DeadlineExceeded
+	}
+	expected := `
+		# HELP gpfs_exporter_collect_timeout Indicates the collector timed out
+		# TYPE gpfs_exporter_collect_timeout gauge
+		gpfs_exporter_collect_timeout{collector="mmbackup-project"} 1
+	`
+	collector := NewMmbackupCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 15 {
+		t.Errorf("Unexpected collection count %d, expected 15", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
+		"gpfs_exporter_collect_timeout", "gpfs_mmbackup_status"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	mmccrTimeout   = kingpin.Flag("collector.mmccr.timeout", "Timeout for executing mmccr check").Default("10").Int()
+	ccrStatuses    = []string{"OK", "WARNING", "FATAL"}
+	MmccrCheckExec = mmccrCheck
+)
+
+// CCRCheck is the severity of a check of the cluster configuration repository
+type CCRCheck struct {
+	Check    string
+	Severity string
+}
+
+type MmccrCollector struct {
+	CheckStatus *prometheus.Desc
+	Healthy     *prometheus.Desc
+	logger      log.Logger
+}
+
+func init() {
+	registerCollector("mmccr", false, NewMmccrCollector)
+}
+
+func NewMmccrCollector(logger log.Logger) Collector {
+	return &MmccrCollector{
+		CheckStatus: newDesc(prometheus.BuildFQName(namespace, "ccr", "check_status"),
+			"GPFS cluster configuration repository check status", []string{"check", "status"}, nil),
+		Healthy: newDesc(prometheus.BuildFQName(namespace, "ccr", "healthy"),
+			"GPFS cluster configuration repository checks are all OK", nil, nil),
+		logger: logger,
+	}
+}
+
+func (c *MmccrCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.CheckStatus
+	ch <- c.Healthy
+}
+
+func (c *MmccrCollector) Collect(ch chan<- prometheus.Metric) {
+	level.Debug(c.logger).Log("msg", "Collecting mmccr metrics")
+	collectTime := time.Now()
+	checks, err := c.collect()
+	if err == context.DeadlineExceeded {
+		level.Error(c.logger).Log("msg", "Timeout executing mmccr")
+	} else if err != nil {
+		level.Error(c.logger).Log("msg", err)
+	}
+	if err == nil {
+		var healthy float64
+		if len(checks) > 0 {
+			healthy = 1
+		}
+		for _, check := range checks {
+			for _, s := range append(ccrStatuses, "UNKNOWN") {
+				var value float64
+				if s == check.Severity || (s == "UNKNOWN" && !SliceContains(ccrStatuses, check.Severity)) {
+					value = 1
+				}
+				ch <- prometheus.MustNewConstMetric(c.CheckStatus, prometheus.GaugeValue, value, check.Check, s)
+			}
+			if check.Severity != "OK" {
+				healthy = 0
+			}
+			if !SliceContains(ccrStatuses, check.Severity) {
+				level.Warn(c.logger).Log("msg", "Unknown mmccr check severity", "check", check.Check, "severity", check.Severity)
+			}
+		}
+		ch <- prometheus.MustNewConstMetric(c.Healthy, prometheus.GaugeValue, healthy)
+	} else if reason := errorReason(err); reason != "not_found" && reason != "permission" {
+		// mmccr hangs or fails when the repository is broken, which is what the collector detects
+		ch <- prometheus.MustNewConstMetric(c.Healthy, prometheus.GaugeValue, 0)
+	}
+	emitCollectorStatus(ch, "mmccr", err, collectTime, len(checks))
+}
+
+func (c *MmccrCollector) collect() ([]CCRCheck, error) {
+	ctx, cancel := commandContext("mmccr", *mmccrTimeout)
+	defer cancel()
+	out, err := execRetry(ctx, "mmccr", func() (string, error) {
+		return MmccrCheckExec(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	commandDump.record("mmccr-check", out)
+	checks := parse_mmccr_check(out, c.logger)
+	commandDump.recordParsed("mmccr-check", checks)
+	return checks, nil
+}
+
+func mmccrCheck(ctx context.Context) (string, error) {
+	return RunMMCommand(ctx, "mmccr", "check", "-Y", "-e")
+}
+
+// parse_mmccr_check returns the severity of each check, a check listed more than once
+// reports the first severity that is not OK
+func parse_mmccr_check(out string, logger log.Logger) []CCRCheck {
+	var checks []CCRCheck
+	index := make(map[string]int)
+	var indexes map[string]int
+	for _, l := range strings.Split(out, "\n") {
+		items := strings.Split(strings.TrimSpace(l), ":")
+		if len(items) < 7 || items[0] != "mmccr" {
+			continue
+		}
+		if items[2] == "HEADER" {
+			indexes = HeaderIndexMap(items)
+			continue
+		}
+		check, ok := headerValue(items, indexes, "CheckMnemonic")
+		if !ok || check == "" {
+			level.Debug(logger).Log("msg", "Skipping mmccr line without check", "line", l)
+			continue
+		}
+		severity, _ := headerValue(items, indexes, "Severity")
+		severity = strings.ToUpper(strings.TrimSpace(DecodeGPFSString(severity)))
+		check = DecodeGPFSString(check)
+		if i, ok := index[check]; ok {
+			if checks[i].Severity == "OK" {
+				checks[i].Severity = severity
+			}
+			continue
+		}
+		index[check] = len(checks)
+		checks = append(checks, CCRCheck{Check: check, Severity: severity})
+	}
+	return checks
+}
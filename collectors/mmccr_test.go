@@ -0,0 +1,232 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var (
+	mmccrCheckStdout = `
+mmccr::HEADER:version:reserved:reserved:NodeId:CheckMnemonic:ErrorCode:ErrorMsg:ListOfFailedEntities:ListOfSucceedEntities:Severity:
+mmccr::0:1:::1:CCR_CLIENT_INIT:0:::%2Fvar%2Fmmfs%2Fccr,%2Fvar%2Fmmfs%2Fccr%2Fcommitted,%2Fvar%2Fmmfs%2Fccr%2Fccr.nodes,Security:OK:
+mmccr::0:1:::1:FC_CCR_AUTH_KEYS:0:::%2Fvar%2Fmmfs%2Fssl%2Fauthorized_ccr_keys:OK:
+mmccr::0:1:::1:PC_QUORUM_NODES:0:::10.22.0.11,10.22.0.12,10.22.0.13:OK:
+mmccr::0:1:::1:TC_TIEBREAKER_DISKS:0::::OK:
+`
+	mmccrCheckStdoutDegraded = `
+mmccr::HEADER:version:reserved:reserved:NodeId:CheckMnemonic:ErrorCode:ErrorMsg:ListOfFailedEntities:ListOfSucceedEntities:Severity:
+mmccr::0:1:::1:CCR_CLIENT_INIT:0:::%2Fvar%2Fmmfs%2Fccr,%2Fvar%2Fmmfs%2Fccr%2Fcommitted,%2Fvar%2Fmmfs%2Fccr%2Fccr.nodes,Security:OK:
+mmccr::0:1:::1:FC_CCR_AUTH_KEYS:0:::%2Fvar%2Fmmfs%2Fssl%2Fauthorized_ccr_keys:OK:
+mmccr::0:1:::1:PC_QUORUM_NODES:809:ccr_comm_unreachable:10.22.0.12,10.22.0.13:10.22.0.11:WARNING:
+mmccr::0:1:::2:PC_QUORUM_NODES:0:::10.22.0.11,10.22.0.12,10.22.0.13:OK:
+mmccr::0:1:::1:TC_TIEBREAKER_DISKS:0::::OK:
+`
+)
+
+func TestMmccrCheck(t *testing.T) {
+	execCommand = fakeExecCommand
+	mockedExitStatus = 0
+	mockedStdout = "foo"
+	defer func() { execCommand = exec.CommandContext }()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out, err := mmccrCheck(ctx)
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+	if out != mockedStdout {
+		t.Errorf("Unexpected out: %s", out)
+	}
+}
+
+func TestParseMmccrCheck(t *testing.T) {
+	checks := parse_mmccr_check(mmccrCheckStdoutDegraded, log.NewNopLogger())
+	expected := []CCRCheck{
+		{Check: "CCR_CLIENT_INIT", Severity: "OK"},
+		{Check: "FC_CCR_AUTH_KEYS", Severity: "OK"},
+		{Check: "PC_QUORUM_NODES", Severity: "WARNING"},
+		{Check: "TC_TIEBREAKER_DISKS", Severity: "OK"},
+	}
+	if !reflect.DeepEqual(checks, expected) {
+		t.Errorf("Unexpected checks\nGot: %v\nExpected: %v", checks, expected)
+	}
+}
+
+func TestParseMmccrCheckInsertedColumn(t *testing.T) {
+	expected := parse_mmccr_check(mmccrCheckStdout, log.NewNopLogger())
+	got := parse_mmccr_check(insertColumn(mmccrCheckStdout, 7), log.NewNopLogger())
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Unexpected checks with inserted column\nGot: %v\nExpected: %v", got, expected)
+	}
+}
+
+func TestMmccrCollector(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	MmccrCheckExec = func(ctx context.Context) (string, error) {
+		return mmccrCheckStdout, nil
+	}
+	expected := `
+		# HELP gpfs_ccr_check_status GPFS cluster configuration repository check status
+		# TYPE gpfs_ccr_check_status gauge
+		gpfs_ccr_check_status{check="CCR_CLIENT_INIT",status="FATAL"} 0
+		gpfs_ccr_check_status{check="CCR_CLIENT_INIT",status="OK"} 1
+		gpfs_ccr_check_status{check="CCR_CLIENT_INIT",status="UNKNOWN"} 0
+		gpfs_ccr_check_status{check="CCR_CLIENT_INIT",status="WARNING"} 0
+		gpfs_ccr_check_status{check="FC_CCR_AUTH_KEYS",status="FATAL"} 0
+		gpfs_ccr_check_status{check="FC_CCR_AUTH_KEYS",status="OK"} 1
+		gpfs_ccr_check_status{check="FC_CCR_AUTH_KEYS",status="UNKNOWN"} 0
+		gpfs_ccr_check_status{check="FC_CCR_AUTH_KEYS",status="WARNING"} 0
+		gpfs_ccr_check_status{check="PC_QUORUM_NODES",status="FATAL"} 0
+		gpfs_ccr_check_status{check="PC_QUORUM_NODES",status="OK"} 1
+		gpfs_ccr_check_status{check="PC_QUORUM_NODES",status="UNKNOWN"} 0
+		gpfs_ccr_check_status{check="PC_QUORUM_NODES",status="WARNING"} 0
+		gpfs_ccr_check_status{check="TC_TIEBREAKER_DISKS",status="FATAL"} 0
+		gpfs_ccr_check_status{check="TC_TIEBREAKER_DISKS",status="OK"} 1
+		gpfs_ccr_check_status{check="TC_TIEBREAKER_DISKS",status="UNKNOWN"} 0
+		gpfs_ccr_check_status{check="TC_TIEBREAKER_DISKS",status="WARNING"} 0
+		# HELP gpfs_ccr_healthy GPFS cluster configuration repository checks are all OK
+		# TYPE gpfs_ccr_healthy gauge
+		gpfs_ccr_healthy 1
+	`
+	collector := NewMmccrCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 29 {
+		t.Errorf("Unexpected collection count %d, expected 29", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_ccr_check_status", "gpfs_ccr_healthy"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestMmccrCollectorDegraded(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	MmccrCheckExec = func(ctx context.Context) (string, error) {
+		return mmccrCheckStdoutDegraded, nil
+	}
+	expected := `
+		# HELP gpfs_ccr_check_status GPFS cluster configuration repository check status
+		# TYPE gpfs_ccr_check_status gauge
+		gpfs_ccr_check_status{check="CCR_CLIENT_INIT",status="FATAL"} 0
+		gpfs_ccr_check_status{check="CCR_CLIENT_INIT",status="OK"} 1
+		gpfs_ccr_check_status{check="CCR_CLIENT_INIT",status="UNKNOWN"} 0
+		gpfs_ccr_check_status{check="CCR_CLIENT_INIT",status="WARNING"} 0
+		gpfs_ccr_check_status{check="FC_CCR_AUTH_KEYS",status="FATAL"} 0
+		gpfs_ccr_check_status{check="FC_CCR_AUTH_KEYS",status="OK"} 1
+		gpfs_ccr_check_status{check="FC_CCR_AUTH_KEYS",status="UNKNOWN"} 0
+		gpfs_ccr_check_status{check="FC_CCR_AUTH_KEYS",status="WARNING"} 0
+		gpfs_ccr_check_status{check="PC_QUORUM_NODES",status="FATAL"} 0
+		gpfs_ccr_check_status{check="PC_QUORUM_NODES",status="OK"} 0
+		gpfs_ccr_check_status{check="PC_QUORUM_NODES",status="UNKNOWN"} 0
+		gpfs_ccr_check_status{check="PC_QUORUM_NODES",status="WARNING"} 1
+		gpfs_ccr_check_status{check="TC_TIEBREAKER_DISKS",status="FATAL"} 0
+		gpfs_ccr_check_status{check="TC_TIEBREAKER_DISKS",status="OK"} 1
+		gpfs_ccr_check_status{check="TC_TIEBREAKER_DISKS",status="UNKNOWN"} 0
+		gpfs_ccr_check_status{check="TC_TIEBREAKER_DISKS",status="WARNING"} 0
+		# HELP gpfs_ccr_healthy GPFS cluster configuration repository checks are all OK
+		# TYPE gpfs_ccr_healthy gauge
+		gpfs_ccr_healthy 0
+	`
+	collector := NewMmccrCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_ccr_check_status", "gpfs_ccr_healthy"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestMmccrCollectorError(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	MmccrCheckExec = func(ctx context.Context) (string, error) {
+		return "", fmt.Errorf("Error")
+	}
+	expected := `
+		# HELP gpfs_ccr_healthy GPFS cluster configuration repository checks are all OK
+		# TYPE gpfs_ccr_healthy gauge
+		gpfs_ccr_healthy 0
+		# HELP gpfs_exporter_collect_error Indicates if error has occurred during collection
+		# TYPE gpfs_exporter_collect_error gauge
+		gpfs_exporter_collect_error{collector="mmccr"} 1
+	`
+	collector := NewMmccrCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 13 {
+		t.Errorf("Unexpected collection count %d, expected 13", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_ccr_healthy", "gpfs_exporter_collect_error"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestMmccrCollectorNotFound(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	MmccrCheckExec = func(ctx context.Context) (string, error) {
+		return "", &CommandError{Command: "mmccr check -Y -e", ExitCode: 127, Reason: "not_found", Err: exec.ErrNotFound}
+	}
+	collector := NewMmccrCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers, "gpfs_ccr_healthy"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 0 {
+		t.Errorf("Unexpected gpfs_ccr_healthy count %d, expected 0", val)
+	}
+}
+
+func TestMmccrCollectorTimeout(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	MmccrCheckExec = func(ctx context.Context) (string, error) {
+		return "", context.DeadlineExceeded
+	}
+	expected := `
+		# HELP gpfs_ccr_healthy GPFS cluster configuration repository checks are all OK
+		# TYPE gpfs_ccr_healthy gauge
+		gpfs_ccr_healthy 0
+		# HELP gpfs_exporter_collect_timeout Indicates the collector timed out
+		# TYPE gpfs_exporter_collect_timeout gauge
+		gpfs_exporter_collect_timeout{collector="mmccr"} 1
+	`
+	collector := NewMmccrCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 13 {
+		t.Errorf("Unexpected collection count %d, expected 13", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_ccr_healthy", "gpfs_exporter_collect_timeout"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
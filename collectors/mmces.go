@@ -14,7 +14,6 @@
 package collectors
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"os"
@@ -33,9 +32,13 @@ var (
 	configNodeName       = kingpin.Flag("collector.mmces.nodename", "CES node name to check, defaults to FQDN").Default("").String()
 	mmcesTimeout         = kingpin.Flag("collector.mmces.timeout", "Timeout for mmces execution").Default("5").Int()
 	mmcesIgnoredServices = kingpin.Flag("collector.mmces.ignored-services", "Regex of services to ignore").Default("^$").String()
+	mmcesAllNodes        = kingpin.Flag("collector.mmces.all-nodes", "Collect CES state for all CES nodes, adds node label").Default("false").Bool()
+	mmcesAddresses       = kingpin.Flag("collector.mmces.addresses", "Collect CES address assignments with mmces address list").Default("false").Bool()
 	cesServices          = []string{"AUTH", "BLOCK", "NETWORK", "AUTH_OBJ", "NFS", "OBJ", "SMB", "CES"}
+	cesNonServiceHeaders = []string{"", "HEADER", "version", "reserved", "NODE"}
 	cesStates            = []string{"DEGRADED", "DEPEND", "DISABLED", "FAILED", "HEALTHY", "STARTING", "STOPPED", "SUSPENDED"}
 	mmcesExec            = mmces
+	mmcesAddressExec     = mmcesAddress
 )
 
 func getFQDN(logger log.Logger) string {
@@ -48,13 +51,23 @@ func getFQDN(logger log.Logger) string {
 }
 
 type CESMetric struct {
+	Node    string
 	Service string
 	State   string
 }
 
+type CESAddressMetric struct {
+	Address    string
+	Node       string
+	Attributes []string
+}
+
 type MmcesCollector struct {
-	State  *prometheus.Desc
-	logger log.Logger
+	State               *prometheus.Desc
+	NodeState           *prometheus.Desc
+	AddressInfo         *prometheus.Desc
+	AddressesUnassigned *prometheus.Desc
+	logger              log.Logger
 }
 
 func init() {
@@ -63,23 +76,40 @@ func init() {
 
 func NewMmcesCollector(logger log.Logger) Collector {
 	return &MmcesCollector{
-		State: prometheus.NewDesc(prometheus.BuildFQName(namespace, "ces", "state"),
+		State: newDesc(prometheus.BuildFQName(namespace, "ces", "state"),
 			"GPFS CES health status", []string{"service", "state"}, nil),
+		NodeState: newDesc(prometheus.BuildFQName(namespace, "ces", "state"),
+			"GPFS CES health status", []string{"node", "service", "state"}, nil),
+		AddressInfo: newDesc(prometheus.BuildFQName(namespace, "ces", "address_info"),
+			"GPFS CES address assignment, node is none when unassigned", []string{"address", "node", "attribute"}, nil),
+		AddressesUnassigned: newDesc(prometheus.BuildFQName(namespace, "ces", "addresses_unassigned"),
+			"GPFS number of CES addresses not assigned to a node", nil, nil),
 		logger: logger,
 	}
 }
 
 func (c *MmcesCollector) Describe(ch chan<- *prometheus.Desc) {
-	ch <- c.State
+	if *mmcesAllNodes {
+		ch <- c.NodeState
+	} else {
+		ch <- c.State
+	}
+	if *mmcesAddresses {
+		ch <- c.AddressInfo
+		ch <- c.AddressesUnassigned
+	}
 }
 
 func (c *MmcesCollector) Collect(ch chan<- prometheus.Metric) {
 	level.Debug(c.logger).Log("msg", "Collecting mmces metrics")
+	if *mmcesAddresses {
+		c.collectAddresses(ch)
+	}
 	collectTime := time.Now()
-	timeout := 0
-	errorMetric := 0
 	var nodename string
-	if *configNodeName == "" {
+	if *mmcesAllNodes {
+		nodename = ""
+	} else if *configNodeName == "" {
 		nodename = getFQDN(c.logger)
 		if nodename == "" {
 			level.Error(c.logger).Log("msg", "collector.mmces.nodename must be defined and could not be determined")
@@ -91,10 +121,8 @@ func (c *MmcesCollector) Collect(ch chan<- prometheus.Metric) {
 	metrics, err := c.collect(nodename)
 	if err == context.DeadlineExceeded {
 		level.Error(c.logger).Log("msg", "Timeout executing mmces")
-		timeout = 1
 	} else if err != nil {
 		level.Error(c.logger).Log("msg", err)
-		errorMetric = 1
 	}
 	for _, m := range metrics {
 		for _, s := range cesStates {
@@ -102,42 +130,121 @@ func (c *MmcesCollector) Collect(ch chan<- prometheus.Metric) {
 			if s == m.State {
 				value = 1
 			}
-			ch <- prometheus.MustNewConstMetric(c.State, prometheus.GaugeValue, value, m.Service, s)
+			c.emitState(ch, m, s, value)
 		}
 		var unknown float64
 		if !SliceContains(cesStates, m.State) {
 			unknown = 1
-			level.Warn(c.logger).Log("msg", "Unknown state encountered", "state", m.State, "service", m.Service)
+			level.Warn(c.logger).Log("msg", "Unknown state encountered", "state", m.State, "service", m.Service, "node", m.Node)
+		}
+		c.emitState(ch, m, "UNKNOWN", unknown)
+	}
+	emitCollectorStatus(ch, "mmces", err, collectTime, len(metrics))
+}
+
+func (c *MmcesCollector) emitState(ch chan<- prometheus.Metric, m CESMetric, state string, value float64) {
+	if *mmcesAllNodes {
+		ch <- prometheus.MustNewConstMetric(c.NodeState, prometheus.GaugeValue, value, m.Node, m.Service, state)
+	} else {
+		ch <- prometheus.MustNewConstMetric(c.State, prometheus.GaugeValue, value, m.Service, state)
+	}
+}
+
+// collectAddresses collects the cluster wide CES address assignments, which do not depend on the node name
+func (c *MmcesCollector) collectAddresses(ch chan<- prometheus.Metric) {
+	collectTime := time.Now()
+	ctx, cancel := commandContext("mmces", *mmcesTimeout)
+	defer cancel()
+	var metrics []CESAddressMetric
+	out, err := execRetry(ctx, "mmces", func() (string, error) {
+		return mmcesAddressExec(ctx)
+	})
+	if err == context.DeadlineExceeded {
+		level.Error(c.logger).Log("msg", "Timeout executing mmces address list")
+	} else if err != nil {
+		level.Error(c.logger).Log("msg", err)
+	} else {
+		commandDump.record("mmces-address", out)
+		metrics = mmces_address_list_parse(out, c.logger)
+		commandDump.recordParsed("mmces-address", metrics)
+		var unassigned float64
+		for _, m := range metrics {
+			if m.Node == "none" {
+				unassigned++
+			}
+			attributes := m.Attributes
+			if len(attributes) == 0 {
+				attributes = []string{""}
+			}
+			for _, attribute := range attributes {
+				ch <- prometheus.MustNewConstMetric(c.AddressInfo, prometheus.GaugeValue, 1, m.Address, m.Node, attribute)
+			}
 		}
-		ch <- prometheus.MustNewConstMetric(c.State, prometheus.GaugeValue, unknown, m.Service, "UNKNOWN")
+		ch <- prometheus.MustNewConstMetric(c.AddressesUnassigned, prometheus.GaugeValue, unassigned)
 	}
-	ch <- prometheus.MustNewConstMetric(collectError, prometheus.GaugeValue, float64(errorMetric), "mmces")
-	ch <- prometheus.MustNewConstMetric(collecTimeout, prometheus.GaugeValue, float64(timeout), "mmces")
-	ch <- prometheus.MustNewConstMetric(collectDuration, prometheus.GaugeValue, time.Since(collectTime).Seconds(), "mmces")
+	emitCollectorStatus(ch, "mmces-addresses", err, collectTime, len(metrics))
 }
 
 func (c *MmcesCollector) collect(nodename string) ([]CESMetric, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(*mmcesTimeout)*time.Second)
+	ctx, cancel := commandContext("mmces", *mmcesTimeout)
 	defer cancel()
-	mmces_state_out, err := mmcesExec(nodename, ctx)
+	mmces_state_out, err := execRetry(ctx, "mmces", func() (string, error) {
+		return mmcesExec(nodename, ctx)
+	})
 	if err != nil {
 		return nil, err
 	}
+	commandDump.record("mmces", mmces_state_out)
 	metrics := mmces_state_show_parse(mmces_state_out, c.logger)
+	commandDump.recordParsed("mmces", metrics)
 	return metrics, nil
 }
 
 func mmces(nodename string, ctx context.Context) (string, error) {
-	cmd := execCommand(ctx, *sudoCmd, "/usr/lpp/mmfs/bin/mmces", "state", "show", "-N", nodename, "-Y")
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	err := cmd.Run()
-	if ctx.Err() == context.DeadlineExceeded {
-		return "", ctx.Err()
-	} else if err != nil {
-		return "", err
+	args := []string{"state", "show"}
+	if nodename == "" {
+		args = append(args, "-a", "-Y")
+	} else {
+		args = append(args, "-N", nodename, "-Y")
 	}
-	return out.String(), nil
+	return RunMMCommand(ctx, "mmces", args...)
+}
+
+func mmcesAddress(ctx context.Context) (string, error) {
+	return RunMMCommand(ctx, "mmces", "address", "list", "-Y")
+}
+
+func mmces_address_list_parse(out string, logger log.Logger) []CESAddressMetric {
+	var metrics []CESAddressMetric
+	var headers []string
+	lines := strings.Split(out, "\n")
+	for _, l := range lines {
+		if !strings.HasPrefix(l, "mmces") {
+			continue
+		}
+		items := strings.Split(l, ":")
+		if len(items) < 3 {
+			continue
+		}
+		if items[2] == "HEADER" {
+			headers = items
+			continue
+		}
+		addressIndex := SliceIndex(headers, "cesAddress")
+		nodeIndex := SliceIndex(headers, "cesNode")
+		if addressIndex == -1 || nodeIndex == -1 || addressIndex >= len(items) || nodeIndex >= len(items) {
+			continue
+		}
+		metric := CESAddressMetric{Address: items[addressIndex], Node: items[nodeIndex]}
+		if metric.Node == "" {
+			metric.Node = "none"
+		}
+		if attributesIndex := SliceIndex(headers, "attributes"); attributesIndex != -1 && attributesIndex < len(items) {
+			metric.Attributes = SplitList(DecodeGPFSString(items[attributesIndex]))
+		}
+		metrics = append(metrics, metric)
+	}
+	return metrics
 }
 
 func mmces_state_show_parse(out string, logger log.Logger) []CESMetric {
@@ -145,7 +252,6 @@ func mmces_state_show_parse(out string, logger log.Logger) []CESMetric {
 	var metrics []CESMetric
 	lines := strings.Split(out, "\n")
 	var headers []string
-	var values []string
 	for _, l := range lines {
 		if !strings.HasPrefix(l, "mmcesstate") {
 			continue
@@ -155,23 +261,28 @@ func mmces_state_show_parse(out string, logger log.Logger) []CESMetric {
 			continue
 		}
 		if items[2] == "HEADER" {
-			headers = append(headers, items...)
-		} else {
-			values = append(values, items...)
-		}
-	}
-	for i, h := range headers {
-		if !SliceContains(cesServices, h) {
+			headers = items
 			continue
 		}
-		if mmcesIgnoredServicesPattern.MatchString(h) {
-			level.Debug(logger).Log("msg", "Skipping service due to ignored pattern", "service", h)
-			continue
+		var node string
+		if nodeIndex := SliceIndex(headers, "NODE"); nodeIndex != -1 && nodeIndex < len(items) {
+			node = items[nodeIndex]
+		}
+		// Every column after the record prefix that is not NODE is a service
+		for i, h := range headers {
+			if i == 0 || SliceContains(cesNonServiceHeaders, h) || i >= len(items) {
+				continue
+			}
+			if mmcesIgnoredServicesPattern.MatchString(h) {
+				level.Debug(logger).Log("msg", "Skipping service due to ignored pattern", "service", h)
+				continue
+			}
+			var metric CESMetric
+			metric.Node = node
+			metric.Service = h
+			metric.State = items[i]
+			metrics = append(metrics, metric)
 		}
-		var metric CESMetric
-		metric.Service = h
-		metric.State = values[i]
-		metrics = append(metrics, metric)
 	}
 	return metrics
 }
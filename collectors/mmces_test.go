@@ -17,6 +17,7 @@ import (
 	"context"
 	"fmt"
 	"os/exec"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -31,6 +32,25 @@ var (
 mmcesstate::HEADER:version:reserved:reserved:NODE:AUTH:BLOCK:NETWORK:AUTH_OBJ:NFS:OBJ:SMB:CES:
 mmcesstate::0:1:::ib-protocol01.domain:HEALTHY:DISABLED:HEALTHY:DISABLED:HEALTHY:DISABLED:FOO:HEALTHY:
 
+`
+	mmcesStdoutAll = `
+mmcesstate::HEADER:version:reserved:reserved:NODE:AUTH:BLOCK:NETWORK:AUTH_OBJ:NFS:OBJ:SMB:CES:
+mmcesstate::0:1:::ib-protocol01.domain:HEALTHY:DISABLED:HEALTHY:DISABLED:HEALTHY:DISABLED:HEALTHY:HEALTHY:
+mmcesstate::0:1:::ib-protocol02.domain:HEALTHY:DISABLED:HEALTHY:DISABLED:FAILED:DISABLED:HEALTHY:DEGRADED:
+`
+	mmcesStdoutS3 = `
+mmcesstate::HEADER:version:reserved:reserved:NODE:AUTH:BLOCK:NETWORK:HDFS:AUTH_OBJ:NFS:OBJ:SMB:S3:CES:
+mmcesstate::0:1:::ib-protocol01.domain:HEALTHY:DISABLED:HEALTHY:DISABLED:DISABLED:HEALTHY:DISABLED:HEALTHY:FAILED:HEALTHY:
+`
+	mmcesStdoutReordered = `
+mmcesstate::HEADER:version:reserved:reserved:NODE:CES:S3:SMB:OBJ:NFS:AUTH_OBJ:HDFS:NETWORK:BLOCK:AUTH:
+mmcesstate::0:1:::ib-protocol01.domain:HEALTHY:FAILED:HEALTHY:DISABLED:HEALTHY:DISABLED:DISABLED:HEALTHY:DISABLED:HEALTHY:
+`
+	mmcesAddressStdout = `
+mmces:address:HEADER:version:reserved:reserved:cesAddress:cesNode:attributes:cesGroup:preferredNode:unhostableNodes:
+mmces:address:0:1:::10.0.0.10:ib-protocol01.domain:object_database_node%2Cobject_singleton_node::none::
+mmces:address:0:1:::10.0.0.11:ib-protocol01.domain:::none::
+mmces:address:0:1:::10.0.0.12:none:::none::
 `
 )
 
@@ -119,6 +139,33 @@ func TestParseMmcesStateShow(t *testing.T) {
 	}
 }
 
+func TestParseMmcesStateShowServices(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.mmces.nodename=ib-protocol01.domain"}); err != nil {
+		t.Fatal(err)
+	}
+	ignored := "^$"
+	mmcesIgnoredServices = &ignored
+	expected := map[string]string{
+		"AUTH": "HEALTHY", "BLOCK": "DISABLED", "NETWORK": "HEALTHY", "HDFS": "DISABLED", "AUTH_OBJ": "DISABLED",
+		"NFS": "HEALTHY", "OBJ": "DISABLED", "SMB": "HEALTHY", "S3": "FAILED", "CES": "HEALTHY",
+	}
+	for _, out := range []string{mmcesStdoutS3, mmcesStdoutReordered} {
+		metrics := mmces_state_show_parse(out, log.NewNopLogger())
+		if len(metrics) != len(expected) {
+			t.Errorf("Expected %d metrics returned, got %d", len(expected), len(metrics))
+			continue
+		}
+		for _, m := range metrics {
+			if m.Node != "ib-protocol01.domain" {
+				t.Errorf("Unexpected Node got %s", m.Node)
+			}
+			if state, ok := expected[m.Service]; !ok || state != m.State {
+				t.Errorf("Unexpected state %s for service %s", m.State, m.Service)
+			}
+		}
+	}
+}
+
 func TestParseMmcesStateShowIgnore(t *testing.T) {
 	if _, err := kingpin.CommandLine.Parse([]string{"--collector.mmces.nodename=ib-protocol01.domain"}); err != nil {
 		t.Fatal(err)
@@ -132,6 +179,31 @@ func TestParseMmcesStateShowIgnore(t *testing.T) {
 	}
 }
 
+func TestParseMmcesStateShowAll(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.mmces.all-nodes"}); err != nil {
+		t.Fatal(err)
+	}
+	ignored := "^$"
+	mmcesIgnoredServices = &ignored
+	metrics := mmces_state_show_parse(mmcesStdoutAll, log.NewNopLogger())
+	if len(metrics) != 16 {
+		t.Errorf("Expected 16 metrics returned, got %d", len(metrics))
+		return
+	}
+	if val := metrics[0].Node; val != "ib-protocol01.domain" {
+		t.Errorf("Unexpected Node got %s", val)
+	}
+	if val := metrics[12].Node; val != "ib-protocol02.domain" {
+		t.Errorf("Unexpected Node got %s", val)
+	}
+	if val := metrics[12].Service; val != "NFS" {
+		t.Errorf("Unexpected Service got %s", val)
+	}
+	if val := metrics[12].State; val != "FAILED" {
+		t.Errorf("Unexpected State got %s", val)
+	}
+}
+
 func TestMMcesCollector(t *testing.T) {
 	if _, err := kingpin.CommandLine.Parse([]string{"--collector.mmces.nodename=ib-protocol01.domain"}); err != nil {
 		t.Fatal(err)
@@ -221,8 +293,8 @@ func TestMMcesCollector(t *testing.T) {
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
-	} else if val != 75 {
-		t.Errorf("Unexpected collection count %d, expected 75", val)
+	} else if val != 84 {
+		t.Errorf("Unexpected collection count %d, expected 84", val)
 	}
 	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_ces_state"); err != nil {
 		t.Errorf("unexpected collecting result:\n%s", err)
@@ -316,12 +388,147 @@ func TestMMcesCollectorHostname(t *testing.T) {
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
-	} else if val != 75 {
-		t.Errorf("Unexpected collection count %d, expected 75", val)
+	} else if val != 84 {
+		t.Errorf("Unexpected collection count %d, expected 84", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_ces_state"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestMMcesCollectorAllNodes(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.mmces.all-nodes"}); err != nil {
+		t.Fatal(err)
+	}
+	var execNodename string
+	mmcesExec = func(nodename string, ctx context.Context) (string, error) {
+		execNodename = nodename
+		return mmcesStdoutAll, nil
+	}
+	ignored := "^(AUTH|BLOCK|NETWORK|AUTH_OBJ|OBJ|SMB)$"
+	mmcesIgnoredServices = &ignored
+	expected := `
+		# HELP gpfs_ces_state GPFS CES health status
+		# TYPE gpfs_ces_state gauge
+		gpfs_ces_state{node="ib-protocol01.domain",service="CES",state="DEGRADED"} 0
+		gpfs_ces_state{node="ib-protocol01.domain",service="CES",state="DEPEND"} 0
+		gpfs_ces_state{node="ib-protocol01.domain",service="CES",state="DISABLED"} 0
+		gpfs_ces_state{node="ib-protocol01.domain",service="CES",state="FAILED"} 0
+		gpfs_ces_state{node="ib-protocol01.domain",service="CES",state="HEALTHY"} 1
+		gpfs_ces_state{node="ib-protocol01.domain",service="CES",state="STARTING"} 0
+		gpfs_ces_state{node="ib-protocol01.domain",service="CES",state="STOPPED"} 0
+		gpfs_ces_state{node="ib-protocol01.domain",service="CES",state="SUSPENDED"} 0
+		gpfs_ces_state{node="ib-protocol01.domain",service="CES",state="UNKNOWN"} 0
+		gpfs_ces_state{node="ib-protocol01.domain",service="NFS",state="DEGRADED"} 0
+		gpfs_ces_state{node="ib-protocol01.domain",service="NFS",state="DEPEND"} 0
+		gpfs_ces_state{node="ib-protocol01.domain",service="NFS",state="DISABLED"} 0
+		gpfs_ces_state{node="ib-protocol01.domain",service="NFS",state="FAILED"} 0
+		gpfs_ces_state{node="ib-protocol01.domain",service="NFS",state="HEALTHY"} 1
+		gpfs_ces_state{node="ib-protocol01.domain",service="NFS",state="STARTING"} 0
+		gpfs_ces_state{node="ib-protocol01.domain",service="NFS",state="STOPPED"} 0
+		gpfs_ces_state{node="ib-protocol01.domain",service="NFS",state="SUSPENDED"} 0
+		gpfs_ces_state{node="ib-protocol01.domain",service="NFS",state="UNKNOWN"} 0
+		gpfs_ces_state{node="ib-protocol02.domain",service="CES",state="DEGRADED"} 1
+		gpfs_ces_state{node="ib-protocol02.domain",service="CES",state="DEPEND"} 0
+		gpfs_ces_state{node="ib-protocol02.domain",service="CES",state="DISABLED"} 0
+		gpfs_ces_state{node="ib-protocol02.domain",service="CES",state="FAILED"} 0
+		gpfs_ces_state{node="ib-protocol02.domain",service="CES",state="HEALTHY"} 0
+		gpfs_ces_state{node="ib-protocol02.domain",service="CES",state="STARTING"} 0
+		gpfs_ces_state{node="ib-protocol02.domain",service="CES",state="STOPPED"} 0
+		gpfs_ces_state{node="ib-protocol02.domain",service="CES",state="SUSPENDED"} 0
+		gpfs_ces_state{node="ib-protocol02.domain",service="CES",state="UNKNOWN"} 0
+		gpfs_ces_state{node="ib-protocol02.domain",service="NFS",state="DEGRADED"} 0
+		gpfs_ces_state{node="ib-protocol02.domain",service="NFS",state="DEPEND"} 0
+		gpfs_ces_state{node="ib-protocol02.domain",service="NFS",state="DISABLED"} 0
+		gpfs_ces_state{node="ib-protocol02.domain",service="NFS",state="FAILED"} 1
+		gpfs_ces_state{node="ib-protocol02.domain",service="NFS",state="HEALTHY"} 0
+		gpfs_ces_state{node="ib-protocol02.domain",service="NFS",state="STARTING"} 0
+		gpfs_ces_state{node="ib-protocol02.domain",service="NFS",state="STOPPED"} 0
+		gpfs_ces_state{node="ib-protocol02.domain",service="NFS",state="SUSPENDED"} 0
+		gpfs_ces_state{node="ib-protocol02.domain",service="NFS",state="UNKNOWN"} 0
+	`
+	collector := NewMmcesCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 48 {
+		t.Errorf("Unexpected collection count %d, expected 48", val)
 	}
 	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_ces_state"); err != nil {
 		t.Errorf("unexpected collecting result:\n%s", err)
 	}
+	if execNodename != "" {
+		t.Errorf("Unexpected nodename %s", execNodename)
+	}
+}
+
+func TestParseMmcesAddressList(t *testing.T) {
+	metrics := mmces_address_list_parse(mmcesAddressStdout, log.NewNopLogger())
+	expected := []CESAddressMetric{
+		{Address: "10.0.0.10", Node: "ib-protocol01.domain", Attributes: []string{"object_database_node", "object_singleton_node"}},
+		{Address: "10.0.0.11", Node: "ib-protocol01.domain"},
+		{Address: "10.0.0.12", Node: "none"},
+	}
+	if !reflect.DeepEqual(metrics, expected) {
+		t.Errorf("Unexpected metrics\nGot: %v\nExpected: %v", metrics, expected)
+	}
+}
+
+func TestMMcesCollectorAddresses(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.mmces.nodename=ib-protocol01.domain", "--collector.mmces.addresses"}); err != nil {
+		t.Fatal(err)
+	}
+	mmcesExec = func(nodename string, ctx context.Context) (string, error) {
+		return mmcesStdout, nil
+	}
+	mmcesAddressExec = func(ctx context.Context) (string, error) {
+		return mmcesAddressStdout, nil
+	}
+	expected := `
+		# HELP gpfs_ces_address_info GPFS CES address assignment, node is none when unassigned
+		# TYPE gpfs_ces_address_info gauge
+		gpfs_ces_address_info{address="10.0.0.10",attribute="object_database_node",node="ib-protocol01.domain"} 1
+		gpfs_ces_address_info{address="10.0.0.10",attribute="object_singleton_node",node="ib-protocol01.domain"} 1
+		gpfs_ces_address_info{address="10.0.0.11",attribute="",node="ib-protocol01.domain"} 1
+		gpfs_ces_address_info{address="10.0.0.12",attribute="",node="none"} 1
+		# HELP gpfs_ces_addresses_unassigned GPFS number of CES addresses not assigned to a node
+		# TYPE gpfs_ces_addresses_unassigned gauge
+		gpfs_ces_addresses_unassigned 1
+		# HELP gpfs_exporter_collect_error Indicates if error has occurred during collection
+		# TYPE gpfs_exporter_collect_error gauge
+		gpfs_exporter_collect_error{collector="mmces"} 0
+		gpfs_exporter_collect_error{collector="mmces-addresses"} 0
+	`
+	collector := NewMmcesCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
+		"gpfs_ces_address_info", "gpfs_ces_addresses_unassigned", "gpfs_exporter_collect_error"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestMMcesCollectorAddressesError(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.mmces.nodename=ib-protocol01.domain", "--collector.mmces.addresses"}); err != nil {
+		t.Fatal(err)
+	}
+	mmcesExec = func(nodename string, ctx context.Context) (string, error) {
+		return mmcesStdout, nil
+	}
+	mmcesAddressExec = func(ctx context.Context) (string, error) {
+		return "", fmt.Errorf("Error")
+	}
+	expected := `
+		# HELP gpfs_exporter_collect_error Indicates if error has occurred during collection
+		# TYPE gpfs_exporter_collect_error gauge
+		gpfs_exporter_collect_error{collector="mmces"} 0
+		gpfs_exporter_collect_error{collector="mmces-addresses"} 1
+	`
+	collector := NewMmcesCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
+		"gpfs_ces_addresses_unassigned", "gpfs_exporter_collect_error"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
 }
 
 func TestMMcesCollectorError(t *testing.T) {
@@ -340,8 +547,8 @@ func TestMMcesCollectorError(t *testing.T) {
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
-	} else if val != 3 {
-		t.Errorf("Unexpected collection count %d, expected 3", val)
+	} else if val != 12 {
+		t.Errorf("Unexpected collection count %d, expected 12", val)
 	}
 	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collect_error"); err != nil {
 		t.Errorf("unexpected collecting result:\n%s", err)
@@ -364,8 +571,8 @@ func TestMMcesCollectorTimeout(t *testing.T) {
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
-	} else if val != 3 {
-		t.Errorf("Unexpected collection count %d, expected 3", val)
+	} else if val != 12 {
+		t.Errorf("Unexpected collection count %d, expected 12", val)
 	}
 	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collect_timeout"); err != nil {
 		t.Errorf("unexpected collecting result:\n%s", err)
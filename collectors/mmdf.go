@@ -14,9 +14,9 @@
 package collectors
 
 import (
-	"bytes"
 	"context"
 	"fmt"
+	"regexp"
 	"strings"
 	"sync"
 	"time"
@@ -30,7 +30,10 @@ import (
 var (
 	configFilesystems = kingpin.Flag("collector.mmdf.filesystems", "Filesystems to query with mmdf, comma separated. Defaults to all filesystems.").Default("").String()
 	mmdfTimeout       = kingpin.Flag("collector.mmdf.timeout", "Timeout for mmdf execution").Default("60").Int()
-	mappedSections    = []string{"inode", "fsTotal", "metadata", "poolTotal"}
+	mmdfPoolInclude   = kingpin.Flag("collector.mmdf.pool-include", "Regex of pool names to collect").Default(".*").String()
+	mmdfPoolExclude   = kingpin.Flag("collector.mmdf.pool-exclude", "Regex of pool names to exclude").Default("^$").String()
+	mmdfNSDMetrics    = kingpin.Flag("collector.mmdf.nsd-metrics", "Collect capacity metrics for every NSD").Default("false").Bool()
+	mappedSections    = []string{"inode", "fsTotal", "metadata", "poolTotal", "nsd"}
 	MmdfExec          = mmdf
 )
 
@@ -46,6 +49,7 @@ type DFMetric struct {
 	MetadataTotal   float64
 	MetadataFree    float64
 	Pools           []PoolMetric
+	NSDs            []NSDMetric
 }
 
 type PoolMetric struct {
@@ -54,21 +58,45 @@ type PoolMetric struct {
 	PoolFree          float64
 	PoolFreeFragments float64
 	PoolMaxDiskSize   float64
+	// PoolSuspended and PoolSuspendedFree are the size and free space of NSDs
+	// not available for block allocation, such as suspended or being emptied disks
+	PoolSuspended     float64
+	PoolSuspendedFree float64
+}
+
+type NSDMetric struct {
+	NSDName      string
+	PoolName     string
+	FailureGroup string
+	Size         float64
+	Free         float64
+	FreePercent  float64
+	Available    bool
 }
 
 type MmdfCollector struct {
+	filesystemOverride
 	InodesUsed        *prometheus.Desc
 	InodesFree        *prometheus.Desc
 	InodesAllocated   *prometheus.Desc
 	InodesTotal       *prometheus.Desc
 	FSTotal           *prometheus.Desc
 	FSFree            *prometheus.Desc
+	FSUsed            *prometheus.Desc
 	MetadataTotal     *prometheus.Desc
 	MetadataFree      *prometheus.Desc
+	MetadataUsed      *prometheus.Desc
 	PoolTotal         *prometheus.Desc
 	PoolFree          *prometheus.Desc
+	PoolUsed          *prometheus.Desc
 	PoolFreeFragments *prometheus.Desc
 	PoolMaxDiskSize   *prometheus.Desc
+	PoolExcluded      *prometheus.Desc
+	PoolSuspended     *prometheus.Desc
+	PoolSuspendedFree *prometheus.Desc
+	NSDSize           *prometheus.Desc
+	NSDFree           *prometheus.Desc
+	NSDFreePercent    *prometheus.Desc
 	logger            log.Logger
 }
 
@@ -78,30 +106,48 @@ func init() {
 
 func NewMmdfCollector(logger log.Logger) Collector {
 	return &MmdfCollector{
-		InodesUsed: prometheus.NewDesc(prometheus.BuildFQName(namespace, "fs", "used_inodes"),
-			"GPFS filesystem inodes used", []string{"fs"}, nil),
-		InodesFree: prometheus.NewDesc(prometheus.BuildFQName(namespace, "fs", "free_inodes"),
-			"GPFS filesystem inodes free", []string{"fs"}, nil),
-		InodesAllocated: prometheus.NewDesc(prometheus.BuildFQName(namespace, "fs", "allocated_inodes"),
-			"GPFS filesystem inodes allocated", []string{"fs"}, nil),
-		InodesTotal: prometheus.NewDesc(prometheus.BuildFQName(namespace, "fs", "inodes"),
-			"GPFS filesystem inodes total", []string{"fs"}, nil),
-		FSTotal: prometheus.NewDesc(prometheus.BuildFQName(namespace, "fs", "size_bytes"),
-			"GPFS filesystem total size in bytes", []string{"fs"}, nil),
-		FSFree: prometheus.NewDesc(prometheus.BuildFQName(namespace, "fs", "free_bytes"),
-			"GPFS filesystem free size in bytes", []string{"fs"}, nil),
-		MetadataTotal: prometheus.NewDesc(prometheus.BuildFQName(namespace, "fs", "metadata_size_bytes"),
-			"GPFS total metadata size in bytes", []string{"fs"}, nil),
-		MetadataFree: prometheus.NewDesc(prometheus.BuildFQName(namespace, "fs", "metadata_free_bytes"),
-			"GPFS metadata free size in bytes", []string{"fs"}, nil),
-		PoolTotal: prometheus.NewDesc(prometheus.BuildFQName(namespace, "fs", "pool_total_bytes"),
-			"GPFS pool total size in bytes", []string{"fs", "pool"}, nil),
-		PoolFree: prometheus.NewDesc(prometheus.BuildFQName(namespace, "fs", "pool_free_bytes"),
-			"GPFS pool free size in bytes", []string{"fs", "pool"}, nil),
-		PoolFreeFragments: prometheus.NewDesc(prometheus.BuildFQName(namespace, "fs", "pool_free_fragments_bytes"),
-			"GPFS pool free fragments in bytes", []string{"fs", "pool"}, nil),
-		PoolMaxDiskSize: prometheus.NewDesc(prometheus.BuildFQName(namespace, "fs", "pool_max_disk_size_bytes"),
-			"GPFS pool max disk size in bytes", []string{"fs", "pool"}, nil),
+		InodesUsed: newDesc(prometheus.BuildFQName(namespace, "fs", "used_inodes"),
+			"GPFS filesystem inodes used", []string{"fs", "remote_cluster"}, nil),
+		InodesFree: newDesc(prometheus.BuildFQName(namespace, "fs", "free_inodes"),
+			"GPFS filesystem inodes free", []string{"fs", "remote_cluster"}, nil),
+		InodesAllocated: newDesc(prometheus.BuildFQName(namespace, "fs", "allocated_inodes"),
+			"GPFS filesystem inodes allocated", []string{"fs", "remote_cluster"}, nil),
+		InodesTotal: newDesc(prometheus.BuildFQName(namespace, "fs", "inodes"),
+			"GPFS filesystem inodes total", []string{"fs", "remote_cluster"}, nil),
+		FSTotal: newDesc(prometheus.BuildFQName(namespace, "fs", "size_bytes"),
+			"GPFS filesystem total size in bytes", []string{"fs", "remote_cluster"}, nil),
+		FSFree: newDesc(prometheus.BuildFQName(namespace, "fs", "free_bytes"),
+			"GPFS filesystem free size in bytes", []string{"fs", "remote_cluster"}, nil),
+		FSUsed: newDesc(prometheus.BuildFQName(namespace, "fs", "used_bytes"),
+			"GPFS filesystem used size in bytes", []string{"fs", "remote_cluster"}, nil),
+		MetadataTotal: newDesc(prometheus.BuildFQName(namespace, "fs", "metadata_size_bytes"),
+			"GPFS total metadata size in bytes", []string{"fs", "remote_cluster"}, nil),
+		MetadataFree: newDesc(prometheus.BuildFQName(namespace, "fs", "metadata_free_bytes"),
+			"GPFS metadata free size in bytes", []string{"fs", "remote_cluster"}, nil),
+		MetadataUsed: newDesc(prometheus.BuildFQName(namespace, "fs", "metadata_used_bytes"),
+			"GPFS metadata used size in bytes", []string{"fs", "remote_cluster"}, nil),
+		PoolTotal: newDesc(prometheus.BuildFQName(namespace, "fs", "pool_total_bytes"),
+			"GPFS pool total size in bytes", []string{"fs", "remote_cluster", "pool"}, nil),
+		PoolFree: newDesc(prometheus.BuildFQName(namespace, "fs", "pool_free_bytes"),
+			"GPFS pool free size in bytes", []string{"fs", "remote_cluster", "pool"}, nil),
+		PoolUsed: newDesc(prometheus.BuildFQName(namespace, "fs", "pool_used_bytes"),
+			"GPFS pool used size in bytes", []string{"fs", "remote_cluster", "pool"}, nil),
+		PoolFreeFragments: newDesc(prometheus.BuildFQName(namespace, "fs", "pool_free_fragments_bytes"),
+			"GPFS pool free fragments in bytes", []string{"fs", "remote_cluster", "pool"}, nil),
+		PoolMaxDiskSize: newDesc(prometheus.BuildFQName(namespace, "fs", "pool_max_disk_size_bytes"),
+			"GPFS pool max disk size in bytes", []string{"fs", "remote_cluster", "pool"}, nil),
+		PoolExcluded: newDesc(prometheus.BuildFQName(namespace, "fs", "pool_excluded_count"),
+			"GPFS count of pools excluded from pool metrics", []string{"fs", "remote_cluster"}, nil),
+		PoolSuspended: newDesc(prometheus.BuildFQName(namespace, "fs", "pool_suspended_bytes"),
+			"GPFS pool size in bytes of NSDs not available for block allocation", []string{"fs", "remote_cluster", "pool"}, nil),
+		PoolSuspendedFree: newDesc(prometheus.BuildFQName(namespace, "fs", "pool_suspended_free_bytes"),
+			"GPFS pool free size in bytes of NSDs not available for block allocation", []string{"fs", "remote_cluster", "pool"}, nil),
+		NSDSize: newDesc(prometheus.BuildFQName(namespace, "fs", "nsd_size_bytes"),
+			"GPFS NSD size in bytes", []string{"fs", "remote_cluster", "nsd", "pool", "failure_group"}, nil),
+		NSDFree: newDesc(prometheus.BuildFQName(namespace, "fs", "nsd_free_bytes"),
+			"GPFS NSD free size in bytes", []string{"fs", "remote_cluster", "nsd", "pool", "failure_group"}, nil),
+		NSDFreePercent: newDesc(prometheus.BuildFQName(namespace, "fs", "nsd_free_percent"),
+			"GPFS NSD free percent", []string{"fs", "remote_cluster", "nsd", "pool", "failure_group"}, nil),
 		logger: logger,
 	}
 }
@@ -113,34 +159,30 @@ func (c *MmdfCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- c.InodesTotal
 	ch <- c.FSTotal
 	ch <- c.FSFree
+	ch <- c.FSUsed
 	ch <- c.MetadataTotal
 	ch <- c.MetadataFree
+	ch <- c.MetadataUsed
 	ch <- c.PoolTotal
 	ch <- c.PoolFree
+	ch <- c.PoolUsed
+	ch <- c.PoolFreeFragments
+	ch <- c.PoolMaxDiskSize
+	ch <- c.PoolExcluded
+	ch <- c.PoolSuspended
+	ch <- c.PoolSuspendedFree
+	if *mmdfNSDMetrics {
+		ch <- c.NSDSize
+		ch <- c.NSDFree
+		ch <- c.NSDFreePercent
+	}
 }
 
 func (c *MmdfCollector) Collect(ch chan<- prometheus.Metric) {
 	wg := &sync.WaitGroup{}
-	var filesystems []string
-	if *configFilesystems == "" {
-		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(*mmlsfsTimeout)*time.Second)
-		defer cancel()
-		var mmlsfsTimeout float64
-		var mmlsfsError float64
-		mmlfsfs_filesystems, err := mmlfsfsFilesystems(ctx, c.logger)
-		if err == context.DeadlineExceeded {
-			mmlsfsTimeout = 1
-			level.Error(c.logger).Log("msg", "Timeout executing mmlsfs")
-		} else if err != nil {
-			mmlsfsError = 1
-			level.Error(c.logger).Log("msg", err)
-		}
-		ch <- prometheus.MustNewConstMetric(collecTimeout, prometheus.GaugeValue, mmlsfsTimeout, "mmdf-mmlsfs")
-		ch <- prometheus.MustNewConstMetric(collectError, prometheus.GaugeValue, mmlsfsError, "mmdf-mmlsfs")
-		filesystems = mmlfsfs_filesystems
-	} else {
-		filesystems = strings.Split(*configFilesystems, ",")
-	}
+	poolInclude := regexp.MustCompile(*mmdfPoolInclude)
+	poolExclude := regexp.MustCompile(*mmdfPoolExclude)
+	filesystems := c.getFilesystems(*configFilesystems, "mmdf", ch, c.logger)
 	for _, fs := range filesystems {
 		level.Debug(c.logger).Log("msg", "Collecting mmdf metrics", "fs", fs)
 		wg.Add(1)
@@ -148,71 +190,94 @@ func (c *MmdfCollector) Collect(ch chan<- prometheus.Metric) {
 		go func(fs string) {
 			defer wg.Done()
 			label := fmt.Sprintf("mmdf-%s", fs)
-			timeout := 0
-			errorMetric := 0
+			fsName, remoteCluster := splitFilesystem(fs)
+			defer recoverCollectorPanic(ch, label, collectTime, c.logger)
 			metric, err := c.mmdfCollect(fs)
 			if err == context.DeadlineExceeded {
 				level.Error(c.logger).Log("msg", fmt.Sprintf("Timeout executing %s", label))
-				timeout = 1
 			} else if err != nil {
 				level.Error(c.logger).Log("msg", err, "fs", fs)
-				errorMetric = 1
 			}
-			ch <- prometheus.MustNewConstMetric(collectError, prometheus.GaugeValue, float64(errorMetric), label)
-			ch <- prometheus.MustNewConstMetric(collecTimeout, prometheus.GaugeValue, float64(timeout), label)
-			ch <- prometheus.MustNewConstMetric(collectDuration, prometheus.GaugeValue, time.Since(collectTime).Seconds(), label)
 			if err == nil {
-				ch <- prometheus.MustNewConstMetric(c.InodesUsed, prometheus.GaugeValue, metric.InodesUsed, fs)
-				ch <- prometheus.MustNewConstMetric(c.InodesFree, prometheus.GaugeValue, metric.InodesFree, fs)
-				ch <- prometheus.MustNewConstMetric(c.InodesAllocated, prometheus.GaugeValue, metric.InodesAllocated, fs)
-				ch <- prometheus.MustNewConstMetric(c.InodesTotal, prometheus.GaugeValue, metric.InodesTotal, fs)
-				ch <- prometheus.MustNewConstMetric(c.FSTotal, prometheus.GaugeValue, metric.FSTotal, fs)
-				ch <- prometheus.MustNewConstMetric(c.FSFree, prometheus.GaugeValue, metric.FSFree, fs)
+				ch <- prometheus.MustNewConstMetric(c.InodesUsed, prometheus.GaugeValue, metric.InodesUsed, fsName, remoteCluster)
+				ch <- prometheus.MustNewConstMetric(c.InodesFree, prometheus.GaugeValue, metric.InodesFree, fsName, remoteCluster)
+				ch <- prometheus.MustNewConstMetric(c.InodesAllocated, prometheus.GaugeValue, metric.InodesAllocated, fsName, remoteCluster)
+				ch <- prometheus.MustNewConstMetric(c.InodesTotal, prometheus.GaugeValue, metric.InodesTotal, fsName, remoteCluster)
+				ch <- prometheus.MustNewConstMetric(c.FSTotal, prometheus.GaugeValue, metric.FSTotal, fsName, remoteCluster)
+				ch <- prometheus.MustNewConstMetric(c.FSFree, prometheus.GaugeValue, metric.FSFree, fsName, remoteCluster)
+				ch <- prometheus.MustNewConstMetric(c.FSUsed, prometheus.GaugeValue, usedBytes(metric.FSTotal, metric.FSFree), fsName, remoteCluster)
 				if metric.Metadata {
-					ch <- prometheus.MustNewConstMetric(c.MetadataTotal, prometheus.GaugeValue, metric.MetadataTotal, fs)
-					ch <- prometheus.MustNewConstMetric(c.MetadataFree, prometheus.GaugeValue, metric.MetadataFree, fs)
+					ch <- prometheus.MustNewConstMetric(c.MetadataTotal, prometheus.GaugeValue, metric.MetadataTotal, fsName, remoteCluster)
+					ch <- prometheus.MustNewConstMetric(c.MetadataFree, prometheus.GaugeValue, metric.MetadataFree, fsName, remoteCluster)
+					ch <- prometheus.MustNewConstMetric(c.MetadataUsed, prometheus.GaugeValue, usedBytes(metric.MetadataTotal, metric.MetadataFree), fsName, remoteCluster)
 				}
+				var excluded float64
 				for _, pool := range metric.Pools {
-					ch <- prometheus.MustNewConstMetric(c.PoolTotal, prometheus.GaugeValue, pool.PoolTotal, fs, pool.PoolName)
-					ch <- prometheus.MustNewConstMetric(c.PoolFree, prometheus.GaugeValue, pool.PoolFree, fs, pool.PoolName)
-					ch <- prometheus.MustNewConstMetric(c.PoolFreeFragments, prometheus.GaugeValue, pool.PoolFreeFragments, fs, pool.PoolName)
-					ch <- prometheus.MustNewConstMetric(c.PoolMaxDiskSize, prometheus.GaugeValue, pool.PoolMaxDiskSize, fs, pool.PoolName)
+					if !poolInclude.MatchString(pool.PoolName) || poolExclude.MatchString(pool.PoolName) {
+						excluded++
+						continue
+					}
+					ch <- prometheus.MustNewConstMetric(c.PoolTotal, prometheus.GaugeValue, pool.PoolTotal, fsName, remoteCluster, pool.PoolName)
+					ch <- prometheus.MustNewConstMetric(c.PoolFree, prometheus.GaugeValue, pool.PoolFree, fsName, remoteCluster, pool.PoolName)
+					ch <- prometheus.MustNewConstMetric(c.PoolUsed, prometheus.GaugeValue, usedBytes(pool.PoolTotal, pool.PoolFree), fsName, remoteCluster, pool.PoolName)
+					ch <- prometheus.MustNewConstMetric(c.PoolFreeFragments, prometheus.GaugeValue, pool.PoolFreeFragments, fsName, remoteCluster, pool.PoolName)
+					ch <- prometheus.MustNewConstMetric(c.PoolMaxDiskSize, prometheus.GaugeValue, pool.PoolMaxDiskSize, fsName, remoteCluster, pool.PoolName)
+					ch <- prometheus.MustNewConstMetric(c.PoolSuspended, prometheus.GaugeValue, pool.PoolSuspended, fsName, remoteCluster, pool.PoolName)
+					ch <- prometheus.MustNewConstMetric(c.PoolSuspendedFree, prometheus.GaugeValue, pool.PoolSuspendedFree, fsName, remoteCluster, pool.PoolName)
+				}
+				ch <- prometheus.MustNewConstMetric(c.PoolExcluded, prometheus.GaugeValue, excluded, fsName, remoteCluster)
+				if *mmdfNSDMetrics {
+					for _, nsd := range metric.NSDs {
+						if !poolInclude.MatchString(nsd.PoolName) || poolExclude.MatchString(nsd.PoolName) {
+							continue
+						}
+						ch <- prometheus.MustNewConstMetric(c.NSDSize, prometheus.GaugeValue, nsd.Size, fsName, remoteCluster, nsd.NSDName, nsd.PoolName, nsd.FailureGroup)
+						ch <- prometheus.MustNewConstMetric(c.NSDFree, prometheus.GaugeValue, nsd.Free, fsName, remoteCluster, nsd.NSDName, nsd.PoolName, nsd.FailureGroup)
+						ch <- prometheus.MustNewConstMetric(c.NSDFreePercent, prometheus.GaugeValue, nsd.FreePercent, fsName, remoteCluster, nsd.NSDName, nsd.PoolName, nsd.FailureGroup)
+					}
 				}
 			}
-			ch <- prometheus.MustNewConstMetric(lastExecution, prometheus.GaugeValue, float64(time.Now().Unix()), label)
+			emitCollectorStatus(ch, label, err, collectTime, recordCount(metric.FSTotal != 0))
 		}(fs)
 	}
 	wg.Wait()
 }
 
 func (c *MmdfCollector) mmdfCollect(fs string) (DFMetric, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(*mmdfTimeout)*time.Second)
+	ctx, cancel := commandContext("mmdf", *mmdfTimeout)
 	defer cancel()
-	out, err := MmdfExec(fs, ctx)
+	out, err := execRetry(ctx, "mmdf", func() (string, error) {
+		return MmdfExec(fs, ctx)
+	})
 	if err != nil {
 		return DFMetric{}, err
 	}
-	dfMetric := parse_mmdf(out, c.logger)
-	return dfMetric, nil
+	commandDump.record(fmt.Sprintf("mmdf-%s", fs), out)
+	dfMetric, err := parse_mmdf(out, c.logger)
+	recordParseIncomplete(fmt.Sprintf("mmdf-%s", fs), err)
+	commandDump.recordParsed(fmt.Sprintf("mmdf-%s", fs), dfMetric)
+	return dfMetric, err
 }
 
-func mmdf(fs string, ctx context.Context) (string, error) {
-	cmd := execCommand(ctx, *sudoCmd, "/usr/lpp/mmfs/bin/mmdf", fs, "-Y")
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	err := cmd.Run()
-	if ctx.Err() == context.DeadlineExceeded {
-		return "", ctx.Err()
-	} else if err != nil {
-		return "", err
+// usedBytes returns total less free from the same mmdf output, clamped at zero
+func usedBytes(total float64, free float64) float64 {
+	if used := total - free; used > 0 {
+		return used
 	}
-	return out.String(), nil
+	return 0
+}
+
+func mmdf(fs string, ctx context.Context) (string, error) {
+	return RunMMCommand(ctx, "mmdf", fs, "-Y")
 }
 
-func parse_mmdf(out string, logger log.Logger) DFMetric {
+// parse_mmdf returns an IncompleteOutputError when the inode or fsTotal values are missing
+func parse_mmdf(out string, logger log.Logger) (DFMetric, error) {
 	dfMetrics := DFMetric{Metadata: false}
 	pools := []PoolMetric{}
-	headers := make(map[string][]string)
+	nsds := []NSDMetric{}
+	headers := make(map[string]map[string]int)
+	seen := make(map[string]bool)
 	lines := strings.Split(out, "\n")
 	for _, l := range lines {
 		if !strings.HasPrefix(l, "mmdf") {
@@ -227,84 +292,75 @@ func parse_mmdf(out string, logger log.Logger) DFMetric {
 			continue
 		}
 		if items[2] == "HEADER" {
-			headers[items[1]] = append(headers[items[1]], items...)
+			headers[section] = HeaderIndexMap(items)
 			continue
 		}
-		if section == "inode" {
-			if inodesUsedIndex := SliceIndex(headers["inode"], "usedInodes"); inodesUsedIndex != -1 {
-				if inodesUsed, err := ParseFloat(items[inodesUsedIndex], false, logger); err == nil {
-					dfMetrics.InodesUsed = inodesUsed
-				}
-			}
-			if inodesFreeIndex := SliceIndex(headers["inode"], "freeInodes"); inodesFreeIndex != -1 {
-				if inodesFree, err := ParseFloat(items[inodesFreeIndex], false, logger); err == nil {
-					dfMetrics.InodesFree = inodesFree
-				}
-			}
-			if inodesAllocatedIndex := SliceIndex(headers["inode"], "allocatedInodes"); inodesAllocatedIndex != -1 {
-				if inodesAllocated, err := ParseFloat(items[inodesAllocatedIndex], false, logger); err == nil {
-					dfMetrics.InodesAllocated = inodesAllocated
-				}
-			}
-			if inodesTotalIndex := SliceIndex(headers["inode"], "maxInodes"); inodesTotalIndex != -1 {
-				if inodesTotal, err := ParseFloat(items[inodesTotalIndex], false, logger); err == nil {
-					dfMetrics.InodesTotal = inodesTotal
-				}
-			}
+		seen[section] = true
+		value := func(name string) (string, bool) {
+			return headerValue(items, headers[section], name)
 		}
-		if section == "fsTotal" {
-			if fsTotalIndex := SliceIndex(headers["fsTotal"], "fsSize"); fsTotalIndex != -1 {
-				if fsTotal, err := ParseFloat(items[fsTotalIndex], true, logger); err == nil {
-					dfMetrics.FSTotal = fsTotal
-				}
-			}
-			if fsFreeIndex := SliceIndex(headers["fsTotal"], "freeBlocks"); fsFreeIndex != -1 {
-				if fsFree, err := ParseFloat(items[fsFreeIndex], true, logger); err == nil {
-					dfMetrics.FSFree = fsFree
+		// setFloat sets target to the named column, converted from KiB to bytes when toBytes is true
+		setFloat := func(name string, toBytes bool, target *float64) {
+			if v, ok := value(name); ok {
+				if val, err := ParseFloat(v, toBytes, logger); err == nil {
+					*target = val
 				}
 			}
 		}
-		if section == "metadata" {
+		switch section {
+		case "inode":
+			setFloat("usedInodes", false, &dfMetrics.InodesUsed)
+			setFloat("freeInodes", false, &dfMetrics.InodesFree)
+			setFloat("allocatedInodes", false, &dfMetrics.InodesAllocated)
+			setFloat("maxInodes", false, &dfMetrics.InodesTotal)
+		case "fsTotal":
+			setFloat("fsSize", true, &dfMetrics.FSTotal)
+			setFloat("freeBlocks", true, &dfMetrics.FSFree)
+		case "metadata":
 			dfMetrics.Metadata = true
-			if metadataTotalIndex := SliceIndex(headers["metadata"], "totalMetadata"); metadataTotalIndex != -1 {
-				if metadataTotal, err := ParseFloat(items[metadataTotalIndex], true, logger); err == nil {
-					dfMetrics.MetadataTotal = metadataTotal
-				}
-			}
-			if metadataFreeIndex := SliceIndex(headers["metadata"], "freeBlocks"); metadataFreeIndex != -1 {
-				if metadataFree, err := ParseFloat(items[metadataFreeIndex], true, logger); err == nil {
-					dfMetrics.MetadataFree = metadataFree
-				}
-			}
-		}
-		if section == "poolTotal" {
+			setFloat("totalMetadata", true, &dfMetrics.MetadataTotal)
+			setFloat("freeBlocks", true, &dfMetrics.MetadataFree)
+		case "poolTotal":
 			poolMetric := PoolMetric{}
-			if poolNameIndex := SliceIndex(headers["poolTotal"], "poolName"); poolNameIndex != -1 {
-				poolMetric.PoolName = items[poolNameIndex]
-			}
-			if poolTotalIndex := SliceIndex(headers["poolTotal"], "poolSize"); poolTotalIndex != -1 {
-				if poolTotal, err := ParseFloat(items[poolTotalIndex], true, logger); err == nil {
-					poolMetric.PoolTotal = poolTotal
-				}
-			}
-			if poolFreeIndex := SliceIndex(headers["poolTotal"], "freeBlocks"); poolFreeIndex != -1 {
-				if poolFree, err := ParseFloat(items[poolFreeIndex], true, logger); err == nil {
-					poolMetric.PoolFree = poolFree
-				}
-			}
-			if poolFreeFragmentsIndex := SliceIndex(headers["poolTotal"], "freeFragments"); poolFreeFragmentsIndex != -1 {
-				if poolFreeFragments, err := ParseFloat(items[poolFreeFragmentsIndex], true, logger); err == nil {
-					poolMetric.PoolFreeFragments = poolFreeFragments
-				}
+			poolMetric.PoolName, _ = value("poolName")
+			setFloat("poolSize", true, &poolMetric.PoolTotal)
+			setFloat("freeBlocks", true, &poolMetric.PoolFree)
+			setFloat("freeFragments", true, &poolMetric.PoolFreeFragments)
+			setFloat("maxDiskSize", true, &poolMetric.PoolMaxDiskSize)
+			pools = append(pools, poolMetric)
+		case "nsd":
+			nsdMetric := NSDMetric{Available: true}
+			nsdMetric.NSDName, _ = value("nsdName")
+			nsdMetric.PoolName, _ = value("storagePool")
+			nsdMetric.FailureGroup, _ = value("failureGroup")
+			setFloat("diskSize", true, &nsdMetric.Size)
+			setFloat("freeBlocks", true, &nsdMetric.Free)
+			setFloat("freeBlocksPct", false, &nsdMetric.FreePercent)
+			if available, ok := value("diskAvailableForAlloc"); ok {
+				available = strings.ToLower(strings.TrimSpace(available))
+				nsdMetric.Available = available != "no" && available != "*"
 			}
-			if poolMaxDiskSizeIndex := SliceIndex(headers["poolTotal"], "maxDiskSize"); poolMaxDiskSizeIndex != -1 {
-				if poolMaxDiskSize, err := ParseFloat(items[poolMaxDiskSizeIndex], true, logger); err == nil {
-					poolMetric.PoolMaxDiskSize = poolMaxDiskSize
-				}
+			nsds = append(nsds, nsdMetric)
+		}
+	}
+	for i := range pools {
+		for _, nsd := range nsds {
+			if nsd.PoolName == pools[i].PoolName && !nsd.Available {
+				pools[i].PoolSuspended += nsd.Size
+				pools[i].PoolSuspendedFree += nsd.Free
 			}
-			pools = append(pools, poolMetric)
 		}
 	}
 	dfMetrics.Pools = pools
-	return dfMetrics
+	dfMetrics.NSDs = nsds
+	var missing []string
+	for _, section := range []string{"inode", "fsTotal"} {
+		if !seen[section] {
+			missing = append(missing, section)
+		}
+	}
+	if len(missing) > 0 {
+		return DFMetric{}, &IncompleteOutputError{Command: "mmdf", Missing: missing}
+	}
+	return dfMetrics, nil
 }
@@ -15,9 +15,13 @@ package collectors
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os/exec"
+	"reflect"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -42,6 +46,20 @@ mmdf:metadata:0:1:::13891534848:6011299328:43:58139768:0:
 mmdf:poolTotal:0:1:::data:3064453922816:1342362296320:44:1999215152:0:10143773212672:
 mmdf:fsTotal:0:1:::3661677723648:481202021888:14:12117655064:0:
 mmdf:inode:0:1:::430741822:484301506:915043328:1332164000:
+`
+	mmdfStdoutSuspended = `
+mmdf:nsd:HEADER:version:reserved:reserved:nsdName:storagePool:diskSize:failureGroup:metadata:data:freeBlocks:freeBlocksPct:freeFragments:freeFragmentsPct:diskAvailableForAlloc:
+mmdf:poolTotal:HEADER:version:reserved:reserved:poolName:poolSize:freeBlocks:freeBlocksPct:freeFragments:freeFragmentsPct:maxDiskSize:
+mmdf:fsTotal:HEADER:version:reserved:reserved:fsSize:freeBlocks:freeBlocksPct:freeFragments:freeFragmentsPct:
+mmdf:inode:HEADER:version:reserved:reserved:usedInodes:freeInodes:allocatedInodes:maxInodes:
+mmdf:nsd:0:1:::P_META_VD102:system:771751936:300:Yes:No:320274944:41:5005384:1::
+mmdf:nsd:0:1:::P_DATA_VD02:data:46766489600:200:No:Yes:6092915712:13:154966272:0::
+mmdf:nsd:0:1:::P_DATA_VD03:data:46766489600:200:No:Yes:4092915712:9:154966272:0:No:
+mmdf:nsd:0:1:::P_DATA_VD04:data:46766489600:200:No:Yes:2092915712:4:154966272:0:*:
+mmdf:poolTotal:0:1:::system:771751936:320274944:41:5005384:1:1153081262080:
+mmdf:poolTotal:0:1:::data:140299468800:12278747136:9:464898816:0:10143773212672:
+mmdf:fsTotal:0:1:::141071220736:12599022080:9:469904200:0:
+mmdf:inode:0:1:::430741822:484301506:915043328:1332164000:
 `
 	mmdfStdoutMissingMetadata = `
 mmdf:nsd:HEADER:version:reserved:reserved:nsdName:storagePool:diskSize:failureGroup:metadata:data:freeBlocks:freeBlocksPct:freeFragments:freeFragmentsPct:diskAvailableForAlloc:
@@ -125,7 +143,10 @@ func TestMmdfTimeout(t *testing.T) {
 }
 
 func TestParseMmdf(t *testing.T) {
-	dfmetrics := parse_mmdf(mmdfStdout, log.NewNopLogger())
+	dfmetrics, err := parse_mmdf(mmdfStdout, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
 	if dfmetrics.InodesFree != 484301506 {
 		t.Errorf("Unexpected value for InodesFree, got %v", dfmetrics.InodesFree)
 	}
@@ -141,7 +162,17 @@ func TestParseMmdf(t *testing.T) {
 	if len(dfmetrics.Pools) != 2 {
 		t.Errorf("Unexpected number of pools, got %v", len(dfmetrics.Pools))
 	}
-	dfmetrics = parse_mmdf(mmdfStdoutErrors, log.NewNopLogger())
+	expectedNSD := NSDMetric{NSDName: "P_DATA_VD02", PoolName: "data", FailureGroup: "200",
+		Size: 47888885350400, Free: 6239145689088, FreePercent: 13, Available: true}
+	if len(dfmetrics.NSDs) != 2 {
+		t.Errorf("Unexpected number of NSDs, got %v", len(dfmetrics.NSDs))
+	} else if dfmetrics.NSDs[1] != expectedNSD {
+		t.Errorf("Unexpected NSD\nGot: %v\nExpected: %v", dfmetrics.NSDs[1], expectedNSD)
+	}
+	dfmetrics, err = parse_mmdf(mmdfStdoutErrors, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
 	if dfmetrics.InodesFree != 484301506 {
 		t.Errorf("Unexpected value for InodesFree, got %v", dfmetrics.InodesFree)
 	}
@@ -157,7 +188,10 @@ func TestParseMmdf(t *testing.T) {
 	if len(dfmetrics.Pools) != 2 {
 		t.Errorf("Unexpected number of pools, got %v", len(dfmetrics.Pools))
 	}
-	dfmetrics = parse_mmdf(mmdfStdoutMissingMetadata, log.NewNopLogger())
+	dfmetrics, err = parse_mmdf(mmdfStdoutMissingMetadata, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
 	if dfmetrics.InodesFree != 484301506 {
 		t.Errorf("Unexpected value for InodesFree, got %v", dfmetrics.InodesFree)
 	}
@@ -181,60 +215,241 @@ func TestMmdfCollector(t *testing.T) {
 	expected := `
 		# HELP gpfs_fs_allocated_inodes GPFS filesystem inodes allocated
 		# TYPE gpfs_fs_allocated_inodes gauge
-		gpfs_fs_allocated_inodes{fs="project"} 915043328
+		gpfs_fs_allocated_inodes{fs="project",remote_cluster=""} 915043328
 		# HELP gpfs_fs_free_bytes GPFS filesystem free size in bytes
 		# TYPE gpfs_fs_free_bytes gauge
-		gpfs_fs_free_bytes{fs="project"} 492750870413312
+		gpfs_fs_free_bytes{fs="project",remote_cluster=""} 492750870413312
 		# HELP gpfs_fs_free_inodes GPFS filesystem inodes free
 		# TYPE gpfs_fs_free_inodes gauge
-		gpfs_fs_free_inodes{fs="project"} 484301506
+		gpfs_fs_free_inodes{fs="project",remote_cluster=""} 484301506
 		# HELP gpfs_fs_inodes GPFS filesystem inodes total
 		# TYPE gpfs_fs_inodes gauge
-		gpfs_fs_inodes{fs="project"} 1332164000
+		gpfs_fs_inodes{fs="project",remote_cluster=""} 1332164000
 		# HELP gpfs_fs_metadata_free_bytes GPFS metadata free size in bytes
 		# TYPE gpfs_fs_metadata_free_bytes gauge
-		gpfs_fs_metadata_free_bytes{fs="project"} 6155570511872
+		gpfs_fs_metadata_free_bytes{fs="project",remote_cluster=""} 6155570511872
 		# HELP gpfs_fs_metadata_size_bytes GPFS total metadata size in bytes
 		# TYPE gpfs_fs_metadata_size_bytes gauge
-		gpfs_fs_metadata_size_bytes{fs="project"} 14224931684352
+		gpfs_fs_metadata_size_bytes{fs="project",remote_cluster=""} 14224931684352
+		# HELP gpfs_fs_metadata_used_bytes GPFS metadata used size in bytes
+		# TYPE gpfs_fs_metadata_used_bytes gauge
+		gpfs_fs_metadata_used_bytes{fs="project",remote_cluster=""} 8069361172480
 		# HELP gpfs_fs_pool_free_bytes GPFS pool free size in bytes
 		# TYPE gpfs_fs_pool_free_bytes gauge
-		gpfs_fs_pool_free_bytes{fs="project",pool="data"} 1374578991431680
-		gpfs_fs_pool_free_bytes{fs="project",pool="system"} 389698396618752
+		gpfs_fs_pool_free_bytes{fs="project",pool="data",remote_cluster=""} 1374578991431680
+		gpfs_fs_pool_free_bytes{fs="project",pool="system",remote_cluster=""} 389698396618752
 		# HELP gpfs_fs_pool_free_fragments_bytes GPFS pool free fragments in bytes
 		# TYPE gpfs_fs_pool_free_fragments_bytes gauge
-		gpfs_fs_pool_free_fragments_bytes{fs="project",pool="data"} 2047196315648
-		gpfs_fs_pool_free_fragments_bytes{fs="project",pool="system"} 10265051611136
+		gpfs_fs_pool_free_fragments_bytes{fs="project",pool="data",remote_cluster=""} 2047196315648
+		gpfs_fs_pool_free_fragments_bytes{fs="project",pool="system",remote_cluster=""} 10265051611136
 		# HELP gpfs_fs_pool_max_disk_size_bytes GPFS pool max disk size in bytes
 		# TYPE gpfs_fs_pool_max_disk_size_bytes gauge
-		gpfs_fs_pool_max_disk_size_bytes{fs="project",pool="data"} 10387223769776128
-		gpfs_fs_pool_max_disk_size_bytes{fs="project",pool="system"} 1180755212369920
+		gpfs_fs_pool_max_disk_size_bytes{fs="project",pool="data",remote_cluster=""} 10387223769776128
+		gpfs_fs_pool_max_disk_size_bytes{fs="project",pool="system",remote_cluster=""} 1180755212369920
 		# HELP gpfs_fs_pool_total_bytes GPFS pool total size in bytes
 		# TYPE gpfs_fs_pool_total_bytes gauge
-		gpfs_fs_pool_total_bytes{fs="project",pool="data"} 3138000816963584
-		gpfs_fs_pool_total_bytes{fs="project",pool="system"} 802107691106304
+		gpfs_fs_pool_total_bytes{fs="project",pool="data",remote_cluster=""} 3138000816963584
+		gpfs_fs_pool_total_bytes{fs="project",pool="system",remote_cluster=""} 802107691106304
+		# HELP gpfs_fs_pool_used_bytes GPFS pool used size in bytes
+		# TYPE gpfs_fs_pool_used_bytes gauge
+		gpfs_fs_pool_used_bytes{fs="project",pool="data",remote_cluster=""} 1763421825531904
+		gpfs_fs_pool_used_bytes{fs="project",pool="system",remote_cluster=""} 412409294487552
 		# HELP gpfs_fs_size_bytes GPFS filesystem total size in bytes
 		# TYPE gpfs_fs_size_bytes gauge
-		gpfs_fs_size_bytes{fs="project"} 3749557989015552
+		gpfs_fs_size_bytes{fs="project",remote_cluster=""} 3749557989015552
+		# HELP gpfs_fs_used_bytes GPFS filesystem used size in bytes
+		# TYPE gpfs_fs_used_bytes gauge
+		gpfs_fs_used_bytes{fs="project",remote_cluster=""} 3256807118602240
 		# HELP gpfs_fs_used_inodes GPFS filesystem inodes used
 		# TYPE gpfs_fs_used_inodes gauge
-		gpfs_fs_used_inodes{fs="project"} 430741822
+		gpfs_fs_used_inodes{fs="project",remote_cluster=""} 430741822
 	`
 	collector := NewMmdfCollector(log.NewNopLogger())
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
-	} else if val != 20 {
-		t.Errorf("Unexpected collection count %d, expected 20", val)
+	} else if val != 40 {
+		t.Errorf("Unexpected collection count %d, expected 40", val)
 	}
 	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
 		"gpfs_fs_used_inodes", "gpfs_fs_free_inodes", "gpfs_fs_allocated_inodes", "gpfs_fs_inodes",
 		"gpfs_fs_free_bytes", "gpfs_fs_free_percent", "gpfs_fs_size_bytes",
 		"gpfs_fs_pool_free_bytes", "gpfs_fs_pool_free_fragments_bytes",
 		"gpfs_fs_pool_max_disk_size_bytes", "gpfs_fs_pool_total_bytes",
-		"gpfs_fs_metadata_size_bytes", "gpfs_fs_metadata_free_bytes", "gpfs_fs_metadata_free_percent"); err != nil {
+		"gpfs_fs_metadata_size_bytes", "gpfs_fs_metadata_free_bytes", "gpfs_fs_metadata_free_percent",
+		"gpfs_fs_used_bytes", "gpfs_fs_metadata_used_bytes", "gpfs_fs_pool_used_bytes"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestUsedBytes(t *testing.T) {
+	if val := usedBytes(100, 40); val != 60 {
+		t.Errorf("Unexpected used bytes %v, expected 60", val)
+	}
+	if val := usedBytes(100, 100.5); val != 0 {
+		t.Errorf("Unexpected used bytes %v, expected 0", val)
+	}
+}
+
+func TestMmdfCollectorPoolFilter(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.mmdf.pool-exclude=^sys"}); err != nil {
+		t.Fatal(err)
+	}
+	filesystems := "project"
+	configFilesystems = &filesystems
+	MmdfExec = func(fs string, ctx context.Context) (string, error) {
+		return mmdfStdout, nil
+	}
+	expected := `
+		# HELP gpfs_fs_pool_excluded_count GPFS count of pools excluded from pool metrics
+		# TYPE gpfs_fs_pool_excluded_count gauge
+		gpfs_fs_pool_excluded_count{fs="project",remote_cluster=""} 1
+		# HELP gpfs_fs_pool_total_bytes GPFS pool total size in bytes
+		# TYPE gpfs_fs_pool_total_bytes gauge
+		gpfs_fs_pool_total_bytes{fs="project",pool="data",remote_cluster=""} 3138000816963584
+	`
+	collector := NewMmdfCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 33 {
+		t.Errorf("Unexpected collection count %d, expected 33", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
+		"gpfs_fs_pool_excluded_count", "gpfs_fs_pool_total_bytes"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.mmdf.pool-include=^sys"}); err != nil {
+		t.Fatal(err)
+	}
+	expected = `
+		# HELP gpfs_fs_pool_excluded_count GPFS count of pools excluded from pool metrics
+		# TYPE gpfs_fs_pool_excluded_count gauge
+		gpfs_fs_pool_excluded_count{fs="project",remote_cluster=""} 1
+		# HELP gpfs_fs_pool_total_bytes GPFS pool total size in bytes
+		# TYPE gpfs_fs_pool_total_bytes gauge
+		gpfs_fs_pool_total_bytes{fs="project",pool="system",remote_cluster=""} 802107691106304
+	`
+	collector = NewMmdfCollector(log.NewNopLogger())
+	gatherers = setupGatherer(collector)
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
+		"gpfs_fs_pool_excluded_count", "gpfs_fs_pool_total_bytes"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestMmdfCollectorNSDMetrics(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.mmdf.nsd-metrics", "--collector.mmdf.pool-exclude=^sys"}); err != nil {
+		t.Fatal(err)
+	}
+	filesystems := "project"
+	configFilesystems = &filesystems
+	MmdfExec = func(fs string, ctx context.Context) (string, error) {
+		return mmdfStdout, nil
+	}
+	expected := `
+		# HELP gpfs_fs_nsd_free_bytes GPFS NSD free size in bytes
+		# TYPE gpfs_fs_nsd_free_bytes gauge
+		gpfs_fs_nsd_free_bytes{failure_group="200",fs="project",nsd="P_DATA_VD02",pool="data",remote_cluster=""} 6239145689088
+		# HELP gpfs_fs_nsd_free_percent GPFS NSD free percent
+		# TYPE gpfs_fs_nsd_free_percent gauge
+		gpfs_fs_nsd_free_percent{failure_group="200",fs="project",nsd="P_DATA_VD02",pool="data",remote_cluster=""} 13
+		# HELP gpfs_fs_nsd_size_bytes GPFS NSD size in bytes
+		# TYPE gpfs_fs_nsd_size_bytes gauge
+		gpfs_fs_nsd_size_bytes{failure_group="200",fs="project",nsd="P_DATA_VD02",pool="data",remote_cluster=""} 47888885350400
+	`
+	collector := NewMmdfCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 36 {
+		t.Errorf("Unexpected collection count %d, expected 36", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
+		"gpfs_fs_nsd_free_bytes", "gpfs_fs_nsd_free_percent", "gpfs_fs_nsd_size_bytes"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestMmdfCollectorSuspended(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	filesystems := "project"
+	configFilesystems = &filesystems
+	MmdfExec = func(fs string, ctx context.Context) (string, error) {
+		return mmdfStdoutSuspended, nil
+	}
+	expected := `
+		# HELP gpfs_fs_pool_suspended_bytes GPFS pool size in bytes of NSDs not available for block allocation
+		# TYPE gpfs_fs_pool_suspended_bytes gauge
+		gpfs_fs_pool_suspended_bytes{fs="project",pool="data",remote_cluster=""} 95777770700800
+		gpfs_fs_pool_suspended_bytes{fs="project",pool="system",remote_cluster=""} 0
+		# HELP gpfs_fs_pool_suspended_free_bytes GPFS pool free size in bytes of NSDs not available for block allocation
+		# TYPE gpfs_fs_pool_suspended_free_bytes gauge
+		gpfs_fs_pool_suspended_free_bytes{fs="project",pool="data",remote_cluster=""} 6334291378176
+		gpfs_fs_pool_suspended_free_bytes{fs="project",pool="system",remote_cluster=""} 0
+	`
+	collector := NewMmdfCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
+		"gpfs_fs_pool_suspended_bytes", "gpfs_fs_pool_suspended_free_bytes"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestParseMmdfIncomplete(t *testing.T) {
+	truncated := mmdfStdout[:strings.Index(mmdfStdout, "mmdf:fsTotal:0:1")] + "mmdf:fsTot"
+	dfmetrics, err := parse_mmdf(truncated, log.NewNopLogger())
+	var incompleteErr *IncompleteOutputError
+	if !errors.As(err, &incompleteErr) {
+		t.Fatalf("Expected IncompleteOutputError, got %v", err)
+	}
+	if !SliceContains(incompleteErr.Missing, "fsTotal") {
+		t.Errorf("Expected missing fsTotal, got %v", incompleteErr.Missing)
+	}
+	if dfmetrics.InodesFree != 0 || len(dfmetrics.Pools) != 0 {
+		t.Errorf("Unexpected metrics for incomplete output, got %v", dfmetrics)
+	}
+	if _, err := parse_mmdf("", log.NewNopLogger()); !errors.As(err, &incompleteErr) {
+		t.Errorf("Expected IncompleteOutputError for empty output, got %v", err)
+	}
+}
+
+func TestMmdfCollectorIncomplete(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	filesystems := "project"
+	configFilesystems = &filesystems
+	parseIncomplete.Reset()
+	defer parseIncomplete.Reset()
+	MmdfExec = func(fs string, ctx context.Context) (string, error) {
+		return mmdfStdout[:strings.Index(mmdfStdout, "mmdf:fsTotal:0:1")], nil
+	}
+	expected := `
+		# HELP gpfs_exporter_collect_error Indicates if error has occurred during collection
+		# TYPE gpfs_exporter_collect_error gauge
+		gpfs_exporter_collect_error{collector="mmdf-project"} 1
+	`
+	collector := NewMmdfCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
+		"gpfs_exporter_collect_error", "gpfs_fs_free_bytes", "gpfs_fs_total_bytes"); err != nil {
 		t.Errorf("unexpected collecting result:\n%s", err)
 	}
+	if val := testutil.ToFloat64(parseIncomplete.WithLabelValues("mmdf-project")); val != 1 {
+		t.Errorf("Unexpected parse incomplete value %v", val)
+	}
+	MmdfExec = func(fs string, ctx context.Context) (string, error) {
+		return mmdfStdout, nil
+	}
+	if _, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if val := testutil.CollectAndCount(parseIncomplete); val != 0 {
+		t.Errorf("Unexpected parse incomplete count %d, expected 0", val)
+	}
 }
 
 func TestMmdfCollectorNoMetadata(t *testing.T) {
@@ -249,45 +464,45 @@ func TestMmdfCollectorNoMetadata(t *testing.T) {
 	expected := `
 		# HELP gpfs_fs_allocated_inodes GPFS filesystem inodes allocated
 		# TYPE gpfs_fs_allocated_inodes gauge
-		gpfs_fs_allocated_inodes{fs="project"} 915043328
+		gpfs_fs_allocated_inodes{fs="project",remote_cluster=""} 915043328
 		# HELP gpfs_fs_free_bytes GPFS filesystem free size in bytes
 		# TYPE gpfs_fs_free_bytes gauge
-		gpfs_fs_free_bytes{fs="project"} 492750870413312
+		gpfs_fs_free_bytes{fs="project",remote_cluster=""} 492750870413312
 		# HELP gpfs_fs_free_inodes GPFS filesystem inodes free
 		# TYPE gpfs_fs_free_inodes gauge
-		gpfs_fs_free_inodes{fs="project"} 484301506
+		gpfs_fs_free_inodes{fs="project",remote_cluster=""} 484301506
 		# HELP gpfs_fs_inodes GPFS filesystem inodes total
 		# TYPE gpfs_fs_inodes gauge
-		gpfs_fs_inodes{fs="project"} 1332164000
+		gpfs_fs_inodes{fs="project",remote_cluster=""} 1332164000
 		# HELP gpfs_fs_pool_free_bytes GPFS pool free size in bytes
 		# TYPE gpfs_fs_pool_free_bytes gauge
-		gpfs_fs_pool_free_bytes{fs="project",pool="data"} 1374578991431680
-		gpfs_fs_pool_free_bytes{fs="project",pool="system"} 389698396618752
+		gpfs_fs_pool_free_bytes{fs="project",pool="data",remote_cluster=""} 1374578991431680
+		gpfs_fs_pool_free_bytes{fs="project",pool="system",remote_cluster=""} 389698396618752
 		# HELP gpfs_fs_pool_free_fragments_bytes GPFS pool free fragments in bytes
 		# TYPE gpfs_fs_pool_free_fragments_bytes gauge
-		gpfs_fs_pool_free_fragments_bytes{fs="project",pool="data"} 2047196315648
-		gpfs_fs_pool_free_fragments_bytes{fs="project",pool="system"} 10265051611136
+		gpfs_fs_pool_free_fragments_bytes{fs="project",pool="data",remote_cluster=""} 2047196315648
+		gpfs_fs_pool_free_fragments_bytes{fs="project",pool="system",remote_cluster=""} 10265051611136
 		# HELP gpfs_fs_pool_max_disk_size_bytes GPFS pool max disk size in bytes
 		# TYPE gpfs_fs_pool_max_disk_size_bytes gauge
-		gpfs_fs_pool_max_disk_size_bytes{fs="project",pool="data"} 10387223769776128
-		gpfs_fs_pool_max_disk_size_bytes{fs="project",pool="system"} 1180755212369920
+		gpfs_fs_pool_max_disk_size_bytes{fs="project",pool="data",remote_cluster=""} 10387223769776128
+		gpfs_fs_pool_max_disk_size_bytes{fs="project",pool="system",remote_cluster=""} 1180755212369920
 		# HELP gpfs_fs_pool_total_bytes GPFS pool total size in bytes
 		# TYPE gpfs_fs_pool_total_bytes gauge
-		gpfs_fs_pool_total_bytes{fs="project",pool="data"} 3138000816963584
-		gpfs_fs_pool_total_bytes{fs="project",pool="system"} 802107691106304
+		gpfs_fs_pool_total_bytes{fs="project",pool="data",remote_cluster=""} 3138000816963584
+		gpfs_fs_pool_total_bytes{fs="project",pool="system",remote_cluster=""} 802107691106304
 		# HELP gpfs_fs_size_bytes GPFS filesystem total size in bytes
 		# TYPE gpfs_fs_size_bytes gauge
-		gpfs_fs_size_bytes{fs="project"} 3749557989015552
+		gpfs_fs_size_bytes{fs="project",remote_cluster=""} 3749557989015552
 		# HELP gpfs_fs_used_inodes GPFS filesystem inodes used
 		# TYPE gpfs_fs_used_inodes gauge
-		gpfs_fs_used_inodes{fs="project"} 430741822
+		gpfs_fs_used_inodes{fs="project",remote_cluster=""} 430741822
 	`
 	collector := NewMmdfCollector(log.NewNopLogger())
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
-	} else if val != 18 {
-		t.Errorf("Unexpected collection count %d, expected 18", val)
+	} else if val != 37 {
+		t.Errorf("Unexpected collection count %d, expected 37", val)
 	}
 	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
 		"gpfs_fs_used_inodes", "gpfs_fs_free_inodes", "gpfs_fs_allocated_inodes", "gpfs_fs_inodes",
@@ -318,51 +533,51 @@ mmlsfs::0:1:::project:defaultMountPoint:%2Ffs%2Fproject::
 	expected := `
 		# HELP gpfs_fs_free_bytes GPFS filesystem free size in bytes
 		# TYPE gpfs_fs_free_bytes gauge
-		gpfs_fs_free_bytes{fs="project"} 492750870413312
+		gpfs_fs_free_bytes{fs="project",remote_cluster=""} 492750870413312
 		# HELP gpfs_fs_allocated_inodes GPFS filesystem inodes allocated
 		# TYPE gpfs_fs_allocated_inodes gauge
-		gpfs_fs_allocated_inodes{fs="project"} 915043328
+		gpfs_fs_allocated_inodes{fs="project",remote_cluster=""} 915043328
 		# HELP gpfs_fs_free_inodes GPFS filesystem inodes free
 		# TYPE gpfs_fs_free_inodes gauge
-		gpfs_fs_free_inodes{fs="project"} 484301506
+		gpfs_fs_free_inodes{fs="project",remote_cluster=""} 484301506
 		# HELP gpfs_fs_inodes GPFS filesystem inodes total
 		# TYPE gpfs_fs_inodes gauge
-		gpfs_fs_inodes{fs="project"} 1332164000
+		gpfs_fs_inodes{fs="project",remote_cluster=""} 1332164000
 		# HELP gpfs_fs_used_inodes GPFS filesystem inodes used
 		# TYPE gpfs_fs_used_inodes gauge
-		gpfs_fs_used_inodes{fs="project"} 430741822
+		gpfs_fs_used_inodes{fs="project",remote_cluster=""} 430741822
 		# HELP gpfs_fs_metadata_free_bytes GPFS metadata free size in bytes
 		# TYPE gpfs_fs_metadata_free_bytes gauge
-		gpfs_fs_metadata_free_bytes{fs="project"} 6155570511872
+		gpfs_fs_metadata_free_bytes{fs="project",remote_cluster=""} 6155570511872
 		# HELP gpfs_fs_metadata_size_bytes GPFS total metadata size in bytes
 		# TYPE gpfs_fs_metadata_size_bytes gauge
-		gpfs_fs_metadata_size_bytes{fs="project"} 14224931684352
+		gpfs_fs_metadata_size_bytes{fs="project",remote_cluster=""} 14224931684352
 		# HELP gpfs_fs_pool_free_bytes GPFS pool free size in bytes
 		# TYPE gpfs_fs_pool_free_bytes gauge
-		gpfs_fs_pool_free_bytes{fs="project",pool="data"} 1374578991431680
-		gpfs_fs_pool_free_bytes{fs="project",pool="system"} 389698396618752
+		gpfs_fs_pool_free_bytes{fs="project",pool="data",remote_cluster=""} 1374578991431680
+		gpfs_fs_pool_free_bytes{fs="project",pool="system",remote_cluster=""} 389698396618752
 		# HELP gpfs_fs_pool_free_fragments_bytes GPFS pool free fragments in bytes
 		# TYPE gpfs_fs_pool_free_fragments_bytes gauge
-		gpfs_fs_pool_free_fragments_bytes{fs="project",pool="data"} 2047196315648
-		gpfs_fs_pool_free_fragments_bytes{fs="project",pool="system"} 10265051611136
+		gpfs_fs_pool_free_fragments_bytes{fs="project",pool="data",remote_cluster=""} 2047196315648
+		gpfs_fs_pool_free_fragments_bytes{fs="project",pool="system",remote_cluster=""} 10265051611136
 		# HELP gpfs_fs_pool_max_disk_size_bytes GPFS pool max disk size in bytes
 		# TYPE gpfs_fs_pool_max_disk_size_bytes gauge
-		gpfs_fs_pool_max_disk_size_bytes{fs="project",pool="data"} 10387223769776128
-		gpfs_fs_pool_max_disk_size_bytes{fs="project",pool="system"} 1180755212369920
+		gpfs_fs_pool_max_disk_size_bytes{fs="project",pool="data",remote_cluster=""} 10387223769776128
+		gpfs_fs_pool_max_disk_size_bytes{fs="project",pool="system",remote_cluster=""} 1180755212369920
 		# HELP gpfs_fs_pool_total_bytes GPFS pool total size in bytes
 		# TYPE gpfs_fs_pool_total_bytes gauge
-		gpfs_fs_pool_total_bytes{fs="project",pool="data"} 3138000816963584
-		gpfs_fs_pool_total_bytes{fs="project",pool="system"} 802107691106304
+		gpfs_fs_pool_total_bytes{fs="project",pool="data",remote_cluster=""} 3138000816963584
+		gpfs_fs_pool_total_bytes{fs="project",pool="system",remote_cluster=""} 802107691106304
 		# HELP gpfs_fs_size_bytes GPFS filesystem total size in bytes
 		# TYPE gpfs_fs_size_bytes gauge
-		gpfs_fs_size_bytes{fs="project"} 3749557989015552
+		gpfs_fs_size_bytes{fs="project",remote_cluster=""} 3749557989015552
 	`
 	collector := NewMmdfCollector(log.NewNopLogger())
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
-	} else if val != 22 {
-		t.Errorf("Unexpected collection count %d, expected 22", val)
+	} else if val != 50 {
+		t.Errorf("Unexpected collection count %d, expected 50", val)
 	}
 	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
 		"gpfs_fs_used_inodes", "gpfs_fs_free_inodes", "gpfs_fs_allocated_inodes", "gpfs_fs_inodes",
@@ -374,6 +589,155 @@ mmlsfs::0:1:::project:defaultMountPoint:%2Ffs%2Fproject::
 	}
 }
 
+func TestMmdfCollectorRemote(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	filesystems := ""
+	configFilesystems = &filesystems
+	MmdfExec = func(fs string, ctx context.Context) (string, error) {
+		if fs != "ess01:project" {
+			return "", fmt.Errorf("Unexpected filesystem %s", fs)
+		}
+		return mmdfStdout, nil
+	}
+	defer func() {
+		MmdfExec = func(fs string, ctx context.Context) (string, error) {
+			return mmdfStdout, nil
+		}
+	}()
+	mmlsfsStdout = `
+fs::HEADER:version:reserved:reserved:deviceName:fieldName:data:remarks:
+mmlsfs::0:1:::ess01%3Aproject:defaultMountPoint:%2Ffs%2Fproject::
+`
+	MmlsfsExec = func(ctx context.Context) (string, error) {
+		return mmlsfsStdout, nil
+	}
+	expected := `
+		# HELP gpfs_fs_pool_total_bytes GPFS pool total size in bytes
+		# TYPE gpfs_fs_pool_total_bytes gauge
+		gpfs_fs_pool_total_bytes{fs="project",pool="data",remote_cluster="ess01"} 3138000816963584
+		gpfs_fs_pool_total_bytes{fs="project",pool="system",remote_cluster="ess01"} 802107691106304
+		# HELP gpfs_fs_used_inodes GPFS filesystem inodes used
+		# TYPE gpfs_fs_used_inodes gauge
+		gpfs_fs_used_inodes{fs="project",remote_cluster="ess01"} 430741822
+	`
+	collector := NewMmdfCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
+		"gpfs_fs_used_inodes", "gpfs_fs_pool_total_bytes"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestMmdfCollectorMmlsfsExclude(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.filesystems-exclude=^remote"}); err != nil {
+		t.Fatal(err)
+	}
+	filesystems := ""
+	configFilesystems = &filesystems
+	var mu sync.Mutex
+	var executed []string
+	MmdfExec = func(fs string, ctx context.Context) (string, error) {
+		mu.Lock()
+		executed = append(executed, fs)
+		mu.Unlock()
+		return mmdfStdout, nil
+	}
+	MmlsfsExec = func(ctx context.Context) (string, error) {
+		return `
+fs::HEADER:version:reserved:reserved:deviceName:fieldName:data:remarks:
+mmlsfs::0:1:::project:defaultMountPoint:%2Ffs%2Fproject::
+mmlsfs::0:1:::remote_scratch:defaultMountPoint:%2Ffs%2Fscratch::
+`, nil
+	}
+	expected := `
+		# HELP gpfs_exporter_filesystems_excluded Number of filesystems discovered with mmlsfs that were excluded from collection
+		# TYPE gpfs_exporter_filesystems_excluded gauge
+		gpfs_exporter_filesystems_excluded{collector="mmdf"} 1
+	`
+	collector := NewMmdfCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 50 {
+		t.Errorf("Unexpected collection count %d, expected 50", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_filesystems_excluded"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, fs := range executed {
+		if fs != "project" {
+			t.Errorf("Unexpected mmdf execution for filesystem %s", fs)
+		}
+	}
+	if len(executed) == 0 {
+		t.Errorf("Expected mmdf execution for filesystem project")
+	}
+}
+
+func TestMmdfCollectorPanic(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	filesystems := "project,scratch"
+	configFilesystems = &filesystems
+	MmdfExec = func(fs string, ctx context.Context) (string, error) {
+		if fs == "scratch" {
+			panic("unexpected output")
+		}
+		return mmdfStdout, nil
+	}
+	expected := `
+		# HELP gpfs_exporter_collect_error Indicates if error has occurred during collection
+		# TYPE gpfs_exporter_collect_error gauge
+		gpfs_exporter_collect_error{collector="mmdf-project"} 0
+		gpfs_exporter_collect_error{collector="mmdf-scratch"} 1
+		# HELP gpfs_fs_size_bytes GPFS filesystem total size in bytes
+		# TYPE gpfs_fs_size_bytes gauge
+		gpfs_fs_size_bytes{fs="project",remote_cluster=""} 3749557989015552
+	`
+	collector := NewMmdfCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
+		"gpfs_exporter_collect_error", "gpfs_fs_size_bytes"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestMmdfCollectorFilesystemsWhitespace(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	filesystems := "project, scratch"
+	configFilesystems = &filesystems
+	var mutex sync.Mutex
+	var queried []string
+	MmdfExec = func(fs string, ctx context.Context) (string, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		queried = append(queried, fs)
+		return "", fmt.Errorf("Error")
+	}
+	expected := `
+		# HELP gpfs_exporter_collect_error Indicates if error has occurred during collection
+		# TYPE gpfs_exporter_collect_error gauge
+		gpfs_exporter_collect_error{collector="mmdf-project"} 1
+		gpfs_exporter_collect_error{collector="mmdf-scratch"} 1
+	`
+	collector := NewMmdfCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collect_error"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+	sort.Strings(queried)
+	if !reflect.DeepEqual(queried, []string{"project", "scratch"}) {
+		t.Errorf("Unexpected filesystems queried: %v", queried)
+	}
+}
+
 func TestMmdfCollectorError(t *testing.T) {
 	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
 		t.Fatal(err)
@@ -392,8 +756,8 @@ func TestMmdfCollectorError(t *testing.T) {
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
-	} else if val != 4 {
-		t.Errorf("Unexpected collection count %d, expected 4", val)
+	} else if val != 15 {
+		t.Errorf("Unexpected collection count %d, expected 15", val)
 	}
 	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collect_error"); err != nil {
 		t.Errorf("unexpected collecting result:\n%s", err)
@@ -418,8 +782,8 @@ func TestMmdfCollectorTimeout(t *testing.T) {
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
-	} else if val != 4 {
-		t.Errorf("Unexpected collection count %d, expected 4", val)
+	} else if val != 15 {
+		t.Errorf("Unexpected collection count %d, expected 15", val)
 	}
 	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collect_timeout"); err != nil {
 		t.Errorf("unexpected collecting result:\n%s", err)
@@ -444,8 +808,8 @@ func TestMmdfCollectorMmlsfsError(t *testing.T) {
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
-	} else if val != 2 {
-		t.Errorf("Unexpected collection count %d, expected 2", val)
+	} else if val != 9 {
+		t.Errorf("Unexpected collection count %d, expected 9", val)
 	}
 	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collect_error"); err != nil {
 		t.Errorf("unexpected collecting result:\n%s", err)
@@ -470,10 +834,24 @@ func TestMmdfCollectorMmlsfsTimeout(t *testing.T) {
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
-	} else if val != 2 {
-		t.Errorf("Unexpected collection count %d, expected 2", val)
+	} else if val != 9 {
+		t.Errorf("Unexpected collection count %d, expected 9", val)
 	}
 	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collect_timeout"); err != nil {
 		t.Errorf("unexpected collecting result:\n%s", err)
 	}
 }
+
+func TestParseMmdfInsertedColumn(t *testing.T) {
+	expected, err := parse_mmdf(mmdfStdout, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := parse_mmdf(insertColumn(mmdfStdout, 7), log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Unexpected metrics with inserted column\nGot: %v\nExpected: %v", got, expected)
+	}
+}
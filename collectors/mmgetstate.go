@@ -14,7 +14,6 @@
 package collectors
 
 import (
-	"bytes"
 	"context"
 	"strings"
 	"time"
@@ -46,7 +45,7 @@ func init() {
 
 func NewMmgetstateCollector(logger log.Logger) Collector {
 	return &MmgetstateCollector{
-		state: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "state"),
+		state: newDesc(prometheus.BuildFQName(namespace, "", "state"),
 			"GPFS state", []string{"state"}, nil),
 		logger: logger,
 	}
@@ -59,15 +58,11 @@ func (c *MmgetstateCollector) Describe(ch chan<- *prometheus.Desc) {
 func (c *MmgetstateCollector) Collect(ch chan<- prometheus.Metric) {
 	level.Debug(c.logger).Log("msg", "Collecting mmgetstate metrics")
 	collectTime := time.Now()
-	timeout := 0
-	errorMetric := 0
 	metric, err := c.collect()
 	if err == context.DeadlineExceeded {
 		level.Error(c.logger).Log("msg", "Timeout executing mmgetstate")
-		timeout = 1
 	} else if err != nil {
 		level.Error(c.logger).Log("msg", err)
-		errorMetric = 1
 	}
 	for _, state := range mmgetstateStates {
 		if state == metric.state {
@@ -81,39 +76,32 @@ func (c *MmgetstateCollector) Collect(ch chan<- prometheus.Metric) {
 	} else {
 		ch <- prometheus.MustNewConstMetric(c.state, prometheus.GaugeValue, 0, "unknown")
 	}
-	ch <- prometheus.MustNewConstMetric(collectError, prometheus.GaugeValue, float64(errorMetric), "mmgetstate")
-	ch <- prometheus.MustNewConstMetric(collecTimeout, prometheus.GaugeValue, float64(timeout), "mmgetstate")
-	ch <- prometheus.MustNewConstMetric(collectDuration, prometheus.GaugeValue, time.Since(collectTime).Seconds(), "mmgetstate")
+	emitCollectorStatus(ch, "mmgetstate", err, collectTime, recordCount(metric.state != ""))
 }
 
 func (c *MmgetstateCollector) collect() (MmgetstateMetrics, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(*mmgetstateTimeout)*time.Second)
+	ctx, cancel := commandContext("mmgetstate", *mmgetstateTimeout)
 	defer cancel()
-	out, err := MmgetstateExec(ctx)
+	out, err := execRetry(ctx, "mmgetstate", func() (string, error) {
+		return MmgetstateExec(ctx)
+	})
 	if err != nil {
 		return MmgetstateMetrics{}, err
 	}
+	commandDump.record("mmgetstate", out)
 	metric := mmgetstate_parse(out)
+	commandDump.recordParsed("mmgetstate", metric)
 	return metric, nil
 }
 
 func mmgetstate(ctx context.Context) (string, error) {
-	cmd := execCommand(ctx, *sudoCmd, "/usr/lpp/mmfs/bin/mmgetstate", "-Y")
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	err := cmd.Run()
-	if ctx.Err() == context.DeadlineExceeded {
-		return "", ctx.Err()
-	} else if err != nil {
-		return "", err
-	}
-	return out.String(), nil
+	return RunMMCommand(ctx, "mmgetstate", "-Y")
 }
 
 func mmgetstate_parse(out string) MmgetstateMetrics {
 	metric := MmgetstateMetrics{}
 	lines := strings.Split(out, "\n")
-	var headers []string
+	var headers map[string]int
 	for _, l := range lines {
 		if !strings.HasPrefix(l, "mmgetstate") {
 			continue
@@ -122,18 +110,12 @@ func mmgetstate_parse(out string) MmgetstateMetrics {
 		if len(items) < 3 {
 			continue
 		}
-		var values []string
 		if items[2] == "HEADER" {
-			headers = append(headers, items...)
+			headers = HeaderIndexMap(items)
 			continue
-		} else {
-			values = append(values, items...)
 		}
-		for i, h := range headers {
-			switch h {
-			case "state":
-				metric.state = values[i]
-			}
+		if state, ok := headerValue(items, headers, "state"); ok {
+			metric.state = state
 		}
 	}
 	return metric
@@ -17,6 +17,7 @@ import (
 	"context"
 	"fmt"
 	"os/exec"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -35,8 +36,8 @@ mmgetstate::0:1:::ib-proj-nsd05.domain:11:active:4:7:1122::(undefined):
 
 func TestNewGPFSCollector(t *testing.T) {
 	ret := NewGPFSCollector(log.NewNopLogger())
-	if len(ret.Collectors) != 4 {
-		t.Errorf("Unexpected number of collectors, expected 4, got %d", len(ret.Collectors))
+	if len(ret.Collectors) != 5 {
+		t.Errorf("Unexpected number of collectors, expected 5, got %d", len(ret.Collectors))
 	}
 }
 
@@ -114,8 +115,8 @@ func TestMmgetstateCollector(t *testing.T) {
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
-	} else if val != 7 {
-		t.Errorf("Unexpected collection count %d, expected 7", val)
+	} else if val != 16 {
+		t.Errorf("Unexpected collection count %d, expected 16", val)
 	}
 	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_state"); err != nil {
 		t.Errorf("unexpected collecting result:\n%s", err)
@@ -138,8 +139,8 @@ func TestMMgetstateCollectorError(t *testing.T) {
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
-	} else if val != 7 {
-		t.Errorf("Unexpected collection count %d, expected 7", val)
+	} else if val != 16 {
+		t.Errorf("Unexpected collection count %d, expected 16", val)
 	}
 	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collect_error"); err != nil {
 		t.Errorf("unexpected collecting result:\n%s", err)
@@ -162,10 +163,56 @@ func TestMMgetstateCollectorTimeout(t *testing.T) {
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
-	} else if val != 7 {
-		t.Errorf("Unexpected collection count %d, expected 7", val)
+	} else if val != 16 {
+		t.Errorf("Unexpected collection count %d, expected 16", val)
 	}
 	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collect_timeout"); err != nil {
 		t.Errorf("unexpected collecting result:\n%s", err)
 	}
 }
+
+func TestMMgetstateCollectorRetry(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.retries=2", "--collector.retry-backoff=1ms"}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		*retries = 0
+		*retryBackoff = time.Second
+	}()
+	defer commandRetries.Reset()
+	attempts := 0
+	MmgetstateExec = func(ctx context.Context) (string, error) {
+		attempts++
+		if attempts <= 2 {
+			return "", fmt.Errorf("mmcommon: lock is busy")
+		}
+		return mmgetstateStdout, nil
+	}
+	expected := `
+		# HELP gpfs_exporter_collect_success Indicates the collector completed without error or timeout and parsed at least one record
+		# TYPE gpfs_exporter_collect_success gauge
+		gpfs_exporter_collect_success{collector="mmgetstate"} 1
+	`
+	collector := NewMmgetstateCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collect_success"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+	if attempts != 3 {
+		t.Errorf("Unexpected number of attempts %d, expected 3", attempts)
+	}
+	if val := testutil.ToFloat64(commandRetries.WithLabelValues("mmgetstate")); val != 2 {
+		t.Errorf("Unexpected command retries %v, expected 2", val)
+	}
+}
+
+func TestParseMmgetstateInsertedColumn(t *testing.T) {
+	expected := mmgetstate_parse(mmgetstateStdout)
+	if expected.state == "" {
+		t.Fatal("Expected state to be parsed")
+	}
+	got := mmgetstate_parse(insertColumn(mmgetstateStdout, 7))
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Unexpected metrics with inserted column\nGot: %v\nExpected: %v", got, expected)
+	}
+}
@@ -14,13 +14,13 @@
 package collectors
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/alecthomas/kingpin/v2"
@@ -31,34 +31,96 @@ import (
 
 var (
 	mmhealthTimeout           = kingpin.Flag("collector.mmhealth.timeout", "Timeout for mmhealth execution").Default("5").Int()
+	mmhealthCluster           = kingpin.Flag("collector.mmhealth.cluster", "Collect the health of all nodes with 'mmhealth node show -N all' and add a node label").Default("false").Bool()
+	mmhealthClusterTimeout    = kingpin.Flag("collector.mmhealth.cluster-timeout", "Timeout for mmhealth execution with --collector.mmhealth.cluster").Default("30").Int()
+	mmhealthIgnoredNode       = kingpin.Flag("collector.mmhealth.ignored-node", "Regex of nodes to ignore with --collector.mmhealth.cluster").Default("^$").String()
 	mmhealthIgnoredComponent  = kingpin.Flag("collector.mmhealth.ignored-component", "Regex of components to ignore").Default("^$").String()
 	mmhealthIgnoredEntityName = kingpin.Flag("collector.mmhealth.ignored-entityname", "Regex of entity names to ignore").Default("^$").String()
 	mmhealthIgnoredEntityType = kingpin.Flag("collector.mmhealth.ignored-entitytype", "Regex of entity types to ignore").Default("^$").String()
 	mmhealthIgnoredEvent      = kingpin.Flag("collector.mmhealth.ignored-event", "Regex of events to ignore").Default("").String()
+	mmhealthIgnoredStatus     = kingpin.Flag("collector.mmhealth.ignored-status", "Regex of status values to ignore").Default("^$").String()
+	mmhealthIncludeHidden     = kingpin.Flag("collector.mmhealth.include-hidden", "Include events mmhealth marks as hidden").Default("false").Bool()
+	mmhealthMaxEvents         = kingpin.Flag("collector.mmhealth.max-events-per-name", "Maximum number of series for each event name, 0 disables the limit").Default("50").Int()
+	mmhealthStructureEvents   = kingpin.Flag("collector.mmhealth.fs-structure-events", "Regex of FILESYSTEM events counted by gpfs_fs_structure_errors").Default("^(fsstruct_error|fserr.+)$").String()
 	mmhealthMap               = map[string]string{
-		"component":  "Component",
-		"entityname": "EntityName",
-		"entitytype": "EntityType",
-		"status":     "Status",
-		"event":      "Event",
+		"node":             "Node",
+		"component":        "Component",
+		"entityname":       "EntityName",
+		"entitytype":       "EntityType",
+		"status":           "Status",
+		"event":            "Event",
+		"identifier":       "Identifier",
+		"ishidden":         "Hidden",
+		"laststatuschange": "LastStatusChange",
 	}
 	mmhealthStatuses = []string{"CHECKING", "DEGRADED", "DEPEND", "DISABLED", "FAILED", "HEALTHY", "STARTING", "STOPPED", "SUSPENDED", "TIPS"}
 	mmhealthExec     = mmhealth
+	// mmhealthOverflowLogged is the dropped count last logged at warning level for each event
+	mmhealthOverflowLogged = &overflowLogger{counts: make(map[string]float64)}
 )
 
+type overflowLogger struct {
+	sync.Mutex
+	counts map[string]float64
+}
+
+// log warns about the events that dropped series when the count of an event changed since it was last
+// logged, unchanged counts are logged at debug level. Events no longer dropping series are forgotten.
+func (o *overflowLogger) log(overflow map[string]float64, logger log.Logger) {
+	o.Lock()
+	defer o.Unlock()
+	for event := range o.counts {
+		if _, ok := overflow[event]; !ok {
+			delete(o.counts, event)
+		}
+	}
+	for event, count := range overflow {
+		logLevel := level.Warn
+		if last, ok := o.counts[event]; ok && last == count {
+			logLevel = level.Debug
+		}
+		o.counts[event] = count
+		logLevel(logger).Log("msg", "Limit of series reached for health event", "event", event, "dropped", count)
+	}
+}
+
 type HealthMetric struct {
 	Type       string
+	Node       string
 	Component  string
 	EntityName string
 	EntityType string
 	Status     string
 	Event      string
+	Identifier string
+	Hidden     string
+	// LastStatusChange is the raw laststatuschange value of State rows
+	LastStatusChange string
+	StatusChange     float64
+}
+
+type mmhealthFilter struct {
+	node       *regexp.Regexp
+	component  *regexp.Regexp
+	entityName *regexp.Regexp
+	entityType *regexp.Regexp
+	event      *regexp.Regexp
+	status     *regexp.Regexp
+	eventKeys  []string
+	logger     log.Logger
 }
 
 type MmhealthCollector struct {
-	State  *prometheus.Desc
-	Event  *prometheus.Desc
-	logger log.Logger
+	State         *prometheus.Desc
+	Event         *prometheus.Desc
+	EventOverflow *prometheus.Desc
+	Summary       *prometheus.Desc
+	StatusChange  *prometheus.Desc
+	// StructureErrors is the number of filesystem structure error events of each filesystem
+	StructureErrors *prometheus.Desc
+	structureEvents *regexp.Regexp
+	cluster         bool
+	logger          log.Logger
 }
 
 func init() {
@@ -66,36 +128,75 @@ func init() {
 }
 
 func NewMmhealthCollector(logger log.Logger) Collector {
+	labels := func(extra ...string) []string {
+		l := []string{"component", "entityname", "entitytype"}
+		if *mmhealthCluster {
+			l = append(l, "node")
+		}
+		return append(l, extra...)
+	}
+	fsLabels := []string{"fs"}
+	if *mmhealthCluster {
+		fsLabels = append(fsLabels, "node")
+	}
 	return &MmhealthCollector{
-		State: prometheus.NewDesc(prometheus.BuildFQName(namespace, "health", "status"),
-			"GPFS health status", []string{"component", "entityname", "entitytype", "status"}, nil),
-		Event: prometheus.NewDesc(prometheus.BuildFQName(namespace, "health", "event"),
-			"GPFS health event", []string{"component", "entityname", "entitytype", "event"}, nil),
-		logger: logger,
+		State: newDesc(prometheus.BuildFQName(namespace, "health", "status"),
+			"GPFS health status", labels("status"), nil),
+		Event: newDesc(prometheus.BuildFQName(namespace, "health", "event"),
+			"GPFS health event", labels("event", "identifier"), nil),
+		EventOverflow: newDesc(prometheus.BuildFQName(namespace, "health", "event_overflow_count"),
+			"GPFS count of health events not reported after reaching the limit of series for the event", []string{"event"}, nil),
+		Summary: newDesc(prometheus.BuildFQName(namespace, "health", "status_summary"),
+			"GPFS count of health entities in each status", []string{"status"}, nil),
+		StatusChange: newDesc(prometheus.BuildFQName(namespace, "health", "status_change_timestamp_seconds"),
+			"GPFS health time of the last status change of the entity", labels(), nil),
+		StructureErrors: newDesc(prometheus.BuildFQName(namespace, "fs", "structure_errors"),
+			"GPFS number of active filesystem structure error events of the filesystem", fsLabels, nil),
+		structureEvents: regexp.MustCompile(*mmhealthStructureEvents),
+		cluster:         *mmhealthCluster,
+		logger:          logger,
 	}
 }
 
+// entityLabels returns the label values that identify the entity of a metric followed by values
+func (c *MmhealthCollector) entityLabels(m HealthMetric, values ...string) []string {
+	labels := []string{m.Component, m.EntityName, m.EntityType}
+	if c.cluster {
+		labels = append(labels, m.Node)
+	}
+	return append(labels, values...)
+}
+
 func (c *MmhealthCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- c.State
 	ch <- c.Event
+	ch <- c.EventOverflow
+	ch <- c.Summary
+	ch <- c.StatusChange
+	ch <- c.StructureErrors
 }
 
 func (c *MmhealthCollector) Collect(ch chan<- prometheus.Metric) {
 	level.Debug(c.logger).Log("msg", "Collecting mmhealth metrics")
 	collectTime := time.Now()
-	timeout := 0
-	errorMetric := 0
 	metrics, err := c.collect()
 	if err == context.DeadlineExceeded {
-		timeout = 1
 		level.Error(c.logger).Log("msg", "Timeout executing mmhealth")
 	} else if err != nil {
 		level.Error(c.logger).Log("msg", err)
-		errorMetric = 1
 	}
+	summary := make(map[string]float64)
+	events := make(map[string]int)
+	overflow := make(map[string]float64)
+	structureErrors := c.structureErrors(metrics)
 	for _, m := range metrics {
 		if m.Type == "Event" {
-			ch <- prometheus.MustNewConstMetric(c.Event, prometheus.GaugeValue, 1, m.Component, m.EntityName, m.EntityType, m.Event)
+			if *mmhealthMaxEvents > 0 && events[m.Event] >= *mmhealthMaxEvents {
+				overflow[m.Event]++
+				continue
+			}
+			events[m.Event]++
+			ch <- prometheus.MustNewConstMetric(c.Event, prometheus.GaugeValue, 1, c.entityLabels(m, m.Event, m.Identifier)...)
 			continue
 		}
 		for _, s := range mmhealthStatuses {
@@ -103,52 +204,158 @@ func (c *MmhealthCollector) Collect(ch chan<- prometheus.Metric) {
 			if s == m.Status {
 				value = 1
 			}
-			ch <- prometheus.MustNewConstMetric(c.State, prometheus.GaugeValue, value, m.Component, m.EntityName, m.EntityType, s)
+			ch <- prometheus.MustNewConstMetric(c.State, prometheus.GaugeValue, value, c.entityLabels(m, s)...)
+		}
+		if m.StatusChange != 0 {
+			ch <- prometheus.MustNewConstMetric(c.StatusChange, prometheus.GaugeValue, m.StatusChange, c.entityLabels(m)...)
 		}
 		var unknown float64
 		if !SliceContains(mmhealthStatuses, m.Status) {
 			unknown = 1
 			level.Warn(c.logger).Log("msg", "Unknown status encountered", "status", m.Status,
 				"component", m.Component, "entityname", m.EntityName, "entitytype", m.EntityType)
+			summary["UNKNOWN"]++
+		} else {
+			summary[m.Status]++
 		}
-		ch <- prometheus.MustNewConstMetric(c.State, prometheus.GaugeValue, unknown, m.Component, m.EntityName, m.EntityType, "UNKNOWN")
+		ch <- prometheus.MustNewConstMetric(c.State, prometheus.GaugeValue, unknown, c.entityLabels(m, "UNKNOWN")...)
+	}
+	mmhealthOverflowLogged.log(overflow, c.logger)
+	for event, count := range overflow {
+		ch <- prometheus.MustNewConstMetric(c.EventOverflow, prometheus.GaugeValue, count, event)
+	}
+	for _, e := range structureErrors {
+		ch <- prometheus.MustNewConstMetric(c.StructureErrors, prometheus.GaugeValue, e.Count, e.labels(c.cluster)...)
+	}
+	if err == nil {
+		for _, s := range append(mmhealthStatuses, "UNKNOWN") {
+			ch <- prometheus.MustNewConstMetric(c.Summary, prometheus.GaugeValue, summary[s], s)
+		}
+	}
+	emitCollectorStatus(ch, "mmhealth", err, collectTime, len(metrics))
+}
+
+// fsStructureErrors is the number of structure error events of a filesystem on a node
+type fsStructureErrors struct {
+	FS    string
+	Node  string
+	Count float64
+}
+
+func (e fsStructureErrors) labels(cluster bool) []string {
+	if cluster {
+		return []string{e.FS, e.Node}
 	}
-	ch <- prometheus.MustNewConstMetric(collectError, prometheus.GaugeValue, float64(errorMetric), "mmhealth")
-	ch <- prometheus.MustNewConstMetric(collecTimeout, prometheus.GaugeValue, float64(timeout), "mmhealth")
-	ch <- prometheus.MustNewConstMetric(collectDuration, prometheus.GaugeValue, time.Since(collectTime).Seconds(), "mmhealth")
+	return []string{e.FS}
+}
+
+// structureErrors counts the FILESYSTEM events matching collector.mmhealth.fs-structure-events for
+// every filesystem entity, including those without events so the count is 0 when the filesystem is clean.
+// Events are counted before collector.mmhealth.max-events-per-name is applied.
+func (c *MmhealthCollector) structureErrors(metrics []HealthMetric) []fsStructureErrors {
+	var counts []fsStructureErrors
+	index := make(map[string]int)
+	for _, m := range metrics {
+		if m.Component != "FILESYSTEM" || m.EntityType != "FILESYSTEM" {
+			continue
+		}
+		key := m.Node + ":" + m.EntityName
+		i, ok := index[key]
+		if !ok {
+			i = len(counts)
+			index[key] = i
+			counts = append(counts, fsStructureErrors{FS: m.EntityName, Node: m.Node})
+		}
+		if m.Type == "Event" && c.structureEvents.MatchString(m.Event) {
+			counts[i].Count++
+		}
+	}
+	return counts
 }
 
 func (c *MmhealthCollector) collect() ([]HealthMetric, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(*mmhealthTimeout)*time.Second)
+	timeout := *mmhealthTimeout
+	if c.cluster {
+		timeout = *mmhealthClusterTimeout
+	}
+	ctx, cancel := commandContext("mmhealth", timeout)
 	defer cancel()
-	mmhealth_out, err := mmhealthExec(ctx)
+	mmhealth_out, err := execRetry(ctx, "mmhealth", func() (string, error) {
+		return mmhealthExec(ctx)
+	})
 	if err != nil {
 		return nil, err
 	}
+	commandDump.record("mmhealth", mmhealth_out)
 	metrics := mmhealth_parse(mmhealth_out, c.logger)
+	commandDump.recordParsed("mmhealth", metrics)
 	return metrics, nil
 }
 
 func mmhealth(ctx context.Context) (string, error) {
-	cmd := execCommand(ctx, *sudoCmd, "/usr/lpp/mmfs/bin/mmhealth", "node", "show", "-Y")
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	err := cmd.Run()
-	if ctx.Err() == context.DeadlineExceeded {
-		return "", ctx.Err()
-	} else if err != nil {
-		return "", err
+	args := []string{"node", "show", "-Y"}
+	if *mmhealthCluster {
+		args = []string{"node", "show", "-N", "all", "-Y"}
+	}
+	return RunMMCommand(ctx, "mmhealth", args...)
+}
+
+func newMmhealthFilter(logger log.Logger) *mmhealthFilter {
+	return &mmhealthFilter{
+		node:       regexp.MustCompile(*mmhealthIgnoredNode),
+		component:  regexp.MustCompile(*mmhealthIgnoredComponent),
+		entityName: regexp.MustCompile(*mmhealthIgnoredEntityName),
+		entityType: regexp.MustCompile(*mmhealthIgnoredEntityType),
+		event:      regexp.MustCompile(*mmhealthIgnoredEvent),
+		status:     regexp.MustCompile(*mmhealthIgnoredStatus),
+		logger:     logger,
+	}
+}
+
+func (f *mmhealthFilter) ignore(metric HealthMetric) bool {
+	if *mmhealthCluster && f.node.MatchString(metric.Node) {
+		level.Debug(f.logger).Log("msg", "Skipping node due to ignored pattern", "node", metric.Node)
+		return true
+	}
+	if f.component.MatchString(metric.Component) {
+		level.Debug(f.logger).Log("msg", "Skipping component due to ignored pattern", "component", metric.Component)
+		return true
+	}
+	if f.entityName.MatchString(metric.EntityName) {
+		level.Debug(f.logger).Log("msg", "Skipping entity name due to ignored pattern", "entityname", metric.EntityName)
+		return true
+	}
+	if f.entityType.MatchString(metric.EntityType) {
+		level.Debug(f.logger).Log("msg", "Skipping entity type due to ignored pattern", "entitytype", metric.EntityType)
+		return true
+	}
+	if metric.Type == "State" && f.status.MatchString(metric.Status) {
+		level.Debug(f.logger).Log("msg", "Skipping status due to ignored pattern", "status", metric.Status)
+		return true
+	}
+	if metric.Type == "Event" && *mmhealthIgnoredEvent != "" && f.event.MatchString(metric.Event) {
+		level.Debug(f.logger).Log("msg", "Skipping event due to ignored pattern", "event", metric.Event)
+		return true
+	}
+	if metric.Type == "Event" && !*mmhealthIncludeHidden && (metric.Hidden == "yes" || metric.Hidden == "true") {
+		level.Debug(f.logger).Log("msg", "Skipping hidden event", "event", metric.Event)
+		return true
+	}
+	if metric.Type == "Event" {
+		eventKey := fmt.Sprintf("%s-%s-%s-%s-%s-%s", metric.Node, metric.Component, metric.EntityName, metric.EntityType, metric.Event, metric.Identifier)
+		if SliceContains(f.eventKeys, eventKey) {
+			level.Debug(f.logger).Log("msg", "Skipping event as already encountered", "event", metric.Event)
+			return true
+		} else {
+			f.eventKeys = append(f.eventKeys, eventKey)
+		}
 	}
-	return out.String(), nil
+	return false
 }
 
 func mmhealth_parse(out string, logger log.Logger) []HealthMetric {
-	mmhealthIgnoredComponentPattern := regexp.MustCompile(*mmhealthIgnoredComponent)
-	mmhealthIgnoredEntityNamePattern := regexp.MustCompile(*mmhealthIgnoredEntityName)
-	mmhealthIgnoredEntityTypePattern := regexp.MustCompile(*mmhealthIgnoredEntityType)
-	mmhealthIgnoredEventPattern := regexp.MustCompile(*mmhealthIgnoredEvent)
+	filter := newMmhealthFilter(logger)
 	var metrics []HealthMetric
-	var eventKeys []string
 	lines := strings.Split(out, "\n")
 	typeHeaders := make(map[string][]string)
 	for _, line := range lines {
@@ -180,10 +387,13 @@ func mmhealth_parse(out string, logger log.Logger) []HealthMetric {
 		ps := reflect.ValueOf(&metric) // pointer to struct - addressable
 		s := ps.Elem()                 // struct
 		for i, h := range headers {
+			if i >= len(values) {
+				break
+			}
 			if field, ok := mmhealthMap[h]; ok {
 				f := s.FieldByName(field)
 				if f.Kind() == reflect.String {
-					f.SetString(values[i])
+					f.SetString(DecodeGPFSString(values[i]))
 				} else if f.Kind() == reflect.Int64 {
 					if val, err := strconv.ParseInt(values[i], 10, 64); err == nil {
 						f.SetInt(val)
@@ -193,32 +403,43 @@ func mmhealth_parse(out string, logger log.Logger) []HealthMetric {
 				}
 			}
 		}
-		if mmhealthIgnoredComponentPattern.MatchString(metric.Component) {
-			level.Debug(logger).Log("msg", "Skipping component due to ignored pattern", "component", metric.Component)
-			continue
-		}
-		if mmhealthIgnoredEntityNamePattern.MatchString(metric.EntityName) {
-			level.Debug(logger).Log("msg", "Skipping entity name due to ignored pattern", "entityname", metric.EntityName)
-			continue
-		}
-		if mmhealthIgnoredEntityTypePattern.MatchString(metric.EntityType) {
-			level.Debug(logger).Log("msg", "Skipping entity type due to ignored pattern", "entitytype", metric.EntityType)
+		if filter.ignore(metric) {
 			continue
 		}
-		if metric.Type == "Event" && *mmhealthIgnoredEvent != "" && mmhealthIgnoredEventPattern.MatchString(metric.Event) {
-			level.Debug(logger).Log("msg", "Skipping event due to ignored pattern", "event", metric.Event)
-			continue
-		}
-		if metric.Type == "Event" {
-			eventKey := fmt.Sprintf("%s-%s-%s-%s", metric.Component, metric.EntityName, metric.EntityType, metric.Event)
-			if SliceContains(eventKeys, eventKey) {
-				level.Debug(logger).Log("msg", "Skipping event as already encountered", "event", metric.Event)
-				continue
-			} else {
-				eventKeys = append(eventKeys, eventKey)
-			}
+		if metric.Type == "State" {
+			metric.LastStatusChange = DecodeGPFSString(metric.LastStatusChange)
+			mmhealth_status_change(&metric, logger)
 		}
 		metrics = append(metrics, metric)
 	}
 	return metrics
 }
+
+// mmhealth_status_change sets StatusChange from LastStatusChange, such as 2020-01-27 09:35:21.859186 EST,
+// leaving it 0 if the value can not be parsed.
+// Timezone abbreviations are ambiguous so unless the suffix is a numeric offset
+// the time is parsed in the local timezone, where mmhealth reports it.
+func mmhealth_status_change(metric *HealthMetric, logger log.Logger) {
+	if metric.LastStatusChange == "" {
+		return
+	}
+	fields := strings.Fields(metric.LastStatusChange)
+	var changed time.Time
+	err := fmt.Errorf("Unexpected format")
+	if len(fields) >= 2 {
+		value := fields[0] + " " + fields[1]
+		if len(fields) == 3 {
+			changed, err = time.Parse("2006-01-02 15:04:05.999999999 -0700", value+" "+fields[2])
+		}
+		if err != nil && len(fields) <= 3 {
+			changed, err = time.ParseInLocation("2006-01-02 15:04:05.999999999", value, NowLocation())
+		}
+	}
+	if err != nil {
+		level.Warn(logger).Log("msg", "Unable to parse mmhealth laststatuschange", "value", metric.LastStatusChange,
+			"component", metric.Component, "entityname", metric.EntityName, "err", err)
+		parseErrors.WithLabelValues("mmhealth").Inc()
+		return
+	}
+	metric.StatusChange = float64(changed.UnixNano()) / 1e9
+}
@@ -14,16 +14,19 @@
 package collectors
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"os"
 	"os/exec"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/alecthomas/kingpin/v2"
 	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
 	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
@@ -98,8 +101,8 @@ func TestParseMmhealth(t *testing.T) {
 	w := log.NewSyncWriter(os.Stderr)
 	logger := log.NewLogfmtLogger(w)
 	metrics := mmhealth_parse(mmhealthStdout, logger)
-	if len(metrics) != 11 {
-		t.Errorf("Expected 11 metrics returned, got %d", len(metrics))
+	if len(metrics) != 12 {
+		t.Errorf("Expected 12 metrics returned, got %d", len(metrics))
 		return
 	}
 	if val := metrics[0].Component; val != "NODE" {
@@ -122,6 +125,25 @@ func TestParseMmhealth(t *testing.T) {
 	}
 }
 
+func TestParseMmhealthStatusChange(t *testing.T) {
+	tests := map[string]float64{
+		"2020-01-27 09:35:21.859186 EST": 1580135721.859186,
+		"2023-07-05 16:33:11 EDT":        1688592791,
+		"2020-01-27 09:35:21 +0000":      1580117721,
+		"2020-01-27 09:35:21":            1580135721,
+		"2020-01-27T09:35:21":            0,
+		"foo bar":                        0,
+		"":                               0,
+	}
+	for value, expected := range tests {
+		metric := HealthMetric{Type: "State", LastStatusChange: value}
+		mmhealth_status_change(&metric, log.NewNopLogger())
+		if metric.StatusChange != expected {
+			t.Errorf("Unexpected StatusChange for %q, got %v expected %v", value, metric.StatusChange, expected)
+		}
+	}
+}
+
 func TestParseMmhealthIgnores(t *testing.T) {
 	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
 		t.Fatal(err)
@@ -135,8 +157,8 @@ func TestParseMmhealthIgnores(t *testing.T) {
 	mmhealthIgnoredEntityType = &noignore
 	mmhealthIgnoredEvent = &eventIgnore
 	metrics := mmhealth_parse(mmhealthStdout, log.NewNopLogger())
-	if len(metrics) != 6 {
-		t.Errorf("Expected 6 metrics returned, got %d", len(metrics))
+	if len(metrics) != 7 {
+		t.Errorf("Expected 7 metrics returned, got %d", len(metrics))
 		return
 	}
 	ignore = "ess"
@@ -145,8 +167,8 @@ func TestParseMmhealthIgnores(t *testing.T) {
 	mmhealthIgnoredEntityType = &noignore
 	mmhealthIgnoredEvent = &empty
 	metrics = mmhealth_parse(mmhealthStdout, log.NewNopLogger())
-	if len(metrics) != 10 {
-		t.Errorf("Expected 10 metrics returned, got %d", len(metrics))
+	if len(metrics) != 11 {
+		t.Errorf("Expected 11 metrics returned, got %d", len(metrics))
 		return
 	}
 	ignore = "FILESYSTEM"
@@ -155,8 +177,8 @@ func TestParseMmhealthIgnores(t *testing.T) {
 	mmhealthIgnoredEntityType = &ignore
 	mmhealthIgnoredEvent = &empty
 	metrics = mmhealth_parse(mmhealthStdout, log.NewNopLogger())
-	if len(metrics) != 8 {
-		t.Errorf("Expected 8 metrics returned, got %d", len(metrics))
+	if len(metrics) != 9 {
+		t.Errorf("Expected 9 metrics returned, got %d", len(metrics))
 		return
 	}
 }
@@ -175,8 +197,9 @@ func TestMmhealthCollector(t *testing.T) {
 	expected := `
 		# HELP gpfs_health_event GPFS health event
 		# TYPE gpfs_health_event gauge
-		gpfs_health_event{component="GPFS",entityname="ib-haswell1.example.com",entitytype="NODE",event="cluster_connections_down"} 1
-		gpfs_health_event{component="GPFS",entityname="ib-haswell1.example.com",entitytype="NODE",event="gpfs_pagepool_small"} 1
+		gpfs_health_event{component="GPFS",entityname="ib-haswell1.example.com",entitytype="NODE",event="cluster_connections_down",identifier="10.22.51.57"} 1
+		gpfs_health_event{component="GPFS",entityname="ib-haswell1.example.com",entitytype="NODE",event="cluster_connections_down",identifier="10.22.95.17"} 1
+		gpfs_health_event{component="GPFS",entityname="ib-haswell1.example.com",entitytype="NODE",event="gpfs_pagepool_small",identifier=""} 1
 		# HELP gpfs_health_status GPFS health status
 		# TYPE gpfs_health_status gauge
 		gpfs_health_status{component="FILESYSTEM",entityname="ib-haswell1.example.com",entitytype="NODE",status="CHECKING"} 0
@@ -278,6 +301,30 @@ func TestMmhealthCollector(t *testing.T) {
 		gpfs_health_status{component="NODE",entityname="ib-haswell1.example.com",entitytype="NODE",status="SUSPENDED"} 0
 		gpfs_health_status{component="NODE",entityname="ib-haswell1.example.com",entitytype="NODE",status="TIPS"} 1
 		gpfs_health_status{component="NODE",entityname="ib-haswell1.example.com",entitytype="NODE",status="UNKNOWN"} 0
+		# HELP gpfs_health_status_summary GPFS count of health entities in each status
+		# TYPE gpfs_health_status_summary gauge
+		gpfs_health_status_summary{status="CHECKING"} 0
+		gpfs_health_status_summary{status="DEGRADED"} 0
+		gpfs_health_status_summary{status="DEPEND"} 0
+		gpfs_health_status_summary{status="DISABLED"} 0
+		gpfs_health_status_summary{status="FAILED"} 0
+		gpfs_health_status_summary{status="HEALTHY"} 6
+		gpfs_health_status_summary{status="STARTING"} 0
+		gpfs_health_status_summary{status="STOPPED"} 0
+		gpfs_health_status_summary{status="SUSPENDED"} 0
+		gpfs_health_status_summary{status="TIPS"} 2
+		gpfs_health_status_summary{status="UNKNOWN"} 1
+		# HELP gpfs_health_status_change_timestamp_seconds GPFS health time of the last status change of the entity
+		# TYPE gpfs_health_status_change_timestamp_seconds gauge
+		gpfs_health_status_change_timestamp_seconds{component="FILESYSTEM",entityname="ess",entitytype="FILESYSTEM"} 1.580135721716417e+09
+		gpfs_health_status_change_timestamp_seconds{component="FILESYSTEM",entityname="ib-haswell1.example.com",entitytype="NODE"} 1.580135721499264e+09
+		gpfs_health_status_change_timestamp_seconds{component="FILESYSTEM",entityname="project",entitytype="FILESYSTEM"} 1.5801357215739782e+09
+		gpfs_health_status_change_timestamp_seconds{component="FILESYSTEM",entityname="scratch",entitytype="FILESYSTEM"} 1.5801357216577978e+09
+		gpfs_health_status_change_timestamp_seconds{component="GPFS",entityname="ib-haswell1.example.com",entitytype="NODE"} 1.5801357217918952e+09
+		gpfs_health_status_change_timestamp_seconds{component="NETWORK",entityname="ib-haswell1.example.com",entitytype="NODE"} 1.5784345601312718e+09
+		gpfs_health_status_change_timestamp_seconds{component="NETWORK",entityname="ib0",entitytype="NIC"} 1.578433659397852e+09
+		gpfs_health_status_change_timestamp_seconds{component="NETWORK",entityname="mlx5_0/1",entitytype="IB_RDMA"} 1.578434560205075e+09
+		gpfs_health_status_change_timestamp_seconds{component="NODE",entityname="ib-haswell1.example.com",entitytype="NODE"} 1.580135721859186e+09
 	`
 	w := log.NewSyncWriter(os.Stderr)
 	logger := log.NewLogfmtLogger(w)
@@ -285,14 +332,158 @@ func TestMmhealthCollector(t *testing.T) {
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
-	} else if val != 104 {
-		t.Errorf("Unexpected collection count %d, expected 104", val)
+	} else if val != 137 {
+		t.Errorf("Unexpected collection count %d, expected 137", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_health_status", "gpfs_health_event",
+		"gpfs_health_status_summary", "gpfs_health_status_change_timestamp_seconds"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestMmhealthCollectorIgnoredStatus(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.mmhealth.ignored-status=^TIPS$"}); err != nil {
+		t.Fatal(err)
+	}
+	mmhealthExec = func(ctx context.Context) (string, error) {
+		return mmhealthStdout, nil
+	}
+	ignore := "^$"
+	mmhealthIgnoredComponent = &ignore
+	mmhealthIgnoredEntityName = &ignore
+	mmhealthIgnoredEntityType = &ignore
+	expected := `
+		# HELP gpfs_health_status_summary GPFS count of health entities in each status
+		# TYPE gpfs_health_status_summary gauge
+		gpfs_health_status_summary{status="CHECKING"} 0
+		gpfs_health_status_summary{status="DEGRADED"} 0
+		gpfs_health_status_summary{status="DEPEND"} 0
+		gpfs_health_status_summary{status="DISABLED"} 0
+		gpfs_health_status_summary{status="FAILED"} 0
+		gpfs_health_status_summary{status="HEALTHY"} 6
+		gpfs_health_status_summary{status="STARTING"} 0
+		gpfs_health_status_summary{status="STOPPED"} 0
+		gpfs_health_status_summary{status="SUSPENDED"} 0
+		gpfs_health_status_summary{status="TIPS"} 0
+		gpfs_health_status_summary{status="UNKNOWN"} 1
+	`
+	collector := NewMmhealthCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 113 {
+		t.Errorf("Unexpected collection count %d, expected 113", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_health_status_summary"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestParseMmhealthHidden(t *testing.T) {
+	out := strings.Replace(mmhealthStdout, "gpfs_pagepool_small::2020-01-07 16%3A47%3A43.892296 EST::no:", "gpfs_pagepool_small::2020-01-07 16%3A47%3A43.892296 EST::yes:", 1)
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	metrics := mmhealth_parse(out, log.NewNopLogger())
+	if len(metrics) != 11 {
+		t.Errorf("Expected 11 metrics returned, got %d", len(metrics))
+	}
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.mmhealth.include-hidden"}); err != nil {
+		t.Fatal(err)
+	}
+	metrics = mmhealth_parse(out, log.NewNopLogger())
+	if len(metrics) != 12 {
+		t.Errorf("Expected 12 metrics returned, got %d", len(metrics))
+	}
+	if val := metrics[3].Identifier; val != "10.22.51.57" {
+		t.Errorf("Unexpected Identifier got %s", val)
+	}
+}
+
+func TestMmhealthCollectorMaxEvents(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.mmhealth.max-events-per-name=1"}); err != nil {
+		t.Fatal(err)
 	}
-	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_health_status", "gpfs_health_event"); err != nil {
+	mmhealthExec = func(ctx context.Context) (string, error) {
+		return mmhealthStdout, nil
+	}
+	expected := `
+		# HELP gpfs_health_event GPFS health event
+		# TYPE gpfs_health_event gauge
+		gpfs_health_event{component="GPFS",entityname="ib-haswell1.example.com",entitytype="NODE",event="cluster_connections_down",identifier="10.22.51.57"} 1
+		gpfs_health_event{component="GPFS",entityname="ib-haswell1.example.com",entitytype="NODE",event="gpfs_pagepool_small",identifier=""} 1
+		# HELP gpfs_health_event_overflow_count GPFS count of health events not reported after reaching the limit of series for the event
+		# TYPE gpfs_health_event_overflow_count gauge
+		gpfs_health_event_overflow_count{event="cluster_connections_down"} 1
+	`
+	collector := NewMmhealthCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
+		"gpfs_health_event", "gpfs_health_event_overflow_count"); err != nil {
 		t.Errorf("unexpected collecting result:\n%s", err)
 	}
 }
 
+func TestOverflowLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := level.NewFilter(log.NewLogfmtLogger(&buf), level.AllowWarn())
+	o := &overflowLogger{counts: make(map[string]float64)}
+	tests := []struct {
+		overflow map[string]float64
+		logged   int
+	}{
+		{overflow: map[string]float64{"a": 1, "b": 2}, logged: 2},
+		{overflow: map[string]float64{"a": 1, "b": 2}, logged: 0},
+		{overflow: map[string]float64{"a": 3, "b": 2}, logged: 1},
+		{overflow: map[string]float64{"a": 3}, logged: 0},
+		{overflow: map[string]float64{"a": 3, "b": 2}, logged: 1},
+	}
+	for i, test := range tests {
+		buf.Reset()
+		o.log(test.overflow, logger)
+		if logged := strings.Count(buf.String(), "level=warn"); logged != test.logged {
+			t.Errorf("Unexpected warnings for scrape %d, got %d expected %d:\n%s", i, logged, test.logged, buf.String())
+		}
+	}
+}
+
+func TestMmhealthCollectorStructureErrors(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	erroring := mmhealthStdout + `mmhealth:Event:0:1:::ib-haswell1.example.com:FILESYSTEM:scratch:FILESYSTEM:fsstruct_error:scratch:2024-03-01 10%3A00%3A00.000000 EST:scratch:no:
+mmhealth:Event:0:1:::ib-haswell1.example.com:FILESYSTEM:scratch:FILESYSTEM:fserrinvalid:scratch,108:2024-03-01 10%3A00%3A01.000000 EST:108:no:
+mmhealth:Event:0:1:::ib-haswell1.example.com:FILESYSTEM:project:FILESYSTEM:unmounted_fs_check:project:2024-03-01 10%3A00%3A02.000000 EST:project:no:
+`
+	tests := map[string]string{
+		mmhealthStdout: `
+		# HELP gpfs_fs_structure_errors GPFS number of active filesystem structure error events of the filesystem
+		# TYPE gpfs_fs_structure_errors gauge
+		gpfs_fs_structure_errors{fs="ess"} 0
+		gpfs_fs_structure_errors{fs="project"} 0
+		gpfs_fs_structure_errors{fs="scratch"} 0
+	`,
+		erroring: `
+		# HELP gpfs_fs_structure_errors GPFS number of active filesystem structure error events of the filesystem
+		# TYPE gpfs_fs_structure_errors gauge
+		gpfs_fs_structure_errors{fs="ess"} 0
+		gpfs_fs_structure_errors{fs="project"} 0
+		gpfs_fs_structure_errors{fs="scratch"} 2
+	`,
+	}
+	for out, expected := range tests {
+		out := out
+		mmhealthExec = func(ctx context.Context) (string, error) {
+			return out, nil
+		}
+		collector := NewMmhealthCollector(log.NewNopLogger())
+		gatherers := setupGatherer(collector)
+		if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_fs_structure_errors"); err != nil {
+			t.Errorf("unexpected collecting result:\n%s", err)
+		}
+	}
+}
+
 func TestMMhealthCollectorError(t *testing.T) {
 	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
 		t.Fatal(err)
@@ -309,8 +500,8 @@ func TestMMhealthCollectorError(t *testing.T) {
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
-	} else if val != 3 {
-		t.Errorf("Unexpected collection count %d, expected 3", val)
+	} else if val != 12 {
+		t.Errorf("Unexpected collection count %d, expected 12", val)
 	}
 	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collect_error"); err != nil {
 		t.Errorf("unexpected collecting result:\n%s", err)
@@ -333,10 +524,104 @@ func TestMMhealthCollectorTimeout(t *testing.T) {
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
-	} else if val != 3 {
-		t.Errorf("Unexpected collection count %d, expected 3", val)
+	} else if val != 12 {
+		t.Errorf("Unexpected collection count %d, expected 12", val)
 	}
 	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collect_timeout"); err != nil {
 		t.Errorf("unexpected collecting result:\n%s", err)
 	}
 }
+
+func TestParseMmhealthInsertedColumn(t *testing.T) {
+	expected := mmhealth_parse(mmhealthStdout, log.NewNopLogger())
+	if len(expected) == 0 {
+		t.Fatal("Expected metrics to be parsed")
+	}
+	got := mmhealth_parse(insertColumn(mmhealthStdout, 7), log.NewNopLogger())
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Unexpected metrics with inserted column\nGot: %v\nExpected: %v", got, expected)
+	}
+}
+
+func TestMmhealthCollectorCluster(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.mmhealth.cluster",
+		"--collector.mmhealth.ignored-component=^(NETWORK|FILESYSTEM)$", "--collector.mmhealth.ignored-node=^old"}); err != nil {
+		t.Fatal(err)
+	}
+	var timeout time.Duration
+	mmhealthExec = func(ctx context.Context) (string, error) {
+		deadline, _ := ctx.Deadline()
+		timeout = time.Until(deadline)
+		return `
+mmhealth:Event:HEADER:version:reserved:reserved:node:component:entityname:entitytype:event:arguments:activesince:identifier:ishidden:
+mmhealth:State:HEADER:version:reserved:reserved:node:component:entityname:entitytype:status:laststatuschange:
+mmhealth:State:0:1:::ib-haswell1.example.com:NODE:ib-haswell1.example.com:NODE:HEALTHY:2020-01-27 09%3A35%3A21.859186 EST:
+mmhealth:State:0:1:::ib-haswell1.example.com:GPFS:ib-haswell1.example.com:NODE:HEALTHY:2020-01-27 09%3A35%3A21.791895 EST:
+mmhealth:State:0:1:::ib-haswell2.example.com:NODE:ib-haswell2.example.com:NODE:DEGRADED:2020-01-27 09%3A35%3A21.859186 EST:
+mmhealth:State:0:1:::ib-haswell2.example.com:GPFS:ib-haswell2.example.com:NODE:DEGRADED:2020-01-27 09%3A35%3A21.791895 EST:
+mmhealth:Event:0:1:::ib-haswell2.example.com:GPFS:ib-haswell2.example.com:NODE:gpfs_pagepool_small::2020-01-07 16%3A47%3A43.892296 EST::no:
+mmhealth:State:0:1:::old1.example.com:NODE:old1.example.com:NODE:FAILED:2019-01-27 09%3A35%3A21.859186 EST:
+mmhealth:Event:0:1:::old1.example.com:GPFS:old1.example.com:NODE:gpfs_down::2019-01-27 09%3A35%3A21.892296 EST::no:
+`, nil
+	}
+	expected := `
+		# HELP gpfs_health_event GPFS health event
+		# TYPE gpfs_health_event gauge
+		gpfs_health_event{component="GPFS",entityname="ib-haswell2.example.com",entitytype="NODE",event="gpfs_pagepool_small",identifier="",node="ib-haswell2.example.com"} 1
+		# HELP gpfs_health_status_change_timestamp_seconds GPFS health time of the last status change of the entity
+		# TYPE gpfs_health_status_change_timestamp_seconds gauge
+		gpfs_health_status_change_timestamp_seconds{component="GPFS",entityname="ib-haswell1.example.com",entitytype="NODE",node="ib-haswell1.example.com"} 1.5801357217918952e+09
+		gpfs_health_status_change_timestamp_seconds{component="GPFS",entityname="ib-haswell2.example.com",entitytype="NODE",node="ib-haswell2.example.com"} 1.5801357217918952e+09
+		gpfs_health_status_change_timestamp_seconds{component="NODE",entityname="ib-haswell1.example.com",entitytype="NODE",node="ib-haswell1.example.com"} 1.580135721859186e+09
+		gpfs_health_status_change_timestamp_seconds{component="NODE",entityname="ib-haswell2.example.com",entitytype="NODE",node="ib-haswell2.example.com"} 1.580135721859186e+09
+	`
+	collector := NewMmhealthCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
+		"gpfs_health_event", "gpfs_health_status_change_timestamp_seconds"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+	if timeout <= 5*time.Second || timeout > 30*time.Second {
+		t.Errorf("Unexpected timeout %v, expected the cluster timeout of 30s", timeout)
+	}
+	expected = `
+		# HELP gpfs_health_status_summary GPFS count of health entities in each status
+		# TYPE gpfs_health_status_summary gauge
+		gpfs_health_status_summary{status="CHECKING"} 0
+		gpfs_health_status_summary{status="DEGRADED"} 2
+		gpfs_health_status_summary{status="DEPEND"} 0
+		gpfs_health_status_summary{status="DISABLED"} 0
+		gpfs_health_status_summary{status="FAILED"} 0
+		gpfs_health_status_summary{status="HEALTHY"} 2
+		gpfs_health_status_summary{status="STARTING"} 0
+		gpfs_health_status_summary{status="STOPPED"} 0
+		gpfs_health_status_summary{status="SUSPENDED"} 0
+		gpfs_health_status_summary{status="TIPS"} 0
+		gpfs_health_status_summary{status="UNKNOWN"} 0
+	`
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_health_status_summary"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestMmhealthCluster(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.mmhealth.cluster"}); err != nil {
+		t.Fatal(err)
+	}
+	var args []string
+	execCommand = func(ctx context.Context, command string, arg ...string) *exec.Cmd {
+		args = arg
+		return fakeExecCommand(ctx, command, arg...)
+	}
+	mockedExitStatus = 0
+	mockedStdout = "foo"
+	defer func() { execCommand = exec.CommandContext }()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := mmhealth(ctx); err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+	if val := strings.Join(args, " "); !strings.HasSuffix(val, "mmhealth node show -N all -Y") {
+		t.Errorf("Unexpected args %q", val)
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	mmkeyservTimeout    = kingpin.Flag("collector.mmkeyserv.timeout", "Timeout for executing mmkeyserv").Default("30").Int()
+	MmkeyservServerExec = mmkeyservServer
+	MmkeyservClientExec = mmkeyservClient
+	// mmkeyservReachableStatus are the key server status values treated as reachable
+	mmkeyservReachableStatus = []string{"ok", "online", "reachable"}
+)
+
+type KeyServerMetric struct {
+	Name      string
+	Reachable float64
+}
+
+type KeyClientMetric struct {
+	Name       string
+	Server     string
+	Tenants    []string
+	Expiration float64
+}
+
+type MmkeyservCollector struct {
+	Reachable  *prometheus.Desc
+	Expiration *prometheus.Desc
+	Tenant     *prometheus.Desc
+	logger     log.Logger
+}
+
+func init() {
+	registerCollector("mmkeyserv", false, NewMmkeyservCollector)
+}
+
+func NewMmkeyservCollector(logger log.Logger) Collector {
+	return &MmkeyservCollector{
+		Reachable: newDesc(prometheus.BuildFQName(namespace, "keyserver", "reachable"),
+			"GPFS encryption key server is reachable", []string{"server"}, nil),
+		Expiration: newDesc(prometheus.BuildFQName(namespace, "keyserv", "client_cert_expiration_timestamp_seconds"),
+			"GPFS encryption key client certificate expiration timestamp", []string{"client"}, nil),
+		Tenant: newDesc(prometheus.BuildFQName(namespace, "keyserv", "tenant_info"),
+			"GPFS encryption key server tenant registered for a key client", []string{"tenant", "server"}, nil),
+		logger: logger,
+	}
+}
+
+func (c *MmkeyservCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.Reachable
+	ch <- c.Expiration
+	ch <- c.Tenant
+}
+
+func (c *MmkeyservCollector) Collect(ch chan<- prometheus.Metric) {
+	level.Debug(c.logger).Log("msg", "Collecting mmkeyserv metrics")
+	collectTime := time.Now()
+	servers, clients, err := c.collect()
+	if err == context.DeadlineExceeded {
+		level.Error(c.logger).Log("msg", "Timeout executing mmkeyserv")
+	} else if err != nil {
+		level.Error(c.logger).Log("msg", err)
+	}
+	if err == nil {
+		for _, s := range servers {
+			ch <- prometheus.MustNewConstMetric(c.Reachable, prometheus.GaugeValue, s.Reachable, s.Name)
+		}
+		tenants := make(map[string]bool)
+		for _, m := range clients {
+			if m.Expiration != 0 {
+				ch <- prometheus.MustNewConstMetric(c.Expiration, prometheus.GaugeValue, m.Expiration, m.Name)
+			}
+			for _, t := range m.Tenants {
+				key := t + ":" + m.Server
+				if tenants[key] {
+					continue
+				}
+				tenants[key] = true
+				ch <- prometheus.MustNewConstMetric(c.Tenant, prometheus.GaugeValue, 1, t, m.Server)
+			}
+		}
+	}
+	emitCollectorStatus(ch, "mmkeyserv", err, collectTime, len(servers)+len(clients))
+}
+
+func (c *MmkeyservCollector) collect() ([]KeyServerMetric, []KeyClientMetric, error) {
+	ctx, cancel := commandContext("mmkeyserv", *mmkeyservTimeout)
+	defer cancel()
+	out, err := execRetry(ctx, "mmkeyserv", func() (string, error) {
+		return MmkeyservServerExec(ctx)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	commandDump.record("mmkeyserv-server", out)
+	servers := parse_mmkeyserv_server(out)
+	commandDump.recordParsed("mmkeyserv-server", servers)
+	out, err = execRetry(ctx, "mmkeyserv", func() (string, error) {
+		return MmkeyservClientExec(ctx)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	commandDump.record("mmkeyserv-client", out)
+	clients := parse_mmkeyserv_client(out, c.logger)
+	commandDump.recordParsed("mmkeyserv-client", clients)
+	return servers, clients, nil
+}
+
+func mmkeyservServer(ctx context.Context) (string, error) {
+	return RunMMCommand(ctx, "mmkeyserv", "server", "show", "-Y")
+}
+
+func mmkeyservClient(ctx context.Context) (string, error) {
+	return RunMMCommand(ctx, "mmkeyserv", "client", "show", "-Y")
+}
+
+// mmkeyserv_section returns the decoded rows of a mmkeyserv -Y section as maps of header to value
+func mmkeyserv_section(out string, section string) []map[string]string {
+	var rows []map[string]string
+	var headers []string
+	for _, l := range strings.Split(out, "\n") {
+		items := strings.Split(l, ":")
+		if len(items) < 7 || items[0] != "mmkeyserv" || items[1] != section {
+			continue
+		}
+		if items[2] == "HEADER" {
+			headers = items
+			continue
+		}
+		row := make(map[string]string)
+		for i, h := range headers {
+			if i < 6 || i >= len(items) || h == "" {
+				continue
+			}
+			row[h] = DecodeGPFSString(items[i])
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// parse_mmkeyserv_server returns the key servers, a server is reachable unless
+// the output includes a status for it that is not one of mmkeyservReachableStatus
+func parse_mmkeyserv_server(out string) []KeyServerMetric {
+	var metrics []KeyServerMetric
+	for _, row := range mmkeyserv_section(out, "server") {
+		metric := KeyServerMetric{Name: mmvdisk_value(row, "serverName", "server"), Reachable: 1}
+		if metric.Name == "" {
+			continue
+		}
+		if status, ok := row["status"]; ok && !SliceContains(mmkeyservReachableStatus, strings.ToLower(status)) {
+			metric.Reachable = 0
+		}
+		metrics = append(metrics, metric)
+	}
+	return metrics
+}
+
+// parse_mmkeyserv_client returns the key clients, the certificate expiration such as
+// 2024-04-12 13:52:07 (-0400) is parsed as epoch seconds
+func parse_mmkeyserv_client(out string, logger log.Logger) []KeyClientMetric {
+	var metrics []KeyClientMetric
+	for _, row := range mmkeyserv_section(out, "client") {
+		metric := KeyClientMetric{
+			Name:   mmvdisk_value(row, "clientName", "client"),
+			Server: mmvdisk_value(row, "keyServer", "server"),
+		}
+		if metric.Name == "" {
+			continue
+		}
+		for _, t := range strings.Split(row["tenants"], ",") {
+			if t = strings.TrimSpace(t); t != "" && t != "-" {
+				metric.Tenants = append(metric.Tenants, t)
+			}
+		}
+		expiration := strings.NewReplacer("(", "", ")", "").Replace(row["certificateExpiration"])
+		if expiration != "" && expiration != "-" {
+			if t, err := parseGPFSTime(expiration); err == nil {
+				metric.Expiration = float64(t.Unix())
+			} else {
+				level.Warn(logger).Log("msg", "Unable to parse key client certificate expiration", "client", metric.Name, "value", row["certificateExpiration"], "err", err)
+				parseErrors.WithLabelValues("mmkeyserv").Inc()
+			}
+		}
+		metrics = append(metrics, metric)
+	}
+	return metrics
+}
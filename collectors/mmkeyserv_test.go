@@ -0,0 +1,187 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var (
+	mmkeyservServerStdout = `
+mmkeyserv:server:HEADER:version:reserved:reserved:serverName:type:ipa:userId:restPort:label:status:
+mmkeyserv:server:0:1:::keyserver01:ISKLM:192.168.9.135:SKLMAdmin:9080:1_keyserver01:ok:
+mmkeyserv:server:0:1:::keyserver02:ISKLM:192.168.9.136:SKLMAdmin:9080:2_keyserver02:unreachable:
+`
+	mmkeyservClientStdout = `
+mmkeyserv:client:HEADER:version:reserved:reserved:clientName:label:keyServer:tenants:certificateExpiration:
+mmkeyserv:client:0:1:::c1Client1:c1Client1:keyserver01:devG1%2CprodG1:2024-04-12 13%3A52%3A07 (-0400):
+mmkeyserv:client:0:1:::c1Client2:c1Client2:keyserver02:devG1:2025-01-31 10%3A00%3A00 (-0500):
+`
+)
+
+func TestMmkeyserv(t *testing.T) {
+	execCommand = fakeExecCommand
+	mockedExitStatus = 0
+	mockedStdout = "foo"
+	defer func() { execCommand = exec.CommandContext }()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out, err := mmkeyservServer(ctx)
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+	if out != mockedStdout {
+		t.Errorf("Unexpected out: %s", out)
+	}
+	out, err = mmkeyservClient(ctx)
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+	if out != mockedStdout {
+		t.Errorf("Unexpected out: %s", out)
+	}
+}
+
+func TestParseMmkeyserv(t *testing.T) {
+	servers := parse_mmkeyserv_server(mmkeyservServerStdout)
+	expectedServers := []KeyServerMetric{
+		{Name: "keyserver01", Reachable: 1},
+		{Name: "keyserver02", Reachable: 0},
+	}
+	if !reflect.DeepEqual(servers, expectedServers) {
+		t.Errorf("Unexpected servers\nGot: %v\nExpected: %v", servers, expectedServers)
+	}
+	clients := parse_mmkeyserv_client(mmkeyservClientStdout, log.NewNopLogger())
+	expectedClients := []KeyClientMetric{
+		{Name: "c1Client1", Server: "keyserver01", Tenants: []string{"devG1", "prodG1"}, Expiration: 1712944327},
+		{Name: "c1Client2", Server: "keyserver02", Tenants: []string{"devG1"}, Expiration: 1738335600},
+	}
+	if !reflect.DeepEqual(clients, expectedClients) {
+		t.Errorf("Unexpected clients\nGot: %v\nExpected: %v", clients, expectedClients)
+	}
+}
+
+func TestParseMmkeyservBadExpiration(t *testing.T) {
+	parseErrors.Reset()
+	out := strings.Replace(mmkeyservClientStdout, "2024-04-12 13%3A52%3A07 (-0400)", "never", 1)
+	clients := parse_mmkeyserv_client(out, log.NewNopLogger())
+	if len(clients) != 2 {
+		t.Fatalf("Expected 2 clients, got %d", len(clients))
+	}
+	if val := clients[0].Expiration; val != 0 {
+		t.Errorf("Unexpected expiration %v", val)
+	}
+	if val := testutil.ToFloat64(parseErrors.WithLabelValues("mmkeyserv")); val != 1 {
+		t.Errorf("Unexpected parse errors %v", val)
+	}
+}
+
+func TestMmkeyservCollector(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	MmkeyservServerExec = func(ctx context.Context) (string, error) {
+		return mmkeyservServerStdout, nil
+	}
+	MmkeyservClientExec = func(ctx context.Context) (string, error) {
+		return mmkeyservClientStdout, nil
+	}
+	expected := `
+		# HELP gpfs_keyserv_client_cert_expiration_timestamp_seconds GPFS encryption key client certificate expiration timestamp
+		# TYPE gpfs_keyserv_client_cert_expiration_timestamp_seconds gauge
+		gpfs_keyserv_client_cert_expiration_timestamp_seconds{client="c1Client1"} 1712944327
+		gpfs_keyserv_client_cert_expiration_timestamp_seconds{client="c1Client2"} 1738335600
+		# HELP gpfs_keyserv_tenant_info GPFS encryption key server tenant registered for a key client
+		# TYPE gpfs_keyserv_tenant_info gauge
+		gpfs_keyserv_tenant_info{server="keyserver01",tenant="devG1"} 1
+		gpfs_keyserv_tenant_info{server="keyserver01",tenant="prodG1"} 1
+		gpfs_keyserv_tenant_info{server="keyserver02",tenant="devG1"} 1
+		# HELP gpfs_keyserver_reachable GPFS encryption key server is reachable
+		# TYPE gpfs_keyserver_reachable gauge
+		gpfs_keyserver_reachable{server="keyserver01"} 1
+		gpfs_keyserver_reachable{server="keyserver02"} 0
+	`
+	collector := NewMmkeyservCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 19 {
+		t.Errorf("Unexpected collection count %d, expected 19", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
+		"gpfs_keyserv_client_cert_expiration_timestamp_seconds", "gpfs_keyserv_tenant_info", "gpfs_keyserver_reachable"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestMmkeyservCollectorError(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	MmkeyservServerExec = func(ctx context.Context) (string, error) {
+		return mmkeyservServerStdout, nil
+	}
+	MmkeyservClientExec = func(ctx context.Context) (string, error) {
+		return "", fmt.Errorf("Error")
+	}
+	expected := `
+		# HELP gpfs_exporter_collect_error Indicates if error has occurred during collection
+		# TYPE gpfs_exporter_collect_error gauge
+		gpfs_exporter_collect_error{collector="mmkeyserv"} 1
+	`
+	collector := NewMmkeyservCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 12 {
+		t.Errorf("Unexpected collection count %d, expected 12", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collect_error"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestMmkeyservCollectorTimeout(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	MmkeyservServerExec = func(ctx context.Context) (string, error) {
+		return "", context.DeadlineExceeded
+	}
+	expected := `
+		# HELP gpfs_exporter_collect_timeout Indicates the collector timed out
+		# TYPE gpfs_exporter_collect_timeout gauge
+		gpfs_exporter_collect_timeout{collector="mmkeyserv"} 1
+	`
+	collector := NewMmkeyservCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 12 {
+		t.Errorf("Unexpected collection count %d, expected 12", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collect_timeout"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
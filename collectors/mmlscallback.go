@@ -0,0 +1,127 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	mmlscallbackTimeout = kingpin.Flag("collector.mmlscallback.timeout", "Timeout for executing mmlscallback").Default("5").Int()
+	MmlscallbackExec    = mmlscallback
+)
+
+type CallbackMetric struct {
+	Callback string
+	Command  string
+	Events   []string
+}
+
+type MmlscallbackCollector struct {
+	Info   *prometheus.Desc
+	logger log.Logger
+}
+
+func init() {
+	registerCollector("mmlscallback", false, NewMmlscallbackCollector)
+}
+
+func NewMmlscallbackCollector(logger log.Logger) Collector {
+	return &MmlscallbackCollector{
+		Info: newDesc(prometheus.BuildFQName(namespace, "callback", "info"),
+			"GPFS callback registered for an event", []string{"callback", "event", "command"}, nil),
+		logger: logger,
+	}
+}
+
+func (c *MmlscallbackCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.Info
+}
+
+func (c *MmlscallbackCollector) Collect(ch chan<- prometheus.Metric) {
+	level.Debug(c.logger).Log("msg", "Collecting mmlscallback metrics")
+	collectTime := time.Now()
+	metrics, err := c.collect()
+	if err == context.DeadlineExceeded {
+		level.Error(c.logger).Log("msg", "Timeout executing mmlscallback")
+	} else if err != nil {
+		level.Error(c.logger).Log("msg", err)
+	}
+	if err == nil {
+		for _, m := range metrics {
+			for _, event := range m.Events {
+				ch <- prometheus.MustNewConstMetric(c.Info, prometheus.GaugeValue, 1, m.Callback, event, m.Command)
+			}
+		}
+	}
+	emitCollectorStatus(ch, "mmlscallback", err, collectTime, anyRecords)
+}
+
+func (c *MmlscallbackCollector) collect() ([]CallbackMetric, error) {
+	ctx, cancel := commandContext("mmlscallback", *mmlscallbackTimeout)
+	defer cancel()
+	out, err := execRetry(ctx, "mmlscallback", func() (string, error) {
+		return MmlscallbackExec(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	commandDump.record("mmlscallback", out)
+	metrics := parse_mmlscallback(out, c.logger)
+	commandDump.recordParsed("mmlscallback", metrics)
+	return metrics, nil
+}
+
+func mmlscallback(ctx context.Context) (string, error) {
+	return RunMMCommand(ctx, "mmlscallback", "-Y")
+}
+
+// parse_mmlscallback returns the callbacks with the comma separated events of each callback
+// split so there is one event per value, repeated events of a callback are only returned once
+func parse_mmlscallback(out string, logger log.Logger) []CallbackMetric {
+	var metrics []CallbackMetric
+	var indexes map[string]int
+	for _, l := range strings.Split(out, "\n") {
+		items := strings.Split(strings.TrimSpace(l), ":")
+		if len(items) < 7 || items[0] != "mmlscallback" {
+			continue
+		}
+		if items[2] == "HEADER" {
+			indexes = HeaderIndexMap(items)
+			continue
+		}
+		callback, ok := headerValue(items, indexes, "identifier")
+		if !ok || callback == "" {
+			level.Debug(logger).Log("msg", "Skipping mmlscallback line without identifier", "line", l)
+			continue
+		}
+		command, _ := headerValue(items, indexes, "command")
+		events, _ := headerValue(items, indexes, "event")
+		metric := CallbackMetric{Callback: DecodeGPFSString(callback), Command: DecodeGPFSString(command)}
+		for _, event := range strings.Split(DecodeGPFSString(events), ",") {
+			if event = strings.TrimSpace(event); event != "" && !SliceContains(metric.Events, event) {
+				metric.Events = append(metric.Events, event)
+			}
+		}
+		metrics = append(metrics, metric)
+	}
+	return metrics
+}
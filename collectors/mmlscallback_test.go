@@ -0,0 +1,148 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var (
+	mmlscallbackStdout = `
+mmlscallback::HEADER:version:reserved:reserved:identifier:command:priority:sync:timeout:event:node:parms:onError:object:
+mmlscallback::0:1:::MIGRATION:%2Fusr%2Flpp%2Fmmfs%2Fbin%2Fmmstartpolicy::::lowDiskSpace,noDiskSpace::%25eventName %25fsName --single-instance:::
+mmlscallback::0:1:::nodeLeave:%2Fusr%2Flocal%2Fbin%2Fnode-leave.sh::true:60:nodeLeave,nodeLeave:all:%25eventNode:::
+mmlscallback::0:1:::quotaWarn:%2Fusr%2Flocal%2Fbin%2Fquota-warn.sh::::softQuotaExceeded::%25fsName %25filesetName:::
+`
+)
+
+func TestMmlscallback(t *testing.T) {
+	execCommand = fakeExecCommand
+	mockedExitStatus = 0
+	mockedStdout = "foo"
+	defer func() { execCommand = exec.CommandContext }()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out, err := mmlscallback(ctx)
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+	if out != mockedStdout {
+		t.Errorf("Unexpected out: %s", out)
+	}
+}
+
+func TestParseMmlscallback(t *testing.T) {
+	metrics := parse_mmlscallback(mmlscallbackStdout, log.NewNopLogger())
+	expected := []CallbackMetric{
+		{Callback: "MIGRATION", Command: "/usr/lpp/mmfs/bin/mmstartpolicy", Events: []string{"lowDiskSpace", "noDiskSpace"}},
+		{Callback: "nodeLeave", Command: "/usr/local/bin/node-leave.sh", Events: []string{"nodeLeave"}},
+		{Callback: "quotaWarn", Command: "/usr/local/bin/quota-warn.sh", Events: []string{"softQuotaExceeded"}},
+	}
+	if !reflect.DeepEqual(metrics, expected) {
+		t.Errorf("Unexpected callbacks\nGot: %v\nExpected: %v", metrics, expected)
+	}
+}
+
+func TestParseMmlscallbackInsertedColumn(t *testing.T) {
+	expected := parse_mmlscallback(mmlscallbackStdout, log.NewNopLogger())
+	got := parse_mmlscallback(insertColumn(mmlscallbackStdout, 7), log.NewNopLogger())
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Unexpected callbacks with inserted column\nGot: %v\nExpected: %v", got, expected)
+	}
+}
+
+func TestMmlscallbackCollector(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	MmlscallbackExec = func(ctx context.Context) (string, error) {
+		return mmlscallbackStdout, nil
+	}
+	expected := `
+		# HELP gpfs_callback_info GPFS callback registered for an event
+		# TYPE gpfs_callback_info gauge
+		gpfs_callback_info{callback="MIGRATION",command="/usr/lpp/mmfs/bin/mmstartpolicy",event="lowDiskSpace"} 1
+		gpfs_callback_info{callback="MIGRATION",command="/usr/lpp/mmfs/bin/mmstartpolicy",event="noDiskSpace"} 1
+		gpfs_callback_info{callback="nodeLeave",command="/usr/local/bin/node-leave.sh",event="nodeLeave"} 1
+		gpfs_callback_info{callback="quotaWarn",command="/usr/local/bin/quota-warn.sh",event="softQuotaExceeded"} 1
+	`
+	collector := NewMmlscallbackCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 16 {
+		t.Errorf("Unexpected collection count %d, expected 16", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_callback_info"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestMmlscallbackCollectorError(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	MmlscallbackExec = func(ctx context.Context) (string, error) {
+		return "", fmt.Errorf("Error")
+	}
+	expected := `
+		# HELP gpfs_exporter_collect_error Indicates if error has occurred during collection
+		# TYPE gpfs_exporter_collect_error gauge
+		gpfs_exporter_collect_error{collector="mmlscallback"} 1
+	`
+	collector := NewMmlscallbackCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 12 {
+		t.Errorf("Unexpected collection count %d, expected 12", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collect_error"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestMmlscallbackCollectorTimeout(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	MmlscallbackExec = func(ctx context.Context) (string, error) {
+		return "", context.DeadlineExceeded
+	}
+	expected := `
+		# HELP gpfs_exporter_collect_timeout Indicates the collector timed out
+		# TYPE gpfs_exporter_collect_timeout gauge
+		gpfs_exporter_collect_timeout{collector="mmlscallback"} 1
+	`
+	collector := NewMmlscallbackCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 12 {
+		t.Errorf("Unexpected collection count %d, expected 12", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collect_timeout"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
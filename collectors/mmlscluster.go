@@ -0,0 +1,189 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	mmlsclusterTimeout  = kingpin.Flag("collector.mmlscluster.timeout", "Timeout for executing mmlscluster").Default("5").Int()
+	mmlsclusterNodeInfo = kingpin.Flag("collector.mmlscluster.node-info", "Collect designation info for every cluster node").Default("false").Bool()
+	MmlsclusterExec     = mmlscluster
+)
+
+type ClusterNodeMetric struct {
+	Node          string
+	AdminNodeName string
+	Designations  []string
+}
+
+type ClusterMetrics struct {
+	Name        string
+	ID          string
+	Nodes       []ClusterNodeMetric
+	QuorumNodes float64
+}
+
+type MmlsclusterCollector struct {
+	Info        *prometheus.Desc
+	Nodes       *prometheus.Desc
+	QuorumNodes *prometheus.Desc
+	NodeInfo    *prometheus.Desc
+	logger      log.Logger
+}
+
+func init() {
+	registerCollector("mmlscluster", false, NewMmlsclusterCollector)
+}
+
+func NewMmlsclusterCollector(logger log.Logger) Collector {
+	return &MmlsclusterCollector{
+		Info: newDesc(prometheus.BuildFQName(namespace, "cluster", "info"),
+			"GPFS cluster information", []string{"name", "id"}, nil),
+		Nodes: newDesc(prometheus.BuildFQName(namespace, "cluster", "nodes"),
+			"GPFS number of nodes in the cluster", nil, nil),
+		QuorumNodes: newDesc(prometheus.BuildFQName(namespace, "cluster", "quorum_nodes"),
+			"GPFS number of quorum nodes in the cluster", nil, nil),
+		NodeInfo: newDesc(prometheus.BuildFQName(namespace, "cluster", "node_info"),
+			"GPFS cluster node designation", []string{"node", "designation", "admin_node_name"}, nil),
+		logger: logger,
+	}
+}
+
+func (c *MmlsclusterCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.Info
+	ch <- c.Nodes
+	ch <- c.QuorumNodes
+	if *mmlsclusterNodeInfo {
+		ch <- c.NodeInfo
+	}
+}
+
+func (c *MmlsclusterCollector) Collect(ch chan<- prometheus.Metric) {
+	level.Debug(c.logger).Log("msg", "Collecting mmlscluster metrics")
+	collectTime := time.Now()
+	metrics, err := c.collect()
+	if err == context.DeadlineExceeded {
+		level.Error(c.logger).Log("msg", "Timeout executing mmlscluster")
+	} else if err != nil {
+		level.Error(c.logger).Log("msg", err)
+	}
+	if err == nil {
+		ch <- prometheus.MustNewConstMetric(c.Info, prometheus.GaugeValue, 1, metrics.Name, metrics.ID)
+		ch <- prometheus.MustNewConstMetric(c.Nodes, prometheus.GaugeValue, float64(len(metrics.Nodes)))
+		ch <- prometheus.MustNewConstMetric(c.QuorumNodes, prometheus.GaugeValue, metrics.QuorumNodes)
+		if *mmlsclusterNodeInfo {
+			for _, n := range metrics.Nodes {
+				for _, d := range n.Designations {
+					ch <- prometheus.MustNewConstMetric(c.NodeInfo, prometheus.GaugeValue, 1, n.Node, d, n.AdminNodeName)
+				}
+			}
+		}
+	}
+	emitCollectorStatus(ch, "mmlscluster", err, collectTime, len(metrics.Nodes))
+}
+
+func (c *MmlsclusterCollector) collect() (ClusterMetrics, error) {
+	ctx, cancel := commandContext("mmlscluster", *mmlsclusterTimeout)
+	defer cancel()
+	out, err := execRetry(ctx, "mmlscluster", func() (string, error) {
+		return MmlsclusterExec(ctx)
+	})
+	if err != nil {
+		return ClusterMetrics{}, err
+	}
+	commandDump.record("mmlscluster", out)
+	metrics := parse_mmlscluster(out)
+	commandDump.recordParsed("mmlscluster", metrics)
+	return metrics, nil
+}
+
+func mmlscluster(ctx context.Context) (string, error) {
+	return RunMMCommand(ctx, "mmlscluster", "-Y")
+}
+
+// mmlscluster_designations returns the roles of a node from its designation,
+// such as quorumManager, and its other node roles. Nodes without a role are clients.
+func mmlscluster_designations(designation string, otherRoles string) []string {
+	var designations []string
+	if strings.Contains(designation, "quorum") {
+		designations = append(designations, "quorum")
+	}
+	if strings.Contains(strings.ToLower(designation), "manager") {
+		designations = append(designations, "manager")
+	}
+	for _, role := range strings.Split(otherRoles, ",") {
+		if strings.TrimSpace(role) == "gateway" {
+			designations = append(designations, "gateway")
+		}
+	}
+	if len(designations) == 0 {
+		designations = append(designations, "client")
+	}
+	return designations
+}
+
+func parse_mmlscluster(out string) ClusterMetrics {
+	var metrics ClusterMetrics
+	headers := make(map[string][]string)
+	lines := strings.Split(out, "\n")
+	for _, l := range lines {
+		if !strings.HasPrefix(l, "mmlscluster") {
+			continue
+		}
+		items := strings.Split(l, ":")
+		if len(items) < 3 {
+			continue
+		}
+		section := items[1]
+		if items[2] == "HEADER" {
+			headers[section] = items
+			continue
+		}
+		value := func(header string) string {
+			if i := SliceIndex(headers[section], header); i != -1 && i < len(items) {
+				return items[i]
+			}
+			return ""
+		}
+		switch section {
+		case "clusterSummary":
+			metrics.Name = value("clusterName")
+			metrics.ID = value("clusterId")
+		case "clusterNode":
+			node := value("daemonNodeName")
+			if node == "" {
+				continue
+			}
+			designations := mmlscluster_designations(value("designation"), value("otherNodeRoles"))
+			if SliceContains(designations, "quorum") {
+				metrics.QuorumNodes++
+			}
+			metrics.Nodes = append(metrics.Nodes, ClusterNodeMetric{
+				Node:          node,
+				AdminNodeName: value("adminNodeName"),
+				Designations:  designations,
+			})
+		}
+	}
+	return metrics
+}
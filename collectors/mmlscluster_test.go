@@ -0,0 +1,181 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var (
+	mmlsclusterStdout = `
+mmlscluster:clusterSummary:HEADER:version:reserved:reserved:clusterName:clusterId:uidDomain:rshPath:rshSudoWrapper:rcpPath:rcpSudoWrapper:repositoryType:primaryServer:secondaryServer:
+mmlscluster:clusterSummary:0:1:::gpfs.example.com:1234567890123456789:example.com:/usr/bin/ssh:no:/usr/bin/scp:no:CCR:::
+mmlscluster:clusterNode:HEADER:version:reserved:reserved:nodeNumber:daemonNodeName:ipAddress:adminNodeName:designation:otherNodeRoles:adminLoginName:otherNodeRolesAlias:
+mmlscluster:clusterNode:0:1:::1:ess01.example.com:10.0.0.1:ess01-admin.example.com:quorumManager:perfmonNode:root:perfmon:
+mmlscluster:clusterNode:0:1:::2:ess02.example.com:10.0.0.2:ess02-admin.example.com:quorum:::
+mmlscluster:clusterNode:0:1:::3:afm01.example.com:10.0.0.3:afm01.example.com::gateway::gateway:
+mmlscluster:clusterNode:0:1:::4:client01.example.com:10.0.0.10:client01.example.com::::
+`
+)
+
+func TestMmlscluster(t *testing.T) {
+	execCommand = fakeExecCommand
+	mockedExitStatus = 0
+	mockedStdout = "foo"
+	defer func() { execCommand = exec.CommandContext }()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out, err := mmlscluster(ctx)
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+	if out != mockedStdout {
+		t.Errorf("Unexpected out: %s", out)
+	}
+}
+
+func TestParseMmlscluster(t *testing.T) {
+	metrics := parse_mmlscluster(mmlsclusterStdout)
+	expected := ClusterMetrics{
+		Name: "gpfs.example.com",
+		ID:   "1234567890123456789",
+		Nodes: []ClusterNodeMetric{
+			{Node: "ess01.example.com", AdminNodeName: "ess01-admin.example.com", Designations: []string{"quorum", "manager"}},
+			{Node: "ess02.example.com", AdminNodeName: "ess02-admin.example.com", Designations: []string{"quorum"}},
+			{Node: "afm01.example.com", AdminNodeName: "afm01.example.com", Designations: []string{"gateway"}},
+			{Node: "client01.example.com", AdminNodeName: "client01.example.com", Designations: []string{"client"}},
+		},
+		QuorumNodes: 2,
+	}
+	if !reflect.DeepEqual(metrics, expected) {
+		t.Errorf("Unexpected metrics\nGot: %v\nExpected: %v", metrics, expected)
+	}
+}
+
+func TestMmlsclusterCollector(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	MmlsclusterExec = func(ctx context.Context) (string, error) {
+		return mmlsclusterStdout, nil
+	}
+	expected := `
+		# HELP gpfs_cluster_info GPFS cluster information
+		# TYPE gpfs_cluster_info gauge
+		gpfs_cluster_info{id="1234567890123456789",name="gpfs.example.com"} 1
+		# HELP gpfs_cluster_nodes GPFS number of nodes in the cluster
+		# TYPE gpfs_cluster_nodes gauge
+		gpfs_cluster_nodes 4
+		# HELP gpfs_cluster_quorum_nodes GPFS number of quorum nodes in the cluster
+		# TYPE gpfs_cluster_quorum_nodes gauge
+		gpfs_cluster_quorum_nodes 2
+	`
+	collector := NewMmlsclusterCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 15 {
+		t.Errorf("Unexpected collection count %d, expected 15", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
+		"gpfs_cluster_info", "gpfs_cluster_nodes", "gpfs_cluster_quorum_nodes", "gpfs_cluster_node_info"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestMmlsclusterCollectorNodeInfo(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.mmlscluster.node-info"}); err != nil {
+		t.Fatal(err)
+	}
+	MmlsclusterExec = func(ctx context.Context) (string, error) {
+		return mmlsclusterStdout, nil
+	}
+	expected := `
+		# HELP gpfs_cluster_node_info GPFS cluster node designation
+		# TYPE gpfs_cluster_node_info gauge
+		gpfs_cluster_node_info{admin_node_name="afm01.example.com",designation="gateway",node="afm01.example.com"} 1
+		gpfs_cluster_node_info{admin_node_name="client01.example.com",designation="client",node="client01.example.com"} 1
+		gpfs_cluster_node_info{admin_node_name="ess01-admin.example.com",designation="manager",node="ess01.example.com"} 1
+		gpfs_cluster_node_info{admin_node_name="ess01-admin.example.com",designation="quorum",node="ess01.example.com"} 1
+		gpfs_cluster_node_info{admin_node_name="ess02-admin.example.com",designation="quorum",node="ess02.example.com"} 1
+	`
+	collector := NewMmlsclusterCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 20 {
+		t.Errorf("Unexpected collection count %d, expected 20", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_cluster_node_info"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestMmlsclusterCollectorError(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	MmlsclusterExec = func(ctx context.Context) (string, error) {
+		return "", fmt.Errorf("Error")
+	}
+	expected := `
+		# HELP gpfs_exporter_collect_error Indicates if error has occurred during collection
+		# TYPE gpfs_exporter_collect_error gauge
+		gpfs_exporter_collect_error{collector="mmlscluster"} 1
+	`
+	collector := NewMmlsclusterCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 12 {
+		t.Errorf("Unexpected collection count %d, expected 12", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collect_error"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestMmlsclusterCollectorTimeout(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	MmlsclusterExec = func(ctx context.Context) (string, error) {
+		return "", context.DeadlineExceeded
+	}
+	expected := `
+		# HELP gpfs_exporter_collect_timeout Indicates the collector timed out
+		# TYPE gpfs_exporter_collect_timeout gauge
+		gpfs_exporter_collect_timeout{collector="mmlscluster"} 1
+	`
+	collector := NewMmlsclusterCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 12 {
+		t.Errorf("Unexpected collection count %d, expected 12", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collect_timeout"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	mmlsconfigTimeout    = kingpin.Flag("collector.mmlsconfig.timeout", "Timeout for executing mmlsconfig").Default("5").Int()
+	mmlsconfigParameters = kingpin.Flag("collector.mmlsconfig.parameters", "Comma separated list of numeric mmlsconfig parameters to collect").Default("pagepool,maxFilesToCache,maxStatCache,workerThreads,maxMBpS,maxblocksize").String()
+	mmlsconfigInfo       = kingpin.Flag("collector.mmlsconfig.info", "Collect gpfs_config_info for every mmlsconfig parameter with a non-numeric value").Default("false").Bool()
+	// mmlsconfigByteParameters are reported in bytes with a _bytes suffix, in lower case
+	mmlsconfigByteParameters = []string{"pagepool", "maxblocksize", "tokenmemlimit"}
+	mmlsconfigValuePattern   = regexp.MustCompile(`^(-?[0-9]+(?:\.[0-9]+)?)([KkMmGgTtPp])?$`)
+	MmlsconfigExec           = mmlsconfig
+)
+
+// ConfigParameter is a mmlsconfig parameter with the value that applies to this node
+type ConfigParameter struct {
+	Name  string
+	Value string
+}
+
+type MmlsconfigCollector struct {
+	Parameters map[string]*prometheus.Desc
+	Info       *prometheus.Desc
+	logger     log.Logger
+}
+
+func init() {
+	registerCollector("mmlsconfig", false, NewMmlsconfigCollector)
+}
+
+func NewMmlsconfigCollector(logger log.Logger) Collector {
+	parameters := make(map[string]*prometheus.Desc)
+	for _, p := range SplitList(*mmlsconfigParameters) {
+		name := strings.ToLower(p)
+		help := fmt.Sprintf("GPFS configured value of %s", p)
+		if SliceContains(mmlsconfigByteParameters, name) {
+			name = name + "_bytes"
+			help = help + " in bytes"
+		}
+		parameters[strings.ToLower(p)] = newDesc(prometheus.BuildFQName(namespace, "config", name), help, nil, nil)
+	}
+	return &MmlsconfigCollector{
+		Parameters: parameters,
+		Info: newDesc(prometheus.BuildFQName(namespace, "config", "info"),
+			"GPFS configured value of a parameter that is not numeric", []string{"name", "value"}, nil),
+		logger: logger,
+	}
+}
+
+func (c *MmlsconfigCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range c.Parameters {
+		ch <- desc
+	}
+	if *mmlsconfigInfo {
+		ch <- c.Info
+	}
+}
+
+func (c *MmlsconfigCollector) Collect(ch chan<- prometheus.Metric) {
+	level.Debug(c.logger).Log("msg", "Collecting mmlsconfig metrics")
+	collectTime := time.Now()
+	parameters, err := c.collect()
+	if err == context.DeadlineExceeded {
+		level.Error(c.logger).Log("msg", "Timeout executing mmlsconfig")
+	} else if err != nil {
+		level.Error(c.logger).Log("msg", err)
+	}
+	if err == nil {
+		for _, p := range parameters {
+			value, numeric := parseConfigValue(p.Value)
+			if desc, ok := c.Parameters[strings.ToLower(p.Name)]; ok {
+				if numeric {
+					ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value)
+				} else {
+					level.Debug(c.logger).Log("msg", "Skipping mmlsconfig parameter with a value that is not numeric", "name", p.Name, "value", p.Value)
+				}
+			}
+			if !numeric && *mmlsconfigInfo {
+				ch <- prometheus.MustNewConstMetric(c.Info, prometheus.GaugeValue, 1, p.Name, p.Value)
+			}
+		}
+	}
+	emitCollectorStatus(ch, "mmlsconfig", err, collectTime, len(parameters))
+}
+
+func (c *MmlsconfigCollector) collect() ([]ConfigParameter, error) {
+	ctx, cancel := commandContext("mmlsconfig", *mmlsconfigTimeout)
+	defer cancel()
+	out, err := execRetry(ctx, "mmlsconfig", func() (string, error) {
+		return MmlsconfigExec(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	commandDump.record("mmlsconfig", out)
+	parameters := parse_mmlsconfig(out, localNodeNames(), c.logger)
+	commandDump.recordParsed("mmlsconfig", parameters)
+	return parameters, nil
+}
+
+func mmlsconfig(ctx context.Context) (string, error) {
+	return RunMMCommand(ctx, "mmlsconfig", "-Y")
+}
+
+// parse_mmlsconfig returns the parameters in the order they are first listed with the value
+// that applies to this node. A value for a node list that includes one of localNames replaces
+// the cluster value, values for other nodes and node classes are skipped as the node classes
+// of this node are not known.
+func parse_mmlsconfig(out string, localNames []string, logger log.Logger) []ConfigParameter {
+	var names []string
+	values := make(map[string]string)
+	overridden := make(map[string]bool)
+	var indexes map[string]int
+	for _, l := range strings.Split(out, "\n") {
+		items := strings.Split(strings.TrimSpace(l), ":")
+		if len(items) < 7 || items[0] != "mmlsconfig" {
+			continue
+		}
+		if items[2] == "HEADER" {
+			indexes = HeaderIndexMap(items)
+			continue
+		}
+		name, ok := headerValue(items, indexes, "configParameter")
+		if !ok || name == "" {
+			continue
+		}
+		value, _ := headerValue(items, indexes, "value")
+		value = DecodeGPFSString(value)
+		nodeList, _ := headerValue(items, indexes, "nodeList")
+		nodeList = DecodeGPFSString(nodeList)
+		if nodeList != "" {
+			local := false
+			for _, node := range strings.Split(nodeList, ",") {
+				if SliceContains(localNames, strings.TrimSpace(node)) {
+					local = true
+					break
+				}
+			}
+			if !local {
+				level.Debug(logger).Log("msg", "Skipping mmlsconfig value for other nodes", "name", name, "value", value, "nodes", nodeList)
+				continue
+			}
+		}
+		if _, ok := values[name]; !ok {
+			names = append(names, name)
+		}
+		if nodeList == "" && overridden[name] {
+			continue
+		}
+		values[name] = value
+		overridden[name] = overridden[name] || nodeList != ""
+	}
+	parameters := make([]ConfigParameter, 0, len(names))
+	for _, name := range names {
+		parameters = append(parameters, ConfigParameter{Name: name, Value: values[name]})
+	}
+	return parameters
+}
+
+// parseConfigValue returns the value of a numeric parameter, a K, M, G, T or P suffix
+// is converted to bytes. ok is false when the value is not numeric.
+func parseConfigValue(value string) (float64, bool) {
+	match := mmlsconfigValuePattern.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil {
+		return 0, false
+	}
+	number, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, false
+	}
+	if match[2] != "" {
+		power := strings.Index("KMGTP", strings.ToUpper(match[2])) + 1
+		number = number * math.Pow(1024, float64(power))
+	}
+	return number, true
+}
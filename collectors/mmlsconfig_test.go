@@ -0,0 +1,228 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var (
+	mmlsconfigStdout = `
+mmlsconfig::HEADER:version:reserved:reserved:configParameter:value:nodeList:
+mmlsconfig::0:1:::clusterName:ess.example.com::
+mmlsconfig::0:1:::autoload:yes::
+mmlsconfig::0:1:::pagepool:64G:nsd1,nsd2:
+mmlsconfig::0:1:::pagepool:16G::
+mmlsconfig::0:1:::pagepool:32G:compute1,compute2:
+mmlsconfig::0:1:::maxFilesToCache:100000::
+mmlsconfig::0:1:::maxFilesToCache:4000:clientNodes:
+mmlsconfig::0:1:::workerThreads:512::
+mmlsconfig::0:1:::maxblocksize:16M::
+mmlsconfig::0:1:::verbsPorts:mlx5_0%2F1:compute1:
+`
+)
+
+func TestMmlsconfig(t *testing.T) {
+	execCommand = fakeExecCommand
+	mockedExitStatus = 0
+	mockedStdout = "foo"
+	defer func() { execCommand = exec.CommandContext }()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out, err := mmlsconfig(ctx)
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+	if out != mockedStdout {
+		t.Errorf("Unexpected out: %s", out)
+	}
+}
+
+func TestParseMmlsconfig(t *testing.T) {
+	parameters := parse_mmlsconfig(mmlsconfigStdout, []string{"compute1.example.com", "compute1"}, log.NewNopLogger())
+	expected := []ConfigParameter{
+		{Name: "clusterName", Value: "ess.example.com"},
+		{Name: "autoload", Value: "yes"},
+		{Name: "pagepool", Value: "32G"},
+		{Name: "maxFilesToCache", Value: "100000"},
+		{Name: "workerThreads", Value: "512"},
+		{Name: "maxblocksize", Value: "16M"},
+		{Name: "verbsPorts", Value: "mlx5_0/1"},
+	}
+	if !reflect.DeepEqual(parameters, expected) {
+		t.Errorf("Unexpected parameters\nGot: %v\nExpected: %v", parameters, expected)
+	}
+	parameters = parse_mmlsconfig(mmlsconfigStdout, []string{"nsd1"}, log.NewNopLogger())
+	if parameters[2].Value != "64G" {
+		t.Errorf("Unexpected pagepool for nsd1, got %s", parameters[2].Value)
+	}
+	parameters = parse_mmlsconfig(mmlsconfigStdout, []string{"login1"}, log.NewNopLogger())
+	if parameters[2].Value != "16G" || len(parameters) != 6 {
+		t.Errorf("Unexpected parameters for login1, got %v", parameters)
+	}
+}
+
+func TestParseMmlsconfigInsertedColumn(t *testing.T) {
+	expected := parse_mmlsconfig(mmlsconfigStdout, []string{"compute1"}, log.NewNopLogger())
+	got := parse_mmlsconfig(insertColumn(mmlsconfigStdout, 7), []string{"compute1"}, log.NewNopLogger())
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Unexpected parameters with inserted column\nGot: %v\nExpected: %v", got, expected)
+	}
+}
+
+func TestParseConfigValue(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected float64
+		numeric  bool
+	}{
+		{value: "100000", expected: 100000, numeric: true},
+		{value: "-1", expected: -1, numeric: true},
+		{value: "512K", expected: 512 * 1024, numeric: true},
+		{value: "16M", expected: 16 * 1024 * 1024, numeric: true},
+		{value: "16G", expected: 16 * 1024 * 1024 * 1024, numeric: true},
+		{value: "1.5g", expected: 1.5 * 1024 * 1024 * 1024, numeric: true},
+		{value: "2T", expected: 2 * 1024 * 1024 * 1024 * 1024, numeric: true},
+		{value: "yes", numeric: false},
+		{value: "mlx5_0/1", numeric: false},
+		{value: "", numeric: false},
+	}
+	for _, test := range tests {
+		value, numeric := parseConfigValue(test.value)
+		if numeric != test.numeric || value != test.expected {
+			t.Errorf("Unexpected value for %q, got %v %v expected %v %v", test.value, value, numeric, test.expected, test.numeric)
+		}
+	}
+}
+
+func TestMmlsconfigCollector(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.mmlsconfig.info"}); err != nil {
+		t.Fatal(err)
+	}
+	defer kingpin.CommandLine.Parse([]string{})
+	defer func() { localNodeNames = localNames }()
+	localNodeNames = func() []string {
+		return []string{"compute1"}
+	}
+	MmlsconfigExec = func(ctx context.Context) (string, error) {
+		return mmlsconfigStdout, nil
+	}
+	expected := `
+		# HELP gpfs_config_info GPFS configured value of a parameter that is not numeric
+		# TYPE gpfs_config_info gauge
+		gpfs_config_info{name="autoload",value="yes"} 1
+		gpfs_config_info{name="clusterName",value="ess.example.com"} 1
+		gpfs_config_info{name="verbsPorts",value="mlx5_0/1"} 1
+		# HELP gpfs_config_maxblocksize_bytes GPFS configured value of maxblocksize in bytes
+		# TYPE gpfs_config_maxblocksize_bytes gauge
+		gpfs_config_maxblocksize_bytes 16777216
+		# HELP gpfs_config_maxfilestocache GPFS configured value of maxFilesToCache
+		# TYPE gpfs_config_maxfilestocache gauge
+		gpfs_config_maxfilestocache 100000
+		# HELP gpfs_config_pagepool_bytes GPFS configured value of pagepool in bytes
+		# TYPE gpfs_config_pagepool_bytes gauge
+		gpfs_config_pagepool_bytes 34359738368
+		# HELP gpfs_config_workerthreads GPFS configured value of workerThreads
+		# TYPE gpfs_config_workerthreads gauge
+		gpfs_config_workerthreads 512
+	`
+	collector := NewMmlsconfigCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 19 {
+		t.Errorf("Unexpected collection count %d, expected 19", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_config_info",
+		"gpfs_config_maxblocksize_bytes", "gpfs_config_maxfilestocache", "gpfs_config_pagepool_bytes",
+		"gpfs_config_workerthreads"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestMmlsconfigCollectorParameters(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.mmlsconfig.parameters=pagepool,autoload"}); err != nil {
+		t.Fatal(err)
+	}
+	defer kingpin.CommandLine.Parse([]string{})
+	MmlsconfigExec = func(ctx context.Context) (string, error) {
+		return mmlsconfigStdout, nil
+	}
+	collector := NewMmlsconfigCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers, "gpfs_config_pagepool_bytes", "gpfs_config_autoload",
+		"gpfs_config_maxfilestocache", "gpfs_config_info"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 1 {
+		t.Errorf("Unexpected collection count %d, expected 1", val)
+	}
+}
+
+func TestMmlsconfigCollectorError(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	MmlsconfigExec = func(ctx context.Context) (string, error) {
+		return "", fmt.Errorf("Error")
+	}
+	expected := `
+		# HELP gpfs_exporter_collect_error Indicates if error has occurred during collection
+		# TYPE gpfs_exporter_collect_error gauge
+		gpfs_exporter_collect_error{collector="mmlsconfig"} 1
+	`
+	collector := NewMmlsconfigCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 12 {
+		t.Errorf("Unexpected collection count %d, expected 12", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collect_error"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestMmlsconfigCollectorTimeout(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	MmlsconfigExec = func(ctx context.Context) (string, error) {
+		return "", context.DeadlineExceeded
+	}
+	expected := `
+		# HELP gpfs_exporter_collect_timeout Indicates the collector timed out
+		# TYPE gpfs_exporter_collect_timeout gauge
+		gpfs_exporter_collect_timeout{collector="mmlsconfig"} 1
+	`
+	collector := NewMmlsconfigCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 12 {
+		t.Errorf("Unexpected collection count %d, expected 12", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collect_timeout"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
@@ -14,11 +14,10 @@
 package collectors
 
 import (
-	"bytes"
 	"context"
 	"fmt"
-	"net/url"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -31,40 +30,83 @@ import (
 )
 
 var (
-	filesetFilesystems = kingpin.Flag("collector.mmlsfileset.filesystems", "Filesystems to query with mmlsfileset, comma separated. Defaults to all filesystems.").Default("").String()
-	filesetTimeout     = kingpin.Flag("collector.mmlsfileset.timeout", "Timeout for mmlsfileset execution").Default("60").Int()
-	filesetMap         = map[string]string{
-		"filesystemName": "FS",
-		"filesetName":    "Fileset",
-		"status":         "Status",
-		"path":           "Path",
-		"created":        "Created",
-		"maxInodes":      "MaxInodes",
-		"allocInodes":    "AllocInodes",
-		"freeInodes":     "FreeInodes",
-	}
-	MmlsfilesetExec = mmlsfileset
+	filesetFilesystems  = kingpin.Flag("collector.mmlsfileset.filesystems", "Filesystems to query with mmlsfileset, comma separated. Defaults to all filesystems.").Default("").String()
+	filesetTimeout      = kingpin.Flag("collector.mmlsfileset.timeout", "Timeout for mmlsfileset execution").Default("60").Int()
+	filesetAFM          = kingpin.Flag("collector.mmlsfileset.afm", "Collect AFM state metrics for AFM filesets").Default("false").Bool()
+	filesetGetSize      = kingpin.Flag("collector.mmlsfileset.get-size", "Collect fileset data size and used inodes, long running operation").Default("false").Bool()
+	filesetSizeTimeout  = kingpin.Flag("collector.mmlsfileset.get-size-timeout", "Timeout for mmlsfileset execution when collecting fileset sizes").Default("600").Int()
+	filesetTopN         = kingpin.Flag("collector.mmlsfileset.topn", "Only collect per fileset metrics for this number of filesets with the lowest free inode percentage and filesets under --collector.mmlsfileset.low-inode-threshold, 0 collects all filesets").Default("0").Int()
+	filesetLowInodes    = kingpin.Flag("collector.mmlsfileset.low-inode-threshold", "Percentage of free inodes under which a fileset is counted by gpfs_fileset_low_inode_count").Default("5").Float64()
+	filesetInodeBuckets = []float64{1, 5, 10, 25, 50, 100}
+	filesetMap          = map[string]string{
+		"filesystemName":    "FS",
+		"filesetName":       "Fileset",
+		"status":            "Status",
+		"path":              "Path",
+		"created":           "Created",
+		"maxInodes":         "MaxInodes",
+		"allocInodes":       "AllocInodes",
+		"freeInodes":        "FreeInodes",
+		"afmTarget":         "AFMTarget",
+		"afmState":          "AFMState",
+		"afmMode":           "AFMMode",
+		"afmNeedsRecovery":  "AFMNeedsRecovery",
+		"inodeSpace":        "InodeSpace",
+		"isInodeSpaceOwner": "InodeSpaceOwner",
+	}
+	filesetAFMHeaders        = []string{"afmTarget", "afmState", "afmMode", "afmNeedsRecovery"}
+	filesetInodeSpaceHeaders = []string{"inodeSpace", "isInodeSpaceOwner"}
+	MmlsfilesetExec          = mmlsfileset
 )
 
 type FilesetMetric struct {
+	FS               string
+	Fileset          string
+	Status           string
+	Path             string
+	Created          float64
+	MaxInodes        float64
+	AllocInodes      float64
+	FreeInodes       float64
+	AFMTarget        string
+	AFMState         string
+	AFMMode          string
+	AFMNeedsRecovery string
+	InodeSpace       string
+	InodeSpaceOwner  string
+	DataSize         *float64
+	UsedInodes       *float64
+}
+
+type InodeSpaceMetric struct {
 	FS          string
-	Fileset     string
-	Status      string
-	Path        string
-	Created     float64
+	InodeSpace  string
+	Owner       string
 	MaxInodes   float64
 	AllocInodes float64
 	FreeInodes  float64
 }
 
 type MmlsfilesetCollector struct {
-	Status      *prometheus.Desc
-	Path        *prometheus.Desc
-	Created     *prometheus.Desc
-	MaxInodes   *prometheus.Desc
-	AllocInodes *prometheus.Desc
-	FreeInodes  *prometheus.Desc
-	logger      log.Logger
+	filesystemOverride
+	Status           *prometheus.Desc
+	Path             *prometheus.Desc
+	Created          *prometheus.Desc
+	MaxInodes        *prometheus.Desc
+	InodesUnlimited  *prometheus.Desc
+	AllocInodes      *prometheus.Desc
+	FreeInodes       *prometheus.Desc
+	AFMState         *prometheus.Desc
+	AFMNeedsRecovery *prometheus.Desc
+	DataSize         *prometheus.Desc
+	UsedInodes       *prometheus.Desc
+	SpaceMaxInodes   *prometheus.Desc
+	SpaceAllocInodes *prometheus.Desc
+	SpaceFreeInodes  *prometheus.Desc
+	Count            *prometheus.Desc
+	LowInodeCount    *prometheus.Desc
+	InodeFreePercent *prometheus.Desc
+	logger           log.Logger
 }
 
 func init() {
@@ -72,20 +114,43 @@ func init() {
 }
 
 func NewMmlsfilesetCollector(logger log.Logger) Collector {
-	labels := []string{"fs", "fileset"}
+	labels := []string{"fs", "remote_cluster", "fileset"}
+	spaceLabels := []string{"fs", "remote_cluster", "inode_space", "owner_fileset"}
 	return &MmlsfilesetCollector{
-		Status: prometheus.NewDesc(prometheus.BuildFQName(namespace, "fileset", "status_info"),
+		Status: newDesc(prometheus.BuildFQName(namespace, "fileset", "status_info"),
 			"GPFS fileset status", append(labels, []string{"status"}...), nil),
-		Path: prometheus.NewDesc(prometheus.BuildFQName(namespace, "fileset", "path_info"),
+		Path: newDesc(prometheus.BuildFQName(namespace, "fileset", "path_info"),
 			"GPFS fileset path", append(labels, []string{"path"}...), nil),
-		Created: prometheus.NewDesc(prometheus.BuildFQName(namespace, "fileset", "created_timestamp_seconds"),
+		Created: newDesc(prometheus.BuildFQName(namespace, "fileset", "created_timestamp_seconds"),
 			"GPFS fileset creation timestamp", labels, nil),
-		MaxInodes: prometheus.NewDesc(prometheus.BuildFQName(namespace, "fileset", "max_inodes"),
+		MaxInodes: newDesc(prometheus.BuildFQName(namespace, "fileset", "max_inodes"),
 			"GPFS fileset max inodes", labels, nil),
-		AllocInodes: prometheus.NewDesc(prometheus.BuildFQName(namespace, "fileset", "alloc_inodes"),
+		InodesUnlimited: newDesc(prometheus.BuildFQName(namespace, "fileset", "inodes_unlimited"),
+			"GPFS fileset has no max inodes limit, max inodes is 0", labels, nil),
+		AllocInodes: newDesc(prometheus.BuildFQName(namespace, "fileset", "alloc_inodes"),
 			"GPFS fileset alloc inodes", labels, nil),
-		FreeInodes: prometheus.NewDesc(prometheus.BuildFQName(namespace, "fileset", "free_inodes"),
+		FreeInodes: newDesc(prometheus.BuildFQName(namespace, "fileset", "free_inodes"),
 			"GPFS fileset free inodes", labels, nil),
+		AFMState: newDesc(prometheus.BuildFQName(namespace, "fileset", "afm_state_info"),
+			"GPFS AFM fileset state", append(labels, []string{"state", "mode"}...), nil),
+		AFMNeedsRecovery: newDesc(prometheus.BuildFQName(namespace, "fileset", "afm_needs_recovery"),
+			"GPFS AFM fileset needs recovery", labels, nil),
+		DataSize: newDesc(prometheus.BuildFQName(namespace, "fileset", "data_size_bytes"),
+			"GPFS fileset data size in bytes", labels, nil),
+		UsedInodes: newDesc(prometheus.BuildFQName(namespace, "fileset", "used_inodes"),
+			"GPFS fileset used inodes", labels, nil),
+		SpaceMaxInodes: newDesc(prometheus.BuildFQName(namespace, "inode_space", "max_inodes"),
+			"GPFS inode space max inodes", spaceLabels, nil),
+		SpaceAllocInodes: newDesc(prometheus.BuildFQName(namespace, "inode_space", "allocated_inodes"),
+			"GPFS inode space allocated inodes", spaceLabels, nil),
+		SpaceFreeInodes: newDesc(prometheus.BuildFQName(namespace, "inode_space", "free_inodes"),
+			"GPFS inode space free inodes", spaceLabels, nil),
+		Count: newDesc(prometheus.BuildFQName(namespace, "fileset", "count"),
+			"GPFS number of filesets", []string{"fs", "remote_cluster"}, nil),
+		LowInodeCount: newDesc(prometheus.BuildFQName(namespace, "fileset", "low_inode_count"),
+			"GPFS number of filesets with a percentage of free inodes under threshold", []string{"fs", "remote_cluster", "threshold"}, nil),
+		InodeFreePercent: newDesc(prometheus.BuildFQName(namespace, "fileset", "inode_free_percent"),
+			"GPFS histogram of the percentage of max inodes that are free for each fileset, filesets without a max inodes limit are 100", []string{"fs", "remote_cluster"}, nil),
 		logger: logger,
 	}
 }
@@ -95,32 +160,26 @@ func (c *MmlsfilesetCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- c.Path
 	ch <- c.Created
 	ch <- c.MaxInodes
+	ch <- c.InodesUnlimited
 	ch <- c.AllocInodes
 	ch <- c.FreeInodes
+	ch <- c.AFMState
+	ch <- c.AFMNeedsRecovery
+	ch <- c.SpaceMaxInodes
+	ch <- c.SpaceAllocInodes
+	ch <- c.SpaceFreeInodes
+	ch <- c.Count
+	ch <- c.LowInodeCount
+	ch <- c.InodeFreePercent
+	if *filesetGetSize {
+		ch <- c.DataSize
+		ch <- c.UsedInodes
+	}
 }
 
 func (c *MmlsfilesetCollector) Collect(ch chan<- prometheus.Metric) {
 	wg := &sync.WaitGroup{}
-	var filesystems []string
-	if *filesetFilesystems == "" {
-		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(*mmlsfsTimeout)*time.Second)
-		defer cancel()
-		var mmlsfsTimeout float64
-		var mmlsfsError float64
-		mmlfsfs_filesystems, err := mmlfsfsFilesystems(ctx, c.logger)
-		if err == context.DeadlineExceeded {
-			mmlsfsTimeout = 1
-			level.Error(c.logger).Log("msg", "Timeout executing mmlsfs")
-		} else if err != nil {
-			mmlsfsError = 1
-			level.Error(c.logger).Log("msg", err)
-		}
-		ch <- prometheus.MustNewConstMetric(collecTimeout, prometheus.GaugeValue, mmlsfsTimeout, "mmlsfileset-mmlsfs")
-		ch <- prometheus.MustNewConstMetric(collectError, prometheus.GaugeValue, mmlsfsError, "mmlsfileset-mmlsfs")
-		filesystems = mmlfsfs_filesystems
-	} else {
-		filesystems = strings.Split(*filesetFilesystems, ",")
-	}
+	filesystems := c.getFilesystems(*filesetFilesystems, "mmlsfileset", ch, c.logger)
 	for _, fs := range filesystems {
 		level.Debug(c.logger).Log("msg", "Collecting mmlsfileset metrics", "fs", fs)
 		wg.Add(1)
@@ -128,57 +187,106 @@ func (c *MmlsfilesetCollector) Collect(ch chan<- prometheus.Metric) {
 		go func(fs string) {
 			defer wg.Done()
 			label := fmt.Sprintf("mmlsfileset-%s", fs)
-			timeout := 0
-			errorMetric := 0
+			fsName, remoteCluster := splitFilesystem(fs)
+			defer recoverCollectorPanic(ch, label, collectTime, c.logger)
 			metrics, err := c.mmlsfilesetCollect(fs)
 			if err == context.DeadlineExceeded {
 				level.Error(c.logger).Log("msg", fmt.Sprintf("Timeout executing %s", label))
-				timeout = 1
 			} else if err != nil {
 				level.Error(c.logger).Log("msg", err, "fs", fs)
-				errorMetric = 1
 			}
-			ch <- prometheus.MustNewConstMetric(collectError, prometheus.GaugeValue, float64(errorMetric), label)
-			ch <- prometheus.MustNewConstMetric(collecTimeout, prometheus.GaugeValue, float64(timeout), label)
-			ch <- prometheus.MustNewConstMetric(collectDuration, prometheus.GaugeValue, time.Since(collectTime).Seconds(), label)
 			if err != nil {
+				emitCollectorStatus(ch, label, err, collectTime, len(metrics))
 				return
 			}
+			var lowInodes float64
+			buckets := make(map[float64]uint64)
+			for _, b := range filesetInodeBuckets {
+				buckets[b] = 0
+			}
+			var sum float64
 			for _, m := range metrics {
-				ch <- prometheus.MustNewConstMetric(c.Status, prometheus.GaugeValue, 1, m.FS, m.Fileset, m.Status)
-				ch <- prometheus.MustNewConstMetric(c.Path, prometheus.GaugeValue, 1, m.FS, m.Fileset, m.Path)
-				ch <- prometheus.MustNewConstMetric(c.Created, prometheus.GaugeValue, m.Created, m.FS, m.Fileset)
-				ch <- prometheus.MustNewConstMetric(c.MaxInodes, prometheus.GaugeValue, m.MaxInodes, m.FS, m.Fileset)
-				ch <- prometheus.MustNewConstMetric(c.AllocInodes, prometheus.GaugeValue, m.AllocInodes, m.FS, m.Fileset)
-				ch <- prometheus.MustNewConstMetric(c.FreeInodes, prometheus.GaugeValue, m.FreeInodes, m.FS, m.Fileset)
+				percent := filesetInodeFreePercent(m)
+				if percent < *filesetLowInodes {
+					lowInodes++
+				}
+				sum += percent
+				for _, b := range filesetInodeBuckets {
+					if percent <= b {
+						buckets[b]++
+					}
+				}
+			}
+			threshold := strconv.FormatFloat(*filesetLowInodes, 'f', -1, 64)
+			ch <- prometheus.MustNewConstMetric(c.Count, prometheus.GaugeValue, float64(len(metrics)), fsName, remoteCluster)
+			ch <- prometheus.MustNewConstMetric(c.LowInodeCount, prometheus.GaugeValue, lowInodes, fsName, remoteCluster, threshold)
+			ch <- prometheus.MustNewConstHistogram(c.InodeFreePercent, uint64(len(metrics)), sum, buckets, fsName, remoteCluster)
+			for _, m := range select_filesets(metrics, *filesetTopN, *filesetLowInodes) {
+				ch <- prometheus.MustNewConstMetric(c.Status, prometheus.GaugeValue, 1, m.FS, remoteCluster, m.Fileset, m.Status)
+				ch <- prometheus.MustNewConstMetric(c.Path, prometheus.GaugeValue, 1, m.FS, remoteCluster, m.Fileset, m.Path)
+				if m.Created != 0 {
+					ch <- prometheus.MustNewConstMetric(c.Created, prometheus.GaugeValue, m.Created, m.FS, remoteCluster, m.Fileset)
+				}
+				ch <- prometheus.MustNewConstMetric(c.MaxInodes, prometheus.GaugeValue, m.MaxInodes, m.FS, remoteCluster, m.Fileset)
+				var unlimited float64
+				if m.MaxInodes == 0 {
+					unlimited = 1
+				}
+				ch <- prometheus.MustNewConstMetric(c.InodesUnlimited, prometheus.GaugeValue, unlimited, m.FS, remoteCluster, m.Fileset)
+				ch <- prometheus.MustNewConstMetric(c.AllocInodes, prometheus.GaugeValue, m.AllocInodes, m.FS, remoteCluster, m.Fileset)
+				ch <- prometheus.MustNewConstMetric(c.FreeInodes, prometheus.GaugeValue, m.FreeInodes, m.FS, remoteCluster, m.Fileset)
+				if m.DataSize != nil {
+					ch <- prometheus.MustNewConstMetric(c.DataSize, prometheus.GaugeValue, *m.DataSize, m.FS, remoteCluster, m.Fileset)
+				}
+				if m.UsedInodes != nil {
+					ch <- prometheus.MustNewConstMetric(c.UsedInodes, prometheus.GaugeValue, *m.UsedInodes, m.FS, remoteCluster, m.Fileset)
+				}
+				if !*filesetAFM || m.AFMTarget == "" {
+					continue
+				}
+				var needsRecovery float64
+				if m.AFMNeedsRecovery == "yes" || m.AFMNeedsRecovery == "true" || m.AFMNeedsRecovery == "1" {
+					needsRecovery = 1
+				}
+				ch <- prometheus.MustNewConstMetric(c.AFMState, prometheus.GaugeValue, 1, m.FS, remoteCluster, m.Fileset, m.AFMState, m.AFMMode)
+				ch <- prometheus.MustNewConstMetric(c.AFMNeedsRecovery, prometheus.GaugeValue, needsRecovery, m.FS, remoteCluster, m.Fileset)
+			}
+			for _, s := range aggregate_inode_spaces(metrics) {
+				ch <- prometheus.MustNewConstMetric(c.SpaceMaxInodes, prometheus.GaugeValue, s.MaxInodes, s.FS, remoteCluster, s.InodeSpace, s.Owner)
+				ch <- prometheus.MustNewConstMetric(c.SpaceAllocInodes, prometheus.GaugeValue, s.AllocInodes, s.FS, remoteCluster, s.InodeSpace, s.Owner)
+				ch <- prometheus.MustNewConstMetric(c.SpaceFreeInodes, prometheus.GaugeValue, s.FreeInodes, s.FS, remoteCluster, s.InodeSpace, s.Owner)
 			}
+			emitCollectorStatus(ch, label, err, collectTime, len(metrics))
 		}(fs)
 	}
 	wg.Wait()
 }
 
 func (c *MmlsfilesetCollector) mmlsfilesetCollect(fs string) ([]FilesetMetric, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(*filesetTimeout)*time.Second)
+	timeout := *filesetTimeout
+	if *filesetGetSize {
+		timeout = *filesetSizeTimeout
+	}
+	ctx, cancel := commandContext("mmlsfileset", timeout)
 	defer cancel()
-	out, err := MmlsfilesetExec(fs, ctx)
+	out, err := execRetry(ctx, "mmlsfileset", func() (string, error) {
+		return MmlsfilesetExec(fs, ctx)
+	})
 	if err != nil {
 		return nil, err
 	}
+	commandDump.record(fmt.Sprintf("mmlsfileset-%s", fs), out)
 	metrics, err := parse_mmlsfileset(out, c.logger)
+	commandDump.recordParsed(fmt.Sprintf("mmlsfileset-%s", fs), metrics)
 	return metrics, err
 }
 
 func mmlsfileset(fs string, ctx context.Context) (string, error) {
-	cmd := execCommand(ctx, *sudoCmd, "/usr/lpp/mmfs/bin/mmlsfileset", fs, "-Y")
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	err := cmd.Run()
-	if ctx.Err() == context.DeadlineExceeded {
-		return "", ctx.Err()
-	} else if err != nil {
-		return "", err
+	args := []string{fs, "-Y"}
+	if *filesetGetSize {
+		args = append(args, "-d", "-i")
 	}
-	return out.String(), nil
+	return RunMMCommand(ctx, "mmlsfileset", args...)
 }
 
 func parse_mmlsfileset(out string, logger log.Logger) ([]FilesetMetric, error) {
@@ -195,54 +303,190 @@ func parse_mmlsfileset(out string, logger log.Logger) ([]FilesetMetric, error) {
 		}
 		var values []string
 		if items[2] == "HEADER" {
-			headers = append(headers, items...)
+			headers = items
 			continue
 		} else {
 			values = append(values, items...)
 		}
+		if len(values) < len(headers) {
+			level.Debug(logger).Log("msg", "Skipping truncated fileset row", "values", len(values), "headers", len(headers), "line", l)
+			parseErrors.WithLabelValues("mmlsfileset").Inc()
+			continue
+		}
 		var metric FilesetMetric
+		var rowErr error
 		ps := reflect.ValueOf(&metric) // pointer to struct - addressable
 		s := ps.Elem()                 // struct
 		for i, h := range headers {
 			if field, ok := filesetMap[h]; ok {
 				f := s.FieldByName(field)
 				if f.Kind() == reflect.String {
-					value := values[i]
-					if h == "path" {
-						pathParsed, err := url.QueryUnescape(values[i])
-						if err != nil {
-							level.Error(logger).Log("msg", "Unable to unescape path", "value", values[i])
-							return nil, err
-						}
-						value = pathParsed
-					}
-					f.SetString(value)
+					f.SetString(DecodeGPFSString(values[i]))
 				} else if f.Kind() == reflect.Float64 {
 					var value float64
 					if h == "created" {
-						createdStr, err := url.QueryUnescape(values[i])
-						if err != nil {
-							level.Error(logger).Log("msg", "Unable to unescape created time", "value", values[i])
-							return nil, err
-						}
-						createdTime, err := time.ParseInLocation(time.ANSIC, createdStr, NowLocation())
+						created, err := parse_fileset_created(values[i])
 						if err != nil {
-							level.Error(logger).Log("msg", "Unable to parse time", "value", createdStr)
-							return nil, err
+							skip_fileset_created(metric.Fileset, err, logger)
 						}
-						value = float64(createdTime.Unix())
+						value = created
 					} else if val, err := strconv.ParseFloat(values[i], 64); err == nil {
 						value = val
 					} else {
-						level.Error(logger).Log("msg", fmt.Sprintf("Error parsing %s value %s: %s", h, values[i], err.Error()))
-						return nil, err
+						rowErr = fmt.Errorf("Error parsing %s value %s: %w", h, values[i], err)
+						break
 					}
 					f.SetFloat(value)
 				}
 			}
 		}
+		if rowErr == nil {
+			rowErr = parse_fileset_size(&metric, headers, values)
+		}
+		if rowErr != nil {
+			skip_fileset_row(metric.Fileset, rowErr, logger)
+			continue
+		}
+		normalize_fileset_afm(&metric)
+		metric.FS, _ = splitFilesystem(metric.FS)
 
 		metrics = append(metrics, metric)
 	}
 	return metrics, nil
 }
+
+// normalize_fileset_afm clears the AFM fields of filesets that are not AFM filesets
+func normalize_fileset_afm(metric *FilesetMetric) {
+	if metric.AFMTarget == "-" {
+		metric.AFMTarget = ""
+		metric.AFMState = ""
+		metric.AFMMode = ""
+		metric.AFMNeedsRecovery = ""
+	}
+	metric.AFMNeedsRecovery = strings.ToLower(metric.AFMNeedsRecovery)
+}
+
+// parse_fileset_size sets the data size and used inodes reported by mmlsfileset -d -i,
+// values of - are left unset so no metric is collected for the fileset.
+func parse_fileset_size(metric *FilesetMetric, headers []string, items []string) error {
+	for h, f := range map[string]**float64{"dataInKB": &metric.DataSize, "inodes": &metric.UsedInodes} {
+		i := SliceIndex(headers, h)
+		if i == -1 || i >= len(items) || items[i] == "-" || items[i] == "" {
+			continue
+		}
+		val, err := strconv.ParseFloat(items[i], 64)
+		if err != nil {
+			return fmt.Errorf("Error parsing %s value %s: %w", h, items[i], err)
+		}
+		if h == "dataInKB" {
+			val = KBToBytes(val)
+		}
+		*f = &val
+	}
+	return nil
+}
+
+// skip_fileset_row records a fileset row that could not be parsed so the
+// remaining filesets are still collected.
+func skip_fileset_row(fileset string, err error, logger log.Logger) {
+	level.Warn(logger).Log("msg", "Skipping fileset with unparsable values", "fileset", fileset, "err", err)
+	parseErrors.WithLabelValues("mmlsfileset").Inc()
+}
+
+// skip_fileset_created records a fileset created time that could not be parsed, the fileset
+// is still collected without its created timestamp.
+func skip_fileset_created(fileset string, err error, logger log.Logger) {
+	level.Warn(logger).Log("msg", "Skipping fileset created time that can not be parsed", "fileset", fileset, "err", err)
+	parseErrors.WithLabelValues("mmlsfileset").Inc()
+}
+
+func parse_fileset_created(value string) (float64, error) {
+	createdStr := DecodeGPFSString(value)
+	createdTime, err := parseGPFSTime(createdStr)
+	if err != nil {
+		return 0, fmt.Errorf("Unable to parse created time %s: %w", createdStr, err)
+	}
+	return float64(createdTime.Unix()), nil
+}
+
+// aggregate_inode_spaces groups filesets by the inode space they belong to. The inode
+// values of a space are those of the independent fileset that owns it, dependent filesets
+// are only used when the owning fileset was not collected.
+// filesetInodeFreePercent returns the percentage of max inodes that are not used,
+// a fileset without a max inodes limit is 100
+func filesetInodeFreePercent(m FilesetMetric) float64 {
+	if m.MaxInodes <= 0 {
+		return 100
+	}
+	used := m.AllocInodes - m.FreeInodes
+	percent := (m.MaxInodes - used) / m.MaxInodes * 100
+	if percent < 0 {
+		return 0
+	}
+	return percent
+}
+
+// select_filesets returns the topn filesets with the lowest free inode percentage and any
+// fileset under threshold, in the order they were parsed. Ties are ordered by fileset name
+// so the same filesets are selected for the same output. All filesets are returned when topn is 0.
+func select_filesets(metrics []FilesetMetric, topn int, threshold float64) []FilesetMetric {
+	if topn <= 0 || len(metrics) <= topn {
+		return metrics
+	}
+	order := make([]int, len(metrics))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := metrics[order[i]], metrics[order[j]]
+		pa, pb := filesetInodeFreePercent(a), filesetInodeFreePercent(b)
+		if pa != pb {
+			return pa < pb
+		}
+		return a.Fileset < b.Fileset
+	})
+	selected := make([]bool, len(metrics))
+	for rank, i := range order {
+		if rank < topn || filesetInodeFreePercent(metrics[i]) < threshold {
+			selected[i] = true
+		}
+	}
+	var filesets []FilesetMetric
+	for i, m := range metrics {
+		if selected[i] {
+			filesets = append(filesets, m)
+		}
+	}
+	return filesets
+}
+
+func aggregate_inode_spaces(metrics []FilesetMetric) []InodeSpaceMetric {
+	var spaces []InodeSpaceMetric
+	index := make(map[string]int)
+	for _, m := range metrics {
+		if m.InodeSpace == "" || m.InodeSpace == "-" {
+			continue
+		}
+		key := fmt.Sprintf("%s-%s", m.FS, m.InodeSpace)
+		i, ok := index[key]
+		if !ok {
+			spaces = append(spaces, InodeSpaceMetric{FS: m.FS, InodeSpace: m.InodeSpace})
+			i = len(spaces) - 1
+			index[key] = i
+		}
+		s := &spaces[i]
+		if m.InodeSpaceOwner == "1" {
+			s.Owner = m.Fileset
+			s.MaxInodes = m.MaxInodes
+			s.AllocInodes = m.AllocInodes
+			s.FreeInodes = m.FreeInodes
+			continue
+		}
+		if s.Owner == "" && m.MaxInodes > s.MaxInodes {
+			s.MaxInodes = m.MaxInodes
+			s.AllocInodes = m.AllocInodes
+			s.FreeInodes = m.FreeInodes
+		}
+	}
+	return spaces
+}
@@ -17,6 +17,7 @@ import (
 	"context"
 	"fmt"
 	"os/exec"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -32,6 +33,35 @@ mmlsfileset::HEADER:version:reserved:reserved:filesystemName:filesetName:id:root
 mmlsfileset::0:1:::project:root:0:3:Linked:%2Ffs%2Fproject:--:Wed May 18 10%3A41%3A35 2016:-:-:root fileset:off:-:-:-:-:-:-:-:-:-:-:-:-:0:1:300000000:102052224:2692530176:-:-:-:-:-:-:-:-:0:-:-:-:chmodAndSetacl:-:102045986:-:-:-:-:-:-:-:-:-:
 mmlsfileset::0:1:::project:ibtest:1:524291:Linked:%2Ffs%2Fproject%2Fibtest:0:Tue Jun 28 07%3A08%3A46 2016:-:-::off:-:-:-:-:-:-:-:-:-:-:-:-:1:1:1000000:556032:2692530176:-:-:-:-:-:-:-:-:0:-:-:-:chmodAndSetacl:-:544397:-:-:-:-:-:-:-:-:-:
 mmlsfileset::0:1:::project:PAS1136:2:17255366659:Unlinked:%2D%2D:--:Wed Nov 22 14%3A29%3A26 2017:-:-::off:-:-:-:-:-:-:-:-:-:-:-:-:164:1:1100000:1000000:2692530176:-:-:-:-:-:-:-:-:0:-:-:-:chmodAndSetacl:-:989069:-:-:-:-:-:-:-:-:-:
+`
+	mmlsfilesetStdoutTruncated = `
+mmlsfileset::HEADER:version:reserved:reserved:filesystemName:filesetName:id:rootInode:status:path:parentId:created:inodes:dataInKB:comment:filesetMode:afmTarget:afmState:afmMode:afmFileLookupRefreshInterval:afmFileOpenRefreshInterval:afmDirLookupRefreshInterval:afmDirOpenRefreshInterval:afmAsyncDelay:afmNeedsRecovery:afmExpirationTimeout:afmRPO:afmLastPSnapId:inodeSpace:isInodeSpaceOwner:maxInodes:allocInodes:inodeSpaceMask:afmShowHomeSnapshots:afmNumReadThreads:reserved:afmReadBufferSize:afmWriteBufferSize:afmReadSparseThreshold:afmParallelReadChunkSize:afmParallelReadThreshold:snapId:afmNumFlushThreads:afmPrefetchThreshold:afmEnableAutoEviction:permChangeFlag:afmParallelWriteThreshold:freeInodes:afmNeedsResync:afmParallelWriteChunkSize:afmNumWriteThreads:afmPrimaryID:afmDRState:afmAssociatedPrimaryId:afmDIO:afmGatewayNode:afmIOFlags:
+mmlsfileset::0:1:::project:root:0:3:Linked:%2Ffs%2Fproject:--:Wed May 18 10%3A41%3A35 2016:-:-:root fileset:off:-:-:-:-:-:-:-:-:-:-:-:-:0:1:300000000:102052224:2692530176:-:-:-:-:-:-:-:-:0:-:-:-:chmodAndSetacl:-:102045986:-:-:-:-:-:-:-:-:-:
+mmlsfileset::0:1:::project:ibtest:1:524291:Linked:%2Ffs%2Fproject%2Fibtest:0:Tue Jun 28 07%3A08%3A46 2016:-:-::off:-:-:-:-:-:-:-:-:-:-:-:-:1:1:1000000
+`
+	mmlsfilesetStdoutEncoded = `
+mmlsfileset::HEADER:version:reserved:reserved:filesystemName:filesetName:id:rootInode:status:path:parentId:created:inodes:dataInKB:comment:inodeSpace:isInodeSpaceOwner:maxInodes:allocInodes:freeInodes:
+mmlsfileset::0:1:::project:caf%C3%A9:1:524291:Linked:%2Ffs%2Fproject%2Fmy%20caf%C3%A9:0:Tue Jun 28 07%3A08%3A46 2016:-:-:lab%3A data+archive:1:1:1000000:556032:544397:
+`
+	mmlsfilesetStdoutSize = `
+mmlsfileset::HEADER:version:reserved:reserved:filesystemName:filesetName:id:rootInode:status:path:parentId:created:inodes:dataInKB:comment:inodeSpace:isInodeSpaceOwner:maxInodes:allocInodes:freeInodes:
+mmlsfileset::0:1:::project:root:0:3:Linked:%2Ffs%2Fproject:--:Wed May 18 10%3A41%3A35 2016:6238:5242880:root fileset:0:1:300000000:102052224:102045986:
+mmlsfileset::0:1:::project:ibtest:1:524291:Linked:%2Ffs%2Fproject%2Fibtest:0:Tue Jun 28 07%3A08%3A46 2016:11635:1024::1:1:1000000:556032:544397:
+mmlsfileset::0:1:::project:PAS1136:2:17255366659:Unlinked:%2D%2D:--:Wed Nov 22 14%3A29%3A26 2017:-:-::164:1:1100000:1000000:989069:
+`
+	mmlsfilesetStdoutInodeSpace = `
+mmlsfileset::HEADER:version:reserved:reserved:filesystemName:filesetName:id:rootInode:status:path:parentId:created:inodes:dataInKB:comment:inodeSpace:isInodeSpaceOwner:maxInodes:allocInodes:freeInodes:
+mmlsfileset::0:1:::project:root:0:3:Linked:%2Ffs%2Fproject:--:Wed May 18 10%3A41%3A35 2016:-:-:root fileset:0:1:300000000:102052224:102045986:
+mmlsfileset::0:1:::project:apps:1:524291:Linked:%2Ffs%2Fproject%2Fapps:0:Tue Jun 28 07%3A08%3A46 2016:-:-::0:0:0:0:0:
+mmlsfileset::0:1:::project:PAS1136:2:17255366659:Linked:%2Ffs%2Fproject%2FPAS1136:0:Wed Nov 22 14%3A29%3A26 2017:-:-::164:1:1000000:1000000:10:
+mmlsfileset::0:1:::project:PAS1136_data:3:17255366660:Linked:%2Ffs%2Fproject%2FPAS1136%2Fdata:2:Wed Nov 22 14%3A29%3A26 2017:-:-::164:0:0:0:0:
+mmlsfileset::0:1:::project:PAS1136_home:4:17255366661:Linked:%2Ffs%2Fproject%2FPAS1136%2Fhome:2:Wed Nov 22 14%3A29%3A26 2017:-:-::164:0:0:0:0:
+`
+	mmlsfilesetStdoutAFM = `
+mmlsfileset::HEADER:version:reserved:reserved:filesystemName:filesetName:id:rootInode:status:path:parentId:created:inodes:dataInKB:comment:filesetMode:afmTarget:afmState:afmMode:afmFileLookupRefreshInterval:afmFileOpenRefreshInterval:afmDirLookupRefreshInterval:afmDirOpenRefreshInterval:afmAsyncDelay:afmNeedsRecovery:afmExpirationTimeout:afmRPO:afmLastPSnapId:inodeSpace:isInodeSpaceOwner:maxInodes:allocInodes:inodeSpaceMask:afmShowHomeSnapshots:afmNumReadThreads:reserved:afmReadBufferSize:afmWriteBufferSize:afmReadSparseThreshold:afmParallelReadChunkSize:afmParallelReadThreshold:snapId:afmNumFlushThreads:afmPrefetchThreshold:afmEnableAutoEviction:permChangeFlag:afmParallelWriteThreshold:freeInodes:afmNeedsResync:afmParallelWriteChunkSize:afmNumWriteThreads:afmPrimaryID:afmDRState:afmAssociatedPrimaryId:afmDIO:afmGatewayNode:afmIOFlags:
+mmlsfileset::0:1:::project:ibtest:1:524291:Linked:%2Ffs%2Fproject%2Fibtest:0:Tue Jun 28 07%3A08%3A46 2016:-:-::off:-:-:-:-:-:-:-:-:-:-:-:-:1:1:1000000:556032:2692530176:-:-:-:-:-:-:-:-:0:-:-:-:chmodAndSetacl:-:544397:-:-:-:-:-:-:-:-:-:
+mmlsfileset::0:1:::project:cache1:3:1048579:Linked:%2Ffs%2Fproject%2Fcache1:0:Tue Jun 28 07%3A08%3A46 2016:-:-::off:nfs%3A%2F%2Fhome%2Fcache1:Active:sw:30:60:60:60:15:no:-:-:-:2:1:1000000:556032:2692530176:-:-:-:-:-:-:-:-:0:-:-:-:chmodAndSetacl:-:544397:-:-:-:-:-:-:-:-:-:
+mmlsfileset::0:1:::project:cache2:4:1572867:Linked:%2Ffs%2Fproject%2Fcache2:0:Tue Jun 28 07%3A08%3A46 2016:-:-::off:nfs%3A%2F%2Fhome%2Fcache2:NeedsRecovery:iw:30:60:60:60:15:yes:-:-:-:3:1:1000000:556032:2692530176:-:-:-:-:-:-:-:-:0:-:-:-:chmodAndSetacl:-:544397:-:-:-:-:-:-:-:-:-:
 `
 	mmlsfilesetStdoutBadTime = `
 mmlsfileset::HEADER:version:reserved:reserved:filesystemName:filesetName:id:rootInode:status:path:parentId:created:inodes:dataInKB:comment:filesetMode:afmTarget:afmState:afmMode:afmFileLookupRefreshInterval:afmFileOpenRefreshInterval:afmDirLookupRefreshInterval:afmDirOpenRefreshInterval:afmAsyncDelay:afmNeedsRecovery:afmExpirationTimeout:afmRPO:afmLastPSnapId:inodeSpace:isInodeSpaceOwner:maxInodes:allocInodes:inodeSpaceMask:afmShowHomeSnapshots:afmNumReadThreads:reserved:afmReadBufferSize:afmWriteBufferSize:afmReadSparseThreshold:afmParallelReadChunkSize:afmParallelReadThreshold:snapId:afmNumFlushThreads:afmPrefetchThreshold:afmEnableAutoEviction:permChangeFlag:afmParallelWriteThreshold:freeInodes:afmNeedsResync:afmParallelWriteChunkSize:afmNumWriteThreads:afmPrimaryID:afmDRState:afmAssociatedPrimaryId:afmDIO:afmGatewayNode:afmIOFlags:
@@ -123,17 +153,192 @@ func TestParseMmlsfileset(t *testing.T) {
 	}
 }
 
-func TestParseMmlsfilesetErrors(t *testing.T) {
-	_, err := parse_mmlsfileset(mmlsfilesetStdoutBadTime, log.NewNopLogger())
-	if err == nil {
-		t.Errorf("Expected error")
+func TestParseMmlsfilesetEncoded(t *testing.T) {
+	metrics, err := parse_mmlsfileset(mmlsfilesetStdoutEncoded, log.NewNopLogger())
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
 		return
 	}
-	_, err = parse_mmlsfileset(mmlsfilesetStdoutBadValue, log.NewNopLogger())
-	if err == nil {
-		t.Errorf("Expected error")
+	if len(metrics) != 1 {
+		t.Errorf("Unexpected number of metrics, got %d", len(metrics))
+		return
+	}
+	if metrics[0].Fileset != "café" {
+		t.Errorf("Unexpected value for Fileset, got %v", metrics[0].Fileset)
+	}
+	if metrics[0].Path != "/fs/project/my café" {
+		t.Errorf("Unexpected value for Path, got %v", metrics[0].Path)
+	}
+	if metrics[0].Created != 1467115726 {
+		t.Errorf("Unexpected value for Created, got %v", metrics[0].Created)
+	}
+}
+
+func TestParseMmlsfilesetAFM(t *testing.T) {
+	metrics, err := parse_mmlsfileset(mmlsfilesetStdoutAFM, log.NewNopLogger())
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
 		return
 	}
+	if len(metrics) != 3 {
+		t.Errorf("Unexpected number of metrics, got %d", len(metrics))
+		return
+	}
+	if metrics[0].AFMTarget != "" || metrics[0].AFMState != "" || metrics[0].AFMMode != "" {
+		t.Errorf("Unexpected AFM values for non-AFM fileset, got %+v", metrics[0])
+	}
+	if metrics[1].AFMState != "Active" || metrics[1].AFMMode != "sw" || metrics[1].AFMNeedsRecovery != "no" {
+		t.Errorf("Unexpected AFM values for cache1, got %+v", metrics[1])
+	}
+	if metrics[2].AFMState != "NeedsRecovery" || metrics[2].AFMMode != "iw" || metrics[2].AFMNeedsRecovery != "yes" {
+		t.Errorf("Unexpected AFM values for cache2, got %+v", metrics[2])
+	}
+}
+
+func TestParseMmlsfilesetSize(t *testing.T) {
+	metrics, err := parse_mmlsfileset(mmlsfilesetStdoutSize, log.NewNopLogger())
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+		return
+	}
+	if len(metrics) != 3 {
+		t.Errorf("Unexpected number of metrics, got %d", len(metrics))
+		return
+	}
+	if metrics[0].DataSize == nil || *metrics[0].DataSize != 5368709120 {
+		t.Errorf("Unexpected value for DataSize, got %v", metrics[0].DataSize)
+	}
+	if metrics[0].UsedInodes == nil || *metrics[0].UsedInodes != 6238 {
+		t.Errorf("Unexpected value for UsedInodes, got %v", metrics[0].UsedInodes)
+	}
+	if metrics[2].DataSize != nil {
+		t.Errorf("Unexpected value for DataSize, got %v", *metrics[2].DataSize)
+	}
+	if metrics[2].UsedInodes != nil {
+		t.Errorf("Unexpected value for UsedInodes, got %v", *metrics[2].UsedInodes)
+	}
+}
+
+func TestAggregateInodeSpaces(t *testing.T) {
+	metrics, err := parse_mmlsfileset(mmlsfilesetStdoutInodeSpace, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	spaces := aggregate_inode_spaces(metrics)
+	if len(spaces) != 2 {
+		t.Fatalf("Unexpected number of inode spaces, got %d", len(spaces))
+	}
+	if spaces[1].InodeSpace != "164" || spaces[1].Owner != "PAS1136" {
+		t.Errorf("Unexpected inode space, got %v", spaces[1])
+	}
+	if spaces[1].MaxInodes != 1000000 || spaces[1].AllocInodes != 1000000 || spaces[1].FreeInodes != 10 {
+		t.Errorf("Unexpected inode space values, got %v", spaces[1])
+	}
+	noOwner := aggregate_inode_spaces(metrics[3:])
+	if len(noOwner) != 1 || noOwner[0].Owner != "" || noOwner[0].MaxInodes != 0 {
+		t.Errorf("Unexpected inode space without owner, got %v", noOwner)
+	}
+}
+
+func TestSelectFilesets(t *testing.T) {
+	metrics := []FilesetMetric{
+		{Fileset: "c", MaxInodes: 100, AllocInodes: 100, FreeInodes: 50},
+		{Fileset: "unlimited", MaxInodes: 0, AllocInodes: 100, FreeInodes: 0},
+		{Fileset: "b", MaxInodes: 100, AllocInodes: 100, FreeInodes: 50},
+		{Fileset: "full", MaxInodes: 100, AllocInodes: 100, FreeInodes: 0},
+		{Fileset: "a", MaxInodes: 100, AllocInodes: 100, FreeInodes: 96},
+	}
+	names := func(filesets []FilesetMetric) []string {
+		var n []string
+		for _, f := range filesets {
+			n = append(n, f.Fileset)
+		}
+		return n
+	}
+	tests := []struct {
+		topn      int
+		threshold float64
+		expected  []string
+	}{
+		{topn: 0, threshold: 5, expected: []string{"c", "unlimited", "b", "full", "a"}},
+		{topn: 10, threshold: 5, expected: []string{"c", "unlimited", "b", "full", "a"}},
+		{topn: 1, threshold: 5, expected: []string{"full"}},
+		{topn: 2, threshold: 5, expected: []string{"b", "full"}},
+		{topn: 1, threshold: 60, expected: []string{"c", "b", "full"}},
+	}
+	for _, test := range tests {
+		for i := 0; i < 5; i++ {
+			if got := names(select_filesets(metrics, test.topn, test.threshold)); !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("Unexpected filesets for topn %d threshold %v\nExpected: %v\nGot: %v", test.topn, test.threshold, test.expected, got)
+			}
+		}
+	}
+	if val := filesetInodeFreePercent(metrics[1]); val != 100 {
+		t.Errorf("Unexpected free percent for unlimited fileset %v", val)
+	}
+	if val := filesetInodeFreePercent(metrics[4]); val != 96 {
+		t.Errorf("Unexpected free percent %v", val)
+	}
+}
+
+func TestParseMmlsfilesetErrors(t *testing.T) {
+	for _, out := range []string{mmlsfilesetStdoutBadTime, mmlsfilesetStdoutBadValue} {
+		before := testutil.ToFloat64(parseErrors.WithLabelValues("mmlsfileset"))
+		metrics, err := parse_mmlsfileset(out, log.NewNopLogger())
+		if err != nil {
+			t.Errorf("Unexpected error: %s", err.Error())
+			return
+		}
+		if val := testutil.ToFloat64(parseErrors.WithLabelValues("mmlsfileset")) - before; val != 1 {
+			t.Errorf("Unexpected parse errors, got %v", val)
+		}
+		if out == mmlsfilesetStdoutBadTime {
+			if len(metrics) != 3 || metrics[0].Fileset != "root" || metrics[0].Created != 0 || metrics[0].MaxInodes != 300000000 {
+				t.Errorf("Unexpected metrics for bad time: %+v", metrics)
+			}
+			continue
+		}
+		if len(metrics) != 2 {
+			t.Errorf("Unexpected number of metrics, got %d", len(metrics))
+			return
+		}
+		if metrics[0].Fileset != "ibtest" || metrics[1].Fileset != "PAS1136" {
+			t.Errorf("Unexpected filesets: %+v", metrics)
+		}
+	}
+}
+
+func TestParseMmlsfilesetTruncated(t *testing.T) {
+	before := testutil.ToFloat64(parseErrors.WithLabelValues("mmlsfileset"))
+	metrics, err := parse_mmlsfileset(mmlsfilesetStdoutTruncated, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if len(metrics) != 1 || metrics[0].Fileset != "root" {
+		t.Errorf("Unexpected metrics for truncated row: %+v", metrics)
+	}
+	if val := testutil.ToFloat64(parseErrors.WithLabelValues("mmlsfileset")) - before; val != 1 {
+		t.Errorf("Unexpected parse errors, got %v", val)
+	}
+}
+
+func TestParseMmlsfilesetLocalizedTime(t *testing.T) {
+	localized := strings.Replace(mmlsfilesetStdout, "Wed May 18 10%3A41%3A35 2016", "Mi Mai 18 10%3A41%3A35 2016", 1)
+	zoned := strings.Replace(mmlsfilesetStdout, "Wed May 18 10%3A41%3A35 2016", "Wed May 18 10%3A41%3A35 EST 2016", 1)
+	metrics, err := parse_mmlsfileset(localized, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if len(metrics) != 3 || metrics[0].Created != 0 || metrics[1].Created != 1467115726 {
+		t.Errorf("Unexpected metrics for localized time: %+v", metrics)
+	}
+	metrics, err = parse_mmlsfileset(zoned, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if len(metrics) != 3 || metrics[0].Created != 1463586095 {
+		t.Errorf("Unexpected metrics for time with timezone: %+v", metrics)
+	}
 }
 
 func TestMmlsfilesetCollector(t *testing.T) {
@@ -148,41 +353,41 @@ func TestMmlsfilesetCollector(t *testing.T) {
 	expected := `
 		# HELP gpfs_fileset_alloc_inodes GPFS fileset alloc inodes
 		# TYPE gpfs_fileset_alloc_inodes gauge
-		gpfs_fileset_alloc_inodes{fileset="PAS1136",fs="project"} 1000000
-		gpfs_fileset_alloc_inodes{fileset="ibtest",fs="project"} 556032
-		gpfs_fileset_alloc_inodes{fileset="root",fs="project"} 102052224
+		gpfs_fileset_alloc_inodes{fileset="PAS1136",fs="project",remote_cluster=""} 1000000
+		gpfs_fileset_alloc_inodes{fileset="ibtest",fs="project",remote_cluster=""} 556032
+		gpfs_fileset_alloc_inodes{fileset="root",fs="project",remote_cluster=""} 102052224
 		# HELP gpfs_fileset_created_timestamp_seconds GPFS fileset creation timestamp
 		# TYPE gpfs_fileset_created_timestamp_seconds gauge
-		gpfs_fileset_created_timestamp_seconds{fileset="PAS1136",fs="project"} 1511378966
-		gpfs_fileset_created_timestamp_seconds{fileset="ibtest",fs="project"} 1467115726
-		gpfs_fileset_created_timestamp_seconds{fileset="root",fs="project"} 1463586095
+		gpfs_fileset_created_timestamp_seconds{fileset="PAS1136",fs="project",remote_cluster=""} 1511378966
+		gpfs_fileset_created_timestamp_seconds{fileset="ibtest",fs="project",remote_cluster=""} 1467115726
+		gpfs_fileset_created_timestamp_seconds{fileset="root",fs="project",remote_cluster=""} 1463586095
 		# HELP gpfs_fileset_free_inodes GPFS fileset free inodes
 		# TYPE gpfs_fileset_free_inodes gauge
-		gpfs_fileset_free_inodes{fileset="PAS1136",fs="project"} 989069
-		gpfs_fileset_free_inodes{fileset="ibtest",fs="project"} 544397
-		gpfs_fileset_free_inodes{fileset="root",fs="project"} 102045986
+		gpfs_fileset_free_inodes{fileset="PAS1136",fs="project",remote_cluster=""} 989069
+		gpfs_fileset_free_inodes{fileset="ibtest",fs="project",remote_cluster=""} 544397
+		gpfs_fileset_free_inodes{fileset="root",fs="project",remote_cluster=""} 102045986
 		# HELP gpfs_fileset_max_inodes GPFS fileset max inodes
 		# TYPE gpfs_fileset_max_inodes gauge
-		gpfs_fileset_max_inodes{fileset="PAS1136",fs="project"} 1100000
-		gpfs_fileset_max_inodes{fileset="ibtest",fs="project"} 1000000
-		gpfs_fileset_max_inodes{fileset="root",fs="project"} 300000000
+		gpfs_fileset_max_inodes{fileset="PAS1136",fs="project",remote_cluster=""} 1100000
+		gpfs_fileset_max_inodes{fileset="ibtest",fs="project",remote_cluster=""} 1000000
+		gpfs_fileset_max_inodes{fileset="root",fs="project",remote_cluster=""} 300000000
 		# HELP gpfs_fileset_path_info GPFS fileset path
 		# TYPE gpfs_fileset_path_info gauge
-		gpfs_fileset_path_info{fileset="PAS1136",fs="project",path="--"} 1
-		gpfs_fileset_path_info{fileset="ibtest",fs="project",path="/fs/project/ibtest"} 1
-		gpfs_fileset_path_info{fileset="root",fs="project",path="/fs/project"} 1
+		gpfs_fileset_path_info{fileset="PAS1136",fs="project",path="--",remote_cluster=""} 1
+		gpfs_fileset_path_info{fileset="ibtest",fs="project",path="/fs/project/ibtest",remote_cluster=""} 1
+		gpfs_fileset_path_info{fileset="root",fs="project",path="/fs/project",remote_cluster=""} 1
 		# HELP gpfs_fileset_status_info GPFS fileset status
 		# TYPE gpfs_fileset_status_info gauge
-		gpfs_fileset_status_info{fileset="PAS1136",fs="project",status="Unlinked"} 1
-		gpfs_fileset_status_info{fileset="ibtest",fs="project",status="Linked"} 1
-		gpfs_fileset_status_info{fileset="root",fs="project",status="Linked"} 1
+		gpfs_fileset_status_info{fileset="PAS1136",fs="project",remote_cluster="",status="Unlinked"} 1
+		gpfs_fileset_status_info{fileset="ibtest",fs="project",remote_cluster="",status="Linked"} 1
+		gpfs_fileset_status_info{fileset="root",fs="project",remote_cluster="",status="Linked"} 1
 	`
 	collector := NewMmlsfilesetCollector(log.NewNopLogger())
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
-	} else if val != 21 {
-		t.Errorf("Unexpected collection count %d, expected 21", val)
+	} else if val != 48 {
+		t.Errorf("Unexpected collection count %d, expected 48", val)
 	}
 	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
 		"gpfs_fileset_created_timestamp_seconds", "gpfs_fileset_status_info", "gpfs_fileset_path_info",
@@ -191,6 +396,206 @@ func TestMmlsfilesetCollector(t *testing.T) {
 	}
 }
 
+func TestMmlsfilesetCollectorTopN(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.mmlsfileset.topn=1", "--collector.mmlsfileset.low-inode-threshold=99.01"}); err != nil {
+		t.Fatal(err)
+	}
+	defer kingpin.CommandLine.Parse([]string{})
+	filesystems := "project"
+	filesetFilesystems = &filesystems
+	MmlsfilesetExec = func(fs string, ctx context.Context) (string, error) {
+		return mmlsfilesetStdout, nil
+	}
+	expected := `
+		# HELP gpfs_fileset_count GPFS number of filesets
+		# TYPE gpfs_fileset_count gauge
+		gpfs_fileset_count{fs="project",remote_cluster=""} 3
+		# HELP gpfs_fileset_free_inodes GPFS fileset free inodes
+		# TYPE gpfs_fileset_free_inodes gauge
+		gpfs_fileset_free_inodes{fileset="PAS1136",fs="project",remote_cluster=""} 989069
+		gpfs_fileset_free_inodes{fileset="ibtest",fs="project",remote_cluster=""} 544397
+		# HELP gpfs_fileset_inode_free_percent GPFS histogram of the percentage of max inodes that are free for each fileset, filesets without a max inodes limit are 100
+		# TYPE gpfs_fileset_inode_free_percent histogram
+		gpfs_fileset_inode_free_percent_bucket{fs="project",remote_cluster="",le="1"} 0
+		gpfs_fileset_inode_free_percent_bucket{fs="project",remote_cluster="",le="5"} 0
+		gpfs_fileset_inode_free_percent_bucket{fs="project",remote_cluster="",le="10"} 0
+		gpfs_fileset_inode_free_percent_bucket{fs="project",remote_cluster="",le="25"} 0
+		gpfs_fileset_inode_free_percent_bucket{fs="project",remote_cluster="",le="50"} 0
+		gpfs_fileset_inode_free_percent_bucket{fs="project",remote_cluster="",le="100"} 3
+		gpfs_fileset_inode_free_percent_bucket{fs="project",remote_cluster="",le="+Inf"} 3
+		gpfs_fileset_inode_free_percent_sum{fs="project",remote_cluster=""} 297.8406933939394
+		gpfs_fileset_inode_free_percent_count{fs="project",remote_cluster=""} 3
+		# HELP gpfs_fileset_low_inode_count GPFS number of filesets with a percentage of free inodes under threshold
+		# TYPE gpfs_fileset_low_inode_count gauge
+		gpfs_fileset_low_inode_count{fs="project",remote_cluster="",threshold="99.01"} 2
+		# HELP gpfs_inode_space_free_inodes GPFS inode space free inodes
+		# TYPE gpfs_inode_space_free_inodes gauge
+		gpfs_inode_space_free_inodes{fs="project",inode_space="0",owner_fileset="root",remote_cluster=""} 102045986
+		gpfs_inode_space_free_inodes{fs="project",inode_space="1",owner_fileset="ibtest",remote_cluster=""} 544397
+		gpfs_inode_space_free_inodes{fs="project",inode_space="164",owner_fileset="PAS1136",remote_cluster=""} 989069
+	`
+	collector := NewMmlsfilesetCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
+		"gpfs_fileset_count", "gpfs_fileset_free_inodes", "gpfs_fileset_inode_free_percent",
+		"gpfs_fileset_low_inode_count", "gpfs_inode_space_free_inodes"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestMmlsfilesetCollectorRemote(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	filesystems := "ess01:project"
+	filesetFilesystems = &filesystems
+	MmlsfilesetExec = func(fs string, ctx context.Context) (string, error) {
+		return strings.ReplaceAll(mmlsfilesetStdout, ":::project:", ":::ess01%3Aproject:"), nil
+	}
+	expected := `
+		# HELP gpfs_fileset_max_inodes GPFS fileset max inodes
+		# TYPE gpfs_fileset_max_inodes gauge
+		gpfs_fileset_max_inodes{fileset="PAS1136",fs="project",remote_cluster="ess01"} 1100000
+		gpfs_fileset_max_inodes{fileset="ibtest",fs="project",remote_cluster="ess01"} 1000000
+		gpfs_fileset_max_inodes{fileset="root",fs="project",remote_cluster="ess01"} 300000000
+	`
+	collector := NewMmlsfilesetCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
+		"gpfs_fileset_max_inodes"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestMmlsfilesetCollectorUnlimited(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	filesystems := "project"
+	filesetFilesystems = &filesystems
+	MmlsfilesetExec = func(fs string, ctx context.Context) (string, error) {
+		return strings.Replace(mmlsfilesetStdout, ":1:1:1000000:556032:", ":1:1:0:556032:", 1), nil
+	}
+	expected := `
+		# HELP gpfs_fileset_inodes_unlimited GPFS fileset has no max inodes limit, max inodes is 0
+		# TYPE gpfs_fileset_inodes_unlimited gauge
+		gpfs_fileset_inodes_unlimited{fileset="PAS1136",fs="project",remote_cluster=""} 0
+		gpfs_fileset_inodes_unlimited{fileset="ibtest",fs="project",remote_cluster=""} 1
+		gpfs_fileset_inodes_unlimited{fileset="root",fs="project",remote_cluster=""} 0
+		# HELP gpfs_fileset_max_inodes GPFS fileset max inodes
+		# TYPE gpfs_fileset_max_inodes gauge
+		gpfs_fileset_max_inodes{fileset="PAS1136",fs="project",remote_cluster=""} 1100000
+		gpfs_fileset_max_inodes{fileset="ibtest",fs="project",remote_cluster=""} 0
+		gpfs_fileset_max_inodes{fileset="root",fs="project",remote_cluster=""} 300000000
+	`
+	collector := NewMmlsfilesetCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
+		"gpfs_fileset_inodes_unlimited", "gpfs_fileset_max_inodes"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestMmlsfilesetCollectorAFM(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.mmlsfileset.afm"}); err != nil {
+		t.Fatal(err)
+	}
+	filesystems := "project"
+	filesetFilesystems = &filesystems
+	MmlsfilesetExec = func(fs string, ctx context.Context) (string, error) {
+		return mmlsfilesetStdoutAFM, nil
+	}
+	expected := `
+		# HELP gpfs_fileset_afm_needs_recovery GPFS AFM fileset needs recovery
+		# TYPE gpfs_fileset_afm_needs_recovery gauge
+		gpfs_fileset_afm_needs_recovery{fileset="cache1",fs="project",remote_cluster=""} 0
+		gpfs_fileset_afm_needs_recovery{fileset="cache2",fs="project",remote_cluster=""} 1
+		# HELP gpfs_fileset_afm_state_info GPFS AFM fileset state
+		# TYPE gpfs_fileset_afm_state_info gauge
+		gpfs_fileset_afm_state_info{fileset="cache1",fs="project",mode="sw",remote_cluster="",state="Active"} 1
+		gpfs_fileset_afm_state_info{fileset="cache2",fs="project",mode="iw",remote_cluster="",state="NeedsRecovery"} 1
+	`
+	collector := NewMmlsfilesetCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 52 {
+		t.Errorf("Unexpected collection count %d, expected 52", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
+		"gpfs_fileset_afm_state_info", "gpfs_fileset_afm_needs_recovery"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestMmlsfilesetCollectorGetSize(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.mmlsfileset.get-size"}); err != nil {
+		t.Fatal(err)
+	}
+	filesystems := "project"
+	filesetFilesystems = &filesystems
+	MmlsfilesetExec = func(fs string, ctx context.Context) (string, error) {
+		return mmlsfilesetStdoutSize, nil
+	}
+	expected := `
+		# HELP gpfs_fileset_data_size_bytes GPFS fileset data size in bytes
+		# TYPE gpfs_fileset_data_size_bytes gauge
+		gpfs_fileset_data_size_bytes{fileset="ibtest",fs="project",remote_cluster=""} 1048576
+		gpfs_fileset_data_size_bytes{fileset="root",fs="project",remote_cluster=""} 5368709120
+		# HELP gpfs_fileset_used_inodes GPFS fileset used inodes
+		# TYPE gpfs_fileset_used_inodes gauge
+		gpfs_fileset_used_inodes{fileset="ibtest",fs="project",remote_cluster=""} 11635
+		gpfs_fileset_used_inodes{fileset="root",fs="project",remote_cluster=""} 6238
+	`
+	collector := NewMmlsfilesetCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 52 {
+		t.Errorf("Unexpected collection count %d, expected 52", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
+		"gpfs_fileset_data_size_bytes", "gpfs_fileset_used_inodes"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestMmlsfilesetCollectorInodeSpace(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	filesystems := "project"
+	filesetFilesystems = &filesystems
+	MmlsfilesetExec = func(fs string, ctx context.Context) (string, error) {
+		return mmlsfilesetStdoutInodeSpace, nil
+	}
+	expected := `
+		# HELP gpfs_inode_space_allocated_inodes GPFS inode space allocated inodes
+		# TYPE gpfs_inode_space_allocated_inodes gauge
+		gpfs_inode_space_allocated_inodes{fs="project",inode_space="0",owner_fileset="root",remote_cluster=""} 102052224
+		gpfs_inode_space_allocated_inodes{fs="project",inode_space="164",owner_fileset="PAS1136",remote_cluster=""} 1000000
+		# HELP gpfs_inode_space_free_inodes GPFS inode space free inodes
+		# TYPE gpfs_inode_space_free_inodes gauge
+		gpfs_inode_space_free_inodes{fs="project",inode_space="0",owner_fileset="root",remote_cluster=""} 102045986
+		gpfs_inode_space_free_inodes{fs="project",inode_space="164",owner_fileset="PAS1136",remote_cluster=""} 10
+		# HELP gpfs_inode_space_max_inodes GPFS inode space max inodes
+		# TYPE gpfs_inode_space_max_inodes gauge
+		gpfs_inode_space_max_inodes{fs="project",inode_space="0",owner_fileset="root",remote_cluster=""} 300000000
+		gpfs_inode_space_max_inodes{fs="project",inode_space="164",owner_fileset="PAS1136",remote_cluster=""} 1000000
+	`
+	collector := NewMmlsfilesetCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 59 {
+		t.Errorf("Unexpected collection count %d, expected 59", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
+		"gpfs_inode_space_max_inodes", "gpfs_inode_space_allocated_inodes", "gpfs_inode_space_free_inodes"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
 func TestMmlsfilesetCollectorMmlsfs(t *testing.T) {
 	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
 		t.Fatal(err)
@@ -208,41 +613,41 @@ mmlsfs::0:1:::project:defaultMountPoint:%2Ffs%project::
 	expected := `
 		# HELP gpfs_fileset_alloc_inodes GPFS fileset alloc inodes
 		# TYPE gpfs_fileset_alloc_inodes gauge
-		gpfs_fileset_alloc_inodes{fileset="PAS1136",fs="project"} 1000000
-		gpfs_fileset_alloc_inodes{fileset="ibtest",fs="project"} 556032
-		gpfs_fileset_alloc_inodes{fileset="root",fs="project"} 102052224
+		gpfs_fileset_alloc_inodes{fileset="PAS1136",fs="project",remote_cluster=""} 1000000
+		gpfs_fileset_alloc_inodes{fileset="ibtest",fs="project",remote_cluster=""} 556032
+		gpfs_fileset_alloc_inodes{fileset="root",fs="project",remote_cluster=""} 102052224
 		# HELP gpfs_fileset_created_timestamp_seconds GPFS fileset creation timestamp
 		# TYPE gpfs_fileset_created_timestamp_seconds gauge
-		gpfs_fileset_created_timestamp_seconds{fileset="PAS1136",fs="project"} 1511378966
-		gpfs_fileset_created_timestamp_seconds{fileset="ibtest",fs="project"} 1467115726
-		gpfs_fileset_created_timestamp_seconds{fileset="root",fs="project"} 1463586095
+		gpfs_fileset_created_timestamp_seconds{fileset="PAS1136",fs="project",remote_cluster=""} 1511378966
+		gpfs_fileset_created_timestamp_seconds{fileset="ibtest",fs="project",remote_cluster=""} 1467115726
+		gpfs_fileset_created_timestamp_seconds{fileset="root",fs="project",remote_cluster=""} 1463586095
 		# HELP gpfs_fileset_free_inodes GPFS fileset free inodes
 		# TYPE gpfs_fileset_free_inodes gauge
-		gpfs_fileset_free_inodes{fileset="PAS1136",fs="project"} 989069
-		gpfs_fileset_free_inodes{fileset="ibtest",fs="project"} 544397
-		gpfs_fileset_free_inodes{fileset="root",fs="project"} 102045986
+		gpfs_fileset_free_inodes{fileset="PAS1136",fs="project",remote_cluster=""} 989069
+		gpfs_fileset_free_inodes{fileset="ibtest",fs="project",remote_cluster=""} 544397
+		gpfs_fileset_free_inodes{fileset="root",fs="project",remote_cluster=""} 102045986
 		# HELP gpfs_fileset_max_inodes GPFS fileset max inodes
 		# TYPE gpfs_fileset_max_inodes gauge
-		gpfs_fileset_max_inodes{fileset="PAS1136",fs="project"} 1100000
-		gpfs_fileset_max_inodes{fileset="ibtest",fs="project"} 1000000
-		gpfs_fileset_max_inodes{fileset="root",fs="project"} 300000000
+		gpfs_fileset_max_inodes{fileset="PAS1136",fs="project",remote_cluster=""} 1100000
+		gpfs_fileset_max_inodes{fileset="ibtest",fs="project",remote_cluster=""} 1000000
+		gpfs_fileset_max_inodes{fileset="root",fs="project",remote_cluster=""} 300000000
 		# HELP gpfs_fileset_path_info GPFS fileset path
 		# TYPE gpfs_fileset_path_info gauge
-		gpfs_fileset_path_info{fileset="PAS1136",fs="project",path="--"} 1
-		gpfs_fileset_path_info{fileset="ibtest",fs="project",path="/fs/project/ibtest"} 1
-		gpfs_fileset_path_info{fileset="root",fs="project",path="/fs/project"} 1
+		gpfs_fileset_path_info{fileset="PAS1136",fs="project",path="--",remote_cluster=""} 1
+		gpfs_fileset_path_info{fileset="ibtest",fs="project",path="/fs/project/ibtest",remote_cluster=""} 1
+		gpfs_fileset_path_info{fileset="root",fs="project",path="/fs/project",remote_cluster=""} 1
 		# HELP gpfs_fileset_status_info GPFS fileset status
 		# TYPE gpfs_fileset_status_info gauge
-		gpfs_fileset_status_info{fileset="PAS1136",fs="project",status="Unlinked"} 1
-		gpfs_fileset_status_info{fileset="ibtest",fs="project",status="Linked"} 1
-		gpfs_fileset_status_info{fileset="root",fs="project",status="Linked"} 1
+		gpfs_fileset_status_info{fileset="PAS1136",fs="project",remote_cluster="",status="Unlinked"} 1
+		gpfs_fileset_status_info{fileset="ibtest",fs="project",remote_cluster="",status="Linked"} 1
+		gpfs_fileset_status_info{fileset="root",fs="project",remote_cluster="",status="Linked"} 1
 	`
 	collector := NewMmlsfilesetCollector(log.NewNopLogger())
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
-	} else if val != 21 {
-		t.Errorf("Unexpected collection count %d, expected 21", val)
+	} else if val != 48 {
+		t.Errorf("Unexpected collection count %d, expected 48", val)
 	}
 	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
 		"gpfs_fileset_created_timestamp_seconds", "gpfs_fileset_status_info", "gpfs_fileset_path_info",
@@ -269,8 +674,8 @@ func TestMmlsfilesetCollectorError(t *testing.T) {
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
-	} else if val != 3 {
-		t.Errorf("Unexpected collection count %d, expected 3", val)
+	} else if val != 15 {
+		t.Errorf("Unexpected collection count %d, expected 15", val)
 	}
 	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collect_error"); err != nil {
 		t.Errorf("unexpected collecting result:\n%s", err)
@@ -295,8 +700,8 @@ func TestMmlsfilesetCollectorTimeout(t *testing.T) {
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
-	} else if val != 3 {
-		t.Errorf("Unexpected collection count %d, expected 3", val)
+	} else if val != 15 {
+		t.Errorf("Unexpected collection count %d, expected 15", val)
 	}
 	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collect_timeout"); err != nil {
 		t.Errorf("unexpected collecting result:\n%s", err)
@@ -321,8 +726,8 @@ func TestMmlsfilesetCollectorMmlsfsError(t *testing.T) {
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
-	} else if val != 2 {
-		t.Errorf("Unexpected collection count %d, expected 2", val)
+	} else if val != 9 {
+		t.Errorf("Unexpected collection count %d, expected 9", val)
 	}
 	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collect_error"); err != nil {
 		t.Errorf("unexpected collecting result:\n%s", err)
@@ -347,10 +752,27 @@ func TestMmlsfilesetCollectorMmlsfsTimeout(t *testing.T) {
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
-	} else if val != 2 {
-		t.Errorf("Unexpected collection count %d, expected 2", val)
+	} else if val != 9 {
+		t.Errorf("Unexpected collection count %d, expected 9", val)
 	}
 	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collect_timeout"); err != nil {
 		t.Errorf("unexpected collecting result:\n%s", err)
 	}
 }
+
+func TestParseMmlsfilesetInsertedColumn(t *testing.T) {
+	expected, err := parse_mmlsfileset(mmlsfilesetStdout, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expected) == 0 {
+		t.Fatal("Expected metrics to be parsed")
+	}
+	got, err := parse_mmlsfileset(insertColumn(mmlsfilesetStdout, 7), log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Unexpected metrics with inserted column\nGot: %v\nExpected: %v", got, expected)
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	mmlsfsCollectorTimeout = kingpin.Flag("collector.mmlsfs.timeout", "Timeout for executing mmlsfs").Default("5").Int()
+	mmlsfsAttributes       = kingpin.Flag("collector.mmlsfs.attributes", "Regex of mmlsfs attribute names to expose as gpfs_fs_attr_info").Default("^$").String()
+	mmlsfsQuotaTypes       = []string{"user", "group", "fileset"}
+	MmlsfsAllExec          = mmlsfsAll
+)
+
+type FilesystemAttrMetric struct {
+	FS    string
+	Attrs map[string]string
+}
+
+type MmlsfsCollector struct {
+	BlockSize     *prometheus.Desc
+	Version       *prometheus.Desc
+	QuotasEnabled *prometheus.Desc
+	DMAPIEnabled  *prometheus.Desc
+	AttrInfo      *prometheus.Desc
+	logger        log.Logger
+}
+
+func init() {
+	registerCollector("mmlsfs", false, NewMmlsfsCollector)
+}
+
+func NewMmlsfsCollector(logger log.Logger) Collector {
+	return &MmlsfsCollector{
+		BlockSize: newDesc(prometheus.BuildFQName(namespace, "fs", "block_size_bytes"),
+			"GPFS filesystem block size in bytes", []string{"fs"}, nil),
+		Version: newDesc(prometheus.BuildFQName(namespace, "fs", "filesystem_version_info"),
+			"GPFS filesystem version", []string{"fs", "version"}, nil),
+		QuotasEnabled: newDesc(prometheus.BuildFQName(namespace, "fs", "quotas_enabled"),
+			"GPFS filesystem quota enforcement enabled", []string{"fs", "type"}, nil),
+		DMAPIEnabled: newDesc(prometheus.BuildFQName(namespace, "fs", "dmapi_enabled"),
+			"GPFS filesystem DMAPI enabled", []string{"fs"}, nil),
+		AttrInfo: newDesc(prometheus.BuildFQName(namespace, "fs", "attr_info"),
+			"GPFS filesystem attribute", []string{"fs", "name", "value"}, nil),
+		logger: logger,
+	}
+}
+
+func (c *MmlsfsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.BlockSize
+	ch <- c.Version
+	ch <- c.QuotasEnabled
+	ch <- c.DMAPIEnabled
+	ch <- c.AttrInfo
+}
+
+func (c *MmlsfsCollector) Collect(ch chan<- prometheus.Metric) {
+	level.Debug(c.logger).Log("msg", "Collecting mmlsfs metrics")
+	collectTime := time.Now()
+	metrics, err := c.collect()
+	if err == context.DeadlineExceeded {
+		level.Error(c.logger).Log("msg", "Timeout executing mmlsfs")
+	} else if err != nil {
+		level.Error(c.logger).Log("msg", err)
+	}
+	attributes := regexp.MustCompile(*mmlsfsAttributes)
+	for _, m := range metrics {
+		if blockSize, ok := m.Attrs["blockSize"]; ok {
+			if val, err := ParseFloat(blockSize, false, c.logger); err == nil {
+				ch <- prometheus.MustNewConstMetric(c.BlockSize, prometheus.GaugeValue, val, m.FS)
+			}
+		}
+		if version, ok := m.Attrs["filesystemVersion"]; ok {
+			ch <- prometheus.MustNewConstMetric(c.Version, prometheus.GaugeValue, 1, m.FS, version)
+		}
+		if quotas, ok := m.Attrs["quotasEnforced"]; ok {
+			enforced := strings.FieldsFunc(quotas, func(r rune) bool {
+				return r == ';' || r == ',' || r == ' '
+			})
+			for _, t := range mmlsfsQuotaTypes {
+				var value float64
+				if SliceContains(enforced, t) {
+					value = 1
+				}
+				ch <- prometheus.MustNewConstMetric(c.QuotasEnabled, prometheus.GaugeValue, value, m.FS, t)
+			}
+		}
+		if dmapi, ok := m.Attrs["DMAPIEnabled"]; ok {
+			var value float64
+			if strings.ToLower(dmapi) == "yes" {
+				value = 1
+			}
+			ch <- prometheus.MustNewConstMetric(c.DMAPIEnabled, prometheus.GaugeValue, value, m.FS)
+		}
+		for name, value := range m.Attrs {
+			if attributes.MatchString(name) {
+				ch <- prometheus.MustNewConstMetric(c.AttrInfo, prometheus.GaugeValue, 1, m.FS, name, value)
+			}
+		}
+	}
+	emitCollectorStatus(ch, "mmlsfs", err, collectTime, len(metrics))
+}
+
+func (c *MmlsfsCollector) collect() ([]FilesystemAttrMetric, error) {
+	ctx, cancel := commandContext("mmlsfs", *mmlsfsCollectorTimeout)
+	defer cancel()
+	out, err := execRetry(ctx, "mmlsfs", func() (string, error) {
+		return MmlsfsAllExec(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	commandDump.record("mmlsfs-all", out)
+	metrics := parse_mmlsfs_attrs(out, c.logger)
+	commandDump.recordParsed("mmlsfs-all", metrics)
+	return metrics, nil
+}
+
+func mmlsfsAll(ctx context.Context) (string, error) {
+	return RunMMCommand(ctx, "mmlsfs", "all", "-Y")
+}
+
+func parse_mmlsfs_attrs(out string, logger log.Logger) []FilesystemAttrMetric {
+	var metrics []FilesystemAttrMetric
+	index := make(map[string]int)
+	var headers []string
+	lines := strings.Split(out, "\n")
+	for _, l := range lines {
+		if !strings.HasPrefix(l, "mmlsfs") {
+			continue
+		}
+		items := strings.Split(l, ":")
+		if len(items) < 3 {
+			continue
+		}
+		if items[2] == "HEADER" {
+			headers = items
+			continue
+		}
+		fsIndex := SliceIndex(headers, "deviceName")
+		nameIndex := SliceIndex(headers, "fieldName")
+		dataIndex := SliceIndex(headers, "data")
+		if fsIndex == -1 || nameIndex == -1 || dataIndex == -1 || dataIndex >= len(items) {
+			continue
+		}
+		fs := DecodeGPFSString(items[fsIndex])
+		value := DecodeGPFSString(items[dataIndex])
+		i, ok := index[fs]
+		if !ok {
+			i = len(metrics)
+			index[fs] = i
+			metrics = append(metrics, FilesystemAttrMetric{FS: fs, Attrs: make(map[string]string)})
+		}
+		metrics[i].Attrs[items[nameIndex]] = value
+	}
+	return metrics
+}
@@ -0,0 +1,177 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var (
+	mmlsfsAllStdout = `
+mmlsfs::HEADER:version:reserved:reserved:deviceName:fieldName:data:remarks:
+mmlsfs::0:1:::project:minFragmentSize:8192::
+mmlsfs::0:1:::project:blockSize:4194304::
+mmlsfs::0:1:::project:quotasAccountingEnabled:user%3Bgroup%3Bfileset::
+mmlsfs::0:1:::project:quotasEnforced:user%3Bgroup%3Bfileset::
+mmlsfs::0:1:::project:filesystemVersion:27.00 (5.1.3.0)::
+mmlsfs::0:1:::project:DMAPIEnabled:no::
+mmlsfs::0:1:::project:defaultMountPoint:%2Ffs%2Fproject::
+mmlsfs::0:1:::scratch:blockSize:16777216::
+mmlsfs::0:1:::scratch:quotasEnforced:fileset::
+mmlsfs::0:1:::scratch:filesystemVersion:23.00 (5.0.5.0)::
+mmlsfs::0:1:::scratch:DMAPIEnabled:yes::
+mmlsfs::0:1:::scratch:defaultMountPoint:%2Ffs%2Fscratch::
+`
+)
+
+func TestMmlsfsAll(t *testing.T) {
+	execCommand = fakeExecCommand
+	mockedExitStatus = 0
+	mockedStdout = "foo"
+	defer func() { execCommand = exec.CommandContext }()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out, err := mmlsfsAll(ctx)
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+	if out != mockedStdout {
+		t.Errorf("Unexpected out: %s", out)
+	}
+}
+
+func TestParseMmlsfsAttrs(t *testing.T) {
+	metrics := parse_mmlsfs_attrs(mmlsfsAllStdout, log.NewNopLogger())
+	if len(metrics) != 2 {
+		t.Fatalf("Unexpected number of filesystems, got %d", len(metrics))
+	}
+	expected := FilesystemAttrMetric{FS: "scratch", Attrs: map[string]string{
+		"blockSize":         "16777216",
+		"quotasEnforced":    "fileset",
+		"filesystemVersion": "23.00 (5.0.5.0)",
+		"DMAPIEnabled":      "yes",
+		"defaultMountPoint": "/fs/scratch",
+	}}
+	if !reflect.DeepEqual(metrics[1], expected) {
+		t.Errorf("Unexpected metrics\nGot: %v\nExpected: %v", metrics[1], expected)
+	}
+	if val := metrics[0].Attrs["quotasAccountingEnabled"]; val != "user;group;fileset" {
+		t.Errorf("Unexpected quotasAccountingEnabled, got %s", val)
+	}
+}
+
+func TestMmlsfsCollector(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.mmlsfs.attributes=^defaultMountPoint$"}); err != nil {
+		t.Fatal(err)
+	}
+	MmlsfsAllExec = func(ctx context.Context) (string, error) {
+		return mmlsfsAllStdout, nil
+	}
+	expected := `
+		# HELP gpfs_fs_attr_info GPFS filesystem attribute
+		# TYPE gpfs_fs_attr_info gauge
+		gpfs_fs_attr_info{fs="project",name="defaultMountPoint",value="/fs/project"} 1
+		gpfs_fs_attr_info{fs="scratch",name="defaultMountPoint",value="/fs/scratch"} 1
+		# HELP gpfs_fs_block_size_bytes GPFS filesystem block size in bytes
+		# TYPE gpfs_fs_block_size_bytes gauge
+		gpfs_fs_block_size_bytes{fs="project"} 4194304
+		gpfs_fs_block_size_bytes{fs="scratch"} 16777216
+		# HELP gpfs_fs_dmapi_enabled GPFS filesystem DMAPI enabled
+		# TYPE gpfs_fs_dmapi_enabled gauge
+		gpfs_fs_dmapi_enabled{fs="project"} 0
+		gpfs_fs_dmapi_enabled{fs="scratch"} 1
+		# HELP gpfs_fs_filesystem_version_info GPFS filesystem version
+		# TYPE gpfs_fs_filesystem_version_info gauge
+		gpfs_fs_filesystem_version_info{fs="project",version="27.00 (5.1.3.0)"} 1
+		gpfs_fs_filesystem_version_info{fs="scratch",version="23.00 (5.0.5.0)"} 1
+		# HELP gpfs_fs_quotas_enabled GPFS filesystem quota enforcement enabled
+		# TYPE gpfs_fs_quotas_enabled gauge
+		gpfs_fs_quotas_enabled{fs="project",type="fileset"} 1
+		gpfs_fs_quotas_enabled{fs="project",type="group"} 1
+		gpfs_fs_quotas_enabled{fs="project",type="user"} 1
+		gpfs_fs_quotas_enabled{fs="scratch",type="fileset"} 1
+		gpfs_fs_quotas_enabled{fs="scratch",type="group"} 0
+		gpfs_fs_quotas_enabled{fs="scratch",type="user"} 0
+	`
+	collector := NewMmlsfsCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 26 {
+		t.Errorf("Unexpected collection count %d, expected 26", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
+		"gpfs_fs_attr_info", "gpfs_fs_block_size_bytes", "gpfs_fs_dmapi_enabled",
+		"gpfs_fs_filesystem_version_info", "gpfs_fs_quotas_enabled"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestMmlsfsCollectorError(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	MmlsfsAllExec = func(ctx context.Context) (string, error) {
+		return "", fmt.Errorf("Error")
+	}
+	expected := `
+		# HELP gpfs_exporter_collect_error Indicates if error has occurred during collection
+		# TYPE gpfs_exporter_collect_error gauge
+		gpfs_exporter_collect_error{collector="mmlsfs"} 1
+	`
+	collector := NewMmlsfsCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 12 {
+		t.Errorf("Unexpected collection count %d, expected 12", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collect_error"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestMmlsfsCollectorTimeout(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	MmlsfsAllExec = func(ctx context.Context) (string, error) {
+		return "", context.DeadlineExceeded
+	}
+	expected := `
+		# HELP gpfs_exporter_collect_timeout Indicates the collector timed out
+		# TYPE gpfs_exporter_collect_timeout gauge
+		gpfs_exporter_collect_timeout{collector="mmlsfs"} 1
+	`
+	collector := NewMmlsfsCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 12 {
+		t.Errorf("Unexpected collection count %d, expected 12", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collect_timeout"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
@@ -0,0 +1,260 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"context"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	mmlsmgrTimeout   = kingpin.Flag("collector.mmlsmgr.timeout", "Timeout for mmlsmgr execution").Default("5").Int()
+	mmlsmgrTTL       = kingpin.Flag("collector.mmlsmgr.cache-ttl", "How long managers listed by mmlsmgr are cached for the mmlsmgr collector and run-if flags").Default("60s").Duration()
+	mmlsmgrCache     = &MmlsmgrCache{}
+	collectorSkipped = newDesc(
+		prometheus.BuildFQName(namespace, "exporter", "collector_skipped"),
+		"Indicates the collector was skipped on this node",
+		[]string{"collector", "reason"}, nil)
+	MmlsmgrExec    = mmlsmgr
+	localNodeNames = localNames
+)
+
+// Managers are the cluster manager and filesystem manager nodes listed by mmlsmgr.
+// ClusterManager and FSManagers hold every name and address of the nodes for run-if checks
+// while ClusterManagerNode and Filesystems hold the node reported for each role, none when
+// the role is not assigned such as during failover.
+type Managers struct {
+	ClusterManager     []string
+	FSManagers         []string
+	ClusterManagerNode string
+	Filesystems        []FSManager
+}
+
+type FSManager struct {
+	FS   string
+	Node string
+}
+
+type MmlsmgrCollector struct {
+	ClusterManager *prometheus.Desc
+	Manager        *prometheus.Desc
+	logger         log.Logger
+}
+
+func init() {
+	registerCollector("mmlsmgr", true, NewMmlsmgrCollector)
+}
+
+func NewMmlsmgrCollector(logger log.Logger) Collector {
+	return &MmlsmgrCollector{
+		ClusterManager: newDesc(prometheus.BuildFQName(namespace, "cluster_manager", "info"),
+			"GPFS node that is the cluster manager", []string{"node"}, nil),
+		Manager: newDesc(prometheus.BuildFQName(namespace, "manager", "info"),
+			"GPFS node that is the filesystem manager", []string{"fs", "node"}, nil),
+		logger: logger,
+	}
+}
+
+func (c *MmlsmgrCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.ClusterManager
+	ch <- c.Manager
+}
+
+func (c *MmlsmgrCollector) Collect(ch chan<- prometheus.Metric) {
+	level.Debug(c.logger).Log("msg", "Collecting mmlsmgr metrics")
+	collectTime := time.Now()
+	managers, err := c.collect()
+	if err == context.DeadlineExceeded {
+		level.Error(c.logger).Log("msg", "Timeout executing mmlsmgr")
+	} else if err != nil {
+		level.Error(c.logger).Log("msg", err)
+	}
+	records := 0
+	if err == nil {
+		if managers.ClusterManagerNode != "" {
+			ch <- prometheus.MustNewConstMetric(c.ClusterManager, prometheus.GaugeValue, 1, managers.ClusterManagerNode)
+			records++
+		}
+		for _, m := range managers.Filesystems {
+			ch <- prometheus.MustNewConstMetric(c.Manager, prometheus.GaugeValue, 1, m.FS, m.Node)
+			records++
+		}
+	}
+	emitCollectorStatus(ch, "mmlsmgr", err, collectTime, records)
+}
+
+func (c *MmlsmgrCollector) collect() (Managers, error) {
+	ctx, cancel := commandContext("mmlsmgr", *mmlsmgrTimeout)
+	defer cancel()
+	return mmlsmgrCache.get(ctx, c.logger)
+}
+
+// MmlsmgrCache shares the managers listed by mmlsmgr between collectors
+type MmlsmgrCache struct {
+	sync.Mutex
+	managers Managers
+	err      error
+	updated  time.Time
+}
+
+func (c *MmlsmgrCache) get(ctx context.Context, logger log.Logger) (Managers, error) {
+	c.Lock()
+	defer c.Unlock()
+	if c.err == nil && !c.updated.IsZero() && time.Since(c.updated) < *mmlsmgrTTL {
+		level.Debug(logger).Log("msg", "Using cached mmlsmgr managers")
+		return c.managers, nil
+	}
+	out, err := MmlsmgrExec(ctx)
+	err = commandKilledTimeout("mmlsmgr", err)
+	c.updated = time.Now()
+	if err != nil {
+		c.managers, c.err = Managers{}, err
+		return c.managers, err
+	}
+	commandDump.record("mmlsmgr", out)
+	c.managers, c.err = parse_mmlsmgr(out), nil
+	commandDump.recordParsed("mmlsmgr", c.managers)
+	return c.managers, nil
+}
+
+func runIfFlag(collector string) *string {
+	return kingpin.Flag(
+		"collector."+collector+".run-if",
+		"Only collect when this node is the cluster manager with cluster-manager or a filesystem manager with manager").
+		Default("always").Enum("always", "cluster-manager", "manager")
+}
+
+// checkRunIf returns true if the collector should run on this node based on its run-if flag
+func checkRunIf(collector string, runIf string, ch chan<- prometheus.Metric, logger log.Logger) (bool, error) {
+	if runIf == "always" {
+		return true, nil
+	}
+	ctx, cancel := commandContext(collector, *mmlsmgrTimeout)
+	defer cancel()
+	managers, err := mmlsmgrCache.get(ctx, logger)
+	if err != nil {
+		return false, err
+	}
+	nodes := managers.FSManagers
+	if runIf == "cluster-manager" {
+		nodes = managers.ClusterManager
+	}
+	local := localNodeNames()
+	run := false
+	for _, node := range nodes {
+		if SliceContains(local, node) {
+			run = true
+			break
+		}
+	}
+	var skipped float64
+	if !run {
+		level.Debug(logger).Log("msg", "Skipping collector as node is not a manager", "collector", collector, "run-if", runIf)
+		skipped = 1
+	}
+	ch <- prometheus.MustNewConstMetric(collectorSkipped, prometheus.GaugeValue, skipped, collector, "not-manager")
+	return run, nil
+}
+
+func mmlsmgr(ctx context.Context) (string, error) {
+	return RunMMCommand(ctx, "mmlsmgr", "-Y")
+}
+
+// localNames returns the hostnames and IP addresses of this node
+func localNames() []string {
+	var names []string
+	if hostname, err := os.Hostname(); err == nil {
+		names = append(names, hostname, strings.Split(hostname, ".")[0])
+	}
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok {
+				names = append(names, ipnet.IP.String())
+			}
+		}
+	}
+	return names
+}
+
+func parse_mmlsmgr(out string) Managers {
+	var managers Managers
+	headers := make(map[string][]string)
+	lines := strings.Split(out, "\n")
+	for _, l := range lines {
+		if !strings.HasPrefix(l, "mmlsmgr") {
+			continue
+		}
+		items := strings.Split(l, ":")
+		if len(items) < 7 {
+			continue
+		}
+		if items[2] == "HEADER" {
+			headers[items[1]] = items
+			continue
+		}
+		var values []string
+		var fs, name, address string
+		for i, h := range headers[items[1]] {
+			if i >= len(items) || mmlsmgrNone(items[i]) {
+				continue
+			}
+			header := strings.ToLower(h)
+			switch {
+			case header == "fsname":
+				fs = DecodeGPFSString(items[i])
+			case strings.Contains(header, "node"):
+				name = items[i]
+				values = append(values, items[i])
+			case strings.Contains(header, "ip"):
+				address = items[i]
+				values = append(values, items[i])
+			}
+		}
+		node := name
+		if node == "" {
+			node = address
+		}
+		if node == "" {
+			node = "none"
+		}
+		if items[1] == "clusterManager" {
+			managers.ClusterManager = append(managers.ClusterManager, values...)
+			managers.ClusterManagerNode = node
+		} else {
+			managers.FSManagers = append(managers.FSManagers, values...)
+			if fs != "" {
+				managers.Filesystems = append(managers.Filesystems, FSManager{FS: fs, Node: node})
+			}
+		}
+	}
+	return managers
+}
+
+// mmlsmgrNone returns true for values mmlsmgr reports when a manager is not assigned
+func mmlsmgrNone(value string) bool {
+	switch strings.ToLower(value) {
+	case "", "-", "none", "(none)":
+		return true
+	}
+	return false
+}
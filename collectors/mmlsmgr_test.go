@@ -0,0 +1,232 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var (
+	mmlsmgrStdout = `
+mmlsmgr:fsManager:HEADER:version:reserved:reserved:fsName:managerIPaddress:managerNodeName:
+mmlsmgr:clusterManager:HEADER:version:reserved:reserved:clusterManagerIPaddress:clusterManagerNodeName:remarks:
+mmlsmgr:fsManager:0:1:::project:10.22.0.11:ess01-ib:
+mmlsmgr:fsManager:0:1:::scratch:10.22.0.12:ess02-ib:
+mmlsmgr:clusterManager:0:1:::10.22.0.13:ess03-ib:quorum node:
+`
+	mmlsmgrStdoutNone = `
+mmlsmgr:fsManager:HEADER:version:reserved:reserved:fsName:managerIPaddress:managerNodeName:
+mmlsmgr:clusterManager:HEADER:version:reserved:reserved:clusterManagerIPaddress:clusterManagerNodeName:remarks:
+mmlsmgr:fsManager:0:1:::project:10.22.0.11:ess01-ib:
+mmlsmgr:fsManager:0:1:::scratch::(none):
+mmlsmgr:clusterManager:0:1:::10.22.0.13:ess03-ib:quorum node:
+`
+)
+
+func TestMmlsmgr(t *testing.T) {
+	execCommand = fakeExecCommand
+	mockedExitStatus = 0
+	mockedStdout = "foo"
+	defer func() { execCommand = exec.CommandContext }()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out, err := mmlsmgr(ctx)
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+	if out != mockedStdout {
+		t.Errorf("Unexpected out: %s", out)
+	}
+}
+
+func TestParseMmlsmgr(t *testing.T) {
+	managers := parse_mmlsmgr(mmlsmgrStdout)
+	expected := Managers{
+		ClusterManager:     []string{"10.22.0.13", "ess03-ib"},
+		FSManagers:         []string{"10.22.0.11", "ess01-ib", "10.22.0.12", "ess02-ib"},
+		ClusterManagerNode: "ess03-ib",
+		Filesystems:        []FSManager{{FS: "project", Node: "ess01-ib"}, {FS: "scratch", Node: "ess02-ib"}},
+	}
+	if !reflect.DeepEqual(managers, expected) {
+		t.Errorf("Unexpected managers\nGot: %v\nExpected: %v", managers, expected)
+	}
+	managers = parse_mmlsmgr(mmlsmgrStdoutNone)
+	expected = Managers{
+		ClusterManager:     []string{"10.22.0.13", "ess03-ib"},
+		FSManagers:         []string{"10.22.0.11", "ess01-ib"},
+		ClusterManagerNode: "ess03-ib",
+		Filesystems:        []FSManager{{FS: "project", Node: "ess01-ib"}, {FS: "scratch", Node: "none"}},
+	}
+	if !reflect.DeepEqual(managers, expected) {
+		t.Errorf("Unexpected managers\nGot: %v\nExpected: %v", managers, expected)
+	}
+}
+
+func TestMmlsmgrCollector(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.mmlsmgr.cache-ttl=0s"}); err != nil {
+		t.Fatal(err)
+	}
+	MmlsmgrExec = func(ctx context.Context) (string, error) {
+		return mmlsmgrStdoutNone, nil
+	}
+	expected := `
+		# HELP gpfs_cluster_manager_info GPFS node that is the cluster manager
+		# TYPE gpfs_cluster_manager_info gauge
+		gpfs_cluster_manager_info{node="ess03-ib"} 1
+		# HELP gpfs_manager_info GPFS node that is the filesystem manager
+		# TYPE gpfs_manager_info gauge
+		gpfs_manager_info{fs="project",node="ess01-ib"} 1
+		gpfs_manager_info{fs="scratch",node="none"} 1
+	`
+	collector := NewMmlsmgrCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 15 {
+		t.Errorf("Unexpected collection count %d, expected 15", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
+		"gpfs_cluster_manager_info", "gpfs_manager_info"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestMmlsmgrCollectorError(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.mmlsmgr.cache-ttl=0s"}); err != nil {
+		t.Fatal(err)
+	}
+	MmlsmgrExec = func(ctx context.Context) (string, error) {
+		return "", fmt.Errorf("Error")
+	}
+	expected := `
+		# HELP gpfs_exporter_collect_error Indicates if error has occurred during collection
+		# TYPE gpfs_exporter_collect_error gauge
+		gpfs_exporter_collect_error{collector="mmlsmgr"} 1
+	`
+	collector := NewMmlsmgrCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 12 {
+		t.Errorf("Unexpected collection count %d, expected 12", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collect_error"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestMmlsmgrCollectorTimeout(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.mmlsmgr.cache-ttl=0s"}); err != nil {
+		t.Fatal(err)
+	}
+	MmlsmgrExec = func(ctx context.Context) (string, error) {
+		return "", context.DeadlineExceeded
+	}
+	expected := `
+		# HELP gpfs_exporter_collect_timeout Indicates the collector timed out
+		# TYPE gpfs_exporter_collect_timeout gauge
+		gpfs_exporter_collect_timeout{collector="mmlsmgr"} 1
+	`
+	collector := NewMmlsmgrCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 12 {
+		t.Errorf("Unexpected collection count %d, expected 12", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collect_timeout"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestMmrepquotaCollectorRunIf(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.mmrepquota.run-if=cluster-manager", "--collector.mmlsmgr.cache-ttl=0s"}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { localNodeNames = localNames }()
+	MmlsmgrExec = func(ctx context.Context) (string, error) {
+		return mmlsmgrStdout, nil
+	}
+	mmrepquotaExec = func(ctx context.Context, typeArg string) (string, error) {
+		return mmrepquotaStdout, nil
+	}
+	localNodeNames = func() []string {
+		return []string{"ess01", "10.22.0.11"}
+	}
+	expected := `
+		# HELP gpfs_exporter_collector_skipped Indicates the collector was skipped on this node
+		# TYPE gpfs_exporter_collector_skipped gauge
+		gpfs_exporter_collector_skipped{collector="mmrepquota",reason="not-manager"} 1
+	`
+	collector := NewMmrepquotaCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 1 {
+		t.Errorf("Unexpected collection count %d, expected 1", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collector_skipped"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+	localNodeNames = func() []string {
+		return []string{"ess03", "10.22.0.13"}
+	}
+	expected = `
+		# HELP gpfs_exporter_collector_skipped Indicates the collector was skipped on this node
+		# TYPE gpfs_exporter_collector_skipped gauge
+		gpfs_exporter_collector_skipped{collector="mmrepquota",reason="not-manager"} 0
+	`
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 45 {
+		t.Errorf("Unexpected collection count %d, expected 45", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collector_skipped"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestMmlssnapshotCollectorRunIfError(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.mmlssnapshot.run-if=manager", "--collector.mmlsmgr.cache-ttl=0s"}); err != nil {
+		t.Fatal(err)
+	}
+	MmlsmgrExec = func(ctx context.Context) (string, error) {
+		return "", fmt.Errorf("Error")
+	}
+	expected := `
+		# HELP gpfs_exporter_collect_error Indicates if error has occurred during collection
+		# TYPE gpfs_exporter_collect_error gauge
+		gpfs_exporter_collect_error{collector="mmlssnapshot"} 1
+	`
+	collector := NewMmlssnapshotCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 12 {
+		t.Errorf("Unexpected collection count %d, expected 12", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collect_error"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
@@ -13,9 +13,9 @@
 package collectors
 
 import (
-	"bytes"
 	"context"
 	"fmt"
+	"math"
 	"reflect"
 	"strconv"
 	"strings"
@@ -29,10 +29,11 @@ import (
 )
 
 var (
-	qosFilesystems = kingpin.Flag("collector.mmlsqos.filesystems", "Filesystems to query with mmlsqos, comma separated. Defaults to all filesystems.").Default("").String()
-	qosTimeout     = kingpin.Flag("collector.mmlsqos.timeout", "Timeout for mmlsqos execution").Default("60").Int()
-	qosSeconds     = kingpin.Flag("collector.mmlsqos.seconds", "Display the I/O performance values for the previous number of seconds. The valid range of seconds is 1-999").Default("60").Int()
-	qosMap         = map[string]string{
+	qosFilesystems   = kingpin.Flag("collector.mmlsqos.filesystems", "Filesystems to query with mmlsqos, comma separated. Defaults to all filesystems.").Default("").String()
+	qosTimeout       = kingpin.Flag("collector.mmlsqos.timeout", "Timeout for mmlsqos execution").Default("60").Int()
+	qosSeconds       = kingpin.Flag("collector.mmlsqos.seconds", "Display the I/O performance values for the previous number of seconds. The valid range of seconds is 1-999").Default("60").Int()
+	qosOmitUnlimited = kingpin.Flag("collector.mmlsqos.omit-unlimited", "Omit configured QoS limits of inf instead of reporting them as +Inf").Default("false").Bool()
+	qosMap           = map[string]string{
 		"pool":      "Pool",
 		"timeEpoch": "Time",
 		"class":     "Class",
@@ -56,12 +57,41 @@ type QosMetric struct {
 	Bs                     float64
 }
 
+// QosStatus is the status row of mmlsqos, each value is 1 for Yes and 0 for No
+type QosStatus struct {
+	Enabled    float64
+	Throttling float64
+	Monitoring float64
+}
+
+// QosLimit is the configured limit of a class in a pool, Unit is iops or bytes_per_second
+type QosLimit struct {
+	Pool  string
+	Class string
+	Scope string
+	Unit  string
+	Value float64
+}
+
+// QosConfig is the status and configured limits reported by mmlsqos
+type QosConfig struct {
+	Status *QosStatus
+	Limits []QosLimit
+}
+
 type MmlsqosCollector struct {
+	filesystemOverride
+	Time                   *prometheus.Desc
 	Iops                   *prometheus.Desc
 	AvegarePendingRequests *prometheus.Desc
 	AvegareQueuedRequests  *prometheus.Desc
 	MeasurementInterval    *prometheus.Desc
 	Bs                     *prometheus.Desc
+	Enabled                *prometheus.Desc
+	Throttling             *prometheus.Desc
+	Monitoring             *prometheus.Desc
+	IopsLimit              *prometheus.Desc
+	BsLimit                *prometheus.Desc
 	logger                 log.Logger
 }
 
@@ -70,52 +100,53 @@ func init() {
 }
 
 func NewMmlsqosCollector(logger log.Logger) Collector {
-	labels := []string{"fs", "pool", "class", "measurement_period_seconds"}
+	labels := []string{"fs", "remote_cluster", "pool", "class"}
+	fsLabels := []string{"fs", "remote_cluster"}
+	limitLabels := []string{"fs", "remote_cluster", "pool", "class", "scope"}
 	return &MmlsqosCollector{
-		Iops: prometheus.NewDesc(prometheus.BuildFQName(namespace, "qos", "iops"),
+		Time: newDesc(prometheus.BuildFQName(namespace, "qos", "epoch_timestamp_seconds"),
+			"GPFS epoch timestamp of the measurement", labels, nil),
+		Iops: newDesc(prometheus.BuildFQName(namespace, "qos", "iops"),
 			"GPFS performance of the class in I/O operations per second", labels, nil),
-		AvegarePendingRequests: prometheus.NewDesc(prometheus.BuildFQName(namespace, "qos", "average_pending_requests"),
+		AvegarePendingRequests: newDesc(prometheus.BuildFQName(namespace, "qos", "average_pending_requests"),
 			"GPFS average number of I/O requests in the class that are pending for reasons other than being queued by QoS", labels, nil),
-		AvegareQueuedRequests: prometheus.NewDesc(prometheus.BuildFQName(namespace, "qos", "average_queued_requests"),
+		AvegareQueuedRequests: newDesc(prometheus.BuildFQName(namespace, "qos", "average_queued_requests"),
 			"GPFS average number of I/O requests in the class that are queued by QoS", labels, nil),
-		MeasurementInterval: prometheus.NewDesc(prometheus.BuildFQName(namespace, "qos", "measurement_interval_seconds"),
+		MeasurementInterval: newDesc(prometheus.BuildFQName(namespace, "qos", "measurement_interval_seconds"),
 			"GPFS interval in seconds during which the measurement was made", labels, nil),
-		Bs: prometheus.NewDesc(prometheus.BuildFQName(namespace, "qos", "bytes_per_second"),
-			"GPFS performance of the class in Bytes per second", labels, nil),
+		Bs: newDesc(prometheus.BuildFQName(namespace, "qos", "bytes_per_second"),
+			"GPFS performance of the class in bytes per second", labels, nil),
+		Enabled: newDesc(prometheus.BuildFQName(namespace, "qos", "enabled"),
+			"GPFS QoS is enabled for the filesystem", fsLabels, nil),
+		Throttling: newDesc(prometheus.BuildFQName(namespace, "qos", "throttling_enabled"),
+			"GPFS QoS throttling is enabled for the filesystem", fsLabels, nil),
+		Monitoring: newDesc(prometheus.BuildFQName(namespace, "qos", "monitoring_enabled"),
+			"GPFS QoS monitoring is enabled for the filesystem", fsLabels, nil),
+		IopsLimit: newDesc(prometheus.BuildFQName(namespace, "qos", "configured_iops_limit"),
+			"GPFS configured QoS limit of the class in I/O operations per second, +Inf when unlimited", limitLabels, nil),
+		BsLimit: newDesc(prometheus.BuildFQName(namespace, "qos", "configured_bytes_per_second_limit"),
+			"GPFS configured QoS limit of the class in bytes per second", limitLabels, nil),
 		logger: logger,
 	}
 }
 
 func (c *MmlsqosCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.Time
 	ch <- c.Iops
 	ch <- c.AvegarePendingRequests
 	ch <- c.AvegareQueuedRequests
 	ch <- c.MeasurementInterval
 	ch <- c.Bs
+	ch <- c.Enabled
+	ch <- c.Throttling
+	ch <- c.Monitoring
+	ch <- c.IopsLimit
+	ch <- c.BsLimit
 }
 
 func (c *MmlsqosCollector) Collect(ch chan<- prometheus.Metric) {
 	wg := &sync.WaitGroup{}
-	var filesystems []string
-	if *qosFilesystems == "" {
-		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(*mmlsfsTimeout)*time.Second)
-		defer cancel()
-		var mmlsfsTimeout float64
-		var mmlsfsError float64
-		mmlfsfs_filesystems, err := mmlfsfsFilesystems(ctx, c.logger)
-		if err == context.DeadlineExceeded {
-			mmlsfsTimeout = 1
-			level.Error(c.logger).Log("msg", "Timeout executing mmlsfs")
-		} else if err != nil {
-			mmlsfsError = 1
-			level.Error(c.logger).Log("msg", err)
-		}
-		ch <- prometheus.MustNewConstMetric(collecTimeout, prometheus.GaugeValue, mmlsfsTimeout, "mmlsqos-mmlsfs")
-		ch <- prometheus.MustNewConstMetric(collectError, prometheus.GaugeValue, mmlsfsError, "mmlsqos-mmlsfs")
-		filesystems = mmlfsfs_filesystems
-	} else {
-		filesystems = strings.Split(*qosFilesystems, ",")
-	}
+	filesystems := c.getFilesystems(*qosFilesystems, "mmlsqos", ch, c.logger)
 	for _, fs := range filesystems {
 		level.Debug(c.logger).Log("msg", "Collecting mmlsqos metrics", "fs", fs)
 		wg.Add(1)
@@ -123,61 +154,76 @@ func (c *MmlsqosCollector) Collect(ch chan<- prometheus.Metric) {
 		go func(fs string) {
 			defer wg.Done()
 			label := fmt.Sprintf("mmlsqos-%s", fs)
-			timeout := 0
-			errorMetric := 0
-			metrics, err := c.mmlsqosCollect(fs)
+			fsName, remoteCluster := splitFilesystem(fs)
+			defer recoverCollectorPanic(ch, label, collectTime, c.logger)
+			metrics, config, err := c.mmlsqosCollect(fs)
 			if err == context.DeadlineExceeded {
 				level.Error(c.logger).Log("msg", fmt.Sprintf("Timeout executing %s", label))
-				timeout = 1
 			} else if err != nil {
 				level.Error(c.logger).Log("msg", err, "fs", fs)
-				errorMetric = 1
 			}
-			ch <- prometheus.MustNewConstMetric(collectError, prometheus.GaugeValue, float64(errorMetric), label)
-			ch <- prometheus.MustNewConstMetric(collecTimeout, prometheus.GaugeValue, float64(timeout), label)
-			ch <- prometheus.MustNewConstMetric(collectDuration, prometheus.GaugeValue, time.Since(collectTime).Seconds(), label)
 			if err != nil {
+				emitCollectorStatus(ch, label, err, collectTime, len(metrics))
 				return
 			}
 			for _, m := range metrics {
-				ch <- prometheus.MustNewConstMetric(c.Iops, prometheus.GaugeValue, m.Iops, fs, m.Pool, m.Class, fmt.Sprintf("%.f", m.Time))
-				ch <- prometheus.MustNewConstMetric(c.AvegarePendingRequests, prometheus.GaugeValue, m.AvegarePendingRequests, fs, m.Pool, m.Class, fmt.Sprintf("%.f", m.Time))
-				ch <- prometheus.MustNewConstMetric(c.AvegareQueuedRequests, prometheus.GaugeValue, m.AvegareQueuedRequests, fs, m.Pool, m.Class, fmt.Sprintf("%.f", m.Time))
-				ch <- prometheus.MustNewConstMetric(c.MeasurementInterval, prometheus.GaugeValue, m.MeasurementInterval, fs, m.Pool, m.Class, fmt.Sprintf("%.f", m.Time))
-				ch <- prometheus.MustNewConstMetric(c.Bs, prometheus.GaugeValue, m.Bs, fs, m.Pool, m.Class, fmt.Sprintf("%.f", m.Time))
+				ch <- prometheus.MustNewConstMetric(c.Time, prometheus.GaugeValue, m.Time, fsName, remoteCluster, m.Pool, m.Class)
+				ch <- prometheus.MustNewConstMetric(c.Iops, prometheus.GaugeValue, m.Iops, fsName, remoteCluster, m.Pool, m.Class)
+				ch <- prometheus.MustNewConstMetric(c.AvegarePendingRequests, prometheus.GaugeValue, m.AvegarePendingRequests, fsName, remoteCluster, m.Pool, m.Class)
+				ch <- prometheus.MustNewConstMetric(c.AvegareQueuedRequests, prometheus.GaugeValue, m.AvegareQueuedRequests, fsName, remoteCluster, m.Pool, m.Class)
+				ch <- prometheus.MustNewConstMetric(c.MeasurementInterval, prometheus.GaugeValue, m.MeasurementInterval, fsName, remoteCluster, m.Pool, m.Class)
+				ch <- prometheus.MustNewConstMetric(c.Bs, prometheus.GaugeValue, m.Bs, fsName, remoteCluster, m.Pool, m.Class)
+			}
+			if status := config.Status; status != nil {
+				ch <- prometheus.MustNewConstMetric(c.Enabled, prometheus.GaugeValue, status.Enabled, fsName, remoteCluster)
+				ch <- prometheus.MustNewConstMetric(c.Throttling, prometheus.GaugeValue, status.Throttling, fsName, remoteCluster)
+				ch <- prometheus.MustNewConstMetric(c.Monitoring, prometheus.GaugeValue, status.Monitoring, fsName, remoteCluster)
+			}
+			for _, l := range config.Limits {
+				if math.IsInf(l.Value, 1) && *qosOmitUnlimited {
+					continue
+				}
+				desc := c.IopsLimit
+				if l.Unit == "bytes_per_second" {
+					desc = c.BsLimit
+				}
+				ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, l.Value, fsName, remoteCluster, l.Pool, l.Class, l.Scope)
 			}
+			emitCollectorStatus(ch, label, err, collectTime, len(metrics))
 		}(fs)
 	}
 	wg.Wait()
 }
 
-func (c *MmlsqosCollector) mmlsqosCollect(fs string) ([]QosMetric, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(*qosTimeout)*time.Second)
+func (c *MmlsqosCollector) mmlsqosCollect(fs string) ([]QosMetric, QosConfig, error) {
+	ctx, cancel := commandContext("mmlsqos", *qosTimeout)
 	defer cancel()
-	out, err := MmlsqosExec(fs, ctx)
+	out, err := execRetry(ctx, "mmlsqos", func() (string, error) {
+		return MmlsqosExec(fs, ctx)
+	})
 	if err != nil {
-		return nil, err
+		return nil, QosConfig{}, err
 	}
+	commandDump.record(fmt.Sprintf("mmlsqos-%s", fs), out)
 	metrics, err := parse_mmlsqos(out, c.logger)
-	return metrics, err
+	commandDump.recordParsed(fmt.Sprintf("mmlsqos-%s", fs), metrics)
+	if err != nil {
+		return metrics, QosConfig{}, err
+	}
+	config := parse_mmlsqos_config(out, c.logger)
+	commandDump.recordParsed(fmt.Sprintf("mmlsqos-%s-config", fs), config)
+	return metrics, config, nil
 }
 
 func mmlsqos(fs string, ctx context.Context) (string, error) {
-	args := []string{"/usr/lpp/mmfs/bin/mmlsqos", fs, "-Y", "--seconds", strconv.Itoa(*qosSeconds)}
-	cmd := execCommand(ctx, *sudoCmd, args...)
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	err := cmd.Run()
-	if ctx.Err() == context.DeadlineExceeded {
-		return "", ctx.Err()
-	} else if err != nil {
-		return "", err
-	}
-	return out.String(), nil
+	return RunMMCommand(ctx, "mmlsqos", fs, "-Y", "--seconds", strconv.Itoa(*qosSeconds))
 }
 
 func parse_mmlsqos(out string, logger log.Logger) ([]QosMetric, error) {
 	var metrics []QosMetric
+	// Index of newest interval in metrics for each pool and class
+	type intervalKey struct{ Pool, Class string }
+	intervals := make(map[intervalKey]int)
 	headers := []string{}
 	lines := strings.Split(out, "\n")
 	for _, l := range lines {
@@ -193,36 +239,136 @@ func parse_mmlsqos(out string, logger log.Logger) ([]QosMetric, error) {
 		}
 		var values []string
 		if items[2] == "HEADER" {
-			headers = append(headers, items...)
+			headers = items
 			continue
 		} else {
 			values = append(values, items...)
 		}
 		var metric QosMetric
+		var rowErr error
 		ps := reflect.ValueOf(&metric) // pointer to struct - addressable
 		s := ps.Elem()                 // struct
 		for i, h := range headers {
+			if i >= len(values) {
+				break
+			}
 			if field, ok := qosMap[h]; ok {
 				f := s.FieldByName(field)
 				if f.Kind() == reflect.String {
-					f.SetString(values[i])
+					f.SetString(DecodeGPFSString(values[i]))
 				} else if f.Kind() == reflect.Float64 {
 					if strings.Contains(values[i], "nan") {
 						f.SetFloat(0)
 					} else if val, err := strconv.ParseFloat(strings.Replace(values[i], ",", ".", -1), 64); err == nil {
 						if field == "Bs" {
-							val = val * 1024 * 1024
+							val = MBToBytes(val)
 						}
 						f.SetFloat(val)
 					} else {
-						level.Error(logger).Log("msg", fmt.Sprintf("Error parsing %s value %s: %s", h, values[i], err.Error()))
-						return nil, err
+						rowErr = fmt.Errorf("Error parsing %s value %s: %w", h, values[i], err)
+						break
 					}
 				}
 			}
 		}
+		if rowErr != nil {
+			level.Warn(logger).Log("msg", "Skipping QoS row with unparsable values", "pool", metric.Pool, "class", metric.Class, "err", rowErr)
+			parseErrors.WithLabelValues("mmlsqos").Inc()
+			continue
+		}
 
+		key := intervalKey{metric.Pool, metric.Class}
+		if i, ok := intervals[key]; ok {
+			if metric.Time > metrics[i].Time {
+				metrics[i] = metric
+			}
+			continue
+		}
+		intervals[key] = len(metrics)
 		metrics = append(metrics, metric)
 	}
 	return metrics, nil
 }
+
+// parse_mmlsqos_config parses the status row and the configured limits of mmlsqos.
+// The limits are read from the values row, or the config row when there is no values row,
+// which holds pool specifications such as pool=sas1,other=inf,maintenance/all_local=50000Iops
+// separated by encoded colons. The scope of a class, such as /all_local, is kept separate from the class.
+func parse_mmlsqos_config(out string, logger log.Logger) QosConfig {
+	var config QosConfig
+	headers := make(map[string]map[string]int)
+	encoded := make(map[string]string)
+	for _, l := range strings.Split(out, "\n") {
+		if !strings.HasPrefix(l, "mmlsqos") {
+			continue
+		}
+		items := strings.Split(l, ":")
+		if len(items) < 3 {
+			continue
+		}
+		section := items[1]
+		if section != "status" && section != "config" && section != "values" {
+			continue
+		}
+		if items[2] == "HEADER" {
+			headers[section] = HeaderIndexMap(items)
+			continue
+		}
+		switch section {
+		case "status":
+			status := QosStatus{}
+			for name, field := range map[string]*float64{"enabled": &status.Enabled, "throttling": &status.Throttling, "monitoring": &status.Monitoring} {
+				if value, ok := headerValue(items, headers[section], name); ok && strings.ToLower(value) == "yes" {
+					*field = 1
+				}
+			}
+			config.Status = &status
+		case "config":
+			encoded[section], _ = headerValue(items, headers[section], "config_enc")
+		case "values":
+			encoded[section], _ = headerValue(items, headers[section], "values_enc")
+		}
+	}
+	specs, ok := encoded["values"]
+	if !ok {
+		specs = encoded["config"]
+	}
+	for _, spec := range strings.Split(DecodeGPFSString(specs), ":") {
+		var pool string
+		for _, item := range strings.Split(spec, ",") {
+			name, value, found := strings.Cut(item, "=")
+			if !found {
+				continue
+			}
+			if name == "pool" {
+				pool = value
+				continue
+			}
+			class, scope, _ := strings.Cut(name, "/")
+			limit, unit, err := parseQosLimit(value)
+			if err != nil {
+				level.Warn(logger).Log("msg", "Skipping QoS limit that could not be parsed", "pool", pool, "class", class, "scope", scope, "err", err)
+				parseErrors.WithLabelValues("mmlsqos").Inc()
+				continue
+			}
+			config.Limits = append(config.Limits, QosLimit{Pool: pool, Class: class, Scope: scope, Unit: unit, Value: limit})
+		}
+	}
+	return config
+}
+
+// parseQosLimit returns the value and unit of a QoS limit such as inf, 50000Iops or 100MB/s
+func parseQosLimit(value string) (float64, string, error) {
+	v := strings.ToLower(strings.TrimSpace(value))
+	switch {
+	case v == "inf" || v == "unlimited":
+		return math.Inf(1), "iops", nil
+	case strings.HasSuffix(v, "iops"):
+		val, err := strconv.ParseFloat(strings.TrimSuffix(v, "iops"), 64)
+		return val, "iops", err
+	case strings.HasSuffix(v, "mb/s"):
+		val, err := strconv.ParseFloat(strings.TrimSuffix(v, "mb/s"), 64)
+		return MBToBytes(val), "bytes_per_second", err
+	}
+	return 0, "", fmt.Errorf("Unknown QoS limit %s", value)
+}
@@ -16,7 +16,9 @@ package collectors
 import (
 	"context"
 	"fmt"
+	"math"
 	"os/exec"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -40,6 +42,14 @@ mmlsqos:stats:0:1:::nvme1:1678438680:other:829,83:0,85256:77349065,73251:30:1525
 mmlsqos:stats:0:1:::system:1678438680:misc:24875:1,7781e+08:0,0055852:30:212.95:
 mmlsqos:stats:0:1:::system:1678438680:other:35545:41,399:1,9398e+08:30:149.76:
 mmlsqos:stats:0:1:::system:1678438680:maintenance:0,066667:5,579e-05:0,00000:30:0.00026042:
+`
+	mmlsqosStdoutIntervals = `
+mmlsqos:stats:HEADER:version:reserved:reserved:pool:timeEpoch:class:iops:ioql:qsdl:et:MBs:
+mmlsqos:stats:0:1:::system:1678438620:misc:100:1:0:30:1.0:
+mmlsqos:stats:0:1:::system:1678438620:other:200:2:0:30:2.0:
+mmlsqos:stats:0:1:::system:1678438680:misc:300:3:0:30:3.0:
+mmlsqos:stats:0:1:::system:1678438650:other:400:4:0:30:4.0:
+mmlsqos:stats:0:1:::system:1678438590:misc:500:5:0:30:5.0:
 `
 	mmlsqosStdoutNanValue = `
 mmlsqos:status:HEADER:version:reserved:reserved:enabled:throttling:monitoring:fineStatsSecs:idStats:
@@ -169,16 +179,97 @@ func TestParseMmlsqos(t *testing.T) {
 }
 
 func TestParseMmlsqosErrors(t *testing.T) {
-	_, err := parse_mmlsqos(mmlsqosStdoutBadTime, log.NewNopLogger())
-	if err == nil {
-		t.Errorf("Expected error")
+	for _, out := range []string{mmlsqosStdoutBadTime, mmlsqosStdoutBadValue} {
+		before := testutil.ToFloat64(parseErrors.WithLabelValues("mmlsqos"))
+		metrics, err := parse_mmlsqos(out, log.NewNopLogger())
+		if err != nil {
+			t.Errorf("Unexpected error: %s", err.Error())
+			return
+		}
+		if len(metrics) != 1 {
+			t.Errorf("Unexpected number of metrics, got %d", len(metrics))
+			return
+		}
+		if metrics[0].Class != "other" {
+			t.Errorf("Unexpected class %s", metrics[0].Class)
+		}
+		if val := testutil.ToFloat64(parseErrors.WithLabelValues("mmlsqos")) - before; val != 1 {
+			t.Errorf("Unexpected parse errors, got %v", val)
+		}
+	}
+}
+
+func TestParseMmlsqosIntervals(t *testing.T) {
+	metrics, err := parse_mmlsqos(mmlsqosStdoutIntervals, log.NewNopLogger())
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
 		return
 	}
-	_, err = parse_mmlsqos(mmlsqosStdoutBadValue, log.NewNopLogger())
-	if err == nil {
-		t.Errorf("Expected error")
+	if len(metrics) != 2 {
+		t.Errorf("Unexpected number of metrics, got %d", len(metrics))
 		return
 	}
+	if metrics[0].Class != "misc" || metrics[0].Time != 1678438680 || metrics[0].Iops != 300 {
+		t.Errorf("Unexpected metric for misc class: %+v", metrics[0])
+	}
+	if metrics[1].Class != "other" || metrics[1].Time != 1678438650 || metrics[1].Iops != 400 {
+		t.Errorf("Unexpected metric for other class: %+v", metrics[1])
+	}
+}
+
+func TestParseMmlsqosIntervalsDashes(t *testing.T) {
+	out := `
+mmlsqos:stats:HEADER:version:reserved:reserved:pool:timeEpoch:class:iops:ioql:qsdl:et:MBs:
+mmlsqos:stats:0:1:::a-b:1678438620:c:100:1:0:30:1.0:
+mmlsqos:stats:0:1:::a:1678438680:b-c:300:3:0:30:3.0:
+`
+	metrics, err := parse_mmlsqos(out, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if len(metrics) != 2 {
+		t.Errorf("Unexpected number of metrics, got %d: %+v", len(metrics), metrics)
+	}
+}
+
+func TestParseMmlsqosConfig(t *testing.T) {
+	config := parse_mmlsqos_config(mmlsqosStdout, log.NewNopLogger())
+	if config.Status == nil || config.Status.Enabled != 1 || config.Status.Throttling != 1 || config.Status.Monitoring != 1 {
+		t.Errorf("Unexpected status: %+v", config.Status)
+	}
+	if len(config.Limits) != 10 {
+		t.Errorf("Unexpected number of limits, got %d", len(config.Limits))
+		return
+	}
+	if l := config.Limits[0]; l.Pool != "system" || l.Class != "other" || l.Unit != "iops" || !math.IsInf(l.Value, 1) {
+		t.Errorf("Unexpected limit: %+v", l)
+	}
+	if l := config.Limits[3]; l.Pool != "sas1" || l.Class != "maintenance" || l.Scope != "all_local" || l.Unit != "iops" || l.Value != 50000 {
+		t.Errorf("Unexpected limit: %+v", l)
+	}
+	out := `mmlsqos:status:HEADER:version:reserved:reserved:enabled:throttling:monitoring:fineStatsSecs:idStats:
+mmlsqos:config:HEADER:version:reserved:reserved:config_enc:
+mmlsqos:status:0:1:::Yes:No:Yes:0:No:
+mmlsqos:config:0:1:::pool=*,other=100MB/s,maintenance=1000IOPS%3Apool=data,maintenance=fast:
+`
+	before := testutil.ToFloat64(parseErrors.WithLabelValues("mmlsqos"))
+	config = parse_mmlsqos_config(out, log.NewNopLogger())
+	if config.Status == nil || config.Status.Enabled != 1 || config.Status.Throttling != 0 || config.Status.Monitoring != 1 {
+		t.Errorf("Unexpected status: %+v", config.Status)
+	}
+	expected := []QosLimit{
+		{Pool: "*", Class: "other", Unit: "bytes_per_second", Value: 100 * 1024 * 1024},
+		{Pool: "*", Class: "maintenance", Unit: "iops", Value: 1000},
+	}
+	if !reflect.DeepEqual(config.Limits, expected) {
+		t.Errorf("Unexpected limits\nExpected: %+v\nGot: %+v", expected, config.Limits)
+	}
+	if val := testutil.ToFloat64(parseErrors.WithLabelValues("mmlsqos")) - before; val != 1 {
+		t.Errorf("Unexpected parse errors, got %v", val)
+	}
+	if config = parse_mmlsqos_config(mmlsqosStdoutIntervals, log.NewNopLogger()); config.Status != nil || len(config.Limits) != 0 {
+		t.Errorf("Unexpected config without status and values rows: %+v", config)
+	}
 }
 
 func TestMmlsqosCollector(t *testing.T) {
@@ -193,46 +284,53 @@ func TestMmlsqosCollector(t *testing.T) {
 	expected := `
 		# HELP gpfs_qos_average_pending_requests GPFS average number of I/O requests in the class that are pending for reasons other than being queued by QoS
         # TYPE gpfs_qos_average_pending_requests gauge
-        gpfs_qos_average_pending_requests{class="maintenance",fs="mmfs1",measurement_period_seconds="1678438680",pool="system"} 5.579e-05
-        gpfs_qos_average_pending_requests{class="misc",fs="mmfs1",measurement_period_seconds="1678438680",pool="nvme1"} 0.013449
-        gpfs_qos_average_pending_requests{class="misc",fs="mmfs1",measurement_period_seconds="1678438680",pool="system"} 1.7781e+08
-        gpfs_qos_average_pending_requests{class="other",fs="mmfs1",measurement_period_seconds="1678438680",pool="nvme1"} 0.85256
-        gpfs_qos_average_pending_requests{class="other",fs="mmfs1",measurement_period_seconds="1678438680",pool="system"} 41.399
+        gpfs_qos_average_pending_requests{class="maintenance",fs="mmfs1",pool="system",remote_cluster=""} 5.579e-05
+        gpfs_qos_average_pending_requests{class="misc",fs="mmfs1",pool="nvme1",remote_cluster=""} 0.013449
+        gpfs_qos_average_pending_requests{class="misc",fs="mmfs1",pool="system",remote_cluster=""} 1.7781e+08
+        gpfs_qos_average_pending_requests{class="other",fs="mmfs1",pool="nvme1",remote_cluster=""} 0.85256
+        gpfs_qos_average_pending_requests{class="other",fs="mmfs1",pool="system",remote_cluster=""} 41.399
+        # HELP gpfs_qos_epoch_timestamp_seconds GPFS epoch timestamp of the measurement
+        # TYPE gpfs_qos_epoch_timestamp_seconds gauge
+        gpfs_qos_epoch_timestamp_seconds{class="maintenance",fs="mmfs1",pool="system",remote_cluster=""} 1678438680
+        gpfs_qos_epoch_timestamp_seconds{class="misc",fs="mmfs1",pool="nvme1",remote_cluster=""} 1678438680
+        gpfs_qos_epoch_timestamp_seconds{class="misc",fs="mmfs1",pool="system",remote_cluster=""} 1678438680
+        gpfs_qos_epoch_timestamp_seconds{class="other",fs="mmfs1",pool="nvme1",remote_cluster=""} 1678438680
+        gpfs_qos_epoch_timestamp_seconds{class="other",fs="mmfs1",pool="system",remote_cluster=""} 1678438680
         # HELP gpfs_qos_average_queued_requests GPFS average number of I/O requests in the class that are queued by QoS
         # TYPE gpfs_qos_average_queued_requests gauge
-        gpfs_qos_average_queued_requests{class="maintenance",fs="mmfs1",measurement_period_seconds="1678438680",pool="system"} 0
-        gpfs_qos_average_queued_requests{class="misc",fs="mmfs1",measurement_period_seconds="1678438680",pool="nvme1"} 1.0751e-05
-        gpfs_qos_average_queued_requests{class="misc",fs="mmfs1",measurement_period_seconds="1678438680",pool="system"} 0.0055852
-        gpfs_qos_average_queued_requests{class="other",fs="mmfs1",measurement_period_seconds="1678438680",pool="nvme1"} 7.734906573251e+07
-        gpfs_qos_average_queued_requests{class="other",fs="mmfs1",measurement_period_seconds="1678438680",pool="system"} 1.9398e+08
-        # HELP gpfs_qos_bytes_per_second GPFS performance of the class in Bytes per second
+        gpfs_qos_average_queued_requests{class="maintenance",fs="mmfs1",pool="system",remote_cluster=""} 0
+        gpfs_qos_average_queued_requests{class="misc",fs="mmfs1",pool="nvme1",remote_cluster=""} 1.0751e-05
+        gpfs_qos_average_queued_requests{class="misc",fs="mmfs1",pool="system",remote_cluster=""} 0.0055852
+        gpfs_qos_average_queued_requests{class="other",fs="mmfs1",pool="nvme1",remote_cluster=""} 7.734906573251e+07
+        gpfs_qos_average_queued_requests{class="other",fs="mmfs1",pool="system",remote_cluster=""} 1.9398e+08
+        # HELP gpfs_qos_bytes_per_second GPFS performance of the class in bytes per second
         # TYPE gpfs_qos_bytes_per_second gauge
-        gpfs_qos_bytes_per_second{class="maintenance",fs="mmfs1",measurement_period_seconds="1678438680",pool="system"} 273.07016192
-        gpfs_qos_bytes_per_second{class="misc",fs="mmfs1",measurement_period_seconds="1678438680",pool="nvme1"} 4.9020928e+06
-        gpfs_qos_bytes_per_second{class="misc",fs="mmfs1",measurement_period_seconds="1678438680",pool="system"} 2.232942592e+08
-        gpfs_qos_bytes_per_second{class="other",fs="mmfs1",measurement_period_seconds="1678438680",pool="nvme1"} 1.599602688e+09
-        gpfs_qos_bytes_per_second{class="other",fs="mmfs1",measurement_period_seconds="1678438680",pool="system"} 1.5703474176e+08
+        gpfs_qos_bytes_per_second{class="maintenance",fs="mmfs1",pool="system",remote_cluster=""} 273.07016192
+        gpfs_qos_bytes_per_second{class="misc",fs="mmfs1",pool="nvme1",remote_cluster=""} 4.9020928e+06
+        gpfs_qos_bytes_per_second{class="misc",fs="mmfs1",pool="system",remote_cluster=""} 2.232942592e+08
+        gpfs_qos_bytes_per_second{class="other",fs="mmfs1",pool="nvme1",remote_cluster=""} 1.599602688e+09
+        gpfs_qos_bytes_per_second{class="other",fs="mmfs1",pool="system",remote_cluster=""} 1.5703474176e+08
         # HELP gpfs_qos_iops GPFS performance of the class in I/O operations per second
         # TYPE gpfs_qos_iops gauge
-        gpfs_qos_iops{class="maintenance",fs="mmfs1",measurement_period_seconds="1678438680",pool="system"} 0.066667
-        gpfs_qos_iops{class="misc",fs="mmfs1",measurement_period_seconds="1678438680",pool="nvme1"} 33.267
-        gpfs_qos_iops{class="misc",fs="mmfs1",measurement_period_seconds="1678438680",pool="system"} 24875
-        gpfs_qos_iops{class="other",fs="mmfs1",measurement_period_seconds="1678438680",pool="nvme1"} 829.83
-        gpfs_qos_iops{class="other",fs="mmfs1",measurement_period_seconds="1678438680",pool="system"} 35545
+        gpfs_qos_iops{class="maintenance",fs="mmfs1",pool="system",remote_cluster=""} 0.066667
+        gpfs_qos_iops{class="misc",fs="mmfs1",pool="nvme1",remote_cluster=""} 33.267
+        gpfs_qos_iops{class="misc",fs="mmfs1",pool="system",remote_cluster=""} 24875
+        gpfs_qos_iops{class="other",fs="mmfs1",pool="nvme1",remote_cluster=""} 829.83
+        gpfs_qos_iops{class="other",fs="mmfs1",pool="system",remote_cluster=""} 35545
         # HELP gpfs_qos_measurement_interval_seconds GPFS interval in seconds during which the measurement was made
         # TYPE gpfs_qos_measurement_interval_seconds gauge
-        gpfs_qos_measurement_interval_seconds{class="maintenance",fs="mmfs1",measurement_period_seconds="1678438680",pool="system"} 30
-        gpfs_qos_measurement_interval_seconds{class="misc",fs="mmfs1",measurement_period_seconds="1678438680",pool="nvme1"} 30
-        gpfs_qos_measurement_interval_seconds{class="misc",fs="mmfs1",measurement_period_seconds="1678438680",pool="system"} 30
-        gpfs_qos_measurement_interval_seconds{class="other",fs="mmfs1",measurement_period_seconds="1678438680",pool="nvme1"} 30
-        gpfs_qos_measurement_interval_seconds{class="other",fs="mmfs1",measurement_period_seconds="1678438680",pool="system"} 30
+        gpfs_qos_measurement_interval_seconds{class="maintenance",fs="mmfs1",pool="system",remote_cluster=""} 30
+        gpfs_qos_measurement_interval_seconds{class="misc",fs="mmfs1",pool="nvme1",remote_cluster=""} 30
+        gpfs_qos_measurement_interval_seconds{class="misc",fs="mmfs1",pool="system",remote_cluster=""} 30
+        gpfs_qos_measurement_interval_seconds{class="other",fs="mmfs1",pool="nvme1",remote_cluster=""} 30
+        gpfs_qos_measurement_interval_seconds{class="other",fs="mmfs1",pool="system",remote_cluster=""} 30
 	`
 	collector := NewMmlsqosCollector(log.NewNopLogger())
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
-	} else if val != 28 {
-		t.Errorf("Unexpected collection count %d, expected 28", val)
+	} else if val != 58 {
+		t.Errorf("Unexpected collection count %d, expected 58", val)
 	}
 	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
 		"gpfs_qos_epoch_timestamp_seconds", "gpfs_qos_measurement_interval_seconds",
@@ -242,6 +340,59 @@ func TestMmlsqosCollector(t *testing.T) {
 	}
 }
 
+func TestMmlsqosCollectorOmitUnlimited(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.mmlsqos.omit-unlimited"}); err != nil {
+		t.Fatal(err)
+	}
+	defer kingpin.CommandLine.Parse([]string{})
+	filesystems := "mmfs1"
+	qosFilesystems = &filesystems
+	MmlsqosExec = func(fs string, ctx context.Context) (string, error) {
+		return mmlsqosStdout, nil
+	}
+	expected := `
+		# HELP gpfs_qos_configured_iops_limit GPFS configured QoS limit of the class in I/O operations per second, +Inf when unlimited
+		# TYPE gpfs_qos_configured_iops_limit gauge
+		gpfs_qos_configured_iops_limit{class="maintenance",fs="mmfs1",pool="sas1",remote_cluster="",scope="all_local"} 50000
+		# HELP gpfs_qos_throttling_enabled GPFS QoS throttling is enabled for the filesystem
+		# TYPE gpfs_qos_throttling_enabled gauge
+		gpfs_qos_throttling_enabled{fs="mmfs1",remote_cluster=""} 1
+	`
+	collector := NewMmlsqosCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
+		"gpfs_qos_configured_iops_limit", "gpfs_qos_throttling_enabled"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestMmlsqosCollectorScopes(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	filesystems := "mmfs1"
+	qosFilesystems = &filesystems
+	MmlsqosExec = func(fs string, ctx context.Context) (string, error) {
+		return `mmlsqos:status:HEADER:version:reserved:reserved:enabled:throttling:monitoring:fineStatsSecs:idStats:
+mmlsqos:values:HEADER:version:reserved:reserved:values_enc:
+mmlsqos:status:0:1:::Yes:Yes:Yes:0:No:
+mmlsqos:values:0:1:::pool=system,other=inf,maintenance/all_local=1000Iops,maintenance/nsdNodes=2000Iops:
+`, nil
+	}
+	expected := `
+		# HELP gpfs_qos_configured_iops_limit GPFS configured QoS limit of the class in I/O operations per second, +Inf when unlimited
+		# TYPE gpfs_qos_configured_iops_limit gauge
+		gpfs_qos_configured_iops_limit{class="maintenance",fs="mmfs1",pool="system",remote_cluster="",scope="all_local"} 1000
+		gpfs_qos_configured_iops_limit{class="maintenance",fs="mmfs1",pool="system",remote_cluster="",scope="nsdNodes"} 2000
+		gpfs_qos_configured_iops_limit{class="other",fs="mmfs1",pool="system",remote_cluster="",scope=""} +Inf
+	`
+	collector := NewMmlsqosCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_qos_configured_iops_limit"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
 func TestMmlsqosCollectorMmlsfs(t *testing.T) {
 	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
 		t.Fatal(err)
@@ -259,46 +410,53 @@ func TestMmlsqosCollectorMmlsfs(t *testing.T) {
 	expected := `
 		# HELP gpfs_qos_average_pending_requests GPFS average number of I/O requests in the class that are pending for reasons other than being queued by QoS
         # TYPE gpfs_qos_average_pending_requests gauge
-        gpfs_qos_average_pending_requests{class="maintenance",fs="mmfs1",measurement_period_seconds="1678438680",pool="system"} 5.579e-05
-        gpfs_qos_average_pending_requests{class="misc",fs="mmfs1",measurement_period_seconds="1678438680",pool="nvme1"} 0.013449
-        gpfs_qos_average_pending_requests{class="misc",fs="mmfs1",measurement_period_seconds="1678438680",pool="system"} 1.7781e+08
-        gpfs_qos_average_pending_requests{class="other",fs="mmfs1",measurement_period_seconds="1678438680",pool="nvme1"} 0.85256
-        gpfs_qos_average_pending_requests{class="other",fs="mmfs1",measurement_period_seconds="1678438680",pool="system"} 41.399
+        gpfs_qos_average_pending_requests{class="maintenance",fs="mmfs1",pool="system",remote_cluster=""} 5.579e-05
+        gpfs_qos_average_pending_requests{class="misc",fs="mmfs1",pool="nvme1",remote_cluster=""} 0.013449
+        gpfs_qos_average_pending_requests{class="misc",fs="mmfs1",pool="system",remote_cluster=""} 1.7781e+08
+        gpfs_qos_average_pending_requests{class="other",fs="mmfs1",pool="nvme1",remote_cluster=""} 0.85256
+        gpfs_qos_average_pending_requests{class="other",fs="mmfs1",pool="system",remote_cluster=""} 41.399
+        # HELP gpfs_qos_epoch_timestamp_seconds GPFS epoch timestamp of the measurement
+        # TYPE gpfs_qos_epoch_timestamp_seconds gauge
+        gpfs_qos_epoch_timestamp_seconds{class="maintenance",fs="mmfs1",pool="system",remote_cluster=""} 1678438680
+        gpfs_qos_epoch_timestamp_seconds{class="misc",fs="mmfs1",pool="nvme1",remote_cluster=""} 1678438680
+        gpfs_qos_epoch_timestamp_seconds{class="misc",fs="mmfs1",pool="system",remote_cluster=""} 1678438680
+        gpfs_qos_epoch_timestamp_seconds{class="other",fs="mmfs1",pool="nvme1",remote_cluster=""} 1678438680
+        gpfs_qos_epoch_timestamp_seconds{class="other",fs="mmfs1",pool="system",remote_cluster=""} 1678438680
         # HELP gpfs_qos_average_queued_requests GPFS average number of I/O requests in the class that are queued by QoS
         # TYPE gpfs_qos_average_queued_requests gauge
-        gpfs_qos_average_queued_requests{class="maintenance",fs="mmfs1",measurement_period_seconds="1678438680",pool="system"} 0
-        gpfs_qos_average_queued_requests{class="misc",fs="mmfs1",measurement_period_seconds="1678438680",pool="nvme1"} 1.0751e-05
-        gpfs_qos_average_queued_requests{class="misc",fs="mmfs1",measurement_period_seconds="1678438680",pool="system"} 0.0055852
-        gpfs_qos_average_queued_requests{class="other",fs="mmfs1",measurement_period_seconds="1678438680",pool="nvme1"} 7.734906573251e+07
-        gpfs_qos_average_queued_requests{class="other",fs="mmfs1",measurement_period_seconds="1678438680",pool="system"} 1.9398e+08
-        # HELP gpfs_qos_bytes_per_second GPFS performance of the class in Bytes per second
+        gpfs_qos_average_queued_requests{class="maintenance",fs="mmfs1",pool="system",remote_cluster=""} 0
+        gpfs_qos_average_queued_requests{class="misc",fs="mmfs1",pool="nvme1",remote_cluster=""} 1.0751e-05
+        gpfs_qos_average_queued_requests{class="misc",fs="mmfs1",pool="system",remote_cluster=""} 0.0055852
+        gpfs_qos_average_queued_requests{class="other",fs="mmfs1",pool="nvme1",remote_cluster=""} 7.734906573251e+07
+        gpfs_qos_average_queued_requests{class="other",fs="mmfs1",pool="system",remote_cluster=""} 1.9398e+08
+        # HELP gpfs_qos_bytes_per_second GPFS performance of the class in bytes per second
         # TYPE gpfs_qos_bytes_per_second gauge
-        gpfs_qos_bytes_per_second{class="maintenance",fs="mmfs1",measurement_period_seconds="1678438680",pool="system"} 273.07016192
-        gpfs_qos_bytes_per_second{class="misc",fs="mmfs1",measurement_period_seconds="1678438680",pool="nvme1"} 4.9020928e+06
-        gpfs_qos_bytes_per_second{class="misc",fs="mmfs1",measurement_period_seconds="1678438680",pool="system"} 2.232942592e+08
-        gpfs_qos_bytes_per_second{class="other",fs="mmfs1",measurement_period_seconds="1678438680",pool="nvme1"} 1.599602688e+09
-        gpfs_qos_bytes_per_second{class="other",fs="mmfs1",measurement_period_seconds="1678438680",pool="system"} 1.5703474176e+08
+        gpfs_qos_bytes_per_second{class="maintenance",fs="mmfs1",pool="system",remote_cluster=""} 273.07016192
+        gpfs_qos_bytes_per_second{class="misc",fs="mmfs1",pool="nvme1",remote_cluster=""} 4.9020928e+06
+        gpfs_qos_bytes_per_second{class="misc",fs="mmfs1",pool="system",remote_cluster=""} 2.232942592e+08
+        gpfs_qos_bytes_per_second{class="other",fs="mmfs1",pool="nvme1",remote_cluster=""} 1.599602688e+09
+        gpfs_qos_bytes_per_second{class="other",fs="mmfs1",pool="system",remote_cluster=""} 1.5703474176e+08
         # HELP gpfs_qos_iops GPFS performance of the class in I/O operations per second
         # TYPE gpfs_qos_iops gauge
-        gpfs_qos_iops{class="maintenance",fs="mmfs1",measurement_period_seconds="1678438680",pool="system"} 0.066667
-        gpfs_qos_iops{class="misc",fs="mmfs1",measurement_period_seconds="1678438680",pool="nvme1"} 33.267
-        gpfs_qos_iops{class="misc",fs="mmfs1",measurement_period_seconds="1678438680",pool="system"} 24875
-        gpfs_qos_iops{class="other",fs="mmfs1",measurement_period_seconds="1678438680",pool="nvme1"} 829.83
-        gpfs_qos_iops{class="other",fs="mmfs1",measurement_period_seconds="1678438680",pool="system"} 35545
+        gpfs_qos_iops{class="maintenance",fs="mmfs1",pool="system",remote_cluster=""} 0.066667
+        gpfs_qos_iops{class="misc",fs="mmfs1",pool="nvme1",remote_cluster=""} 33.267
+        gpfs_qos_iops{class="misc",fs="mmfs1",pool="system",remote_cluster=""} 24875
+        gpfs_qos_iops{class="other",fs="mmfs1",pool="nvme1",remote_cluster=""} 829.83
+        gpfs_qos_iops{class="other",fs="mmfs1",pool="system",remote_cluster=""} 35545
         # HELP gpfs_qos_measurement_interval_seconds GPFS interval in seconds during which the measurement was made
         # TYPE gpfs_qos_measurement_interval_seconds gauge
-        gpfs_qos_measurement_interval_seconds{class="maintenance",fs="mmfs1",measurement_period_seconds="1678438680",pool="system"} 30
-        gpfs_qos_measurement_interval_seconds{class="misc",fs="mmfs1",measurement_period_seconds="1678438680",pool="nvme1"} 30
-        gpfs_qos_measurement_interval_seconds{class="misc",fs="mmfs1",measurement_period_seconds="1678438680",pool="system"} 30
-        gpfs_qos_measurement_interval_seconds{class="other",fs="mmfs1",measurement_period_seconds="1678438680",pool="nvme1"} 30
-        gpfs_qos_measurement_interval_seconds{class="other",fs="mmfs1",measurement_period_seconds="1678438680",pool="system"} 30
+        gpfs_qos_measurement_interval_seconds{class="maintenance",fs="mmfs1",pool="system",remote_cluster=""} 30
+        gpfs_qos_measurement_interval_seconds{class="misc",fs="mmfs1",pool="nvme1",remote_cluster=""} 30
+        gpfs_qos_measurement_interval_seconds{class="misc",fs="mmfs1",pool="system",remote_cluster=""} 30
+        gpfs_qos_measurement_interval_seconds{class="other",fs="mmfs1",pool="nvme1",remote_cluster=""} 30
+        gpfs_qos_measurement_interval_seconds{class="other",fs="mmfs1",pool="system",remote_cluster=""} 30
 	`
 	collector := NewMmlsqosCollector(log.NewNopLogger())
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
-	} else if val != 28 {
-		t.Errorf("Unexpected collection count %d, expected 28", val)
+	} else if val != 58 {
+		t.Errorf("Unexpected collection count %d, expected 58", val)
 	}
 	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
 		"gpfs_qos_epoch_timestamp_seconds", "gpfs_qos_measurement_interval_seconds",
@@ -326,8 +484,8 @@ func TestMmlsqosCollectorError(t *testing.T) {
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
-	} else if val != 3 {
-		t.Errorf("Unexpected collection count %d, expected 3", val)
+	} else if val != 15 {
+		t.Errorf("Unexpected collection count %d, expected 15", val)
 	}
 	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collect_error"); err != nil {
 		t.Errorf("unexpected collecting result:\n%s", err)
@@ -352,8 +510,8 @@ func TestMmlsqosCollectorTimeout(t *testing.T) {
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
-	} else if val != 3 {
-		t.Errorf("Unexpected collection count %d, expected 3", val)
+	} else if val != 15 {
+		t.Errorf("Unexpected collection count %d, expected 15", val)
 	}
 	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collect_timeout"); err != nil {
 		t.Errorf("unexpected collecting result:\n%s", err)
@@ -378,8 +536,8 @@ func TestMmlsqosCollectorMmlsfsError(t *testing.T) {
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
-	} else if val != 2 {
-		t.Errorf("Unexpected collection count %d, expected 2", val)
+	} else if val != 9 {
+		t.Errorf("Unexpected collection count %d, expected 9", val)
 	}
 	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collect_error"); err != nil {
 		t.Errorf("unexpected collecting result:\n%s", err)
@@ -404,10 +562,27 @@ func TestMmlsqosCollectorMmlsfsTimeout(t *testing.T) {
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
-	} else if val != 2 {
-		t.Errorf("Unexpected collection count %d, expected 2", val)
+	} else if val != 9 {
+		t.Errorf("Unexpected collection count %d, expected 9", val)
 	}
 	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collect_timeout"); err != nil {
 		t.Errorf("unexpected collecting result:\n%s", err)
 	}
 }
+
+func TestParseMmlsqosInsertedColumn(t *testing.T) {
+	expected, err := parse_mmlsqos(mmlsqosStdout, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expected) == 0 {
+		t.Fatal("Expected metrics to be parsed")
+	}
+	got, err := parse_mmlsqos(insertColumn(mmlsqosStdout, 7), log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Unexpected metrics with inserted column\nGot: %v\nExpected: %v", got, expected)
+	}
+}
@@ -14,11 +14,10 @@
 package collectors
 
 import (
-	"bytes"
 	"context"
 	"fmt"
-	"net/url"
 	"reflect"
+	"regexp"
 	"strconv"
 	"strings"
 	"sync"
@@ -34,6 +33,11 @@ var (
 	snapshotFilesystems = kingpin.Flag("collector.mmlssnapshot.filesystems", "Filesystems to query with mmlssnapshot, comma separated. Defaults to all filesystems.").Default("").String()
 	snapshotTimeout     = kingpin.Flag("collector.mmlssnapshot.timeout", "Timeout for mmlssnapshot execution").Default("60").Int()
 	snapshotGetSize     = kingpin.Flag("collector.mmlssnapshot.get-size", "Collect snapshot sizes, long running operation").Default("false").Bool()
+	snapshotAggregate   = kingpin.Flag("collector.mmlssnapshot.aggregate", "Collect snapshot count and age per fileset instead of per snapshot metrics").Default("false").Bool()
+	snapshotInclude     = kingpin.Flag("collector.mmlssnapshot.include", "Regex of snapshot names to collect").Default(".*").String()
+	snapshotExclude     = kingpin.Flag("collector.mmlssnapshot.exclude", "Regex of snapshot names to exclude").Default("^$").String()
+	snapshotMinAge      = kingpin.Flag("collector.mmlssnapshot.min-age", "Only collect snapshots created more than this duration ago").Default("0s").Duration()
+	snapshotRunIf       = runIfFlag("mmlssnapshot")
 	SnapshotKbToBytes   = []string{"data", "metadata"}
 	snapshotMap         = map[string]string{
 		"filesystemName": "FS",
@@ -59,12 +63,27 @@ type SnapshotMetric struct {
 	Metadata float64
 }
 
+type SnapshotAggregateMetric struct {
+	FS      string
+	Fileset string
+	Count   float64
+	Invalid float64
+	Newest  float64
+	Oldest  float64
+}
+
 type MmlssnapshotCollector struct {
-	Status   *prometheus.Desc
-	Created  *prometheus.Desc
-	Data     *prometheus.Desc
-	Metadata *prometheus.Desc
-	logger   log.Logger
+	filesystemOverride
+	Status       *prometheus.Desc
+	Created      *prometheus.Desc
+	Data         *prometheus.Desc
+	Metadata     *prometheus.Desc
+	Count        *prometheus.Desc
+	InvalidCount *prometheus.Desc
+	Newest       *prometheus.Desc
+	Oldest       *prometheus.Desc
+	Filtered     *prometheus.Desc
+	logger       log.Logger
 }
 
 func init() {
@@ -72,23 +91,42 @@ func init() {
 }
 
 func NewMmlssnapshotCollector(logger log.Logger) Collector {
-	labels := []string{"fs", "fileset", "snapshot", "id"}
+	labels := []string{"fs", "remote_cluster", "fileset", "snapshot", "id"}
+	aggregateLabels := []string{"fs", "remote_cluster", "fileset"}
 	return &MmlssnapshotCollector{
-		Status: prometheus.NewDesc(prometheus.BuildFQName(namespace, "snapshot", "status_info"),
+		Status: newDesc(prometheus.BuildFQName(namespace, "snapshot", "status_info"),
 			"GPFS snapshot status", append(labels, []string{"status"}...), nil),
-		Created: prometheus.NewDesc(prometheus.BuildFQName(namespace, "snapshot", "created_timestamp_seconds"),
+		Created: newDesc(prometheus.BuildFQName(namespace, "snapshot", "created_timestamp_seconds"),
 			"GPFS snapshot creation timestamp", labels, nil),
-		Data: prometheus.NewDesc(prometheus.BuildFQName(namespace, "snapshot", "data_size_bytes"),
-			"GPFS snapshot data size", labels, nil),
-		Metadata: prometheus.NewDesc(prometheus.BuildFQName(namespace, "snapshot", "metadata_size_bytes"),
-			"GPFS snapshot metadata size", labels, nil),
+		Data: newDesc(prometheus.BuildFQName(namespace, "snapshot", "data_size_bytes"),
+			"GPFS snapshot data size in bytes", labels, nil),
+		Metadata: newDesc(prometheus.BuildFQName(namespace, "snapshot", "metadata_size_bytes"),
+			"GPFS snapshot metadata size in bytes", labels, nil),
+		Count: newDesc(prometheus.BuildFQName(namespace, "snapshot", "count"),
+			"GPFS count of valid snapshots", aggregateLabels, nil),
+		InvalidCount: newDesc(prometheus.BuildFQName(namespace, "snapshot", "invalid_count"),
+			"GPFS count of snapshots with status other than Valid", aggregateLabels, nil),
+		Newest: newDesc(prometheus.BuildFQName(namespace, "snapshot", "newest_created_timestamp_seconds"),
+			"GPFS newest valid snapshot creation timestamp", aggregateLabels, nil),
+		Oldest: newDesc(prometheus.BuildFQName(namespace, "snapshot", "oldest_created_timestamp_seconds"),
+			"GPFS oldest valid snapshot creation timestamp", aggregateLabels, nil),
+		Filtered: newDesc(prometheus.BuildFQName(namespace, "snapshot", "filtered_count"),
+			"GPFS count of snapshots excluded by the include, exclude and min-age filters", []string{"fs", "remote_cluster"}, nil),
 		logger: logger,
 	}
 }
 
 func (c *MmlssnapshotCollector) Describe(ch chan<- *prometheus.Desc) {
+	if *snapshotAggregate {
+		ch <- c.Count
+		ch <- c.InvalidCount
+		ch <- c.Newest
+		ch <- c.Oldest
+		return
+	}
 	ch <- c.Status
 	ch <- c.Created
+	ch <- c.Filtered
 	if *snapshotGetSize {
 		ch <- c.Data
 		ch <- c.Metadata
@@ -96,27 +134,17 @@ func (c *MmlssnapshotCollector) Describe(ch chan<- *prometheus.Desc) {
 }
 
 func (c *MmlssnapshotCollector) Collect(ch chan<- prometheus.Metric) {
-	wg := &sync.WaitGroup{}
-	var filesystems []string
-	if *snapshotFilesystems == "" {
-		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(*mmlsfsTimeout)*time.Second)
-		defer cancel()
-		var mmlsfsTimeout float64
-		var mmlsfsError float64
-		mmlfsfs_filesystems, err := mmlfsfsFilesystems(ctx, c.logger)
-		if err == context.DeadlineExceeded {
-			mmlsfsTimeout = 1
-			level.Error(c.logger).Log("msg", "Timeout executing mmlsfs")
-		} else if err != nil {
-			mmlsfsError = 1
-			level.Error(c.logger).Log("msg", err)
-		}
-		ch <- prometheus.MustNewConstMetric(collecTimeout, prometheus.GaugeValue, mmlsfsTimeout, "mmlssnapshot-mmlsfs")
-		ch <- prometheus.MustNewConstMetric(collectError, prometheus.GaugeValue, mmlsfsError, "mmlssnapshot-mmlsfs")
-		filesystems = mmlfsfs_filesystems
-	} else {
-		filesystems = strings.Split(*snapshotFilesystems, ",")
+	if run, err := checkRunIf("mmlssnapshot", *snapshotRunIf, ch, c.logger); err != nil {
+		level.Error(c.logger).Log("msg", "Unable to determine manager nodes", "err", err)
+		emitCollectorStatus(ch, "mmlssnapshot", err, time.Now(), 0)
+		return
+	} else if !run {
+		return
 	}
+	include := regexp.MustCompile(*snapshotInclude)
+	exclude := regexp.MustCompile(*snapshotExclude)
+	wg := &sync.WaitGroup{}
+	filesystems := c.getFilesystems(*snapshotFilesystems, "mmlssnapshot", ch, c.logger)
 	for _, fs := range filesystems {
 		level.Debug(c.logger).Log("msg", "Collecting mmlssnapshot metrics", "fs", fs)
 		wg.Add(1)
@@ -124,62 +152,68 @@ func (c *MmlssnapshotCollector) Collect(ch chan<- prometheus.Metric) {
 		go func(fs string) {
 			defer wg.Done()
 			label := fmt.Sprintf("mmlssnapshot-%s", fs)
-			timeout := 0
-			errorMetric := 0
+			fsName, remoteCluster := splitFilesystem(fs)
+			defer recoverCollectorPanic(ch, label, collectTime, c.logger)
 			metrics, err := c.mmlssnapshotCollect(fs)
 			if err == context.DeadlineExceeded {
 				level.Error(c.logger).Log("msg", fmt.Sprintf("Timeout executing %s", label))
-				timeout = 1
 			} else if err != nil {
 				level.Error(c.logger).Log("msg", err, "fs", fs)
-				errorMetric = 1
 			}
-			ch <- prometheus.MustNewConstMetric(collectError, prometheus.GaugeValue, float64(errorMetric), label)
-			ch <- prometheus.MustNewConstMetric(collecTimeout, prometheus.GaugeValue, float64(timeout), label)
-			ch <- prometheus.MustNewConstMetric(collectDuration, prometheus.GaugeValue, time.Since(collectTime).Seconds(), label)
 			if err != nil {
+				emitCollectorStatus(ch, label, err, collectTime, anyRecords)
 				return
 			}
-			for _, m := range metrics {
-				ch <- prometheus.MustNewConstMetric(c.Status, prometheus.GaugeValue, 1, m.FS, m.Fileset, m.Name, m.ID, m.Status)
-				ch <- prometheus.MustNewConstMetric(c.Created, prometheus.GaugeValue, m.Created, m.FS, m.Fileset, m.Name, m.ID)
-				if *snapshotGetSize {
-					ch <- prometheus.MustNewConstMetric(c.Data, prometheus.GaugeValue, m.Data, m.FS, m.Fileset, m.Name, m.ID)
-					ch <- prometheus.MustNewConstMetric(c.Metadata, prometheus.GaugeValue, m.Metadata, m.FS, m.Fileset, m.Name, m.ID)
+			if *snapshotAggregate {
+				for _, m := range aggregate_snapshots(metrics) {
+					ch <- prometheus.MustNewConstMetric(c.Count, prometheus.GaugeValue, m.Count, m.FS, remoteCluster, m.Fileset)
+					ch <- prometheus.MustNewConstMetric(c.InvalidCount, prometheus.GaugeValue, m.Invalid, m.FS, remoteCluster, m.Fileset)
+					if m.Newest != 0 {
+						ch <- prometheus.MustNewConstMetric(c.Newest, prometheus.GaugeValue, m.Newest, m.FS, remoteCluster, m.Fileset)
+						ch <- prometheus.MustNewConstMetric(c.Oldest, prometheus.GaugeValue, m.Oldest, m.FS, remoteCluster, m.Fileset)
+					}
+				}
+			} else {
+				metrics, filtered := filter_snapshots(metrics, include, exclude, *snapshotMinAge, time.Now())
+				ch <- prometheus.MustNewConstMetric(c.Filtered, prometheus.GaugeValue, filtered, fsName, remoteCluster)
+				for _, m := range metrics {
+					ch <- prometheus.MustNewConstMetric(c.Status, prometheus.GaugeValue, 1, m.FS, remoteCluster, m.Fileset, m.Name, m.ID, m.Status)
+					if m.Created != 0 {
+						ch <- prometheus.MustNewConstMetric(c.Created, prometheus.GaugeValue, m.Created, m.FS, remoteCluster, m.Fileset, m.Name, m.ID)
+					}
+					if *snapshotGetSize {
+						ch <- prometheus.MustNewConstMetric(c.Data, prometheus.GaugeValue, m.Data, m.FS, remoteCluster, m.Fileset, m.Name, m.ID)
+						ch <- prometheus.MustNewConstMetric(c.Metadata, prometheus.GaugeValue, m.Metadata, m.FS, remoteCluster, m.Fileset, m.Name, m.ID)
+					}
 				}
 			}
-			ch <- prometheus.MustNewConstMetric(lastExecution, prometheus.GaugeValue, float64(time.Now().Unix()), label)
+			emitCollectorStatus(ch, label, err, collectTime, anyRecords)
 		}(fs)
 	}
 	wg.Wait()
 }
 
 func (c *MmlssnapshotCollector) mmlssnapshotCollect(fs string) ([]SnapshotMetric, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(*snapshotTimeout)*time.Second)
+	ctx, cancel := commandContext("mmlssnapshot", *snapshotTimeout)
 	defer cancel()
-	out, err := MmlssnapshotExec(fs, ctx)
+	out, err := execRetry(ctx, "mmlssnapshot", func() (string, error) {
+		return MmlssnapshotExec(fs, ctx)
+	})
 	if err != nil {
 		return nil, err
 	}
+	commandDump.record(fmt.Sprintf("mmlssnapshot-%s", fs), out)
 	metrics, err := parse_mmlssnapshot(out, c.logger)
+	commandDump.recordParsed(fmt.Sprintf("mmlssnapshot-%s", fs), metrics)
 	return metrics, err
 }
 
 func mmlssnapshot(fs string, ctx context.Context) (string, error) {
-	args := []string{"/usr/lpp/mmfs/bin/mmlssnapshot", fs, "-s", "all", "-Y"}
+	args := []string{fs, "-s", "all", "-Y"}
 	if *snapshotGetSize {
 		args = append(args, "-d")
 	}
-	cmd := execCommand(ctx, *sudoCmd, args...)
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	err := cmd.Run()
-	if ctx.Err() == context.DeadlineExceeded {
-		return "", ctx.Err()
-	} else if err != nil {
-		return "", err
-	}
-	return out.String(), nil
+	return RunMMCommand(ctx, "mmlssnapshot", args...)
 }
 
 func parse_mmlssnapshot(out string, logger log.Logger) ([]SnapshotMetric, error) {
@@ -196,48 +230,107 @@ func parse_mmlssnapshot(out string, logger log.Logger) ([]SnapshotMetric, error)
 		}
 		var values []string
 		if items[2] == "HEADER" {
-			headers = append(headers, items...)
+			headers = items
 			continue
 		} else {
 			values = append(values, items...)
 		}
+		if len(values) < len(headers) {
+			level.Debug(logger).Log("msg", "Skipping truncated snapshot row", "values", len(values), "headers", len(headers), "line", l)
+			parseErrors.WithLabelValues("mmlssnapshot").Inc()
+			continue
+		}
 		var metric SnapshotMetric
+		var rowErr error
 		ps := reflect.ValueOf(&metric) // pointer to struct - addressable
 		s := ps.Elem()                 // struct
 		for i, h := range headers {
 			if field, ok := snapshotMap[h]; ok {
 				f := s.FieldByName(field)
 				if f.Kind() == reflect.String {
-					f.SetString(values[i])
+					f.SetString(DecodeGPFSString(values[i]))
 				} else if f.Kind() == reflect.Float64 {
 					if h == "created" {
-						createdStr, err := url.QueryUnescape(values[i])
+						createdStr := DecodeGPFSString(values[i])
+						createdTime, err := parseGPFSTime(createdStr)
 						if err != nil {
-							level.Error(logger).Log("msg", "Unable to unescape created time", "value", values[i])
-							return nil, err
-						}
-						createdTime, err := time.ParseInLocation(time.ANSIC, createdStr, NowLocation())
-						if err != nil {
-							level.Error(logger).Log("msg", "Unable to parse time", "value", createdStr)
-							return nil, err
+							level.Warn(logger).Log("msg", "Skipping snapshot created time that can not be parsed", "snapshot", metric.Name, "err", err)
+							parseErrors.WithLabelValues("mmlssnapshot").Inc()
+							continue
 						}
 						f.SetFloat(float64(createdTime.Unix()))
 						continue
 					}
 					if val, err := strconv.ParseFloat(values[i], 64); err == nil {
 						if SliceContains(SnapshotKbToBytes, h) {
-							val = val * 1024
+							val = KBToBytes(val)
 						}
 						f.SetFloat(val)
 					} else {
-						level.Error(logger).Log("msg", fmt.Sprintf("Error parsing %s value %s: %s", h, values[i], err.Error()))
-						return nil, err
+						rowErr = fmt.Errorf("Error parsing %s value %s: %w", h, values[i], err)
+						break
 					}
 				}
 			}
 		}
+		if rowErr != nil {
+			level.Warn(logger).Log("msg", "Skipping snapshot with unparsable values", "snapshot", metric.Name, "err", rowErr)
+			parseErrors.WithLabelValues("mmlssnapshot").Inc()
+			continue
+		}
+		metric.FS, _ = splitFilesystem(metric.FS)
 
 		metrics = append(metrics, metric)
 	}
 	return metrics, nil
 }
+
+// filter_snapshots returns the snapshots whose name matches include and not exclude and that
+// were created at least minAge before now, along with the number of snapshots filtered out.
+func filter_snapshots(metrics []SnapshotMetric, include *regexp.Regexp, exclude *regexp.Regexp, minAge time.Duration, now time.Time) ([]SnapshotMetric, float64) {
+	var filtered []SnapshotMetric
+	var count float64
+	for _, m := range metrics {
+		if !include.MatchString(m.Name) || exclude.MatchString(m.Name) {
+			count++
+			continue
+		}
+		if minAge > 0 && m.Created != 0 && now.Sub(time.Unix(int64(m.Created), 0)) < minAge {
+			count++
+			continue
+		}
+		filtered = append(filtered, m)
+	}
+	return filtered, count
+}
+
+func aggregate_snapshots(metrics []SnapshotMetric) []SnapshotAggregateMetric {
+	var aggregates []SnapshotAggregateMetric
+	type filesetKey struct{ FS, Fileset string }
+	index := make(map[filesetKey]int)
+	for _, m := range metrics {
+		key := filesetKey{m.FS, m.Fileset}
+		i, ok := index[key]
+		if !ok {
+			aggregates = append(aggregates, SnapshotAggregateMetric{FS: m.FS, Fileset: m.Fileset})
+			i = len(aggregates) - 1
+			index[key] = i
+		}
+		a := &aggregates[i]
+		if m.Status != "Valid" {
+			a.Invalid++
+			continue
+		}
+		a.Count++
+		if m.Created == 0 {
+			continue
+		}
+		if a.Newest == 0 || m.Created > a.Newest {
+			a.Newest = m.Created
+		}
+		if a.Oldest == 0 || m.Created < a.Oldest {
+			a.Oldest = m.Created
+		}
+	}
+	return aggregates
+}
@@ -17,6 +17,8 @@ import (
 	"context"
 	"fmt"
 	"os/exec"
+	"reflect"
+	"regexp"
 	"strings"
 	"testing"
 	"time"
@@ -31,15 +33,32 @@ var (
 mmlssnapshot::HEADER:version:reserved:reserved:filesystemName:directory:snapID:status:created:quotas:data:metadata:fileset:snapType:
 mmlssnapshot::0:1:::ess:20201115_PAS1736:16337:Valid:Sun Nov 15 02%3A47%3A48 2020::0:0:PAS1736::
 mmlssnapshot::0:1:::ess:20210120:27107:Valid:Wed Jan 20 00%3A30%3A02 2021::0:0:::
+`
+	mmlssnapshotStdoutEncoded = `
+mmlssnapshot::HEADER:version:reserved:reserved:filesystemName:directory:snapID:status:created:quotas:data:metadata:fileset:snapType:
+mmlssnapshot::0:1:::ess:daily%20snap%3A2020-11-15:16337:Valid:Sun Nov 15 02%3A47%3A48 2020::0:0:caf%C3%A9::
 `
 	mmlssnapshotStdoutData = `
 mmlssnapshot::HEADER:version:reserved:reserved:filesystemName:directory:snapID:status:created:quotas:data:metadata:fileset:snapType:
 mmlssnapshot::0:1:::ess:20210120:27107:Valid:Wed Jan 20 00%3A30%3A02 2021::823587352320:529437984:::
 mmlssnapshot::0:1:::ess:20201115_PAS1736:16337:Valid:Sun Nov 15 02%3A47%3A48 2020::0:205184:PAS1736::
+`
+	mmlssnapshotStdoutAggregate = `
+mmlssnapshot::HEADER:version:reserved:reserved:filesystemName:directory:snapID:status:created:quotas:data:metadata:fileset:snapType:
+mmlssnapshot::0:1:::ess:20201115_PAS1736:16337:Valid:Sun Nov 15 02%3A47%3A48 2020::0:0:PAS1736::
+mmlssnapshot::0:1:::ess:20201116_PAS1736:16338:Valid:Mon Nov 16 02%3A47%3A48 2020::0:0:PAS1736::
+mmlssnapshot::0:1:::ess:20201117_PAS1736:16339:DeleteRequired:Tue Nov 17 02%3A47%3A48 2020::0:0:PAS1736::
+mmlssnapshot::0:1:::ess:20210120:27107:Valid:Wed Jan 20 00%3A30%3A02 2021::0:0:::
+mmlssnapshot::0:1:::ess:20210121_PAS0001:27108:Deleting:Thu Jan 21 00%3A30%3A02 2021::0:0:PAS0001::
 `
 	mmlssnapshotStdoutBadTime = `
 mmlssnapshot::HEADER:version:reserved:reserved:filesystemName:directory:snapID:status:created:quotas:data:metadata:fileset:snapType:
 mmlssnapshot::0:1:::ess:20201115_PAS1736:16337:Valid:Sun Nov 15 foo::0:205184:PAS1736::
+`
+	mmlssnapshotStdoutTruncated = `
+mmlssnapshot::HEADER:version:reserved:reserved:filesystemName:directory:snapID:status:created:quotas:data:metadata:fileset:snapType:
+mmlssnapshot::0:1:::ess:20201115_PAS1736:16337:Valid:Sun Nov 15 02%3A47%3A48 2020::0:0:PAS1736::
+mmlssnapshot::0:1:::ess:20210120:27107:Valid:Wed Jan 20 00%3A30%3A02 2021
 `
 	mmlssnapshotStdoutBadValue = `
 mmlssnapshot::HEADER:version:reserved:reserved:filesystemName:directory:snapID:status:created:quotas:data:metadata:fileset:snapType:
@@ -130,17 +149,60 @@ func TestParseMmlssnapshot(t *testing.T) {
 	}
 }
 
-func TestParseMmlssnapshotErrors(t *testing.T) {
-	_, err := parse_mmlssnapshot(mmlssnapshotStdoutBadTime, log.NewNopLogger())
-	if err == nil {
-		t.Errorf("Expected error")
+func TestParseMmlssnapshotEncoded(t *testing.T) {
+	metrics, err := parse_mmlssnapshot(mmlssnapshotStdoutEncoded, log.NewNopLogger())
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
 		return
 	}
-	_, err = parse_mmlssnapshot(mmlssnapshotStdoutBadValue, log.NewNopLogger())
-	if err == nil {
-		t.Errorf("Expected error")
+	if len(metrics) != 1 {
+		t.Errorf("Unexpected number of metrics, got %d", len(metrics))
 		return
 	}
+	if metrics[0].Name != "daily snap:2020-11-15" {
+		t.Errorf("Unexpected value for Name, got %v", metrics[0].Name)
+	}
+	if metrics[0].Fileset != "café" {
+		t.Errorf("Unexpected value for Fileset, got %v", metrics[0].Fileset)
+	}
+	if metrics[0].Created != 1605426468 {
+		t.Errorf("Unexpected value for Created, got %v", metrics[0].Created)
+	}
+}
+
+func TestParseMmlssnapshotErrors(t *testing.T) {
+	for _, out := range []string{mmlssnapshotStdoutBadTime, mmlssnapshotStdoutBadValue} {
+		before := testutil.ToFloat64(parseErrors.WithLabelValues("mmlssnapshot"))
+		metrics, err := parse_mmlssnapshot(out, log.NewNopLogger())
+		if err != nil {
+			t.Errorf("Unexpected error: %s", err.Error())
+			return
+		}
+		if out == mmlssnapshotStdoutBadTime {
+			if len(metrics) != 1 || metrics[0].Created != 0 || metrics[0].Metadata != 210108416 {
+				t.Errorf("Unexpected metrics for bad time: %+v", metrics)
+			}
+		} else if len(metrics) != 0 {
+			t.Errorf("Unexpected number of metrics, got %d", len(metrics))
+		}
+		if val := testutil.ToFloat64(parseErrors.WithLabelValues("mmlssnapshot")) - before; val != 1 {
+			t.Errorf("Unexpected parse errors, got %v", val)
+		}
+	}
+}
+
+func TestParseMmlssnapshotTruncated(t *testing.T) {
+	before := testutil.ToFloat64(parseErrors.WithLabelValues("mmlssnapshot"))
+	metrics, err := parse_mmlssnapshot(mmlssnapshotStdoutTruncated, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if len(metrics) != 1 || metrics[0].Name != "20201115_PAS1736" {
+		t.Errorf("Unexpected metrics for truncated row: %+v", metrics)
+	}
+	if val := testutil.ToFloat64(parseErrors.WithLabelValues("mmlssnapshot")) - before; val != 1 {
+		t.Errorf("Unexpected parse errors, got %v", val)
+	}
 }
 
 func TestMmlssnapshotCollector(t *testing.T) {
@@ -155,19 +217,19 @@ func TestMmlssnapshotCollector(t *testing.T) {
 	expected := `
 		# HELP gpfs_snapshot_created_timestamp_seconds GPFS snapshot creation timestamp
 		# TYPE gpfs_snapshot_created_timestamp_seconds gauge
-		gpfs_snapshot_created_timestamp_seconds{fileset="PAS1736",fs="ess",id="16337",snapshot="20201115_PAS1736"} 1605426468
-		gpfs_snapshot_created_timestamp_seconds{fileset="",fs="ess",id="27107",snapshot="20210120"} 1611120602
+		gpfs_snapshot_created_timestamp_seconds{fileset="PAS1736",fs="ess",id="16337",remote_cluster="",snapshot="20201115_PAS1736"} 1605426468
+		gpfs_snapshot_created_timestamp_seconds{fileset="",fs="ess",id="27107",remote_cluster="",snapshot="20210120"} 1611120602
 		# HELP gpfs_snapshot_status_info GPFS snapshot status
 		# TYPE gpfs_snapshot_status_info gauge
-		gpfs_snapshot_status_info{fileset="PAS1736",fs="ess",id="16337",snapshot="20201115_PAS1736",status="Valid"} 1
-		gpfs_snapshot_status_info{fileset="",fs="ess",id="27107",snapshot="20210120",status="Valid"} 1
+		gpfs_snapshot_status_info{fileset="PAS1736",fs="ess",id="16337",remote_cluster="",snapshot="20201115_PAS1736",status="Valid"} 1
+		gpfs_snapshot_status_info{fileset="",fs="ess",id="27107",remote_cluster="",snapshot="20210120",status="Valid"} 1
 	`
 	collector := NewMmlssnapshotCollector(log.NewNopLogger())
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
-	} else if val != 8 {
-		t.Errorf("Unexpected collection count %d, expected 8", val)
+	} else if val != 20 {
+		t.Errorf("Unexpected collection count %d, expected 20", val)
 	}
 	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
 		"gpfs_snapshot_created_timestamp_seconds", "gpfs_snapshot_status_info",
@@ -188,27 +250,27 @@ func TestMmlssnapshotCollectorData(t *testing.T) {
 	expected := `
 		# HELP gpfs_snapshot_created_timestamp_seconds GPFS snapshot creation timestamp
 		# TYPE gpfs_snapshot_created_timestamp_seconds gauge
-		gpfs_snapshot_created_timestamp_seconds{fileset="PAS1736",fs="ess",id="16337",snapshot="20201115_PAS1736"} 1605426468
-		gpfs_snapshot_created_timestamp_seconds{fileset="",fs="ess",id="27107",snapshot="20210120"} 1611120602
-		# HELP gpfs_snapshot_data_size_bytes GPFS snapshot data size
+		gpfs_snapshot_created_timestamp_seconds{fileset="PAS1736",fs="ess",id="16337",remote_cluster="",snapshot="20201115_PAS1736"} 1605426468
+		gpfs_snapshot_created_timestamp_seconds{fileset="",fs="ess",id="27107",remote_cluster="",snapshot="20210120"} 1611120602
+		# HELP gpfs_snapshot_data_size_bytes GPFS snapshot data size in bytes
 		# TYPE gpfs_snapshot_data_size_bytes gauge
-		gpfs_snapshot_data_size_bytes{fileset="PAS1736",fs="ess",id="16337",snapshot="20201115_PAS1736"} 0
-		gpfs_snapshot_data_size_bytes{fileset="",fs="ess",id="27107",snapshot="20210120"} 843353448775680
-		# HELP gpfs_snapshot_metadata_size_bytes GPFS snapshot metadata size
+		gpfs_snapshot_data_size_bytes{fileset="PAS1736",fs="ess",id="16337",remote_cluster="",snapshot="20201115_PAS1736"} 0
+		gpfs_snapshot_data_size_bytes{fileset="",fs="ess",id="27107",remote_cluster="",snapshot="20210120"} 843353448775680
+		# HELP gpfs_snapshot_metadata_size_bytes GPFS snapshot metadata size in bytes
 		# TYPE gpfs_snapshot_metadata_size_bytes gauge
-		gpfs_snapshot_metadata_size_bytes{fileset="PAS1736",fs="ess",id="16337",snapshot="20201115_PAS1736"} 210108416
-		gpfs_snapshot_metadata_size_bytes{fileset="",fs="ess",id="27107",snapshot="20210120"} 542144495616
+		gpfs_snapshot_metadata_size_bytes{fileset="PAS1736",fs="ess",id="16337",remote_cluster="",snapshot="20201115_PAS1736"} 210108416
+		gpfs_snapshot_metadata_size_bytes{fileset="",fs="ess",id="27107",remote_cluster="",snapshot="20210120"} 542144495616
 		# HELP gpfs_snapshot_status_info GPFS snapshot status
 		# TYPE gpfs_snapshot_status_info gauge
-		gpfs_snapshot_status_info{fileset="PAS1736",fs="ess",id="16337",snapshot="20201115_PAS1736",status="Valid"} 1
-		gpfs_snapshot_status_info{fileset="",fs="ess",id="27107",snapshot="20210120",status="Valid"} 1
+		gpfs_snapshot_status_info{fileset="PAS1736",fs="ess",id="16337",remote_cluster="",snapshot="20201115_PAS1736",status="Valid"} 1
+		gpfs_snapshot_status_info{fileset="",fs="ess",id="27107",remote_cluster="",snapshot="20210120",status="Valid"} 1
 	`
 	collector := NewMmlssnapshotCollector(log.NewNopLogger())
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
-	} else if val != 12 {
-		t.Errorf("Unexpected collection count %d, expected 12", val)
+	} else if val != 24 {
+		t.Errorf("Unexpected collection count %d, expected 24", val)
 	}
 	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
 		"gpfs_snapshot_created_timestamp_seconds", "gpfs_snapshot_status_info",
@@ -217,6 +279,131 @@ func TestMmlssnapshotCollectorData(t *testing.T) {
 	}
 }
 
+func TestAggregateSnapshots(t *testing.T) {
+	metrics, err := parse_mmlssnapshot(mmlssnapshotStdoutAggregate, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	aggregates := aggregate_snapshots(metrics)
+	expected := []SnapshotAggregateMetric{
+		{FS: "ess", Fileset: "PAS1736", Count: 2, Invalid: 1, Newest: 1605512868, Oldest: 1605426468},
+		{FS: "ess", Fileset: "", Count: 1, Invalid: 0, Newest: 1611120602, Oldest: 1611120602},
+		{FS: "ess", Fileset: "PAS0001", Count: 0, Invalid: 1},
+	}
+	if !reflect.DeepEqual(aggregates, expected) {
+		t.Errorf("Unexpected aggregates\nGot: %v\nExpected: %v", aggregates, expected)
+	}
+	aggregates = aggregate_snapshots([]SnapshotMetric{
+		{FS: "a-b", Fileset: "c", Status: "Valid"},
+		{FS: "a", Fileset: "b-c", Status: "Valid"},
+	})
+	if len(aggregates) != 2 {
+		t.Errorf("Unexpected aggregates for filesets with dashes: %v", aggregates)
+	}
+}
+
+func TestFilterSnapshots(t *testing.T) {
+	metrics, err := parse_mmlssnapshot(mmlssnapshotStdoutAggregate, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	now := time.Unix(1605512868+3600, 0)
+	filtered, count := filter_snapshots(metrics, regexp.MustCompile(".*"), regexp.MustCompile("^$"), 0, now)
+	if len(filtered) != 5 || count != 0 {
+		t.Errorf("Unexpected filter result without filters, got %d snapshots and %v filtered", len(filtered), count)
+	}
+	filtered, count = filter_snapshots(metrics, regexp.MustCompile("_PAS1736$"), regexp.MustCompile("^20201117"), 2*time.Hour, now)
+	if len(filtered) != 1 || filtered[0].Name != "20201115_PAS1736" {
+		t.Errorf("Unexpected filtered snapshots %v", filtered)
+	}
+	if count != 4 {
+		t.Errorf("Unexpected filtered count %v, expected 4", count)
+	}
+	if aggregates := aggregate_snapshots(metrics); aggregates[0].Count != 2 || aggregates[0].Invalid != 1 {
+		t.Errorf("Filtering should not change aggregates, got %v", aggregates[0])
+	}
+}
+
+func TestMmlssnapshotCollectorFilter(t *testing.T) {
+	args := []string{"--collector.mmlssnapshot.exclude=^20210120$", "--collector.mmlssnapshot.min-age=24h"}
+	if _, err := kingpin.CommandLine.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		*snapshotExclude = "^$"
+		*snapshotMinAge = 0
+	}()
+	filesystems := "ess"
+	snapshotFilesystems = &filesystems
+	created := strings.NewReplacer(" ", "%20", ":", "%3A").Replace(time.Now().Add(-time.Minute).In(NowLocation()).Format(time.ANSIC))
+	stdout := mmlssnapshotStdout + fmt.Sprintf("mmlssnapshot::0:1:::ess:hourly:27200:Valid:%s::0:0:::\n", created)
+	MmlssnapshotExec = func(fs string, ctx context.Context) (string, error) {
+		return stdout, nil
+	}
+	expected := `
+		# HELP gpfs_snapshot_created_timestamp_seconds GPFS snapshot creation timestamp
+		# TYPE gpfs_snapshot_created_timestamp_seconds gauge
+		gpfs_snapshot_created_timestamp_seconds{fileset="PAS1736",fs="ess",id="16337",remote_cluster="",snapshot="20201115_PAS1736"} 1605426468
+		# HELP gpfs_snapshot_filtered_count GPFS count of snapshots excluded by the include, exclude and min-age filters
+		# TYPE gpfs_snapshot_filtered_count gauge
+		gpfs_snapshot_filtered_count{fs="ess",remote_cluster=""} 2
+	`
+	collector := NewMmlssnapshotCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 18 {
+		t.Errorf("Unexpected collection count %d, expected 18", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
+		"gpfs_snapshot_created_timestamp_seconds", "gpfs_snapshot_filtered_count"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestMmlssnapshotCollectorAggregate(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.mmlssnapshot.aggregate"}); err != nil {
+		t.Fatal(err)
+	}
+	filesystems := "ess"
+	snapshotFilesystems = &filesystems
+	MmlssnapshotExec = func(fs string, ctx context.Context) (string, error) {
+		return mmlssnapshotStdoutAggregate, nil
+	}
+	expected := `
+		# HELP gpfs_snapshot_count GPFS count of valid snapshots
+		# TYPE gpfs_snapshot_count gauge
+		gpfs_snapshot_count{fileset="",fs="ess",remote_cluster=""} 1
+		gpfs_snapshot_count{fileset="PAS0001",fs="ess",remote_cluster=""} 0
+		gpfs_snapshot_count{fileset="PAS1736",fs="ess",remote_cluster=""} 2
+		# HELP gpfs_snapshot_invalid_count GPFS count of snapshots with status other than Valid
+		# TYPE gpfs_snapshot_invalid_count gauge
+		gpfs_snapshot_invalid_count{fileset="",fs="ess",remote_cluster=""} 0
+		gpfs_snapshot_invalid_count{fileset="PAS0001",fs="ess",remote_cluster=""} 1
+		gpfs_snapshot_invalid_count{fileset="PAS1736",fs="ess",remote_cluster=""} 1
+		# HELP gpfs_snapshot_newest_created_timestamp_seconds GPFS newest valid snapshot creation timestamp
+		# TYPE gpfs_snapshot_newest_created_timestamp_seconds gauge
+		gpfs_snapshot_newest_created_timestamp_seconds{fileset="",fs="ess",remote_cluster=""} 1611120602
+		gpfs_snapshot_newest_created_timestamp_seconds{fileset="PAS1736",fs="ess",remote_cluster=""} 1605512868
+		# HELP gpfs_snapshot_oldest_created_timestamp_seconds GPFS oldest valid snapshot creation timestamp
+		# TYPE gpfs_snapshot_oldest_created_timestamp_seconds gauge
+		gpfs_snapshot_oldest_created_timestamp_seconds{fileset="",fs="ess",remote_cluster=""} 1611120602
+		gpfs_snapshot_oldest_created_timestamp_seconds{fileset="PAS1736",fs="ess",remote_cluster=""} 1605426468
+	`
+	collector := NewMmlssnapshotCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 25 {
+		t.Errorf("Unexpected collection count %d, expected 25", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
+		"gpfs_snapshot_count", "gpfs_snapshot_invalid_count", "gpfs_snapshot_newest_created_timestamp_seconds",
+		"gpfs_snapshot_oldest_created_timestamp_seconds", "gpfs_snapshot_created_timestamp_seconds", "gpfs_snapshot_status_info"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
 func TestMmlssnapshotCollectorMmlsfs(t *testing.T) {
 	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
 		t.Fatal(err)
@@ -234,19 +421,19 @@ mmlsfs::0:1:::ess:defaultMountPoint:%2Ffs%ess::
 	expected := `
 		# HELP gpfs_snapshot_created_timestamp_seconds GPFS snapshot creation timestamp
 		# TYPE gpfs_snapshot_created_timestamp_seconds gauge
-		gpfs_snapshot_created_timestamp_seconds{fileset="PAS1736",fs="ess",id="16337",snapshot="20201115_PAS1736"} 1605426468
-		gpfs_snapshot_created_timestamp_seconds{fileset="",fs="ess",id="27107",snapshot="20210120"} 1611120602
+		gpfs_snapshot_created_timestamp_seconds{fileset="PAS1736",fs="ess",id="16337",remote_cluster="",snapshot="20201115_PAS1736"} 1605426468
+		gpfs_snapshot_created_timestamp_seconds{fileset="",fs="ess",id="27107",remote_cluster="",snapshot="20210120"} 1611120602
 		# HELP gpfs_snapshot_status_info GPFS snapshot status
 		# TYPE gpfs_snapshot_status_info gauge
-		gpfs_snapshot_status_info{fileset="PAS1736",fs="ess",id="16337",snapshot="20201115_PAS1736",status="Valid"} 1
-		gpfs_snapshot_status_info{fileset="",fs="ess",id="27107",snapshot="20210120",status="Valid"} 1
+		gpfs_snapshot_status_info{fileset="PAS1736",fs="ess",id="16337",remote_cluster="",snapshot="20201115_PAS1736",status="Valid"} 1
+		gpfs_snapshot_status_info{fileset="",fs="ess",id="27107",remote_cluster="",snapshot="20210120",status="Valid"} 1
 	`
 	collector := NewMmlssnapshotCollector(log.NewNopLogger())
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
-	} else if val != 8 {
-		t.Errorf("Unexpected collection count %d, expected 8", val)
+	} else if val != 20 {
+		t.Errorf("Unexpected collection count %d, expected 20", val)
 	}
 	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
 		"gpfs_snapshot_created_timestamp_seconds", "gpfs_snapshot_status_info",
@@ -273,8 +460,8 @@ func TestMmlssnapshotCollectorError(t *testing.T) {
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
-	} else if val != 3 {
-		t.Errorf("Unexpected collection count %d, expected 3", val)
+	} else if val != 15 {
+		t.Errorf("Unexpected collection count %d, expected 15", val)
 	}
 	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collect_error"); err != nil {
 		t.Errorf("unexpected collecting result:\n%s", err)
@@ -299,8 +486,8 @@ func TestMmlssnapshotCollectorTimeout(t *testing.T) {
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
-	} else if val != 3 {
-		t.Errorf("Unexpected collection count %d, expected 3", val)
+	} else if val != 15 {
+		t.Errorf("Unexpected collection count %d, expected 15", val)
 	}
 	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collect_timeout"); err != nil {
 		t.Errorf("unexpected collecting result:\n%s", err)
@@ -325,8 +512,8 @@ func TestMmlssnapshotCollectorMmlsfsError(t *testing.T) {
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
-	} else if val != 2 {
-		t.Errorf("Unexpected collection count %d, expected 2", val)
+	} else if val != 9 {
+		t.Errorf("Unexpected collection count %d, expected 9", val)
 	}
 	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collect_error"); err != nil {
 		t.Errorf("unexpected collecting result:\n%s", err)
@@ -351,10 +538,27 @@ func TestMmlssnapshotCollectorMmlsfsTimeout(t *testing.T) {
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
-	} else if val != 2 {
-		t.Errorf("Unexpected collection count %d, expected 2", val)
+	} else if val != 9 {
+		t.Errorf("Unexpected collection count %d, expected 9", val)
 	}
 	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collect_timeout"); err != nil {
 		t.Errorf("unexpected collecting result:\n%s", err)
 	}
 }
+
+func TestParseMmlssnapshotInsertedColumn(t *testing.T) {
+	expected, err := parse_mmlssnapshot(mmlssnapshotStdout, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expected) == 0 {
+		t.Fatal("Expected metrics to be parsed")
+	}
+	got, err := parse_mmlssnapshot(insertColumn(mmlssnapshotStdout, 7), log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Unexpected metrics with inserted column\nGot: %v\nExpected: %v", got, expected)
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	mmpdiskTimeout   = kingpin.Flag("collector.mmpdisk.timeout", "Timeout for executing mmvdisk pdisk list").Default("30").Int()
+	mmpdiskOnlyNotOK = kingpin.Flag("collector.mmpdisk.only-not-ok", "Only collect per pdisk metrics for pdisks that are not ok").Default("false").Bool()
+	mmpdiskStates    = []string{"ok", "draining", "missing", "failing", "replace"}
+	MmpdiskExec      = mmpdisk
+)
+
+type PdiskMetric struct {
+	RG        string
+	Name      string
+	States    []string
+	FreeSpace float64
+}
+
+// NotOK returns true if the pdisk has any state other than ok
+func (m PdiskMetric) NotOK() bool {
+	for _, s := range m.States {
+		if s != "ok" {
+			return true
+		}
+	}
+	return len(m.States) == 0
+}
+
+type MmpdiskCollector struct {
+	State     *prometheus.Desc
+	FreeSpace *prometheus.Desc
+	NotOK     *prometheus.Desc
+	logger    log.Logger
+}
+
+func init() {
+	registerCollector("mmpdisk", false, NewMmpdiskCollector)
+}
+
+func NewMmpdiskCollector(logger log.Logger) Collector {
+	return &MmpdiskCollector{
+		State: newDesc(prometheus.BuildFQName(namespace, "pdisk", "state"),
+			"GPFS pdisk state", []string{"rg", "pdisk", "state"}, nil),
+		FreeSpace: newDesc(prometheus.BuildFQName(namespace, "pdisk", "free_space_bytes"),
+			"GPFS pdisk free space in bytes", []string{"rg", "pdisk"}, nil),
+		NotOK: newDesc(prometheus.BuildFQName(namespace, "pdisk", "not_ok_count"),
+			"GPFS number of pdisks in recovery group that are not ok", []string{"rg"}, nil),
+		logger: logger,
+	}
+}
+
+func (c *MmpdiskCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.State
+	ch <- c.FreeSpace
+	ch <- c.NotOK
+}
+
+func (c *MmpdiskCollector) Collect(ch chan<- prometheus.Metric) {
+	level.Debug(c.logger).Log("msg", "Collecting mmpdisk metrics")
+	collectTime := time.Now()
+	metrics, err := c.collect()
+	if err == context.DeadlineExceeded {
+		level.Error(c.logger).Log("msg", "Timeout executing mmvdisk pdisk list")
+	} else if err != nil {
+		level.Error(c.logger).Log("msg", err)
+	}
+	var rgs []string
+	notOK := make(map[string]float64)
+	for _, m := range metrics {
+		if !SliceContains(rgs, m.RG) {
+			rgs = append(rgs, m.RG)
+		}
+		if m.NotOK() {
+			notOK[m.RG]++
+		} else if *mmpdiskOnlyNotOK {
+			continue
+		}
+		for _, s := range mmpdiskStates {
+			var value float64
+			if SliceContains(m.States, s) {
+				value = 1
+			}
+			ch <- prometheus.MustNewConstMetric(c.State, prometheus.GaugeValue, value, m.RG, m.Name, s)
+		}
+		ch <- prometheus.MustNewConstMetric(c.FreeSpace, prometheus.GaugeValue, m.FreeSpace, m.RG, m.Name)
+	}
+	for _, rg := range rgs {
+		ch <- prometheus.MustNewConstMetric(c.NotOK, prometheus.GaugeValue, notOK[rg], rg)
+	}
+	emitCollectorStatus(ch, "mmpdisk", err, collectTime, len(metrics))
+}
+
+func (c *MmpdiskCollector) collect() ([]PdiskMetric, error) {
+	ctx, cancel := commandContext("mmpdisk", *mmpdiskTimeout)
+	defer cancel()
+	out, err := execRetry(ctx, "mmpdisk", func() (string, error) {
+		return MmpdiskExec(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	commandDump.record("mmvdisk-pdisk", out)
+	metrics := parse_mmpdisk(out, c.logger)
+	commandDump.recordParsed("mmvdisk-pdisk", metrics)
+	return metrics, nil
+}
+
+func mmpdisk(ctx context.Context) (string, error) {
+	return RunMMCommand(ctx, "mmvdisk", "pdisk", "list", "--rg", "all", "-Y")
+}
+
+// mmpdisk_states splits a pdisk state such as missing/draining into its individual states
+func mmpdisk_states(state string) []string {
+	return strings.FieldsFunc(strings.ToLower(state), func(r rune) bool {
+		return r == '/' || r == ',' || r == '+' || r == ' '
+	})
+}
+
+func parse_mmpdisk(out string, logger log.Logger) []PdiskMetric {
+	var metrics []PdiskMetric
+	_, rows := mmvdisk_sections(out, "pdisk")
+	for _, row := range rows {
+		var metric PdiskMetric
+		metric.RG = mmvdisk_value(row, "recoveryGroup", "recoveryGroupName", "rgName")
+		metric.Name = mmvdisk_value(row, "pdisk", "pdiskName")
+		if metric.RG == "" || metric.Name == "" {
+			continue
+		}
+		metric.States = mmpdisk_states(mmvdisk_value(row, "state", "pdiskState"))
+		if strings.ToLower(row["replace"]) == "yes" && !SliceContains(metric.States, "replace") {
+			metric.States = append(metric.States, "replace")
+		}
+		if free := mmvdisk_value(row, "freeSpace", "free"); free != "" {
+			if val, err := strconv.ParseFloat(free, 64); err == nil {
+				metric.FreeSpace = val
+			} else {
+				level.Warn(logger).Log("msg", "Unable to parse pdisk free space", "rg", metric.RG, "pdisk", metric.Name, "value", free, "err", err)
+				parseErrors.WithLabelValues("mmpdisk").Inc()
+			}
+		}
+		metrics = append(metrics, metric)
+	}
+	return metrics
+}
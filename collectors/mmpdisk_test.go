@@ -0,0 +1,199 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var (
+	mmpdiskStdout = `
+mmvdisk:pdisk:HEADER:version:reserved:reserved:recoveryGroup:pdisk:priority:location:state:freeSpace:replace:
+mmvdisk:pdisk:0:1:::ess01a:e1s01:5:enclosure 1 slot 1:ok:10737418240:no:
+mmvdisk:pdisk:0:1:::ess01a:e1s02:5:enclosure 1 slot 2:failing/draining:0:no:
+mmvdisk:pdisk:0:1:::ess01b:e1s03:5:enclosure 1 slot 3:ok:10737418240:no:
+mmvdisk:pdisk:0:1:::ess01b:e1s04:5:enclosure 1 slot 4:missing:0:yes:
+`
+)
+
+func TestMmpdisk(t *testing.T) {
+	execCommand = fakeExecCommand
+	mockedExitStatus = 0
+	mockedStdout = "foo"
+	defer func() { execCommand = exec.CommandContext }()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out, err := mmpdisk(ctx)
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+	if out != mockedStdout {
+		t.Errorf("Unexpected out: %s", out)
+	}
+}
+
+func TestParseMmpdisk(t *testing.T) {
+	metrics := parse_mmpdisk(mmpdiskStdout, log.NewNopLogger())
+	expected := []PdiskMetric{
+		{RG: "ess01a", Name: "e1s01", States: []string{"ok"}, FreeSpace: 10737418240},
+		{RG: "ess01a", Name: "e1s02", States: []string{"failing", "draining"}, FreeSpace: 0},
+		{RG: "ess01b", Name: "e1s03", States: []string{"ok"}, FreeSpace: 10737418240},
+		{RG: "ess01b", Name: "e1s04", States: []string{"missing", "replace"}, FreeSpace: 0},
+	}
+	if !reflect.DeepEqual(metrics, expected) {
+		t.Errorf("Unexpected metrics\nGot: %v\nExpected: %v", metrics, expected)
+	}
+}
+
+func TestMmpdiskCollector(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	MmpdiskExec = func(ctx context.Context) (string, error) {
+		return mmpdiskStdout, nil
+	}
+	expected := `
+		# HELP gpfs_pdisk_free_space_bytes GPFS pdisk free space in bytes
+		# TYPE gpfs_pdisk_free_space_bytes gauge
+		gpfs_pdisk_free_space_bytes{pdisk="e1s01",rg="ess01a"} 10737418240
+		gpfs_pdisk_free_space_bytes{pdisk="e1s02",rg="ess01a"} 0
+		gpfs_pdisk_free_space_bytes{pdisk="e1s03",rg="ess01b"} 10737418240
+		gpfs_pdisk_free_space_bytes{pdisk="e1s04",rg="ess01b"} 0
+		# HELP gpfs_pdisk_not_ok_count GPFS number of pdisks in recovery group that are not ok
+		# TYPE gpfs_pdisk_not_ok_count gauge
+		gpfs_pdisk_not_ok_count{rg="ess01a"} 1
+		gpfs_pdisk_not_ok_count{rg="ess01b"} 1
+		# HELP gpfs_pdisk_state GPFS pdisk state
+		# TYPE gpfs_pdisk_state gauge
+		gpfs_pdisk_state{pdisk="e1s01",rg="ess01a",state="draining"} 0
+		gpfs_pdisk_state{pdisk="e1s01",rg="ess01a",state="failing"} 0
+		gpfs_pdisk_state{pdisk="e1s01",rg="ess01a",state="missing"} 0
+		gpfs_pdisk_state{pdisk="e1s01",rg="ess01a",state="ok"} 1
+		gpfs_pdisk_state{pdisk="e1s01",rg="ess01a",state="replace"} 0
+		gpfs_pdisk_state{pdisk="e1s02",rg="ess01a",state="draining"} 1
+		gpfs_pdisk_state{pdisk="e1s02",rg="ess01a",state="failing"} 1
+		gpfs_pdisk_state{pdisk="e1s02",rg="ess01a",state="missing"} 0
+		gpfs_pdisk_state{pdisk="e1s02",rg="ess01a",state="ok"} 0
+		gpfs_pdisk_state{pdisk="e1s02",rg="ess01a",state="replace"} 0
+		gpfs_pdisk_state{pdisk="e1s03",rg="ess01b",state="draining"} 0
+		gpfs_pdisk_state{pdisk="e1s03",rg="ess01b",state="failing"} 0
+		gpfs_pdisk_state{pdisk="e1s03",rg="ess01b",state="missing"} 0
+		gpfs_pdisk_state{pdisk="e1s03",rg="ess01b",state="ok"} 1
+		gpfs_pdisk_state{pdisk="e1s03",rg="ess01b",state="replace"} 0
+		gpfs_pdisk_state{pdisk="e1s04",rg="ess01b",state="draining"} 0
+		gpfs_pdisk_state{pdisk="e1s04",rg="ess01b",state="failing"} 0
+		gpfs_pdisk_state{pdisk="e1s04",rg="ess01b",state="missing"} 1
+		gpfs_pdisk_state{pdisk="e1s04",rg="ess01b",state="ok"} 0
+		gpfs_pdisk_state{pdisk="e1s04",rg="ess01b",state="replace"} 1
+	`
+	collector := NewMmpdiskCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 38 {
+		t.Errorf("Unexpected collection count %d, expected 38", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
+		"gpfs_pdisk_free_space_bytes", "gpfs_pdisk_not_ok_count", "gpfs_pdisk_state"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestMmpdiskCollectorOnlyNotOK(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.mmpdisk.only-not-ok"}); err != nil {
+		t.Fatal(err)
+	}
+	MmpdiskExec = func(ctx context.Context) (string, error) {
+		return mmpdiskStdout, nil
+	}
+	expected := `
+		# HELP gpfs_pdisk_free_space_bytes GPFS pdisk free space in bytes
+		# TYPE gpfs_pdisk_free_space_bytes gauge
+		gpfs_pdisk_free_space_bytes{pdisk="e1s02",rg="ess01a"} 0
+		gpfs_pdisk_free_space_bytes{pdisk="e1s04",rg="ess01b"} 0
+		# HELP gpfs_pdisk_not_ok_count GPFS number of pdisks in recovery group that are not ok
+		# TYPE gpfs_pdisk_not_ok_count gauge
+		gpfs_pdisk_not_ok_count{rg="ess01a"} 1
+		gpfs_pdisk_not_ok_count{rg="ess01b"} 1
+	`
+	collector := NewMmpdiskCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 26 {
+		t.Errorf("Unexpected collection count %d, expected 26", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
+		"gpfs_pdisk_free_space_bytes", "gpfs_pdisk_not_ok_count"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestMmpdiskCollectorError(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	MmpdiskExec = func(ctx context.Context) (string, error) {
+		return "", fmt.Errorf("Error")
+	}
+	expected := `
+		# HELP gpfs_exporter_collect_error Indicates if error has occurred during collection
+		# TYPE gpfs_exporter_collect_error gauge
+		gpfs_exporter_collect_error{collector="mmpdisk"} 1
+	`
+	collector := NewMmpdiskCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 12 {
+		t.Errorf("Unexpected collection count %d, expected 12", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collect_error"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestMmpdiskCollectorTimeout(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	MmpdiskExec = func(ctx context.Context) (string, error) {
+		return "", context.DeadlineExceeded
+	}
+	expected := `
+		# HELP gpfs_exporter_collect_timeout Indicates the collector timed out
+		# TYPE gpfs_exporter_collect_timeout gauge
+		gpfs_exporter_collect_timeout{collector="mmpdisk"} 1
+	`
+	collector := NewMmpdiskCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 12 {
+		t.Errorf("Unexpected collection count %d, expected 12", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collect_timeout"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
@@ -14,7 +14,6 @@
 package collectors
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"reflect"
@@ -29,8 +28,10 @@ import (
 )
 
 var (
-	mmpmonTimeout = kingpin.Flag("collector.mmpmon.timeout", "Timeout for mmpmon execution").Default("5").Int()
-	mmpmonMap     = map[string]string{
+	mmpmonTimeout           = kingpin.Flag("collector.mmpmon.timeout", "Timeout for mmpmon execution").Default("5").Int()
+	mmpmonRequests          = kingpin.Flag("collector.mmpmon.requests", "Comma separated list of mmpmon requests to run, supported requests are fs_io_s and io_s").Default("fs_io_s").String()
+	mmpmonSupportedRequests = []string{"fs_io_s", "io_s"}
+	mmpmonMap               = map[string]string{
 		"_fs_":  "FS",
 		"_nn_":  "NodeName",
 		"_br_":  "ReadBytes",
@@ -46,6 +47,7 @@ var (
 )
 
 type PerfMetrics struct {
+	Request      string
 	FS           string
 	NodeName     string
 	ReadBytes    int64
@@ -59,11 +61,14 @@ type PerfMetrics struct {
 }
 
 type MmpmonCollector struct {
-	read_bytes  *prometheus.Desc
-	write_bytes *prometheus.Desc
-	operations  *prometheus.Desc
-	info        *prometheus.Desc
-	logger      log.Logger
+	read_bytes        *prometheus.Desc
+	write_bytes       *prometheus.Desc
+	operations        *prometheus.Desc
+	info              *prometheus.Desc
+	total_read_bytes  *prometheus.Desc
+	total_write_bytes *prometheus.Desc
+	total_operations  *prometheus.Desc
+	logger            log.Logger
 }
 
 func init() {
@@ -72,14 +77,20 @@ func init() {
 
 func NewMmpmonCollector(logger log.Logger) Collector {
 	return &MmpmonCollector{
-		read_bytes: prometheus.NewDesc(prometheus.BuildFQName(namespace, "perf", "read_bytes_total"),
+		read_bytes: newDesc(prometheus.BuildFQName(namespace, "perf", "read_bytes_total"),
 			"GPFS read bytes", []string{"fs"}, nil),
-		write_bytes: prometheus.NewDesc(prometheus.BuildFQName(namespace, "perf", "write_bytes_total"),
+		write_bytes: newDesc(prometheus.BuildFQName(namespace, "perf", "write_bytes_total"),
 			"GPFS write bytes", []string{"fs"}, nil),
-		operations: prometheus.NewDesc(prometheus.BuildFQName(namespace, "perf", "operations_total"),
+		operations: newDesc(prometheus.BuildFQName(namespace, "perf", "operations_total"),
 			"GPFS operationgs reported by mmpmon", []string{"fs", "operation"}, nil),
-		info: prometheus.NewDesc(prometheus.BuildFQName(namespace, "perf", "info"),
+		info: newDesc(prometheus.BuildFQName(namespace, "perf", "info"),
 			"GPFS client information", []string{"fs", "nodename"}, nil),
+		total_read_bytes: newDesc(prometheus.BuildFQName(namespace, "perf", "total_read_bytes_total"),
+			"GPFS read bytes for all filesystems", nil, nil),
+		total_write_bytes: newDesc(prometheus.BuildFQName(namespace, "perf", "total_write_bytes_total"),
+			"GPFS write bytes for all filesystems", nil, nil),
+		total_operations: newDesc(prometheus.BuildFQName(namespace, "perf", "total_operations_total"),
+			"GPFS operations for all filesystems reported by mmpmon", []string{"operation"}, nil),
 		logger: logger,
 	}
 }
@@ -89,22 +100,32 @@ func (c *MmpmonCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- c.write_bytes
 	ch <- c.operations
 	ch <- c.info
+	ch <- c.total_read_bytes
+	ch <- c.total_write_bytes
+	ch <- c.total_operations
 }
 
 func (c *MmpmonCollector) Collect(ch chan<- prometheus.Metric) {
 	level.Debug(c.logger).Log("msg", "Collecting mmpmon metrics")
 	collectTime := time.Now()
-	timeout := 0
-	errorMetric := 0
 	perfs, err := c.collect()
 	if err == context.DeadlineExceeded {
-		timeout = 1
 		level.Error(c.logger).Log("msg", "Timeout executing mmpmon")
 	} else if err != nil {
 		level.Error(c.logger).Log("msg", err)
-		errorMetric = 1
 	}
 	for _, perf := range perfs {
+		if perf.Request == "io_s" {
+			ch <- prometheus.MustNewConstMetric(c.total_read_bytes, prometheus.CounterValue, float64(perf.ReadBytes))
+			ch <- prometheus.MustNewConstMetric(c.total_write_bytes, prometheus.CounterValue, float64(perf.WriteBytes))
+			ch <- prometheus.MustNewConstMetric(c.total_operations, prometheus.CounterValue, float64(perf.Reads), "reads")
+			ch <- prometheus.MustNewConstMetric(c.total_operations, prometheus.CounterValue, float64(perf.Writes), "writes")
+			ch <- prometheus.MustNewConstMetric(c.total_operations, prometheus.CounterValue, float64(perf.Opens), "opens")
+			ch <- prometheus.MustNewConstMetric(c.total_operations, prometheus.CounterValue, float64(perf.Closes), "closes")
+			ch <- prometheus.MustNewConstMetric(c.total_operations, prometheus.CounterValue, float64(perf.ReadDir), "read_dir")
+			ch <- prometheus.MustNewConstMetric(c.total_operations, prometheus.CounterValue, float64(perf.InodeUpdates), "inode_updates")
+			continue
+		}
 		ch <- prometheus.MustNewConstMetric(c.read_bytes, prometheus.CounterValue, float64(perf.ReadBytes), perf.FS)
 		ch <- prometheus.MustNewConstMetric(c.write_bytes, prometheus.CounterValue, float64(perf.WriteBytes), perf.FS)
 		ch <- prometheus.MustNewConstMetric(c.operations, prometheus.CounterValue, float64(perf.Reads), perf.FS, "reads")
@@ -115,34 +136,58 @@ func (c *MmpmonCollector) Collect(ch chan<- prometheus.Metric) {
 		ch <- prometheus.MustNewConstMetric(c.operations, prometheus.CounterValue, float64(perf.InodeUpdates), perf.FS, "inode_updates")
 		ch <- prometheus.MustNewConstMetric(c.info, prometheus.GaugeValue, 1, perf.FS, perf.NodeName)
 	}
-	ch <- prometheus.MustNewConstMetric(collectError, prometheus.GaugeValue, float64(errorMetric), "mmpmon")
-	ch <- prometheus.MustNewConstMetric(collecTimeout, prometheus.GaugeValue, float64(timeout), "mmpmon")
-	ch <- prometheus.MustNewConstMetric(collectDuration, prometheus.GaugeValue, time.Since(collectTime).Seconds(), "mmpmon")
+	emitCollectorStatus(ch, "mmpmon", err, collectTime, len(perfs))
 }
 
 func (c *MmpmonCollector) collect() ([]PerfMetrics, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(*mmpmonTimeout)*time.Second)
+	ctx, cancel := commandContext("mmpmon", *mmpmonTimeout)
 	defer cancel()
-	mmpmon_out, err := MmpmonExec(ctx)
+	mmpmon_out, err := execRetry(ctx, "mmpmon", func() (string, error) {
+		return MmpmonExec(ctx)
+	})
 	if err != nil {
 		return nil, err
 	}
+	commandDump.record("mmpmon", mmpmon_out)
 	perfs := mmpmon_parse(mmpmon_out, c.logger)
+	commandDump.recordParsed("mmpmon", perfs)
 	return perfs, nil
 }
 
+// ValidateMmpmonRequests returns an error if --collector.mmpmon.requests has a request that can not be parsed
+func ValidateMmpmonRequests() error {
+	if _, unsupported := mmpmonRequestList(); len(unsupported) > 0 {
+		return fmt.Errorf("Unsupported mmpmon request %s for --collector.mmpmon.requests, supported requests are %s",
+			strings.Join(unsupported, ","), strings.Join(mmpmonSupportedRequests, ","))
+	}
+	return nil
+}
+
+// mmpmonRequestList splits the configured mmpmon requests into those that can be parsed and those that can not
+func mmpmonRequestList() ([]string, []string) {
+	var supported []string
+	var unsupported []string
+	for _, r := range strings.Split(*mmpmonRequests, ",") {
+		r = strings.TrimSpace(r)
+		if r == "" {
+			continue
+		}
+		if SliceContains(mmpmonSupportedRequests, r) {
+			supported = append(supported, r)
+		} else {
+			unsupported = append(unsupported, r)
+		}
+	}
+	return supported, unsupported
+}
+
 func mmpmon(ctx context.Context) (string, error) {
-	cmd := execCommand(ctx, *sudoCmd, "/usr/lpp/mmfs/bin/mmpmon", "-s", "-p")
-	cmd.Stdin = strings.NewReader("fs_io_s\n")
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	err := cmd.Run()
-	if ctx.Err() == context.DeadlineExceeded {
-		return "", ctx.Err()
-	} else if err != nil {
-		return "", err
+	var stdin strings.Builder
+	requests, _ := mmpmonRequestList()
+	for _, r := range requests {
+		stdin.WriteString(r + "\n")
 	}
-	return out.String(), nil
+	return runMMCommand(ctx, strings.NewReader(stdin.String()), "mmpmon", "-s", "-p")
 }
 
 func mmpmon_parse(out string, logger log.Logger) []PerfMetrics {
@@ -155,6 +200,11 @@ func mmpmon_parse(out string, logger log.Logger) []PerfMetrics {
 		var headers []string
 		var values []string
 		items := strings.Split(l, " ")
+		request := strings.Trim(items[0], "_")
+		if !SliceContains(mmpmonSupportedRequests, request) {
+			level.Debug(logger).Log("msg", "Skipping unsupported mmpmon response", "request", request)
+			continue
+		}
 		for _, i := range items[1:] {
 			if strings.HasPrefix(i, "_") {
 				headers = append(headers, i)
@@ -162,7 +212,11 @@ func mmpmon_parse(out string, logger log.Logger) []PerfMetrics {
 				values = append(values, i)
 			}
 		}
-		var perf PerfMetrics
+		if i := SliceIndex(headers, "_rc_"); i != -1 && i < len(values) && values[i] != "0" {
+			level.Warn(logger).Log("msg", "mmpmon request failed", "request", request, "rc", values[i])
+			continue
+		}
+		perf := PerfMetrics{Request: request}
 		ps := reflect.ValueOf(&perf) // pointer to struct - addressable
 		s := ps.Elem()               // struct
 		for i, h := range headers {
@@ -30,6 +30,15 @@ var (
 	mmpmonStdout = `
 _fs_io_s_ _n_ 10.22.0.106 _nn_ ib-pitzer-rw02.ten _rc_ 0 _t_ 1579358234 _tu_ 53212 _cl_ gpfs.domain _fs_ scratch _d_ 48 _br_ 205607400434 _bw_ 74839282351 _oc_ 2377656 _cc_ 2201576 _rdc_ 59420404 _wc_ 18874626 _dir_ 40971 _iu_ 544768
 _fs_io_s_ _n_ 10.22.0.106 _nn_ ib-pitzer-rw02.ten _rc_ 0 _t_ 1579358234 _tu_ 53212 _cl_ gpfs.domain _fs_ project _d_ 96 _br_ 0 _bw_ 0 _oc_ 513 _cc_ 513 _rdc_ 0 _wc_ 0 _dir_ 0 _iu_ 169
+`
+	mmpmonStdoutRequests = `
+_fs_io_s_ _n_ 10.22.0.106 _nn_ ib-pitzer-rw02.ten _rc_ 0 _t_ 1579358234 _tu_ 53212 _cl_ gpfs.domain _fs_ scratch _d_ 48 _br_ 205607400434 _bw_ 74839282351 _oc_ 2377656 _cc_ 2201576 _rdc_ 59420404 _wc_ 18874626 _dir_ 40971 _iu_ 544768
+_io_s_ _n_ 10.22.0.106 _nn_ ib-pitzer-rw02.ten _rc_ 0 _t_ 1579358234 _tu_ 53212 _br_ 205607400434 _bw_ 74839282351 _oc_ 2378169 _cc_ 2202089 _rdc_ 59420404 _wc_ 18874626 _dir_ 40971 _iu_ 544937
+_nsd_ds_ _n_ 10.22.0.106 _nn_ ib-pitzer-rw02.ten _rc_ 0 _t_ 1579358234 _tu_ 53212
+`
+	mmpmonStdoutFailed = `
+_fs_io_s_ _n_ 10.22.0.106 _nn_ ib-pitzer-rw02.ten _rc_ 0 _t_ 1579358234 _tu_ 53212 _cl_ gpfs.domain _fs_ scratch _d_ 48 _br_ 205607400434 _bw_ 74839282351 _oc_ 2377656 _cc_ 2201576 _rdc_ 59420404 _wc_ 18874626 _dir_ 40971 _iu_ 544768
+_io_s_ _n_ 10.22.0.106 _nn_ ib-pitzer-rw02.ten _rc_ 1 _t_ 1579358234 _tu_ 53212
 `
 )
 
@@ -104,6 +113,91 @@ func TestParsePerf(t *testing.T) {
 	}
 }
 
+func TestParsePerfRequests(t *testing.T) {
+	perfs := mmpmon_parse(mmpmonStdoutRequests, log.NewNopLogger())
+	if len(perfs) != 2 {
+		t.Errorf("Expected 2 perfs returned, got %d", len(perfs))
+		return
+	}
+	if val := perfs[0].Request; val != "fs_io_s" {
+		t.Errorf("Unexpected Request got %s", val)
+	}
+	if val := perfs[1].Request; val != "io_s" {
+		t.Errorf("Unexpected Request got %s", val)
+	}
+	if val := perfs[1].Opens; val != 2378169 {
+		t.Errorf("Unexpected Opens got %d", val)
+	}
+	perfs = mmpmon_parse(mmpmonStdoutFailed, log.NewNopLogger())
+	if len(perfs) != 1 {
+		t.Errorf("Expected 1 perfs returned, got %d", len(perfs))
+	}
+}
+
+func TestMmpmonRequestList(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.mmpmon.requests=fs_io_s, io_s,nsd_ds"}); err != nil {
+		t.Fatal(err)
+	}
+	supported, unsupported := mmpmonRequestList()
+	if strings.Join(supported, ",") != "fs_io_s,io_s" {
+		t.Errorf("Unexpected supported requests: %v", supported)
+	}
+	if strings.Join(unsupported, ",") != "nsd_ds" {
+		t.Errorf("Unexpected unsupported requests: %v", unsupported)
+	}
+}
+
+func TestValidateMmpmonRequests(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.mmpmon.requests=fs_io_s,io_s"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateMmpmonRequests(); err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.mmpmon.requests=fs_io_s,nsd_ds"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateMmpmonRequests(); err == nil {
+		t.Errorf("Expected error for nsd_ds request")
+	}
+}
+
+func TestMmpmonCollectorRequests(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.mmpmon.requests=fs_io_s,io_s"}); err != nil {
+		t.Fatal(err)
+	}
+	MmpmonExec = func(ctx context.Context) (string, error) {
+		return mmpmonStdoutRequests, nil
+	}
+	expected := `
+		# HELP gpfs_perf_total_operations_total GPFS operations for all filesystems reported by mmpmon
+		# TYPE gpfs_perf_total_operations_total counter
+		gpfs_perf_total_operations_total{operation="closes"} 2202089
+		gpfs_perf_total_operations_total{operation="inode_updates"} 544937
+		gpfs_perf_total_operations_total{operation="opens"} 2378169
+		gpfs_perf_total_operations_total{operation="read_dir"} 40971
+		gpfs_perf_total_operations_total{operation="reads"} 59420404
+		gpfs_perf_total_operations_total{operation="writes"} 18874626
+		# HELP gpfs_perf_total_read_bytes_total GPFS read bytes for all filesystems
+		# TYPE gpfs_perf_total_read_bytes_total counter
+		gpfs_perf_total_read_bytes_total 2.05607400434e+11
+		# HELP gpfs_perf_total_write_bytes_total GPFS write bytes for all filesystems
+		# TYPE gpfs_perf_total_write_bytes_total counter
+		gpfs_perf_total_write_bytes_total 74839282351
+	`
+	collector := NewMmpmonCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 29 {
+		t.Errorf("Unexpected collection count %d, expected 29", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
+		"gpfs_perf_total_read_bytes_total", "gpfs_perf_total_write_bytes_total", "gpfs_perf_total_operations_total"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
 func TestMmpmonCollector(t *testing.T) {
 	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
 		t.Fatal(err)
@@ -143,8 +237,8 @@ func TestMmpmonCollector(t *testing.T) {
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
-	} else if val != 21 {
-		t.Errorf("Unexpected collection count %d, expected 21", val)
+	} else if val != 30 {
+		t.Errorf("Unexpected collection count %d, expected 30", val)
 	}
 	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
 		"gpfs_perf_info",
@@ -169,8 +263,8 @@ func TestMMpmonCollectorError(t *testing.T) {
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
-	} else if val != 3 {
-		t.Errorf("Unexpected collection count %d, expected 3", val)
+	} else if val != 12 {
+		t.Errorf("Unexpected collection count %d, expected 12", val)
 	}
 	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collect_error"); err != nil {
 		t.Errorf("unexpected collecting result:\n%s", err)
@@ -193,8 +287,8 @@ func TestMMpmonCollectorTimeout(t *testing.T) {
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
-	} else if val != 3 {
-		t.Errorf("Unexpected collection count %d, expected 3", val)
+	} else if val != 12 {
+		t.Errorf("Unexpected collection count %d, expected 12", val)
 	}
 	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collect_timeout"); err != nil {
 		t.Errorf("unexpected collecting result:\n%s", err)
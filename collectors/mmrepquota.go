@@ -14,8 +14,8 @@
 package collectors
 
 import (
-	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"reflect"
 	"strconv"
@@ -31,10 +31,20 @@ import (
 var (
 	configMmrepquotaFilesystems = kingpin.Flag("collector.mmrepquota.filesystems", "Filesystems to query with mmrepquota, comma separated. Defaults to all filesystems.").Default("").String()
 	configMmrepquotaTypes       = kingpin.Flag("collector.mmrepquota.quota-types", "Quota Types to query with mmrepquota, Default to fileset only").Default("fileset").String()
+	configMmrepquotaFilesets    = kingpin.Flag("collector.mmrepquota.filesets", "Filesets to query with mmrepquota as filesystem:fileset, comma separated. Overrides filesystems when set.").Default("").String()
+	mmrepquotaUsers             = kingpin.Flag("collector.mmrepquota.users", "Only collect user quotas for these user names, comma separated. Defaults to all users.").Default("").String()
+	mmrepquotaGroups            = kingpin.Flag("collector.mmrepquota.groups", "Only collect group quotas for these group names, comma separated. Defaults to all groups.").Default("").String()
+	mmrepquotaIncludeID         = kingpin.Flag("collector.mmrepquota.include-id", "Include the numeric id of the quota entity as the id label").Default("false").Bool()
 	mmrepquotaTimeout           = kingpin.Flag("collector.mmrepquota.timeout", "Timeout for mmrepquota execution").Default("20").Int()
+	mmrepquotaRunIf             = runIfFlag("mmrepquota")
+	mmrepquotaMinBlockUsage     = kingpin.Flag("collector.mmrepquota.min-block-usage", "Skip quota records using fewer bytes than this that also have no quota and are below min-files-usage").Default("0").Int64()
+	mmrepquotaMinFilesUsage     = kingpin.Flag("collector.mmrepquota.min-files-usage", "Skip quota records using fewer files than this that also have no quota and are below min-block-usage").Default("0").Int64()
+	mmrepquotaDefaults          = kingpin.Flag("collector.mmrepquota.defaults", "Collect the default fileset quotas of each filesystem with 'mmlsquota -d -j'").Default("false").Bool()
+	mmrepquotaIncludeDefaults   = kingpin.Flag("collector.mmrepquota.include-defaults", "Collect default quota rows of mmrepquota as gpfs_<type>_default_* metrics instead of skipping them").Default("false").Bool()
 	quotaMap                    = map[string]string{
 		"name":           "Name",
 		"filesystemName": "FS",
+		"id":             "ID",
 		"quotaType":      "QuotaType",
 		"blockUsage":     "BlockUsage",
 		"blockQuota":     "BlockQuota",
@@ -45,17 +55,65 @@ var (
 		"filesLimit":     "FilesLimit",
 		"filesInDoubt":   "FilesInDoubt",
 		"filesetname":    "FilesetName",
+		"remarks":        "Remarks",
+		"quota":          "Quota",
+		"defQuota":       "DefQuota",
 	}
 	quotaTypeMap = map[string]rune{
 		"user":    'u',
 		"group":   'g',
 		"fileset": 'j',
 	}
-	mmrepquotaExec = mmrepquota
+	quotaTypeNames = map[string]string{
+		"USR":     "user",
+		"GRP":     "group",
+		"FILESET": "fileset",
+	}
+	quotaRecordsSkipped = newCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "quota",
+		Name:      "records_skipped_total",
+		Help:      "Number of mmrepquota records skipped for being below the minimum usage thresholds",
+	}, []string{"type"})
+	// quotaDefaultMetrics are reported for default quota rows. The quotas use a default_entry_ prefix
+	// as gpfs_fileset_default_quota_bytes is reported by collector.mmrepquota.defaults.
+	quotaDefaultMetrics = []struct {
+		name  string
+		help  string
+		value func(QuotaMetric) float64
+	}{
+		{"default_used_bytes", "default quota entry used in bytes", func(m QuotaMetric) float64 { return m.BlockUsage }},
+		{"default_entry_quota_bytes", "default quota entry block quota in bytes", func(m QuotaMetric) float64 { return m.BlockQuota }},
+		{"default_limit_bytes", "default quota entry block limit in bytes", func(m QuotaMetric) float64 { return m.BlockLimit }},
+		{"default_in_doubt_bytes", "default quota entry block in doubt in bytes", func(m QuotaMetric) float64 { return m.BlockInDoubt }},
+		{"default_used_files", "default quota entry files used", func(m QuotaMetric) float64 { return m.FilesUsage }},
+		{"default_entry_quota_files", "default quota entry files quota", func(m QuotaMetric) float64 { return m.FilesQuota }},
+		{"default_limit_files", "default quota entry files limit", func(m QuotaMetric) float64 { return m.FilesLimit }},
+		{"default_in_doubt_files", "default quota entry files in doubt", func(m QuotaMetric) float64 { return m.FilesInDoubt }},
+	}
+	mmrepquotaExec        = mmrepquota
+	mmlsquotaDefaultsExec = mmlsquotaDefaults
 )
 
+// QuotaDefault is the default fileset quota of a filesystem
+type QuotaDefault struct {
+	FS         string
+	BlockQuota float64
+	FilesQuota float64
+}
+
+// QuotaMissing is a user or group listed by the users or groups flags and whether it has no
+// quota record on a filesystem that reported quotas of that type
+type QuotaMissing struct {
+	QuotaType string
+	Name      string
+	FS        string
+	Missing   float64
+}
+
 type QuotaMetric struct {
 	Name         string
+	ID           string
 	FS           string
 	QuotaType    string
 	BlockUsage   float64
@@ -67,6 +125,9 @@ type QuotaMetric struct {
 	FilesLimit   float64
 	FilesInDoubt float64
 	FilesetName  string
+	Remarks      string
+	Quota        string
+	DefQuota     string
 }
 
 type MmrepquotaCollector struct {
@@ -78,6 +139,13 @@ type MmrepquotaCollector struct {
 	FilesetFilesQuota   *prometheus.Desc
 	FilesetFilesLimit   *prometheus.Desc
 	FilesetFilesInDoubt *prometheus.Desc
+	FilesetBlockRatio   *prometheus.Desc
+	FilesetFilesRatio   *prometheus.Desc
+	FilesetDefaultQuota *prometheus.Desc
+	FilesetEnforced     *prometheus.Desc
+
+	FilesetDefaultBlockQuota *prometheus.Desc
+	FilesetDefaultFilesQuota *prometheus.Desc
 
 	UserBlockUsage   *prometheus.Desc
 	UserBlockQuota   *prometheus.Desc
@@ -87,6 +155,9 @@ type MmrepquotaCollector struct {
 	UserFilesQuota   *prometheus.Desc
 	UserFilesLimit   *prometheus.Desc
 	UserFilesInDoubt *prometheus.Desc
+	UserBlockRatio   *prometheus.Desc
+	UserFilesRatio   *prometheus.Desc
+	UserEnforced     *prometheus.Desc
 
 	GroupBlockUsage   *prometheus.Desc
 	GroupBlockQuota   *prometheus.Desc
@@ -96,6 +167,15 @@ type MmrepquotaCollector struct {
 	GroupFilesQuota   *prometheus.Desc
 	GroupFilesLimit   *prometheus.Desc
 	GroupFilesInDoubt *prometheus.Desc
+	GroupBlockRatio   *prometheus.Desc
+	GroupFilesRatio   *prometheus.Desc
+	GroupEnforced     *prometheus.Desc
+
+	UserQuotaMissing  *prometheus.Desc
+	GroupQuotaMissing *prometheus.Desc
+
+	// DefaultRows are the descs of quotaDefaultMetrics for each quota type
+	DefaultRows map[string][]*prometheus.Desc
 
 	logger log.Logger
 }
@@ -113,57 +193,101 @@ func NewMmrepquotaCollector(logger log.Logger) Collector {
 	fileset_labels := []string{"fileset", "fs"}
 	user_labels := []string{"user", "fs", "fileset"}
 	group_labels := []string{"group", "fs", "fileset"}
+	if *mmrepquotaIncludeID {
+		fileset_labels = append(fileset_labels, "id")
+		user_labels = append(user_labels, "id")
+		group_labels = append(group_labels, "id")
+	}
+	defaultRows := make(map[string][]*prometheus.Desc)
+	for quotaType, labels := range map[string][]string{"FILESET": fileset_labels, "USR": user_labels, "GRP": group_labels} {
+		for _, d := range quotaDefaultMetrics {
+			defaultRows[quotaType] = append(defaultRows[quotaType], newDesc(prometheus.BuildFQName(namespace, quotaTypeNames[quotaType], d.name),
+				fmt.Sprintf("GPFS %s %s", quotaTypeNames[quotaType], d.help), labels, nil))
+		}
+	}
 	return &MmrepquotaCollector{
-		FilesetBlockUsage: prometheus.NewDesc(prometheus.BuildFQName(namespace, "fileset", "used_bytes"),
-			"GPFS fileset quota used", fileset_labels, nil),
-		FilesetBlockQuota: prometheus.NewDesc(prometheus.BuildFQName(namespace, "fileset", "quota_bytes"),
-			"GPFS fileset block quota", fileset_labels, nil),
-		FilesetBlockLimit: prometheus.NewDesc(prometheus.BuildFQName(namespace, "fileset", "limit_bytes"),
-			"GPFS fileset quota block limit", fileset_labels, nil),
-		FilesetBlockInDoubt: prometheus.NewDesc(prometheus.BuildFQName(namespace, "fileset", "in_doubt_bytes"),
-			"GPFS fileset quota block in doubt", fileset_labels, nil),
-		FilesetFilesUsage: prometheus.NewDesc(prometheus.BuildFQName(namespace, "fileset", "used_files"),
+		FilesetBlockUsage: newDesc(prometheus.BuildFQName(namespace, "fileset", "used_bytes"),
+			"GPFS fileset quota used in bytes", fileset_labels, nil),
+		FilesetBlockQuota: newDesc(prometheus.BuildFQName(namespace, "fileset", "quota_bytes"),
+			"GPFS fileset block quota in bytes", fileset_labels, nil),
+		FilesetBlockLimit: newDesc(prometheus.BuildFQName(namespace, "fileset", "limit_bytes"),
+			"GPFS fileset quota block limit in bytes", fileset_labels, nil),
+		FilesetBlockInDoubt: newDesc(prometheus.BuildFQName(namespace, "fileset", "in_doubt_bytes"),
+			"GPFS fileset quota block in doubt in bytes", fileset_labels, nil),
+		FilesetFilesUsage: newDesc(prometheus.BuildFQName(namespace, "fileset", "used_files"),
 			"GPFS fileset quota files used", fileset_labels, nil),
-		FilesetFilesQuota: prometheus.NewDesc(prometheus.BuildFQName(namespace, "fileset", "quota_files"),
+		FilesetFilesQuota: newDesc(prometheus.BuildFQName(namespace, "fileset", "quota_files"),
 			"GPFS fileset files quota", fileset_labels, nil),
-		FilesetFilesLimit: prometheus.NewDesc(prometheus.BuildFQName(namespace, "fileset", "limit_files"),
+		FilesetFilesLimit: newDesc(prometheus.BuildFQName(namespace, "fileset", "limit_files"),
 			"GPFS fileset quota files limit", fileset_labels, nil),
-		FilesetFilesInDoubt: prometheus.NewDesc(prometheus.BuildFQName(namespace, "fileset", "in_doubt_files"),
+		FilesetFilesInDoubt: newDesc(prometheus.BuildFQName(namespace, "fileset", "in_doubt_files"),
 			"GPFS fileset quota files in doubt", fileset_labels, nil),
+		FilesetBlockRatio: newDesc(prometheus.BuildFQName(namespace, "fileset", "block_usage_ratio"),
+			"GPFS fileset block usage including in doubt as a ratio of the block quota", fileset_labels, nil),
+		FilesetFilesRatio: newDesc(prometheus.BuildFQName(namespace, "fileset", "files_usage_ratio"),
+			"GPFS fileset files usage including in doubt as a ratio of the files quota", fileset_labels, nil),
+		FilesetDefaultQuota: newDesc(prometheus.BuildFQName(namespace, "fileset", "default_quota"),
+			"GPFS fileset default quota is on", fileset_labels, nil),
+		FilesetEnforced: newDesc(prometheus.BuildFQName(namespace, "fileset", "quota_enforced"),
+			"GPFS fileset quota is enforced", fileset_labels, nil),
 
-		UserBlockUsage: prometheus.NewDesc(prometheus.BuildFQName(namespace, "user", "used_bytes"),
-			"GPFS user quota used", user_labels, nil),
-		UserBlockQuota: prometheus.NewDesc(prometheus.BuildFQName(namespace, "user", "quota_bytes"),
-			"GPFS user block quota", user_labels, nil),
-		UserBlockLimit: prometheus.NewDesc(prometheus.BuildFQName(namespace, "user", "limit_bytes"),
-			"GPFS user quota block limit", user_labels, nil),
-		UserBlockInDoubt: prometheus.NewDesc(prometheus.BuildFQName(namespace, "user", "in_doubt_bytes"),
-			"GPFS user quota block in doubt", user_labels, nil),
-		UserFilesUsage: prometheus.NewDesc(prometheus.BuildFQName(namespace, "user", "used_files"),
+		FilesetDefaultBlockQuota: newDesc(prometheus.BuildFQName(namespace, "fileset", "default_quota_bytes"),
+			"GPFS default fileset block quota of the filesystem in bytes", []string{"fs"}, nil),
+		FilesetDefaultFilesQuota: newDesc(prometheus.BuildFQName(namespace, "fileset", "default_quota_files"),
+			"GPFS default fileset files quota of the filesystem", []string{"fs"}, nil),
+
+		UserBlockUsage: newDesc(prometheus.BuildFQName(namespace, "user", "used_bytes"),
+			"GPFS user quota used in bytes", user_labels, nil),
+		UserBlockQuota: newDesc(prometheus.BuildFQName(namespace, "user", "quota_bytes"),
+			"GPFS user block quota in bytes", user_labels, nil),
+		UserBlockLimit: newDesc(prometheus.BuildFQName(namespace, "user", "limit_bytes"),
+			"GPFS user quota block limit in bytes", user_labels, nil),
+		UserBlockInDoubt: newDesc(prometheus.BuildFQName(namespace, "user", "in_doubt_bytes"),
+			"GPFS user quota block in doubt in bytes", user_labels, nil),
+		UserFilesUsage: newDesc(prometheus.BuildFQName(namespace, "user", "used_files"),
 			"GPFS user quota files used", user_labels, nil),
-		UserFilesQuota: prometheus.NewDesc(prometheus.BuildFQName(namespace, "user", "quota_files"),
+		UserFilesQuota: newDesc(prometheus.BuildFQName(namespace, "user", "quota_files"),
 			"GPFS user files quota", user_labels, nil),
-		UserFilesLimit: prometheus.NewDesc(prometheus.BuildFQName(namespace, "user", "limit_files"),
+		UserFilesLimit: newDesc(prometheus.BuildFQName(namespace, "user", "limit_files"),
 			"GPFS user quota files limit", user_labels, nil),
-		UserFilesInDoubt: prometheus.NewDesc(prometheus.BuildFQName(namespace, "user", "in_doubt_files"),
+		UserFilesInDoubt: newDesc(prometheus.BuildFQName(namespace, "user", "in_doubt_files"),
 			"GPFS user quota files in doubt", user_labels, nil),
+		UserBlockRatio: newDesc(prometheus.BuildFQName(namespace, "user", "block_usage_ratio"),
+			"GPFS user block usage including in doubt as a ratio of the block quota", user_labels, nil),
+		UserFilesRatio: newDesc(prometheus.BuildFQName(namespace, "user", "files_usage_ratio"),
+			"GPFS user files usage including in doubt as a ratio of the files quota", user_labels, nil),
+		UserEnforced: newDesc(prometheus.BuildFQName(namespace, "user", "quota_enforced"),
+			"GPFS user quota is enforced", user_labels, nil),
 
-		GroupBlockUsage: prometheus.NewDesc(prometheus.BuildFQName(namespace, "group", "used_bytes"),
-			"GPFS group quota used", group_labels, nil),
-		GroupBlockQuota: prometheus.NewDesc(prometheus.BuildFQName(namespace, "group", "quota_bytes"),
-			"GPFS group block quota", group_labels, nil),
-		GroupBlockLimit: prometheus.NewDesc(prometheus.BuildFQName(namespace, "group", "limit_bytes"),
-			"GPFS group quota block limit", group_labels, nil),
-		GroupBlockInDoubt: prometheus.NewDesc(prometheus.BuildFQName(namespace, "group", "in_doubt_bytes"),
-			"GPFS group quota block in doubt", group_labels, nil),
-		GroupFilesUsage: prometheus.NewDesc(prometheus.BuildFQName(namespace, "group", "used_files"),
+		GroupBlockUsage: newDesc(prometheus.BuildFQName(namespace, "group", "used_bytes"),
+			"GPFS group quota used in bytes", group_labels, nil),
+		GroupBlockQuota: newDesc(prometheus.BuildFQName(namespace, "group", "quota_bytes"),
+			"GPFS group block quota in bytes", group_labels, nil),
+		GroupBlockLimit: newDesc(prometheus.BuildFQName(namespace, "group", "limit_bytes"),
+			"GPFS group quota block limit in bytes", group_labels, nil),
+		GroupBlockInDoubt: newDesc(prometheus.BuildFQName(namespace, "group", "in_doubt_bytes"),
+			"GPFS group quota block in doubt in bytes", group_labels, nil),
+		GroupFilesUsage: newDesc(prometheus.BuildFQName(namespace, "group", "used_files"),
 			"GPFS group quota files used", group_labels, nil),
-		GroupFilesQuota: prometheus.NewDesc(prometheus.BuildFQName(namespace, "group", "quota_files"),
+		GroupFilesQuota: newDesc(prometheus.BuildFQName(namespace, "group", "quota_files"),
 			"GPFS group files quota", group_labels, nil),
-		GroupFilesLimit: prometheus.NewDesc(prometheus.BuildFQName(namespace, "group", "limit_files"),
+		GroupFilesLimit: newDesc(prometheus.BuildFQName(namespace, "group", "limit_files"),
 			"GPFS group quota files limit", group_labels, nil),
-		GroupFilesInDoubt: prometheus.NewDesc(prometheus.BuildFQName(namespace, "group", "in_doubt_files"),
+		GroupFilesInDoubt: newDesc(prometheus.BuildFQName(namespace, "group", "in_doubt_files"),
 			"GPFS group quota files in doubt", group_labels, nil),
+		GroupBlockRatio: newDesc(prometheus.BuildFQName(namespace, "group", "block_usage_ratio"),
+			"GPFS group block usage including in doubt as a ratio of the block quota", group_labels, nil),
+		GroupFilesRatio: newDesc(prometheus.BuildFQName(namespace, "group", "files_usage_ratio"),
+			"GPFS group files usage including in doubt as a ratio of the files quota", group_labels, nil),
+		GroupEnforced: newDesc(prometheus.BuildFQName(namespace, "group", "quota_enforced"),
+			"GPFS group quota is enforced", group_labels, nil),
+
+		UserQuotaMissing: newDesc(prometheus.BuildFQName(namespace, "user", "quota_missing"),
+			"GPFS user set by collector.mmrepquota.users has no quota record on the filesystem", []string{"user", "fs"}, nil),
+		GroupQuotaMissing: newDesc(prometheus.BuildFQName(namespace, "group", "quota_missing"),
+			"GPFS group set by collector.mmrepquota.groups has no quota record on the filesystem", []string{"group", "fs"}, nil),
+
+		DefaultRows: defaultRows,
 
 		logger: logger,
 	}
@@ -178,6 +302,13 @@ func (c *MmrepquotaCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- c.FilesetFilesQuota
 	ch <- c.FilesetFilesLimit
 	ch <- c.FilesetFilesInDoubt
+	ch <- c.FilesetBlockRatio
+	ch <- c.FilesetFilesRatio
+	ch <- c.FilesetDefaultQuota
+	ch <- c.FilesetEnforced
+
+	ch <- c.FilesetDefaultBlockQuota
+	ch <- c.FilesetDefaultFilesQuota
 
 	ch <- c.UserBlockUsage
 	ch <- c.UserBlockQuota
@@ -187,6 +318,9 @@ func (c *MmrepquotaCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- c.UserFilesQuota
 	ch <- c.UserFilesLimit
 	ch <- c.UserFilesInDoubt
+	ch <- c.UserBlockRatio
+	ch <- c.UserFilesRatio
+	ch <- c.UserEnforced
 
 	ch <- c.GroupBlockUsage
 	ch <- c.GroupBlockQuota
@@ -196,21 +330,38 @@ func (c *MmrepquotaCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- c.GroupFilesQuota
 	ch <- c.GroupFilesLimit
 	ch <- c.GroupFilesInDoubt
+	ch <- c.GroupBlockRatio
+	ch <- c.GroupFilesRatio
+	ch <- c.GroupEnforced
+
+	ch <- c.UserQuotaMissing
+	ch <- c.GroupQuotaMissing
+	for _, quotaType := range []string{"FILESET", "USR", "GRP"} {
+		for _, desc := range c.DefaultRows[quotaType] {
+			ch <- desc
+		}
+	}
+	quotaRecordsSkipped.Describe(ch)
 }
 
 func (c *MmrepquotaCollector) Collect(ch chan<- prometheus.Metric) {
 	level.Debug(c.logger).Log("msg", "Collecting mmrepquota metrics")
 	collectTime := time.Now()
-	timeout := 0
-	errorMetric := 0
+	if run, err := checkRunIf("mmrepquota", *mmrepquotaRunIf, ch, c.logger); err != nil {
+		level.Error(c.logger).Log("msg", "Unable to determine manager nodes", "err", err)
+		emitCollectorStatus(ch, "mmrepquota", err, collectTime, 0)
+		return
+	} else if !run {
+		return
+	}
+	var collectErr error
 	metrics := []QuotaMetric{}
 
-	typesToCollect := strings.Split(*configMmrepquotaTypes, ",")
+	typesToCollect := SplitList(*configMmrepquotaTypes)
 
-	results := make(chan MetricCollectionResult, len(typesToCollect)-1)
+	results := make(chan MetricCollectionResult, len(typesToCollect))
 
 	for _, quotaType := range typesToCollect {
-		quotaType = strings.TrimSpace(quotaType)
 		quotaArg := quotaTypeMap[quotaType]
 
 		// Collect quota types concurrently, place metrics on results channel as MetricCollectionResult
@@ -221,92 +372,330 @@ func (c *MmrepquotaCollector) Collect(ch chan<- prometheus.Metric) {
 	}
 
 	// merge metrics from results channel
+	var incompleteErr error
 	for range typesToCollect {
 		result := <-results
 		metrics = append(metrics, result.Result...)
 
 		err := result.Error
+		var incomplete *IncompleteOutputError
+		if errors.As(err, &incomplete) {
+			incompleteErr = err
+		}
 		if err == context.DeadlineExceeded {
-			timeout = 1
 			level.Error(c.logger).Log("msg", "Timeout executing mmrepquota")
 		} else if err != nil {
 			level.Error(c.logger).Log("msg", err)
-			errorMetric = 1
+		}
+		if collectErr == nil {
+			collectErr = err
+		}
+	}
+	recordParseIncomplete("mmrepquota", incompleteErr)
+
+	if *mmrepquotaDefaults {
+		defaults, err := c.collectDefaults()
+		if err == context.DeadlineExceeded {
+			level.Error(c.logger).Log("msg", "Timeout executing mmlsquota")
+		} else if err != nil {
+			level.Error(c.logger).Log("msg", err)
+		}
+		if collectErr == nil {
+			collectErr = err
+		}
+		for _, d := range defaults {
+			ch <- prometheus.MustNewConstMetric(c.FilesetDefaultBlockQuota, prometheus.GaugeValue, d.BlockQuota, d.FS)
+			ch <- prometheus.MustNewConstMetric(c.FilesetDefaultFilesQuota, prometheus.GaugeValue, d.FilesQuota, d.FS)
+		}
+	}
+
+	records := len(metrics)
+	metrics, defaults := splitQuotaDefaults(metrics)
+	for _, m := range defaults {
+		if !*mmrepquotaIncludeDefaults {
+			level.Debug(c.logger).Log("msg", "Skipping default quota row", "type", m.QuotaType, "name", m.Name, "fs", m.FS, "remarks", m.Remarks)
+			continue
+		}
+		values := []string{m.Name, m.FS}
+		if m.QuotaType != "FILESET" {
+			values = append(values, m.FilesetName)
+		}
+		if *mmrepquotaIncludeID {
+			values = append(values, m.ID)
+		}
+		for i, desc := range c.DefaultRows[m.QuotaType] {
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, quotaDefaultMetrics[i].value(m), values...)
+		}
+	}
+	metrics, missing := filterQuotaNames(metrics, SplitList(*mmrepquotaUsers), SplitList(*mmrepquotaGroups))
+	if collectErr == nil {
+		for _, m := range missing {
+			if m.QuotaType == "USR" {
+				ch <- prometheus.MustNewConstMetric(c.UserQuotaMissing, prometheus.GaugeValue, m.Missing, m.Name, m.FS)
+			} else {
+				ch <- prometheus.MustNewConstMetric(c.GroupQuotaMissing, prometheus.GaugeValue, m.Missing, m.Name, m.FS)
+			}
 		}
 	}
 
 	for _, m := range metrics {
+		if quotaSkip(m) {
+			quotaRecordsSkipped.WithLabelValues(quotaTypeNames[m.QuotaType]).Inc()
+			continue
+		}
+		filesetValues := []string{m.Name, m.FS}
+		values := []string{m.Name, m.FS, m.FilesetName}
+		if *mmrepquotaIncludeID {
+			filesetValues = append(filesetValues, m.ID)
+			values = append(values, m.ID)
+		}
 		if m.QuotaType == "FILESET" {
-			ch <- prometheus.MustNewConstMetric(c.FilesetBlockUsage, prometheus.GaugeValue, m.BlockUsage, m.Name, m.FS)
-			ch <- prometheus.MustNewConstMetric(c.FilesetBlockQuota, prometheus.GaugeValue, m.BlockQuota, m.Name, m.FS)
-			ch <- prometheus.MustNewConstMetric(c.FilesetBlockLimit, prometheus.GaugeValue, m.BlockLimit, m.Name, m.FS)
-			ch <- prometheus.MustNewConstMetric(c.FilesetBlockInDoubt, prometheus.GaugeValue, m.BlockInDoubt, m.Name, m.FS)
-			ch <- prometheus.MustNewConstMetric(c.FilesetFilesUsage, prometheus.GaugeValue, m.FilesUsage, m.Name, m.FS)
-			ch <- prometheus.MustNewConstMetric(c.FilesetFilesQuota, prometheus.GaugeValue, m.FilesQuota, m.Name, m.FS)
-			ch <- prometheus.MustNewConstMetric(c.FilesetFilesLimit, prometheus.GaugeValue, m.FilesLimit, m.Name, m.FS)
-			ch <- prometheus.MustNewConstMetric(c.FilesetFilesInDoubt, prometheus.GaugeValue, m.FilesInDoubt, m.Name, m.FS)
+			ch <- prometheus.MustNewConstMetric(c.FilesetBlockUsage, prometheus.GaugeValue, m.BlockUsage, filesetValues...)
+			ch <- prometheus.MustNewConstMetric(c.FilesetBlockQuota, prometheus.GaugeValue, m.BlockQuota, filesetValues...)
+			ch <- prometheus.MustNewConstMetric(c.FilesetBlockLimit, prometheus.GaugeValue, m.BlockLimit, filesetValues...)
+			ch <- prometheus.MustNewConstMetric(c.FilesetBlockInDoubt, prometheus.GaugeValue, m.BlockInDoubt, filesetValues...)
+			ch <- prometheus.MustNewConstMetric(c.FilesetFilesUsage, prometheus.GaugeValue, m.FilesUsage, filesetValues...)
+			ch <- prometheus.MustNewConstMetric(c.FilesetFilesQuota, prometheus.GaugeValue, m.FilesQuota, filesetValues...)
+			ch <- prometheus.MustNewConstMetric(c.FilesetFilesLimit, prometheus.GaugeValue, m.FilesLimit, filesetValues...)
+			ch <- prometheus.MustNewConstMetric(c.FilesetFilesInDoubt, prometheus.GaugeValue, m.FilesInDoubt, filesetValues...)
+			if ratio, ok := quotaRatio(m.BlockUsage, m.BlockInDoubt, m.BlockQuota); ok {
+				ch <- prometheus.MustNewConstMetric(c.FilesetBlockRatio, prometheus.GaugeValue, ratio, filesetValues...)
+			}
+			if ratio, ok := quotaRatio(m.FilesUsage, m.FilesInDoubt, m.FilesQuota); ok {
+				ch <- prometheus.MustNewConstMetric(c.FilesetFilesRatio, prometheus.GaugeValue, ratio, filesetValues...)
+			}
+			ch <- prometheus.MustNewConstMetric(c.FilesetDefaultQuota, prometheus.GaugeValue, quotaOn(m.DefQuota), filesetValues...)
+			ch <- prometheus.MustNewConstMetric(c.FilesetEnforced, prometheus.GaugeValue, quotaOn(m.Quota), filesetValues...)
 		} else if m.QuotaType == "USR" {
-			ch <- prometheus.MustNewConstMetric(c.UserBlockUsage, prometheus.GaugeValue, m.BlockUsage, m.Name, m.FS, m.FilesetName)
-			ch <- prometheus.MustNewConstMetric(c.UserBlockQuota, prometheus.GaugeValue, m.BlockQuota, m.Name, m.FS, m.FilesetName)
-			ch <- prometheus.MustNewConstMetric(c.UserBlockLimit, prometheus.GaugeValue, m.BlockLimit, m.Name, m.FS, m.FilesetName)
-			ch <- prometheus.MustNewConstMetric(c.UserBlockInDoubt, prometheus.GaugeValue, m.BlockInDoubt, m.Name, m.FS, m.FilesetName)
-			ch <- prometheus.MustNewConstMetric(c.UserFilesUsage, prometheus.GaugeValue, m.FilesUsage, m.Name, m.FS, m.FilesetName)
-			ch <- prometheus.MustNewConstMetric(c.UserFilesQuota, prometheus.GaugeValue, m.FilesQuota, m.Name, m.FS, m.FilesetName)
-			ch <- prometheus.MustNewConstMetric(c.UserFilesLimit, prometheus.GaugeValue, m.FilesLimit, m.Name, m.FS, m.FilesetName)
-			ch <- prometheus.MustNewConstMetric(c.UserFilesInDoubt, prometheus.GaugeValue, m.FilesInDoubt, m.Name, m.FS, m.FilesetName)
+			ch <- prometheus.MustNewConstMetric(c.UserBlockUsage, prometheus.GaugeValue, m.BlockUsage, values...)
+			ch <- prometheus.MustNewConstMetric(c.UserBlockQuota, prometheus.GaugeValue, m.BlockQuota, values...)
+			ch <- prometheus.MustNewConstMetric(c.UserBlockLimit, prometheus.GaugeValue, m.BlockLimit, values...)
+			ch <- prometheus.MustNewConstMetric(c.UserBlockInDoubt, prometheus.GaugeValue, m.BlockInDoubt, values...)
+			ch <- prometheus.MustNewConstMetric(c.UserFilesUsage, prometheus.GaugeValue, m.FilesUsage, values...)
+			ch <- prometheus.MustNewConstMetric(c.UserFilesQuota, prometheus.GaugeValue, m.FilesQuota, values...)
+			ch <- prometheus.MustNewConstMetric(c.UserFilesLimit, prometheus.GaugeValue, m.FilesLimit, values...)
+			ch <- prometheus.MustNewConstMetric(c.UserFilesInDoubt, prometheus.GaugeValue, m.FilesInDoubt, values...)
+			if ratio, ok := quotaRatio(m.BlockUsage, m.BlockInDoubt, m.BlockQuota); ok {
+				ch <- prometheus.MustNewConstMetric(c.UserBlockRatio, prometheus.GaugeValue, ratio, values...)
+			}
+			if ratio, ok := quotaRatio(m.FilesUsage, m.FilesInDoubt, m.FilesQuota); ok {
+				ch <- prometheus.MustNewConstMetric(c.UserFilesRatio, prometheus.GaugeValue, ratio, values...)
+			}
+			ch <- prometheus.MustNewConstMetric(c.UserEnforced, prometheus.GaugeValue, quotaOn(m.Quota), values...)
 		} else if m.QuotaType == "GRP" {
-			ch <- prometheus.MustNewConstMetric(c.GroupBlockUsage, prometheus.GaugeValue, m.BlockUsage, m.Name, m.FS, m.FilesetName)
-			ch <- prometheus.MustNewConstMetric(c.GroupBlockQuota, prometheus.GaugeValue, m.BlockQuota, m.Name, m.FS, m.FilesetName)
-			ch <- prometheus.MustNewConstMetric(c.GroupBlockLimit, prometheus.GaugeValue, m.BlockLimit, m.Name, m.FS, m.FilesetName)
-			ch <- prometheus.MustNewConstMetric(c.GroupBlockInDoubt, prometheus.GaugeValue, m.BlockInDoubt, m.Name, m.FS, m.FilesetName)
-			ch <- prometheus.MustNewConstMetric(c.GroupFilesUsage, prometheus.GaugeValue, m.FilesUsage, m.Name, m.FS, m.FilesetName)
-			ch <- prometheus.MustNewConstMetric(c.GroupFilesQuota, prometheus.GaugeValue, m.FilesQuota, m.Name, m.FS, m.FilesetName)
-			ch <- prometheus.MustNewConstMetric(c.GroupFilesLimit, prometheus.GaugeValue, m.FilesLimit, m.Name, m.FS, m.FilesetName)
-			ch <- prometheus.MustNewConstMetric(c.GroupFilesInDoubt, prometheus.GaugeValue, m.FilesInDoubt, m.Name, m.FS, m.FilesetName)
+			ch <- prometheus.MustNewConstMetric(c.GroupBlockUsage, prometheus.GaugeValue, m.BlockUsage, values...)
+			ch <- prometheus.MustNewConstMetric(c.GroupBlockQuota, prometheus.GaugeValue, m.BlockQuota, values...)
+			ch <- prometheus.MustNewConstMetric(c.GroupBlockLimit, prometheus.GaugeValue, m.BlockLimit, values...)
+			ch <- prometheus.MustNewConstMetric(c.GroupBlockInDoubt, prometheus.GaugeValue, m.BlockInDoubt, values...)
+			ch <- prometheus.MustNewConstMetric(c.GroupFilesUsage, prometheus.GaugeValue, m.FilesUsage, values...)
+			ch <- prometheus.MustNewConstMetric(c.GroupFilesQuota, prometheus.GaugeValue, m.FilesQuota, values...)
+			ch <- prometheus.MustNewConstMetric(c.GroupFilesLimit, prometheus.GaugeValue, m.FilesLimit, values...)
+			ch <- prometheus.MustNewConstMetric(c.GroupFilesInDoubt, prometheus.GaugeValue, m.FilesInDoubt, values...)
+			if ratio, ok := quotaRatio(m.BlockUsage, m.BlockInDoubt, m.BlockQuota); ok {
+				ch <- prometheus.MustNewConstMetric(c.GroupBlockRatio, prometheus.GaugeValue, ratio, values...)
+			}
+			if ratio, ok := quotaRatio(m.FilesUsage, m.FilesInDoubt, m.FilesQuota); ok {
+				ch <- prometheus.MustNewConstMetric(c.GroupFilesRatio, prometheus.GaugeValue, ratio, values...)
+			}
+			ch <- prometheus.MustNewConstMetric(c.GroupEnforced, prometheus.GaugeValue, quotaOn(m.Quota), values...)
 		}
 	}
-	ch <- prometheus.MustNewConstMetric(collectError, prometheus.GaugeValue, float64(errorMetric), "mmrepquota")
-	ch <- prometheus.MustNewConstMetric(collecTimeout, prometheus.GaugeValue, float64(timeout), "mmrepquota")
-	ch <- prometheus.MustNewConstMetric(collectDuration, prometheus.GaugeValue, time.Since(collectTime).Seconds(), "mmrepquota")
+	quotaRecordsSkipped.Collect(ch)
+	emitCollectorStatus(ch, "mmrepquota", collectErr, collectTime, records)
+}
+
+// filterQuotaNames keeps only the user and group records for the given names when names are set,
+// fileset records are always kept. For each name it also returns whether a record was found on
+// every filesystem that reported quotas of that type.
+func filterQuotaNames(metrics []QuotaMetric, users []string, groups []string) ([]QuotaMetric, []QuotaMissing) {
+	names := map[string][]string{"USR": users, "GRP": groups}
+	filesystems := make(map[string][]string)
+	found := make(map[string]bool)
+	var filtered []QuotaMetric
+	for _, m := range metrics {
+		if !SliceContains(filesystems[m.QuotaType], m.FS) {
+			filesystems[m.QuotaType] = append(filesystems[m.QuotaType], m.FS)
+		}
+		if allowed, ok := names[m.QuotaType]; ok && len(allowed) > 0 {
+			if !SliceContains(allowed, m.Name) {
+				continue
+			}
+			found[m.QuotaType+":"+m.Name+":"+m.FS] = true
+		}
+		filtered = append(filtered, m)
+	}
+	var missing []QuotaMissing
+	for _, quotaType := range []string{"USR", "GRP"} {
+		for _, name := range names[quotaType] {
+			for _, fs := range filesystems[quotaType] {
+				m := QuotaMissing{QuotaType: quotaType, Name: name, FS: fs}
+				if !found[quotaType+":"+name+":"+fs] {
+					m.Missing = 1
+				}
+				missing = append(missing, m)
+			}
+		}
+	}
+	return filtered, missing
+}
+
+// splitQuotaDefaults separates the default quota rows, named DEFAULT or with a d remark, from the
+// rows of real entities. Rows with d_fsys or d_fset remarks are entities using the default limits.
+func splitQuotaDefaults(metrics []QuotaMetric) ([]QuotaMetric, []QuotaMetric) {
+	var entities, defaults []QuotaMetric
+	for _, m := range metrics {
+		if strings.EqualFold(m.Name, "DEFAULT") || strings.EqualFold(m.Remarks, "d") {
+			defaults = append(defaults, m)
+			continue
+		}
+		entities = append(entities, m)
+	}
+	return entities, defaults
+}
+
+// quotaRatio returns the usage including in doubt as a ratio of the quota,
+// ok is false when no quota is set
+func quotaRatio(usage float64, inDoubt float64, quota float64) (float64, bool) {
+	if quota <= 0 {
+		return 0, false
+	}
+	return (usage + inDoubt) / quota, true
+}
+
+// quotaSkip returns true for records below both usage thresholds with no quota configured.
+// Records over their limits are never skipped.
+func quotaSkip(m QuotaMetric) bool {
+	if m.BlockQuota != 0 || m.FilesQuota != 0 {
+		return false
+	}
+	if (m.BlockLimit > 0 && m.BlockUsage > m.BlockLimit) || (m.FilesLimit > 0 && m.FilesUsage > m.FilesLimit) {
+		return false
+	}
+	return m.BlockUsage < float64(*mmrepquotaMinBlockUsage) && m.FilesUsage < float64(*mmrepquotaMinFilesUsage)
 }
 
 func (c *MmrepquotaCollector) collect(typeArg string) ([]QuotaMetric, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(*mmrepquotaTimeout)*time.Second)
+	ctx, cancel := commandContext("mmrepquota", *mmrepquotaTimeout)
 	defer cancel()
-	out, err := mmrepquotaExec(ctx, typeArg)
+	out, err := execRetry(ctx, "mmrepquota", func() (string, error) {
+		return mmrepquotaExec(ctx, typeArg)
+	})
 	if err != nil {
 		return nil, err
 	}
-	metric := parse_mmrepquota(out, c.logger)
-	return metric, nil
+	commandDump.record(fmt.Sprintf("mmrepquota%s", typeArg), out)
+	metrics, err := parse_mmrepquota(out, c.logger)
+	commandDump.recordParsed(fmt.Sprintf("mmrepquota%s", typeArg), metrics)
+	return metrics, err
+}
+
+// quotaOn returns 1 when the quota or defQuota column is on
+func quotaOn(value string) float64 {
+	if strings.EqualFold(value, "on") {
+		return 1
+	}
+	return 0
+}
+
+func (c *MmrepquotaCollector) collectDefaults() ([]QuotaDefault, error) {
+	ctx, cancel := commandContext("mmrepquota", *mmrepquotaTimeout)
+	defer cancel()
+	out, err := execRetry(ctx, "mmrepquota", func() (string, error) {
+		return mmlsquotaDefaultsExec(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	commandDump.record("mmlsquota-d-j", out)
+	defaults := parse_mmlsquota_defaults(out, c.logger)
+	commandDump.recordParsed("mmlsquota-d-j", defaults)
+	return defaults, nil
+}
+
+func mmlsquotaDefaults(ctx context.Context) (string, error) {
+	args := append([]string{"-d", "-j", "-Y"}, SplitList(*configMmrepquotaFilesystems)...)
+	return RunMMCommand(ctx, "mmlsquota", args...)
+}
+
+// parse_mmlsquota_defaults returns the default fileset quotas, rows for other quota types are skipped
+func parse_mmlsquota_defaults(out string, logger log.Logger) []QuotaDefault {
+	var defaults []QuotaDefault
+	var headers []string
+	lines := strings.Split(out, "\n")
+	for _, l := range lines {
+		if !strings.HasPrefix(l, "mmlsquota") {
+			continue
+		}
+		items := strings.Split(l, ":")
+		if len(items) < 3 {
+			continue
+		}
+		if items[2] == "HEADER" {
+			headers = items
+			continue
+		}
+		value := func(header string) string {
+			if i := SliceIndex(headers, header); i != -1 && i < len(items) {
+				return items[i]
+			}
+			return ""
+		}
+		if value("quotaType") != "FILESET" {
+			continue
+		}
+		d := QuotaDefault{FS: DecodeGPFSString(value("filesystemName"))}
+		for field, dest := range map[string]*float64{"blockQuota": &d.BlockQuota, "filesQuota": &d.FilesQuota} {
+			val, err := strconv.ParseFloat(value(field), 64)
+			if err != nil {
+				level.Warn(logger).Log("msg", "Unable to parse default quota", "key", field, "value", value(field), "fs", d.FS, "err", err)
+				parseErrors.WithLabelValues("mmrepquota").Inc()
+				continue
+			}
+			if field == "blockQuota" {
+				val = KBToBytes(val)
+			}
+			*dest = val
+		}
+		defaults = append(defaults, d)
+	}
+	return defaults
 }
 
 func mmrepquota(ctx context.Context, typeArg string) (string, error) {
-	args := []string{"/usr/lpp/mmfs/bin/mmrepquota", typeArg, "-Y"}
+	return RunMMCommand(ctx, "mmrepquota", mmrepquotaArgs(typeArg)...)
+}
+
+func mmrepquotaArgs(typeArg string) []string {
+	args := []string{typeArg, "-Y"}
 
-	if *configMmrepquotaFilesystems == "" {
+	if *configMmrepquotaFilesets != "" {
+		args = append(args, SplitList(*configMmrepquotaFilesets)...)
+	} else if *configMmrepquotaFilesystems == "" {
 		args = append(args, "-a")
 	} else {
-		args = append(args, strings.Split(*configMmrepquotaFilesystems, ",")...)
+		args = append(args, SplitList(*configMmrepquotaFilesystems)...)
 	}
 
-	cmd := execCommand(ctx, *sudoCmd, args...)
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	err := cmd.Run()
-	if ctx.Err() == context.DeadlineExceeded {
-		return "", ctx.Err()
-	} else if err != nil {
-		return "", err
-	}
-	return out.String(), nil
+	return args
 }
 
-func parse_mmrepquota(out string, logger log.Logger) []QuotaMetric {
+// parse_mmrepquota returns an IncompleteOutputError when a report has no header or the
+// last row has fewer values than the header, such as when the output was truncated
+func parse_mmrepquota(out string, logger log.Logger) ([]QuotaMetric, error) {
 	var metrics []QuotaMetric
 	var headers []string
+	var missing []string
+	report := ""
+	truncated := false
 	lines := strings.Split(out, "\n")
 	for _, l := range lines {
+		if strings.HasPrefix(l, "*** Report for") {
+			if report != "" {
+				missing = append(missing, fmt.Sprintf("header for %s", report))
+			}
+			report = strings.TrimSpace(strings.TrimPrefix(l, "***"))
+			continue
+		}
 		if !strings.HasPrefix(l, "mmrepquota") {
 			continue
 		}
@@ -320,10 +709,12 @@ func parse_mmrepquota(out string, logger log.Logger) []QuotaMetric {
 				headers = nil
 			}
 			headers = append(headers, items...)
+			report = ""
 			continue
 		} else {
 			values = append(values, items...)
 		}
+		truncated = len(values) < len(headers)
 		if len(headers) != len(values) {
 			level.Error(logger).Log("msg", "Header value mismatch", "headers", len(headers), "values", len(values), "line", l)
 			continue
@@ -336,11 +727,11 @@ func parse_mmrepquota(out string, logger log.Logger) []QuotaMetric {
 				f := s.FieldByName(field)
 				value := values[i]
 				if f.Kind() == reflect.String {
-					f.SetString(value)
+					f.SetString(DecodeGPFSString(value))
 				} else if f.Kind() == reflect.Float64 {
 					if val, err := strconv.ParseFloat(value, 64); err == nil {
 						if strings.HasPrefix(field, "Block") {
-							val = val * 1024
+							val = KBToBytes(val)
 						}
 						f.SetFloat(val)
 					} else {
@@ -351,5 +742,14 @@ func parse_mmrepquota(out string, logger log.Logger) []QuotaMetric {
 		}
 		metrics = append(metrics, metric)
 	}
-	return metrics
+	if report != "" {
+		missing = append(missing, fmt.Sprintf("header for %s", report))
+	}
+	if truncated {
+		missing = append(missing, "values of the last row")
+	}
+	if len(missing) > 0 {
+		return nil, &IncompleteOutputError{Command: "mmrepquota", Missing: missing}
+	}
+	return metrics, nil
 }
@@ -15,8 +15,10 @@ package collectors
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os/exec"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -37,6 +39,38 @@ mmrepquota::HEADER:version:reserved:reserved:filesystemName:quotaType:id:name:bl
 mmrepquota::0:1:::scratch:FILESET:0:root:928235294208:0:0:5308909920:none:141909093:0:0:140497:none:i:on:off:::
 `
 
+	mmrepquotaStdoutEnforced = `
+*** Report for FILESET quotas on project
+mmrepquota::HEADER:version:reserved:reserved:filesystemName:quotaType:id:name:blockUsage:blockQuota:blockLimit:blockInDoubt:blockGrace:filesUsage:filesQuota:filesLimit:filesInDoubt:filesGrace:remarks:quota:defQuota:fid:filesetname:
+mmrepquota::0:1:::project:FILESET:0:root:337419744:0:0:163840:none:1395:0:0:400:none:i:off:off:::
+mmrepquota::0:1:::project:FILESET:408:PZS1003:341467872:2147483648:2147483648:0:none:6286:2000000:2000000:0:none:e:on:on:::
+*** Report for USR quotas on project
+mmrepquota::HEADER:version:reserved:reserved:filesystemName:quotaType:id:name:blockUsage:blockQuota:blockLimit:blockInDoubt:blockGrace:filesUsage:filesQuota:filesLimit:filesInDoubt:filesGrace:remarks:quota:defQuota:fid:filesetname:
+mmrepquota::0:1:::project:USR:0:root:337419744:0:0:163840:none:1395:0:0:400:none:i:off:off::root:
+mmrepquota::0:1:::project:USR:1000:user1:1024:2048:4096:0:none:10:100:200:0:none:e:on:off::root:
+*** Report for GRP quotas on project
+mmrepquota::HEADER:version:reserved:reserved:filesystemName:quotaType:id:name:blockUsage:blockQuota:blockLimit:blockInDoubt:blockGrace:filesUsage:filesQuota:filesLimit:filesInDoubt:filesGrace:remarks:quota:defQuota:fid:filesetname:
+mmrepquota::0:1:::project:GRP:0:root:337419744:0:0:163840:none:1395:0:0:400:none:i:off:off::root:
+mmrepquota::0:1:::project:GRP:1000:group1:1024:2048:4096:0:none:10:100:200:0:none:e:on:off::root:
+`
+
+	mmrepquotaStdoutDefaults = `
+*** Report for FILESET quotas on project
+mmrepquota::HEADER:version:reserved:reserved:filesystemName:quotaType:id:name:blockUsage:blockQuota:blockLimit:blockInDoubt:blockGrace:filesUsage:filesQuota:filesLimit:filesInDoubt:filesGrace:remarks:quota:defQuota:fid:filesetname:
+mmrepquota::0:1:::project:FILESET:0:DEFAULT:0:1073741824:2147483648:0:none:0:1000000:2000000:0:none:d:on:on:::
+mmrepquota::0:1:::project:FILESET:408:PZS1003:341467872:2147483648:2147483648:0:none:6286:2000000:2000000:0:none:e:on:on:::
+*** Report for USR quotas on project
+mmrepquota::HEADER:version:reserved:reserved:filesystemName:quotaType:id:name:blockUsage:blockQuota:blockLimit:blockInDoubt:blockGrace:filesUsage:filesQuota:filesLimit:filesInDoubt:filesGrace:remarks:quota:defQuota:fid:filesetname:
+mmrepquota::0:1:::project:USR:0:default:0:1024:2048:0:none:0:100:200:0:none:d:on:on::root:
+mmrepquota::0:1:::project:USR:1000:user1:1024:2048:4096:0:none:10:100:200:0:none:e:on:on::root:
+mmrepquota::0:1:::project:USR:1001:user2:512:1024:2048:0:none:5:100:200:0:none:d_fsys:on:on::root:
+`
+
+	mmlsquotaDefaultsStdout = `
+mmlsquota::HEADER:version:reserved:reserved:filesystemName:quotaType:id:name:blockUsage:blockQuota:blockLimit:blockInDoubt:blockGrace:filesUsage:filesQuota:filesLimit:filesInDoubt:filesGrace:remarks:quota:defQuota:fid:filesetname:
+mmlsquota::0:1:::project:FILESET:::0:1073741824:2147483648:0:none:0:1000000:2000000:0:none:::on:::
+mmlsquota::0:1:::scratch:FILESET:::0:0:0:0:none:0:0:0:0:none:::off:::
+`
 	mmrepquotaStdoutAll = `
 *** Report for FILESET quotas on project
 mmrepquota::HEADER:version:reserved:reserved:filesystemName:quotaType:id:name:blockUsage:blockQuota:blockLimit:blockInDoubt:blockGrace:filesUsage:filesQuota:filesLimit:filesInDoubt:filesGrace:remarks:quota:defQuota:fid:filesetname:
@@ -114,8 +148,31 @@ func TestMmrepquotaTimeout(t *testing.T) {
 	}
 }
 
+func TestMmrepquotaArgs(t *testing.T) {
+	tests := []struct {
+		flags    []string
+		expected []string
+	}{
+		{flags: []string{}, expected: []string{"-j", "-Y", "-a"}},
+		{flags: []string{"--collector.mmrepquota.filesystems=project,scratch"}, expected: []string{"-j", "-Y", "project", "scratch"}},
+		{flags: []string{"--collector.mmrepquota.filesystems=project", "--collector.mmrepquota.filesets=project:PZS1003,scratch:tmp"},
+			expected: []string{"-j", "-Y", "project:PZS1003", "scratch:tmp"}},
+	}
+	for _, test := range tests {
+		if _, err := kingpin.CommandLine.Parse(test.flags); err != nil {
+			t.Fatal(err)
+		}
+		if args := mmrepquotaArgs("-j"); !reflect.DeepEqual(args, test.expected) {
+			t.Errorf("Unexpected args %v, expected %v", args, test.expected)
+		}
+	}
+}
+
 func TestParseMmrepquota(t *testing.T) {
-	metrics := parse_mmrepquota(mmrepquotaStdout, log.NewNopLogger())
+	metrics, err := parse_mmrepquota(mmrepquotaStdout, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
 	if len(metrics) != 3 {
 		t.Errorf("Unexpected metric count: %d", len(metrics))
 		return
@@ -132,9 +189,15 @@ func TestParseMmrepquota(t *testing.T) {
 	if val := metrics[0].BlockInDoubt; val != 167772160 {
 		t.Errorf("Unexpected BlockInDoubt got %v", val)
 	}
+	if val := metrics[1].ID; val != "408" {
+		t.Errorf("Unexpected ID got %v", val)
+	}
 }
 func TestParseMmrepquotaAll(t *testing.T) {
-	metrics := parse_mmrepquota(mmrepquotaStdoutAll, log.NewNopLogger())
+	metrics, err := parse_mmrepquota(mmrepquotaStdoutAll, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
 	if len(metrics) != 13 {
 		t.Errorf("Unexpected metric count: %d", len(metrics))
 		return
@@ -167,7 +230,7 @@ gpfs_exporter_collect_error{collector="mmrepquota"} 0
 # HELP gpfs_exporter_collect_timeout Indicates the collector timed out
 # TYPE gpfs_exporter_collect_timeout gauge
 gpfs_exporter_collect_timeout{collector="mmrepquota"} 0
-# HELP gpfs_fileset_in_doubt_bytes GPFS fileset quota block in doubt
+# HELP gpfs_fileset_in_doubt_bytes GPFS fileset quota block in doubt in bytes
 # TYPE gpfs_fileset_in_doubt_bytes gauge
 gpfs_fileset_in_doubt_bytes{fileset="PZS1003",fs="project"} 0
 gpfs_fileset_in_doubt_bytes{fileset="root",fs="project"} 167772160
@@ -177,7 +240,7 @@ gpfs_fileset_in_doubt_bytes{fileset="root",fs="scratch"} 5436323758080
 gpfs_fileset_in_doubt_files{fileset="PZS1003",fs="project"} 0
 gpfs_fileset_in_doubt_files{fileset="root",fs="project"} 400
 gpfs_fileset_in_doubt_files{fileset="root",fs="scratch"} 140497
-# HELP gpfs_fileset_limit_bytes GPFS fileset quota block limit
+# HELP gpfs_fileset_limit_bytes GPFS fileset quota block limit in bytes
 # TYPE gpfs_fileset_limit_bytes gauge
 gpfs_fileset_limit_bytes{fileset="PZS1003",fs="project"} 2199023255552
 gpfs_fileset_limit_bytes{fileset="root",fs="project"} 0
@@ -187,7 +250,7 @@ gpfs_fileset_limit_bytes{fileset="root",fs="scratch"} 0
 gpfs_fileset_limit_files{fileset="PZS1003",fs="project"} 2000000
 gpfs_fileset_limit_files{fileset="root",fs="project"} 0
 gpfs_fileset_limit_files{fileset="root",fs="scratch"} 0
-# HELP gpfs_fileset_quota_bytes GPFS fileset block quota
+# HELP gpfs_fileset_quota_bytes GPFS fileset block quota in bytes
 # TYPE gpfs_fileset_quota_bytes gauge
 gpfs_fileset_quota_bytes{fileset="PZS1003",fs="project"} 2199023255552
 gpfs_fileset_quota_bytes{fileset="root",fs="project"} 0
@@ -197,7 +260,7 @@ gpfs_fileset_quota_bytes{fileset="root",fs="scratch"} 0
 gpfs_fileset_quota_files{fileset="PZS1003",fs="project"} 2000000
 gpfs_fileset_quota_files{fileset="root",fs="project"} 0
 gpfs_fileset_quota_files{fileset="root",fs="scratch"} 0
-# HELP gpfs_fileset_used_bytes GPFS fileset quota used
+# HELP gpfs_fileset_used_bytes GPFS fileset quota used in bytes
 # TYPE gpfs_fileset_used_bytes gauge
 gpfs_fileset_used_bytes{fileset="PZS1003",fs="project"} 349663100928
 gpfs_fileset_used_bytes{fileset="root",fs="project"} 345517817856
@@ -213,8 +276,8 @@ gpfs_fileset_used_files{fileset="root",fs="scratch"} 141909093
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
-	} else if val != 27 {
-		t.Errorf("Unexpected collection count %d, expected 27", val)
+	} else if val != 44 {
+		t.Errorf("Unexpected collection count %d, expected 44", val)
 	}
 	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
 		"gpfs_exporter_collect_error", "gpfs_exporter_collect_timeout",
@@ -227,6 +290,98 @@ gpfs_fileset_used_files{fileset="root",fs="scratch"} 141909093
 	}
 }
 
+func TestParseMmlsquotaDefaults(t *testing.T) {
+	defaults := parse_mmlsquota_defaults(mmlsquotaDefaultsStdout, log.NewNopLogger())
+	expected := []QuotaDefault{
+		{FS: "project", BlockQuota: 1099511627776, FilesQuota: 1000000},
+		{FS: "scratch", BlockQuota: 0, FilesQuota: 0},
+	}
+	if !reflect.DeepEqual(defaults, expected) {
+		t.Errorf("Unexpected defaults\nGot: %v\nExpected: %v", defaults, expected)
+	}
+	before := testutil.ToFloat64(parseErrors.WithLabelValues("mmrepquota"))
+	defaults = parse_mmlsquota_defaults(strings.Replace(mmlsquotaDefaultsStdout, ":1073741824:", ":foo:", 1), log.NewNopLogger())
+	if len(defaults) != 2 || defaults[0].BlockQuota != 0 || defaults[0].FilesQuota != 1000000 {
+		t.Errorf("Unexpected defaults, got %v", defaults)
+	}
+	if val := testutil.ToFloat64(parseErrors.WithLabelValues("mmrepquota")) - before; val != 1 {
+		t.Errorf("Unexpected parse errors, got %v", val)
+	}
+}
+
+func TestMmrepquotaCollectorDefaults(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.mmrepquota.defaults"}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		*mmrepquotaDefaults = false
+	}()
+	mmrepquotaExec = func(ctx context.Context, typeArg string) (string, error) {
+		return strings.Replace(mmrepquotaStdout, ":e:on:off:", ":e:on:on:", 1), nil
+	}
+	var args []string
+	mmlsquotaDefaultsExec = func(ctx context.Context) (string, error) {
+		return mmlsquotaDefaultsStdout, nil
+	}
+	execCommand = func(ctx context.Context, name string, a ...string) *exec.Cmd {
+		args = a
+		return fakeExecCommand(ctx, name, a...)
+	}
+	defer func() { execCommand = exec.CommandContext }()
+	expected := `
+# HELP gpfs_fileset_default_quota GPFS fileset default quota is on
+# TYPE gpfs_fileset_default_quota gauge
+gpfs_fileset_default_quota{fileset="PZS1003",fs="project"} 1
+gpfs_fileset_default_quota{fileset="root",fs="project"} 0
+gpfs_fileset_default_quota{fileset="root",fs="scratch"} 0
+# HELP gpfs_fileset_default_quota_bytes GPFS default fileset block quota of the filesystem in bytes
+# TYPE gpfs_fileset_default_quota_bytes gauge
+gpfs_fileset_default_quota_bytes{fs="project"} 1099511627776
+gpfs_fileset_default_quota_bytes{fs="scratch"} 0
+# HELP gpfs_fileset_default_quota_files GPFS default fileset files quota of the filesystem
+# TYPE gpfs_fileset_default_quota_files gauge
+gpfs_fileset_default_quota_files{fs="project"} 1000000
+gpfs_fileset_default_quota_files{fs="scratch"} 0
+`
+	collector := NewMmrepquotaCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
+		"gpfs_fileset_default_quota", "gpfs_fileset_default_quota_bytes", "gpfs_fileset_default_quota_files"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+
+	mmlsquotaDefaultsExec = mmlsquotaDefaults
+	defer func() {
+		mmlsquotaDefaultsExec = func(ctx context.Context) (string, error) {
+			return mmlsquotaDefaultsStdout, nil
+		}
+	}()
+	mockedExitStatus = 0
+	mockedStdout = mmlsquotaDefaultsStdout
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.mmrepquota.defaults", "--collector.mmrepquota.filesystems=project"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mmlsquotaDefaults(context.Background()); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if expected := []string{"/usr/lpp/mmfs/bin/mmlsquota", "-d", "-j", "-Y", "project"}; !reflect.DeepEqual(args, expected) {
+		t.Errorf("Unexpected args\nGot: %v\nExpected: %v", args, expected)
+	}
+
+	mmlsquotaDefaultsExec = func(ctx context.Context) (string, error) {
+		return "", fmt.Errorf("Error")
+	}
+	expected = `
+# HELP gpfs_exporter_collect_error Indicates if error has occurred during collection
+# TYPE gpfs_exporter_collect_error gauge
+gpfs_exporter_collect_error{collector="mmrepquota"} 1
+`
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
+		"gpfs_exporter_collect_error", "gpfs_fileset_default_quota_bytes"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
 func TestMmrepquotaCollectorAll(t *testing.T) {
 	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
 		t.Fatal(err)
@@ -242,7 +397,7 @@ gpfs_exporter_collect_error{collector="mmrepquota"} 0
 # TYPE gpfs_exporter_collect_timeout gauge
 gpfs_exporter_collect_timeout{collector="mmrepquota"} 0
 
-# HELP gpfs_fileset_in_doubt_bytes GPFS fileset quota block in doubt
+# HELP gpfs_fileset_in_doubt_bytes GPFS fileset quota block in doubt in bytes
 # TYPE gpfs_fileset_in_doubt_bytes gauge
 gpfs_fileset_in_doubt_bytes{fileset="PZS1003",fs="project"} 0
 gpfs_fileset_in_doubt_bytes{fileset="root",fs="project"} 167772160
@@ -252,7 +407,7 @@ gpfs_fileset_in_doubt_bytes{fileset="root",fs="scratch"} 5436323758080
 gpfs_fileset_in_doubt_files{fileset="PZS1003",fs="project"} 0
 gpfs_fileset_in_doubt_files{fileset="root",fs="project"} 400
 gpfs_fileset_in_doubt_files{fileset="root",fs="scratch"} 140497
-# HELP gpfs_fileset_limit_bytes GPFS fileset quota block limit
+# HELP gpfs_fileset_limit_bytes GPFS fileset quota block limit in bytes
 # TYPE gpfs_fileset_limit_bytes gauge
 gpfs_fileset_limit_bytes{fileset="PZS1003",fs="project"} 2199023255552
 gpfs_fileset_limit_bytes{fileset="root",fs="project"} 0
@@ -262,7 +417,7 @@ gpfs_fileset_limit_bytes{fileset="root",fs="scratch"} 0
 gpfs_fileset_limit_files{fileset="PZS1003",fs="project"} 2000000
 gpfs_fileset_limit_files{fileset="root",fs="project"} 0
 gpfs_fileset_limit_files{fileset="root",fs="scratch"} 0
-# HELP gpfs_fileset_quota_bytes GPFS fileset block quota
+# HELP gpfs_fileset_quota_bytes GPFS fileset block quota in bytes
 # TYPE gpfs_fileset_quota_bytes gauge
 gpfs_fileset_quota_bytes{fileset="PZS1003",fs="project"} 2199023255552
 gpfs_fileset_quota_bytes{fileset="root",fs="project"} 0
@@ -272,7 +427,7 @@ gpfs_fileset_quota_bytes{fileset="root",fs="scratch"} 0
 gpfs_fileset_quota_files{fileset="PZS1003",fs="project"} 2000000
 gpfs_fileset_quota_files{fileset="root",fs="project"} 0
 gpfs_fileset_quota_files{fileset="root",fs="scratch"} 0
-# HELP gpfs_fileset_used_bytes GPFS fileset quota used
+# HELP gpfs_fileset_used_bytes GPFS fileset quota used in bytes
 # TYPE gpfs_fileset_used_bytes gauge
 gpfs_fileset_used_bytes{fileset="PZS1003",fs="project"} 349663100928
 gpfs_fileset_used_bytes{fileset="root",fs="project"} 345517817856
@@ -282,7 +437,7 @@ gpfs_fileset_used_bytes{fileset="root",fs="scratch"} 950512941268992
 gpfs_fileset_used_files{fileset="PZS1003",fs="project"} 6286
 gpfs_fileset_used_files{fileset="root",fs="project"} 1395
 gpfs_fileset_used_files{fileset="root",fs="scratch"} 141909093
-# HELP gpfs_group_in_doubt_bytes GPFS group quota block in doubt
+# HELP gpfs_group_in_doubt_bytes GPFS group quota block in doubt in bytes
 # TYPE gpfs_group_in_doubt_bytes gauge
 gpfs_group_in_doubt_bytes{fileset="bar",fs="project",group="PZS1003"} 0
 gpfs_group_in_doubt_bytes{fileset="bar",fs="project",group="root"} 1.6777216e+08
@@ -296,7 +451,7 @@ gpfs_group_in_doubt_files{fileset="bar",fs="project",group="root"} 400
 gpfs_group_in_doubt_files{fileset="foo",fs="project",group="PZS1003"} 0
 gpfs_group_in_doubt_files{fileset="foo",fs="project",group="root"} 400
 gpfs_group_in_doubt_files{fileset="tmpdir",fs="scratch",group="root"} 140497
-# HELP gpfs_group_limit_bytes GPFS group quota block limit
+# HELP gpfs_group_limit_bytes GPFS group quota block limit in bytes
 # TYPE gpfs_group_limit_bytes gauge
 gpfs_group_limit_bytes{fileset="bar",fs="project",group="PZS1003"} 2.199023255552e+12
 gpfs_group_limit_bytes{fileset="bar",fs="project",group="root"} 0
@@ -310,7 +465,7 @@ gpfs_group_limit_files{fileset="bar",fs="project",group="root"} 0
 gpfs_group_limit_files{fileset="foo",fs="project",group="PZS1003"} 2e+06
 gpfs_group_limit_files{fileset="foo",fs="project",group="root"} 0
 gpfs_group_limit_files{fileset="tmpdir",fs="scratch",group="root"} 0
-# HELP gpfs_group_quota_bytes GPFS group block quota
+# HELP gpfs_group_quota_bytes GPFS group block quota in bytes
 # TYPE gpfs_group_quota_bytes gauge
 gpfs_group_quota_bytes{fileset="bar",fs="project",group="PZS1003"} 2.199023255552e+12
 gpfs_group_quota_bytes{fileset="bar",fs="project",group="root"} 0
@@ -324,7 +479,7 @@ gpfs_group_quota_files{fileset="bar",fs="project",group="root"} 0
 gpfs_group_quota_files{fileset="foo",fs="project",group="PZS1003"} 2e+06
 gpfs_group_quota_files{fileset="foo",fs="project",group="root"} 0
 gpfs_group_quota_files{fileset="tmpdir",fs="scratch",group="root"} 0
-# HELP gpfs_group_used_bytes GPFS group quota used
+# HELP gpfs_group_used_bytes GPFS group quota used in bytes
 # TYPE gpfs_group_used_bytes gauge
 gpfs_group_used_bytes{fileset="bar",fs="project",group="PZS1003"} 3.49663100928e+11
 gpfs_group_used_bytes{fileset="bar",fs="project",group="root"} 3.45517817856e+11
@@ -338,7 +493,7 @@ gpfs_group_used_files{fileset="bar",fs="project",group="root"} 1395
 gpfs_group_used_files{fileset="foo",fs="project",group="PZS1003"} 6286
 gpfs_group_used_files{fileset="foo",fs="project",group="root"} 1395
 gpfs_group_used_files{fileset="tmpdir",fs="scratch",group="root"} 1.41909093e+08
-# HELP gpfs_user_in_doubt_bytes GPFS user quota block in doubt
+# HELP gpfs_user_in_doubt_bytes GPFS user quota block in doubt in bytes
 # TYPE gpfs_user_in_doubt_bytes gauge
 gpfs_user_in_doubt_bytes{fileset="bar",fs="home",user="PZS1003"} 0
 gpfs_user_in_doubt_bytes{fileset="bar",fs="home",user="root"} 1.6777216e+08
@@ -352,7 +507,7 @@ gpfs_user_in_doubt_files{fileset="bar",fs="home",user="root"} 400
 gpfs_user_in_doubt_files{fileset="foo",fs="home",user="PZS1003"} 0
 gpfs_user_in_doubt_files{fileset="foo",fs="home",user="root"} 400
 gpfs_user_in_doubt_files{fileset="tmpdir",fs="scratch",user="root"} 140497
-# HELP gpfs_user_limit_bytes GPFS user quota block limit
+# HELP gpfs_user_limit_bytes GPFS user quota block limit in bytes
 # TYPE gpfs_user_limit_bytes gauge
 gpfs_user_limit_bytes{fileset="bar",fs="home",user="PZS1003"} 2.199023255552e+12
 gpfs_user_limit_bytes{fileset="bar",fs="home",user="root"} 0
@@ -366,7 +521,7 @@ gpfs_user_limit_files{fileset="bar",fs="home",user="root"} 0
 gpfs_user_limit_files{fileset="foo",fs="home",user="PZS1003"} 2e+06
 gpfs_user_limit_files{fileset="foo",fs="home",user="root"} 0
 gpfs_user_limit_files{fileset="tmpdir",fs="scratch",user="root"} 0
-# HELP gpfs_user_quota_bytes GPFS user block quota
+# HELP gpfs_user_quota_bytes GPFS user block quota in bytes
 # TYPE gpfs_user_quota_bytes gauge
 gpfs_user_quota_bytes{fileset="bar",fs="home",user="PZS1003"} 2.199023255552e+12
 gpfs_user_quota_bytes{fileset="bar",fs="home",user="root"} 0
@@ -380,7 +535,7 @@ gpfs_user_quota_files{fileset="bar",fs="home",user="root"} 0
 gpfs_user_quota_files{fileset="foo",fs="home",user="PZS1003"} 2e+06
 gpfs_user_quota_files{fileset="foo",fs="home",user="root"} 0
 gpfs_user_quota_files{fileset="tmpdir",fs="scratch",user="root"} 0
-# HELP gpfs_user_used_bytes GPFS user quota used
+# HELP gpfs_user_used_bytes GPFS user quota used in bytes
 # TYPE gpfs_user_used_bytes gauge
 gpfs_user_used_bytes{fileset="bar",fs="home",user="PZS1003"} 3.49663100928e+11
 gpfs_user_used_bytes{fileset="bar",fs="home",user="root"} 3.45517817856e+11
@@ -400,8 +555,8 @@ gpfs_user_used_files{fileset="tmpdir",fs="scratch",user="root"} 1.41909093e+08
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
-	} else if val != 107 {
-		t.Errorf("Unexpected collection count %d, expected 107", val)
+	} else if val != 142 {
+		t.Errorf("Unexpected collection count %d, expected 142", val)
 	}
 	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
 		"gpfs_exporter_collect_error", "gpfs_exporter_collect_timeout",
@@ -424,6 +579,363 @@ gpfs_user_used_files{fileset="tmpdir",fs="scratch",user="root"} 1.41909093e+08
 	}
 }
 
+func TestMmrepquotaCollectorIncludeID(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.mmrepquota.include-id", "--collector.mmrepquota.quota-types=user"}); err != nil {
+		t.Fatal(err)
+	}
+	mmrepquotaExec = func(ctx context.Context, typeArg string) (string, error) {
+		return mmrepquotaStdoutAll, nil
+	}
+	expected := `
+# HELP gpfs_fileset_used_files GPFS fileset quota files used
+# TYPE gpfs_fileset_used_files gauge
+gpfs_fileset_used_files{fileset="PZS1003",fs="project",id="408"} 6286
+gpfs_fileset_used_files{fileset="root",fs="project",id="0"} 1395
+gpfs_fileset_used_files{fileset="root",fs="scratch",id="0"} 141909093
+# HELP gpfs_user_used_files GPFS user quota files used
+# TYPE gpfs_user_used_files gauge
+gpfs_user_used_files{fileset="bar",fs="home",id="0",user="root"} 1395
+gpfs_user_used_files{fileset="bar",fs="home",id="408",user="PZS1003"} 6286
+gpfs_user_used_files{fileset="foo",fs="home",id="0",user="root"} 1395
+gpfs_user_used_files{fileset="foo",fs="home",id="408",user="PZS1003"} 6286
+gpfs_user_used_files{fileset="tmpdir",fs="scratch",id="0",user="root"} 141909093
+`
+	collector := NewMmrepquotaCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
+		"gpfs_fileset_used_files", "gpfs_user_used_files"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestMmrepquotaCollectorUsers(t *testing.T) {
+	args := []string{"--collector.mmrepquota.quota-types=user,group", "--collector.mmrepquota.users=PZS1003, svc01", "--collector.mmrepquota.groups=root"}
+	if _, err := kingpin.CommandLine.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	mmrepquotaExec = func(ctx context.Context, typeArg string) (string, error) {
+		if typeArg == "-u" {
+			return mmrepquotaStdoutAll, nil
+		}
+		return "", nil
+	}
+	expected := `
+# HELP gpfs_fileset_used_files GPFS fileset quota files used
+# TYPE gpfs_fileset_used_files gauge
+gpfs_fileset_used_files{fileset="PZS1003",fs="project"} 6286
+gpfs_fileset_used_files{fileset="root",fs="project"} 1395
+gpfs_fileset_used_files{fileset="root",fs="scratch"} 141909093
+# HELP gpfs_group_quota_missing GPFS group set by collector.mmrepquota.groups has no quota record on the filesystem
+# TYPE gpfs_group_quota_missing gauge
+gpfs_group_quota_missing{fs="project",group="root"} 0
+gpfs_group_quota_missing{fs="scratch",group="root"} 0
+# HELP gpfs_group_used_files GPFS group quota files used
+# TYPE gpfs_group_used_files gauge
+gpfs_group_used_files{fileset="bar",fs="project",group="root"} 1395
+gpfs_group_used_files{fileset="foo",fs="project",group="root"} 1395
+gpfs_group_used_files{fileset="tmpdir",fs="scratch",group="root"} 141909093
+# HELP gpfs_user_quota_missing GPFS user set by collector.mmrepquota.users has no quota record on the filesystem
+# TYPE gpfs_user_quota_missing gauge
+gpfs_user_quota_missing{fs="home",user="PZS1003"} 0
+gpfs_user_quota_missing{fs="home",user="svc01"} 1
+gpfs_user_quota_missing{fs="scratch",user="PZS1003"} 1
+gpfs_user_quota_missing{fs="scratch",user="svc01"} 1
+# HELP gpfs_user_used_files GPFS user quota files used
+# TYPE gpfs_user_used_files gauge
+gpfs_user_used_files{fileset="bar",fs="home",user="PZS1003"} 6286
+gpfs_user_used_files{fileset="foo",fs="home",user="PZS1003"} 6286
+`
+	collector := NewMmrepquotaCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
+		"gpfs_fileset_used_files", "gpfs_user_used_files", "gpfs_user_quota_missing",
+		"gpfs_group_used_files", "gpfs_group_quota_missing"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestFilterQuotaNames(t *testing.T) {
+	metrics, err := parse_mmrepquota(mmrepquotaStdoutAll, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	filtered, missing := filterQuotaNames(metrics, nil, nil)
+	if len(filtered) != len(metrics) || len(missing) != 0 {
+		t.Errorf("Unexpected filtering without names, got %d records and %d missing", len(filtered), len(missing))
+	}
+}
+
+func TestMmrepquotaCollectorMinUsage(t *testing.T) {
+	args := []string{"--collector.mmrepquota.min-block-usage=1000000000000000", "--collector.mmrepquota.min-files-usage=200000000"}
+	if _, err := kingpin.CommandLine.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	defer quotaRecordsSkipped.Reset()
+	mmrepquotaExec = func(ctx context.Context, typeArg string) (string, error) {
+		return mmrepquotaStdout, nil
+	}
+	expected := `
+# HELP gpfs_fileset_used_files GPFS fileset quota files used
+# TYPE gpfs_fileset_used_files gauge
+gpfs_fileset_used_files{fileset="PZS1003",fs="project"} 6286
+# HELP gpfs_quota_records_skipped_total Number of mmrepquota records skipped for being below the minimum usage thresholds
+# TYPE gpfs_quota_records_skipped_total counter
+gpfs_quota_records_skipped_total{type="fileset"} 2
+`
+	collector := NewMmrepquotaCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
+		"gpfs_fileset_used_files", "gpfs_quota_records_skipped_total"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestQuotaSkip(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.mmrepquota.min-block-usage=1024", "--collector.mmrepquota.min-files-usage=10"}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		metric QuotaMetric
+		skip   bool
+	}{
+		{QuotaMetric{BlockUsage: 512, FilesUsage: 5}, true},
+		{QuotaMetric{BlockUsage: 2048, FilesUsage: 5}, false},
+		{QuotaMetric{BlockUsage: 512, FilesUsage: 20}, false},
+		{QuotaMetric{BlockUsage: 512, FilesUsage: 5, BlockQuota: 1024}, false},
+		{QuotaMetric{BlockUsage: 512, FilesUsage: 5, FilesQuota: 100}, false},
+		{QuotaMetric{BlockUsage: 512, FilesUsage: 5, BlockLimit: 256}, false},
+		{QuotaMetric{BlockUsage: 512, FilesUsage: 5, FilesLimit: 2}, false},
+	}
+	for i, test := range tests {
+		if skip := quotaSkip(test.metric); skip != test.skip {
+			t.Errorf("Test %d: unexpected skip %v, expected %v", i, skip, test.skip)
+		}
+	}
+}
+
+func TestParseMmrepquotaIncomplete(t *testing.T) {
+	truncated := mmrepquotaStdoutAll[:strings.Index(mmrepquotaStdoutAll, "2147483648:0:none:6286")]
+	noHeader := strings.Replace(mmrepquotaStdoutAll,
+		"*** Report for GRP quotas on scratch\nmmrepquota::HEADER", "*** Report for GRP quotas on scratch\n*** Report for GRP quotas on home\nmmrepquota::HEADER", 1)
+	tests := map[string]string{
+		truncated: "values of the last row",
+		noHeader:  "header for Report for GRP quotas on scratch",
+	}
+	for out, missing := range tests {
+		metrics, err := parse_mmrepquota(out, log.NewNopLogger())
+		var incompleteErr *IncompleteOutputError
+		if !errors.As(err, &incompleteErr) {
+			t.Errorf("Expected IncompleteOutputError, got %v", err)
+			continue
+		}
+		if !SliceContains(incompleteErr.Missing, missing) {
+			t.Errorf("Expected missing %s, got %v", missing, incompleteErr.Missing)
+		}
+		if len(metrics) != 0 {
+			t.Errorf("Unexpected metrics for incomplete output, got %d", len(metrics))
+		}
+	}
+}
+
+func TestMMrepquotaCollectorIncomplete(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	defer parseIncomplete.Reset()
+	mmrepquotaExec = func(ctx context.Context, typeArg string) (string, error) {
+		return mmrepquotaStdout[:len(mmrepquotaStdout)-20], nil
+	}
+	expected := `
+		# HELP gpfs_exporter_collect_error Indicates if error has occurred during collection
+		# TYPE gpfs_exporter_collect_error gauge
+		gpfs_exporter_collect_error{collector="mmrepquota"} 1
+		# HELP gpfs_exporter_collect_error_reason Indicates the reason for a collection error or timeout
+		# TYPE gpfs_exporter_collect_error_reason gauge
+		gpfs_exporter_collect_error_reason{collector="mmrepquota",reason="gpfs_down"} 0
+		gpfs_exporter_collect_error_reason{collector="mmrepquota",reason="not_found"} 0
+		gpfs_exporter_collect_error_reason{collector="mmrepquota",reason="other"} 0
+		gpfs_exporter_collect_error_reason{collector="mmrepquota",reason="parse"} 1
+		gpfs_exporter_collect_error_reason{collector="mmrepquota",reason="permission"} 0
+		gpfs_exporter_collect_error_reason{collector="mmrepquota",reason="timeout"} 0
+	`
+	collector := NewMmrepquotaCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
+		"gpfs_exporter_collect_error", "gpfs_exporter_collect_error_reason", "gpfs_fileset_used_bytes"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+	if val := testutil.ToFloat64(parseIncomplete.WithLabelValues("mmrepquota")); val != 1 {
+		t.Errorf("Unexpected parse incomplete value %v", val)
+	}
+}
+
+func TestMmrepquotaCollectorEnforced(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.mmrepquota.quota-types=fileset,user,group"}); err != nil {
+		t.Fatal(err)
+	}
+	reports := map[string]string{"-j": "FILESET", "-u": "USR", "-g": "GRP"}
+	mmrepquotaExec = func(ctx context.Context, typeArg string) (string, error) {
+		for _, report := range strings.Split(mmrepquotaStdoutEnforced, "*** Report for ") {
+			if strings.HasPrefix(report, reports[typeArg]+" ") {
+				return "*** Report for " + report, nil
+			}
+		}
+		return "", nil
+	}
+	expected := `
+# HELP gpfs_fileset_default_quota GPFS fileset default quota is on
+# TYPE gpfs_fileset_default_quota gauge
+gpfs_fileset_default_quota{fileset="PZS1003",fs="project"} 1
+gpfs_fileset_default_quota{fileset="root",fs="project"} 0
+# HELP gpfs_fileset_quota_enforced GPFS fileset quota is enforced
+# TYPE gpfs_fileset_quota_enforced gauge
+gpfs_fileset_quota_enforced{fileset="PZS1003",fs="project"} 1
+gpfs_fileset_quota_enforced{fileset="root",fs="project"} 0
+# HELP gpfs_group_quota_enforced GPFS group quota is enforced
+# TYPE gpfs_group_quota_enforced gauge
+gpfs_group_quota_enforced{fileset="root",fs="project",group="group1"} 1
+gpfs_group_quota_enforced{fileset="root",fs="project",group="root"} 0
+# HELP gpfs_user_quota_enforced GPFS user quota is enforced
+# TYPE gpfs_user_quota_enforced gauge
+gpfs_user_quota_enforced{fileset="root",fs="project",user="root"} 0
+gpfs_user_quota_enforced{fileset="root",fs="project",user="user1"} 1
+`
+	collector := NewMmrepquotaCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
+		"gpfs_fileset_default_quota", "gpfs_fileset_quota_enforced", "gpfs_user_quota_enforced", "gpfs_group_quota_enforced"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestSplitQuotaDefaults(t *testing.T) {
+	metrics, err := parse_mmrepquota(mmrepquotaStdoutDefaults, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	entities, defaults := splitQuotaDefaults(metrics)
+	var names []string
+	for _, m := range entities {
+		names = append(names, m.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"PZS1003", "user1", "user2"}) {
+		t.Errorf("Unexpected entities %v", names)
+	}
+	names = nil
+	for _, m := range defaults {
+		names = append(names, m.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"DEFAULT", "default"}) {
+		t.Errorf("Unexpected defaults %v", names)
+	}
+}
+
+func TestMmrepquotaCollectorDefaultRows(t *testing.T) {
+	tests := map[string][]string{
+		"skip":    {"--collector.mmrepquota.quota-types=fileset,user"},
+		"include": {"--collector.mmrepquota.quota-types=fileset,user", "--collector.mmrepquota.include-defaults"},
+	}
+	reports := map[string]string{"-j": "FILESET", "-u": "USR"}
+	mmrepquotaExec = func(ctx context.Context, typeArg string) (string, error) {
+		for _, report := range strings.Split(mmrepquotaStdoutDefaults, "*** Report for ") {
+			if strings.HasPrefix(report, reports[typeArg]+" ") {
+				return "*** Report for " + report, nil
+			}
+		}
+		return "", nil
+	}
+	used := `
+# HELP gpfs_fileset_used_bytes GPFS fileset quota used in bytes
+# TYPE gpfs_fileset_used_bytes gauge
+gpfs_fileset_used_bytes{fileset="PZS1003",fs="project"} 349663100928
+# HELP gpfs_user_used_bytes GPFS user quota used in bytes
+# TYPE gpfs_user_used_bytes gauge
+gpfs_user_used_bytes{fileset="root",fs="project",user="user1"} 1048576
+gpfs_user_used_bytes{fileset="root",fs="project",user="user2"} 524288
+`
+	defaults := `
+# HELP gpfs_fileset_default_entry_quota_bytes GPFS fileset default quota entry block quota in bytes
+# TYPE gpfs_fileset_default_entry_quota_bytes gauge
+gpfs_fileset_default_entry_quota_bytes{fileset="DEFAULT",fs="project"} 1099511627776
+# HELP gpfs_fileset_default_used_bytes GPFS fileset default quota entry used in bytes
+# TYPE gpfs_fileset_default_used_bytes gauge
+gpfs_fileset_default_used_bytes{fileset="DEFAULT",fs="project"} 0
+# HELP gpfs_user_default_limit_files GPFS user default quota entry files limit
+# TYPE gpfs_user_default_limit_files gauge
+gpfs_user_default_limit_files{fileset="root",fs="project",user="default"} 200
+`
+	for name, args := range tests {
+		if _, err := kingpin.CommandLine.Parse(args); err != nil {
+			t.Fatal(err)
+		}
+		expected := used
+		if name == "include" {
+			expected = used + defaults
+		}
+		collector := NewMmrepquotaCollector(log.NewNopLogger())
+		gatherers := setupGatherer(collector)
+		if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
+			"gpfs_fileset_used_bytes", "gpfs_user_used_bytes", "gpfs_fileset_default_used_bytes",
+			"gpfs_fileset_default_entry_quota_bytes", "gpfs_user_default_limit_files"); err != nil {
+			t.Errorf("%s: unexpected collecting result:\n%s", name, err)
+		}
+		if name == "include" {
+			if val, err := testutil.GatherAndCount(gatherers); err != nil {
+				t.Errorf("%s: Unexpected error: %v", name, err)
+			} else if val != 62 {
+				t.Errorf("%s: Unexpected collection count %d, expected 62", name, val)
+			}
+		}
+	}
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMmrepquotaCollectorUsageRatio(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.mmrepquota.quota-types=fileset,user,group"}); err != nil {
+		t.Fatal(err)
+	}
+	out := strings.Replace(mmrepquotaStdoutEnforced, ":user1:1024:2048:4096:0:none:10:100:200:0:", ":user1:1024:2048:4096:512:none:10:100:200:10:", 1)
+	reports := map[string]string{"-j": "FILESET", "-u": "USR", "-g": "GRP"}
+	mmrepquotaExec = func(ctx context.Context, typeArg string) (string, error) {
+		for _, report := range strings.Split(out, "*** Report for ") {
+			if strings.HasPrefix(report, reports[typeArg]+" ") {
+				return "*** Report for " + report, nil
+			}
+		}
+		return "", nil
+	}
+	expected := `
+# HELP gpfs_fileset_block_usage_ratio GPFS fileset block usage including in doubt as a ratio of the block quota
+# TYPE gpfs_fileset_block_usage_ratio gauge
+gpfs_fileset_block_usage_ratio{fileset="PZS1003",fs="project"} 0.15900836884975433
+# HELP gpfs_fileset_files_usage_ratio GPFS fileset files usage including in doubt as a ratio of the files quota
+# TYPE gpfs_fileset_files_usage_ratio gauge
+gpfs_fileset_files_usage_ratio{fileset="PZS1003",fs="project"} 0.003143
+# HELP gpfs_group_block_usage_ratio GPFS group block usage including in doubt as a ratio of the block quota
+# TYPE gpfs_group_block_usage_ratio gauge
+gpfs_group_block_usage_ratio{fileset="root",fs="project",group="group1"} 0.5
+# HELP gpfs_group_files_usage_ratio GPFS group files usage including in doubt as a ratio of the files quota
+# TYPE gpfs_group_files_usage_ratio gauge
+gpfs_group_files_usage_ratio{fileset="root",fs="project",group="group1"} 0.1
+# HELP gpfs_user_block_usage_ratio GPFS user block usage including in doubt as a ratio of the block quota
+# TYPE gpfs_user_block_usage_ratio gauge
+gpfs_user_block_usage_ratio{fileset="root",fs="project",user="user1"} 0.75
+# HELP gpfs_user_files_usage_ratio GPFS user files usage including in doubt as a ratio of the files quota
+# TYPE gpfs_user_files_usage_ratio gauge
+gpfs_user_files_usage_ratio{fileset="root",fs="project",user="user1"} 0.2
+`
+	collector := NewMmrepquotaCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
+		"gpfs_fileset_block_usage_ratio", "gpfs_fileset_files_usage_ratio",
+		"gpfs_user_block_usage_ratio", "gpfs_user_files_usage_ratio",
+		"gpfs_group_block_usage_ratio", "gpfs_group_files_usage_ratio"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
 func TestMMrepquotaCollectorError(t *testing.T) {
 	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
 		t.Fatal(err)
@@ -440,8 +952,8 @@ func TestMMrepquotaCollectorError(t *testing.T) {
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
-	} else if val != 3 {
-		t.Errorf("Unexpected collection count %d, expected 3", val)
+	} else if val != 12 {
+		t.Errorf("Unexpected collection count %d, expected 12", val)
 	}
 	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
 		"gpfs_exporter_collect_error", "gpfs_fileset_used_bytes"); err != nil {
@@ -449,6 +961,29 @@ func TestMMrepquotaCollectorError(t *testing.T) {
 	}
 }
 
+func TestMMrepquotaCollectorEmpty(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	mmrepquotaExec = func(ctx context.Context, typeArg string) (string, error) {
+		return "", nil
+	}
+	expected := `
+		# HELP gpfs_exporter_collect_error Indicates if error has occurred during collection
+		# TYPE gpfs_exporter_collect_error gauge
+		gpfs_exporter_collect_error{collector="mmrepquota"} 0
+		# HELP gpfs_exporter_collect_success Indicates the collector completed without error or timeout and parsed at least one record
+		# TYPE gpfs_exporter_collect_success gauge
+		gpfs_exporter_collect_success{collector="mmrepquota"} 0
+	`
+	collector := NewMmrepquotaCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
+		"gpfs_exporter_collect_error", "gpfs_exporter_collect_success"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
 func TestMMrepquotaCollectorTimeout(t *testing.T) {
 	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
 		t.Fatal(err)
@@ -465,8 +1000,8 @@ func TestMMrepquotaCollectorTimeout(t *testing.T) {
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
-	} else if val != 3 {
-		t.Errorf("Unexpected collection count %d, expected 3", val)
+	} else if val != 12 {
+		t.Errorf("Unexpected collection count %d, expected 12", val)
 	}
 	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
 		"gpfs_exporter_collect_timeout", "gpfs_fileset_used_bytes"); err != nil {
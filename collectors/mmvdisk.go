@@ -0,0 +1,253 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	mmvdiskTimeout   = kingpin.Flag("collector.mmvdisk.timeout", "Timeout for executing mmvdisk").Default("30").Int()
+	mmvdiskDAMetrics = kingpin.Flag("collector.mmvdisk.da-metrics", "Collect declustered array space for each recovery group").Default("false").Bool()
+	MmvdiskExec      = mmvdisk
+	MmvdiskDAExec    = mmvdiskDA
+)
+
+type RecoveryGroupMetric struct {
+	Name         string
+	ActiveServer string
+	Paused       float64
+	Vdisks       float64
+}
+
+type DeclusteredArrayMetric struct {
+	RG   string
+	DA   string
+	Size float64
+	Free float64
+}
+
+type MmvdiskCollector struct {
+	Info   *prometheus.Desc
+	Paused *prometheus.Desc
+	Vdisks *prometheus.Desc
+	DASize *prometheus.Desc
+	DAFree *prometheus.Desc
+	logger log.Logger
+}
+
+func init() {
+	registerCollector("mmvdisk", false, NewMmvdiskCollector)
+}
+
+func NewMmvdiskCollector(logger log.Logger) Collector {
+	return &MmvdiskCollector{
+		Info: newDesc(prometheus.BuildFQName(namespace, "recoverygroup", "info"),
+			"GPFS recovery group information", []string{"rg", "active_server"}, nil),
+		Paused: newDesc(prometheus.BuildFQName(namespace, "recoverygroup", "paused"),
+			"GPFS recovery group is paused or resigned", []string{"rg"}, nil),
+		Vdisks: newDesc(prometheus.BuildFQName(namespace, "recoverygroup", "vdisks"),
+			"GPFS recovery group number of vdisks", []string{"rg"}, nil),
+		DASize: newDesc(prometheus.BuildFQName(namespace, "recoverygroup", "da_size_bytes"),
+			"GPFS recovery group declustered array size in bytes", []string{"rg", "da"}, nil),
+		DAFree: newDesc(prometheus.BuildFQName(namespace, "recoverygroup", "da_free_bytes"),
+			"GPFS recovery group declustered array free space in bytes", []string{"rg", "da"}, nil),
+		logger: logger,
+	}
+}
+
+func (c *MmvdiskCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.Info
+	ch <- c.Paused
+	ch <- c.Vdisks
+	if *mmvdiskDAMetrics {
+		ch <- c.DASize
+		ch <- c.DAFree
+	}
+}
+
+func (c *MmvdiskCollector) Collect(ch chan<- prometheus.Metric) {
+	level.Debug(c.logger).Log("msg", "Collecting mmvdisk metrics")
+	collectTime := time.Now()
+	rgs, das, err := c.collect()
+	if err == context.DeadlineExceeded {
+		level.Error(c.logger).Log("msg", "Timeout executing mmvdisk")
+	} else if err != nil {
+		level.Error(c.logger).Log("msg", err)
+	}
+	for _, rg := range rgs {
+		ch <- prometheus.MustNewConstMetric(c.Info, prometheus.GaugeValue, 1, rg.Name, rg.ActiveServer)
+		ch <- prometheus.MustNewConstMetric(c.Paused, prometheus.GaugeValue, rg.Paused, rg.Name)
+		ch <- prometheus.MustNewConstMetric(c.Vdisks, prometheus.GaugeValue, rg.Vdisks, rg.Name)
+	}
+	for _, da := range das {
+		ch <- prometheus.MustNewConstMetric(c.DASize, prometheus.GaugeValue, da.Size, da.RG, da.DA)
+		ch <- prometheus.MustNewConstMetric(c.DAFree, prometheus.GaugeValue, da.Free, da.RG, da.DA)
+	}
+	emitCollectorStatus(ch, "mmvdisk", err, collectTime, len(rgs))
+}
+
+func (c *MmvdiskCollector) collect() ([]RecoveryGroupMetric, []DeclusteredArrayMetric, error) {
+	ctx, cancel := commandContext("mmvdisk", *mmvdiskTimeout)
+	defer cancel()
+	out, err := execRetry(ctx, "mmvdisk", func() (string, error) {
+		return MmvdiskExec(ctx)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	commandDump.record("mmvdisk-recoverygroup", out)
+	rgs := parse_mmvdisk_rg(out, c.logger)
+	commandDump.recordParsed("mmvdisk-recoverygroup", rgs)
+	if !*mmvdiskDAMetrics {
+		return rgs, nil, nil
+	}
+	var das []DeclusteredArrayMetric
+	for _, rg := range rgs {
+		out, err := execRetry(ctx, "mmvdisk", func() (string, error) {
+			return MmvdiskDAExec(rg.Name, ctx)
+		})
+		if err != nil {
+			return rgs, das, err
+		}
+		commandDump.record("mmvdisk-da-"+rg.Name, out)
+		rgDAs := parse_mmvdisk_da(rg.Name, out, c.logger)
+		commandDump.recordParsed("mmvdisk-da-"+rg.Name, rgDAs)
+		das = append(das, rgDAs...)
+	}
+	return rgs, das, nil
+}
+
+// mmvdisk lists recovery groups with mmvdisk, falling back to mmlsrecoverygroup
+// on older ESS software stacks that do not provide mmvdisk
+func mmvdisk(ctx context.Context) (string, error) {
+	out, err := RunMMCommand(ctx, "mmvdisk", "recoverygroup", "list", "-Y")
+	if err == nil || errorReason(err) != "not_found" {
+		return out, err
+	}
+	return RunMMCommand(ctx, "mmlsrecoverygroup", "-Y")
+}
+
+func mmvdiskDA(rg string, ctx context.Context) (string, error) {
+	return RunMMCommand(ctx, "mmvdisk", "recoverygroup", "list", "--recovery-group", rg, "--declustered-array", "-Y")
+}
+
+// mmvdisk_sections returns the command that produced out and the rows of section as maps of header to value
+func mmvdisk_sections(out string, section string) (string, []map[string]string) {
+	var command string
+	var rows []map[string]string
+	var headers []string
+	lines := strings.Split(out, "\n")
+	for _, l := range lines {
+		if !strings.HasPrefix(l, "mmvdisk:") && !strings.HasPrefix(l, "mmlsrecoverygroup:") {
+			continue
+		}
+		items := strings.Split(l, ":")
+		if len(items) < 7 || items[1] != section {
+			continue
+		}
+		command = items[0]
+		if items[2] == "HEADER" {
+			headers = items
+			continue
+		}
+		row := make(map[string]string)
+		for i, h := range headers {
+			if i < 6 || i >= len(items) || h == "" {
+				continue
+			}
+			row[h] = items[i]
+		}
+		rows = append(rows, row)
+	}
+	return command, rows
+}
+
+func mmvdisk_value(row map[string]string, headers ...string) string {
+	for _, h := range headers {
+		if value, ok := row[h]; ok {
+			return value
+		}
+	}
+	return ""
+}
+
+func parse_mmvdisk_rg(out string, logger log.Logger) []RecoveryGroupMetric {
+	var metrics []RecoveryGroupMetric
+	command, rows := mmvdisk_sections(out, "recoveryGroup")
+	for _, row := range rows {
+		var metric RecoveryGroupMetric
+		var vdisks string
+		if command == "mmlsrecoverygroup" {
+			metric.Name = row["recoveryGroupName"]
+			metric.ActiveServer = row["activeRecoveryGroupServer"]
+			if state := strings.ToLower(row["state"]); strings.Contains(state, "paused") || strings.Contains(state, "resigned") {
+				metric.Paused = 1
+			}
+			vdisks = row["vdisks"]
+		} else {
+			metric.Name = row["recoveryGroup"]
+			metric.ActiveServer = row["currentServer"]
+			// A recovery group that is not active has been resigned by its servers
+			if row["active"] != "yes" {
+				metric.Paused = 1
+			}
+			vdisks = row["userVdisks"]
+		}
+		if metric.Name == "" {
+			continue
+		}
+		if vdisks != "" {
+			if val, err := strconv.ParseFloat(vdisks, 64); err == nil {
+				metric.Vdisks = val
+			} else {
+				level.Warn(logger).Log("msg", "Unable to parse recovery group vdisks", "rg", metric.Name, "value", vdisks, "err", err)
+				parseErrors.WithLabelValues("mmvdisk").Inc()
+			}
+		}
+		metrics = append(metrics, metric)
+	}
+	return metrics
+}
+
+func parse_mmvdisk_da(rg string, out string, logger log.Logger) []DeclusteredArrayMetric {
+	var metrics []DeclusteredArrayMetric
+	_, rows := mmvdisk_sections(out, "declusteredArray")
+	for _, row := range rows {
+		metric := DeclusteredArrayMetric{RG: rg}
+		metric.DA = row["declusteredArray"]
+		if metric.DA == "" {
+			continue
+		}
+		size, sizeErr := strconv.ParseFloat(row["totalRaw"], 64)
+		free, freeErr := strconv.ParseFloat(row["freeRaw"], 64)
+		if sizeErr != nil || freeErr != nil {
+			level.Warn(logger).Log("msg", "Unable to parse declustered array space", "rg", rg, "da", metric.DA)
+			parseErrors.WithLabelValues("mmvdisk").Inc()
+			continue
+		}
+		metric.Size = size
+		metric.Free = free
+		metrics = append(metrics, metric)
+	}
+	return metrics
+}
@@ -0,0 +1,241 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var (
+	mmvdiskStdout = `
+mmvdisk:recoveryGroup:HEADER:version:reserved:reserved:recoveryGroup:active:currentServer:needsService:userVdisks:remarks:
+mmvdisk:recoveryGroup:0:1:::ess01a:yes:ess01a-ib.example.com:no:4::
+mmvdisk:recoveryGroup:0:1:::ess01b:no:ess01a-ib.example.com:no:2::
+mmvdisk:recoveryGroup:0:1:::ess02a:no:ess02a-ib.example.com:yes:3::
+`
+	mmlsrecoverygroupStdout = `
+mmlsrecoverygroup:recoveryGroup:HEADER:version:reserved:reserved:recoveryGroupName:activeRecoveryGroupServer:state:vdisks:
+mmlsrecoverygroup:recoveryGroup:0:1:::rgL:gss01a-ib:active:5:
+mmlsrecoverygroup:recoveryGroup:0:1:::rgR:gss01a-ib:resigned:5:
+mmlsrecoverygroup:declusteredArray:HEADER:version:reserved:reserved:recoveryGroupName:declusteredArrayName:
+mmlsrecoverygroup:declusteredArray:0:1:::rgL:DA1:
+`
+	mmvdiskDAStdout = `
+mmvdisk:declusteredArray:HEADER:version:reserved:reserved:recoveryGroup:declusteredArray:needsService:vdisks:pdisks:spares:replaceThreshold:totalRaw:freeRaw:
+mmvdisk:declusteredArray:0:1:::ess01a:NVR:no:1:2:0:1:0:0:
+mmvdisk:declusteredArray:0:1:::ess01a:DA1:no:4:44:2:2:659706976665600:21990232555520:
+`
+)
+
+func TestMmvdisk(t *testing.T) {
+	execCommand = fakeExecCommand
+	mockedExitStatus = 0
+	mockedStdout = "foo"
+	defer func() { execCommand = exec.CommandContext }()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out, err := mmvdisk(ctx)
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+	if out != mockedStdout {
+		t.Errorf("Unexpected out: %s", out)
+	}
+}
+
+func TestMmvdiskError(t *testing.T) {
+	execCommand = fakeExecCommand
+	mockedExitStatus = 1
+	mockedStdout = "foo"
+	defer func() { execCommand = exec.CommandContext }()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out, err := mmvdisk(ctx)
+	if err == nil {
+		t.Errorf("Expected error")
+	}
+	if out != "" {
+		t.Errorf("Unexpected out: %s", out)
+	}
+}
+
+func TestMmvdiskFallback(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		exitStatus int
+		fallback   bool
+	}{
+		{exitStatus: 127, fallback: true},
+		{exitStatus: 1, fallback: false},
+	}
+	defer func() { execCommand = exec.CommandContext }()
+	for _, test := range tests {
+		var commands []string
+		execCommand = func(ctx context.Context, command string, args ...string) *exec.Cmd {
+			commands = append(commands, strings.Join(args, " "))
+			mockedExitStatus = 0
+			if strings.Contains(strings.Join(args, " "), "mmvdisk") {
+				mockedExitStatus = test.exitStatus
+			}
+			return fakeExecCommand(ctx, command, args...)
+		}
+		mockedStdout = ""
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		_, err := mmvdisk(ctx)
+		cancel()
+		if fallback := len(commands) == 2; fallback != test.fallback {
+			t.Errorf("Unexpected fallback %v for exit status %d, commands %v", fallback, test.exitStatus, commands)
+		}
+		if test.fallback && err != nil {
+			t.Errorf("Unexpected error: %s", err.Error())
+		} else if !test.fallback && err == nil {
+			t.Errorf("Expected error for exit status %d", test.exitStatus)
+		}
+	}
+}
+
+func TestParseMmvdiskRG(t *testing.T) {
+	metrics := parse_mmvdisk_rg(mmvdiskStdout, log.NewNopLogger())
+	expected := []RecoveryGroupMetric{
+		{Name: "ess01a", ActiveServer: "ess01a-ib.example.com", Paused: 0, Vdisks: 4},
+		{Name: "ess01b", ActiveServer: "ess01a-ib.example.com", Paused: 1, Vdisks: 2},
+		{Name: "ess02a", ActiveServer: "ess02a-ib.example.com", Paused: 1, Vdisks: 3},
+	}
+	if !reflect.DeepEqual(metrics, expected) {
+		t.Errorf("Unexpected metrics\nGot: %v\nExpected: %v", metrics, expected)
+	}
+}
+
+func TestParseMmlsrecoverygroup(t *testing.T) {
+	metrics := parse_mmvdisk_rg(mmlsrecoverygroupStdout, log.NewNopLogger())
+	expected := []RecoveryGroupMetric{
+		{Name: "rgL", ActiveServer: "gss01a-ib", Paused: 0, Vdisks: 5},
+		{Name: "rgR", ActiveServer: "gss01a-ib", Paused: 1, Vdisks: 5},
+	}
+	if !reflect.DeepEqual(metrics, expected) {
+		t.Errorf("Unexpected metrics\nGot: %v\nExpected: %v", metrics, expected)
+	}
+}
+
+func TestMmvdiskCollector(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.mmvdisk.da-metrics"}); err != nil {
+		t.Fatal(err)
+	}
+	MmvdiskExec = func(ctx context.Context) (string, error) {
+		return mmvdiskStdout, nil
+	}
+	MmvdiskDAExec = func(rg string, ctx context.Context) (string, error) {
+		if rg == "ess01a" {
+			return mmvdiskDAStdout, nil
+		}
+		return "", nil
+	}
+	expected := `
+		# HELP gpfs_recoverygroup_da_free_bytes GPFS recovery group declustered array free space in bytes
+		# TYPE gpfs_recoverygroup_da_free_bytes gauge
+		gpfs_recoverygroup_da_free_bytes{da="DA1",rg="ess01a"} 21990232555520
+		gpfs_recoverygroup_da_free_bytes{da="NVR",rg="ess01a"} 0
+		# HELP gpfs_recoverygroup_da_size_bytes GPFS recovery group declustered array size in bytes
+		# TYPE gpfs_recoverygroup_da_size_bytes gauge
+		gpfs_recoverygroup_da_size_bytes{da="DA1",rg="ess01a"} 659706976665600
+		gpfs_recoverygroup_da_size_bytes{da="NVR",rg="ess01a"} 0
+		# HELP gpfs_recoverygroup_info GPFS recovery group information
+		# TYPE gpfs_recoverygroup_info gauge
+		gpfs_recoverygroup_info{active_server="ess01a-ib.example.com",rg="ess01a"} 1
+		gpfs_recoverygroup_info{active_server="ess01a-ib.example.com",rg="ess01b"} 1
+		gpfs_recoverygroup_info{active_server="ess02a-ib.example.com",rg="ess02a"} 1
+		# HELP gpfs_recoverygroup_paused GPFS recovery group is paused or resigned
+		# TYPE gpfs_recoverygroup_paused gauge
+		gpfs_recoverygroup_paused{rg="ess01a"} 0
+		gpfs_recoverygroup_paused{rg="ess01b"} 1
+		gpfs_recoverygroup_paused{rg="ess02a"} 1
+		# HELP gpfs_recoverygroup_vdisks GPFS recovery group number of vdisks
+		# TYPE gpfs_recoverygroup_vdisks gauge
+		gpfs_recoverygroup_vdisks{rg="ess01a"} 4
+		gpfs_recoverygroup_vdisks{rg="ess01b"} 2
+		gpfs_recoverygroup_vdisks{rg="ess02a"} 3
+	`
+	collector := NewMmvdiskCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 25 {
+		t.Errorf("Unexpected collection count %d, expected 25", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
+		"gpfs_recoverygroup_da_free_bytes", "gpfs_recoverygroup_da_size_bytes", "gpfs_recoverygroup_info",
+		"gpfs_recoverygroup_paused", "gpfs_recoverygroup_vdisks"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestMmvdiskCollectorError(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	MmvdiskExec = func(ctx context.Context) (string, error) {
+		return "", fmt.Errorf("Error")
+	}
+	expected := `
+		# HELP gpfs_exporter_collect_error Indicates if error has occurred during collection
+		# TYPE gpfs_exporter_collect_error gauge
+		gpfs_exporter_collect_error{collector="mmvdisk"} 1
+	`
+	collector := NewMmvdiskCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 12 {
+		t.Errorf("Unexpected collection count %d, expected 12", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collect_error"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestMmvdiskCollectorTimeout(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	MmvdiskExec = func(ctx context.Context) (string, error) {
+		return "", context.DeadlineExceeded
+	}
+	expected := `
+		# HELP gpfs_exporter_collect_timeout Indicates the collector timed out
+		# TYPE gpfs_exporter_collect_timeout gauge
+		gpfs_exporter_collect_timeout{collector="mmvdisk"} 1
+	`
+	collector := NewMmvdiskCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 12 {
+		t.Errorf("Unexpected collection count %d, expected 12", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collect_timeout"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
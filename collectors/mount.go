@@ -14,8 +14,9 @@
 package collectors
 
 import (
+	"context"
 	"fmt"
-	"strings"
+	"sort"
 	"time"
 
 	"github.com/alecthomas/kingpin/v2"
@@ -44,8 +45,8 @@ func init() {
 
 func NewMountCollector(logger log.Logger) Collector {
 	return &MountCollector{
-		fs_mount_status: prometheus.NewDesc(prometheus.BuildFQName(namespace, "mount", "status"),
-			"Status of GPFS filesystems, 1=mounted 0=not mounted", []string{"mount"}, nil),
+		fs_mount_status: newDesc(prometheus.BuildFQName(namespace, "mount", "status"),
+			"Status of GPFS filesystems, 1=mounted 0=not mounted", []string{"mount", "fs"}, nil),
 		logger: logger,
 	}
 }
@@ -56,19 +57,19 @@ func (c *MountCollector) Describe(ch chan<- *prometheus.Desc) {
 
 func (c *MountCollector) Collect(ch chan<- prometheus.Metric) {
 	level.Debug(c.logger).Log("msg", "Collecting mount metrics")
+	collectTime := time.Now()
 	err := c.collect(ch)
-	if err != nil {
+	if err == context.DeadlineExceeded {
+		level.Error(c.logger).Log("msg", "Timeout collecting mount information")
+	} else if err != nil {
 		level.Error(c.logger).Log("msg", err)
-		ch <- prometheus.MustNewConstMetric(collectError, prometheus.GaugeValue, 1, "mount")
-	} else {
-		ch <- prometheus.MustNewConstMetric(collectError, prometheus.GaugeValue, 0, "mount")
 	}
+	emitCollectorStatus(ch, "mount", err, collectTime, anyRecords)
 }
 
 func (c *MountCollector) collect(ch chan<- prometheus.Metric) error {
-	collectTime := time.Now()
-	var gpfsMounts []string
-	var gpfsMountsFstab []string
+	var gpfsMounts []GPFSFilesystem
+	var gpfsMountsFstab []GPFSFilesystem
 	var err error
 
 	c1 := make(chan int, 1)
@@ -93,43 +94,54 @@ func (c *MountCollector) collect(ch chan<- prometheus.Metric) error {
 	case <-time.After(time.Duration(*mountTimeout) * time.Second):
 		timeout = true
 		close(c1)
-		ch <- prometheus.MustNewConstMetric(collecTimeout, prometheus.GaugeValue, 1, "mount")
-		level.Error(c.logger).Log("msg", "Timeout collecting mount information")
-		return nil
+		return context.DeadlineExceeded
 	}
 	close(c1)
-	ch <- prometheus.MustNewConstMetric(collecTimeout, prometheus.GaugeValue, 0, "mount")
 
 	if err != nil {
-		level.Error(c.logger).Log("msg", err)
 		return err
 	}
 
+	// Filesystems of mount points, /proc/mounts is preferred over mmlsfs and /etc/fstab
+	mounted := make(map[string]bool)
+	filesystems := make(map[string]string)
 	var gpfsFoundMounts []string
-	for _, m := range gpfsMountsFstab {
-		if !SliceContains(gpfsFoundMounts, m) {
-			gpfsFoundMounts = append(gpfsFoundMounts, m)
+	addMount := func(m GPFSFilesystem) {
+		if _, ok := filesystems[m.Mountpoint]; !ok {
+			filesystems[m.Mountpoint] = m.Name
+			gpfsFoundMounts = append(gpfsFoundMounts, m.Mountpoint)
 		}
 	}
+	for _, m := range gpfsMounts {
+		mounted[m.Mountpoint] = true
+		addMount(m)
+	}
+	for _, m := range mmlsfsCache.mounts() {
+		addMount(m)
+	}
+	for _, m := range gpfsMountsFstab {
+		addMount(m)
+	}
 	var checkMounts []string
 	if *configMounts == "" {
 		checkMounts = gpfsFoundMounts
+		sort.Strings(checkMounts)
 	} else {
-		checkMounts = strings.Split(*configMounts, ",")
+		checkMounts = SplitList(*configMounts)
 	}
 	for _, mount := range checkMounts {
-		if SliceContains(gpfsMounts, mount) {
-			ch <- prometheus.MustNewConstMetric(c.fs_mount_status, prometheus.GaugeValue, 1, mount)
+		if mounted[mount] {
+			ch <- prometheus.MustNewConstMetric(c.fs_mount_status, prometheus.GaugeValue, 1, mount, filesystems[mount])
 		} else {
-			ch <- prometheus.MustNewConstMetric(c.fs_mount_status, prometheus.GaugeValue, 0, mount)
+			level.Debug(c.logger).Log("msg", "GPFS filesystem not mounted", "mount", mount, "fs", filesystems[mount])
+			ch <- prometheus.MustNewConstMetric(c.fs_mount_status, prometheus.GaugeValue, 0, mount, filesystems[mount])
 		}
 	}
-	ch <- prometheus.MustNewConstMetric(collectDuration, prometheus.GaugeValue, time.Since(collectTime).Seconds(), "mount")
 	return nil
 }
 
-func getGPFSMounts() ([]string, error) {
-	var gpfsMounts []string
+func getGPFSMounts() ([]GPFSFilesystem, error) {
+	var gpfsMounts []GPFSFilesystem
 	mounts, err := linuxproc.ReadMounts(procMounts)
 	if err != nil {
 		return nil, err
@@ -138,14 +150,14 @@ func getGPFSMounts() ([]string, error) {
 		if mount.FSType != "gpfs" {
 			continue
 		}
-		gpfsMount := mount.MountPoint
-		gpfsMounts = append(gpfsMounts, gpfsMount)
+		fs, _ := splitFilesystem(mount.Device)
+		gpfsMounts = append(gpfsMounts, GPFSFilesystem{Name: fs, Mountpoint: mount.MountPoint})
 	}
 	return gpfsMounts, err
 }
 
-func getGPFSMountsFSTab() ([]string, error) {
-	var gpfsMounts []string
+func getGPFSMountsFSTab() ([]GPFSFilesystem, error) {
+	var gpfsMounts []GPFSFilesystem
 	if exists := FileExists(fstabPath); !exists {
 		return nil, fmt.Errorf("%s does not exist", fstabPath)
 	}
@@ -157,7 +169,8 @@ func getGPFSMountsFSTab() ([]string, error) {
 		if m.VfsType != "gpfs" {
 			continue
 		}
-		gpfsMounts = append(gpfsMounts, m.File)
+		fs, _ := splitFilesystem(m.Spec)
+		gpfsMounts = append(gpfsMounts, GPFSFilesystem{Name: fs, Mountpoint: m.File})
 	}
 	return gpfsMounts, nil
 }
@@ -17,6 +17,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/alecthomas/kingpin/v2"
 	"github.com/go-kit/log"
@@ -47,10 +48,10 @@ project /fs/project gpfs rw,relatime 0 0
 		t.Errorf("Incorrect number of GPFS mounts, expected 2, got %d", len(gpfsMounts))
 		return
 	}
-	if val := gpfsMounts[0]; val != "/fs/scratch" {
+	if val := gpfsMounts[0].Mountpoint; val != "/fs/scratch" {
 		t.Errorf("Unexpected Path value %s", val)
 	}
-	if val := gpfsMounts[1]; val != "/fs/project" {
+	if val := gpfsMounts[1].Mountpoint; val != "/fs/project" {
 		t.Errorf("Unexpected Path value %s", val)
 	}
 }
@@ -78,10 +79,10 @@ scratch              /fs/scratch          gpfs       rw,mtime,atime,quota=userqu
 	if len(gpfsMounts) != 2 {
 		t.Errorf("Incorrect number fo GPFS mounts, expected 2, got %d", len(gpfsMounts))
 	}
-	if val := gpfsMounts[0]; val != "/fs/project" {
+	if val := gpfsMounts[0].Mountpoint; val != "/fs/project" {
 		t.Errorf("Unexpected value %s", val)
 	}
-	if val := gpfsMounts[1]; val != "/fs/scratch" {
+	if val := gpfsMounts[1].Mountpoint; val != "/fs/scratch" {
 		t.Errorf("Unexpected value %s", val)
 	}
 }
@@ -120,18 +121,65 @@ ess                  /fs/ess              gpfs       rw,mtime,relatime,dev=ess.d
 		# HELP gpfs_mount_status Status of GPFS filesystems, 1=mounted 0=not mounted
 		# TYPE gpfs_mount_status gauge`
 	expected := `
-		gpfs_mount_status{mount="/fs/ess"} 0
-		gpfs_mount_status{mount="/fs/project"} 1
-		gpfs_mount_status{mount="/fs/scratch"} 1
+		gpfs_mount_status{fs="ess",mount="/fs/ess"} 0
+		gpfs_mount_status{fs="project",mount="/fs/project"} 1
+		gpfs_mount_status{fs="scratch",mount="/fs/scratch"} 1
 	`
 	collector := NewMountCollector(log.NewNopLogger())
 	gatherers := setupGatherer(collector)
 	if val, err := testutil.GatherAndCount(gatherers); err != nil {
 		t.Errorf("Unexpected error: %v", err)
-	} else if val != 6 {
-		t.Errorf("Unexpected collection count %d, expected 6", val)
+	} else if val != 15 {
+		t.Errorf("Unexpected collection count %d, expected 15", val)
 	}
 	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(metadata+expected), "gpfs_mount_status"); err != nil {
 		t.Errorf("unexpected collecting result:\n%s", err)
 	}
 }
+
+func TestMountCollectorDiscovered(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	mounts := ""
+	configMounts = &mounts
+	tmpDir := t.TempDir()
+	procMounts = tmpDir + "/mounts"
+	fstabPath = tmpDir + "/fstab"
+	mockedProcMounts := `/dev/mapper/vg0-lv_tmp /tmp xfs rw,relatime,attr2,inode64,noquota 0 0
+scratch /fs/scratch gpfs rw,relatime 0 0
+home /users gpfs rw,relatime 0 0
+`
+	mockedFstab := `
+project              /fs/project          gpfs       rw,mtime,atime,dev=project,noauto 0 0
+scratch              /fs/scratch          gpfs       rw,mtime,atime,dev=scratch,noauto 0 0
+`
+	if err := os.WriteFile(procMounts, []byte(mockedProcMounts), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fstabPath, []byte(mockedFstab), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mmlsfsCache = &MmlsfsCache{
+		filesystems: []string{"ess.example.com:ess", "scratch"},
+		mountpoints: []GPFSFilesystem{
+			{Name: "ess", Mountpoint: "/fs/ess", RemoteCluster: "ess.example.com"},
+			{Name: "scratch", Mountpoint: "/fs/scratch"},
+		},
+		updated: time.Now(),
+	}
+	defer func() { mmlsfsCache = &MmlsfsCache{} }()
+	expected := `
+		# HELP gpfs_mount_status Status of GPFS filesystems, 1=mounted 0=not mounted
+		# TYPE gpfs_mount_status gauge
+		gpfs_mount_status{fs="ess",mount="/fs/ess"} 0
+		gpfs_mount_status{fs="home",mount="/users"} 1
+		gpfs_mount_status{fs="project",mount="/fs/project"} 0
+		gpfs_mount_status{fs="scratch",mount="/fs/scratch"} 1
+	`
+	collector := NewMountCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_mount_status"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
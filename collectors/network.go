@@ -0,0 +1,192 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	networkTimeout      = kingpin.Flag("collector.network.timeout", "Timeout for 'mmdiag --network' execution").Default("5").Int()
+	networkIgnoredPeers = kingpin.Flag("collector.network.ignored-peers", "Regex of peer names to ignore").Default("^$").String()
+)
+
+type NetworkPeerMetric struct {
+	Peer              string
+	State             string
+	BrokenConnections float64
+}
+
+type NetworkRDMAMetric struct {
+	Device string
+	Port   string
+	State  string
+}
+
+type NetworkMetrics struct {
+	Peers []NetworkPeerMetric
+	RDMA  []NetworkRDMAMetric
+}
+
+type NetworkCollector struct {
+	ConnectionState   *prometheus.Desc
+	BrokenConnections *prometheus.Desc
+	RDMAState         *prometheus.Desc
+	logger            log.Logger
+}
+
+func init() {
+	registerCollector("network", false, NewNetworkCollector)
+}
+
+func NewNetworkCollector(logger log.Logger) Collector {
+	return &NetworkCollector{
+		ConnectionState: newDesc(prometheus.BuildFQName(namespace, "network", "connection_state"),
+			"GPFS connection state to peer node", []string{"peer", "state"}, nil),
+		BrokenConnections: newDesc(prometheus.BuildFQName(namespace, "network", "connections_broken_total"),
+			"GPFS count of broken connections to peer node", []string{"peer"}, nil),
+		RDMAState: newDesc(prometheus.BuildFQName(namespace, "network", "rdma_state"),
+			"GPFS RDMA device port state", []string{"device", "port", "state"}, nil),
+		logger: logger,
+	}
+}
+
+func (c *NetworkCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.ConnectionState
+	ch <- c.BrokenConnections
+	ch <- c.RDMAState
+}
+
+func (c *NetworkCollector) Collect(ch chan<- prometheus.Metric) {
+	level.Debug(c.logger).Log("msg", "Collecting network metrics")
+	collectTime := time.Now()
+	metrics, err := c.collect()
+	if err == context.DeadlineExceeded {
+		level.Error(c.logger).Log("msg", "Timeout executing 'mmdiag --network'")
+	} else if err != nil {
+		level.Error(c.logger).Log("msg", err)
+	}
+	if err == nil {
+		ignoredPeers := regexp.MustCompile(*networkIgnoredPeers)
+		for _, m := range metrics.Peers {
+			if ignoredPeers.MatchString(m.Peer) {
+				level.Debug(c.logger).Log("msg", "Skipping peer due to ignored pattern", "peer", m.Peer)
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(c.ConnectionState, prometheus.GaugeValue, 1, m.Peer, m.State)
+			ch <- prometheus.MustNewConstMetric(c.BrokenConnections, prometheus.CounterValue, m.BrokenConnections, m.Peer)
+		}
+		for _, m := range metrics.RDMA {
+			ch <- prometheus.MustNewConstMetric(c.RDMAState, prometheus.GaugeValue, 1, m.Device, m.Port, m.State)
+		}
+	}
+	emitCollectorStatus(ch, "network", err, collectTime, len(metrics.Peers)+len(metrics.RDMA))
+}
+
+func (c *NetworkCollector) collect() (NetworkMetrics, error) {
+	ctx, cancel := commandContext("network", *networkTimeout)
+	defer cancel()
+	out, err := execRetry(ctx, "network", func() (string, error) {
+		return MmdiagExec("--network", ctx)
+	})
+	if err != nil {
+		return NetworkMetrics{}, err
+	}
+	commandDump.record("mmdiag-network", out)
+	metrics := parse_mmdiag_network(out, c.logger)
+	commandDump.recordParsed("mmdiag-network", metrics)
+	return metrics, nil
+}
+
+func parse_mmdiag_network(out string, logger log.Logger) NetworkMetrics {
+	var metrics NetworkMetrics
+	peers := make(map[string]int)
+	type rdmaKey struct{ Device, Port string }
+	rdma := make(map[rdmaKey]bool)
+	headers := make(map[string][]string)
+	lines := strings.Split(out, "\n")
+	for _, l := range lines {
+		if !strings.HasPrefix(l, "mmdiag") {
+			continue
+		}
+		items := strings.Split(l, ":")
+		if len(items) < 3 {
+			continue
+		}
+		section := items[1]
+		if items[2] == "HEADER" {
+			headers[section] = items
+			continue
+		}
+		value := func(header string) string {
+			if i := SliceIndex(headers[section], header); i != -1 && i < len(items) {
+				return items[i]
+			}
+			return ""
+		}
+		switch section {
+		case "node":
+			peer := value("hostname")
+			if peer == "" {
+				peer = value("ipAddress")
+			}
+			if peer == "" {
+				continue
+			}
+			var broken float64
+			if b := value("brokenConnections"); b != "" {
+				if val, err := ParseFloat(b, false, logger); err == nil {
+					broken = val
+				}
+			}
+			// A peer can be listed once per connection, keep one entry per peer
+			if i, ok := peers[peer]; ok {
+				metrics.Peers[i].BrokenConnections += broken
+				continue
+			}
+			peers[peer] = len(metrics.Peers)
+			metrics.Peers = append(metrics.Peers, NetworkPeerMetric{
+				Peer:              peer,
+				State:             value("state"),
+				BrokenConnections: broken,
+			})
+		case "rdma":
+			device := value("device")
+			if device == "" {
+				continue
+			}
+			// A port listed more than once would report duplicate series, keep the first row
+			key := rdmaKey{device, value("port")}
+			if rdma[key] {
+				level.Debug(logger).Log("msg", "Skipping duplicate RDMA port", "device", key.Device, "port", key.Port)
+				continue
+			}
+			rdma[key] = true
+			metrics.RDMA = append(metrics.RDMA, NetworkRDMAMetric{
+				Device: device,
+				Port:   key.Port,
+				State:  value("state"),
+			})
+		}
+	}
+	return metrics
+}
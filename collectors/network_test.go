@@ -0,0 +1,153 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var (
+	networkStdout = `
+mmdiag:node:HEADER:version:reserved:reserved:hostname:ipAddress:state:sendQueue:receiveQueue:brokenConnections:
+mmdiag:node:0:1:::ess01:10.0.0.1:connected:0:0:0:
+mmdiag:node:0:1:::ess02:10.0.0.2:connected:0:0:2:
+mmdiag:node:0:1:::ess02:10.0.0.2:connected:0:0:1:
+mmdiag:node:0:1:::client-tmp01:10.0.1.1:disconnected:0:0:5:
+mmdiag:rdma:HEADER:version:reserved:reserved:device:port:state:
+mmdiag:rdma:0:1:::mlx5_0:1:active:
+mmdiag:rdma:0:1:::mlx5_1:1:down:
+mmdiag:rdma:0:1:::mlx5_0:1:active:
+`
+	networkStdoutNoRDMA = `
+mmdiag:node:HEADER:version:reserved:reserved:hostname:ipAddress:state:
+mmdiag:node:0:1::::10.0.0.1:connected:
+`
+)
+
+func TestParseMmdiagNetwork(t *testing.T) {
+	metrics := parse_mmdiag_network(networkStdout, log.NewNopLogger())
+	expected := NetworkMetrics{
+		Peers: []NetworkPeerMetric{
+			{Peer: "ess01", State: "connected", BrokenConnections: 0},
+			{Peer: "ess02", State: "connected", BrokenConnections: 3},
+			{Peer: "client-tmp01", State: "disconnected", BrokenConnections: 5},
+		},
+		RDMA: []NetworkRDMAMetric{
+			{Device: "mlx5_0", Port: "1", State: "active"},
+			{Device: "mlx5_1", Port: "1", State: "down"},
+		},
+	}
+	if !reflect.DeepEqual(metrics, expected) {
+		t.Errorf("Unexpected metrics\nGot: %v\nExpected: %v", metrics, expected)
+	}
+	metrics = parse_mmdiag_network(networkStdoutNoRDMA, log.NewNopLogger())
+	expected = NetworkMetrics{
+		Peers: []NetworkPeerMetric{
+			{Peer: "10.0.0.1", State: "connected", BrokenConnections: 0},
+		},
+	}
+	if !reflect.DeepEqual(metrics, expected) {
+		t.Errorf("Unexpected metrics\nGot: %v\nExpected: %v", metrics, expected)
+	}
+}
+
+func TestNetworkCollector(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.network.ignored-peers=^client-"}); err != nil {
+		t.Fatal(err)
+	}
+	MmdiagExec = func(arg string, ctx context.Context) (string, error) {
+		return networkStdout, nil
+	}
+	expected := `
+		# HELP gpfs_network_connection_state GPFS connection state to peer node
+		# TYPE gpfs_network_connection_state gauge
+		gpfs_network_connection_state{peer="ess01",state="connected"} 1
+		gpfs_network_connection_state{peer="ess02",state="connected"} 1
+		# HELP gpfs_network_connections_broken_total GPFS count of broken connections to peer node
+		# TYPE gpfs_network_connections_broken_total counter
+		gpfs_network_connections_broken_total{peer="ess01"} 0
+		gpfs_network_connections_broken_total{peer="ess02"} 3
+		# HELP gpfs_network_rdma_state GPFS RDMA device port state
+		# TYPE gpfs_network_rdma_state gauge
+		gpfs_network_rdma_state{device="mlx5_0",port="1",state="active"} 1
+		gpfs_network_rdma_state{device="mlx5_1",port="1",state="down"} 1
+	`
+	collector := NewNetworkCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 18 {
+		t.Errorf("Unexpected collection count %d, expected 18", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
+		"gpfs_network_connection_state", "gpfs_network_connections_broken_total", "gpfs_network_rdma_state"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestNetworkCollectorError(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	MmdiagExec = func(arg string, ctx context.Context) (string, error) {
+		return "", fmt.Errorf("Error")
+	}
+	expected := `
+		# HELP gpfs_exporter_collect_error Indicates if error has occurred during collection
+		# TYPE gpfs_exporter_collect_error gauge
+		gpfs_exporter_collect_error{collector="network"} 1
+	`
+	collector := NewNetworkCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 12 {
+		t.Errorf("Unexpected collection count %d, expected 12", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collect_error"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestNetworkCollectorTimeout(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	MmdiagExec = func(arg string, ctx context.Context) (string, error) {
+		return "", context.DeadlineExceeded
+	}
+	expected := `
+		# HELP gpfs_exporter_collect_timeout Indicates the collector timed out
+		# TYPE gpfs_exporter_collect_timeout gauge
+		gpfs_exporter_collect_timeout{collector="network"} 1
+	`
+	collector := NewNetworkCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 12 {
+		t.Errorf("Unexpected collection count %d, expected 12", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collect_timeout"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
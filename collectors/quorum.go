@@ -0,0 +1,150 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	quorumTimeout = kingpin.Flag("collector.quorum.timeout", "Timeout for executing 'mmgetstate -a -s'").Default("30").Int()
+	QuorumExec    = mmgetstateSummary
+)
+
+type QuorumMetrics struct {
+	QuorumNodesRequired float64
+	QuorumNodesActive   float64
+	NodesActive         float64
+	Nodes               float64
+}
+
+type QuorumCollector struct {
+	QuorumNodesRequired *prometheus.Desc
+	QuorumNodesActive   *prometheus.Desc
+	NodesActive         *prometheus.Desc
+	Nodes               *prometheus.Desc
+	logger              log.Logger
+}
+
+func init() {
+	registerCollector("quorum", false, NewQuorumCollector)
+}
+
+func NewQuorumCollector(logger log.Logger) Collector {
+	return &QuorumCollector{
+		QuorumNodesRequired: newDesc(prometheus.BuildFQName(namespace, "quorum", "nodes_required"),
+			"GPFS number of active quorum nodes required to maintain quorum", nil, nil),
+		QuorumNodesActive: newDesc(prometheus.BuildFQName(namespace, "quorum", "nodes_active"),
+			"GPFS number of active quorum nodes", nil, nil),
+		NodesActive: newDesc(prometheus.BuildFQName(namespace, "nodes", "active_total"),
+			"GPFS number of active nodes in the cluster", nil, nil),
+		Nodes: newDesc(prometheus.BuildFQName(namespace, "nodes", "total"),
+			"GPFS number of nodes defined in the cluster", nil, nil),
+		logger: logger,
+	}
+}
+
+func (c *QuorumCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.QuorumNodesRequired
+	ch <- c.QuorumNodesActive
+	ch <- c.NodesActive
+	ch <- c.Nodes
+}
+
+func (c *QuorumCollector) Collect(ch chan<- prometheus.Metric) {
+	level.Debug(c.logger).Log("msg", "Collecting quorum metrics")
+	collectTime := time.Now()
+	metrics, err := c.collect()
+	if err == context.DeadlineExceeded {
+		level.Error(c.logger).Log("msg", "Timeout executing 'mmgetstate -a -s'")
+	} else if err != nil {
+		level.Error(c.logger).Log("msg", err)
+	}
+	if err == nil {
+		ch <- prometheus.MustNewConstMetric(c.QuorumNodesRequired, prometheus.GaugeValue, metrics.QuorumNodesRequired)
+		ch <- prometheus.MustNewConstMetric(c.QuorumNodesActive, prometheus.GaugeValue, metrics.QuorumNodesActive)
+		ch <- prometheus.MustNewConstMetric(c.NodesActive, prometheus.GaugeValue, metrics.NodesActive)
+		ch <- prometheus.MustNewConstMetric(c.Nodes, prometheus.GaugeValue, metrics.Nodes)
+	}
+	emitCollectorStatus(ch, "quorum", err, collectTime, int(metrics.Nodes))
+}
+
+func (c *QuorumCollector) collect() (QuorumMetrics, error) {
+	ctx, cancel := commandContext("quorum", *quorumTimeout)
+	defer cancel()
+	out, err := execRetry(ctx, "quorum", func() (string, error) {
+		return QuorumExec(ctx)
+	})
+	if err != nil {
+		return QuorumMetrics{}, err
+	}
+	commandDump.record("mmgetstate-summary", out)
+	metrics, err := parse_mmgetstate_summary(out, c.logger)
+	commandDump.recordParsed("mmgetstate-summary", metrics)
+	return metrics, err
+}
+
+func mmgetstateSummary(ctx context.Context) (string, error) {
+	return RunMMCommand(ctx, "mmgetstate", "-a", "-Y", "-s")
+}
+
+func parse_mmgetstate_summary(out string, logger log.Logger) (QuorumMetrics, error) {
+	var metrics QuorumMetrics
+	var headers []string
+	found := false
+	lines := strings.Split(out, "\n")
+	for _, l := range lines {
+		if !strings.HasPrefix(l, "mmgetstate:summary:") {
+			continue
+		}
+		items := strings.Split(l, ":")
+		if len(items) < 3 {
+			continue
+		}
+		if items[2] == "HEADER" {
+			headers = items
+			continue
+		}
+		values := map[string]*float64{
+			"quorumNodesRequired": &metrics.QuorumNodesRequired,
+			"quorumNodesActive":   &metrics.QuorumNodesActive,
+			"nodesActive":         &metrics.NodesActive,
+			"nodesDefined":        &metrics.Nodes,
+		}
+		for header, value := range values {
+			i := SliceIndex(headers, header)
+			if i == -1 || i >= len(items) {
+				return QuorumMetrics{}, fmt.Errorf("mmgetstate summary missing %s", header)
+			}
+			val, err := ParseFloat(items[i], false, logger)
+			if err != nil {
+				return QuorumMetrics{}, err
+			}
+			*value = val
+		}
+		found = true
+	}
+	if !found {
+		return QuorumMetrics{}, fmt.Errorf("no summary found in mmgetstate output")
+	}
+	return metrics, nil
+}
@@ -0,0 +1,152 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var (
+	quorumStdout = `
+mmgetstate::HEADER:version:reserved:reserved:nodeName:nodeNumber:state:quorum:nodesUp:totalNodes:remarks:cnfsState:
+mmgetstate::0:1:::ess01:1:active:2:3:5:quorum node:(undefined):
+mmgetstate::0:1:::ess02:2:active:2:3:5:quorum node:(undefined):
+mmgetstate::0:1:::ess03:3:down:2:3:5:quorum node:(undefined):
+mmgetstate::0:1:::client01:4:active:2:3:5::(undefined):
+mmgetstate::0:1:::client02:5:arbitrating:2:3:5::(undefined):
+mmgetstate:summary:HEADER:version:reserved:reserved:nodeName:nodeNumber:nodesDefined:nodesActive:nodesDown:quorumNodesDefined:quorumNodesActive:quorumNodesDown:quorumNodesRequired:nodesArbitrating:nodesUnknown:
+mmgetstate:summary:0:1:::::5:3:1:3:2:1:2:1:0:
+`
+)
+
+func TestMmgetstateSummary(t *testing.T) {
+	execCommand = fakeExecCommand
+	mockedExitStatus = 0
+	mockedStdout = "foo"
+	defer func() { execCommand = exec.CommandContext }()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out, err := mmgetstateSummary(ctx)
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+	if out != mockedStdout {
+		t.Errorf("Unexpected out: %s", out)
+	}
+}
+
+func TestParseMmgetstateSummary(t *testing.T) {
+	metrics, err := parse_mmgetstate_summary(quorumStdout, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	expected := QuorumMetrics{QuorumNodesRequired: 2, QuorumNodesActive: 2, NodesActive: 3, Nodes: 5}
+	if metrics != expected {
+		t.Errorf("Unexpected metrics\nGot: %v\nExpected: %v", metrics, expected)
+	}
+	if _, err := parse_mmgetstate_summary(mmgetstateStdout, log.NewNopLogger()); err == nil {
+		t.Errorf("Expected error parsing output without summary")
+	}
+}
+
+func TestQuorumCollector(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	QuorumExec = func(ctx context.Context) (string, error) {
+		return quorumStdout, nil
+	}
+	expected := `
+		# HELP gpfs_nodes_active_total GPFS number of active nodes in the cluster
+		# TYPE gpfs_nodes_active_total gauge
+		gpfs_nodes_active_total 3
+		# HELP gpfs_nodes_total GPFS number of nodes defined in the cluster
+		# TYPE gpfs_nodes_total gauge
+		gpfs_nodes_total 5
+		# HELP gpfs_quorum_nodes_active GPFS number of active quorum nodes
+		# TYPE gpfs_quorum_nodes_active gauge
+		gpfs_quorum_nodes_active 2
+		# HELP gpfs_quorum_nodes_required GPFS number of active quorum nodes required to maintain quorum
+		# TYPE gpfs_quorum_nodes_required gauge
+		gpfs_quorum_nodes_required 2
+	`
+	collector := NewQuorumCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 16 {
+		t.Errorf("Unexpected collection count %d, expected 16", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected),
+		"gpfs_nodes_active_total", "gpfs_nodes_total", "gpfs_quorum_nodes_active", "gpfs_quorum_nodes_required"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestQuorumCollectorError(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	QuorumExec = func(ctx context.Context) (string, error) {
+		return "", fmt.Errorf("Error")
+	}
+	expected := `
+		# HELP gpfs_exporter_collect_error Indicates if error has occurred during collection
+		# TYPE gpfs_exporter_collect_error gauge
+		gpfs_exporter_collect_error{collector="quorum"} 1
+	`
+	collector := NewQuorumCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 12 {
+		t.Errorf("Unexpected collection count %d, expected 12", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collect_error"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestQuorumCollectorTimeout(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	QuorumExec = func(ctx context.Context) (string, error) {
+		return "", context.DeadlineExceeded
+	}
+	expected := `
+		# HELP gpfs_exporter_collect_timeout Indicates the collector timed out
+		# TYPE gpfs_exporter_collect_timeout gauge
+		gpfs_exporter_collect_timeout{collector="quorum"} 1
+	`
+	collector := NewQuorumCollector(log.NewNopLogger())
+	gatherers := setupGatherer(collector)
+	if val, err := testutil.GatherAndCount(gatherers); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if val != 12 {
+		t.Errorf("Unexpected collection count %d, expected 12", val)
+	}
+	if err := testutil.GatherAndCompare(gatherers, strings.NewReader(expected), "gpfs_exporter_collect_timeout"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
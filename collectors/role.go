@@ -0,0 +1,182 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	autoRole = kingpin.Flag("collector.auto-role",
+		"Detect the roles of this node at startup and enable the collectors for each role, collectors set with --collector.<name> are not changed").
+		Default("false").Bool()
+	autoRoleTimeout = kingpin.Flag("collector.auto-role.timeout", "Timeout for detecting the roles of this node").Default("3s").Duration()
+	// roleCollectors are the collectors enabled for each role by --collector.auto-role, every node is a client
+	roleCollectors = map[string][]string{
+		"client":     {"config", "mmgetstate", "mmhealth", "mmpmon", "mount", "waiter"},
+		"ces":        {"mmces"},
+		"nsd_server": {"network", "verbs"},
+		"manager":    {"mmdf", "mmlscluster", "mmlsfileset", "mmlsfs", "mmlsmgr", "mmlssnapshot", "mmrepquota", "quorum"},
+	}
+	roles    = []string{"client", "ces", "nsd_server", "manager"}
+	nodeRole = newGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "exporter",
+		Name:      "node_role",
+		Help:      "Indicates the role was detected for this node by --collector.auto-role",
+	}, []string{"role"})
+	// autoRoleCollectors are the collectors enabled by --collector.auto-role, nil when not detected
+	autoRoleCollectors map[string]bool
+	MmlsnsdExec        = mmlsnsd
+)
+
+// DetectRoles detects the roles of this node when --collector.auto-role is set and enables the
+// collectors of those roles that are not set with --collector.<name>. The checks run concurrently
+// and a check that fails or does not finish within --collector.auto-role.timeout is treated as
+// not having the role, so startup is not delayed when GPFS is down.
+func DetectRoles(logger log.Logger) []string {
+	if !*autoRole {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(parentContext(), *autoRoleTimeout)
+	defer cancel()
+	checks := map[string]func(context.Context) (bool, error){
+		"ces":        isCESNode,
+		"nsd_server": isNSDServer,
+		"manager":    isManagerNode,
+	}
+	detected := map[string]bool{"client": true}
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for role, check := range checks {
+		wg.Add(1)
+		go func(role string, check func(context.Context) (bool, error)) {
+			defer wg.Done()
+			has, err := check(ctx)
+			if err != nil {
+				level.Warn(logger).Log("msg", "Unable to detect node role, assuming the node does not have the role", "role", role, "err", err)
+			}
+			mu.Lock()
+			detected[role] = has && err == nil
+			mu.Unlock()
+		}(role, check)
+	}
+	wg.Wait()
+	var found []string
+	enabled := make(map[string]bool)
+	for _, role := range roles {
+		var value float64
+		if detected[role] {
+			value = 1
+			found = append(found, role)
+			for _, collector := range roleCollectors[role] {
+				enabled[collector] = true
+			}
+		}
+		nodeRole.WithLabelValues(role).Set(value)
+	}
+	autoRoleCollectors = enabled
+	var names []string
+	for collector := range collectorState {
+		if CollectorEnabled(collector) {
+			names = append(names, collector)
+		}
+	}
+	sort.Strings(names)
+	level.Info(logger).Log("msg", "Detected node roles", "roles", strings.Join(found, ","), "collectors", strings.Join(names, ","))
+	return found
+}
+
+// isCESNode returns true when mmces reports the state of this node, mmces exits with an error on nodes
+// that are not CES nodes. Other errors, such as mmces not being found, are returned.
+func isCESNode(ctx context.Context) (bool, error) {
+	hostname, err := osHostname()
+	if err != nil {
+		return false, err
+	}
+	if _, err := mmcesExec(hostname, ctx); err != nil {
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+		var commandErr *CommandError
+		if errors.As(err, &commandErr) && commandErr.ExitCode > 0 && commandErr.Reason == "other" {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// isNSDServer returns true when mmlsnsd -X lists a local device of an NSD on this node
+func isNSDServer(ctx context.Context) (bool, error) {
+	out, err := MmlsnsdExec(ctx)
+	if err != nil {
+		return false, err
+	}
+	return parse_mmlsnsd_local(out, localNodeNames()), nil
+}
+
+// isManagerNode returns true when this node is the cluster manager or a filesystem manager
+func isManagerNode(ctx context.Context) (bool, error) {
+	managers, err := mmlsmgrCache.get(ctx, log.NewNopLogger())
+	if err != nil {
+		return false, err
+	}
+	local := localNodeNames()
+	for _, nodes := range [][]string{managers.ClusterManager, managers.FSManagers} {
+		for _, node := range nodes {
+			if SliceContains(local, node) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func mmlsnsd(ctx context.Context) (string, error) {
+	return RunMMCommand(ctx, "mmlsnsd", "-X")
+}
+
+// parse_mmlsnsd_local returns true when a row of mmlsnsd -X for one of localNames has a device,
+// the columns are disk name, NSD volume ID, device, device type, node name and remarks
+func parse_mmlsnsd_local(out string, localNames []string) bool {
+	for _, l := range strings.Split(out, "\n") {
+		fields := strings.Fields(l)
+		if len(fields) < 5 || fields[0] == "Disk" || strings.HasPrefix(fields[0], "---") {
+			continue
+		}
+		device, node := fields[2], fields[4]
+		if strings.HasPrefix(device, "/") && SliceContains(localNames, node) {
+			return true
+		}
+	}
+	return false
+}
+
+// autoRoleEnabled returns whether --collector.auto-role enabled the collector and ok when roles were detected
+func autoRoleEnabled(collector string) (enabled bool, ok bool) {
+	if autoRoleCollectors == nil {
+		return false, false
+	}
+	return autoRoleCollectors[collector], true
+}
@@ -0,0 +1,233 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var (
+	mmlsnsdStdout = `
+ Disk name       NSD volume ID      Device          Devtype  Node name or Class       Remarks
+-------------------------------------------------------------------------------------------------------
+ nsd1            0A0A0A0A5F1E2D3C   /dev/sdb        generic  nsd01.example.com        server node
+ nsd2            0A0A0A0B5F1E2D3D   /dev/sdc        generic  nsd02.example.com        server node
+ nsd3            0A0A0A0C5F1E2D3E   -               generic  nsd01.example.com        (not found) server node
+`
+)
+
+func resetRoleExecs() {
+	autoRoleCollectors = nil
+	nodeRole.Reset()
+	mmlsmgrCache = &MmlsmgrCache{}
+	localNodeNames = localNames
+	osHostname = os.Hostname
+	mmcesExec = mmces
+	MmlsnsdExec = mmlsnsd
+	MmlsmgrExec = mmlsmgr
+}
+
+func TestParseMmlsnsdLocal(t *testing.T) {
+	tests := map[string]bool{
+		"nsd01.example.com": true,
+		"nsd02.example.com": true,
+		"nsd03.example.com": false,
+	}
+	for node, expected := range tests {
+		if val := parse_mmlsnsd_local(mmlsnsdStdout, []string{node}); val != expected {
+			t.Errorf("Unexpected NSD server for %s, got %v expected %v", node, val, expected)
+		}
+	}
+	if parse_mmlsnsd_local("", []string{"nsd01.example.com"}) {
+		t.Errorf("Unexpected NSD server for empty output")
+	}
+}
+
+func TestDetectRoles(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.auto-role", "--collector.mmlsmgr.cache-ttl=0s"}); err != nil {
+		t.Fatal(err)
+	}
+	defer resetRoleExecs()
+	osHostname = func() (string, error) {
+		return "nsd01.example.com", nil
+	}
+	localNodeNames = func() []string {
+		return []string{"nsd01.example.com", "nsd01"}
+	}
+	mmcesExec = func(nodename string, ctx context.Context) (string, error) {
+		return "", &CommandError{Command: "mmces state show", ExitCode: 1, Reason: "other", Err: fmt.Errorf("exit status 1")}
+	}
+	MmlsnsdExec = func(ctx context.Context) (string, error) {
+		return mmlsnsdStdout, nil
+	}
+	MmlsmgrExec = func(ctx context.Context) (string, error) {
+		return mmlsmgrStdout, nil
+	}
+	roles := DetectRoles(log.NewNopLogger())
+	if !reflect.DeepEqual(roles, []string{"client", "nsd_server"}) {
+		t.Errorf("Unexpected roles %v", roles)
+	}
+	for role, expected := range map[string]float64{"client": 1, "ces": 0, "nsd_server": 1, "manager": 0} {
+		if val := testutil.ToFloat64(nodeRole.WithLabelValues(role)); val != expected {
+			t.Errorf("Unexpected node role %s value %v, expected %v", role, val, expected)
+		}
+	}
+	for collector, expected := range map[string]bool{"mount": true, "network": true, "mmces": false, "mmlsmgr": false, "mmrepquota": false} {
+		if val := CollectorEnabled(collector); val != expected {
+			t.Errorf("Unexpected enabled %v for %s, expected %v", val, collector, expected)
+		}
+	}
+}
+
+func TestDetectRolesOverride(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.auto-role", "--collector.mmlsmgr.cache-ttl=0s",
+		"--collector.mmrepquota", "--no-collector.mount"}); err != nil {
+		t.Fatal(err)
+	}
+	defer resetRoleExecs()
+	osHostname = func() (string, error) {
+		return "ces01.example.com", nil
+	}
+	localNodeNames = func() []string {
+		return []string{"ess03-ib", "10.22.0.13"}
+	}
+	mmcesExec = func(nodename string, ctx context.Context) (string, error) {
+		return mmcesStdout, nil
+	}
+	MmlsnsdExec = func(ctx context.Context) (string, error) {
+		return mmlsnsdStdout, nil
+	}
+	MmlsmgrExec = func(ctx context.Context) (string, error) {
+		return mmlsmgrStdout, nil
+	}
+	roles := DetectRoles(log.NewNopLogger())
+	if !reflect.DeepEqual(roles, []string{"client", "ces", "manager"}) {
+		t.Errorf("Unexpected roles %v", roles)
+	}
+	for collector, expected := range map[string]bool{"mount": false, "mmces": true, "mmlsmgr": true, "mmrepquota": true, "network": false} {
+		if val := CollectorEnabled(collector); val != expected {
+			t.Errorf("Unexpected enabled %v for %s, expected %v", val, collector, expected)
+		}
+	}
+}
+
+func TestDetectRolesTimeout(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.auto-role", "--collector.auto-role.timeout=100ms", "--collector.mmlsmgr.cache-ttl=0s"}); err != nil {
+		t.Fatal(err)
+	}
+	defer resetRoleExecs()
+	osHostname = func() (string, error) {
+		return "nsd01.example.com", nil
+	}
+	wait := func(ctx context.Context) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+	mmcesExec = func(nodename string, ctx context.Context) (string, error) {
+		return wait(ctx)
+	}
+	MmlsnsdExec = wait
+	MmlsmgrExec = wait
+	start := time.Now()
+	roles := DetectRoles(log.NewNopLogger())
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Role detection took %v", elapsed)
+	}
+	if !reflect.DeepEqual(roles, []string{"client"}) {
+		t.Errorf("Unexpected roles %v", roles)
+	}
+	if !CollectorEnabled("mount") || CollectorEnabled("mmlsmgr") {
+		t.Errorf("Unexpected collectors enabled for the client role")
+	}
+}
+
+func TestIsCESNode(t *testing.T) {
+	defer resetRoleExecs()
+	osHostname = func() (string, error) {
+		return "ces01.example.com", nil
+	}
+	tests := []struct {
+		err    error
+		hasErr bool
+	}{
+		{err: nil},
+		{err: &CommandError{Command: "mmces state show", ExitCode: 1, Reason: "other", Err: fmt.Errorf("exit status 1")}},
+		{err: &CommandError{Command: "mmces state show", ExitCode: 127, Reason: "not_found", Err: fmt.Errorf("exit status 127")}, hasErr: true},
+		{err: &CommandError{Command: "mmces state show", ExitCode: -1, Reason: "other", Err: fmt.Errorf("signal: killed")}, hasErr: true},
+	}
+	for _, test := range tests {
+		mmcesExec = func(nodename string, ctx context.Context) (string, error) {
+			return "", test.err
+		}
+		has, err := isCESNode(context.Background())
+		if has != (test.err == nil) {
+			t.Errorf("Unexpected CES node %v for error %v", has, test.err)
+		}
+		if (err != nil) != test.hasErr {
+			t.Errorf("Unexpected error %v for error %v", err, test.err)
+		}
+	}
+}
+
+func TestDetectRolesParentContext(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.auto-role", "--collector.auto-role.timeout=1m", "--collector.mmlsmgr.cache-ttl=0s"}); err != nil {
+		t.Fatal(err)
+	}
+	defer resetRoleExecs()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	SetParentContext(ctx)
+	defer SetParentContext(context.Background())
+	osHostname = func() (string, error) {
+		return "nsd01.example.com", nil
+	}
+	wait := func(ctx context.Context) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+	mmcesExec = func(nodename string, ctx context.Context) (string, error) {
+		return wait(ctx)
+	}
+	MmlsnsdExec = wait
+	MmlsmgrExec = wait
+	start := time.Now()
+	if roles := DetectRoles(log.NewNopLogger()); !reflect.DeepEqual(roles, []string{"client"}) {
+		t.Errorf("Unexpected roles %v", roles)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Role detection took %v after the parent context was canceled", elapsed)
+	}
+}
+
+func TestDetectRolesDisabled(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	defer resetRoleExecs()
+	if roles := DetectRoles(log.NewNopLogger()); roles != nil {
+		t.Errorf("Unexpected roles %v", roles)
+	}
+	if !CollectorEnabled("mmlsmgr") || CollectorEnabled("mmces") {
+		t.Errorf("Unexpected collectors enabled without auto role")
+	}
+}
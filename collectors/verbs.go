@@ -14,7 +14,6 @@
 package collectors
 
 import (
-	"bytes"
 	"context"
 	"strings"
 	"time"
@@ -45,7 +44,7 @@ func init() {
 
 func NewVerbsCollector(logger log.Logger) Collector {
 	return &VerbsCollector{
-		Status: prometheus.NewDesc(prometheus.BuildFQName(namespace, "verbs", "status"),
+		Status: newDesc(prometheus.BuildFQName(namespace, "verbs", "status"),
 			"GPFS verbs status, 1=started 0=not started", nil, nil),
 		logger: logger,
 	}
@@ -58,48 +57,37 @@ func (c *VerbsCollector) Describe(ch chan<- *prometheus.Desc) {
 func (c *VerbsCollector) Collect(ch chan<- prometheus.Metric) {
 	level.Debug(c.logger).Log("msg", "Collecting verbs metrics")
 	collectTime := time.Now()
-	timeout := 0
-	errorMetric := 0
 	metric, err := c.collect()
 	if err == context.DeadlineExceeded {
-		timeout = 1
 		level.Error(c.logger).Log("msg", "Timeout executing verbs check")
 	} else if err != nil {
 		level.Error(c.logger).Log("msg", err)
-		errorMetric = 1
 	}
 	if metric.Status == "started" {
 		ch <- prometheus.MustNewConstMetric(c.Status, prometheus.GaugeValue, 1)
 	} else if err == nil {
 		ch <- prometheus.MustNewConstMetric(c.Status, prometheus.GaugeValue, 0)
 	}
-	ch <- prometheus.MustNewConstMetric(collectError, prometheus.GaugeValue, float64(errorMetric), "verbs")
-	ch <- prometheus.MustNewConstMetric(collecTimeout, prometheus.GaugeValue, float64(timeout), "verbs")
-	ch <- prometheus.MustNewConstMetric(collectDuration, prometheus.GaugeValue, time.Since(collectTime).Seconds(), "verbs")
+	emitCollectorStatus(ch, "verbs", err, collectTime, recordCount(metric.Status != ""))
 }
 
 func (c *VerbsCollector) collect() (VerbsMetrics, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(*verbsTimeout)*time.Second)
+	ctx, cancel := commandContext("verbs", *verbsTimeout)
 	defer cancel()
-	out, err := verbsExec(ctx)
+	out, err := execRetry(ctx, "verbs", func() (string, error) {
+		return verbsExec(ctx)
+	})
 	if err != nil {
 		return VerbsMetrics{}, err
 	}
+	commandDump.record("verbs", out)
 	metric := verbs_parse(out)
+	commandDump.recordParsed("verbs", metric)
 	return metric, nil
 }
 
 func verbs(ctx context.Context) (string, error) {
-	cmd := execCommand(ctx, *sudoCmd, "/usr/lpp/mmfs/bin/mmfsadm", "test", "verbs", "status")
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	err := cmd.Run()
-	if ctx.Err() == context.DeadlineExceeded {
-		return "", ctx.Err()
-	} else if err != nil {
-		return "", err
-	}
-	return out.String(), nil
+	return RunMMCommand(ctx, "mmfsadm", "test", "verbs", "status")
 }
 
 func verbs_parse(out string) VerbsMetrics {
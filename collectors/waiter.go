@@ -66,14 +66,14 @@ func init() {
 
 func NewWaiterCollector(logger log.Logger) Collector {
 	return &WaiterCollector{
-		Waiter: prometheus.NewHistogram(prometheus.HistogramOpts{
+		Waiter: newHistogram(prometheus.HistogramOpts{
 			Namespace: namespace,
 			Subsystem: "waiter",
 			Name:      "seconds",
 			Help:      "GPFS waiter in seconds",
 			Buckets:   *waiterBuckets,
 		}),
-		WaiterInfo: prometheus.NewDesc(prometheus.BuildFQName(namespace, "waiter", "info_count"),
+		WaiterInfo: newDesc(prometheus.BuildFQName(namespace, "waiter", "info_count"),
 			"GPFS waiter info", []string{"waiter"}, nil),
 		logger: logger,
 	}
@@ -87,15 +87,11 @@ func (c *WaiterCollector) Describe(ch chan<- *prometheus.Desc) {
 func (c *WaiterCollector) Collect(ch chan<- prometheus.Metric) {
 	level.Debug(c.logger).Log("msg", "Collecting waiter metrics")
 	collectTime := time.Now()
-	timeout := 0
-	errorMetric := 0
 	waiterMetric, err := c.collect()
 	if err == context.DeadlineExceeded {
 		level.Error(c.logger).Log("msg", "Timeout executing mmdiag")
-		timeout = 1
 	} else if err != nil {
 		level.Error(c.logger).Log("msg", err)
-		errorMetric = 1
 	}
 	for _, second := range waiterMetric.seconds {
 		c.Waiter.Observe(second)
@@ -106,20 +102,22 @@ func (c *WaiterCollector) Collect(ch chan<- prometheus.Metric) {
 	for waiter, count := range waiterMetric.infoCounts {
 		ch <- prometheus.MustNewConstMetric(c.WaiterInfo, prometheus.GaugeValue, count, waiter)
 	}
-	ch <- prometheus.MustNewConstMetric(collectError, prometheus.GaugeValue, float64(errorMetric), "waiter")
-	ch <- prometheus.MustNewConstMetric(collecTimeout, prometheus.GaugeValue, float64(timeout), "waiter")
-	ch <- prometheus.MustNewConstMetric(collectDuration, prometheus.GaugeValue, time.Since(collectTime).Seconds(), "waiter")
+	emitCollectorStatus(ch, "waiter", err, collectTime, anyRecords)
 }
 
 func (c *WaiterCollector) collect() (WaiterMetric, error) {
 	var waiterMetric WaiterMetric
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(*waiterTimeout)*time.Second)
+	ctx, cancel := commandContext("waiter", *waiterTimeout)
 	defer cancel()
-	out, err := MmdiagExec("--waiters", ctx)
+	out, err := execRetry(ctx, "waiter", func() (string, error) {
+		return MmdiagExec("--waiters", ctx)
+	})
 	if err != nil {
 		return waiterMetric, err
 	}
+	commandDump.record("mmdiag-waiters", out)
 	waiters := parse_mmdiag_waiters(out, c.logger)
+	commandDump.recordParsed("mmdiag-waiters", waiters)
 	seconds := []float64{}
 	infoCounts := make(map[string]float64)
 	for _, waiter := range waiters {
@@ -157,7 +155,7 @@ func parse_mmdiag_waiters(out string, logger log.Logger) []Waiter {
 		}
 		var values []string
 		if items[2] == "HEADER" {
-			headers = append(headers, items...)
+			headers = items
 			continue
 		} else {
 			values = append(values, items...)
@@ -166,6 +164,9 @@ func parse_mmdiag_waiters(out string, logger log.Logger) []Waiter {
 		ps := reflect.ValueOf(&metric) // pointer to struct - addressable
 		s := ps.Elem()                 // struct
 		for i, h := range headers {
+			if i >= len(values) {
+				break
+			}
 			if field, ok := waiterMap[h]; ok {
 				f := s.FieldByName(field)
 				if f.Kind() == reflect.String {
@@ -0,0 +1,173 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package textfile has the helpers shared by the exporters run from cron that write
+// metrics for the node exporter textfile collector.
+package textfile
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/gofrs/flock"
+)
+
+var (
+	lockRetryDelay = time.Second
+	procPath       = "/proc"
+)
+
+// LockOwner is the process that took a lock as written to the lock file
+type LockOwner struct {
+	PID        int
+	Started    time.Time
+	Hostname   string
+	BootID     string
+	StartTicks uint64
+}
+
+func (o LockOwner) String() string {
+	return fmt.Sprintf("%d %d %s %s %d\n", o.PID, o.Started.Unix(), o.Hostname, o.BootID, o.StartTicks)
+}
+
+// currentOwner returns the owner to record for this process
+func currentOwner(start time.Time) LockOwner {
+	owner := LockOwner{PID: os.Getpid(), Started: start, BootID: bootID()}
+	owner.Hostname, _ = os.Hostname()
+	owner.StartTicks, _ = processStartTicks(owner.PID)
+	return owner
+}
+
+// ReadLockOwner returns the owner written to the lock file. Lock files written before the
+// hostname, boot ID and process start time were recorded only have the PID and start time,
+// the PID is 0 when the owner is not known.
+func ReadLockOwner(path string) LockOwner {
+	var owner LockOwner
+	if content, err := os.ReadFile(path); err == nil {
+		var started int64
+		n, _ := fmt.Sscanf(string(content), "%d %d %s %s %d", &owner.PID, &started, &owner.Hostname, &owner.BootID, &owner.StartTicks)
+		if n >= 2 {
+			owner.Started = time.Unix(started, 0)
+			return owner
+		}
+		owner = LockOwner{}
+	}
+	if info, err := os.Stat(path); err == nil {
+		owner.Started = info.ModTime()
+		return owner
+	}
+	owner.Started = time.Now()
+	return owner
+}
+
+func bootID() string {
+	content, err := os.ReadFile(filepath.Join(procPath, "sys/kernel/random/boot_id"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(content))
+}
+
+// processStartTicks returns the start time of pid in clock ticks since boot, field 22 of /proc/<pid>/stat
+func processStartTicks(pid int) (uint64, error) {
+	content, err := os.ReadFile(filepath.Join(procPath, strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return 0, err
+	}
+	// The command name is in parentheses and may contain spaces, fields are counted after it
+	stat := string(content)
+	fields := strings.Fields(stat[strings.LastIndex(stat, ")")+1:])
+	if len(fields) < 20 {
+		return 0, fmt.Errorf("Unable to parse %s/%d/stat", procPath, pid)
+	}
+	return strconv.ParseUint(fields[19], 10, 64)
+}
+
+// running returns true only when the owner can be confirmed to still be running: it is on
+// this host and boot and a process with its PID exists that started at the recorded time.
+// A recycled PID, an owner on another host and a lock file without an owner are not running.
+func (o LockOwner) running() bool {
+	if o.PID <= 0 {
+		return false
+	}
+	if hostname, _ := os.Hostname(); o.Hostname != hostname {
+		return false
+	}
+	if o.BootID != bootID() {
+		return false
+	}
+	if syscall.Kill(o.PID, 0) == syscall.ESRCH {
+		return false
+	}
+	ticks, err := processStartTicks(o.PID)
+	if err != nil {
+		// The process exists but its start time can not be read, assume it is the owner
+		return true
+	}
+	return ticks == o.StartTicks
+}
+
+// AcquireLock locks path and writes the owner of the lock to it, it returns the lock and the
+// seconds spent waiting for it. With a stale timeout a held lock is waited for until it is that
+// old, and then broken unless the process that took it is confirmed to still be running.
+func AcquireLock(path string, staleTimeout time.Duration, logger log.Logger) (*flock.Flock, float64, error) {
+	start := time.Now()
+	fileLock := flock.New(path)
+	locked, err := fileLock.TryLock()
+	if err != nil {
+		return nil, 0, err
+	}
+	if !locked && staleTimeout > 0 {
+		owner := ReadLockOwner(path)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Until(owner.Started.Add(staleTimeout)))
+		defer cancel()
+		locked, err = fileLock.TryLockContext(ctx, lockRetryDelay)
+		if err != nil && err != context.DeadlineExceeded {
+			return nil, 0, err
+		}
+		if !locked {
+			// The owner is read again as another run may have broken the lock while waiting
+			owner := ReadLockOwner(path)
+			if owner.running() {
+				return nil, 0, fmt.Errorf("Lock file %s is held by running process %d since %s", path, owner.PID, owner.Started.Format(time.RFC3339))
+			}
+			// Only a process that inherited the lock from the owner can still hold it on this host,
+			// so a new lock file is created rather than running alongside another collection
+			level.Warn(logger).Log("msg", "Breaking stale lock", "lockfile", path, "pid", owner.PID, "hostname", owner.Hostname, "started", owner.Started)
+			_ = fileLock.Close()
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return nil, 0, err
+			}
+			fileLock = flock.New(path)
+			locked, err = fileLock.TryLock()
+			if err != nil {
+				return nil, 0, err
+			}
+		}
+	}
+	if !locked {
+		return nil, 0, fmt.Errorf("Lock file %s is locked", path)
+	}
+	if err := os.WriteFile(path, []byte(currentOwner(start).String()), 0644); err != nil {
+		level.Warn(logger).Log("msg", "Unable to write owner to lock file", "lockfile", path, "err", err)
+	}
+	return fileLock, time.Since(start).Seconds(), nil
+}
@@ -0,0 +1,127 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package textfile
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/gofrs/flock"
+)
+
+func holdLock(t *testing.T, path string, owner LockOwner) *flock.Flock {
+	held := flock.New(path)
+	if locked, err := held.TryLock(); err != nil || !locked {
+		t.Fatalf("Unable to lock %s: %v", path, err)
+	}
+	if err := os.WriteFile(path, []byte(owner.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return held
+}
+
+func TestAcquireLockStale(t *testing.T) {
+	exited := exec.Command("true")
+	if err := exited.Run(); err != nil {
+		t.Fatal(err)
+	}
+	live := currentOwner(time.Now().Add(-2 * time.Hour))
+	exitedOwner := live
+	exitedOwner.PID = exited.ProcessState.Pid()
+	recycled := live
+	recycled.StartTicks++
+	otherHost := live
+	otherHost.Hostname = "other.example.com"
+	otherBoot := live
+	otherBoot.BootID = "00000000-0000-0000-0000-000000000000"
+	unknown := LockOwner{Started: live.Started}
+	tests := map[string]LockOwner{
+		"exited":    exitedOwner,
+		"recycled":  recycled,
+		"otherHost": otherHost,
+		"otherBoot": otherBoot,
+		"unknown":   unknown,
+	}
+	for name, owner := range tests {
+		path := filepath.Join(t.TempDir(), "test.lock")
+		held := holdLock(t, path, owner)
+		if _, _, err := AcquireLock(path, 0, log.NewNopLogger()); err == nil {
+			t.Errorf("%s: Expected error acquiring held lock", name)
+		}
+		fileLock, _, err := AcquireLock(path, time.Hour, log.NewNopLogger())
+		if err != nil {
+			t.Errorf("%s: Unexpected error: %s", name, err.Error())
+			_ = held.Unlock()
+			continue
+		}
+		if !fileLock.Locked() {
+			t.Errorf("%s: Expected lock to be taken over", name)
+		}
+		if owner := ReadLockOwner(path); owner != currentOwner(owner.Started) {
+			t.Errorf("%s: Unexpected lock owner %v", name, owner)
+		}
+		_ = fileLock.Unlock()
+		_ = held.Unlock()
+	}
+}
+
+func TestAcquireLockStaleRunning(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lock")
+	owner := currentOwner(time.Now().Add(-2 * time.Hour).Truncate(time.Second))
+	held := holdLock(t, path, owner)
+	defer held.Unlock()
+	if _, _, err := AcquireLock(path, time.Hour, log.NewNopLogger()); err == nil {
+		t.Errorf("Expected error breaking lock of running owner")
+	}
+	if val := ReadLockOwner(path); val != owner {
+		t.Errorf("Unexpected lock owner %v, expected %v", val, owner)
+	}
+}
+
+func TestReadLockOwner(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lock")
+	if err := os.WriteFile(path, []byte("123 1580117721\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	owner := ReadLockOwner(path)
+	if owner.PID != 123 || owner.Started.Unix() != 1580117721 || owner.Hostname != "" {
+		t.Errorf("Unexpected lock owner %v", owner)
+	}
+	if owner.running() {
+		t.Errorf("Expected lock owner without a hostname to not be running")
+	}
+}
+
+func TestAcquireLockWait(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lock")
+	lockRetryDelay = 10 * time.Millisecond
+	defer func() { lockRetryDelay = time.Second }()
+	held := holdLock(t, path, currentOwner(time.Now()))
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		_ = held.Unlock()
+	}()
+	fileLock, wait, err := AcquireLock(path, time.Hour, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	defer fileLock.Unlock()
+	if wait < 0.2 {
+		t.Errorf("Unexpected lock wait %f", wait)
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package textfile
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// StatusMetrics returns the time of the collection and whether it was successful, with labels added to both
+func StatusMetrics(success bool, labels prometheus.Labels) ([]*dto.MetricFamily, error) {
+	registry := prometheus.NewRegistry()
+	registerer := prometheus.WrapRegistererWith(labels, registry)
+	lastCollect := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "gpfs_exporter_last_collect_timestamp_seconds",
+		Help: "Time of the last collection",
+	})
+	lastCollect.SetToCurrentTime()
+	collectSuccess := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "gpfs_exporter_collect_success",
+		Help: "Indicates if the last collection was successful",
+	})
+	if success {
+		collectSuccess.Set(1)
+	}
+	registerer.MustRegister(lastCollect, collectSuccess)
+	return registry.Gather()
+}
+
+// AppendStatus adds the status metrics to mfs, samples of a family already in mfs
+// such as the per collector gpfs_exporter_collect_success are added to that family.
+func AppendStatus(mfs []*dto.MetricFamily, status []*dto.MetricFamily) []*dto.MetricFamily {
+	for _, smf := range status {
+		merged := false
+		for _, mf := range mfs {
+			if mf.GetName() == smf.GetName() {
+				mf.Metric = append(mf.Metric, smf.Metric...)
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			mfs = append(mfs, smf)
+		}
+	}
+	return mfs
+}
+
+// WriteFile replaces path with content using a temporary file in the same directory
+// so the node exporter never reads a partially written file.
+func WriteFile(path string, content []byte, logger log.Logger) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		level.Error(logger).Log("msg", "Unable to create temp file", "err", err)
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		level.Error(logger).Log("msg", "Error writing tmp file", "err", err)
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		level.Error(logger).Log("msg", "Error syncing tmp file", "err", err)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		level.Error(logger).Log("msg", "Error closing tmp file", "err", err)
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		level.Error(logger).Log("msg", "Error executing chmod 0644 on tmp file", "err", err)
+		return err
+	}
+	level.Debug(logger).Log("msg", "Renaming temp file to output", "temp", tmp.Name(), "output", path)
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		level.Error(logger).Log("msg", "Error renaming tmp file to output", "err", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+// Copyright 2020 Trey Dockendorf
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package textfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestAppendStatus(t *testing.T) {
+	status, err := StatusMetrics(false, prometheus.Labels{"cluster": "test"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	mfs := []*dto.MetricFamily{{
+		Name:   proto.String("gpfs_exporter_collect_success"),
+		Metric: []*dto.Metric{{}},
+	}}
+	mfs = AppendStatus(mfs, status)
+	if len(mfs) != 2 {
+		t.Fatalf("Unexpected number of metric families %d, expected 2", len(mfs))
+	}
+	if val := len(mfs[0].Metric); val != 2 {
+		t.Errorf("Unexpected number of collect success samples %d, expected 2", val)
+	}
+	for _, mf := range status {
+		if label := mf.Metric[0].Label; len(label) != 1 || label[0].GetValue() != "test" {
+			t.Errorf("Unexpected labels %v for %s", label, mf.GetName())
+		}
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.prom")
+	if err := os.WriteFile(path, []byte("old\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(path, []byte("new\n"), log.NewNopLogger()); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "new\n" {
+		t.Errorf("Unexpected content %q", content)
+	}
+	info, _ := os.Stat(path)
+	if info.Mode().Perm() != 0644 {
+		t.Errorf("Unexpected mode %v", info.Mode())
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("Unexpected files left in output directory: %d", len(entries))
+	}
+}